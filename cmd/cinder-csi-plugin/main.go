@@ -38,6 +38,8 @@ var (
 	cloudConfig  []string
 	cluster      string
 	httpEndpoint string
+
+	disableControllerPublish bool
 )
 
 func main() {
@@ -92,6 +94,7 @@ func main() {
 
 	cmd.PersistentFlags().StringVar(&cluster, "cluster", "", "The identifier of the cluster that the plugin is running in.")
 	cmd.PersistentFlags().StringVar(&httpEndpoint, "http-endpoint", "", "The TCP network address where the HTTP server for diagnostics, including metrics and leader election health check, will listen (example: `:8080`). The default is empty string, which means the server is disabled.")
+	cmd.PersistentFlags().BoolVar(&disableControllerPublish, "disable-controller-publish", false, "Disable the ControllerPublishVolume capability, the node plugin attaches the volumes to the node itself. Requires attach-type local, the CSIDriver must not require attach.")
 	openstack.AddExtraFlags(pflag.CommandLine)
 
 	code := cli.Run(cmd)
@@ -108,6 +111,12 @@ func handle() {
 		klog.Warningf("Failed to GetOpenStackProvider: %v", err)
 		return
 	}
+	if disableControllerPublish {
+		if err := d.DisableControllerPublish(cloud.GetBlockStorageOpts().AttachType); err != nil {
+			klog.Fatalf("Invalid --disable-controller-publish: %v", err)
+		}
+	}
+
 	//Initialize mount
 	mount := mount.GetMountProvider()
 
@@ -39,6 +39,7 @@ var (
 	withTopology          bool
 	protoSelector         string
 	fwdEndpoint           string
+	extraFwdEndpoints     map[string]string
 	compatibilitySettings string
 
 	// Node information
@@ -98,22 +99,28 @@ func main() {
 			if err := validateShareProtocolSelector(protoSelector); err != nil {
 				klog.Fatalf(err.Error())
 			}
+			for proto := range extraFwdEndpoints {
+				if err := validateShareProtocolSelector(proto); err != nil {
+					klog.Fatalf(err.Error())
+				}
+			}
 
 			manilaClientBuilder := &manilaclient.ClientBuilder{UserAgent: "manila-csi-plugin", ExtraUserAgentData: userAgentData}
 			csiClientBuilder := &csiclient.ClientBuilder{}
 
 			d, err := manila.NewDriver(
 				&manila.DriverOpts{
-					DriverName:          driverName,
-					NodeID:              nodeID,
-					NodeAZ:              nodeAZ,
-					WithTopology:        withTopology,
-					ShareProto:          protoSelector,
-					ServerCSIEndpoint:   endpoint,
-					FwdCSIEndpoint:      fwdEndpoint,
-					ManilaClientBuilder: manilaClientBuilder,
-					CSIClientBuilder:    csiClientBuilder,
-					ClusterID:           clusterID,
+					DriverName:           driverName,
+					NodeID:               nodeID,
+					NodeAZ:               nodeAZ,
+					WithTopology:         withTopology,
+					ShareProto:           protoSelector,
+					ServerCSIEndpoint:    endpoint,
+					FwdCSIEndpoint:       fwdEndpoint,
+					ExtraFwdCSIEndpoints: extraFwdEndpoints,
+					ManilaClientBuilder:  manilaClientBuilder,
+					CSIClientBuilder:     csiClientBuilder,
+					ClusterID:            clusterID,
 				},
 			)
 
@@ -155,6 +162,8 @@ func main() {
 		klog.Fatalf("Unable to mark flag fwdendpoint to be required: %v", err)
 	}
 
+	cmd.PersistentFlags().StringToStringVar(&extraFwdEndpoints, "extra-fwdendpoints", nil, "additional Manila share protocols to serve, with the CSI Node Plugin endpoints their Node Service RPCs are forwarded to, e.g. NFS=unix:///csi-nfs/csi.sock. StorageClasses select them with the protocol parameter")
+
 	cmd.PersistentFlags().StringVar(&compatibilitySettings, "compatibility-settings", "", "settings for the compatibility layer")
 
 	cmd.PersistentFlags().StringArrayVar(&userAgentData, "user-agent", nil, "extra data to add to gophercloud user-agent. Use multiple times to add more than one component.")
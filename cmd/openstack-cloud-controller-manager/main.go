@@ -48,8 +48,21 @@ func main() {
 		klog.Fatalf("unable to initialize command options: %v", err)
 	}
 
+	controllerInitializers := make(map[string]app.ControllerInitFuncConstructor, len(app.DefaultInitFuncConstructors)+1)
+	for name, constructor := range app.DefaultInitFuncConstructors {
+		controllerInitializers[name] = constructor
+	}
+	// Reconciles the Services of spec.loadBalancerClass handled-class, which the service controller skips. It shares
+	// the identity of the service controller.
+	controllerInitializers[openstack.LoadBalancerClassControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{
+			ClientName: "service-controller",
+		},
+		Constructor: openstack.StartLoadBalancerClassControllerWrapper,
+	}
+
 	fss := cliflag.NamedFlagSets{}
-	command := app.NewCloudControllerManagerCommand(ccmOptions, cloudInitializer, app.DefaultInitFuncConstructors, names.CCMControllerAliases(), fss, wait.NeverStop)
+	command := app.NewCloudControllerManagerCommand(ccmOptions, cloudInitializer, controllerInitializers, names.CCMControllerAliases(), fss, wait.NeverStop)
 
 	openstack.AddExtraFlags(pflag.CommandLine)
 
@@ -75,6 +88,12 @@ func main() {
 func cloudInitializer(config *config.CompletedConfig) cloudprovider.Interface {
 	cloudConfig := config.ComponentConfig.KubeCloudShared.CloudProvider
 
+	// The cluster name is part of the names of the load balancers, without it they can't be told apart from the ones
+	// of other clusters.
+	if config.ComponentConfig.KubeCloudShared.ClusterName == "" {
+		klog.Fatalf("cluster-name must not be empty")
+	}
+
 	// initialize cloud provider with the cloud provider name and config file provided
 	cloud, err := cloudprovider.InitCloudProvider(cloudConfig.Name, cloudConfig.CloudConfigFile)
 	if err != nil {
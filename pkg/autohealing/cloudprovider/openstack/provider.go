@@ -215,7 +215,7 @@ func (provider CloudProvider) waitForServerDetachVolumes(serverID string, timeou
 
 			bootable, err := strconv.ParseBool(volume.Bootable)
 			if err != nil {
-				log.Warningf("Unexpected value for bootable volume %s in volume %s, error %s", volume.Bootable, volume, err)
+				log.Warningf("Unexpected value for bootable volume %s in volume %s, error %s", volume.Bootable, volume.ID, err)
 			}
 
 			log.Infof("volume %s is bootable %t", attachment.VolumeID, bootable)
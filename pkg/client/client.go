@@ -32,7 +32,6 @@ import (
 	"github.com/gophercloud/utils/openstack/clientconfig"
 
 	"k8s.io/apimachinery/pkg/util/net"
-	"k8s.io/client-go/util/cert"
 	"k8s.io/cloud-provider-openstack/pkg/version"
 	"k8s.io/klog/v2"
 )
@@ -54,9 +53,11 @@ type AuthOpts struct {
 	UserDomainID     string                   `gcfg:"user-domain-id" mapstructure:"user-domain-id" name:"os-userDomainID" value:"optional"`
 	UserDomainName   string                   `gcfg:"user-domain-name" mapstructure:"user-domain-name" name:"os-userDomainName" value:"optional"`
 	Region           string                   `name:"os-region"`
+	Regions          []string                 `name:"os-regions" value:"optional"`
 	EndpointType     gophercloud.Availability `gcfg:"os-endpoint-type" mapstructure:"os-endpoint-type" name:"os-endpointType" value:"optional"`
 	CAFile           string                   `gcfg:"ca-file" mapstructure:"ca-file" name:"os-certAuthorityPath" value:"optional"`
 	TLSInsecure      string                   `gcfg:"tls-insecure" mapstructure:"tls-insecure" name:"os-TLSInsecure" value:"optional" matches:"^true|false$"`
+	TLSMinVersion    string                   `gcfg:"tls-min-version" mapstructure:"tls-min-version" name:"os-TLSMinVersion" value:"optional" matches:"^1\\.[23]$"`
 
 	// TLS client auth
 	CertFile string `gcfg:"cert-file" mapstructure:"cert-file" name:"os-clientCertPath" value:"optional" dependsOn:"os-clientKeyPath"`
@@ -88,8 +89,10 @@ func LogCfg(authOpts AuthOpts) {
 	klog.V(5).Infof("UserDomainID: %s", authOpts.UserDomainID)
 	klog.V(5).Infof("UserDomainName: %s", authOpts.UserDomainName)
 	klog.V(5).Infof("Region: %s", authOpts.Region)
+	klog.V(5).Infof("Regions: %s", authOpts.Regions)
 	klog.V(5).Infof("EndpointType: %s", authOpts.EndpointType)
 	klog.V(5).Infof("CAFile: %s", authOpts.CAFile)
+	klog.V(5).Infof("TLSMinVersion: %s", authOpts.TLSMinVersion)
 	klog.V(5).Infof("CertFile: %s", authOpts.CertFile)
 	klog.V(5).Infof("KeyFile: %s", authOpts.KeyFile)
 	klog.V(5).Infof("UseClouds: %t", authOpts.UseClouds)
@@ -251,25 +254,22 @@ func NewOpenStackClient(cfg *AuthOpts, userAgent string, extraUserAgent ...strin
 	provider.UserAgent = ua
 	klog.V(4).Infof("Using user-agent %s", ua.Join())
 
-	var caPool *x509.CertPool
-	if cfg.CAFile != "" {
-		// read and parse CA certificate from file
-		caPool, err = cert.NewPool(cfg.CAFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read and parse %s certificate: %s", cfg.CAFile, err)
-		}
-	} else if cfg.CAFileContents != "" {
+	minVersion, err := parseTLSMinVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: minVersion}
+	config.InsecureSkipVerify = cfg.TLSInsecure == "true"
+	if config.InsecureSkipVerify && (cfg.CAFile != "" || cfg.CAFileContents != "") {
+		klog.Warningf("The server's certificate is not verified as tls-insecure is set, the CA certificate is ignored")
+	}
+
+	if cfg.CAFile == "" && cfg.CAFileContents != "" {
 		// parse CA certificate from the contents
-		caPool = x509.NewCertPool()
+		caPool := x509.NewCertPool()
 		if ok := caPool.AppendCertsFromPEM([]byte(cfg.CAFileContents)); !ok {
 			return nil, fmt.Errorf("failed to parse os-certAuthority certificate")
 		}
-	}
-
-	config := &tls.Config{}
-	config.InsecureSkipVerify = cfg.TLSInsecure == "true"
-
-	if caPool != nil {
 		config.RootCAs = caPool
 	}
 
@@ -282,7 +282,15 @@ func NewOpenStackClient(cfg *AuthOpts, userAgent string, extraUserAgent ...strin
 		config.Certificates = []tls.Certificate{cert}
 	}
 
-	provider.HTTPClient.Transport = net.SetOldTransportDefaults(&http.Transport{TLSClientConfig: config})
+	if cfg.CAFile != "" {
+		// read and parse CA certificate from file, reloaded when the file changes
+		provider.HTTPClient.Transport, err = newCAReloadingTransport(cfg.CAFile, config)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		provider.HTTPClient.Transport = net.SetOldTransportDefaults(&http.Transport{TLSClientConfig: config})
+	}
 
 	if klog.V(6).Enabled() {
 		provider.HTTPClient.Transport = &client.RoundTripper{
@@ -69,3 +69,12 @@ func NewKeyManagerV1(provider *gophercloud.ProviderClient, eo *gophercloud.Endpo
 	}
 	return secret, nil
 }
+
+// NewDNSV2 creates a ServiceClient that can be used with DNS v2 API
+func NewDNSV2(provider *gophercloud.ProviderClient, eo *gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error) {
+	dns, err := openstack.NewDNSV2(provider, *eo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize dns client for region %s: %v", eo.Region, err)
+	}
+	return dns, nil
+}
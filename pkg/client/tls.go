@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+)
+
+// caReloadInterval is how often the CA file is checked for changes at most.
+const caReloadInterval = time.Minute
+
+// tlsVersions are the supported values of tls-min-version. The older versions are insecure.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSMinVersion returns the TLS version of tls-min-version, 0 if it isn't set and the Go default is used.
+func parseTLSMinVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported tls-min-version %q, supported values are \"1.2\" and \"1.3\"", version)
+	}
+	return v, nil
+}
+
+// caReloadingTransport sends the requests with a transport trusting the certificates of the CA file, rebuilt when the
+// file changes, e.g. when the CA bundle of a mounted Secret is rotated. The connections already established are kept,
+// the new ones are verified with the new certificates. An unreadable or invalid file is ignored until it's fixed.
+type caReloadingTransport struct {
+	caFile string
+	// config is the TLS config of the transports, without the root CAs.
+	config   *tls.Config
+	interval time.Duration
+
+	mu        sync.Mutex
+	transport *http.Transport
+	modTime   time.Time
+	size      int64
+	nextCheck time.Time
+}
+
+func newCAReloadingTransport(caFile string, config *tls.Config) (*caReloadingTransport, error) {
+	t := &caReloadingTransport{
+		caFile:   caFile,
+		config:   config,
+		interval: caReloadInterval,
+	}
+	info, err := os.Stat(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read and parse %s certificate: %s", caFile, err)
+	}
+	if err := t.load(info); err != nil {
+		return nil, err
+	}
+	t.nextCheck = time.Now().Add(t.interval)
+	return t, nil
+}
+
+func (t *caReloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current().RoundTrip(req)
+}
+
+// current returns the transport of the current certificates of the CA file, reloading them if the file changed.
+func (t *caReloadingTransport) current() *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(t.nextCheck) {
+		return t.transport
+	}
+	t.nextCheck = now.Add(t.interval)
+
+	info, err := os.Stat(t.caFile)
+	if err != nil {
+		klog.Warningf("Failed to check CA file %s for changes, keeping the current certificates: %v", t.caFile, err)
+		return t.transport
+	}
+	if info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return t.transport
+	}
+	if err := t.load(info); err != nil {
+		klog.Warningf("Failed to reload CA file %s, keeping the current certificates: %v", t.caFile, err)
+	}
+	return t.transport
+}
+
+// load builds the transport trusting the certificates of the CA file, whose info is recorded to detect its changes.
+func (t *caReloadingTransport) load(info os.FileInfo) error {
+	pool, err := cert.NewPool(t.caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read and parse %s certificate: %s", t.caFile, err)
+	}
+	config := t.config.Clone()
+	config.RootCAs = pool
+
+	previous := t.transport
+	t.transport = net.SetOldTransportDefaults(&http.Transport{TLSClientConfig: config})
+	t.modTime = info.ModTime()
+	t.size = info.Size()
+	if previous != nil {
+		klog.Infof("Reloaded CA certificates from %s", t.caFile)
+		previous.CloseIdleConnections()
+	}
+	return nil
+}
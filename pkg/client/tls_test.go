@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/cert"
+)
+
+func TestParseTLSMinVersion(t *testing.T) {
+	version, err := parseTLSMinVersion("")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), version)
+
+	version, err = parseTLSMinVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = parseTLSMinVersion("1.0")
+	assert.EqualError(t, err, `unsupported tls-min-version "1.0", supported values are "1.2" and "1.3"`)
+}
+
+func TestCAReloadingTransport(t *testing.T) {
+	writeCA := func(path, host string, modTime time.Time) {
+		ca, _, err := cert.GenerateSelfSignedCertKey(host, nil, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(path, ca, 0600))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	modTime := time.Now().Add(-time.Hour)
+	writeCA(caFile, "keystone.example.com", modTime)
+
+	_, err := newCAReloadingTransport(filepath.Join(t.TempDir(), "missing.crt"), &tls.Config{})
+	assert.Error(t, err)
+
+	transport, err := newCAReloadingTransport(caFile, &tls.Config{MinVersion: tls.VersionTLS12})
+	assert.NoError(t, err)
+	initial := transport.current()
+	assert.NotNil(t, initial.TLSClientConfig.RootCAs)
+	assert.Equal(t, uint16(tls.VersionTLS12), initial.TLSClientConfig.MinVersion)
+
+	// The file isn't checked again before the interval elapses.
+	writeCA(caFile, "keystone-rotated.example.com", modTime.Add(time.Minute))
+	assert.Same(t, initial, transport.current())
+
+	transport.nextCheck = time.Time{}
+	rotated := transport.current()
+	assert.NotSame(t, initial, rotated)
+	assert.False(t, initial.TLSClientConfig.RootCAs.Equal(rotated.TLSClientConfig.RootCAs))
+	assert.Equal(t, uint16(tls.VersionTLS12), rotated.TLSClientConfig.MinVersion)
+
+	// An invalid file is ignored, the current certificates are kept.
+	assert.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+	transport.nextCheck = time.Time{}
+	assert.Same(t, rotated, transport.current())
+}
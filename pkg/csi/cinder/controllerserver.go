@@ -17,17 +17,24 @@ limitations under the License.
 package cinder
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
 	"k8s.io/cloud-provider-openstack/pkg/util"
@@ -38,14 +45,45 @@ import (
 type controllerServer struct {
 	Driver *Driver
 	Cloud  openstack.IOpenStack
+	csi.UnimplementedControllerServer
 }
 
 const (
 	cinderCSIClusterIDKey = "cinder.csi.openstack.org/cluster"
+	// The snapshot a volume was restored from through a backup, see createVolumeFromSnapshotCopy
+	snapshotCopySourceKey = "cinder.csi.openstack.org/source-snapshot"
+
+	// StorageClass parameters
+	mkfsOptionsKey = "mkfsOptions"
+	// Prefix of the Cinder scheduler hints, e.g. schedulerHint.different_host
+	schedulerHintKeyPrefix = "schedulerHint."
+	// Provisioning of the volumes, thin or thick, also passed in the volume context
+	provisioningKey   = "provisioning"
+	provisioningThin  = "thin"
+	provisioningThick = "thick"
+	// Comma separated availability zones tried in order when the requested one can't provision the volume
+	fallbackAvailabilitiesKey = "fallbackAvailabilities"
+
+	// VolumeAttributesClass parameters
+	mutableVolumeTypeKey      = "type"
+	mutableQoSKey             = "qos"
+	mutableMigrationPolicyKey = "migrationPolicy"
+
+	// Volume type extra spec selecting the backend of the volumes
+	volumeBackendNameKey = "volume_backend_name"
+	// Volume type extra spec of the provisioning of the volumes, Cinder provisions thin volumes when it isn't set
+	provisioningTypeKey = "provisioning:type"
+
+	// Publish context
+	attachModeKey       = "AttachMode"
+	attachModeReadOnly  = "ro"
+	attachModeReadWrite = "rw"
+	// The node connects to the volumes attached locally on its own, see openstack.AttachTypeLocal
+	attachTypeKey = "AttachType"
 )
 
 func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
-	klog.V(4).Infof("CreateVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("CreateVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	// Volume Name
 	volName := req.GetName()
@@ -69,6 +107,46 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	// Volume Type
 	volType := req.GetParameters()["type"]
 
+	// A VolumeAttributesClass type takes precedence over the StorageClass one
+	if len(req.GetMutableParameters()) > 0 {
+		params, err := parseMutableParameters(req.GetMutableParameters())
+		if err != nil {
+			return nil, err
+		}
+		if params.volumeType != "" || params.qos != "" {
+			vtype, err := cs.resolveVolumeType(params)
+			if err != nil {
+				return nil, err
+			}
+			volType = vtype.Name
+		}
+	}
+
+	// The volume type has to provision the volumes as requested, one is picked if it isn't set
+	provisioning := req.GetParameters()[provisioningKey]
+	if provisioning != "" {
+		vtype, err := cs.resolveProvisioningVolumeType(volType, provisioning)
+		if err != nil {
+			return nil, err
+		}
+		volType = vtype
+	}
+
+	// The mkfs options are passed to NodeStageVolume in the volume context
+	var volCtx map[string]string
+	if mkfsOpts := req.GetParameters()[mkfsOptionsKey]; mkfsOpts != "" {
+		if _, err := parseMkfsOptions(getVolumeCapabilitiesFsType(volCapabilities), mkfsOpts); err != nil {
+			return nil, err
+		}
+		volCtx = map[string]string{mkfsOptionsKey: mkfsOpts}
+	}
+	if provisioning != "" {
+		if volCtx == nil {
+			volCtx = make(map[string]string)
+		}
+		volCtx[provisioningKey] = provisioning
+	}
+
 	// First check if volAvailability is already specified, if not get preferred from Topology
 	// Required, incase vol AZ is different from node AZ
 	volAvailability := req.GetParameters()["availability"]
@@ -79,6 +157,11 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
+	schedulerHints, err := parseSchedulerHints(req.GetParameters())
+	if err != nil {
+		return nil, err
+	}
+
 	cloud := cs.Cloud
 	ignoreVolumeAZ := cloud.GetBlockStorageOpts().IgnoreVolumeAZ
 
@@ -94,7 +177,12 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 			return nil, status.Error(codes.AlreadyExists, "Volume Already exists with same name and different capacity")
 		}
 		klog.V(4).Infof("Volume %s already exists in Availability Zone: %s of size %d GiB", volumes[0].ID, volumes[0].AvailabilityZone, volumes[0].Size)
-		return getCreateVolumeResponse(&volumes[0], ignoreVolumeAZ, req.GetAccessibilityRequirements()), nil
+		if volumes[0].Metadata[snapshotCopySourceKey] != "" {
+			if err := cs.finishSnapshotCopy(&volumes[0]); err != nil {
+				return nil, err
+			}
+		}
+		return getCreateVolumeResponse(&volumes[0], volCtx, ignoreVolumeAZ, req.GetAccessibilityRequirements()), nil
 	} else if len(volumes) > 1 {
 		klog.V(3).Infof("found multiple existing volumes with selected name (%s) during create", volName)
 		return nil, status.Error(codes.Internal, "Multiple volumes reported by Cinder with same name")
@@ -115,13 +203,28 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 
 	if content != nil && content.GetSnapshot() != nil {
 		snapshotID = content.GetSnapshot().GetSnapshotId()
-		_, err := cloud.GetSnapshotByID(snapshotID)
+		snap, err := cloud.GetSnapshotByID(snapshotID)
 		if err != nil {
 			if cpoerrors.IsNotFound(err) {
 				return nil, status.Errorf(codes.NotFound, "VolumeContentSource Snapshot %s not found", snapshotID)
 			}
 			return nil, status.Errorf(codes.Internal, "Failed to retrieve the snapshot %s: %v", snapshotID, err)
 		}
+
+		// Cinder only restores a snapshot in the availability zone of its volume
+		if volAvailability != "" && cloud.GetBlockStorageOpts().CrossAZSnapshotCopy {
+			srcVol, err := cloud.GetVolume(snap.VolumeID)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "Failed to retrieve the volume %s of the snapshot %s: %v", snap.VolumeID, snapshotID, err)
+			}
+			if srcVol.AvailabilityZone != volAvailability {
+				vol, err := cs.createVolumeFromSnapshotCopy(volName, volSizeGB, volType, volAvailability, snap, srcVol.AvailabilityZone, properties)
+				if err != nil {
+					return nil, err
+				}
+				return getCreateVolumeResponse(vol, volCtx, ignoreVolumeAZ, req.GetAccessibilityRequirements()), nil
+			}
+		}
 	}
 
 	if content != nil && content.GetVolume() != nil {
@@ -135,21 +238,157 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
-	vol, err := cloud.CreateVolume(volName, volSizeGB, volType, volAvailability, snapshotID, sourcevolID, &properties)
+	// The volumes restored from a snapshot or cloned from a volume can't be created in another availability zone
+	var fallbacks []string
+	if snapshotID == "" && sourcevolID == "" {
+		fallbacks = getFallbackAvailabilities(req.GetParameters(), volAvailability, req.GetAccessibilityRequirements(), ignoreVolumeAZ)
+	}
 
+	vol, err := cs.createVolumeWithFallback(volName, volSizeGB, volType, volAvailability, fallbacks, snapshotID, sourcevolID, properties, schedulerHints)
 	if err != nil {
-		klog.Errorf("Failed to CreateVolume: %v", err)
-		return nil, status.Error(codes.Internal, fmt.Sprintf("CreateVolume failed with error %v", err))
-
+		return nil, err
 	}
 
 	klog.V(4).Infof("CreateVolume: Successfully created volume %s in Availability Zone: %s of size %d GiB", vol.ID, vol.AvailabilityZone, vol.Size)
 
-	return getCreateVolumeResponse(vol, ignoreVolumeAZ, req.GetAccessibilityRequirements()), nil
+	return getCreateVolumeResponse(vol, volCtx, ignoreVolumeAZ, req.GetAccessibilityRequirements()), nil
+}
+
+// createVolumeWithFallback creates the volume in the availability zone, or in the first of the fallback zones able to
+// provision it. With fallback zones, the volume is waited for until it's available: a volume ending up in error, e.g.
+// as no backend of the zone has the capacity for it, is deleted and created again in the next zone.
+func (cs *controllerServer) createVolumeWithFallback(name string, size int, vtype, availability string, fallbacks []string, snapshotID, sourceVolID string, properties map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error) {
+	cloud := cs.Cloud
+	zones := append([]string{availability}, fallbacks...)
+	for _, zone := range zones {
+		vol, err := cloud.CreateVolume(name, size, vtype, zone, snapshotID, sourceVolID, &properties, schedulerHints)
+		if err != nil {
+			klog.Errorf("Failed to CreateVolume: %v", err)
+			return nil, cs.createVolumeError(err, "CreateVolume failed with error %v", err)
+		}
+		if len(fallbacks) == 0 {
+			return vol, nil
+		}
+
+		waitErr := cloud.WaitVolumeTargetStatus(vol.ID, []string{openstack.VolumeAvailableStatus})
+		if waitErr == nil {
+			if zone != availability {
+				klog.Infof("CreateVolume: volume %s created in fallback Availability Zone: %s", vol.ID, zone)
+			}
+			return vol, nil
+		}
+		// A volume still being created, e.g. past the timeout, is found by name by the retries.
+		failed, err := cloud.GetVolume(vol.ID)
+		if err != nil || failed.Status != openstack.VolumeErrorStatus {
+			return nil, status.Errorf(codes.Internal, "CreateVolume failed waiting for volume %s: %v", vol.ID, waitErr)
+		}
+
+		// The failed volume is deleted for the retries to find the new one by name.
+		klog.Warningf("CreateVolume: volume %s failed in Availability Zone: %s: %v", vol.ID, zone, waitErr)
+		if err := cloud.DeleteVolume(vol.ID); err != nil {
+			return nil, status.Errorf(codes.Internal, "CreateVolume failed to delete volume %s failed in Availability Zone %s: %v", vol.ID, zone, err)
+		}
+	}
+	return nil, status.Errorf(codes.ResourceExhausted, "CreateVolume failed in Availability Zones %v, none of them could provision the volume", zones)
+}
+
+// createVolumeError returns the status of a volume creation Cinder failed. The ones exceeding the quota of the project
+// are ResourceExhausted, which the provisioner retries with backoff, so that the volume gets created once the quota is
+// raised. The message of the error is the one of the event of the PVC meanwhile. A volume larger than the size limit of
+// a single volume is out of range, it's never going to fit.
+func (cs *controllerServer) createVolumeError(err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	switch {
+	case openstack.IsVolumeSizeLimitExceeded(err):
+		return status.Errorf(codes.OutOfRange, "%s: the volume is larger than the size limit of a single volume", msg)
+	case openstack.IsQuotaExceeded(err) && !cs.Cloud.GetBlockStorageOpts().FailOnQuotaExceeded:
+		return status.Errorf(codes.ResourceExhausted, "%s: the quota of the project is exceeded, the creation is retried until it's raised", msg)
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+// createVolumeFromSnapshotCopy copies the snapshot to another availability zone than the one of its volume: the snapshot
+// is backed up and the backup is restored to the new volume. The backup is named after the volume, so that the retries
+// of CreateVolume find it again, e.g. after a timeout waiting for it, and deleted once the volume is restored.
+func (cs *controllerServer) createVolumeFromSnapshotCopy(name string, size int, vtype, availability string, snap *snapshots.Snapshot, snapAvailability string, properties map[string]string) (*volumes.Volume, error) {
+	cloud := cs.Cloud
+	backups, err := cloud.GetBackupsByName(name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to get backups: %v", err)
+	}
+	if len(backups) > 1 {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] multiple backups reported by Cinder with name %s", name)
+	}
+
+	var backupID string
+	if len(backups) == 1 {
+		backupID = backups[0].ID
+	} else {
+		klog.Infof("CreateVolume: copying snapshot %s from Availability Zone: %s to %s with a backup", snap.ID, snapAvailability, availability)
+		backup, err := cloud.CreateBackup(name, snap.VolumeID, snap.ID, properties)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to back up snapshot %s: %v", snap.ID, err)
+		}
+		backupID = backup.ID
+	}
+
+	if err := cloud.WaitBackupReady(backupID); err != nil {
+		if errors.Is(err, openstack.ErrWaitTimeout) {
+			return nil, status.Errorf(codes.DeadlineExceeded, "[CreateVolume] copy of snapshot %s to Availability Zone: %s in progress: %v", snap.ID, availability, err)
+		}
+		// The copy starts over on retry
+		if derr := cloud.DeleteBackup(backupID); derr != nil {
+			klog.Warningf("Failed to delete failed backup %s of snapshot %s: %v", backupID, snap.ID, derr)
+		}
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to back up snapshot %s: %v", snap.ID, err)
+	}
+
+	volProperties := map[string]string{snapshotCopySourceKey: snap.ID}
+	for k, v := range properties {
+		volProperties[k] = v
+	}
+	vol, err := cloud.CreateVolumeFromBackup(name, size, vtype, availability, backupID, volProperties)
+	if err != nil {
+		return nil, cs.createVolumeError(err, "[CreateVolume] failed to restore backup %s of snapshot %s: %v", backupID, snap.ID, err)
+	}
+	klog.V(4).Infof("CreateVolume: restoring backup %s of snapshot %s to volume %s in Availability Zone: %s", backupID, snap.ID, vol.ID, vol.AvailabilityZone)
+
+	if err := cs.finishSnapshotCopy(vol); err != nil {
+		return nil, err
+	}
+	return vol, nil
+}
+
+// finishSnapshotCopy deletes the backup the volume is restored from once the volume is available, Cinder refuses to
+// delete it before. An error is returned while the volume is being restored, CreateVolume is retried until it's done.
+func (cs *controllerServer) finishSnapshotCopy(vol *volumes.Volume) error {
+	backups, err := cs.Cloud.GetBackupsByName(vol.Name)
+	if err != nil {
+		return status.Errorf(codes.Internal, "[CreateVolume] failed to get backups: %v", err)
+	}
+	if len(backups) == 0 {
+		return nil
+	}
+
+	switch vol.Status {
+	case openstack.VolumeAvailableStatus:
+	case openstack.VolumeErrorStatus:
+		return status.Errorf(codes.Internal, "[CreateVolume] failed to restore volume %s from backup %s, volume is in %s status", vol.ID, backups[0].ID, vol.Status)
+	default:
+		return status.Errorf(codes.DeadlineExceeded, "[CreateVolume] copy of snapshot %s in progress: volume %s is %s", vol.Metadata[snapshotCopySourceKey], vol.ID, vol.Status)
+	}
+
+	for _, backup := range backups {
+		if err := cs.Cloud.DeleteBackup(backup.ID); err != nil && !cpoerrors.IsNotFound(err) {
+			return status.Errorf(codes.Internal, "[CreateVolume] failed to delete backup %s: %v", backup.ID, err)
+		}
+		klog.V(4).Infof("CreateVolume: deleted backup %s, volume %s is restored", backup.ID, vol.ID)
+	}
+	return nil
 }
 
 func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
-	klog.V(4).Infof("DeleteVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("DeleteVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	// Volume Delete
 	volID := req.GetVolumeId()
@@ -172,7 +411,11 @@ func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 }
 
 func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
-	klog.V(4).Infof("ControllerPublishVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("ControllerPublishVolume: called with args %+v", protosanitizer.StripSecrets(req))
+
+	if cs.Driver.controllerPublishDisabled {
+		return nil, status.Error(codes.Unimplemented, "[ControllerPublishVolume] controller publish is disabled, the volumes are attached by the node plugin")
+	}
 
 	// Volume Attach
 	instanceID := req.GetNodeId()
@@ -189,7 +432,7 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Error(codes.InvalidArgument, "[ControllerPublishVolume] Volume capability must be provided")
 	}
 
-	_, err := cs.Cloud.GetVolume(volumeID)
+	vol, err := cs.Cloud.GetVolume(volumeID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
 			return nil, status.Errorf(codes.NotFound, "[ControllerPublishVolume] Volume %s not found", volumeID)
@@ -197,6 +440,14 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] get volume failed with error %v", err))
 	}
 
+	localAttach, err := cs.isLocalAttach(instanceID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] GetInstanceByID failed with error %v", err))
+	}
+	if localAttach {
+		return cs.publishVolumeToHost(vol, instanceID, req.GetReadonly())
+	}
+
 	_, err = cs.Cloud.GetInstanceByID(instanceID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
@@ -205,9 +456,36 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] GetInstanceByID failed with error %v", err))
 	}
 
+	detached, err := cs.detachStaleAttachments(vol, instanceID)
+	if err != nil {
+		klog.Errorf("Failed to detach stale attachments: %v", err)
+		if errors.Is(err, openstack.ErrWaitTimeout) {
+			return nil, status.Error(codes.DeadlineExceeded, fmt.Sprintf("[ControllerPublishVolume] failed to detach stale attachments: %v", err))
+		}
+		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] failed to detach stale attachments: %v", err))
+	}
+	if detached {
+		vol, err = cs.Cloud.GetVolume(volumeID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] get volume failed with error %v", err))
+		}
+	}
+
+	attachMode, err := cs.setAttachMode(vol, req.GetReadonly())
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = cs.Cloud.AttachVolume(instanceID, volumeID)
 	if err != nil {
 		klog.Errorf("Failed to AttachVolume: %v", err)
+		if errors.Is(err, openstack.ErrVolumeAttachConflict) {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("[ControllerPublishVolume] Attach Volume failed with error %v", err))
+		}
+		if errors.Is(err, openstack.ErrWaitTimeout) {
+			// The volume is still reserved by another attach, external-attacher retries on non-final errors
+			return nil, status.Error(codes.DeadlineExceeded, fmt.Sprintf("[ControllerPublishVolume] Attach Volume failed with error %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] Attach Volume failed with error %v", err))
 
 	}
@@ -215,6 +493,10 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 	err = cs.Cloud.WaitDiskAttached(instanceID, volumeID)
 	if err != nil {
 		klog.Errorf("Failed to WaitDiskAttached: %v", err)
+		if errors.Is(err, openstack.ErrWaitTimeout) {
+			// The attachment may still be in progress, external-attacher retries on non-final errors
+			return nil, status.Error(codes.DeadlineExceeded, fmt.Sprintf("[ControllerPublishVolume] failed to attach volume: %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] failed to attach volume: %v", err))
 	}
 
@@ -229,14 +511,149 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 	// Publish Volume Info
 	pvInfo := map[string]string{}
 	pvInfo["DevicePath"] = devicePath
+	pvInfo[attachModeKey] = attachMode
 
 	return &csi.ControllerPublishVolumeResponse{
 		PublishContext: pvInfo,
 	}, nil
 }
 
+// isLocalAttach tells if the volumes are attached locally on the node rather than with Nova, see attach-type. With the
+// auto attach type, it's the case of the nodes that aren't Nova instances.
+func (cs *controllerServer) isLocalAttach(nodeID string) (bool, error) {
+	switch cs.Cloud.GetBlockStorageOpts().AttachType {
+	case openstack.AttachTypeLocal:
+		return true, nil
+	case openstack.AttachTypeAuto:
+		_, err := cs.Cloud.GetInstanceByID(nodeID)
+		if cpoerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// publishVolumeToHost attaches the volume to a node that isn't a Nova instance. The volume is only marked as attached
+// to the host in Cinder, the node connects to it on its own when staging it.
+func (cs *controllerServer) publishVolumeToHost(vol *volumes.Volume, hostName string, readOnly bool) (*csi.ControllerPublishVolumeResponse, error) {
+	attachMode, err := cs.setAttachMode(vol, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cs.Cloud.AttachVolumeToHost(vol.ID, hostName)
+	if err != nil {
+		klog.Errorf("Failed to AttachVolumeToHost: %v", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerPublishVolume] Attach Volume failed with error %v", err))
+	}
+
+	klog.V(4).Infof("ControllerPublishVolume %s on host %s is successful", vol.ID, hostName)
+
+	return &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{
+			attachModeKey: attachMode,
+			attachTypeKey: openstack.AttachTypeLocal,
+		},
+	}, nil
+}
+
+// detachStaleAttachments force-detaches the volume from the other instances that have been down for longer than
+// force-detach-grace-period, so that a volume left attached to a dead node can be attached to instanceID. The
+// instances are judged by Nova rather than by the Kubernetes nodes: a NotReady node may still be running and writing
+// to the volume, e.g. when it's only cut off from the API server. Multi-attach volumes are never force-detached, the
+// other instances may still use them. It returns true if any attachment was detached.
+func (cs *controllerServer) detachStaleAttachments(vol *volumes.Volume, instanceID string) (bool, error) {
+	gracePeriod := cs.Cloud.GetBlockStorageOpts().ForceDetachGracePeriod.Duration
+	if gracePeriod <= 0 || vol.Multiattach {
+		return false, nil
+	}
+
+	detached := false
+	for _, att := range vol.Attachments {
+		if att.ServerID == "" || att.ServerID == instanceID {
+			continue
+		}
+
+		server, err := cs.Cloud.GetInstanceByID(att.ServerID)
+		deleted := cpoerrors.IsNotFound(err)
+		if err != nil && !deleted {
+			return detached, fmt.Errorf("failed to get instance %s the volume %s is attached to: %v", att.ServerID, vol.ID, err)
+		}
+		if !deleted && !isInstanceDown(server, gracePeriod, time.Now()) {
+			continue
+		}
+
+		klog.Warningf("Force-detaching volume %s from instance %s that is down, to attach it to instance %s", vol.ID, att.ServerID, instanceID)
+		if deleted {
+			err = cs.Cloud.DetachVolumeAttachment(vol.ID, att.AttachmentID)
+		} else {
+			err = cs.Cloud.DetachVolume(att.ServerID, vol.ID)
+		}
+		if err != nil {
+			return detached, err
+		}
+		if err := cs.Cloud.WaitDiskDetached(att.ServerID, vol.ID); err != nil {
+			return detached, err
+		}
+		detached = true
+	}
+	return detached, nil
+}
+
+// isInstanceDown tells if the instance has been shut off or deleted for longer than the grace period. The time of its
+// last update is when it entered that state.
+func isInstanceDown(server *servers.Server, gracePeriod time.Duration, now time.Time) bool {
+	if server == nil {
+		return false
+	}
+	switch server.Status {
+	case "SHUTOFF", "DELETED", "SOFT_DELETED":
+		return now.Sub(server.Updated) >= gracePeriod
+	}
+	return false
+}
+
+// setAttachMode sets the readonly flag of the volume, so that Nova attaches it read-only if the publish is read-only
+// and read-write otherwise. The flag can't be changed while the volume is attached and the cloud may not allow
+// changing it at all. In that case a read-only publish falls back to a read-write attachment, which is then only
+// mounted read-only on the node. It returns the attach mode that's used.
+func (cs *controllerServer) setAttachMode(vol *volumes.Volume, readOnly bool) (string, error) {
+	if strings.EqualFold(vol.Metadata[openstack.VolumeReadOnlyKey], "true") == readOnly {
+		if readOnly {
+			return attachModeReadOnly, nil
+		}
+		return attachModeReadWrite, nil
+	}
+
+	if vol.Status != openstack.VolumeAvailableStatus {
+		if readOnly {
+			klog.V(3).Infof("ControllerPublishVolume: volume %s is %s, attaching it read-write and relying on a read-only mount", vol.ID, vol.Status)
+			return attachModeReadWrite, nil
+		}
+		return "", status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] volume %s is attached read-only, it can't be attached read-write", vol.ID)
+	}
+
+	if err := cs.Cloud.SetVolumeReadOnly(vol.ID, readOnly); err != nil {
+		if readOnly {
+			klog.Warningf("ControllerPublishVolume: failed to set volume %s read-only, attaching it read-write and relying on a read-only mount: %v", vol.ID, err)
+			return attachModeReadWrite, nil
+		}
+		return "", status.Errorf(codes.Internal, "[ControllerPublishVolume] failed to unset the readonly flag of volume %s: %v", vol.ID, err)
+	}
+
+	if readOnly {
+		return attachModeReadOnly, nil
+	}
+	return attachModeReadWrite, nil
+}
+
 func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
-	klog.V(4).Infof("ControllerUnpublishVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("ControllerUnpublishVolume: called with args %+v", protosanitizer.StripSecrets(req))
+
+	if cs.Driver.controllerPublishDisabled {
+		return nil, status.Error(codes.Unimplemented, "[ControllerUnpublishVolume] controller publish is disabled, the volumes are detached by the node plugin")
+	}
 
 	// Volume Detach
 	instanceID := req.GetNodeId()
@@ -245,7 +662,26 @@ func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "[ControllerUnpublishVolume] Volume ID must be provided")
 	}
-	_, err := cs.Cloud.GetInstanceByID(instanceID)
+
+	localAttach, err := cs.isLocalAttach(instanceID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerUnpublishVolume] GetInstanceByID failed with error %v", err))
+	}
+	if localAttach {
+		err = cs.Cloud.DetachVolumeFromHost(volumeID, instanceID)
+		if err != nil {
+			if cpoerrors.IsNotFound(err) {
+				klog.V(3).Infof("ControllerUnpublishVolume assuming volume %s is detached, because it does not exist", volumeID)
+				return &csi.ControllerUnpublishVolumeResponse{}, nil
+			}
+			klog.Errorf("Failed to DetachVolumeFromHost: %v", err)
+			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume Detach Volume failed with error %v", err))
+		}
+		klog.V(4).Infof("ControllerUnpublishVolume %s on host %s", volumeID, instanceID)
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	_, err = cs.Cloud.GetInstanceByID(instanceID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
 			klog.V(3).Infof("ControllerUnpublishVolume assuming volume %s is detached, because node %s does not exist", volumeID, instanceID)
@@ -271,6 +707,9 @@ func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *
 			klog.V(3).Infof("ControllerUnpublishVolume assuming volume %s is detached, because it was deleted in the meanwhile", volumeID)
 			return &csi.ControllerUnpublishVolumeResponse{}, nil
 		}
+		if errors.Is(err, openstack.ErrWaitTimeout) {
+			return nil, status.Error(codes.DeadlineExceeded, fmt.Sprintf("ControllerUnpublishVolume failed with error %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume failed with error %v", err))
 	}
 
@@ -306,12 +745,15 @@ func (cs *controllerServer) ListVolumes(ctx context.Context, req *csi.ListVolume
 			},
 		}
 
-		status := &csi.ListVolumesResponse_VolumeStatus{}
-		status.PublishedNodeIds = make([]string, 0, len(v.Attachments))
-		for _, attachment := range v.Attachments {
-			status.PublishedNodeIds = append(status.PublishedNodeIds, attachment.ServerID)
+		// The published nodes are only reported with LIST_VOLUMES_PUBLISHED_NODES
+		if !cs.Driver.controllerPublishDisabled {
+			status := &csi.ListVolumesResponse_VolumeStatus{}
+			status.PublishedNodeIds = make([]string, 0, len(v.Attachments))
+			for _, attachment := range v.Attachments {
+				status.PublishedNodeIds = append(status.PublishedNodeIds, attachment.ServerID)
+			}
+			ventry.Status = status
 		}
-		ventry.Status = status
 
 		ventries = append(ventries, &ventry)
 	}
@@ -324,7 +766,7 @@ func (cs *controllerServer) ListVolumes(ctx context.Context, req *csi.ListVolume
 }
 
 func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	klog.V(4).Infof("CreateSnapshot: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("CreateSnapshot: called with args %+v", protosanitizer.StripSecrets(req))
 
 	name := req.Name
 	volumeID := req.GetSourceVolumeId()
@@ -392,6 +834,11 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	err = cs.Cloud.WaitSnapshotReady(snap.ID)
 	if err != nil {
 		klog.Errorf("Failed to WaitSnapshotReady: %v", err)
+		if errors.Is(err, openstack.ErrWaitTimeout) {
+			// The snapshot is still being created, external-snapshotter retries on non-final errors and the retry
+			// finds it by name instead of creating another one
+			return nil, status.Error(codes.DeadlineExceeded, fmt.Sprintf("CreateSnapshot failed with error %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("CreateSnapshot failed with error %v", err))
 	}
 
@@ -407,7 +854,7 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 }
 
 func (cs *controllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	klog.V(4).Infof("DeleteSnapshot: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("DeleteSnapshot: called with args %+v", protosanitizer.StripSecrets(req))
 
 	id := req.GetSnapshotId()
 
@@ -557,12 +1004,41 @@ func (cs *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req
 	return resp, nil
 }
 
+// GetCapacity reports the free space of the Cinder pools where volumes with the given volume type can be created in the
+// availability zone of the topology segment, as seen by the Cinder scheduler.
 func (cs *controllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "GetCapacity is not yet implemented")
+	klog.V(4).Infof("GetCapacity: called with args %+v", protosanitizer.StripSecrets(req))
+
+	// The availability parameter takes precedence over the topology, like in CreateVolume. The topology segments are
+	// the availability zones of the nodes, which don't match the ones of the volumes when ignore-volume-az is set.
+	zone := req.GetParameters()["availability"]
+	if zone == "" && !cs.Cloud.GetBlockStorageOpts().IgnoreVolumeAZ {
+		zone = req.GetAccessibleTopology().GetSegments()[topologyKey]
+	}
+
+	// Volume types without a volume_backend_name extra spec can be scheduled to any backend
+	var backendName string
+	if volType := req.GetParameters()["type"]; volType != "" {
+		vtype, err := cs.Cloud.GetVolumeType(volType)
+		if err != nil {
+			if cpoerrors.IsNotFound(err) {
+				return nil, status.Errorf(codes.InvalidArgument, "volume type %s not found", volType)
+			}
+			return nil, status.Errorf(codes.Internal, "failed to get volume type %s: %v", volType, err)
+		}
+		backendName = vtype.ExtraSpecs[volumeBackendNameKey]
+	}
+
+	pools, err := cs.Cloud.GetStoragePools()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get the Cinder pools: %v", err)
+	}
+
+	return getPoolsCapacity(pools, zone, backendName), nil
 }
 
 func (cs *controllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	klog.V(4).Infof("ControllerGetVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("ControllerGetVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 
@@ -596,7 +1072,7 @@ func (cs *controllerServer) ControllerGetVolume(ctx context.Context, req *csi.Co
 }
 
 func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	klog.V(4).Infof("ControllerExpandVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("ControllerExpandVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -653,7 +1129,90 @@ func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi
 	}, nil
 }
 
-func getCreateVolumeResponse(vol *volumes.Volume, ignoreVolumeAZ bool, accessibleTopologyReq *csi.TopologyRequirement) *csi.CreateVolumeResponse {
+func (cs *controllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	klog.V(4).Infof("ControllerModifyVolume: called with args %+v", protosanitizer.StripSecrets(req))
+
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
+	}
+
+	params, err := parseMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, err
+	}
+	if params.volumeType == "" && params.qos == "" {
+		return nil, status.Error(codes.InvalidArgument, "[ControllerModifyVolume] missing volume type or QoS parameter")
+	}
+
+	volume, err := cs.Cloud.GetVolume(volumeID)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "Volume %s not found", volumeID)
+		}
+		return nil, status.Error(codes.Internal, fmt.Sprintf("GetVolume failed with error %v", err))
+	}
+
+	vtype, err := cs.resolveVolumeType(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if volume.VolumeType == vtype.Name {
+		klog.V(2).Infof("Volume %q is already of type %q", volumeID, vtype.Name)
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	}
+
+	switch volume.Status {
+	case openstack.VolumeAvailableStatus:
+	case openstack.VolumeInUseStatus:
+		// Cinder refuses to retype multiattach volumes while they're attached.
+		if volume.Multiattach {
+			return nil, status.Errorf(codes.FailedPrecondition, "[ControllerModifyVolume] multiattach volume %s cannot be retyped while in-use", volumeID)
+		}
+	case openstack.VolumeRetypingStatus:
+		return nil, status.Errorf(codes.Aborted, "[ControllerModifyVolume] volume %s is still being retyped", volumeID)
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "[ControllerModifyVolume] volume %s cannot be retyped, its status is %s", volumeID, volume.Status)
+	}
+
+	err = cs.Cloud.ChangeVolumeType(volumeID, vtype.Name, params.migrationPolicy)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Could not retype volume %q to %q: %v", volumeID, vtype.Name, err))
+	}
+
+	// Retyping is asynchronous, the volume goes back to its previous status once it's done, whether it succeeded or not.
+	targetStatus := []string{openstack.VolumeAvailableStatus, openstack.VolumeInUseStatus}
+	err = cs.Cloud.WaitVolumeTargetStatus(volumeID, targetStatus)
+	if err != nil {
+		klog.Errorf("Failed to WaitVolumeTargetStatus of volume %s: %v", volumeID, err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("[ControllerModifyVolume] Volume %s not in target state after retype operation: %v", volumeID, err))
+	}
+
+	volume, err = cs.Cloud.GetVolume(volumeID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("GetVolume failed with error %v", err))
+	}
+	if volume.VolumeType != vtype.Name {
+		return nil, status.Errorf(codes.Internal, "[ControllerModifyVolume] Volume %s was not retyped to %q, check the volume messages in Cinder for details", volumeID, vtype.Name)
+	}
+
+	klog.V(4).Infof("ControllerModifyVolume retyped volume %v to type %v", volumeID, vtype.Name)
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+// getVolumeCapabilitiesFsType returns the filesystem type requested by the volume capabilities, ext4 by default.
+func getVolumeCapabilitiesFsType(volCapabilities []*csi.VolumeCapability) string {
+	for _, volCap := range volCapabilities {
+		if mnt := volCap.GetMount(); mnt != nil && mnt.FsType != "" {
+			return mnt.FsType
+		}
+	}
+	return "ext4"
+}
+
+func getCreateVolumeResponse(vol *volumes.Volume, volCtx map[string]string, ignoreVolumeAZ bool, accessibleTopologyReq *csi.TopologyRequirement) *csi.CreateVolumeResponse {
 
 	var volsrc *csi.VolumeContentSource
 
@@ -667,6 +1226,16 @@ func getCreateVolumeResponse(vol *volumes.Volume, ignoreVolumeAZ bool, accessibl
 		}
 	}
 
+	if snapID := vol.Metadata[snapshotCopySourceKey]; snapID != "" {
+		volsrc = &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{
+					SnapshotId: snapID,
+				},
+			},
+		}
+	}
+
 	if vol.SourceVolID != "" {
 		volsrc = &csi.VolumeContentSource{
 			Type: &csi.VolumeContentSource_Volume{
@@ -698,9 +1267,164 @@ func getCreateVolumeResponse(vol *volumes.Volume, ignoreVolumeAZ bool, accessibl
 			CapacityBytes:      int64(vol.Size * 1024 * 1024 * 1024),
 			AccessibleTopology: accessibleTopology,
 			ContentSource:      volsrc,
+			VolumeContext:      volCtx,
 		},
 	}
 
 	return resp
 
 }
+
+// mutableParameters are the VolumeAttributesClass parameters supported by the driver.
+type mutableParameters struct {
+	volumeType      string
+	qos             string
+	migrationPolicy string
+}
+
+// parseMutableParameters validates the VolumeAttributesClass parameters.
+func parseMutableParameters(params map[string]string) (*mutableParameters, error) {
+	p := &mutableParameters{
+		migrationPolicy: openstack.VolumeMigrationPolicyOnDemand,
+	}
+
+	for k, v := range params {
+		switch k {
+		case mutableVolumeTypeKey:
+			p.volumeType = v
+		case mutableQoSKey:
+			p.qos = v
+		case mutableMigrationPolicyKey:
+			if v != openstack.VolumeMigrationPolicyOnDemand && v != openstack.VolumeMigrationPolicyNever {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid migration policy %q, must be %q or %q", v, openstack.VolumeMigrationPolicyOnDemand, openstack.VolumeMigrationPolicyNever)
+			}
+			p.migrationPolicy = v
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported mutable parameter %q", k)
+		}
+	}
+
+	return p, nil
+}
+
+// resolveVolumeType returns the volume type matching the VolumeAttributesClass parameters. Cinder
+// QoS specs are associated with volume types, so a QoS specs is translated to its associated volume type.
+func (cs *controllerServer) resolveVolumeType(p *mutableParameters) (*volumetypes.VolumeType, error) {
+	if p.qos == "" {
+		vtype, err := cs.Cloud.GetVolumeType(p.volumeType)
+		if err != nil {
+			if cpoerrors.IsNotFound(err) {
+				return nil, status.Errorf(codes.InvalidArgument, "volume type %q not found", p.volumeType)
+			}
+			return nil, status.Errorf(codes.Internal, "GetVolumeType failed with error %v", err)
+		}
+		return vtype, nil
+	}
+
+	vtypes, err := cs.Cloud.GetQoSVolumeTypes(p.qos)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.InvalidArgument, "QoS specs %q not found", p.qos)
+		}
+		return nil, status.Errorf(codes.Internal, "GetQoSVolumeTypes failed with error %v", err)
+	}
+
+	if p.volumeType != "" {
+		for i := range vtypes {
+			if vtypes[i].ID == p.volumeType || vtypes[i].Name == p.volumeType {
+				return &vtypes[i], nil
+			}
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "volume type %q is not associated with QoS specs %q", p.volumeType, p.qos)
+	}
+
+	switch len(vtypes) {
+	case 0:
+		return nil, status.Errorf(codes.InvalidArgument, "QoS specs %q is not associated with any volume type", p.qos)
+	case 1:
+		return &vtypes[0], nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "QoS specs %q is associated with multiple volume types, set the %q parameter as well", p.qos, mutableVolumeTypeKey)
+	}
+}
+
+// resolveProvisioningVolumeType returns the volume type provisioning the volumes as requested by the provisioning
+// parameter: the type of the parameters if it does, or else the only volume type with the provisioning:type extra spec
+// set to it.
+func (cs *controllerServer) resolveProvisioningVolumeType(volType, provisioning string) (string, error) {
+	if provisioning != provisioningThin && provisioning != provisioningThick {
+		return "", status.Errorf(codes.InvalidArgument, "invalid %s parameter %q, must be %q or %q", provisioningKey, provisioning, provisioningThin, provisioningThick)
+	}
+
+	if volType != "" {
+		vtype, err := cs.Cloud.GetVolumeType(volType)
+		if err != nil {
+			if cpoerrors.IsNotFound(err) {
+				return "", status.Errorf(codes.InvalidArgument, "volume type %q not found", volType)
+			}
+			return "", status.Errorf(codes.Internal, "GetVolumeType failed with error %v", err)
+		}
+		if mode := getVolumeTypeProvisioning(vtype); mode != provisioning {
+			return "", status.Errorf(codes.InvalidArgument, "volume type %q provisions %s volumes, %s provisioning was requested", volType, mode, provisioning)
+		}
+		return volType, nil
+	}
+
+	vtypes, err := cs.Cloud.GetVolumeTypes()
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "GetVolumeTypes failed with error %v", err)
+	}
+	var matching []string
+	for _, vtype := range vtypes {
+		if vtype.ExtraSpecs[provisioningTypeKey] == provisioning {
+			matching = append(matching, vtype.Name)
+		}
+	}
+
+	switch len(matching) {
+	case 0:
+		return "", status.Errorf(codes.InvalidArgument, "no volume type has the %s=%s extra spec", provisioningTypeKey, provisioning)
+	case 1:
+		return matching[0], nil
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "volume types %s all provision %s volumes, set the %q parameter as well", strings.Join(matching, ", "), provisioning, mutableVolumeTypeKey)
+	}
+}
+
+// getVolumeTypeProvisioning returns the provisioning of the volumes of the volume type, thin unless its
+// provisioning:type extra spec says otherwise.
+func getVolumeTypeProvisioning(vtype *volumetypes.VolumeType) string {
+	if provisioning := vtype.ExtraSpecs[provisioningTypeKey]; provisioning != "" {
+		return provisioning
+	}
+	return provisioningThin
+}
+
+// getPoolsCapacity sums the free space of the pools of the availability zone and backend, any zone or backend matches
+// when it's empty. A volume has to fit in a single pool, so the free space of the largest pool is the maximum volume
+// size. The capacity isn't limited if any of the pools has an unlimited capacity.
+func getPoolsCapacity(pools []openstack.StoragePool, zone, backendName string) *csi.GetCapacityResponse {
+	var availableGB, maxVolumeGB float64
+	for _, pool := range pools {
+		if zone != "" && pool.AvailabilityZone != zone {
+			continue
+		}
+		if backendName != "" && pool.VolumeBackendName != backendName {
+			continue
+		}
+
+		if pool.Unlimited {
+			klog.V(4).Infof("Pool %s has an unlimited capacity", pool.Name)
+			return &csi.GetCapacityResponse{AvailableCapacity: math.MaxInt64}
+		}
+
+		availableGB += pool.FreeCapacityGB
+		maxVolumeGB = math.Max(maxVolumeGB, pool.FreeCapacityGB)
+	}
+
+	// Cinder volumes are sized in whole GiBs
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: int64(math.Floor(availableGB)) * 1024 * 1024 * 1024,
+		MaximumVolumeSize: wrapperspb.Int64(int64(math.Floor(maxVolumeGB)) * 1024 * 1024 * 1024),
+	}
+}
@@ -17,12 +17,24 @@ limitations under the License.
 package cinder
 
 import (
+	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
 )
 
 var fakeCs *controllerServer
@@ -45,8 +57,8 @@ func TestCreateVolume(t *testing.T) {
 
 	// mock OpenStack
 	properties := map[string]string{"cinder.csi.openstack.org/cluster": FakeCluster}
-	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, tags *map[string]string) (string, string, int, error)
-	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", &properties).Return(&FakeVol, nil)
+	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", &properties, map[string]interface{}(nil)).Return(&FakeVol, nil)
 
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	// Init assert
@@ -92,9 +104,9 @@ func TestCreateVolumeWithParam(t *testing.T) {
 
 	// mock OpenStack
 	properties := map[string]string{"cinder.csi.openstack.org/cluster": FakeCluster}
-	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, tags *map[string]string) (string, string, int, error)
+	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error)
 	// Vol type and availability comes from CreateVolumeRequest.Parameters
-	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "dummyVolType", "cinder", "", "", &properties).Return(&FakeVol, nil)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "dummyVolType", "cinder", "", "", &properties, map[string]interface{}(nil)).Return(&FakeVol, nil)
 
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	// Init assert
@@ -140,6 +152,130 @@ func TestCreateVolumeWithParam(t *testing.T) {
 
 }
 
+// Test CreateVolume with scheduler hints
+func TestCreateVolumeWithSchedulerHints(t *testing.T) {
+	properties := map[string]string{"cinder.csi.openstack.org/cluster": FakeCluster}
+	hints := map[string]interface{}{
+		"different_host":    []string{"volume-1", "volume-2"},
+		"local_to_instance": "instance-1",
+	}
+	// The scheduler hints of the parameters are forwarded to Cinder
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "hintedVolType", "", "", "", &properties, hints).Return(&FakeVol, nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+
+	assert := assert.New(t)
+
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Parameters: map[string]string{
+			"type":                            "hintedVolType",
+			"schedulerHint.different_host":    "volume-1, volume-2",
+			"schedulerHint.local_to_instance": "instance-1",
+		},
+	}
+
+	actualRes, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.NoError(err)
+	assert.NotNil(actualRes.Volume)
+	osmock.AssertCalled(t, "CreateVolume", FakeVolName, mock.AnythingOfType("int"), "hintedVolType", "", "", "", &properties, hints)
+
+	// The hints that aren't allowed are rejected before anything is created
+	fakeReq.Parameters = map[string]string{"schedulerHint.query": `["=", "$free_capacity_gb", 100]`}
+	_, err = fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateVolumeWithProvisioning(t *testing.T) {
+	properties := map[string]string{"cinder.csi.openstack.org/cluster": FakeCluster}
+	osmock.On("GetVolumeType", "thin-type").Return(&volumetypes.VolumeType{ID: "thin-id", Name: "thin-type"}, nil)
+	osmock.On("GetVolumeType", "thick-type").Return(&volumetypes.VolumeType{ID: "thick-id", Name: "thick-type", ExtraSpecs: map[string]string{"provisioning:type": "thick"}}, nil)
+	osmock.On("GetVolumeTypes").Return([]volumetypes.VolumeType{
+		{ID: "thin-id", Name: "thin-type"},
+		{ID: "thick-id", Name: "thick-type", ExtraSpecs: map[string]string{"provisioning:type": "thick"}},
+		{ID: "explicit-thin-id", Name: "explicit-thin-type", ExtraSpecs: map[string]string{"provisioning:type": "thin"}},
+		{ID: "other-thin-id", Name: "other-thin-type", ExtraSpecs: map[string]string{"provisioning:type": "thin"}},
+	}, nil)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "thin-type", "", "", "", &properties, map[string]interface{}(nil)).Return(&FakeVol, nil)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "thick-type", "", "", "", &properties, map[string]interface{}(nil)).Return(&FakeVol, nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+
+	tests := []struct {
+		name         string
+		parameters   map[string]string
+		expectedType string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "thin volume type",
+			parameters:   map[string]string{"type": "thin-type", "provisioning": "thin"},
+			expectedType: "thin-type",
+		},
+		{
+			name:         "thick volume type",
+			parameters:   map[string]string{"type": "thick-type", "provisioning": "thick"},
+			expectedType: "thick-type",
+		},
+		{
+			name:         "thick volume type picked",
+			parameters:   map[string]string{"provisioning": "thick"},
+			expectedType: "thick-type",
+		},
+		{
+			name:         "thin volume type of a thick volume",
+			parameters:   map[string]string{"type": "thin-type", "provisioning": "thick"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "thick volume type of a thin volume",
+			parameters:   map[string]string{"type": "thick-type", "provisioning": "thin"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "several thin volume types",
+			parameters:   map[string]string{"provisioning": "thin"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "invalid provisioning",
+			parameters:   map[string]string{"type": "thin-type", "provisioning": "sparse"},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeReq := &csi.CreateVolumeRequest{
+				Name: FakeVolName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+						},
+					},
+				},
+				Parameters: test.parameters,
+			}
+
+			actualRes, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			// The effective provisioning is passed in the volume context
+			assert.Equal(t, map[string]string{"provisioning": test.parameters["provisioning"]}, actualRes.Volume.VolumeContext)
+			osmock.AssertCalled(t, "CreateVolume", FakeVolName, mock.AnythingOfType("int"), test.expectedType, "", "", "", &properties, map[string]interface{}(nil))
+		})
+	}
+}
+
 func TestCreateVolumeWithExtraMetadata(t *testing.T) {
 
 	// mock OpenStack
@@ -149,8 +285,8 @@ func TestCreateVolumeWithExtraMetadata(t *testing.T) {
 		"csi.storage.k8s.io/pvc/name":      FakePVCName,
 		"csi.storage.k8s.io/pvc/namespace": FakePVCNamespace,
 	}
-	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, tags *map[string]string) (string, string, int, error)
-	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", &properties).Return(&FakeVol, nil)
+	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", &properties, map[string]interface{}(nil)).Return(&FakeVol, nil)
 
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 
@@ -190,8 +326,8 @@ func TestCreateVolumeWithExtraMetadata(t *testing.T) {
 func TestCreateVolumeFromSnapshot(t *testing.T) {
 
 	properties := map[string]string{"cinder.csi.openstack.org/cluster": FakeCluster}
-	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, tags *map[string]string) (string, string, int, error)
-	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", FakeSnapshotID, "", &properties).Return(&FakeVolFromSnapshot, nil)
+	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", FakeSnapshotID, "", &properties, map[string]interface{}(nil)).Return(&FakeVolFromSnapshot, nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 
 	// Init assert
@@ -235,11 +371,274 @@ func TestCreateVolumeFromSnapshot(t *testing.T) {
 
 }
 
+// Test CreateVolume from a snapshot in another availability zone than the one requested
+func TestCreateVolumeFromSnapshotCopy(t *testing.T) {
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	volProperties := map[string]string{cinderCSIClusterIDKey: FakeCluster, snapshotCopySourceKey: FakeSnapshotID}
+	req := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+		},
+		Parameters: map[string]string{"availability": "az2"},
+		VolumeContentSource: &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: FakeSnapshotID}},
+		},
+	}
+
+	// Same availability zone, the snapshot is restored by Cinder
+	osm := new(openstack.OpenStackMock)
+	osm.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osm.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "", "az2", FakeSnapshotID, "", &properties, map[string]interface{}(nil)).
+		Return(&volumes.Volume{ID: FakeVolID, Name: FakeVolName, Status: "creating", AvailabilityZone: "az2", SnapshotID: FakeSnapshotID}, nil)
+	osm.On("GetVolume", "CSIVolumeID").Return(&volumes.Volume{ID: "CSIVolumeID", Status: "available", AvailabilityZone: "az2"}, nil)
+	osm.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{CrossAZSnapshotCopy: true})
+	cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+	res, err := cs.CreateVolume(FakeCtx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, FakeSnapshotID, res.Volume.ContentSource.GetSnapshot().SnapshotId)
+	osm.AssertNotCalled(t, "CreateBackup", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Another availability zone, the snapshot is backed up and the backup restored in the requested one
+	backup := backups.Backup{ID: "backup-id", Name: FakeVolName}
+	osm = new(openstack.OpenStackMock)
+	osm.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil).Once()
+	osm.On("GetBackupsByName", FakeVolName).Return([]backups.Backup(nil), nil).Once()
+	osm.On("CreateBackup", FakeVolName, "CSIVolumeID", FakeSnapshotID, properties).Return(&backup, nil).Once()
+	osm.On("WaitBackupReady", "backup-id").Return(nil)
+	restoring := volumes.Volume{ID: FakeVolID, Name: FakeVolName, Size: 1, Status: "restoring-backup", AvailabilityZone: "az2", Metadata: volProperties}
+	osm.On("CreateVolumeFromBackup", FakeVolName, mock.AnythingOfType("int"), "", "az2", "backup-id", volProperties).Return(&restoring, nil).Once()
+	osm.On("GetBackupsByName", FakeVolName).Return([]backups.Backup{backup}, nil)
+	osm.On("GetVolume", "CSIVolumeID").Return(&volumes.Volume{ID: "CSIVolumeID", Status: "available", AvailabilityZone: "az1"}, nil)
+	osm.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{CrossAZSnapshotCopy: true})
+	cs = NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+
+	// The copy is reported in progress until the volume is restored
+	_, err = cs.CreateVolume(FakeCtx, req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.ErrorContains(t, err, "copy of snapshot "+FakeSnapshotID+" in progress")
+	osm.AssertNotCalled(t, "DeleteBackup", "backup-id")
+
+	// Then the backup is deleted and the snapshot reported as the source of the volume
+	restored := restoring
+	restored.Status = "available"
+	osm.On("GetVolumesByName", FakeVolName).Return([]volumes.Volume{restored}, nil)
+	osm.On("DeleteBackup", "backup-id").Return(nil).Once()
+	res, err = cs.CreateVolume(FakeCtx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, FakeVolID, res.Volume.VolumeId)
+	assert.Equal(t, FakeSnapshotID, res.Volume.ContentSource.GetSnapshot().SnapshotId)
+	assert.Equal(t, "az2", res.Volume.AccessibleTopology[0].Segments[topologyKey])
+	osm.AssertExpectations(t)
+
+	// A failed backup is deleted, so that the copy starts over on retry
+	osm = new(openstack.OpenStackMock)
+	osm.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osm.On("GetBackupsByName", FakeVolName).Return([]backups.Backup{backup}, nil)
+	osm.On("WaitBackupReady", "backup-id").Return(fmt.Errorf("backup %q is in error status", "backup-id"))
+	osm.On("DeleteBackup", "backup-id").Return(nil).Once()
+	osm.On("GetVolume", "CSIVolumeID").Return(&volumes.Volume{ID: "CSIVolumeID", Status: "available", AvailabilityZone: "az1"}, nil)
+	osm.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{CrossAZSnapshotCopy: true})
+	cs = NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+	_, err = cs.CreateVolume(FakeCtx, req)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	osm.AssertExpectations(t)
+}
+
+// Test CreateVolume rejected by Cinder as a quota is exceeded
+func TestCreateVolumeQuotaExceeded(t *testing.T) {
+	overLimit := func(msg string) error {
+		return gophercloud.ErrUnexpectedResponseCode{
+			Actual: 413,
+			Body:   []byte(fmt.Sprintf(`{"overLimit": {"code": 413, "message": %q, "retryAfter": "0"}}`, msg)),
+		}
+	}
+	req := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		opts     openstack.BlockStorageOpts
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{
+			name:     "gigabytes quota exceeded",
+			err:      overLimit("VolumeSizeExceedsAvailableQuota: Requested volume or snapshot exceeds allowed gigabytes quota. Requested 10G, quota is 100G and 95G has been consumed."),
+			wantCode: codes.ResourceExhausted,
+			wantMsg:  "the quota of the project is exceeded, the creation is retried until it's raised",
+		},
+		{
+			name:     "volumes quota exceeded",
+			err:      overLimit("VolumeLimitExceeded: Maximum number of volumes allowed (10) exceeded for quota 'volumes'."),
+			wantCode: codes.ResourceExhausted,
+			wantMsg:  "the quota of the project is exceeded",
+		},
+		{
+			name:     "size limit of a single volume exceeded",
+			err:      overLimit("VolumeSizeExceedsLimit: Requested volume size 2000G is larger than maximum allowed limit 1000G."),
+			wantCode: codes.OutOfRange,
+			wantMsg:  "the volume is larger than the size limit of a single volume",
+		},
+		{
+			name:     "quota exceeded with fail-on-quota-exceeded",
+			err:      overLimit("VolumeSizeExceedsAvailableQuota: Requested volume or snapshot exceeds allowed gigabytes quota."),
+			opts:     openstack.BlockStorageOpts{FailOnQuotaExceeded: true},
+			wantCode: codes.Internal,
+			wantMsg:  "VolumeSizeExceedsAvailableQuota",
+		},
+		{
+			name:     "other error",
+			err:      gophercloud.ErrDefault500{},
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osm := new(openstack.OpenStackMock)
+			osm.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+			osm.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "", "", "", "", mock.Anything, map[string]interface{}(nil)).Return((*volumes.Volume)(nil), test.err)
+			osm.On("GetBlockStorageOpts").Return(test.opts)
+			cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+
+			_, err := cs.CreateVolume(FakeCtx, req)
+			assert.Equal(t, test.wantCode, status.Code(err))
+			assert.ErrorContains(t, err, test.wantMsg)
+		})
+	}
+}
+
+// Test CreateVolume falling back to other availability zones
+func TestCreateVolumeFallbackAvailabilities(t *testing.T) {
+	topology := func(zones ...string) []*csi.Topology {
+		var topologies []*csi.Topology
+		for _, zone := range zones {
+			topologies = append(topologies, &csi.Topology{Segments: map[string]string{topologyKey: zone}})
+		}
+		return topologies
+	}
+
+	tests := []struct {
+		name           string
+		fallbacks      string
+		requisite      []*csi.Topology
+		statuses       map[string]string
+		wantZones      []string
+		wantDeleted    []string
+		wantCode       codes.Code
+		wantTopology   string
+		ignoreVolumeAZ bool
+	}{
+		{
+			name:         "created in the preferred zone",
+			fallbacks:    "az-2",
+			statuses:     map[string]string{"vol-az-1": "available"},
+			wantZones:    []string{"az-1"},
+			wantTopology: "az-1",
+		},
+		{
+			name:         "created in the fallback zone",
+			fallbacks:    "az-2, az-3",
+			statuses:     map[string]string{"vol-az-1": "error", "vol-az-2": "available"},
+			wantZones:    []string{"az-1", "az-2"},
+			wantDeleted:  []string{"vol-az-1"},
+			wantTopology: "az-2",
+		},
+		{
+			name:         "zone not accessible from the nodes skipped",
+			fallbacks:    "az-2,az-3",
+			requisite:    topology("az-1", "az-3"),
+			statuses:     map[string]string{"vol-az-1": "error", "vol-az-3": "available"},
+			wantZones:    []string{"az-1", "az-3"},
+			wantDeleted:  []string{"vol-az-1"},
+			wantTopology: "az-3",
+		},
+		{
+			name:           "zone not accessible from the nodes used with ignore-volume-az",
+			fallbacks:      "az-2,az-3",
+			requisite:      topology("az-1", "az-3"),
+			statuses:       map[string]string{"vol-az-1": "error", "vol-az-2": "available"},
+			wantZones:      []string{"az-1", "az-2"},
+			wantDeleted:    []string{"vol-az-1"},
+			wantTopology:   "az-1",
+			ignoreVolumeAZ: true,
+		},
+		{
+			name:        "all zones failed",
+			fallbacks:   "az-2",
+			statuses:    map[string]string{"vol-az-1": "error", "vol-az-2": "error"},
+			wantZones:   []string{"az-1", "az-2"},
+			wantDeleted: []string{"vol-az-1", "vol-az-2"},
+			wantCode:    codes.ResourceExhausted,
+		},
+		{
+			name:      "volume still being created",
+			fallbacks: "az-2",
+			statuses:  map[string]string{"vol-az-1": "creating"},
+			wantZones: []string{"az-1"},
+			wantCode:  codes.Internal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var zones, deleted []string
+			osm := new(openstack.OpenStackMock)
+			osm.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+			osm.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "", mock.AnythingOfType("string"), "", "", mock.Anything, map[string]interface{}(nil)).Return(
+				func(_ string, _ int, _, zone, _, _ string, _ *map[string]string, _ map[string]interface{}) *volumes.Volume {
+					zones = append(zones, zone)
+					return &volumes.Volume{ID: "vol-" + zone, AvailabilityZone: zone, Size: 1}
+				}, nil)
+			osm.On("WaitVolumeTargetStatus", mock.AnythingOfType("string"), []string{openstack.VolumeAvailableStatus}).Return(
+				func(volumeID string, _ []string) error {
+					if test.statuses[volumeID] != openstack.VolumeAvailableStatus {
+						return fmt.Errorf("volume %s is %s", volumeID, test.statuses[volumeID])
+					}
+					return nil
+				})
+			osm.On("DeleteVolume", mock.AnythingOfType("string")).Return(func(volumeID string) error {
+				deleted = append(deleted, volumeID)
+				return nil
+			})
+			osm.On("GetVolume", mock.AnythingOfType("string")).Return(func(volumeID string) *volumes.Volume {
+				return &volumes.Volume{ID: volumeID, Status: test.statuses[volumeID]}
+			}, nil)
+			osm.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{IgnoreVolumeAZ: test.ignoreVolumeAZ})
+			cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+
+			resp, err := cs.CreateVolume(FakeCtx, &csi.CreateVolumeRequest{
+				Name: FakeVolName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+				},
+				Parameters: map[string]string{fallbackAvailabilitiesKey: test.fallbacks},
+				AccessibilityRequirements: &csi.TopologyRequirement{
+					Preferred: topology("az-1"),
+					Requisite: test.requisite,
+				},
+			})
+			assert.Equal(t, test.wantZones, zones)
+			assert.Equal(t, test.wantDeleted, deleted)
+			assert.Equal(t, test.wantCode, status.Code(err))
+			if test.wantCode == codes.OK {
+				assert.Equal(t, topology(test.wantTopology), resp.Volume.AccessibleTopology)
+			}
+		})
+	}
+}
+
 func TestCreateVolumeFromSourceVolume(t *testing.T) {
 
 	properties := map[string]string{"cinder.csi.openstack.org/cluster": FakeCluster}
-	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, tags *map[string]string) (string, string, int, error)
-	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", "", FakeVolID, &properties).Return(&FakeVolFromSourceVolume, nil)
+	// CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", "", FakeVolID, &properties, map[string]interface{}(nil)).Return(&FakeVolFromSourceVolume, nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 
 	// Init assert
@@ -343,6 +742,25 @@ func TestDeleteVolume(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+// Test CreateVolume with mkfs options not supported by the filesystem
+func TestCreateVolumeInvalidMkfsOptions(t *testing.T) {
+	_, err := fakeCs.CreateVolume(FakeCtx, &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{FsType: "xfs"},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Parameters: map[string]string{"mkfsOptions": "-N 1000"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 // Test ControllerPublishVolume
 func TestControllerPublishVolume(t *testing.T) {
 
@@ -372,6 +790,7 @@ func TestControllerPublishVolume(t *testing.T) {
 	expectedRes := &csi.ControllerPublishVolumeResponse{
 		PublishContext: map[string]string{
 			"DevicePath": FakeDevicePath,
+			"AttachMode": "rw",
 		},
 	}
 
@@ -385,6 +804,306 @@ func TestControllerPublishVolume(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+// Test read-only ControllerPublishVolume with and without the readonly flag of the volume being set
+func TestControllerPublishVolumeReadOnly(t *testing.T) {
+	tests := []struct {
+		name               string
+		setReadOnlyErr     error
+		expectedAttachMode string
+	}{
+		{
+			name:               "read-only attachment",
+			expectedAttachMode: "ro",
+		},
+		{
+			name:               "read-only mount fallback",
+			setReadOnlyErr:     fmt.Errorf("policy doesn't allow volume:update_readonly_flag to be performed"),
+			expectedAttachMode: "rw",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			romock := new(openstack.OpenStackMock)
+			romock.On("SetVolumeReadOnly", mock.AnythingOfType("string"), true).Return(test.setReadOnlyErr)
+			romock.On("AttachVolume", FakeNodeID, FakeVolID).Return(FakeVolID, nil)
+			romock.On("WaitDiskAttached", FakeNodeID, FakeVolID).Return(nil)
+			romock.On("GetAttachmentDiskPath", FakeNodeID, FakeVolID).Return(FakeDevicePath, nil)
+			cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), romock)
+
+			actualRes, err := cs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{
+				VolumeId: FakeVolID,
+				NodeId:   FakeNodeID,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+				},
+				Readonly: true,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedAttachMode, actualRes.PublishContext["AttachMode"])
+			romock.AssertCalled(t, "SetVolumeReadOnly", mock.AnythingOfType("string"), true)
+		})
+	}
+}
+
+// Test ControllerPublishVolume and ControllerUnpublishVolume when Nova is too slow
+func TestControllerPublishUnpublishVolumeTimeout(t *testing.T) {
+	timeoutErr := fmt.Errorf("volume %q failed to be attached: %w", FakeVolID, openstack.ErrWaitTimeout)
+
+	slowmock := new(openstack.OpenStackMock)
+	slowmock.On("AttachVolume", FakeNodeID, FakeVolID).Return(FakeVolID, nil)
+	slowmock.On("WaitDiskAttached", FakeNodeID, FakeVolID).Return(timeoutErr)
+	slowmock.On("DetachVolume", FakeNodeID, FakeVolID).Return(nil)
+	slowmock.On("WaitDiskDetached", FakeNodeID, FakeVolID).Return(timeoutErr)
+	cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), slowmock)
+
+	_, err := cs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{
+		VolumeId: FakeVolID,
+		NodeId:   FakeNodeID,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+		},
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	_, err = cs.ControllerUnpublishVolume(FakeCtx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: FakeVolID,
+		NodeId:   FakeNodeID,
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+// Test ControllerPublishVolume when the volume is reserved by another attach or attached elsewhere
+func TestControllerPublishVolumeReserved(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode codes.Code
+	}{
+		{
+			name:     "still reserved",
+			err:      fmt.Errorf("volume %q is still reserved by another attach: %w", FakeVolID, openstack.ErrWaitTimeout),
+			wantCode: codes.DeadlineExceeded,
+		},
+		{
+			name:     "attached to another instance",
+			err:      fmt.Errorf("failed to attach %s volume: %w", FakeVolID, openstack.ErrVolumeAttachConflict),
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "refused",
+			err:      fmt.Errorf("Invalid volume"),
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osm := new(openstack.OpenStackMock)
+			osm.On("AttachVolume", FakeNodeID, FakeVolID).Return("", test.err)
+			cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+
+			_, err := cs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{
+				VolumeId: FakeVolID,
+				NodeId:   FakeNodeID,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+				},
+			})
+			assert.Equal(t, test.wantCode, status.Code(err))
+			osm.AssertNotCalled(t, "WaitDiskAttached", FakeNodeID, FakeVolID)
+		})
+	}
+}
+
+// Test ControllerPublishVolume of a volume still attached to the instance of a node that went down
+func TestControllerPublishVolumeStaleAttachment(t *testing.T) {
+	const oldInstanceID = "old-instance-id"
+	now := time.Now()
+
+	tests := []struct {
+		name             string
+		gracePeriod      time.Duration
+		multiattach      bool
+		oldInstance      *servers.Server
+		expectedDetach   bool
+		expectedCinderOp bool
+	}{
+		{
+			name:        "force-detach disabled",
+			oldInstance: &servers.Server{ID: oldInstanceID, Status: "SHUTOFF", Updated: now.Add(-time.Hour)},
+		},
+		{
+			name:        "instance running",
+			gracePeriod: 5 * time.Minute,
+			oldInstance: &servers.Server{ID: oldInstanceID, Status: "ACTIVE", Updated: now.Add(-time.Hour)},
+		},
+		{
+			name:        "instance shut off within the grace period",
+			gracePeriod: 5 * time.Minute,
+			oldInstance: &servers.Server{ID: oldInstanceID, Status: "SHUTOFF", Updated: now.Add(-time.Minute)},
+		},
+		{
+			name:           "instance shut off past the grace period",
+			gracePeriod:    5 * time.Minute,
+			oldInstance:    &servers.Server{ID: oldInstanceID, Status: "SHUTOFF", Updated: now.Add(-time.Hour)},
+			expectedDetach: true,
+		},
+		{
+			name:             "instance deleted",
+			gracePeriod:      5 * time.Minute,
+			expectedDetach:   true,
+			expectedCinderOp: true,
+		},
+		{
+			name:        "multi-attach volume",
+			gracePeriod: 5 * time.Minute,
+			multiattach: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osm := new(openstack.OpenStackMock)
+			osm.On("DetachVolume", oldInstanceID, FakeVolID).Return(nil)
+			osm.On("DetachVolumeAttachment", FakeVolID, "attachment-id").Return(nil)
+			osm.On("WaitDiskDetached", oldInstanceID, FakeVolID).Return(nil)
+			osm.On("AttachVolume", FakeNodeID, FakeVolID).Return(FakeVolID, nil)
+			osm.On("WaitDiskAttached", FakeNodeID, FakeVolID).Return(nil)
+			osm.On("GetAttachmentDiskPath", FakeNodeID, FakeVolID).Return(FakeDevicePath, nil)
+
+			osm.On("GetVolume", FakeVolID).Return(&volumes.Volume{
+				ID:          FakeVolID,
+				Status:      "in-use",
+				Multiattach: test.multiattach,
+				Attachments: []volumes.Attachment{{ServerID: oldInstanceID, AttachmentID: "attachment-id"}},
+			}, nil)
+			osm.On("GetInstanceByID", FakeNodeID).Return(&servers.Server{ID: FakeNodeID, Status: "ACTIVE"}, nil)
+			if test.oldInstance != nil {
+				osm.On("GetInstanceByID", oldInstanceID).Return(test.oldInstance, nil)
+			} else {
+				osm.On("GetInstanceByID", oldInstanceID).Return(nil, gophercloud.ErrDefault404{})
+			}
+			osm.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{ForceDetachGracePeriod: util.MyDuration{Duration: test.gracePeriod}})
+			cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+
+			_, err := cs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{
+				VolumeId: FakeVolID,
+				NodeId:   FakeNodeID,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+				},
+			})
+			assert.NoError(t, err)
+			osm.AssertCalled(t, "AttachVolume", FakeNodeID, FakeVolID)
+			if !test.expectedDetach {
+				osm.AssertNotCalled(t, "WaitDiskDetached", oldInstanceID, FakeVolID)
+				return
+			}
+			osm.AssertCalled(t, "WaitDiskDetached", oldInstanceID, FakeVolID)
+			if test.expectedCinderOp {
+				osm.AssertCalled(t, "DetachVolumeAttachment", FakeVolID, "attachment-id")
+				osm.AssertNotCalled(t, "DetachVolume", oldInstanceID, FakeVolID)
+			} else {
+				osm.AssertCalled(t, "DetachVolume", oldInstanceID, FakeVolID)
+				osm.AssertNotCalled(t, "DetachVolumeAttachment", FakeVolID, "attachment-id")
+			}
+		})
+	}
+}
+
+// Test ControllerPublishVolume and ControllerUnpublishVolume of volumes attached locally on the nodes
+func TestControllerPublishUnpublishVolumeAttachType(t *testing.T) {
+	const hostName = "edge-node"
+
+	tests := []struct {
+		name          string
+		attachType    string
+		nodeID        string
+		expectedLocal bool
+	}{
+		{
+			name:       "nova",
+			attachType: openstack.AttachTypeNova,
+			nodeID:     FakeNodeID,
+		},
+		{
+			name:          "local",
+			attachType:    openstack.AttachTypeLocal,
+			nodeID:        hostName,
+			expectedLocal: true,
+		},
+		{
+			name:       "auto with a Nova instance",
+			attachType: openstack.AttachTypeAuto,
+			nodeID:     FakeNodeID,
+		},
+		{
+			name:          "auto with a host",
+			attachType:    openstack.AttachTypeAuto,
+			nodeID:        hostName,
+			expectedLocal: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osm := new(openstack.OpenStackMock)
+			osm.On("AttachVolume", test.nodeID, FakeVolID).Return(FakeVolID, nil)
+			osm.On("WaitDiskAttached", test.nodeID, FakeVolID).Return(nil)
+			osm.On("GetAttachmentDiskPath", test.nodeID, FakeVolID).Return(FakeDevicePath, nil)
+			osm.On("DetachVolume", test.nodeID, FakeVolID).Return(nil)
+			osm.On("WaitDiskDetached", test.nodeID, FakeVolID).Return(nil)
+			osm.On("AttachVolumeToHost", mock.Anything, test.nodeID).Return(nil)
+			osm.On("DetachVolumeFromHost", FakeVolID, test.nodeID).Return(nil)
+
+			osm.On("GetInstanceByID", FakeNodeID).Return(&servers.Server{ID: FakeNodeID, Status: "ACTIVE"}, nil)
+			osm.On("GetInstanceByID", hostName).Return(nil, gophercloud.ErrDefault404{})
+			osm.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{AttachType: test.attachType})
+			cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), osm)
+
+			actualRes, err := cs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{
+				VolumeId: FakeVolID,
+				NodeId:   test.nodeID,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+				},
+			})
+			assert.NoError(t, err)
+
+			_, err = cs.ControllerUnpublishVolume(FakeCtx, &csi.ControllerUnpublishVolumeRequest{
+				VolumeId: FakeVolID,
+				NodeId:   test.nodeID,
+			})
+			assert.NoError(t, err)
+
+			if test.expectedLocal {
+				assert.Equal(t, map[string]string{"AttachMode": "rw", "AttachType": "local"}, actualRes.PublishContext)
+				osm.AssertCalled(t, "AttachVolumeToHost", mock.Anything, test.nodeID)
+				osm.AssertCalled(t, "DetachVolumeFromHost", FakeVolID, test.nodeID)
+				osm.AssertNotCalled(t, "AttachVolume", test.nodeID, FakeVolID)
+				osm.AssertNotCalled(t, "DetachVolume", test.nodeID, FakeVolID)
+			} else {
+				assert.Equal(t, FakeDevicePath, actualRes.PublishContext["DevicePath"])
+				osm.AssertCalled(t, "AttachVolume", test.nodeID, FakeVolID)
+				osm.AssertCalled(t, "DetachVolume", test.nodeID, FakeVolID)
+				osm.AssertNotCalled(t, "AttachVolumeToHost", mock.Anything, test.nodeID)
+				osm.AssertNotCalled(t, "DetachVolumeFromHost", FakeVolID, test.nodeID)
+			}
+		})
+	}
+}
+
 // Test ControllerUnpublishVolume
 func TestControllerUnpublishVolume(t *testing.T) {
 
@@ -530,6 +1249,41 @@ func TestCreateSnapshotWithExtraMetadata(t *testing.T) {
 	assert.NotNil(FakeSnapshotID, actualRes.Snapshot.SnapshotId)
 }
 
+// Test CreateSnapshot retried by external-snapshotter after the snapshot took too long to be ready
+func TestCreateSnapshotReadyTimeout(t *testing.T) {
+	timeoutErr := fmt.Errorf("snapshot %q is still not ready: %w", FakeSnapshotID, openstack.ErrWaitTimeout)
+
+	slowmock := new(openstack.OpenStackMock)
+	slowmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotListEmpty, "", nil).Once()
+	slowmock.On("CreateSnapshot", FakeSnapshotName, FakeVolID, &map[string]string{cinderCSIClusterIDKey: FakeCluster}).Return(&FakeSnapshotRes, nil).Once()
+	slowmock.On("WaitSnapshotReady", FakeSnapshotID).Return(timeoutErr).Once()
+	cs := NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), slowmock)
+
+	req := &csi.CreateSnapshotRequest{
+		Name:           FakeSnapshotName,
+		SourceVolumeId: FakeVolID,
+	}
+	_, err := cs.CreateSnapshot(FakeCtx, req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// The retry finds the snapshot by name and waits for it again
+	slowmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotsRes, "", nil)
+	slowmock.On("WaitSnapshotReady", FakeSnapshotID).Return(nil)
+	res, err := cs.CreateSnapshot(FakeCtx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, FakeSnapshotID, res.Snapshot.SnapshotId)
+	assert.True(t, res.Snapshot.ReadyToUse)
+	slowmock.AssertNumberOfCalls(t, "CreateSnapshot", 1)
+
+	// A snapshot in error status isn't retried
+	errmock := new(openstack.OpenStackMock)
+	errmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotsRes, "", nil)
+	errmock.On("WaitSnapshotReady", FakeSnapshotID).Return(fmt.Errorf("snapshot %q is in error status", FakeSnapshotID))
+	cs = NewControllerServer(NewDriver(FakeEndpoint, FakeCluster), errmock)
+	_, err = cs.CreateSnapshot(FakeCtx, req)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
 // Test DeleteSnapshot
 func TestDeleteSnapshot(t *testing.T) {
 
@@ -610,10 +1364,97 @@ func TestControllerExpandVolume(t *testing.T) {
 
 }
 
+func TestControllerModifyVolume(t *testing.T) {
+
+	tState := []string{"available", "in-use"}
+	// GetVolumeType(nameOrID string) (*volumetypes.VolumeType, error)
+	osmock.On("GetVolumeType", "fast").Return(&volumetypes.VolumeType{ID: "fast-id", Name: "fast"}, nil)
+	osmock.On("GetVolumeType", "missing").Return(nil, cpoerrors.ErrNotFound)
+	// GetQoSVolumeTypes(qosNameOrID string) ([]volumetypes.VolumeType, error)
+	osmock.On("GetQoSVolumeTypes", "high-iops").Return([]volumetypes.VolumeType{{ID: "fast-id", Name: "fast"}, {ID: "faster-id", Name: "faster"}}, nil)
+	osmock.On("GetQoSVolumeTypes", "unused").Return([]volumetypes.VolumeType(nil), nil)
+	osmock.On("GetQoSVolumeTypes", "missing").Return(nil, cpoerrors.ErrNotFound)
+	// ChangeVolumeType(volumeID string, volumeType string, migrationPolicy string) error
+	osmock.On("ChangeVolumeType", FakeVolID, "fast", openstack.VolumeMigrationPolicyOnDemand).Return(nil)
+	// WaitVolumeTargetStatus(volumeID string, tState []string) error
+	osmock.On("WaitVolumeTargetStatus", FakeVolID, tState).Return(nil)
+
+	testCases := []struct {
+		name         string
+		params       map[string]string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "missing type",
+			params:       map[string]string{},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "invalid migration policy",
+			params:       map[string]string{"type": "fast", "migrationPolicy": "always"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "unsupported parameter",
+			params:       map[string]string{"type": "fast", "iops": "1000"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "type not found",
+			params:       map[string]string{"type": "missing"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "QoS specs not found",
+			params:       map[string]string{"qos": "missing"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "QoS specs without volume type",
+			params:       map[string]string{"qos": "unused"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "QoS specs with multiple volume types",
+			params:       map[string]string{"qos": "high-iops"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "type not associated with QoS specs",
+			params:       map[string]string{"qos": "high-iops", "type": "slow"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			// The mocked volume never changes its type, which is what happens when Cinder rejects the retype
+			// asynchronously.
+			name:         "retype not applied",
+			params:       map[string]string{"type": "fast"},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:         "retype by QoS specs not applied",
+			params:       map[string]string{"qos": "high-iops", "type": "fast-id"},
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeReq := &csi.ControllerModifyVolumeRequest{
+				VolumeId:          FakeVolID,
+				MutableParameters: tc.params,
+			}
+
+			_, err := fakeCs.ControllerModifyVolume(FakeCtx, fakeReq)
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
+
 func TestValidateVolumeCapabilities(t *testing.T) {
 
 	// GetVolume(volumeID string)
-	osmock.On("GetVolume", FakeVolID).Return(FakeVol1)
+	osmock.On("GetVolume", FakeVolID).Return(&FakeVol1, nil)
 
 	// Init assert
 	assert := assert.New(t)
@@ -674,3 +1515,95 @@ func TestValidateVolumeCapabilities(t *testing.T) {
 	assert.Equal(expectedRes2, actualRes2)
 
 }
+
+func TestGetCapacity(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+
+	pools := []openstack.StoragePool{
+		{Name: "host1@lvm#lvm", VolumeBackendName: "lvm", AvailabilityZone: "az1", FreeCapacityGB: 100.5},
+		{Name: "host2@lvm#lvm", VolumeBackendName: "lvm", AvailabilityZone: "az2", FreeCapacityGB: 50},
+		{Name: "host2@ssd#ssd", VolumeBackendName: "ssd", AvailabilityZone: "az2", FreeCapacityGB: 20},
+		{Name: "host3@ceph#ceph", VolumeBackendName: "ceph", AvailabilityZone: "az3", Unlimited: true},
+	}
+	osmock.On("GetStoragePools").Return(pools, nil)
+	osmock.On("GetVolumeType", "ssd-type").Return(&volumetypes.VolumeType{ID: "ssd-id", Name: "ssd-type", ExtraSpecs: map[string]string{"volume_backend_name": "ssd"}}, nil)
+	osmock.On("GetVolumeType", "any-type").Return(&volumetypes.VolumeType{ID: "any-id", Name: "any-type"}, nil)
+	osmock.On("GetVolumeType", "missing-type").Return(nil, cpoerrors.ErrNotFound)
+
+	tests := []struct {
+		name              string
+		parameters        map[string]string
+		zone              string
+		expectedAvailable int64
+		expectedMaximum   int64
+		expectedCode      codes.Code
+	}{
+		{
+			name:              "all pools of the zone",
+			zone:              "az2",
+			expectedAvailable: 70 * gib,
+			expectedMaximum:   50 * gib,
+		},
+		{
+			name:              "pools of the volume type backend",
+			parameters:        map[string]string{"type": "ssd-type"},
+			zone:              "az2",
+			expectedAvailable: 20 * gib,
+			expectedMaximum:   20 * gib,
+		},
+		{
+			name:              "volume type without backend",
+			parameters:        map[string]string{"type": "any-type"},
+			zone:              "az1",
+			expectedAvailable: 100 * gib,
+			expectedMaximum:   100 * gib,
+		},
+		{
+			name:              "availability parameter wins over topology",
+			parameters:        map[string]string{"availability": "az1"},
+			zone:              "az2",
+			expectedAvailable: 100 * gib,
+			expectedMaximum:   100 * gib,
+		},
+		{
+			name:              "no matching pools",
+			parameters:        map[string]string{"type": "ssd-type"},
+			zone:              "az1",
+			expectedAvailable: 0,
+			expectedMaximum:   0,
+		},
+		{
+			name:              "unlimited pool",
+			zone:              "az3",
+			expectedAvailable: math.MaxInt64,
+			expectedMaximum:   -1,
+		},
+		{
+			name:         "unknown volume type",
+			parameters:   map[string]string{"type": "missing-type"},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &csi.GetCapacityRequest{Parameters: test.parameters}
+			if test.zone != "" {
+				req.AccessibleTopology = &csi.Topology{Segments: map[string]string{topologyKey: test.zone}}
+			}
+
+			res, err := fakeCs.GetCapacity(FakeCtx, req)
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedAvailable, res.GetAvailableCapacity())
+			if test.expectedMaximum < 0 {
+				assert.Nil(t, res.GetMaximumVolumeSize())
+			} else {
+				assert.Equal(t, test.expectedMaximum, res.GetMaximumVolumeSize().GetValue())
+			}
+		})
+	}
+}
@@ -60,6 +60,9 @@ type Driver struct {
 	fqVersion string //Fully qualified version in format {Version}@{CPO version}
 	endpoint  string
 	cluster   string
+	// controllerPublishDisabled makes the node plugin attach the volumes to the node on its own, see
+	// DisableControllerPublish
+	controllerPublishDisabled bool
 
 	ids *identityServer
 	cs  *controllerServer
@@ -93,6 +96,8 @@ func NewDriver(endpoint, cluster string) *Driver {
 			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
 			csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
 			csi.ControllerServiceCapability_RPC_GET_VOLUME,
+			csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+			csi.ControllerServiceCapability_RPC_GET_CAPACITY,
 		})
 	d.AddVolumeCapabilityAccessModes(
 		[]csi.VolumeCapability_AccessMode_Mode{
@@ -106,6 +111,7 @@ func NewDriver(endpoint, cluster string) *Driver {
 			csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 			csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
 			csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+			csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 		})
 
 	return d
@@ -122,6 +128,28 @@ func (d *Driver) AddControllerServiceCapabilities(cl []csi.ControllerServiceCapa
 	d.cscap = csc
 }
 
+// DisableControllerPublish stops advertising the PUBLISH_UNPUBLISH_VOLUME controller capability, so that no
+// external-attacher is needed: the node plugin attaches the volumes to the node in Cinder and connects to them on its
+// own when staging them. The volumes can only be attached this way with the local attach type, without Nova.
+func (d *Driver) DisableControllerPublish(attachType string) error {
+	if attachType != openstack.AttachTypeLocal {
+		return fmt.Errorf("controller publish can only be disabled with attach-type %s, the volumes are attached with %q", openstack.AttachTypeLocal, attachType)
+	}
+
+	var cscap []*csi.ControllerServiceCapability
+	for _, c := range d.cscap {
+		switch c.GetRpc().GetType() {
+		case csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME, csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES:
+			klog.Infof("Disabling controller service capability: %v", c.GetRpc().GetType().String())
+			continue
+		}
+		cscap = append(cscap, c)
+	}
+	d.cscap = cscap
+	d.controllerPublishDisabled = true
+	return nil
+}
+
 func (d *Driver) AddVolumeCapabilityAccessModes(vc []csi.VolumeCapability_AccessMode_Mode) []*csi.VolumeCapability_AccessMode {
 	vca := make([]*csi.VolumeCapability_AccessMode, 0, len(vc))
 
@@ -21,6 +21,10 @@ import (
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
 )
 
 var (
@@ -60,3 +64,23 @@ func TestValidateControllerServiceRequest(t *testing.T) {
 	err = d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
 	assert.NoError(t, err)
 }
+
+func TestDisableControllerPublish(t *testing.T) {
+	d := NewFakeDriver()
+
+	// The volumes can only be attached by the nodes locally
+	assert.Error(t, d.DisableControllerPublish(""))
+	assert.Error(t, d.DisableControllerPublish(openstack.AttachTypeAuto))
+	assert.NoError(t, d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME))
+
+	assert.NoError(t, d.DisableControllerPublish(openstack.AttachTypeLocal))
+	assert.Error(t, d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME))
+	assert.Error(t, d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES))
+	assert.NoError(t, d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME))
+
+	cs := NewControllerServer(d, new(openstack.OpenStackMock))
+	_, err := cs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{VolumeId: FakeVolID, NodeId: FakeNodeID})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = cs.ControllerUnpublishVolume(FakeCtx, &csi.ControllerUnpublishVolumeRequest{VolumeId: FakeVolID, NodeId: FakeNodeID})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
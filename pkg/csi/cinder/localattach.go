@@ -0,0 +1,540 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+)
+
+const (
+	localConnectionFileSuffix = ".localconnection.json"
+	iscsiInitiatorNameFile    = "/etc/iscsi/initiatorname.iscsi"
+
+	driverVolumeTypeISCSI = "iscsi"
+	driverVolumeTypeRBD   = "rbd"
+
+	localDevicePollInterval = 1 * time.Second
+
+	// Exit statuses of iscsiadm
+	iscsiErrNoObjsFound   = 21
+	iscsiErrSessionExists = 15
+)
+
+// The devices of the node, variables so that the tests can point them to a temporary directory
+var (
+	diskByPathDir      = "/dev/disk/by-path"
+	sysBlockDir        = "/sys/block"
+	localDeviceTimeout = 30 * time.Second
+)
+
+// localConnection is the connection of the node to a volume attached locally, see openstack.AttachTypeLocal. It's
+// saved next to the staging target path, so that the node disconnects from the volume with the same connection info
+// and connector it connected with, even if they changed in the meanwhile.
+type localConnection struct {
+	Connector        openstack.Connector    `json:"connector"`
+	DriverVolumeType string                 `json:"driverVolumeType"`
+	Data             map[string]interface{} `json:"data"`
+	DevicePath       string                 `json:"devicePath"`
+}
+
+// isLocalNode tells if the volumes are attached locally on this node rather than with Nova. With the auto attach
+// type, it's the case of the nodes that aren't Nova instances, i.e. without an instance ID in the metadata.
+func (ns *nodeServer) isLocalNode() bool {
+	switch ns.Cloud.GetBlockStorageOpts().AttachType {
+	case openstack.AttachTypeLocal:
+		return true
+	case openstack.AttachTypeAuto:
+		_, err := ns.Metadata.GetInstanceID()
+		return err != nil
+	}
+	return false
+}
+
+// isLocalAttach tells if the volume of the publish context is attached locally on the node. It's always the case when
+// controller publish is disabled, there's no publish context then.
+func (ns *nodeServer) isLocalAttach(publishContext map[string]string) bool {
+	return ns.Driver.controllerPublishDisabled || publishContext[attachTypeKey] == openstack.AttachTypeLocal
+}
+
+// attachToNode marks the volume as attached to the node in Cinder when controller publish is disabled, as the
+// controller plugin does otherwise. It's a no-op if controller publish is enabled.
+func (ns *nodeServer) attachToNode(volumeID string) error {
+	if !ns.Driver.controllerPublishDisabled {
+		return nil
+	}
+	hostName, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get the host name: %v", err)
+	}
+	return ns.Cloud.AttachVolumeToHost(volumeID, hostName)
+}
+
+// detachFromNode marks the volume as detached from the node in Cinder when controller publish is disabled. It's a
+// no-op if controller publish is enabled or the volume isn't attached to the node.
+func (ns *nodeServer) detachFromNode(volumeID string) error {
+	if !ns.Driver.controllerPublishDisabled {
+		return nil
+	}
+	hostName, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get the host name: %v", err)
+	}
+	return ns.Cloud.DetachVolumeFromHost(volumeID, hostName)
+}
+
+// connectLocalVolume connects the node to the volume attached to it locally and returns the device of the volume. When
+// controller publish is disabled, the volume is attached to the node first, and detached again if the node fails to
+// connect to it.
+func (ns *nodeServer) connectLocalVolume(volumeID, stagingTarget string) (devicePath string, err error) {
+	conn, err := loadLocalConnection(volumeID, stagingTarget)
+	if err != nil {
+		return "", err
+	}
+	if conn != nil {
+		if _, err := os.Stat(conn.DevicePath); err == nil {
+			return conn.DevicePath, nil
+		}
+		klog.V(3).Infof("Device %s of volume %s is gone, connecting to the volume again", conn.DevicePath, volumeID)
+	}
+
+	if err := ns.attachToNode(volumeID); err != nil {
+		return "", err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if derr := ns.detachFromNode(volumeID); derr != nil {
+			klog.Warningf("Failed to detach volume %s from the node: %v", volumeID, derr)
+		}
+	}()
+
+	connector, err := getLocalConnector()
+	if err != nil {
+		return "", err
+	}
+	info, err := ns.Cloud.InitializeConnection(volumeID, connector)
+	if err != nil {
+		return "", err
+	}
+
+	conn = &localConnection{Connector: connector}
+	conn.DriverVolumeType, _ = info["driver_volume_type"].(string)
+	conn.Data, _ = info["data"].(map[string]interface{})
+
+	exec := ns.Mount.Mounter().Exec
+	switch conn.DriverVolumeType {
+	case driverVolumeTypeISCSI:
+		// A partial iSCSI connection is cleaned up by connectISCSI
+		conn.DevicePath, err = connectISCSI(exec, conn.Data)
+	case driverVolumeTypeRBD:
+		conn.DevicePath, err = connectRBD(exec, conn.Data)
+	default:
+		err = fmt.Errorf("unsupported driver volume type %q, only %s and %s volumes can be attached locally", conn.DriverVolumeType, driverVolumeTypeISCSI, driverVolumeTypeRBD)
+	}
+	if err != nil {
+		if terr := ns.Cloud.TerminateConnection(volumeID, connector); terr != nil {
+			klog.Warningf("Failed to terminate the connection of volume %s: %v", volumeID, terr)
+		}
+		return "", fmt.Errorf("failed to connect to volume %s: %v", volumeID, err)
+	}
+
+	if err := saveLocalConnection(volumeID, stagingTarget, conn); err != nil {
+		// The node couldn't disconnect from the volume later without the saved connection
+		if rerr := ns.releaseLocalConnection(volumeID, conn); rerr != nil {
+			klog.Warningf("Failed to roll back the connection to volume %s: %v", volumeID, rerr)
+		}
+		return "", err
+	}
+	klog.V(2).Infof("Connected to volume %s at %s", volumeID, conn.DevicePath)
+	return conn.DevicePath, nil
+}
+
+// disconnectLocalVolume disconnects the node from the volume it connected to with connectLocalVolume, and detaches the
+// volume from the node when controller publish is disabled. It's a no-op for volumes that aren't attached locally.
+func (ns *nodeServer) disconnectLocalVolume(volumeID, stagingTarget string) error {
+	conn, err := loadLocalConnection(volumeID, stagingTarget)
+	if err != nil {
+		return err
+	}
+
+	if conn != nil {
+		if err := ns.releaseLocalConnection(volumeID, conn); err != nil {
+			return err
+		}
+
+		if err := os.Remove(localConnectionPath(volumeID, stagingTarget)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove the local connection of volume %s: %v", volumeID, err)
+		}
+		klog.V(2).Infof("Disconnected from volume %s", volumeID)
+	}
+	return ns.detachFromNode(volumeID)
+}
+
+// rollbackLocalVolume disconnects the node from the volume when it failed to be staged, as the CO doesn't unstage the
+// volumes it failed to stage. A failure only gets logged, the next attempt connects to the volume again anyway.
+func (ns *nodeServer) rollbackLocalVolume(volumeID, stagingTarget string) {
+	klog.V(3).Infof("Rolling back the connection to volume %s which failed to be staged", volumeID)
+	if err := ns.disconnectLocalVolume(volumeID, stagingTarget); err != nil {
+		klog.Warningf("Failed to roll back the connection to volume %s: %v", volumeID, err)
+	}
+}
+
+// releaseLocalConnection removes the device of the connection from the node and terminates the connection in Cinder.
+// It's idempotent, the device or the iSCSI session being gone already isn't an error.
+func (ns *nodeServer) releaseLocalConnection(volumeID string, conn *localConnection) error {
+	var err error
+	exec := ns.Mount.Mounter().Exec
+	switch conn.DriverVolumeType {
+	case driverVolumeTypeISCSI:
+		err = disconnectISCSI(exec, conn.Data, conn.DevicePath)
+	case driverVolumeTypeRBD:
+		err = disconnectRBD(exec, conn.DevicePath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to disconnect from volume %s: %v", volumeID, err)
+	}
+	return ns.Cloud.TerminateConnection(volumeID, conn.Connector)
+}
+
+// getLocalDevicePath returns the device of the volume attached locally, once the node connected to it.
+func getLocalDevicePath(volumeID, stagingTarget string) (string, error) {
+	conn, err := loadLocalConnection(volumeID, stagingTarget)
+	if err != nil {
+		return "", err
+	}
+	if conn == nil {
+		return "", fmt.Errorf("volume %s isn't connected to the node", volumeID)
+	}
+	return conn.DevicePath, nil
+}
+
+// localConnectionPath is the file the connection to the volume is saved in. The parent directory of the staging
+// target path is used since the staging target path is the mount point of the volume, the name of the file is unique
+// as the directory is shared by all the block volumes.
+func localConnectionPath(volumeID, stagingTarget string) string {
+	return filepath.Join(filepath.Dir(stagingTarget), volumeID+localConnectionFileSuffix)
+}
+
+// loadLocalConnection loads the saved connection to the volume, nil if the node isn't connected to it.
+func loadLocalConnection(volumeID, stagingTarget string) (*localConnection, error) {
+	data, err := os.ReadFile(localConnectionPath(volumeID, stagingTarget))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the local connection of volume %s: %v", volumeID, err)
+	}
+
+	conn := &localConnection{}
+	if err := json.Unmarshal(data, conn); err != nil {
+		return nil, fmt.Errorf("failed to parse the local connection of volume %s: %v", volumeID, err)
+	}
+	return conn, nil
+}
+
+// saveLocalConnection saves the connection to the volume. It's only readable by root as the connection info may
+// contain credentials.
+func saveLocalConnection(volumeID, stagingTarget string, conn *localConnection) error {
+	data, err := json.Marshal(conn)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(stagingTarget), 0750); err != nil {
+		return fmt.Errorf("failed to create the directory of the local connection of volume %s: %v", volumeID, err)
+	}
+	if err := os.WriteFile(localConnectionPath(volumeID, stagingTarget), data, 0600); err != nil {
+		return fmt.Errorf("failed to save the local connection of volume %s: %v", volumeID, err)
+	}
+	return nil
+}
+
+// getLocalConnector describes the node to Cinder: its host name, its IP and its iSCSI initiator name, if any.
+func getLocalConnector() (openstack.Connector, error) {
+	var connector openstack.Connector
+
+	hostName, err := os.Hostname()
+	if err != nil {
+		return connector, fmt.Errorf("failed to get the host name: %v", err)
+	}
+	connector.Host = hostName
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return connector, fmt.Errorf("failed to get the IP addresses of the host: %v", err)
+	}
+	connector.IP = getConnectorIP(addrs)
+
+	// The initiator name is only needed for iSCSI volumes
+	data, err := os.ReadFile(iscsiInitiatorNameFile)
+	if err != nil && !os.IsNotExist(err) {
+		return connector, fmt.Errorf("failed to read the iSCSI initiator name: %v", err)
+	}
+	connector.Initiator = parseInitiatorName(string(data))
+
+	return connector, nil
+}
+
+// getConnectorIP returns the first global unicast address, IPv4 addresses first.
+func getConnectorIP(addrs []net.Addr) string {
+	var ipv6 string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+		if ipv6 == "" {
+			ipv6 = ipNet.IP.String()
+		}
+	}
+	return ipv6
+}
+
+// parseInitiatorName parses the content of the initiator name file of open-iscsi.
+func parseInitiatorName(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, found := strings.CutPrefix(line, "InitiatorName="); found {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// iscsiTarget is the target of an iSCSI volume, from the connection info returned by Cinder.
+type iscsiTarget struct {
+	portal   string
+	iqn      string
+	lun      int
+	authUser string
+	authPass string
+}
+
+func parseISCSITarget(data map[string]interface{}) (*iscsiTarget, error) {
+	t := &iscsiTarget{}
+	t.portal, _ = data["target_portal"].(string)
+	t.iqn, _ = data["target_iqn"].(string)
+	if t.portal == "" || t.iqn == "" {
+		return nil, fmt.Errorf("the connection info lacks the target portal or IQN")
+	}
+	// JSON numbers are decoded as float64
+	if lun, ok := data["target_lun"].(float64); ok {
+		t.lun = int(lun)
+	}
+	if method, _ := data["auth_method"].(string); strings.EqualFold(method, "CHAP") {
+		t.authUser, _ = data["auth_username"].(string)
+		t.authPass, _ = data["auth_password"].(string)
+	}
+	return t, nil
+}
+
+// devicePath is the udev link to the device of the LUN.
+func (t *iscsiTarget) devicePath() string {
+	return filepath.Join(diskByPathDir, fmt.Sprintf("ip-%s-iscsi-%s-lun-%d", t.portal, t.iqn, t.lun))
+}
+
+func (t *iscsiTarget) iscsiadm(exec utilexec.Interface, args ...string) ([]byte, error) {
+	args = append([]string{"-m", "node", "-T", t.iqn, "-p", t.portal}, args...)
+	return exec.Command("iscsiadm", args...).CombinedOutput()
+}
+
+// isISCSIExitStatus tells if iscsiadm failed with the exit status.
+func isISCSIExitStatus(err error, status int) bool {
+	var exitErr utilexec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitStatus() == status
+}
+
+// connectISCSI logs into the iSCSI target of the volume and returns the device of its LUN. On failure, the session
+// and the node it created are removed, so that no half-connected target is left behind.
+func connectISCSI(exec utilexec.Interface, data map[string]interface{}) (devicePath string, err error) {
+	t, err := parseISCSITarget(data)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		klog.V(3).Infof("Cleaning up the partial connection to the iSCSI target %s: %v", t.iqn, err)
+		if cerr := t.disconnect(exec, t.devicePath()); cerr != nil {
+			klog.Warningf("Failed to clean up the partial connection to the iSCSI target %s: %v", t.iqn, cerr)
+		}
+	}()
+
+	if out, err := t.iscsiadm(exec, "--op", "new"); err != nil {
+		return "", fmt.Errorf("failed to create the iSCSI node of %s: %v: %s", t.iqn, err, out)
+	}
+	if t.authUser != "" {
+		settings := [][]string{
+			{"node.session.auth.authmethod", "CHAP"},
+			{"node.session.auth.username", t.authUser},
+			{"node.session.auth.password", t.authPass},
+		}
+		for _, s := range settings {
+			// The output isn't logged, it may contain the password
+			if _, err := t.iscsiadm(exec, "--op", "update", "-n", s[0], "-v", s[1]); err != nil {
+				return "", fmt.Errorf("failed to set %s of the iSCSI node of %s: %v", s[0], t.iqn, err)
+			}
+		}
+	}
+
+	// The session may already exist, e.g. when another LUN of the target is in use
+	if out, err := t.iscsiadm(exec, "--login"); err != nil && !isISCSIExitStatus(err, iscsiErrSessionExists) {
+		return "", fmt.Errorf("failed to log into the iSCSI target %s: %v: %s", t.iqn, err, out)
+	}
+
+	devicePath = t.devicePath()
+	err = wait.PollUntilContextTimeout(context.Background(), localDevicePollInterval, localDeviceTimeout, true, func(context.Context) (bool, error) {
+		_, err := os.Stat(devicePath)
+		return err == nil, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("device %s didn't show up: %v", devicePath, err)
+	}
+	return devicePath, nil
+}
+
+// disconnectISCSI removes the device of the LUN and logs out of the iSCSI target of the volume, unless other LUNs of
+// the target are still in use.
+func disconnectISCSI(exec utilexec.Interface, data map[string]interface{}, devicePath string) error {
+	t, err := parseISCSITarget(data)
+	if err != nil {
+		return err
+	}
+	return t.disconnect(exec, devicePath)
+}
+
+// disconnect removes the device of the LUN, logs out of the target and deletes its node, each step being skipped if
+// it's done already.
+func (t *iscsiTarget) disconnect(exec utilexec.Interface, devicePath string) error {
+	if dev, err := filepath.EvalSymlinks(devicePath); err == nil {
+		deleteFile := filepath.Join(sysBlockDir, filepath.Base(dev), "device", "delete")
+		if err := os.WriteFile(deleteFile, []byte("1"), 0200); err != nil {
+			return fmt.Errorf("failed to remove device %s: %v", dev, err)
+		}
+	}
+
+	links, err := filepath.Glob(filepath.Join(diskByPathDir, fmt.Sprintf("ip-%s-iscsi-%s-lun-*", t.portal, t.iqn)))
+	if err != nil {
+		return err
+	}
+	// udev may not have removed the link of the device just removed yet
+	var others []string
+	for _, link := range links {
+		if link != devicePath {
+			others = append(others, link)
+		}
+	}
+	if len(others) > 0 {
+		klog.V(4).Infof("Other LUNs of the iSCSI target %s are in use, not logging out", t.iqn)
+		return nil
+	}
+
+	// There may be no session to log out of anymore
+	if out, err := t.iscsiadm(exec, "--logout"); err != nil && !isISCSIExitStatus(err, iscsiErrNoObjsFound) {
+		return fmt.Errorf("failed to log out of the iSCSI target %s: %v: %s", t.iqn, err, out)
+	}
+	if out, err := t.iscsiadm(exec, "--op", "delete"); err != nil && !isISCSIExitStatus(err, iscsiErrNoObjsFound) {
+		klog.Warningf("Failed to delete the iSCSI node of %s: %v: %s", t.iqn, err, out)
+	}
+	return nil
+}
+
+// connectRBD maps the RBD image of the volume and returns its device. The keyring of the Ceph user has to be on the
+// node.
+func connectRBD(exec utilexec.Interface, data map[string]interface{}) (string, error) {
+	args, err := rbdMapArgs(data)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("rbd", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to map the RBD image: %v: %s", err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// rbdMapArgs builds the arguments of rbd map from the connection info returned by Cinder.
+func rbdMapArgs(data map[string]interface{}) ([]string, error) {
+	name, _ := data["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("the connection info lacks the RBD image name")
+	}
+	args := []string{"map", name}
+
+	if user, _ := data["auth_username"].(string); user != "" {
+		args = append(args, "--id", user)
+	}
+	if cluster, _ := data["cluster_name"].(string); cluster != "" {
+		args = append(args, "--cluster", cluster)
+	}
+
+	hosts, _ := data["hosts"].([]interface{})
+	ports, _ := data["ports"].([]interface{})
+	var monitors []string
+	for i, h := range hosts {
+		host, _ := h.(string)
+		if host == "" {
+			continue
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if i < len(ports) {
+			if port, _ := ports[i].(string); port != "" {
+				host = host + ":" + port
+			}
+		}
+		monitors = append(monitors, host)
+	}
+	if len(monitors) > 0 {
+		args = append(args, "-m", strings.Join(monitors, ","))
+	}
+	return args, nil
+}
+
+// disconnectRBD unmaps the RBD image of the volume.
+func disconnectRBD(exec utilexec.Interface, devicePath string) error {
+	if _, err := os.Stat(devicePath); os.IsNotExist(err) {
+		return nil
+	}
+	if out, err := exec.Command("rbd", "unmap", devicePath).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unmap %s: %v: %s", devicePath, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/util/mount"
+	mountutils "k8s.io/mount-utils"
+	utilsexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestParseInitiatorName(t *testing.T) {
+	content := `## DO NOT EDIT OR REMOVE THIS FILE!
+## InitiatorName=iqn.1994-05.com.example:commented
+InitiatorName=iqn.1994-05.com.redhat:6c2b7a1e4f
+`
+	assert.Equal(t, "iqn.1994-05.com.redhat:6c2b7a1e4f", parseInitiatorName(content))
+	assert.Equal(t, "", parseInitiatorName(""))
+}
+
+func TestGetConnectorIP(t *testing.T) {
+	mustParseCIDR := func(s string) net.Addr {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		return ipNet
+	}
+
+	addrs := []net.Addr{
+		mustParseCIDR("127.0.0.1/8"),
+		mustParseCIDR("fe80::1/64"),
+		mustParseCIDR("2001:db8::10/64"),
+		mustParseCIDR("10.0.0.10/24"),
+	}
+	assert.Equal(t, "10.0.0.10", getConnectorIP(addrs))
+	assert.Equal(t, "2001:db8::10", getConnectorIP(addrs[:3]))
+	assert.Equal(t, "", getConnectorIP(addrs[:2]))
+}
+
+func TestParseISCSITarget(t *testing.T) {
+	var data map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"target_portal": "192.168.0.10:3260",
+		"target_iqn": "iqn.2010-10.org.openstack:volume-1",
+		"target_lun": 1,
+		"auth_method": "CHAP",
+		"auth_username": "user",
+		"auth_password": "secret"
+	}`), &data)
+	assert.NoError(t, err)
+
+	target, err := parseISCSITarget(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", target.authUser)
+	assert.Equal(t, "secret", target.authPass)
+	assert.Equal(t, "/dev/disk/by-path/ip-192.168.0.10:3260-iscsi-iqn.2010-10.org.openstack:volume-1-lun-1", target.devicePath())
+
+	_, err = parseISCSITarget(map[string]interface{}{"target_lun": 0})
+	assert.Error(t, err)
+}
+
+func TestRBDMapArgs(t *testing.T) {
+	var data map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"name": "volumes/volume-1",
+		"auth_username": "cinder",
+		"cluster_name": "ceph",
+		"hosts": ["192.168.0.1", "2001:db8::1"],
+		"ports": ["6789", "6789"]
+	}`), &data)
+	assert.NoError(t, err)
+
+	args, err := rbdMapArgs(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"map", "volumes/volume-1", "--id", "cinder", "--cluster", "ceph", "-m", "192.168.0.1:6789,[2001:db8::1]:6789"}, args)
+
+	_, err = rbdMapArgs(map[string]interface{}{})
+	assert.Error(t, err)
+}
+
+func TestLocalConnection(t *testing.T) {
+	stagingTarget := filepath.Join(t.TempDir(), "globalmount")
+
+	conn, err := loadLocalConnection(FakeVolID, stagingTarget)
+	assert.NoError(t, err)
+	assert.Nil(t, conn)
+
+	saved := &localConnection{
+		Connector:        openstack.Connector{Host: "edge-node", IP: "10.0.0.10"},
+		DriverVolumeType: driverVolumeTypeRBD,
+		Data:             map[string]interface{}{"name": "volumes/volume-1"},
+		DevicePath:       "/dev/rbd0",
+	}
+	assert.NoError(t, saveLocalConnection(FakeVolID, stagingTarget, saved))
+
+	conn, err = loadLocalConnection(FakeVolID, stagingTarget)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, conn)
+
+	devicePath, err := getLocalDevicePath(FakeVolID, stagingTarget)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/rbd0", devicePath)
+}
+
+// fakeISCSI runs iscsiadm against a fake iSCSI initiator, whose node, session and device are tracked to check that no
+// artifact is left behind. The command given in fail fails, the device doesn't show up if noDevice is set.
+type fakeISCSI struct {
+	t        *testing.T
+	fail     string
+	noDevice bool
+
+	node    bool
+	session bool
+	device  string
+}
+
+func newFakeISCSI(t *testing.T) *fakeISCSI {
+	dir := t.TempDir()
+	oldByPath, oldSysBlock, oldTimeout := diskByPathDir, sysBlockDir, localDeviceTimeout
+	diskByPathDir, sysBlockDir, localDeviceTimeout = filepath.Join(dir, "by-path"), filepath.Join(dir, "sys-block"), time.Millisecond
+	t.Cleanup(func() {
+		diskByPathDir, sysBlockDir, localDeviceTimeout = oldByPath, oldSysBlock, oldTimeout
+	})
+	assert.NoError(t, os.MkdirAll(diskByPathDir, 0750))
+	assert.NoError(t, os.MkdirAll(filepath.Join(sysBlockDir, "sdb", "device"), 0750))
+	device := filepath.Join(dir, "sdb")
+	assert.NoError(t, os.WriteFile(device, nil, 0600))
+	return &fakeISCSI{t: t, device: device}
+}
+
+func (f *fakeISCSI) Command(cmd string, args ...string) utilsexec.Cmd {
+	return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+		CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+			return nil, nil, f.run(cmd, args)
+		}},
+	}, cmd, args...)
+}
+
+func (f *fakeISCSI) CommandContext(ctx context.Context, cmd string, args ...string) utilsexec.Cmd {
+	return f.Command(cmd, args...)
+}
+
+func (f *fakeISCSI) LookPath(file string) (string, error) {
+	return file, nil
+}
+
+func (f *fakeISCSI) run(cmd string, args []string) error {
+	// Only iscsiadm -m node -T <iqn> -p <portal> is supported, e.g. mkfs fails
+	if cmd != "iscsiadm" || len(args) < 7 {
+		return errors.New("unsupported command")
+	}
+	op := strings.Join(args[6:], " ")
+	if f.fail != "" && strings.HasPrefix(op, f.fail) {
+		return &testingexec.FakeExitError{Status: 1}
+	}
+	link := filepath.Join(diskByPathDir, "ip-"+args[5]+"-iscsi-"+args[3]+"-lun-1")
+	switch {
+	case op == "--op new":
+		f.node = true
+	case op == "--op delete":
+		if !f.node {
+			return &testingexec.FakeExitError{Status: iscsiErrNoObjsFound}
+		}
+		f.node = false
+	case op == "--login":
+		if f.session {
+			return &testingexec.FakeExitError{Status: iscsiErrSessionExists}
+		}
+		f.session = true
+		if !f.noDevice {
+			assert.NoError(f.t, os.Symlink(f.device, link))
+		}
+	case op == "--logout":
+		if !f.session {
+			return &testingexec.FakeExitError{Status: iscsiErrNoObjsFound}
+		}
+		// The devices of the session are removed on log out
+		f.session = false
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// assertClean checks that the node, the session and the device of the target are gone.
+func (f *fakeISCSI) assertClean(t *testing.T) {
+	assert.False(t, f.node, "the iSCSI node is left behind")
+	assert.False(t, f.session, "the iSCSI session is left behind")
+	links, err := filepath.Glob(filepath.Join(diskByPathDir, "*"))
+	assert.NoError(t, err)
+	assert.Empty(t, links, "the device is left behind")
+}
+
+func fakeISCSIConnectionInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"driver_volume_type": driverVolumeTypeISCSI,
+		"data": map[string]interface{}{
+			"target_portal": "192.168.0.10:3260",
+			"target_iqn":    "iqn.2010-10.org.openstack:volume-1",
+			"target_lun":    float64(1),
+			"auth_method":   "CHAP",
+			"auth_username": "user",
+			"auth_password": "secret",
+		},
+	}
+}
+
+func TestConnectISCSICleanup(t *testing.T) {
+	tests := []struct {
+		name     string
+		fail     string
+		noDevice bool
+	}{
+		{name: "node creation fails", fail: "--op new"},
+		{name: "CHAP setup fails", fail: "--op update"},
+		{name: "login fails", fail: "--login"},
+		{name: "device doesn't show up", noDevice: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iscsi := newFakeISCSI(t)
+			iscsi.fail = test.fail
+			iscsi.noDevice = test.noDevice
+
+			_, err := connectISCSI(iscsi, fakeISCSIConnectionInfo()["data"].(map[string]interface{}))
+			assert.Error(t, err)
+			iscsi.assertClean(t)
+		})
+	}
+
+	t.Run("connected", func(t *testing.T) {
+		iscsi := newFakeISCSI(t)
+		data := fakeISCSIConnectionInfo()["data"].(map[string]interface{})
+
+		devicePath, err := connectISCSI(iscsi, data)
+		assert.NoError(t, err)
+		assert.True(t, iscsi.session)
+
+		// Disconnecting is idempotent
+		assert.NoError(t, disconnectISCSI(iscsi, data, devicePath))
+		assert.NoError(t, disconnectISCSI(iscsi, data, devicePath))
+		iscsi.assertClean(t)
+	})
+}
+
+// localAttachMountMock runs the commands of the mounter with exec.
+type localAttachMountMock struct {
+	*mount.MountMock
+	exec utilsexec.Interface
+}
+
+func (m *localAttachMountMock) Mounter() *mountutils.SafeFormatAndMount {
+	return &mountutils.SafeFormatAndMount{
+		Interface: mount.NewFakeMounter(),
+		Exec:      m.exec,
+	}
+}
+
+func TestNodeStageVolumeLocalRollback(t *testing.T) {
+	tests := []struct {
+		name                      string
+		fail                      string
+		controllerPublishDisabled bool
+	}{
+		{
+			name: "login fails",
+			fail: "--login",
+		},
+		{
+			// The fake exec can't run mkfs
+			name: "mount fails",
+		},
+		{
+			name:                      "login fails without controller publish",
+			fail:                      "--login",
+			controllerPublishDisabled: true,
+		},
+		{
+			name:                      "mount fails without controller publish",
+			controllerPublishDisabled: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iscsi := newFakeISCSI(t)
+			iscsi.fail = test.fail
+			stagingTarget := filepath.Join(t.TempDir(), "globalmount")
+
+			osMock := new(openstack.OpenStackMock)
+			osMock.On("GetVolume", FakeVolID).Return(&FakeVol, nil)
+			osMock.On("InitializeConnection", FakeVolID, mock.Anything).Return(fakeISCSIConnectionInfo(), nil)
+			osMock.On("TerminateConnection", FakeVolID, mock.Anything).Return(nil)
+			osMock.On("AttachVolumeToHost", FakeVolID, mock.Anything).Return(nil)
+			osMock.On("DetachVolumeFromHost", FakeVolID, mock.Anything).Return(nil)
+			mountMock := &localAttachMountMock{MountMock: new(mount.MountMock), exec: iscsi}
+			mountMock.On("IsLikelyNotMountPointAttach", stagingTarget).Return(true, nil)
+			d := NewDriver(FakeEndpoint, FakeCluster)
+			publishContext := map[string]string{attachTypeKey: openstack.AttachTypeLocal}
+			if test.controllerPublishDisabled {
+				assert.NoError(t, d.DisableControllerPublish(openstack.AttachTypeLocal))
+				publishContext = nil
+			}
+			ns := NewNodeServer(d, mountMock, metamock, osMock)
+
+			_, err := ns.NodeStageVolume(FakeCtx, &csi.NodeStageVolumeRequest{
+				VolumeId:          FakeVolID,
+				PublishContext:    publishContext,
+				StagingTargetPath: stagingTarget,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			})
+			assert.Equal(t, codes.Internal, status.Code(err))
+
+			iscsi.assertClean(t)
+			osMock.AssertCalled(t, "TerminateConnection", FakeVolID, mock.Anything)
+			conn, err := loadLocalConnection(FakeVolID, stagingTarget)
+			assert.NoError(t, err)
+			assert.Nil(t, conn, "the local connection is left behind")
+
+			// The node attaches the volume to itself without controller publish
+			if test.controllerPublishDisabled {
+				osMock.AssertCalled(t, "AttachVolumeToHost", FakeVolID, mock.Anything)
+				osMock.AssertCalled(t, "DetachVolumeFromHost", FakeVolID, mock.Anything)
+			} else {
+				osMock.AssertNotCalled(t, "AttachVolumeToHost", FakeVolID, mock.Anything)
+				osMock.AssertNotCalled(t, "DetachVolumeFromHost", FakeVolID, mock.Anything)
+			}
+		})
+	}
+}
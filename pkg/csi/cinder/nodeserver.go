@@ -45,10 +45,11 @@ type nodeServer struct {
 	Mount    mount.IMount
 	Metadata metadata.IMetadata
 	Cloud    openstack.IOpenStack
+	csi.UnimplementedNodeServer
 }
 
 func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
-	klog.V(4).Infof("NodePublishVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodePublishVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	source := req.GetStagingTargetPath()
@@ -150,7 +151,7 @@ func nodePublishEphemeral(req *csi.NodePublishVolumeRequest, ns *nodeServer) (*c
 		volumeType = ""
 	}
 
-	evol, err := ns.Cloud.CreateVolume(volName, size, volumeType, volAvailability, "", "", &properties)
+	evol, err := ns.Cloud.CreateVolume(volName, size, volumeType, volAvailability, "", "", &properties, nil)
 
 	if err != nil {
 		klog.V(3).Infof("Failed to Create Ephemeral Volume: %v", err)
@@ -191,7 +192,8 @@ func nodePublishEphemeral(req *csi.NodePublishVolumeRequest, ns *nodeServer) (*c
 
 	m := ns.Mount
 
-	devicePath, err := getDevicePath(evol.ID, m)
+	// There's no publish context for ephemeral volumes, the device name returned by Nova is unknown.
+	devicePath, err := getDevicePath(evol.ID, "", m, ns.Cloud.GetBlockStorageOpts())
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to find Device path for volume: %v", err))
 	}
@@ -220,7 +222,7 @@ func nodePublishEphemeral(req *csi.NodePublishVolumeRequest, ns *nodeServer) (*c
 }
 
 func nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, ns *nodeServer, mountOptions []string) (*csi.NodePublishVolumeResponse, error) {
-	klog.V(4).Infof("NodePublishVolumeBlock: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodePublishVolumeBlock: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	targetPath := req.GetTargetPath()
@@ -228,8 +230,14 @@ func nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, ns *nodeServer
 
 	m := ns.Mount
 
-	// Do not trust the path provided by cinder, get the real path on node
-	source, err := getDevicePath(volumeID, m)
+	var source string
+	var err error
+	if ns.isLocalAttach(req.GetPublishContext()) {
+		source, err = getLocalDevicePath(volumeID, req.GetStagingTargetPath())
+	} else {
+		// Do not trust the path provided by cinder, get the real path on node
+		source, err = getDevicePath(volumeID, req.GetPublishContext()["DevicePath"], m, ns.Cloud.GetBlockStorageOpts())
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to find Device path for volume: %v", err))
 	}
@@ -259,7 +267,7 @@ func nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, ns *nodeServer
 }
 
 func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
-	klog.V(4).Infof("NodeUnPublishVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodeUnPublishVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	targetPath := req.GetTargetPath()
@@ -342,7 +350,7 @@ func nodeUnpublishEphemeral(req *csi.NodeUnpublishVolumeRequest, ns *nodeServer,
 }
 
 func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
-	klog.V(4).Infof("NodeStageVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodeStageVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	stagingTarget := req.GetStagingTargetPath()
 	volumeCapability := req.GetVolumeCapability()
@@ -368,19 +376,48 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 	}
 
 	m := ns.Mount
-	// Do not trust the path provided by cinder, get the real path on node
-	devicePath, err := getDevicePath(volumeID, m)
+	var devicePath string
+	localAttach := ns.isLocalAttach(req.GetPublishContext())
+	if localAttach {
+		devicePath, err = ns.connectLocalVolume(volumeID, stagingTarget)
+	} else {
+		// Do not trust the path provided by cinder, get the real path on node
+		devicePath, err = getDevicePath(volumeID, req.GetPublishContext()["DevicePath"], m, ns.Cloud.GetBlockStorageOpts())
+	}
 	if err != nil {
+		if volumeCapability.GetBlock() == nil {
+			// The device is gone, a mount left behind at the staging target path is stale
+			if _, err := checkStagingTarget(m, stagingTarget, ""); err != nil {
+				klog.Warningf("Failed to clean up staging target path %s: %v", stagingTarget, err)
+			}
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to find Device path for volume: %v", err))
 	}
 
+	// The local connection is rolled back if the volume fails to be mounted
+	staged := false
+	if localAttach {
+		defer func() {
+			if !staged {
+				ns.rollbackLocalVolume(volumeID, stagingTarget)
+			}
+		}()
+	}
+
 	if blk := volumeCapability.GetBlock(); blk != nil {
+		staged = true
 		// If block volume, do nothing
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
-	// Verify whether mounted
-	notMnt, err := m.IsLikelyNotMountPointAttach(stagingTarget)
+	readOnlyAttach := req.GetPublishContext()[attachModeKey] == attachModeReadOnly
+	if ns.Driver.controllerPublishDisabled {
+		// The node attached the volume itself, read-only if the volume is
+		readOnlyAttach = strings.EqualFold(vol.Metadata[openstack.VolumeReadOnlyKey], "true")
+	}
+
+	// Verify whether mounted, a stale mount is cleaned up first
+	notMnt, err := checkStagingTarget(m, stagingTarget, devicePath)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -397,15 +434,26 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 			mountFlags := mnt.GetMountFlags()
 			options = append(options, collectMountOptions(fsType, mountFlags)...)
 		}
-		// Mount
-		err = m.Mounter().FormatAndMount(devicePath, stagingTarget, fsType, options)
+		// A read-only attachment can't be mounted read-write
+		if readOnlyAttach {
+			options = append(options, "ro")
+		}
+		var formatOptions []string
+		if mkfsOpts := req.GetVolumeContext()[mkfsOptionsKey]; mkfsOpts != "" {
+			if formatOptions, err = parseMkfsOptions(fsType, mkfsOpts); err != nil {
+				return nil, err
+			}
+		}
+		// Mount, the volume is only formatted if it isn't formatted yet
+		err = m.Mounter().FormatAndMountSensitiveWithFormatOptions(devicePath, stagingTarget, fsType, options, nil, formatOptions)
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 	}
+	staged = true
 
 	// Try expanding the volume if it's created from a snapshot or another volume (see #1539)
-	if vol.SourceVolID != "" || vol.SnapshotID != "" {
+	if !readOnlyAttach && (vol.SourceVolID != "" || vol.SnapshotID != "") {
 
 		r := mountutil.NewResizeFs(ns.Mount.Mounter().Exec)
 
@@ -427,7 +475,7 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 }
 
 func (ns *nodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
-	klog.V(4).Infof("NodeUnstageVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodeUnstageVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -453,21 +501,41 @@ func (ns *nodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 		return nil, status.Errorf(codes.Internal, "Unmount of targetPath %s failed with error %v", stagingTargetPath, err)
 	}
 
+	if err := ns.disconnectLocalVolume(volumeID, stagingTargetPath); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
 func (ns *nodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 
-	nodeID, err := ns.Metadata.GetInstanceID()
-	if err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("[NodeGetInfo] unable to retrieve instance id of node %v", err))
+	// The nodes the volumes are attached to locally aren't Nova instances, they're known to Cinder by their host name
+	localNode := ns.isLocalNode()
+	var nodeID string
+	var err error
+	if localNode {
+		nodeID, err = os.Hostname()
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("[NodeGetInfo] unable to retrieve host name of node %v", err))
+		}
+	} else {
+		nodeID, err = ns.Metadata.GetInstanceID()
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("[NodeGetInfo] unable to retrieve instance id of node %v", err))
+		}
 	}
 
+	var topology *csi.Topology
 	zone, err := ns.Metadata.GetAvailabilityZone()
 	if err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("[NodeGetInfo] Unable to retrieve availability zone of node %v", err))
+		if !localNode {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("[NodeGetInfo] Unable to retrieve availability zone of node %v", err))
+		}
+		klog.Warningf("[NodeGetInfo] Unable to retrieve availability zone of node, its topology is unknown: %v", err)
+	} else {
+		topology = &csi.Topology{Segments: map[string]string{topologyKey: zone}}
 	}
-	topology := &csi.Topology{Segments: map[string]string{topologyKey: zone}}
 
 	maxVolume := ns.Cloud.GetMaxVolLimit()
 
@@ -487,7 +555,7 @@ func (ns *nodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetC
 }
 
 func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
-	klog.V(4).Infof("NodeGetVolumeStats: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodeGetVolumeStats: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -519,6 +587,7 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 					Unit:  csi.VolumeUsage_BYTES,
 				},
 			},
+			VolumeCondition: ns.getVolumeCondition(volumeID, volumePath, true),
 		}, nil
 	}
 
@@ -527,11 +596,36 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 			{Total: stats.TotalBytes, Available: stats.AvailableBytes, Used: stats.UsedBytes, Unit: csi.VolumeUsage_BYTES},
 			{Total: stats.TotalInodes, Available: stats.AvailableInodes, Used: stats.UsedInodes, Unit: csi.VolumeUsage_INODES},
 		},
+		VolumeCondition: ns.getVolumeCondition(volumeID, volumePath, false),
 	}, nil
 }
 
+// getVolumeCondition reports the volume as abnormal when the Cinder volume is in an error state or is gone, or when
+// the filesystem mounted at the volume path is unhealthy, see CheckMountHealth. Block volumes have no filesystem to
+// check. Failing to get the Cinder volume doesn't make the volume abnormal.
+func (ns *nodeServer) getVolumeCondition(volumeID, volumePath string, block bool) *csi.VolumeCondition {
+	vol, err := ns.Cloud.GetVolume(volumeID)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("Volume %s not found", volumeID)}
+		}
+		klog.Warningf("Failed to get volume %s to check its condition: %v", volumeID, err)
+	} else if strings.HasPrefix(vol.Status, "error") {
+		// All the error states of Cinder, e.g. error_extending or error_restoring.
+		return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("Volume %s is in %s state", volumeID, vol.Status)}
+	}
+
+	if !block {
+		if err := ns.Mount.CheckMountHealth(volumePath); err != nil {
+			return &csi.VolumeCondition{Abnormal: true, Message: err.Error()}
+		}
+	}
+
+	return &csi.VolumeCondition{Abnormal: false, Message: "Volume is healthy"}
+}
+
 func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	klog.V(4).Infof("NodeExpandVolume: called with args %+v", protosanitizer.StripSecrets(*req))
+	klog.V(4).Infof("NodeExpandVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
@@ -550,6 +644,15 @@ func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Error(codes.Internal, fmt.Sprintf("NodeExpandVolume failed with error %v", err))
 	}
 
+	// The volume capability is optional, a published block volume is the device itself.
+	block := req.GetVolumeCapability().GetBlock() != nil
+	if req.GetVolumeCapability() == nil {
+		block, _ = blockdevice.IsBlockDevice(volumePath)
+	}
+	if block {
+		return expandBlockVolume(volumeID, volumePath, req.GetCapacityRange().GetRequiredBytes())
+	}
+
 	output, err := ns.Mount.GetMountFs(volumePath)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Failed to find mount file system %s: %v", volumePath, err))
@@ -574,11 +677,41 @@ func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 	return &csi.NodeExpandVolumeResponse{}, nil
 }
 
-func getDevicePath(volumeID string, m mount.IMount) (string, error) {
-	var devicePath string
-	devicePath, err := m.GetDevicePath(volumeID)
+// blockDevicePath finds the device of a published block volume, replaced in the tests.
+var blockDevicePath = blockdevice.GetBlockDevicePath
+
+// expandBlockVolume rescans the device of the block volume published at volumePath until it has the new size, and
+// returns its size. There's no filesystem to resize, the pod gets the device.
+func expandBlockVolume(volumeID, volumePath string, newSize int64) (*csi.NodeExpandVolumeResponse, error) {
+	devicePath, err := blockDevicePath(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to find the device of block volume %q: %v", volumeID, err)
+	}
+	if err := blockdevice.RescanBlockDeviceGeometry(devicePath, volumePath, newSize); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not verify %q volume size: %v", volumeID, err)
+	}
+	size, err := blockdevice.GetBlockDeviceSize(devicePath)
 	if err != nil {
-		klog.Warningf("Couldn't get device path from mount: %v", err)
+		return nil, status.Errorf(codes.Internal, "Could not get %q volume size: %v", volumeID, err)
+	}
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: size}, nil
+}
+
+// getDevicePath finds the device of the volume with the device discovery strategy and the device path prefix of the
+// config, the metadata is the last resort unless another strategy is forced. novaDevicePath is the device name
+// returned by Nova, from the publish context.
+func getDevicePath(volumeID, novaDevicePath string, m mount.IMount, opts openstack.BlockStorageOpts) (string, error) {
+	var devicePath string
+	var err error
+	strategy := opts.DeviceDiscovery
+	if strategy != mount.DeviceDiscoveryMetadata {
+		devicePath, err = m.GetDevicePath(volumeID, novaDevicePath, strategy, opts.DevicePathPrefix)
+		if err != nil {
+			klog.Warningf("Couldn't get device path from mount: %v", err)
+		}
+		if devicePath == "" && strategy != "" && strategy != mount.DeviceDiscoveryAuto {
+			return "", fmt.Errorf("couldn't find device with the %s device discovery strategy: %v", strategy, err)
+		}
 	}
 
 	if devicePath == "" {
@@ -595,6 +728,58 @@ func getDevicePath(volumeID string, m mount.IMount) (string, error) {
 
 }
 
+// checkStagingTarget tells if the volume has to be mounted at the staging target path. A stale mount, either a
+// corrupted one or the mount of another device than devicePath, e.g. after the volume got reattached under another
+// name, is unmounted first. devicePath is empty when the device of the volume is gone, any mount is stale then.
+func checkStagingTarget(m mount.IMount, stagingTarget, devicePath string) (bool, error) {
+	notMnt, err := m.IsLikelyNotMountPointAttach(stagingTarget)
+	if err != nil {
+		if !mountutil.IsCorruptedMnt(err) {
+			return false, err
+		}
+		klog.Warningf("Staging target path %s is a corrupted mount, unmounting it: %v", stagingTarget, err)
+		return unmountStagingTarget(m, stagingTarget)
+	}
+	if notMnt {
+		return true, nil
+	}
+
+	output, err := m.GetMountFs(stagingTarget)
+	if err != nil {
+		return false, fmt.Errorf("failed to find the device mounted at %s: %v", stagingTarget, err)
+	}
+	mountedDevice := strings.TrimSpace(string(output))
+	if devicePath != "" && sameDevice(mountedDevice, devicePath) {
+		return false, nil
+	}
+
+	klog.Warningf("Staging target path %s is a stale mount of %s, expected device %q, unmounting it", stagingTarget, mountedDevice, devicePath)
+	return unmountStagingTarget(m, stagingTarget)
+}
+
+// unmountStagingTarget unmounts the staging target path, which is recreated empty.
+func unmountStagingTarget(m mount.IMount, stagingTarget string) (bool, error) {
+	if err := m.UnmountPath(stagingTarget); err != nil {
+		return false, fmt.Errorf("failed to unmount stale staging target path %s: %v", stagingTarget, err)
+	}
+	return m.IsLikelyNotMountPointAttach(stagingTarget)
+}
+
+// sameDevice tells if both paths are the same device, once their symlinks are resolved. A path that can't be
+// resolved, e.g. of a device that's gone, is compared as is.
+func sameDevice(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return a == b
+}
+
 func collectMountOptions(fsType string, mntFlags []string) []string {
 	var options []string
 	options = append(options, mntFlags...)
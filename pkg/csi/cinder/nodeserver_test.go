@@ -20,13 +20,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/util/mount"
+	mountutils "k8s.io/mount-utils"
+	utilsexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
 )
 
 var fakeNs *nodeServer
@@ -89,7 +98,7 @@ func TestNodePublishVolume(t *testing.T) {
 
 	mmock.On("ScanForAttach", FakeDevicePath).Return(nil)
 	mmock.On("IsLikelyNotMountPointAttach", FakeTargetPath).Return(true, nil)
-	omock.On("GetVolume", FakeVolID).Return(FakeVol, nil)
+	omock.On("GetVolume", FakeVolID).Return(&FakeVol, nil)
 	// Init assert
 	assert := assert.New(t)
 
@@ -129,12 +138,12 @@ func TestNodePublishVolumeEphermeral(t *testing.T) {
 	fvolName := fmt.Sprintf("ephemeral-%s", FakeVolID)
 	tState := []string{"available"}
 
-	omock.On("CreateVolume", fvolName, 2, "test", "nova", "", "", &properties).Return(&FakeVol, nil)
+	omock.On("CreateVolume", fvolName, 2, "test", "nova", "", "", &properties, map[string]interface{}(nil)).Return(&FakeVol, nil)
 
 	omock.On("AttachVolume", FakeNodeID, FakeVolID).Return(FakeVolID, nil)
 	omock.On("WaitDiskAttached", FakeNodeID, FakeVolID).Return(nil)
 	omock.On("WaitVolumeTargetStatus", FakeVolID, tState).Return(nil)
-	mmock.On("GetDevicePath", FakeVolID).Return(FakeDevicePath, nil)
+	mmock.On("GetDevicePath", FakeVolID, "", "", "").Return(FakeDevicePath, nil)
 	mmock.On("IsLikelyNotMountPointAttach", FakeTargetPath).Return(true, nil)
 	metamock.On("GetAvailabilityZone").Return(FakeAvailability, nil)
 
@@ -182,9 +191,9 @@ func TestNodePublishVolumeEphermeral(t *testing.T) {
 // Test NodeStageVolume
 func TestNodeStageVolume(t *testing.T) {
 
-	mmock.On("GetDevicePath", FakeVolID).Return(FakeDevicePath, nil)
+	mmock.On("GetDevicePath", FakeVolID, FakeDevicePath, "", "").Return(FakeDevicePath, nil)
 	mmock.On("IsLikelyNotMountPointAttach", FakeStagingTargetPath).Return(true, nil)
-	omock.On("GetVolume", FakeVolID).Return(FakeVol, nil)
+	omock.On("GetVolume", FakeVolID).Return(&FakeVol, nil)
 
 	// Init assert
 	assert := assert.New(t)
@@ -218,6 +227,121 @@ func TestNodeStageVolume(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+// mkfsMountMock records the commands run by the mounter, the disk is formatted with the given filesystem if any.
+type mkfsMountMock struct {
+	*mount.MountMock
+	existingFormat string
+	commands       []string
+}
+
+func (m *mkfsMountMock) Mounter() *mountutils.SafeFormatAndMount {
+	fakeExec := &testingexec.FakeExec{}
+	fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) utilsexec.Cmd {
+		m.commands = append(m.commands, strings.Join(append([]string{cmd}, args...), " "))
+		return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+				if m.existingFormat == "" {
+					return nil, nil, &testingexec.FakeExitError{Status: 2}
+				}
+				return []byte("TYPE=" + m.existingFormat), nil, nil
+			}},
+		}, cmd, args...)
+	})
+	for i := 0; i < 2; i++ {
+		fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) utilsexec.Cmd {
+			m.commands = append(m.commands, strings.Join(append([]string{cmd}, args...), " "))
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) { return nil, nil, nil }},
+			}, cmd, args...)
+		})
+	}
+	return &mountutils.SafeFormatAndMount{
+		Interface: mount.NewFakeMounter(),
+		Exec:      fakeExec,
+	}
+}
+
+func TestNodeStageVolumeMkfsOptions(t *testing.T) {
+	tests := []struct {
+		name            string
+		existingFormat  string
+		fsType          string
+		mkfsOptions     string
+		expectedCommand string
+		expectedCode    codes.Code
+	}{
+		{
+			name:            "ext4 with mkfs options",
+			mkfsOptions:     "-i 65536 -m 0",
+			expectedCommand: "mkfs.ext4 -i 65536 -m 0 -F -m0 " + FakeDevicePath,
+		},
+		{
+			name:            "xfs with mkfs options",
+			fsType:          "xfs",
+			mkfsOptions:     "-i size=512",
+			expectedCommand: "mkfs.xfs -i size=512 -f " + FakeDevicePath,
+		},
+		{
+			name:            "without mkfs options",
+			expectedCommand: "mkfs.ext4 -F -m0 " + FakeDevicePath,
+		},
+		{
+			name:           "already formatted",
+			existingFormat: "ext4",
+			mkfsOptions:    "-i 65536",
+		},
+		{
+			name:         "invalid mkfs options",
+			mkfsOptions:  "-O ^has_journal",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mountMock := &mkfsMountMock{MountMock: new(mount.MountMock), existingFormat: test.existingFormat}
+			mountMock.On("GetDevicePath", FakeVolID, FakeDevicePath, "", "").Return(FakeDevicePath, nil)
+			mountMock.On("IsLikelyNotMountPointAttach", FakeStagingTargetPath).Return(true, nil)
+			ns := NewNodeServer(NewDriver(FakeEndpoint, FakeCluster), mountMock, metamock, omock)
+
+			volumeContext := map[string]string{}
+			if test.mkfsOptions != "" {
+				volumeContext[mkfsOptionsKey] = test.mkfsOptions
+			}
+			_, err := ns.NodeStageVolume(FakeCtx, &csi.NodeStageVolumeRequest{
+				VolumeId:          FakeVolID,
+				PublishContext:    map[string]string{"DevicePath": FakeDevicePath},
+				StagingTargetPath: FakeStagingTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: test.fsType},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: volumeContext,
+			})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedCode != codes.OK {
+				return
+			}
+
+			var mkfsCommands []string
+			for _, command := range mountMock.commands {
+				if strings.HasPrefix(command, "mkfs") {
+					mkfsCommands = append(mkfsCommands, command)
+				}
+			}
+			if test.expectedCommand == "" {
+				assert.Empty(t, mkfsCommands)
+			} else {
+				assert.Equal(t, []string{test.expectedCommand}, mkfsCommands)
+			}
+		})
+	}
+}
+
 func TestNodeStageVolumeBlock(t *testing.T) {
 
 	// Init assert
@@ -252,11 +376,115 @@ func TestNodeStageVolumeBlock(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+// stagingMountMock reports mountedDevice as the device mounted at the staging target path.
+type stagingMountMock struct {
+	*mount.MountMock
+	mountedDevice string
+}
+
+func (m *stagingMountMock) GetMountFs(pathname string) ([]byte, error) {
+	return []byte(m.mountedDevice + "\n"), nil
+}
+
+func TestCheckStagingTarget(t *testing.T) {
+	devDir := t.TempDir()
+	device := filepath.Join(devDir, "vdb")
+	if err := os.WriteFile(device, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	deviceLink := filepath.Join(devDir, "virtio-"+FakeVolID)
+	if err := os.Symlink(device, deviceLink); err != nil {
+		t.Fatal(err)
+	}
+	corruptedErr := &os.PathError{Op: "stat", Path: FakeStagingTargetPath, Err: syscall.ENOTCONN}
+
+	tests := []struct {
+		name            string
+		devicePath      string
+		mountedDevice   string
+		notMnt          bool
+		notMntErr       error
+		unmountErr      error
+		expectedNotMnt  bool
+		expectedUnmount bool
+		expectedErr     bool
+	}{
+		{
+			name:           "not mounted",
+			devicePath:     deviceLink,
+			notMnt:         true,
+			expectedNotMnt: true,
+		},
+		{
+			name:          "mount of the device",
+			devicePath:    deviceLink,
+			mountedDevice: device,
+		},
+		{
+			name:            "mount of another device",
+			devicePath:      deviceLink,
+			mountedDevice:   filepath.Join(devDir, "vdc"),
+			expectedNotMnt:  true,
+			expectedUnmount: true,
+		},
+		{
+			name:            "corrupted mount",
+			devicePath:      deviceLink,
+			notMntErr:       corruptedErr,
+			expectedNotMnt:  true,
+			expectedUnmount: true,
+		},
+		{
+			name:            "device gone",
+			mountedDevice:   device,
+			expectedNotMnt:  true,
+			expectedUnmount: true,
+		},
+		{
+			name:            "unmount failure",
+			devicePath:      deviceLink,
+			mountedDevice:   filepath.Join(devDir, "vdc"),
+			unmountErr:      fmt.Errorf("device busy"),
+			expectedUnmount: true,
+			expectedErr:     true,
+		},
+		{
+			name:        "mount point check failure",
+			devicePath:  deviceLink,
+			notMntErr:   os.ErrPermission,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &stagingMountMock{MountMock: new(mount.MountMock), mountedDevice: test.mountedDevice}
+			m.On("IsLikelyNotMountPointAttach", FakeStagingTargetPath).Return(test.notMnt, test.notMntErr).Once()
+			// The staging target path is recreated empty once unmounted
+			m.On("IsLikelyNotMountPointAttach", FakeStagingTargetPath).Return(true, nil).Once()
+			m.On("UnmountPath", FakeStagingTargetPath).Return(test.unmountErr)
+
+			notMnt, err := checkStagingTarget(m, FakeStagingTargetPath, test.devicePath)
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedNotMnt, notMnt)
+			}
+			if test.expectedUnmount {
+				m.AssertCalled(t, "UnmountPath", FakeStagingTargetPath)
+			} else {
+				m.AssertNotCalled(t, "UnmountPath", FakeStagingTargetPath)
+			}
+		})
+	}
+}
+
 // Test NodeUnpublishVolume
 func TestNodeUnpublishVolume(t *testing.T) {
 
 	mmock.On("UnmountPath", FakeTargetPath).Return(nil)
-	omock.On("GetVolume", FakeVolID).Return(FakeVol, nil)
+	omock.On("GetVolume", FakeVolID).Return(&FakeVol, nil)
 
 	// Init assert
 	assert := assert.New(t)
@@ -322,7 +550,7 @@ func TestNodeUnpublishVolumeEphermeral(t *testing.T) {
 func TestNodeUnstageVolume(t *testing.T) {
 
 	mmock.On("UnmountPath", FakeStagingTargetPath).Return(nil)
-	omock.On("GetVolume", FakeVolID).Return(FakeVol, nil)
+	omock.On("GetVolume", FakeVolID).Return(&FakeVol, nil)
 
 	// Init assert
 	assert := assert.New(t)
@@ -347,6 +575,7 @@ func TestNodeUnstageVolume(t *testing.T) {
 }
 
 func TestNodeExpandVolume(t *testing.T) {
+	omock.On("GetVolume", FakeVolName).Return(&FakeVol, nil)
 
 	// Init assert
 	assert := assert.New(t)
@@ -371,6 +600,52 @@ func TestNodeExpandVolume(t *testing.T) {
 
 }
 
+func TestNodeExpandVolumeBlock(t *testing.T) {
+	// A sparse file stands for the device of the published block volume.
+	device := filepath.Join(t.TempDir(), "vdb")
+	f, err := os.Create(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(2 << 30); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	defer func(f func(string) (string, error)) { blockDevicePath = f }(blockDevicePath)
+	blockDevicePath = func(path string) (string, error) {
+		if path != FakeTargetPath {
+			return "", fmt.Errorf("%q is not a block device", path)
+		}
+		return device, nil
+	}
+
+	blockCapability := &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}}
+	fakeReq := &csi.NodeExpandVolumeRequest{
+		VolumeId:         FakeVolName,
+		VolumePath:       FakeTargetPath,
+		VolumeCapability: blockCapability,
+		CapacityRange:    &csi.CapacityRange{RequiredBytes: 2 << 30},
+	}
+
+	// The device has the new size already, there's no filesystem to resize.
+	actualRes, err := fakeNs.NodeExpandVolume(FakeCtx, fakeReq)
+	assert.NoError(t, err)
+	assert.Equal(t, &csi.NodeExpandVolumeResponse{CapacityBytes: 2 << 30}, actualRes)
+
+	// The device cannot be rescanned, it's still smaller than the new size.
+	fakeReq.CapacityRange.RequiredBytes = 3 << 30
+	_, err = fakeNs.NodeExpandVolume(FakeCtx, fakeReq)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "current volume size is less than expected one")
+
+	// The published volume isn't a block device.
+	fakeReq.VolumePath = "/mnt/not-a-device"
+	_, err = fakeNs.NodeExpandVolume(FakeCtx, fakeReq)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "Unable to find the device of block volume")
+}
+
 func TestNodeGetVolumeStatsBlock(t *testing.T) {
 
 	// Init assert
@@ -397,6 +672,7 @@ func TestNodeGetVolumeStatsBlock(t *testing.T) {
 		Usage: []*csi.VolumeUsage{
 			{Total: FakeBlockDeviceStats.TotalBytes, Unit: csi.VolumeUsage_BYTES},
 		},
+		VolumeCondition: &csi.VolumeCondition{Abnormal: false, Message: "Volume is healthy"},
 	}
 
 	blockRes, err := fakeNs.NodeGetVolumeStats(FakeCtx, fakeReq)
@@ -428,11 +704,13 @@ func TestNodeGetVolumeStatsFs(t *testing.T) {
 	}
 
 	mmock.On("GetDeviceStats", volumePath).Return(FakeFsStats, nil)
+	mmock.On("CheckMountHealth", volumePath).Return(nil)
 	expectedFsRes := &csi.NodeGetVolumeStatsResponse{
 		Usage: []*csi.VolumeUsage{
 			{Total: FakeFsStats.TotalBytes, Available: FakeFsStats.AvailableBytes, Used: FakeFsStats.UsedBytes, Unit: csi.VolumeUsage_BYTES},
 			{Total: FakeFsStats.TotalInodes, Available: FakeFsStats.AvailableInodes, Used: FakeFsStats.UsedInodes, Unit: csi.VolumeUsage_INODES},
 		},
+		VolumeCondition: &csi.VolumeCondition{Abnormal: false, Message: "Volume is healthy"},
 	}
 
 	fsRes, err := fakeNs.NodeGetVolumeStats(FakeCtx, fakeReq)
@@ -441,3 +719,82 @@ func TestNodeGetVolumeStatsFs(t *testing.T) {
 	assert.Equal(expectedFsRes, fsRes)
 
 }
+
+// volumeCloudMock returns volume, or err, for any volume.
+type volumeCloudMock struct {
+	*openstack.OpenStackMock
+	volume *volumes.Volume
+	err    error
+}
+
+func (m *volumeCloudMock) GetVolume(volumeID string) (*volumes.Volume, error) {
+	return m.volume, m.err
+}
+
+func TestNodeGetVolumeStatsCondition(t *testing.T) {
+	volumePath := t.TempDir()
+	tests := []struct {
+		name              string
+		stats             *mount.DeviceStats
+		volume            *volumes.Volume
+		volumeErr         error
+		mountErr          error
+		expectedCondition *csi.VolumeCondition
+	}{
+		{
+			name:              "healthy",
+			stats:             FakeFsStats,
+			volume:            &volumes.Volume{ID: FakeVolID, Status: "in-use"},
+			expectedCondition: &csi.VolumeCondition{Abnormal: false, Message: "Volume is healthy"},
+		},
+		{
+			name:              "volume in error state",
+			stats:             FakeFsStats,
+			volume:            &volumes.Volume{ID: FakeVolID, Status: "error_extending"},
+			expectedCondition: &csi.VolumeCondition{Abnormal: true, Message: "Volume CSIVolumeID is in error_extending state"},
+		},
+		{
+			name:              "volume not found",
+			stats:             FakeFsStats,
+			volumeErr:         gophercloud.ErrDefault404{},
+			expectedCondition: &csi.VolumeCondition{Abnormal: true, Message: "Volume CSIVolumeID not found"},
+		},
+		{
+			name:              "failing to get the volume",
+			stats:             FakeFsStats,
+			volumeErr:         fmt.Errorf("connection refused"),
+			expectedCondition: &csi.VolumeCondition{Abnormal: false, Message: "Volume is healthy"},
+		},
+		{
+			name:              "filesystem remounted read-only",
+			stats:             FakeFsStats,
+			volume:            &volumes.Volume{ID: FakeVolID, Status: "in-use"},
+			mountErr:          fmt.Errorf("filesystem /dev/vdb mounted at %s was remounted read-only", volumePath),
+			expectedCondition: &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("filesystem /dev/vdb mounted at %s was remounted read-only", volumePath)},
+		},
+		{
+			name:              "block volume without filesystem",
+			stats:             FakeBlockDeviceStats,
+			volume:            &volumes.Volume{ID: FakeVolID, Status: "in-use"},
+			mountErr:          fmt.Errorf("not a filesystem"),
+			expectedCondition: &csi.VolumeCondition{Abnormal: false, Message: "Volume is healthy"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := new(mount.MountMock)
+			m.On("GetDeviceStats", volumePath).Return(test.stats, nil)
+			m.On("CheckMountHealth", volumePath).Return(test.mountErr)
+			cloud := &volumeCloudMock{OpenStackMock: new(openstack.OpenStackMock), volume: test.volume, err: test.volumeErr}
+			ns := NewNodeServer(NewDriver(FakeEndpoint, FakeCluster), m, metamock, cloud)
+
+			res, err := ns.NodeGetVolumeStats(FakeCtx, &csi.NodeGetVolumeStatsRequest{VolumeId: FakeVolID, VolumePath: volumePath})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedCondition, res.VolumeCondition)
+			if test.stats.Block {
+				m.AssertNotCalled(t, "CheckMountHealth", volumePath)
+			}
+		})
+	}
+}
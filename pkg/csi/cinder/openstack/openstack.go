@@ -23,33 +23,69 @@ import (
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/spf13/pflag"
 	gcfg "gopkg.in/gcfg.v1"
 	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/cloud-provider-openstack/pkg/util"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
+	"k8s.io/cloud-provider-openstack/pkg/util/mount"
 	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
 )
 
-// userAgentData is used to add extra information to the gophercloud user-agent
-var userAgentData []string
+var (
+	// userAgentData is used to add extra information to the gophercloud user-agent
+	userAgentData []string
+
+	// Polling of the volume attachments, the interval grows exponentially up to a tenth of the timeout
+	attachPollInterval = diskAttachInitDelay
+	attachTimeout      = diskAttachTimeout
+	detachPollInterval = diskDetachInitDelay
+	detachTimeout      = diskDetachTimeout
+
+	// How long an attach waits for the volume reserved by another attach in progress to be settled
+	attachReservedTimeout = diskReservedTimeout
+
+	// Polling of the snapshots being created, the interval grows exponentially up to a tenth of the timeout
+	snapshotReadyTimeout = snapReadyTimeout
+
+	// Polling of the backups copying snapshots across availability zones
+	backupReadyTimeout = backupCopyTimeout
+)
 
 // AddExtraFlags is called by the main package to add component specific command line flags
 func AddExtraFlags(fs *pflag.FlagSet) {
 	fs.StringArrayVar(&userAgentData, "user-agent", nil, "Extra data to add to gophercloud user-agent. Use multiple times to add more than one component.")
+	fs.DurationVar(&attachPollInterval, "attach-poll-interval", diskAttachInitDelay, "Initial interval of polling Nova for a volume to be attached. The interval grows exponentially up to a tenth of --attach-timeout.")
+	fs.DurationVar(&attachTimeout, "attach-timeout", diskAttachTimeout, "Maximum time to wait for a volume to be attached. On timeout, the attach is retried by external-attacher.")
+	fs.DurationVar(&attachReservedTimeout, "attach-reserved-timeout", diskReservedTimeout, "Maximum time to wait for a volume reserved by another attach in progress, e.g. a concurrent one, before attaching it. On timeout, the attach is retried by external-attacher. Zero disables the wait, Nova refuses the attach right away then.")
+	fs.DurationVar(&detachPollInterval, "detach-poll-interval", diskDetachInitDelay, "Initial interval of polling Nova for a volume to be detached. The interval grows exponentially up to a tenth of --detach-timeout.")
+	fs.DurationVar(&detachTimeout, "detach-timeout", diskDetachTimeout, "Maximum time to wait for a volume to be detached. On timeout, the detach is retried by external-attacher.")
+	fs.DurationVar(&snapshotReadyTimeout, "snapshot-ready-timeout", snapReadyTimeout, "Maximum time to wait for a snapshot to be ready. On timeout, external-snapshotter retries and waits for the same snapshot again.")
+	fs.DurationVar(&backupReadyTimeout, "backup-ready-timeout", backupCopyTimeout, "Maximum time to wait for the backup copying a snapshot across availability zones to be ready. On timeout, external-provisioner retries and waits for the same backup again.")
+	fs.IntVar(&apiRetries, "api-retries", 0, "Number of retries of the OpenStack API requests of the volume creations, attachments and stagings failing transiently, e.g. with a 503. The requests changing a resource are only retried if the API refused them. Zero disables the retries.")
+	fs.DurationVar(&apiRetryInterval, "api-retry-interval", apiRetryInitDelay, "Initial interval between the retries of the OpenStack API requests. The interval doubles at each retry, up to 30s.")
+	fs.DurationVar(&apiFailureTimeout, "api-failure-timeout", 0, "Maximum time the OpenStack API may keep failing transiently. Past it, the requests fail right away with a clear error instead of being attempted, a single one is let through every 30s until the API recovers. Zero disables it.")
 }
 
 type IOpenStack interface {
-	CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string) (*volumes.Volume, error)
+	CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error)
 	DeleteVolume(volumeID string) error
 	AttachVolume(instanceID, volumeID string) (string, error)
 	ListVolumes(limit int, startingToken string) ([]volumes.Volume, string, error)
 	WaitDiskAttached(instanceID string, volumeID string) error
 	DetachVolume(instanceID, volumeID string) error
+	DetachVolumeAttachment(volumeID, attachmentID string) error
+	AttachVolumeToHost(volumeID, hostName string) error
+	DetachVolumeFromHost(volumeID, hostName string) error
+	InitializeConnection(volumeID string, connector Connector) (map[string]interface{}, error)
+	TerminateConnection(volumeID string, connector Connector) error
 	WaitDiskDetached(instanceID string, volumeID string) error
 	WaitVolumeTargetStatus(volumeID string, tStatus []string) error
 	GetAttachmentDiskPath(instanceID, volumeID string) (string, error)
@@ -60,8 +96,19 @@ type IOpenStack interface {
 	DeleteSnapshot(snapID string) error
 	GetSnapshotByID(snapshotID string) (*snapshots.Snapshot, error)
 	WaitSnapshotReady(snapshotID string) error
+	CreateBackup(name, volID, snapshotID string, tags map[string]string) (*backups.Backup, error)
+	GetBackupsByName(name string) ([]backups.Backup, error)
+	DeleteBackup(backupID string) error
+	WaitBackupReady(backupID string) error
+	CreateVolumeFromBackup(name string, size int, vtype, availability, backupID string, tags map[string]string) (*volumes.Volume, error)
 	GetInstanceByID(instanceID string) (*servers.Server, error)
 	ExpandVolume(volumeID string, status string, size int) error
+	GetVolumeType(nameOrID string) (*volumetypes.VolumeType, error)
+	GetVolumeTypes() ([]volumetypes.VolumeType, error)
+	GetQoSVolumeTypes(qosNameOrID string) ([]volumetypes.VolumeType, error)
+	ChangeVolumeType(volumeID string, volumeType string, migrationPolicy string) error
+	SetVolumeReadOnly(volumeID string, readOnly bool) error
+	GetStoragePools() ([]StoragePool, error)
 	GetMaxVolLimit() int64
 	GetMetadataOpts() metadata.Opts
 	GetBlockStorageOpts() BlockStorageOpts
@@ -73,15 +120,40 @@ type OpenStack struct {
 	bsOpts       BlockStorageOpts
 	epOpts       gophercloud.EndpointOpts
 	metadataOpts metadata.Opts
+	retry        *retryPolicy
 }
 
 type BlockStorageOpts struct {
-	NodeVolumeAttachLimit    int64 `gcfg:"node-volume-attach-limit"`
-	RescanOnResize           bool  `gcfg:"rescan-on-resize"`
-	IgnoreVolumeAZ           bool  `gcfg:"ignore-volume-az"`
-	IgnoreVolumeMicroversion bool  `gcfg:"ignore-volume-microversion"`
+	NodeVolumeAttachLimit    int64  `gcfg:"node-volume-attach-limit"`
+	RescanOnResize           bool   `gcfg:"rescan-on-resize"`
+	IgnoreVolumeAZ           bool   `gcfg:"ignore-volume-az"`
+	IgnoreVolumeMicroversion bool   `gcfg:"ignore-volume-microversion"`
+	DeviceDiscovery          string `gcfg:"device-discovery"`
+	// DevicePathPrefix hints the node plugin at the kernel device names of the volumes on the node, e.g. /dev/sd.
+	DevicePathPrefix string `gcfg:"device-path-prefix"`
+	// ForceDetachGracePeriod is how long an instance has to be down before the volumes attached to it are
+	// force-detached to be attached elsewhere. Zero disables the force-detach.
+	ForceDetachGracePeriod util.MyDuration `gcfg:"force-detach-grace-period"`
+	// AttachType is how volumes are attached to the nodes, see the AttachType constants. Empty means nova.
+	AttachType string `gcfg:"attach-type"`
+	// CrossAZSnapshotCopy restores the snapshots in another availability zone than the one of their volume through a
+	// Cinder backup, instead of failing.
+	CrossAZSnapshotCopy bool `gcfg:"cross-az-snapshot-copy"`
+	// FailOnQuotaExceeded fails the creations of the volumes exceeding the quota of the project for good, instead of
+	// having them retried until the quota is raised.
+	FailOnQuotaExceeded bool `gcfg:"fail-on-quota-exceeded"`
 }
 
+const (
+	// AttachTypeNova attaches the volumes to the Nova instances of the nodes.
+	AttachTypeNova = "nova"
+	// AttachTypeLocal attaches the volumes directly on the nodes, which aren't Nova instances: the node connects to the
+	// volume over iSCSI or RBD with the connection info given by Cinder, without going through Nova.
+	AttachTypeLocal = "local"
+	// AttachTypeAuto attaches the volumes to the nodes that are Nova instances with Nova and locally on the others.
+	AttachTypeAuto = "auto"
+)
+
 type Config struct {
 	Global       client.AuthOpts
 	Metadata     metadata.Opts
@@ -126,6 +198,23 @@ func GetConfigFromFiles(configFilePaths []string) (Config, error) {
 		klog.V(5).Infof("Credentials are loaded from %s:", cfg.Global.CloudsFile)
 	}
 
+	if err := mount.ValidateDeviceDiscovery(cfg.BlockStorage.DeviceDiscovery); err != nil {
+		return cfg, fmt.Errorf("invalid device-discovery: %v", err)
+	}
+	if err := mount.ValidateDevicePathPrefix(cfg.BlockStorage.DevicePathPrefix); err != nil {
+		return cfg, fmt.Errorf("invalid device-path-prefix: %v", err)
+	}
+
+	if cfg.BlockStorage.ForceDetachGracePeriod.Duration < 0 {
+		return cfg, fmt.Errorf("force-detach-grace-period must not be negative")
+	}
+
+	switch cfg.BlockStorage.AttachType {
+	case "", AttachTypeNova, AttachTypeLocal, AttachTypeAuto:
+	default:
+		return cfg, fmt.Errorf("invalid attach-type %q, supported values are %s, %s and %s", cfg.BlockStorage.AttachType, AttachTypeNova, AttachTypeLocal, AttachTypeAuto)
+	}
+
 	return cfg, nil
 }
 
@@ -196,6 +285,7 @@ func CreateOpenStackProvider() (IOpenStack, error) {
 		bsOpts:       cfg.BlockStorage,
 		epOpts:       epOpts,
 		metadataOpts: cfg.Metadata,
+		retry:        newRetryPolicy(apiRetries, apiRetryInterval, apiFailureTimeout),
 	}
 
 	return OsInstance, nil
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack backups provides the Cinder backups used to copy the snapshots across availability zones.
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	backupReadyStatus   = "available"
+	backupErrorStatus   = "error"
+	backupReadyDuration = 2 * time.Second
+	backupReadyFactor   = 1.2
+	backupCopyTimeout   = 5 * time.Minute
+
+	backupDescription = "Created by OpenStack Cinder CSI driver to copy a snapshot across availability zones"
+)
+
+// CreateBackup backs up the snapshot of the volume, the backup can be restored in any availability zone.
+func (os *OpenStack) CreateBackup(name, volID, snapshotID string, tags map[string]string) (*backups.Backup, error) {
+	opts := backups.CreateOpts{
+		VolumeID:    volID,
+		SnapshotID:  snapshotID,
+		Name:        name,
+		Description: backupDescription,
+		Metadata:    tags,
+	}
+	mc := metrics.NewMetricContext("backup", "create")
+	backup, err := backups.Create(os.blockstorage, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// GetBackupsByName returns the backups with the name, only their ID and name are set.
+func (os *OpenStack) GetBackupsByName(name string) ([]backups.Backup, error) {
+	mc := metrics.NewMetricContext("backup", "list")
+	pages, err := backups.List(os.blockstorage, backups.ListOpts{Name: name}).AllPages()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	all, err := backups.ExtractBackups(pages)
+	if err != nil {
+		return nil, err
+	}
+	// The name filter is ignored by some microversions
+	var named []backups.Backup
+	for _, backup := range all {
+		if backup.Name == name {
+			named = append(named, backup)
+		}
+	}
+	return named, nil
+}
+
+// DeleteBackup deletes the backup.
+func (os *OpenStack) DeleteBackup(backupID string) error {
+	mc := metrics.NewMetricContext("backup", "delete")
+	err := backups.Delete(os.blockstorage, backupID).ExtractErr()
+	if mc.ObserveRequest(err) != nil {
+		klog.Errorf("Failed to delete backup: %v", err)
+	}
+	return err
+}
+
+// WaitBackupReady waits till the backup is ready, at most --backup-ready-timeout. ErrWaitTimeout is returned when the
+// backup is still being created, so that the caller can wait for the same backup again.
+func (os *OpenStack) WaitBackupReady(backupID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backupReadyTimeout)
+	defer cancel()
+
+	backoff := pollBackoff(backupReadyDuration, backupReadyFactor, backupReadyTimeout)
+
+	var status string
+	err := backoff.DelayFunc().Until(ctx, true, false, func(context.Context) (bool, error) {
+		mc := metrics.NewMetricContext("backup", "get")
+		backup, err := backups.Get(os.blockstorage, backupID).Extract()
+		if mc.ObserveRequest(err) != nil {
+			return false, err
+		}
+		status = backup.Status
+		if status == backupErrorStatus {
+			return false, fmt.Errorf("backup %q is in %s status: %s", backupID, status, backup.FailReason)
+		}
+		klog.V(4).Infof("Backup %s is %s", backupID, status)
+		return status == backupReadyStatus, nil
+	})
+
+	if wait.Interrupted(err) {
+		err = fmt.Errorf("backup %q is still %s after %v: %w", backupID, status, backupReadyTimeout, ErrWaitTimeout)
+	}
+
+	return err
+}
+
+// CreateVolumeFromBackup restores the backup to a new volume in the availability zone.
+func (os *OpenStack) CreateVolumeFromBackup(name string, size int, vtype, availability, backupID string, tags map[string]string) (*volumes.Volume, error) {
+	// Init a local thread safe copy of the Cinder ServiceClient
+	blockstorageClient, err := openstack.NewBlockStorageV3(os.blockstorage.ProviderClient, os.epOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// cinder volume creation from a backup is available since 3.47 microversion
+	// https://docs.openstack.org/cinder/latest/contributor/api_microversion_history.html#id45
+	blockstorageClient.Microversion = "3.47"
+
+	opts := &volumes.CreateOpts{
+		Name:             name,
+		Size:             size,
+		VolumeType:       vtype,
+		AvailabilityZone: availability,
+		Description:      volumeDescription,
+		BackupID:         backupID,
+		Metadata:         tags,
+	}
+	mc := metrics.NewMetricContext("volume", "create")
+	vol, err := volumes.Create(blockstorageClient, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return vol, nil
+}
@@ -7,9 +7,14 @@ import (
 
 // GetInstanceByID returns server with specified instanceID
 func (os *OpenStack) GetInstanceByID(instanceID string) (*servers.Server, error) {
-	mc := metrics.NewMetricContext("server", "get")
-	server, err := servers.Get(os.compute, instanceID).Extract()
-	if mc.ObserveRequest(err) != nil {
+	var server *servers.Server
+	err := os.withRetry("server_get", true, func() error {
+		mc := metrics.NewMetricContext("server", "get")
+		var err error
+		server, err = servers.Get(os.compute, instanceID).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return server, nil
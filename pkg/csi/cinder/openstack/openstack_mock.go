@@ -17,8 +17,10 @@ limitations under the License.
 package openstack
 
 import (
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/stretchr/testify/mock"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
@@ -50,6 +52,16 @@ type OpenStackMock struct {
 
 // revive:enable:exported
 
+// expects tells if the test set an expectation for the method, the methods without one return fixed values.
+func (_m *OpenStackMock) expects(method string) bool {
+	for _, call := range _m.ExpectedCalls {
+		if call.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
 // AttachVolume provides a mock function with given fields: instanceID, volumeID
 func (_m *OpenStackMock) AttachVolume(instanceID string, volumeID string) (string, error) {
 	ret := _m.Called(instanceID, volumeID)
@@ -71,20 +83,20 @@ func (_m *OpenStackMock) AttachVolume(instanceID string, volumeID string) (strin
 	return r0, r1
 }
 
-// CreateVolume provides a mock function with given fields: name, size, vtype, availability, tags
-func (_m *OpenStackMock) CreateVolume(name string, size int, vtype string, availability string, snapshotID string, sourceVolID string, tags *map[string]string) (*volumes.Volume, error) {
-	ret := _m.Called(name, size, vtype, availability, snapshotID, sourceVolID, tags)
+// CreateVolume provides a mock function with given fields: name, size, vtype, availability, tags, schedulerHints
+func (_m *OpenStackMock) CreateVolume(name string, size int, vtype string, availability string, snapshotID string, sourceVolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error) {
+	ret := _m.Called(name, size, vtype, availability, snapshotID, sourceVolID, tags, schedulerHints)
 
 	var r0 *volumes.Volume
-	if rf, ok := ret.Get(0).(func(string, int, string, string, string, string, *map[string]string) *volumes.Volume); ok {
-		r0 = rf(name, size, vtype, availability, snapshotID, sourceVolID, tags)
+	if rf, ok := ret.Get(0).(func(string, int, string, string, string, string, *map[string]string, map[string]interface{}) *volumes.Volume); ok {
+		r0 = rf(name, size, vtype, availability, snapshotID, sourceVolID, tags, schedulerHints)
 	} else {
 		r0 = ret.Get(0).(*volumes.Volume)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, int, string, string, string, string, *map[string]string) error); ok {
-		r1 = rf(name, size, vtype, availability, snapshotID, sourceVolID, tags)
+	if rf, ok := ret.Get(1).(func(string, int, string, string, string, string, *map[string]string, map[string]interface{}) error); ok {
+		r1 = rf(name, size, vtype, availability, snapshotID, sourceVolID, tags, schedulerHints)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -108,7 +120,19 @@ func (_m *OpenStackMock) DeleteVolume(volumeID string) error {
 
 // GetVolume provides a mock function with given fields: volumeID
 func (_m *OpenStackMock) GetVolume(volumeID string) (*volumes.Volume, error) {
-	return &fakeVol1, nil
+	if !_m.expects("GetVolume") {
+		return &fakeVol1, nil
+	}
+	ret := _m.Called(volumeID)
+
+	var r0 *volumes.Volume
+	if rf, ok := ret.Get(0).(func(string) *volumes.Volume); ok {
+		r0 = rf(volumeID)
+	} else if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*volumes.Volume)
+	}
+
+	return r0, ret.Error(1)
 }
 
 // DetachVolume provides a mock function with given fields: instanceID, volumeID
@@ -125,6 +149,53 @@ func (_m *OpenStackMock) DetachVolume(instanceID string, volumeID string) error
 	return r0
 }
 
+// AttachVolumeToHost provides a mock function with given fields: volumeID, hostName
+func (_m *OpenStackMock) AttachVolumeToHost(volumeID string, hostName string) error {
+	ret := _m.Called(volumeID, hostName)
+
+	return ret.Error(0)
+}
+
+// DetachVolumeFromHost provides a mock function with given fields: volumeID, hostName
+func (_m *OpenStackMock) DetachVolumeFromHost(volumeID string, hostName string) error {
+	ret := _m.Called(volumeID, hostName)
+
+	return ret.Error(0)
+}
+
+// InitializeConnection provides a mock function with given fields: volumeID, connector
+func (_m *OpenStackMock) InitializeConnection(volumeID string, connector Connector) (map[string]interface{}, error) {
+	ret := _m.Called(volumeID, connector)
+
+	var r0 map[string]interface{}
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(map[string]interface{})
+	}
+
+	return r0, ret.Error(1)
+}
+
+// TerminateConnection provides a mock function with given fields: volumeID, connector
+func (_m *OpenStackMock) TerminateConnection(volumeID string, connector Connector) error {
+	ret := _m.Called(volumeID, connector)
+
+	return ret.Error(0)
+}
+
+// DetachVolumeAttachment provides a mock function with given fields: volumeID, attachmentID
+func (_m *OpenStackMock) DetachVolumeAttachment(volumeID string, attachmentID string) error {
+	ret := _m.Called(volumeID, attachmentID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(volumeID, attachmentID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetAttachmentDiskPath provides a mock function with given fields: instanceID, volumeID
 func (_m *OpenStackMock) GetAttachmentDiskPath(instanceID string, volumeID string) (string, error) {
 	ret := _m.Called(instanceID, volumeID)
@@ -355,12 +426,73 @@ func (_m *OpenStackMock) WaitSnapshotReady(snapshotID string) error {
 	return r0
 }
 
+// CreateBackup provides a mock function with given fields: name, volID, snapshotID, tags
+func (_m *OpenStackMock) CreateBackup(name, volID, snapshotID string, tags map[string]string) (*backups.Backup, error) {
+	ret := _m.Called(name, volID, snapshotID, tags)
+
+	var r0 *backups.Backup
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*backups.Backup)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// GetBackupsByName provides a mock function with given fields: name
+func (_m *OpenStackMock) GetBackupsByName(name string) ([]backups.Backup, error) {
+	ret := _m.Called(name)
+
+	var r0 []backups.Backup
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]backups.Backup)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// DeleteBackup provides a mock function with given fields: backupID
+func (_m *OpenStackMock) DeleteBackup(backupID string) error {
+	ret := _m.Called(backupID)
+
+	return ret.Error(0)
+}
+
+// WaitBackupReady provides a mock function with given fields: backupID
+func (_m *OpenStackMock) WaitBackupReady(backupID string) error {
+	ret := _m.Called(backupID)
+
+	return ret.Error(0)
+}
+
+// CreateVolumeFromBackup provides a mock function with given fields: name, size, vtype, availability, backupID, tags
+func (_m *OpenStackMock) CreateVolumeFromBackup(name string, size int, vtype, availability, backupID string, tags map[string]string) (*volumes.Volume, error) {
+	ret := _m.Called(name, size, vtype, availability, backupID, tags)
+
+	var r0 *volumes.Volume
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*volumes.Volume)
+	}
+
+	return r0, ret.Error(1)
+}
+
 func (_m *OpenStackMock) GetMaxVolLimit() int64 {
 	return 256
 }
 
+// GetInstanceByID provides a mock function with given fields: instanceID
 func (_m *OpenStackMock) GetInstanceByID(instanceID string) (*servers.Server, error) {
-	return nil, nil
+	if !_m.expects("GetInstanceByID") {
+		return nil, nil
+	}
+	ret := _m.Called(instanceID)
+
+	var r0 *servers.Server
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*servers.Server)
+	}
+
+	return r0, ret.Error(1)
 }
 
 // ExpandVolume provides a mock function with given fields: instanceID, volumeID
@@ -377,6 +509,126 @@ func (_m *OpenStackMock) ExpandVolume(volumeID string, status string, size int)
 	return r0
 }
 
+// GetVolumeType provides a mock function with given fields: nameOrID
+func (_m *OpenStackMock) GetVolumeType(nameOrID string) (*volumetypes.VolumeType, error) {
+	ret := _m.Called(nameOrID)
+
+	var r0 *volumetypes.VolumeType
+	if rf, ok := ret.Get(0).(func(string) *volumetypes.VolumeType); ok {
+		r0 = rf(nameOrID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*volumetypes.VolumeType)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(nameOrID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetVolumeTypes provides a mock function with given fields:
+func (_m *OpenStackMock) GetVolumeTypes() ([]volumetypes.VolumeType, error) {
+	ret := _m.Called()
+
+	var r0 []volumetypes.VolumeType
+	if rf, ok := ret.Get(0).(func() []volumetypes.VolumeType); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volumetypes.VolumeType)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetQoSVolumeTypes provides a mock function with given fields: qosNameOrID
+func (_m *OpenStackMock) GetQoSVolumeTypes(qosNameOrID string) ([]volumetypes.VolumeType, error) {
+	ret := _m.Called(qosNameOrID)
+
+	var r0 []volumetypes.VolumeType
+	if rf, ok := ret.Get(0).(func(string) []volumetypes.VolumeType); ok {
+		r0 = rf(qosNameOrID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]volumetypes.VolumeType)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(qosNameOrID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetStoragePools provides a mock function with given fields:
+func (_m *OpenStackMock) GetStoragePools() ([]StoragePool, error) {
+	ret := _m.Called()
+
+	var r0 []StoragePool
+	if rf, ok := ret.Get(0).(func() []StoragePool); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]StoragePool)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ChangeVolumeType provides a mock function with given fields: volumeID, volumeType, migrationPolicy
+func (_m *OpenStackMock) ChangeVolumeType(volumeID string, volumeType string, migrationPolicy string) error {
+	ret := _m.Called(volumeID, volumeType, migrationPolicy)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(volumeID, volumeType, migrationPolicy)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetVolumeReadOnly provides a mock function with given fields: volumeID, readOnly
+func (_m *OpenStackMock) SetVolumeReadOnly(volumeID string, readOnly bool) error {
+	ret := _m.Called(volumeID, readOnly)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, bool) error); ok {
+		r0 = rf(volumeID, readOnly)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 func (_m *OpenStackMock) GetMetadataOpts() metadata.Opts {
 	var m metadata.Opts
 	m.SearchOrder = "configDrive"
@@ -385,5 +637,8 @@ func (_m *OpenStackMock) GetMetadataOpts() metadata.Opts {
 
 // GetBlockStorageOpts provides a mock function to return BlockStorageOpts
 func (_m *OpenStackMock) GetBlockStorageOpts() BlockStorageOpts {
-	return BlockStorageOpts{}
+	if !_m.expects("GetBlockStorageOpts") {
+		return BlockStorageOpts{}
+	}
+	return _m.Called().Get(0).(BlockStorageOpts)
 }
@@ -0,0 +1,167 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// StoragePool is a Cinder backend pool, as reported by the scheduler stats.
+type StoragePool struct {
+	// Name of the pool, in the host@backend#pool format
+	Name string
+	// VolumeBackendName is matched against the volume_backend_name extra spec of the volume types
+	VolumeBackendName string
+	// AvailabilityZone of the cinder-volume service of the pool
+	AvailabilityZone string
+	// FreeCapacityGB is the free space of the pool minus its reserved space
+	FreeCapacityGB float64
+	// Unlimited is set when the backend reports an infinite or unknown free capacity
+	Unlimited bool
+}
+
+type poolCapabilities struct {
+	VolumeBackendName  string      `json:"volume_backend_name"`
+	FreeCapacityGB     interface{} `json:"free_capacity_gb"`
+	TotalCapacityGB    interface{} `json:"total_capacity_gb"`
+	ReservedPercentage interface{} `json:"reserved_percentage"`
+}
+
+type pool struct {
+	Name         string           `json:"name"`
+	Capabilities poolCapabilities `json:"capabilities"`
+}
+
+type volumeService struct {
+	Binary string `json:"binary"`
+	Host   string `json:"host"`
+	Zone   string `json:"zone"`
+	Status string `json:"status"`
+	State  string `json:"state"`
+}
+
+// GetStoragePools returns the pools of the enabled and running cinder-volume services. Both the scheduler stats and
+// the services APIs require admin rights by default.
+func (os *OpenStack) GetStoragePools() ([]StoragePool, error) {
+	// gophercloud doesn't implement the scheduler-stats API
+	var poolsResp struct {
+		Pools []pool `json:"pools"`
+	}
+	mc := metrics.NewMetricContext("scheduler_stats", "get_pools")
+	_, err := os.blockstorage.Get(os.blockstorage.ServiceURL("scheduler-stats", "get_pools")+"?detail=true", &poolsResp, nil)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	var servicesResp struct {
+		Services []volumeService `json:"services"`
+	}
+	mc = metrics.NewMetricContext("service", "list")
+	_, err = os.blockstorage.Get(os.blockstorage.ServiceURL("os-services")+"?binary=cinder-volume", &servicesResp, nil)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	zones := make(map[string]string, len(servicesResp.Services))
+	for _, svc := range servicesResp.Services {
+		if svc.Binary == "cinder-volume" && svc.Status == "enabled" && svc.State == "up" {
+			zones[svc.Host] = svc.Zone
+		}
+	}
+
+	var pools []StoragePool
+	for _, p := range poolsResp.Pools {
+		host, _, _ := strings.Cut(p.Name, "#")
+		zone, ok := zones[host]
+		if !ok {
+			klog.V(4).Infof("Skipping pool %s, its cinder-volume service is disabled or down", p.Name)
+			continue
+		}
+
+		sp, err := newStoragePool(p, zone)
+		if err != nil {
+			klog.Warningf("Skipping pool %s: %v", p.Name, err)
+			continue
+		}
+		pools = append(pools, sp)
+	}
+
+	return pools, nil
+}
+
+// newStoragePool converts the capabilities of the pool. Like the capacity filter of the Cinder scheduler, a pool
+// reporting an infinite or unknown free capacity is considered unlimited.
+func newStoragePool(p pool, zone string) (StoragePool, error) {
+	sp := StoragePool{
+		Name:              p.Name,
+		VolumeBackendName: p.Capabilities.VolumeBackendName,
+		AvailabilityZone:  zone,
+	}
+
+	free, err := parseCapacity(p.Capabilities.FreeCapacityGB)
+	if err != nil {
+		return sp, fmt.Errorf("invalid free_capacity_gb: %v", err)
+	}
+	if free == nil {
+		sp.Unlimited = true
+		return sp, nil
+	}
+
+	// The reserved space can only be computed if the total capacity is known
+	total, err := parseCapacity(p.Capabilities.TotalCapacityGB)
+	if err != nil {
+		return sp, fmt.Errorf("invalid total_capacity_gb: %v", err)
+	}
+	reserved, err := parseCapacity(p.Capabilities.ReservedPercentage)
+	if err != nil {
+		return sp, fmt.Errorf("invalid reserved_percentage: %v", err)
+	}
+	if total != nil && reserved != nil {
+		*free -= *total * *reserved / 100
+	}
+
+	sp.FreeCapacityGB = max(*free, 0)
+
+	return sp, nil
+}
+
+// parseCapacity parses a capacity reported by a backend, either as a number or a string. It returns nil for the
+// infinite and unknown capacities, and for the missing ones.
+func parseCapacity(v interface{}) (*float64, error) {
+	switch c := v.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return &c, nil
+	case string:
+		if strings.EqualFold(c, "infinite") || strings.EqualFold(c, "unknown") {
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(c, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	default:
+		return nil, fmt.Errorf("unexpected type %T", v)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack retry provides the retries of the OpenStack API requests failing transiently, shared by the volume
+// creations, attachments and stagings.
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	apiRetryInitDelay = 1 * time.Second
+	apiRetryFactor    = 2.0
+	apiRetryMaxDelay  = 30 * time.Second
+	// While the API keeps failing, a single request is let through at this interval to tell when it recovers
+	apiProbeInterval = 30 * time.Second
+)
+
+var (
+	// Retries of the requests failing transiently, the interval grows exponentially between the attempts
+	apiRetries       = 0
+	apiRetryInterval = apiRetryInitDelay
+	// How long the API may keep failing before the requests fail right away, zero never does
+	apiFailureTimeout time.Duration
+)
+
+// ErrAPIUnavailable is returned without calling the OpenStack API once it's been failing for --api-failure-timeout.
+var ErrAPIUnavailable = errors.New("the OpenStack API keeps failing")
+
+// retryPolicy retries the requests failing transiently with exponential backoff, and fails them right away once the
+// API has kept failing for failureTimeout: a circuit breaker, so that the retries of all the volumes don't pile up on
+// an API that's down and the callers get a clear error. The breaker closes again when a request succeeds.
+type retryPolicy struct {
+	retries        int
+	interval       time.Duration
+	failureTimeout time.Duration
+	now            func() time.Time
+	sleep          func(time.Duration)
+
+	mu           sync.Mutex
+	failingSince time.Time // first transient failure since the last request answered
+	lastProbe    time.Time
+	lastErr      error
+}
+
+func newRetryPolicy(retries int, interval, failureTimeout time.Duration) *retryPolicy {
+	return &retryPolicy{
+		retries:        retries,
+		interval:       interval,
+		failureTimeout: failureTimeout,
+		now:            time.Now,
+		sleep:          time.Sleep,
+	}
+}
+
+// isTransientError tells if the request failed because the API is unavailable or overloaded, rather than because of
+// the request itself.
+func isTransientError(err error) bool {
+	var statusErr gophercloud.StatusCodeError
+	if errors.As(err, &statusErr) {
+		code := statusErr.GetStatusCode()
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRetryableError tells if the failed request can be sent again. The API refuses the requests it's too busy for
+// before processing them, the other transient failures may have happened after the change was made, so that only the
+// requests that change nothing are retried then.
+func isRetryableError(err error, idempotent bool) bool {
+	if !isTransientError(err) {
+		return false
+	}
+	if idempotent {
+		return true
+	}
+	var statusErr gophercloud.StatusCodeError
+	if errors.As(err, &statusErr) {
+		code := statusErr.GetStatusCode()
+		return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// allow returns ErrAPIUnavailable if the API has kept failing for too long, except for a probe now and then.
+func (p *retryPolicy) allow(request string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failureTimeout <= 0 || p.failingSince.IsZero() {
+		return nil
+	}
+	now := p.now()
+	failing := now.Sub(p.failingSince)
+	if failing < p.failureTimeout || now.Sub(p.lastProbe) >= apiProbeInterval {
+		p.lastProbe = now
+		return nil
+	}
+
+	metrics.ObserveCircuitBreakerRejection(request)
+	return fmt.Errorf("%w for %v, %s isn't attempted until it recovers, last error: %v", ErrAPIUnavailable, failing.Round(time.Second), request, p.lastErr)
+}
+
+// record tracks for how long the API has been failing.
+func (p *retryPolicy) record(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil || !isTransientError(err) {
+		p.failingSince = time.Time{}
+		p.lastErr = nil
+		return
+	}
+	if p.failingSince.IsZero() {
+		p.failingSince = p.now()
+	}
+	p.lastErr = err
+}
+
+// do calls fn until it succeeds, fails for good or the retries are exhausted.
+func (p *retryPolicy) do(request string, idempotent bool, fn func() error) error {
+	if err := p.allow(request); err != nil {
+		return err
+	}
+
+	delay := p.interval
+	attempts := 0
+	var err error
+	for {
+		attempts++
+		err = fn()
+		p.record(err)
+		if err == nil || !isRetryableError(err, idempotent) || attempts > p.retries {
+			break
+		}
+		klog.V(3).Infof("OpenStack API request %s failed transiently, retrying in %v: %v", request, delay, err)
+		p.sleep(delay)
+		delay = time.Duration(float64(delay) * apiRetryFactor)
+		if delay > apiRetryMaxDelay {
+			delay = apiRetryMaxDelay
+		}
+		if err := p.allow(request); err != nil {
+			return err
+		}
+	}
+
+	metrics.ObserveRequestAttempts(request, attempts, err)
+	if err != nil && attempts > 1 {
+		return fmt.Errorf("%s failed after %d attempts: %w", request, attempts, err)
+	}
+	return err
+}
+
+// withRetry calls fn according to the retry policy, it's called once if there's none.
+func (os *OpenStack) withRetry(request string, idempotent bool, fn func() error) error {
+	if os.retry == nil {
+		return fn()
+	}
+	return os.retry.do(request, idempotent, fn)
+}
@@ -19,6 +19,7 @@ limitations under the License.
 package openstack
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -33,9 +34,10 @@ import (
 
 const (
 	snapshotReadyStatus = "available"
+	snapshotErrorStatus = "error"
 	snapReadyDuration   = 1 * time.Second
 	snapReadyFactor     = 1.2
-	snapReadySteps      = 10
+	snapReadyTimeout    = 30 * time.Second
 
 	snapshotDescription = "Created by OpenStack Cinder CSI driver"
 	SnapshotForceCreate = "force-create"
@@ -156,15 +158,15 @@ func (os *OpenStack) GetSnapshotByID(snapshotID string) (*snapshots.Snapshot, er
 	return s, nil
 }
 
-// WaitSnapshotReady waits till snapshot is ready
+// WaitSnapshotReady waits till snapshot is ready, at most --snapshot-ready-timeout. ErrWaitTimeout is returned when
+// the snapshot is still being created, so that the caller can wait for the same snapshot again.
 func (os *OpenStack) WaitSnapshotReady(snapshotID string) error {
-	backoff := wait.Backoff{
-		Duration: snapReadyDuration,
-		Factor:   snapReadyFactor,
-		Steps:    snapReadySteps,
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotReadyTimeout)
+	defer cancel()
+
+	backoff := pollBackoff(snapReadyDuration, snapReadyFactor, snapshotReadyTimeout)
 
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+	err := backoff.DelayFunc().Until(ctx, true, false, func(context.Context) (bool, error) {
 		ready, err := os.snapshotIsReady(snapshotID)
 		if err != nil {
 			return false, err
@@ -173,7 +175,7 @@ func (os *OpenStack) WaitSnapshotReady(snapshotID string) error {
 	})
 
 	if wait.Interrupted(err) {
-		err = fmt.Errorf("Timeout, Snapshot  %s is still not Ready %v", snapshotID, err)
+		err = fmt.Errorf("snapshot %q is still not ready after %v: %w", snapshotID, snapshotReadyTimeout, ErrWaitTimeout)
 	}
 
 	return err
@@ -185,5 +187,8 @@ func (os *OpenStack) snapshotIsReady(snapshotID string) (bool, error) {
 		return false, err
 	}
 
+	if snap.Status == snapshotErrorStatus {
+		return false, fmt.Errorf("snapshot %q is in %s status", snapshotID, snap.Status)
+	}
 	return snap.Status == snapshotReadyStatus, nil
 }
@@ -17,13 +17,21 @@ limitations under the License.
 package openstack
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	th "github.com/gophercloud/gophercloud/testhelper"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
+
+	"k8s.io/cloud-provider-openstack/pkg/util"
 )
 
 var fakeFileName = "cloud.conf"
@@ -88,7 +96,13 @@ rescan-on-resize=true`
 	// Create an override config file
 	var fakeOverrideFileContent = `
 [BlockStorage]
-rescan-on-resize=false`
+rescan-on-resize=false
+device-discovery=nova-device
+device-path-prefix=/dev/sd
+force-detach-grace-period=10m
+attach-type=local
+cross-az-snapshot-copy=true
+fail-on-quota-exceeded=true`
 
 	f, err = os.Create(fakeOverrideFileName)
 	if err != nil {
@@ -106,6 +120,12 @@ rescan-on-resize=false`
 	// other values should be the same as before because they come from the
 	// 'base' configuration
 	expectedOpts.BlockStorage.RescanOnResize = false
+	expectedOpts.BlockStorage.DeviceDiscovery = "nova-device"
+	expectedOpts.BlockStorage.DevicePathPrefix = "/dev/sd"
+	expectedOpts.BlockStorage.ForceDetachGracePeriod = util.MyDuration{Duration: 10 * time.Minute}
+	expectedOpts.BlockStorage.AttachType = AttachTypeLocal
+	expectedOpts.BlockStorage.CrossAZSnapshotCopy = true
+	expectedOpts.BlockStorage.FailOnQuotaExceeded = true
 
 	// Invoke GetConfigFromFiles with both the base and override config files
 	actualAuthOpts, err = GetConfigFromFiles([]string{fakeFileName, fakeOverrideFileName})
@@ -115,6 +135,66 @@ rescan-on-resize=false`
 
 	// Assert
 	assert.Equal(expectedOpts, actualAuthOpts)
+
+	// An unknown device discovery strategy is rejected
+	f, err = os.Create(fakeOverrideFileName)
+	if err != nil {
+		t.Errorf("failed to create file: %v", err)
+	}
+
+	_, err = f.WriteString("[BlockStorage]\ndevice-discovery=udev")
+	f.Close()
+	if err != nil {
+		t.Errorf("failed to write file: %v", err)
+	}
+
+	_, err = GetConfigFromFiles([]string{fakeFileName, fakeOverrideFileName})
+	assert.Error(err)
+
+	// A device path prefix out of /dev is rejected
+	f, err = os.Create(fakeOverrideFileName)
+	if err != nil {
+		t.Errorf("failed to create file: %v", err)
+	}
+
+	_, err = f.WriteString("[BlockStorage]\ndevice-path-prefix=sd")
+	f.Close()
+	if err != nil {
+		t.Errorf("failed to write file: %v", err)
+	}
+
+	_, err = GetConfigFromFiles([]string{fakeFileName, fakeOverrideFileName})
+	assert.Error(err)
+
+	// A negative force-detach grace period is rejected
+	f, err = os.Create(fakeOverrideFileName)
+	if err != nil {
+		t.Errorf("failed to create file: %v", err)
+	}
+
+	_, err = f.WriteString("[BlockStorage]\nforce-detach-grace-period=-1m")
+	f.Close()
+	if err != nil {
+		t.Errorf("failed to write file: %v", err)
+	}
+
+	_, err = GetConfigFromFiles([]string{fakeFileName, fakeOverrideFileName})
+	assert.Error(err)
+
+	// An unknown attach type is rejected
+	f, err = os.Create(fakeOverrideFileName)
+	if err != nil {
+		t.Errorf("failed to create file: %v", err)
+	}
+
+	_, err = f.WriteString("[BlockStorage]\nattach-type=fc")
+	f.Close()
+	if err != nil {
+		t.Errorf("failed to write file: %v", err)
+	}
+
+	_, err = GetConfigFromFiles([]string{fakeFileName, fakeOverrideFileName})
+	assert.Error(err)
 }
 
 func TestGetConfigFromFileWithUseClouds(t *testing.T) {
@@ -207,3 +287,328 @@ func TestUserAgentFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestNewStoragePool(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities poolCapabilities
+		expected     StoragePool
+		expectErr    bool
+	}{
+		{
+			name: "reserved space",
+			capabilities: poolCapabilities{
+				VolumeBackendName:  "lvm",
+				FreeCapacityGB:     float64(100),
+				TotalCapacityGB:    float64(200),
+				ReservedPercentage: float64(10),
+			},
+			expected: StoragePool{Name: "host@lvm#lvm", VolumeBackendName: "lvm", AvailabilityZone: "nova", FreeCapacityGB: 80},
+		},
+		{
+			name: "capacities as strings",
+			capabilities: poolCapabilities{
+				VolumeBackendName: "lvm",
+				FreeCapacityGB:    "15.5",
+				TotalCapacityGB:   "unknown",
+			},
+			expected: StoragePool{Name: "host@lvm#lvm", VolumeBackendName: "lvm", AvailabilityZone: "nova", FreeCapacityGB: 15.5},
+		},
+		{
+			name: "reserved space over free space",
+			capabilities: poolCapabilities{
+				FreeCapacityGB:     float64(5),
+				TotalCapacityGB:    float64(100),
+				ReservedPercentage: float64(10),
+			},
+			expected: StoragePool{Name: "host@lvm#lvm", AvailabilityZone: "nova", FreeCapacityGB: 0},
+		},
+		{
+			name:         "infinite",
+			capabilities: poolCapabilities{VolumeBackendName: "ceph", FreeCapacityGB: "infinite"},
+			expected:     StoragePool{Name: "host@lvm#lvm", VolumeBackendName: "ceph", AvailabilityZone: "nova", Unlimited: true},
+		},
+		{
+			name:         "not reported",
+			capabilities: poolCapabilities{VolumeBackendName: "nfs"},
+			expected:     StoragePool{Name: "host@lvm#lvm", VolumeBackendName: "nfs", AvailabilityZone: "nova", Unlimited: true},
+		},
+		{
+			name:         "invalid",
+			capabilities: poolCapabilities{FreeCapacityGB: "lots"},
+			expectErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sp, err := newStoragePool(pool{Name: "host@lvm#lvm", Capabilities: test.capabilities}, "nova")
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, sp)
+		})
+	}
+}
+
+func TestSchedulerHintsCreateOpts(t *testing.T) {
+	opts := schedulerHintsCreateOpts{
+		CreateOptsBuilder: volumes.CreateOpts{Name: "volume", Size: 1},
+		SchedulerHints:    map[string]interface{}{"different_host": []string{"volume-1"}},
+	}
+	body, err := opts.ToVolumeCreateMap()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"different_host": []string{"volume-1"}}, body["OS-SCH-HNT:scheduler_hints"])
+	assert.Equal(t, map[string]interface{}{"name": "volume", "size": float64(1)}, body["volume"])
+}
+
+// failingHandler answers with the given error codes first, then with the success code and the body.
+func failingHandler(calls *int, codes []int, success int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if *calls <= len(codes) {
+			w.WriteHeader(codes[*calls-1])
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(success)
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestRetryCreateAttachFlow(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	var creates, gets, attaches int
+	th.Mux.HandleFunc("/volumes", failingHandler(&creates, []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, http.StatusAccepted,
+		`{"volume": {"id": "vol-1", "status": "creating"}}`))
+	th.Mux.HandleFunc("/volumes/vol-1", failingHandler(&gets, []int{http.StatusBadGateway}, http.StatusOK,
+		`{"volume": {"id": "vol-1", "status": "available"}}`))
+	th.Mux.HandleFunc("/servers/srv-1/os-volume_attachments", failingHandler(&attaches, []int{http.StatusServiceUnavailable}, http.StatusOK,
+		`{"volumeAttachment": {"id": "vol-1", "volumeId": "vol-1", "serverId": "srv-1"}}`))
+
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+	policy := newRetryPolicy(3, time.Second, 0)
+	var delays []time.Duration
+	policy.sleep = func(d time.Duration) { delays = append(delays, d) }
+	os := &OpenStack{compute: client, blockstorage: client, retry: policy}
+
+	vol, err := os.CreateVolume("pv-1", 1, "", "", "", "", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "vol-1", vol.ID)
+	_, err = os.AttachVolume("srv-1", vol.ID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, creates)
+	assert.Equal(t, 2, gets)
+	assert.Equal(t, 2, attaches)
+	// The backoff starts over for every request
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, time.Second, time.Second}, delays)
+}
+
+func TestRetryNotProcessedOnly(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	var creates, gets int
+	// The volume may have been created despite the error, it's not created again
+	th.Mux.HandleFunc("/volumes", failingHandler(&creates, []int{http.StatusInternalServerError}, http.StatusAccepted, `{"volume": {"id": "vol-1"}}`))
+	th.Mux.HandleFunc("/volumes/vol-1", failingHandler(&gets, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}, http.StatusOK,
+		`{"volume": {"id": "vol-1"}}`))
+	th.Mux.HandleFunc("/volumes/vol-2", func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+	policy := newRetryPolicy(2, time.Second, 0)
+	policy.sleep = func(time.Duration) {}
+	os := &OpenStack{compute: client, blockstorage: client, retry: policy}
+
+	_, err := os.CreateVolume("pv-1", 1, "", "", "", "", nil, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, creates)
+
+	_, err = os.GetVolume("vol-1")
+	assert.ErrorContains(t, err, "volume_get failed after 3 attempts")
+	assert.Equal(t, 3, gets)
+
+	// The errors of the request itself aren't retried
+	_, err = os.GetVolume("vol-2")
+	assert.Error(t, err)
+	assert.Equal(t, 4, gets)
+}
+
+func TestRetryCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	policy := newRetryPolicy(0, time.Second, 5*time.Minute)
+	policy.now = func() time.Time { return now }
+
+	calls := 0
+	unavailable := gophercloud.ErrDefault503{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}}
+	failing := func() error {
+		calls++
+		return unavailable
+	}
+
+	// The requests keep being attempted until the API has been failing for the timeout
+	assert.Error(t, policy.do("volume_get", true, failing))
+	now = now.Add(4 * time.Minute)
+	assert.Error(t, policy.do("volume_get", true, failing))
+	assert.Equal(t, 2, calls)
+
+	// A probe is let through, the next requests fail right away
+	now = now.Add(2 * time.Minute)
+	assert.Error(t, policy.do("volume_get", true, failing))
+	assert.Equal(t, 3, calls)
+	err := policy.do("volume_attach", false, failing)
+	assert.True(t, errors.Is(err, ErrAPIUnavailable))
+	assert.ErrorContains(t, err, "volume_attach isn't attempted")
+	assert.Equal(t, 3, calls)
+
+	// The next probe succeeds, closing the breaker
+	now = now.Add(apiProbeInterval)
+	assert.NoError(t, policy.do("volume_get", true, func() error { calls++; return nil }))
+	assert.NoError(t, policy.do("volume_attach", false, func() error { calls++; return nil }))
+	assert.Equal(t, 5, calls)
+}
+
+func TestAttachVolumeReserved(t *testing.T) {
+	const (
+		available  = `{"volume": {"id": "vol-1", "status": "available", "attachments": []}}`
+		reserved   = `{"volume": {"id": "vol-1", "status": "reserved", "attachments": []}}`
+		attaching  = `{"volume": {"id": "vol-1", "status": "attaching", "attachments": []}}`
+		attached1  = `{"volume": {"id": "vol-1", "status": "in-use", "attachments": [{"server_id": "srv-1"}]}}`
+		attached2  = `{"volume": {"id": "vol-1", "status": "in-use", "attachments": [{"server_id": "srv-2"}]}}`
+		attachment = `{"volumeAttachment": {"id": "vol-1", "volumeId": "vol-1", "serverId": "srv-1"}}`
+	)
+
+	tests := []struct {
+		name string
+		// Zero --attach-reserved-timeout
+		noWait bool
+		// The volume returned by the successive GETs, the last one is returned from then on
+		volumes []string
+		// Nova refuses the attaches with the given codes first
+		attachErrors []int
+		wantGets     int
+		wantAttaches int
+		wantErr      error
+	}{
+		{
+			name:         "available",
+			volumes:      []string{available},
+			wantGets:     1,
+			wantAttaches: 1,
+		},
+		{
+			name:         "reserved by an attach failing",
+			volumes:      []string{reserved, attaching, available},
+			wantGets:     3,
+			wantAttaches: 1,
+		},
+		{
+			name:     "reserved by an attach to the same instance",
+			volumes:  []string{reserved, attached1},
+			wantGets: 2,
+		},
+		{
+			name:     "reserved by an attach to another instance",
+			volumes:  []string{reserved, attached2},
+			wantGets: 2,
+			wantErr:  ErrVolumeAttachConflict,
+		},
+		{
+			name:     "attached to another instance",
+			volumes:  []string{attached2},
+			wantGets: 1,
+			wantErr:  ErrVolumeAttachConflict,
+		},
+		{
+			name:         "reserved after being checked",
+			volumes:      []string{available, reserved, available},
+			attachErrors: []int{http.StatusBadRequest},
+			wantGets:     3,
+			wantAttaches: 2,
+		},
+		{
+			name:     "still reserved",
+			volumes:  []string{reserved},
+			wantErr:  ErrWaitTimeout,
+			wantGets: -1,
+		},
+		{
+			name:         "not waited for",
+			noWait:       true,
+			volumes:      []string{reserved},
+			attachErrors: []int{http.StatusBadRequest},
+			wantGets:     1,
+			wantAttaches: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			defer func(interval, timeout time.Duration) {
+				attachPollInterval, attachReservedTimeout = interval, timeout
+			}(attachPollInterval, attachReservedTimeout)
+			attachPollInterval = time.Millisecond
+			attachReservedTimeout = 50 * time.Millisecond
+			if test.noWait {
+				attachReservedTimeout = 0
+			}
+
+			var gets, attaches int
+			th.Mux.HandleFunc("/volumes/vol-1", func(w http.ResponseWriter, r *http.Request) {
+				gets++
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprint(w, test.volumes[min(gets, len(test.volumes))-1])
+			})
+			th.Mux.HandleFunc("/servers/srv-1/os-volume_attachments", failingHandler(&attaches, test.attachErrors, http.StatusOK, attachment))
+
+			client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+			os := &OpenStack{compute: client, blockstorage: client}
+
+			_, err := os.AttachVolume("srv-1", "vol-1")
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else if test.noWait {
+				// Nova's refusal isn't mistaken for a conflict
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrVolumeAttachConflict)
+			} else {
+				assert.NoError(t, err)
+			}
+			if test.wantGets >= 0 {
+				assert.Equal(t, test.wantGets, gets)
+			}
+			assert.Equal(t, test.wantAttaches, attaches)
+		})
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	backoff := pollBackoff(time.Second, 1.2, 75*time.Second)
+	assert.Equal(t, 7500*time.Millisecond, backoff.Cap)
+	assert.Equal(t, 13, backoff.Steps)
+
+	// The interval stops growing at the cap and stays there until the timeout
+	delay := backoff.DelayFunc()
+	var last time.Duration
+	for i := 0; i < 100; i++ {
+		last = delay()
+		assert.LessOrEqual(t, last, backoff.Cap)
+	}
+	assert.Equal(t, backoff.Cap, last)
+
+	// A timeout shorter than the initial interval doesn't shrink it
+	backoff = pollBackoff(time.Second, 1.2, 5*time.Second)
+	assert.Equal(t, time.Second, backoff.Cap)
+	assert.Equal(t, 1, backoff.Steps)
+}
@@ -17,13 +17,20 @@ limitations under the License.
 package openstack
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
-	volumeexpand "github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/qos"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
 	"github.com/gophercloud/gophercloud/pagination"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -36,22 +43,85 @@ import (
 const (
 	VolumeAvailableStatus    = "available"
 	VolumeInUseStatus        = "in-use"
+	VolumeRetypingStatus     = "retyping"
+	VolumeReservedStatus     = "reserved"
+	VolumeAttachingStatus    = "attaching"
+	VolumeErrorStatus        = "error"
+	VolumeReadOnlyKey        = "readonly"
 	operationFinishInitDelay = 1 * time.Second
 	operationFinishFactor    = 1.1
 	operationFinishSteps     = 10
 	diskAttachInitDelay      = 1 * time.Second
 	diskAttachFactor         = 1.2
-	diskAttachSteps          = 15
+	diskAttachTimeout        = 75 * time.Second
+	diskReservedTimeout      = 60 * time.Second
 	diskDetachInitDelay      = 1 * time.Second
 	diskDetachFactor         = 1.2
-	diskDetachSteps          = 13
+	diskDetachTimeout        = 50 * time.Second
 	volumeDescription        = "Created by OpenStack Cinder CSI driver"
+
+	VolumeMigrationPolicyNever    = string(volumeactions.MigrationPolicyNever)
+	VolumeMigrationPolicyOnDemand = string(volumeactions.MigrationPolicyOnDemand)
 )
 
 var volumeErrorStates = [...]string{"error", "error_extending", "error_deleting"}
 
+// The polling interval of an operation is capped at this fraction of its timeout.
+const pollChecksPerTimeout = 10
+
+// pollBackoff returns the backoff of the polling of an operation lasting at most timeout. The interval grows from
+// initial by factor in a finite number of steps, up to a cap tied to the timeout, so that the operation keeps being
+// checked until the timeout expires rather than after it.
+func pollBackoff(initial time.Duration, factor float64, timeout time.Duration) wait.Backoff {
+	backoff := wait.Backoff{
+		Duration: initial,
+		Factor:   factor,
+		Cap:      timeout / pollChecksPerTimeout,
+		Steps:    1,
+	}
+	if backoff.Cap < initial {
+		backoff.Cap = initial
+	}
+	for d := float64(initial); factor > 1 && d < float64(backoff.Cap); d *= factor {
+		backoff.Steps++
+	}
+	return backoff
+}
+
+// ErrWaitTimeout is returned when a volume doesn't reach the expected attachment state in time, or a snapshot doesn't
+// get ready in time.
+var ErrWaitTimeout = errors.New("timed out waiting for the operation to complete")
+
+// ErrVolumeAttachConflict is returned when attaching a volume already attached to another instance, which only
+// multiattach volumes can be.
+var ErrVolumeAttachConflict = errors.New("volume is attached to another instance")
+
+// overLimitMessage returns the body of the 413 Cinder answers the requests exceeding a quota of the project with.
+func overLimitMessage(err error) (string, bool) {
+	var unexpected gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &unexpected) && unexpected.Actual == http.StatusRequestEntityTooLarge {
+		return string(unexpected.Body), true
+	}
+	return "", false
+}
+
+// IsVolumeSizeLimitExceeded tells if the volume is larger than the size limit of a single volume, the per_volume_gigabytes
+// quota. Retrying won't help, unlike when the quota of the project is exhausted.
+func IsVolumeSizeLimitExceeded(err error) bool {
+	msg, ok := overLimitMessage(err)
+	return ok && (strings.Contains(msg, "VolumeSizeExceedsLimit") || strings.Contains(msg, "larger than maximum allowed limit"))
+}
+
+// IsQuotaExceeded tells if the quota of the project doesn't leave room for the volume or snapshot, e.g.
+// VolumeSizeExceedsAvailableQuota or VolumeLimitExceeded. The request succeeds once the quota is raised or other volumes
+// are deleted.
+func IsQuotaExceeded(err error) bool {
+	_, ok := overLimitMessage(err)
+	return ok && !IsVolumeSizeLimitExceeded(err)
+}
+
 // CreateVolume creates a volume of given size
-func (os *OpenStack) CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string) (*volumes.Volume, error) {
+func (os *OpenStack) CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourcevolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error) {
 
 	opts := &volumes.CreateOpts{
 		Name:             name,
@@ -66,15 +136,42 @@ func (os *OpenStack) CreateVolume(name string, size int, vtype, availability str
 		opts.Metadata = *tags
 	}
 
-	mc := metrics.NewMetricContext("volume", "create")
-	vol, err := volumes.Create(os.blockstorage, opts).Extract()
-	if mc.ObserveRequest(err) != nil {
+	var createOpts volumes.CreateOptsBuilder = opts
+	if len(schedulerHints) > 0 {
+		createOpts = schedulerHintsCreateOpts{CreateOptsBuilder: opts, SchedulerHints: schedulerHints}
+	}
+
+	var vol *volumes.Volume
+	err := os.withRetry("volume_create", false, func() error {
+		mc := metrics.NewMetricContext("volume", "create")
+		var err error
+		vol, err = volumes.Create(os.blockstorage, createOpts).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return vol, nil
 }
 
+// schedulerHintsCreateOpts adds the scheduler hints to the request creating a volume, placing it relative to other
+// volumes, e.g. with different_host.
+type schedulerHintsCreateOpts struct {
+	volumes.CreateOptsBuilder
+	SchedulerHints map[string]interface{}
+}
+
+// ToVolumeCreateMap adds the scheduler hints to the body of the request.
+func (opts schedulerHintsCreateOpts) ToVolumeCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOptsBuilder.ToVolumeCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["OS-SCH-HNT:scheduler_hints"] = opts.SchedulerHints
+	return body, nil
+}
+
 // ListVolumes list all the volumes
 func (os *OpenStack) ListVolumes(limit int, startingToken string) ([]volumes.Volume, string, error) {
 	var nextPageToken string
@@ -128,9 +225,14 @@ func (os *OpenStack) GetVolumesByName(n string) ([]volumes.Volume, error) {
 	}
 
 	opts := volumes.ListOpts{Name: n}
-	mc := metrics.NewMetricContext("volume", "list")
-	pages, err := volumes.List(blockstorageClient, opts).AllPages()
-	if mc.ObserveRequest(err) != nil {
+	var pages pagination.Page
+	err = os.withRetry("volume_list", true, func() error {
+		mc := metrics.NewMetricContext("volume", "list")
+		var err error
+		pages, err = volumes.List(blockstorageClient, opts).AllPages()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -159,9 +261,14 @@ func (os *OpenStack) DeleteVolume(volumeID string) error {
 
 // GetVolume retrieves Volume by its ID.
 func (os *OpenStack) GetVolume(volumeID string) (*volumes.Volume, error) {
-	mc := metrics.NewMetricContext("volume", "get")
-	vol, err := volumes.Get(os.blockstorage, volumeID).Extract()
-	if mc.ObserveRequest(err) != nil {
+	var vol *volumes.Volume
+	err := os.withRetry("volume_get", true, func() error {
+		mc := metrics.NewMetricContext("volume", "get")
+		var err error
+		vol, err = volumes.Get(os.blockstorage, volumeID).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -177,11 +284,9 @@ func (os *OpenStack) AttachVolume(instanceID, volumeID string) (string, error) {
 		return "", err
 	}
 
-	for _, att := range volume.Attachments {
-		if instanceID == att.ServerID {
-			klog.V(4).Infof("Disk %s is already attached to instance %s", volumeID, instanceID)
-			return volume.ID, nil
-		}
+	if isVolumeAttachedTo(volume, instanceID) {
+		klog.V(4).Infof("Disk %s is already attached to instance %s", volumeID, instanceID)
+		return volume.ID, nil
 	}
 
 	if volume.Multiattach {
@@ -194,27 +299,106 @@ func (os *OpenStack) AttachVolume(instanceID, volumeID string) (string, error) {
 		computeServiceClient.Microversion = "2.60"
 	}
 
-	mc := metrics.NewMetricContext("volume", "attach")
-	_, err = volumeattach.Create(computeServiceClient, instanceID, &volumeattach.CreateOpts{
-		VolumeID: volume.ID,
-	}).Extract()
+	deadline := time.Now().Add(attachReservedTimeout)
+	for {
+		volume, err = os.waitVolumeNotReserved(volume, deadline)
+		if err != nil {
+			return "", err
+		}
+		// The attach racing with this one may have been for the same instance
+		if isVolumeAttachedTo(volume, instanceID) {
+			klog.V(4).Infof("Disk %s is already attached to instance %s", volumeID, instanceID)
+			return volume.ID, nil
+		}
+		if !volume.Multiattach && len(volume.Attachments) > 0 {
+			return "", fmt.Errorf("failed to attach %s volume to %s compute, it's attached to %s: %w", volumeID, instanceID, volume.Attachments[0].ServerID, ErrVolumeAttachConflict)
+		}
 
-	if mc.ObserveRequest(err) != nil {
+		err = os.withRetry("volume_attach", false, func() error {
+			mc := metrics.NewMetricContext("volume", "attach")
+			_, err := volumeattach.Create(computeServiceClient, instanceID, &volumeattach.CreateOpts{
+				VolumeID: volume.ID,
+			}).Extract()
+			return mc.ObserveRequest(err)
+		})
+		if err == nil {
+			return volume.ID, nil
+		}
+
+		// Nova refuses the attach if another one reserved the volume since it was checked, it's attempted again once
+		// the volume is settled.
+		if attachReservedTimeout > 0 && !volume.Multiattach && time.Now().Before(deadline) {
+			current, gerr := os.GetVolume(volumeID)
+			if gerr == nil && isVolumeReserved(current) {
+				klog.V(3).Infof("Volume %s was reserved by another attach, waiting for it to attach it to instance %s: %v", volumeID, instanceID, err)
+				volume = current
+				continue
+			}
+		}
 		return "", fmt.Errorf("failed to attach %s volume to %s compute: %v", volumeID, instanceID, err)
 	}
+}
+
+// isVolumeAttachedTo tells if the volume is attached to the instance.
+func isVolumeAttachedTo(volume *volumes.Volume, instanceID string) bool {
+	for _, att := range volume.Attachments {
+		if att.ServerID == instanceID {
+			return true
+		}
+	}
+	return false
+}
+
+// isVolumeReserved tells if another attach of the volume is in progress. Cinder lets several attachments of the
+// multiattach volumes be made at once, so that it's only the case of the other volumes.
+func isVolumeReserved(volume *volumes.Volume) bool {
+	return !volume.Multiattach && (volume.Status == VolumeReservedStatus || volume.Status == VolumeAttachingStatus)
+}
+
+// waitVolumeNotReserved waits until the attach of the volume in progress, e.g. by a concurrent ControllerPublishVolume,
+// is done, at most until the deadline given by --attach-reserved-timeout. It returns the volume then, attached or not
+// depending on the outcome of the other attach. ErrWaitTimeout is returned if the volume is still reserved, so that
+// the attach is retried later rather than failing for good. Zero --attach-reserved-timeout doesn't wait, Nova refuses
+// the attach then.
+func (os *OpenStack) waitVolumeNotReserved(volume *volumes.Volume, deadline time.Time) (*volumes.Volume, error) {
+	if attachReservedTimeout <= 0 || !isVolumeReserved(volume) {
+		return volume, nil
+	}
+	klog.V(3).Infof("Volume %s is %s by another attach, waiting for it to complete", volume.ID, volume.Status)
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	backoff := pollBackoff(attachPollInterval, diskAttachFactor, attachReservedTimeout)
+
+	current := volume
+	err := backoff.DelayFunc().Until(ctx, true, false, func(context.Context) (bool, error) {
+		var err error
+		current, err = os.GetVolume(volume.ID)
+		if err != nil {
+			return false, err
+		}
+		return !isVolumeReserved(current), nil
+	})
 
-	return volume.ID, nil
+	if wait.Interrupted(err) {
+		err = fmt.Errorf("volume %q is still %s by another attach after %v: %w", volume.ID, current.Status, attachReservedTimeout, ErrWaitTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
 }
 
 // WaitDiskAttached waits for attched
 func (os *OpenStack) WaitDiskAttached(instanceID string, volumeID string) error {
-	backoff := wait.Backoff{
-		Duration: diskAttachInitDelay,
-		Factor:   diskAttachFactor,
-		Steps:    diskAttachSteps,
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), attachTimeout)
+	defer cancel()
 
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+	backoff := pollBackoff(attachPollInterval, diskAttachFactor, attachTimeout)
+
+	mc := metrics.NewMetricContext("volume", "wait_attached")
+	err := backoff.DelayFunc().Until(ctx, true, false, func(context.Context) (bool, error) {
 		attached, err := os.diskIsAttached(instanceID, volumeID)
 		if err != nil && !cpoerrors.IsNotFound(err) {
 			// if this is a race condition indicate the volume is deleted
@@ -225,10 +409,10 @@ func (os *OpenStack) WaitDiskAttached(instanceID string, volumeID string) error
 	})
 
 	if wait.Interrupted(err) {
-		err = fmt.Errorf("Volume %q failed to be attached within the alloted time", volumeID)
+		err = fmt.Errorf("volume %q failed to be attached within %v: %w", volumeID, attachTimeout, ErrWaitTimeout)
 	}
 
-	return err
+	return mc.ObserveRequest(err)
 }
 
 // WaitVolumeTargetStatus waits for volume to be in target state
@@ -296,15 +480,137 @@ func (os *OpenStack) DetachVolume(instanceID, volumeID string) error {
 	return nil
 }
 
+// DetachVolumeAttachment marks the attachment of the volume as detached in Cinder. It's meant for the attachments to
+// deleted instances, which Nova can't detach the volume from anymore.
+func (os *OpenStack) DetachVolumeAttachment(volumeID, attachmentID string) error {
+	mc := metrics.NewMetricContext("volume", "detach_attachment")
+	err := volumeactions.Detach(os.blockstorage, volumeID, volumeactions.DetachOpts{AttachmentID: attachmentID}).ExtractErr()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to detach attachment %s of volume %s: %v", attachmentID, volumeID, err)
+	}
+	klog.V(2).Infof("Successfully detached attachment %s of volume %s", attachmentID, volumeID)
+	return nil
+}
+
+// Connector describes a host that connects to the volumes on its own rather than through Nova, see AttachTypeLocal.
+// Cinder exports the volumes to the host based on it.
+type Connector struct {
+	Host      string
+	IP        string
+	Initiator string
+}
+
+// AttachVolumeToHost marks the volume as attached to the host, which isn't a Nova instance. The host connects to the
+// volume with the connection info returned by InitializeConnection.
+func (os *OpenStack) AttachVolumeToHost(volumeID, hostName string) error {
+	volume, err := os.GetVolume(volumeID)
+	if err != nil {
+		return err
+	}
+
+	for _, att := range volume.Attachments {
+		if att.ServerID == "" && att.HostName == hostName {
+			klog.V(4).Infof("Volume %s is already attached to host %s", volumeID, hostName)
+			return nil
+		}
+	}
+
+	// Cinder refuses a read-write attachment of a read-only volume
+	mode := volumeactions.ReadWrite
+	if strings.EqualFold(volume.Metadata[VolumeReadOnlyKey], "true") {
+		mode = volumeactions.ReadOnly
+	}
+
+	mc := metrics.NewMetricContext("volume", "reserve")
+	err = volumeactions.Reserve(os.blockstorage, volumeID).ExtractErr()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to reserve volume %s for host %s: %v", volumeID, hostName, err)
+	}
+
+	mc = metrics.NewMetricContext("volume", "attach_host")
+	err = volumeactions.Attach(os.blockstorage, volumeID, volumeactions.AttachOpts{
+		HostName: hostName,
+		Mode:     mode,
+	}).ExtractErr()
+	if mc.ObserveRequest(err) != nil {
+		// The volume would be stuck in the attaching state otherwise
+		if uerr := volumeactions.Unreserve(os.blockstorage, volumeID).ExtractErr(); uerr != nil {
+			klog.Warningf("Failed to unreserve volume %s: %v", volumeID, uerr)
+		}
+		return fmt.Errorf("failed to attach volume %s to host %s: %v", volumeID, hostName, err)
+	}
+
+	klog.V(2).Infof("Successfully attached volume %s to host %s", volumeID, hostName)
+	return nil
+}
+
+// DetachVolumeFromHost marks the volume as detached from the host it was attached to with AttachVolumeToHost.
+func (os *OpenStack) DetachVolumeFromHost(volumeID, hostName string) error {
+	volume, err := os.GetVolume(volumeID)
+	if err != nil {
+		return err
+	}
+
+	for _, att := range volume.Attachments {
+		if att.ServerID == "" && att.HostName == hostName {
+			mc := metrics.NewMetricContext("volume", "detach_host")
+			err = volumeactions.Detach(os.blockstorage, volumeID, volumeactions.DetachOpts{AttachmentID: att.AttachmentID}).ExtractErr()
+			if mc.ObserveRequest(err) != nil {
+				return fmt.Errorf("failed to detach volume %s from host %s: %v", volumeID, hostName, err)
+			}
+			klog.V(2).Infof("Successfully detached volume %s from host %s", volumeID, hostName)
+			return nil
+		}
+	}
+
+	// Volume isn't attached to the host
+	return nil
+}
+
+// InitializeConnection exports the volume to the host described by the connector and returns the connection info,
+// i.e. the driver_volume_type, e.g. iscsi or rbd, and the data the host needs to connect to the volume.
+func (os *OpenStack) InitializeConnection(volumeID string, connector Connector) (map[string]interface{}, error) {
+	// Initializing the connection of the same host again returns the same connection info
+	var info map[string]interface{}
+	err := os.withRetry("volume_initialize_connection", true, func() error {
+		mc := metrics.NewMetricContext("volume", "initialize_connection")
+		var err error
+		info, err = volumeactions.InitializeConnection(os.blockstorage, volumeID, volumeactions.InitializeConnectionOpts{
+			Host:      connector.Host,
+			IP:        connector.IP,
+			Initiator: connector.Initiator,
+		}).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the connection of volume %s to host %s: %v", volumeID, connector.Host, err)
+	}
+	return info, nil
+}
+
+// TerminateConnection revokes the export of the volume to the host described by the connector.
+func (os *OpenStack) TerminateConnection(volumeID string, connector Connector) error {
+	mc := metrics.NewMetricContext("volume", "terminate_connection")
+	err := volumeactions.TerminateConnection(os.blockstorage, volumeID, volumeactions.TerminateConnectionOpts{
+		Host:      connector.Host,
+		IP:        connector.IP,
+		Initiator: connector.Initiator,
+	}).ExtractErr()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to terminate the connection of volume %s to host %s: %v", volumeID, connector.Host, err)
+	}
+	return nil
+}
+
 // WaitDiskDetached waits for detached
 func (os *OpenStack) WaitDiskDetached(instanceID string, volumeID string) error {
-	backoff := wait.Backoff{
-		Duration: diskDetachInitDelay,
-		Factor:   diskDetachFactor,
-		Steps:    diskDetachSteps,
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), detachTimeout)
+	defer cancel()
+
+	backoff := pollBackoff(detachPollInterval, diskDetachFactor, detachTimeout)
 
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+	mc := metrics.NewMetricContext("volume", "wait_detached")
+	err := backoff.DelayFunc().Until(ctx, true, false, func(context.Context) (bool, error) {
 		attached, err := os.diskIsAttached(instanceID, volumeID)
 		if err != nil {
 			return false, err
@@ -313,10 +619,10 @@ func (os *OpenStack) WaitDiskDetached(instanceID string, volumeID string) error
 	})
 
 	if wait.Interrupted(err) {
-		err = fmt.Errorf("Volume %q failed to detach within the alloted time", volumeID)
+		err = fmt.Errorf("volume %q failed to detach within %v: %w", volumeID, detachTimeout, ErrWaitTimeout)
 	}
 
-	return err
+	return mc.ObserveRequest(err)
 }
 
 // GetAttachmentDiskPath gets device path of attached volume to the compute
@@ -342,7 +648,7 @@ func (os *OpenStack) GetAttachmentDiskPath(instanceID, volumeID string) (string,
 
 // ExpandVolume expands the volume to new size
 func (os *OpenStack) ExpandVolume(volumeID string, status string, newSize int) error {
-	extendOpts := volumeexpand.ExtendSizeOpts{
+	extendOpts := volumeactions.ExtendSizeOpts{
 		NewSize: newSize,
 	}
 
@@ -365,16 +671,118 @@ func (os *OpenStack) ExpandVolume(volumeID string, status string, newSize int) e
 		blockstorageClient.Microversion = "3.42"
 
 		mc := metrics.NewMetricContext("volume", "expand")
-		return mc.ObserveRequest(volumeexpand.ExtendSize(blockstorageClient, volumeID, extendOpts).ExtractErr())
+		return mc.ObserveRequest(volumeactions.ExtendSize(blockstorageClient, volumeID, extendOpts).ExtractErr())
 	case VolumeAvailableStatus:
 		mc := metrics.NewMetricContext("volume", "expand")
-		return mc.ObserveRequest(volumeexpand.ExtendSize(os.blockstorage, volumeID, extendOpts).ExtractErr())
+		return mc.ObserveRequest(volumeactions.ExtendSize(os.blockstorage, volumeID, extendOpts).ExtractErr())
 	}
 
 	// cinder volume can not be expanded when volume status is not volumeInUseStatus or not volumeAvailableStatus
 	return fmt.Errorf("volume cannot be resized, when status is %s", status)
 }
 
+// GetVolumeType retrieves a volume type by its name or ID.
+func (os *OpenStack) GetVolumeType(nameOrID string) (*volumetypes.VolumeType, error) {
+	vtypes, err := os.GetVolumeTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range vtypes {
+		if vtypes[i].ID == nameOrID || vtypes[i].Name == nameOrID {
+			return &vtypes[i], nil
+		}
+	}
+
+	return nil, cpoerrors.ErrNotFound
+}
+
+// GetVolumeTypes returns all the volume types. Their extra specs are only returned if the policy of Cinder allows it,
+// by default to the admins.
+func (os *OpenStack) GetVolumeTypes() ([]volumetypes.VolumeType, error) {
+	mc := metrics.NewMetricContext("volume_type", "list")
+	allPages, err := volumetypes.List(os.blockstorage, volumetypes.ListOpts{}).AllPages()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return volumetypes.ExtractVolumeTypes(allPages)
+}
+
+// GetQoSVolumeTypes returns the volume types associated with the QoS specs of the given name or ID.
+func (os *OpenStack) GetQoSVolumeTypes(qosNameOrID string) ([]volumetypes.VolumeType, error) {
+	mc := metrics.NewMetricContext("qos", "list")
+	allPages, err := qos.List(os.blockstorage, qos.ListOpts{}).AllPages()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	specs, err := qos.ExtractQoS(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	var qosID string
+	for _, spec := range specs {
+		if spec.ID == qosNameOrID || spec.Name == qosNameOrID {
+			qosID = spec.ID
+			break
+		}
+	}
+	if qosID == "" {
+		return nil, cpoerrors.ErrNotFound
+	}
+
+	mc = metrics.NewMetricContext("qos_association", "list")
+	allPages, err = qos.ListAssociations(os.blockstorage, qosID).AllPages()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	associations, err := qos.ExtractAssociations(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	var vtypes []volumetypes.VolumeType
+	for _, a := range associations {
+		if a.AssociationType == "volume_type" {
+			vtypes = append(vtypes, volumetypes.VolumeType{ID: a.ID, Name: a.Name})
+		}
+	}
+
+	return vtypes, nil
+}
+
+// ChangeVolumeType retypes the volume to the given volume type. The migration policy decides whether Cinder is allowed
+// to migrate the volume to another backend if the new type requires it.
+func (os *OpenStack) ChangeVolumeType(volumeID string, volumeType string, migrationPolicy string) error {
+	opts := volumeactions.ChangeTypeOpts{
+		NewType:         volumeType,
+		MigrationPolicy: volumeactions.MigrationPolicy(migrationPolicy),
+	}
+
+	mc := metrics.NewMetricContext("volume", "retype")
+	return mc.ObserveRequest(volumeactions.ChangeType(os.blockstorage, volumeID, opts).ExtractErr())
+}
+
+// SetVolumeReadOnly sets the readonly flag of the volume, which makes Nova attach it read-only. The flag can only be
+// changed while the volume is available.
+func (os *OpenStack) SetVolumeReadOnly(volumeID string, readOnly bool) error {
+	// gophercloud doesn't implement the os-update_readonly_flag action
+	body := map[string]interface{}{
+		"os-update_readonly_flag": map[string]interface{}{
+			"readonly": readOnly,
+		},
+	}
+
+	mc := metrics.NewMetricContext("volume", "update_readonly_flag")
+	_, err := os.blockstorage.Post(os.blockstorage.ServiceURL("volumes", volumeID, "action"), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	return mc.ObserveRequest(err)
+}
+
 // GetMaxVolLimit returns max vol limit
 func (os *OpenStack) GetMaxVolLimit() int64 {
 	if os.bsOpts.NodeVolumeAttachLimit > 0 && os.bsOpts.NodeVolumeAttachLimit <= 256 {
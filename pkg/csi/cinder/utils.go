@@ -2,6 +2,8 @@ package cinder
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync/atomic"
 
@@ -9,6 +11,8 @@ import (
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/util/mount"
@@ -99,3 +103,158 @@ func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h
 
 	return resp, err
 }
+
+// xfsSubOptionsRegexp matches the comma-separated suboptions taken by the mkfs.xfs options, e.g. "size=512,maxpct=5".
+var xfsSubOptionsRegexp = regexp.MustCompile(`^[a-z_]+=[a-zA-Z0-9_]+(,[a-z_]+=[a-zA-Z0-9_]+)*$`)
+
+// ext4ExtendedOptionsRegexp matches the comma-separated extended options of mke2fs, e.g. "lazy_itable_init=0,discard".
+var ext4ExtendedOptionsRegexp = regexp.MustCompile(`^[a-z_]+(=[a-zA-Z0-9_]+)?(,[a-z_]+(=[a-zA-Z0-9_]+)?)*$`)
+
+func validateIntMkfsOption(min, max int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("expected an integer between %d and %d", min, max)
+		}
+		return nil
+	}
+}
+
+func validateRegexpMkfsOption(re *regexp.Regexp) func(string) error {
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return fmt.Errorf("expected comma-separated suboptions")
+		}
+		return nil
+	}
+}
+
+var extMkfsOptions = map[string]func(string) error{
+	// mount-utils formats ext3 and ext4 with -m0 anyway, overriding any other value
+	"-m": validateIntMkfsOption(0, 0),
+	"-i": validateIntMkfsOption(1024, 67108864),
+	"-I": validateIntMkfsOption(128, 65536),
+	"-N": validateIntMkfsOption(1, 1<<32-1),
+	"-b": validateIntMkfsOption(1024, 65536),
+	"-E": validateRegexpMkfsOption(ext4ExtendedOptionsRegexp),
+}
+
+var xfsMkfsOptions = map[string]func(string) error{
+	"-b": validateRegexpMkfsOption(xfsSubOptionsRegexp),
+	"-d": validateRegexpMkfsOption(xfsSubOptionsRegexp),
+	"-i": validateRegexpMkfsOption(xfsSubOptionsRegexp),
+	"-l": validateRegexpMkfsOption(xfsSubOptionsRegexp),
+	"-m": validateRegexpMkfsOption(xfsSubOptionsRegexp),
+	"-n": validateRegexpMkfsOption(xfsSubOptionsRegexp),
+}
+
+// mkfsOptions are the mkfs options allowed per filesystem type. All of them take a value.
+var mkfsOptions = map[string]map[string]func(string) error{
+	"ext3": extMkfsOptions,
+	"ext4": extMkfsOptions,
+	"xfs":  xfsMkfsOptions,
+}
+
+// parseMkfsOptions splits the mkfsOptions parameter into the arguments of mkfs, rejecting the options that are unknown
+// or not valid for the filesystem type.
+func parseMkfsOptions(fsType string, options string) ([]string, error) {
+	allowed, ok := mkfsOptions[fsType]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is not supported for filesystem %s", mkfsOptionsKey, fsType)
+	}
+
+	args := strings.Fields(options)
+	for i := 0; i < len(args); i += 2 {
+		validate, ok := allowed[args[i]]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: option %s is not supported for filesystem %s", mkfsOptionsKey, args[i], fsType)
+		}
+		if i+1 == len(args) {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: option %s requires a value", mkfsOptionsKey, args[i])
+		}
+		if err := validate(args[i+1]); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: invalid value %q of option %s: %v", mkfsOptionsKey, args[i+1], args[i], err)
+		}
+	}
+	return args, nil
+}
+
+// splitVolumeIDs parses a comma separated list of volume IDs.
+func splitVolumeIDs(value string) (interface{}, error) {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			return nil, fmt.Errorf("empty volume ID")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// schedulerHints are the Cinder scheduler hints allowed in the StorageClass parameters, with the parser of their value.
+var schedulerHints = map[string]func(string) (interface{}, error){
+	"same_host":      splitVolumeIDs,
+	"different_host": splitVolumeIDs,
+	"local_to_instance": func(value string) (interface{}, error) {
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("empty instance ID")
+		}
+		return strings.TrimSpace(value), nil
+	},
+}
+
+// parseSchedulerHints returns the Cinder scheduler hints of the schedulerHint.<hint> parameters, rejecting the hints
+// that aren't allowed. It returns nil without any hint.
+func parseSchedulerHints(parameters map[string]string) (map[string]interface{}, error) {
+	var hints map[string]interface{}
+	for key, value := range parameters {
+		hint, ok := strings.CutPrefix(key, schedulerHintKeyPrefix)
+		if !ok {
+			continue
+		}
+		parse, ok := schedulerHints[hint]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "scheduler hint %q is not supported", hint)
+		}
+		parsed, err := parse(value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid value %q of scheduler hint %s: %v", value, hint, err)
+		}
+		if hints == nil {
+			hints = make(map[string]interface{})
+		}
+		hints[hint] = parsed
+	}
+	return hints, nil
+}
+
+// getFallbackAvailabilities returns the availability zones of the fallbackAvailabilities parameter the volume is
+// created in, in order, when the primary one can't provision it. The zones the nodes of the accessibility requirement
+// can't attach the volume from are skipped, unless the volumes are attached across zones with ignore-volume-az.
+func getFallbackAvailabilities(parameters map[string]string, primary string, requirement *csi.TopologyRequirement, ignoreVolumeAZ bool) []string {
+	requisite := make(map[string]bool)
+	if !ignoreVolumeAZ {
+		for _, topology := range requirement.GetRequisite() {
+			if zone, ok := topology.GetSegments()[topologyKey]; ok {
+				requisite[zone] = true
+			}
+		}
+	}
+
+	seen := map[string]bool{primary: true}
+	var zones []string
+	for _, zone := range strings.Split(parameters[fallbackAvailabilitiesKey], ",") {
+		zone = strings.TrimSpace(zone)
+		if zone == "" || seen[zone] {
+			continue
+		}
+		seen[zone] = true
+		if len(requisite) > 0 && !requisite[zone] {
+			klog.V(4).Infof("Skipping fallback Availability Zone %s, not accessible from the requisite topology", zone)
+			continue
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
@@ -117,7 +117,6 @@ func TestLogGRPC(t *testing.T) {
 					"account_name": "k8s",
 					"account_key":  "testkey",
 				},
-				XXX_sizecache: 100,
 			},
 			`GRPC request: {"secrets":"***stripped***","volume_id":"vol_1"}`,
 		},
@@ -146,3 +145,183 @@ func TestLogGRPC(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMkfsOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		fsType    string
+		options   string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "ext4 options",
+			fsType:   "ext4",
+			options:  "-m 0 -i 65536  -E lazy_itable_init=0,discard",
+			expected: []string{"-m", "0", "-i", "65536", "-E", "lazy_itable_init=0,discard"},
+		},
+		{
+			name:     "xfs options",
+			fsType:   "xfs",
+			options:  "-i size=512 -m crc=1,reflink=0",
+			expected: []string{"-i", "size=512", "-m", "crc=1,reflink=0"},
+		},
+		{
+			name:      "unsupported filesystem",
+			fsType:    "btrfs",
+			options:   "-m 0",
+			expectErr: true,
+		},
+		{
+			name:      "unknown option",
+			fsType:    "ext4",
+			options:   "-F",
+			expectErr: true,
+		},
+		{
+			name:      "ext4 option for xfs",
+			fsType:    "xfs",
+			options:   "-N 1000",
+			expectErr: true,
+		},
+		{
+			name:      "reserved blocks",
+			fsType:    "ext4",
+			options:   "-m 5",
+			expectErr: true,
+		},
+		{
+			name:      "invalid inode ratio",
+			fsType:    "ext4",
+			options:   "-i 16k",
+			expectErr: true,
+		},
+		{
+			name:      "missing value",
+			fsType:    "ext4",
+			options:   "-i 16384 -m",
+			expectErr: true,
+		},
+		{
+			name:      "option injection",
+			fsType:    "xfs",
+			options:   "-i size=512;reboot",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := parseMkfsOptions(test.fsType, test.options)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, args)
+		})
+	}
+}
+
+func TestParseSchedulerHints(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		expected   map[string]interface{}
+		expectErr  bool
+	}{
+		{
+			name:       "no hints",
+			parameters: map[string]string{"type": "ssd"},
+		},
+		{
+			name: "allowed hints",
+			parameters: map[string]string{
+				"type":                         "ssd",
+				"schedulerHint.same_host":      "volume-1",
+				"schedulerHint.different_host": "volume-2,volume-3",
+			},
+			expected: map[string]interface{}{
+				"same_host":      []string{"volume-1"},
+				"different_host": []string{"volume-2", "volume-3"},
+			},
+		},
+		{
+			name:       "hint not allowed",
+			parameters: map[string]string{"schedulerHint.query": "[]"},
+			expectErr:  true,
+		},
+		{
+			name:       "empty volume ID",
+			parameters: map[string]string{"schedulerHint.different_host": "volume-1,"},
+			expectErr:  true,
+		},
+		{
+			name:       "empty instance ID",
+			parameters: map[string]string{"schedulerHint.local_to_instance": " "},
+			expectErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hints, err := parseSchedulerHints(test.parameters)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, hints)
+		})
+	}
+}
+
+func TestGetFallbackAvailabilities(t *testing.T) {
+	requirement := &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{
+			{Segments: map[string]string{topologyKey: "az-1"}},
+			{Segments: map[string]string{topologyKey: "az-3"}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		parameters     map[string]string
+		requirement    *csi.TopologyRequirement
+		ignoreVolumeAZ bool
+		expected       []string
+	}{
+		{
+			name: "no fallback",
+		},
+		{
+			name:       "ordered fallbacks",
+			parameters: map[string]string{fallbackAvailabilitiesKey: "az-3, az-2,,az-4"},
+			expected:   []string{"az-3", "az-2", "az-4"},
+		},
+		{
+			name:       "primary and duplicates dropped",
+			parameters: map[string]string{fallbackAvailabilitiesKey: "az-2,az-1,az-2"},
+			expected:   []string{"az-2"},
+		},
+		{
+			name:        "zones outside of the requisite topology dropped",
+			parameters:  map[string]string{fallbackAvailabilitiesKey: "az-2,az-3"},
+			requirement: requirement,
+			expected:    []string{"az-3"},
+		},
+		{
+			name:           "zones outside of the requisite topology kept with ignore-volume-az",
+			parameters:     map[string]string{fallbackAvailabilitiesKey: "az-2,az-3"},
+			requirement:    requirement,
+			ignoreVolumeAZ: true,
+			expected:       []string{"az-2", "az-3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, getFallbackAvailabilities(test.parameters, "az-1", test.requirement, test.ignoreVolumeAZ))
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -34,10 +35,18 @@ import (
 	"k8s.io/klog/v2"
 )
 
-const clusterMetadataKey = "manila.csi.openstack.org/cluster"
+const (
+	clusterMetadataKey = "manila.csi.openstack.org/cluster"
+
+	// The shares created with the retainShare parameter are kept on DeleteVolume, only the access rule granted to
+	// the cluster, recorded in their metadata, is revoked.
+	retainShareMetadataKey = "manila.csi.openstack.org/retain-share"
+	accessIDMetadataKey    = "manila.csi.openstack.org/access-id"
+)
 
 type controllerServer struct {
 	d *Driver
+	csi.UnimplementedControllerServer
 }
 
 var (
@@ -94,7 +103,7 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		params = make(map[string]string)
 	}
 
-	params["protocol"] = cs.d.shareProto
+	params["protocol"] = cs.d.selectShareProto(params["protocol"], req.GetName())
 
 	shareOpts, err := options.NewControllerVolumeContext(params)
 	if err != nil {
@@ -105,6 +114,10 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	if err != nil {
 		return nil, err
 	}
+	retainShare := strings.EqualFold(shareOpts.RetainShare, "true")
+	if retainShare {
+		shareMetadata[retainShareMetadataKey] = "true"
+	}
 
 	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
 	if err != nil {
@@ -153,8 +166,18 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, err
 	}
 
+	if err := checkShareTypeProtocol(manilaClient, shareOpts.Type, shareOpts.Protocol); err != nil {
+		klog.Warningf("%v, creating volume %s anyway", err, req.GetName())
+	}
+
+	if err := cs.d.resolveShareNetwork(manilaClient, osOpts, shareOpts); err != nil {
+		return nil, err
+	}
+
 	share, err := volCreator.create(manilaClient, req, req.GetName(), sizeInGiB, shareOpts, shareMetadata)
 	if err != nil {
+		// The cached share network might be gone, look it up again next time.
+		cs.d.forgetShareNetwork(osOpts, shareOpts)
 		return nil, err
 	}
 
@@ -176,6 +199,12 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Errorf(codes.Internal, "failed to grant access to volume %s: %v", share.Name, err)
 	}
 
+	if retainShare && share.Metadata[accessIDMetadataKey] != accessRight.ID {
+		if _, err := manilaClient.SetShareMetadata(share.ID, shares.SetMetadataOpts{Metadata: map[string]string{accessIDMetadataKey: accessRight.ID}}); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to record access rule %s of volume %s: %v", accessRight.ID, share.Name, err)
+		}
+	}
+
 	volCtx := filterParametersForVolumeContext(params, options.NodeVolumeContextFields())
 	volCtx["shareID"] = share.ID
 	volCtx["shareAccessID"] = accessRight.ID
@@ -206,6 +235,23 @@ func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
 	}
 
+	share, err := manilaClient.GetShareByID(req.GetVolumeId())
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			klog.V(4).Infof("volume with share ID %s not found, assuming it to be already deleted", req.GetVolumeId())
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get volume %s: %v", req.GetVolumeId(), err)
+	}
+
+	if share.Metadata[retainShareMetadataKey] == "true" {
+		if err := revokeShareAccess(manilaClient, share); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to revoke access to retained volume %s: %v", req.GetVolumeId(), err)
+		}
+		klog.Infof("volume %s is retained, its access rule %s was revoked", req.GetVolumeId(), share.Metadata[accessIDMetadataKey])
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
 	if err := deleteShare(manilaClient, req.GetVolumeId()); err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to delete volume %s: %v", req.GetVolumeId(), err)
 	}
@@ -247,9 +293,9 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 		return nil, status.Errorf(codes.Internal, "failed to retrieve source volume %s when creating snapshot %s: %v", req.GetSourceVolumeId(), req.GetName(), err)
 	}
 
-	if strings.ToUpper(sourceShare.ShareProto) != cs.d.shareProto {
+	if !cs.d.servesShareProto(sourceShare.ShareProto) {
 		return nil, status.Errorf(codes.InvalidArgument, "share protocol mismatch: requested snapshot of %s volume %s, but share protocol selector is set to %s",
-			sourceShare.ShareProto, req.GetSourceVolumeId(), cs.d.shareProto)
+			sourceShare.ShareProto, req.GetSourceVolumeId(), strings.Join(cs.d.servedShareProtos(), ", "))
 	}
 
 	// In order to satisfy CSI spec requirements around CREATE_DELETE_SNAPSHOT
@@ -397,8 +443,8 @@ func (cs *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Errorf(codes.FailedPrecondition, "volume %s is in an unexpected state: wanted %s, got %s", req.GetVolumeId(), shareAvailable, share.Status)
 	}
 
-	if !compareProtocol(share.ShareProto, cs.d.shareProto) {
-		return nil, status.Errorf(codes.InvalidArgument, "share protocol mismatch: wanted %s, got %s", cs.d.shareProto, share.ShareProto)
+	if !cs.d.servesShareProto(share.ShareProto) {
+		return nil, status.Errorf(codes.InvalidArgument, "share protocol mismatch: wanted %s, got %s", strings.Join(cs.d.servedShareProtos(), ", "), share.ShareProto)
 	}
 
 	return &csi.ValidateVolumeCapabilitiesResponse{
@@ -418,6 +464,10 @@ func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
+func (cs *controllerServer) ControllerModifyVolume(context.Context, *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
 func (cs *controllerServer) ListVolumes(context.Context, *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
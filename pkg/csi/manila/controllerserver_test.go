@@ -14,8 +14,16 @@ limitations under the License.
 package manila
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
+	"k8s.io/cloud-provider-openstack/pkg/client"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
 )
 
 func TestPrepareShareMetadata(t *testing.T) {
@@ -121,3 +129,93 @@ func TestPrepareShareMetadata(t *testing.T) {
 		}
 	}
 }
+
+// fakeRetainClient implements the calls needed to delete or retain shares, the others panic.
+type fakeRetainClient struct {
+	manilaclient.Interface
+
+	shares  map[string]*shares.Share
+	rights  []shares.AccessRight
+	revoked []string
+	deleted []string
+}
+
+func (c *fakeRetainClient) New(*client.AuthOpts) (manilaclient.Interface, error) {
+	return c, nil
+}
+
+func (c *fakeRetainClient) GetShareByID(shareID string) (*shares.Share, error) {
+	share, ok := c.shares[shareID]
+	if !ok {
+		return nil, gophercloud.ErrResourceNotFound{}
+	}
+	return share, nil
+}
+
+func (c *fakeRetainClient) DeleteShare(shareID string) error {
+	c.deleted = append(c.deleted, shareID)
+	return nil
+}
+
+func (c *fakeRetainClient) GetAccessRights(shareID string) ([]shares.AccessRight, error) {
+	return c.rights, nil
+}
+
+func (c *fakeRetainClient) RevokeAccess(shareID string, opts shares.RevokeAccessOptsBuilder) error {
+	c.revoked = append(c.revoked, opts.(shares.RevokeAccessOpts).AccessID)
+	return nil
+}
+
+func TestDeleteVolumeRetainShare(t *testing.T) {
+	ts := []struct {
+		name            string
+		metadata        map[string]string
+		rights          []shares.AccessRight
+		expectedRevoked []string
+		expectedDeleted []string
+	}{
+		{
+			name:            "share deleted",
+			metadata:        map[string]string{accessIDMetadataKey: "access-id"},
+			rights:          []shares.AccessRight{{ID: "access-id"}},
+			expectedDeleted: []string{"share-id"},
+		},
+		{
+			name:            "share retained and access revoked",
+			metadata:        map[string]string{retainShareMetadataKey: "true", accessIDMetadataKey: "access-id"},
+			rights:          []shares.AccessRight{{ID: "other-access-id"}, {ID: "access-id"}},
+			expectedRevoked: []string{"access-id"},
+		},
+		{
+			name:     "share retained and access already revoked",
+			metadata: map[string]string{retainShareMetadataKey: "true", accessIDMetadataKey: "access-id"},
+			rights:   []shares.AccessRight{{ID: "other-access-id"}},
+		},
+	}
+
+	secrets := map[string]string{"os-authURL": "https://keystone.example.com", "os-region": "RegionOne", "os-trustID": "trust-id"}
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			manilaClient := &fakeRetainClient{
+				shares: map[string]*shares.Share{"share-id": {ID: "share-id", Metadata: tt.metadata}},
+				rights: tt.rights,
+			}
+			cs := &controllerServer{d: &Driver{manilaClientBuilder: manilaClient}}
+
+			if _, err := cs.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "share-id", Secrets: secrets}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(manilaClient.revoked, tt.expectedRevoked) {
+				t.Errorf("revoked access rules %v, expected %v", manilaClient.revoked, tt.expectedRevoked)
+			}
+			if !reflect.DeepEqual(manilaClient.deleted, tt.expectedDeleted) {
+				t.Errorf("deleted shares %v, expected %v", manilaClient.deleted, tt.expectedDeleted)
+			}
+
+			// The share is gone already.
+			if _, err := cs.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "missing-id", Secrets: secrets}); err != nil {
+				t.Errorf("unexpected error deleting a missing volume: %v", err)
+			}
+		})
+	}
+}
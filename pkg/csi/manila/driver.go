@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -45,6 +46,9 @@ type DriverOpts struct {
 
 	ServerCSIEndpoint string
 	FwdCSIEndpoint    string
+	// Share protocols served next to ShareProto, with the CSI Node Plugin endpoints their Node Service RPCs are
+	// forwarded to
+	ExtraFwdCSIEndpoints map[string]string
 
 	ManilaClientBuilder manilaclient.Builder
 	CSIClientBuilder    csiclient.Builder
@@ -61,6 +65,8 @@ type Driver struct {
 
 	serverEndpoint string
 	fwdEndpoint    string
+	// Endpoints of the proxied CSI Node Plugins by the share protocol they handle, fwdEndpoint serves shareProto
+	fwdEndpoints map[string]string
 
 	ids *identityServer
 	cs  *controllerServer
@@ -72,6 +78,10 @@ type Driver struct {
 
 	manilaClientBuilder manilaclient.Builder
 	csiClientBuilder    csiclient.Builder
+
+	// Share network IDs resolved from Neutron subnets, see resolveShareNetwork
+	shareNetworksMu sync.Mutex
+	shareNetworks   map[string]string
 }
 
 type nonBlockingGRPCServer struct {
@@ -123,6 +133,8 @@ func NewDriver(o *DriverOpts) (*Driver, error) {
 		manilaClientBuilder: o.ManilaClientBuilder,
 		csiClientBuilder:    o.CSIClientBuilder,
 		clusterID:           o.ClusterID,
+		fwdEndpoints:        make(map[string]string),
+		shareNetworks:       make(map[string]string),
 	}
 
 	klog.Info("Driver: ", d.name)
@@ -150,6 +162,24 @@ func NewDriver(o *DriverOpts) (*Driver, error) {
 
 	d.serverEndpoint = endpointAddress(serverProto, serverAddr)
 	d.fwdEndpoint = endpointAddress(fwdProto, fwdAddr)
+	d.fwdEndpoints[d.shareProto] = d.fwdEndpoint
+
+	for proto, endpoint := range o.ExtraFwdCSIEndpoints {
+		proto = strings.ToUpper(proto)
+		if _, ok := d.fwdEndpoints[proto]; ok {
+			return nil, fmt.Errorf("share protocol %s is served more than once", proto)
+		}
+
+		getShareAdapter(proto)
+
+		fwdProto, fwdAddr, err := parseGRPCEndpoint(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy client address %s for %s shares: %v", endpoint, proto, err)
+		}
+
+		d.fwdEndpoints[proto] = endpointAddress(fwdProto, fwdAddr)
+		klog.Infof("Operating on %s shares as well", proto)
+	}
 
 	d.addControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
@@ -165,26 +195,44 @@ func NewDriver(o *DriverOpts) (*Driver, error) {
 		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
 	})
 
+	// The node service capabilities are the ones of all the proxied drivers. NodeStageVolume is forwarded only to
+	// the ones supporting it.
 	var supportsNodeStage bool
+	nodeStageProtos := make(map[string]bool)
+	nodeCapsMap := make(csiNodeCapabilitySet)
 
-	nodeCapsMap, err := d.initProxiedDriver()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize proxied CSI driver: %v", err)
+	for proto, endpoint := range d.fwdEndpoints {
+		protoCaps, err := d.initProxiedDriver(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize proxied CSI driver for %s shares: %v", proto, err)
+		}
+
+		for c := range protoCaps {
+			nodeCapsMap[c] = true
+
+			if c == csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME {
+				supportsNodeStage = true
+				nodeStageProtos[proto] = true
+			}
+		}
 	}
+
 	nscaps := make([]csi.NodeServiceCapability_RPC_Type, 0, len(nodeCapsMap))
 	for c := range nodeCapsMap {
 		nscaps = append(nscaps, c)
-
-		if c == csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME {
-			supportsNodeStage = true
-		}
 	}
 
 	d.addNodeServiceCapabilities(nscaps)
 
 	d.ids = &identityServer{d: d}
 	d.cs = &controllerServer{d: d}
-	d.ns = &nodeServer{d: d, supportsNodeStage: supportsNodeStage, nodeStageCache: make(map[volumeID]stageCacheEntry)}
+	d.ns = &nodeServer{
+		d:                 d,
+		supportsNodeStage: supportsNodeStage,
+		nodeStageProtos:   nodeStageProtos,
+		nodeStageCache:    make(map[volumeID]stageCacheEntry),
+		volumeProtos:      make(map[volumeID]string),
+	}
 
 	return d, nil
 }
@@ -244,10 +292,43 @@ func (d *Driver) addNodeServiceCapabilities(ns []csi.NodeServiceCapability_RPC_T
 	d.nscaps = caps
 }
 
-func (d *Driver) initProxiedDriver() (csiNodeCapabilitySet, error) {
-	conn, err := d.csiClientBuilder.NewConnection(d.fwdEndpoint)
+// servesShareProto tells whether the driver provisions and mounts shares of the protocol.
+func (d *Driver) servesShareProto(proto string) bool {
+	_, ok := d.fwdEndpoints[strings.ToUpper(proto)]
+	return ok
+}
+
+// selectShareProto picks the share protocol of a volume from the protocol parameter of its StorageClass. The share
+// protocols the driver doesn't serve used to be ignored, they still fall back to the one of the share protocol selector.
+func (d *Driver) selectShareProto(requested, volName string) string {
+	if requested == "" {
+		return d.shareProto
+	}
+
+	if !d.servesShareProto(requested) {
+		klog.Warningf("protocol %s requested for volume %s, but driver %s serves %s shares only, provisioning a %s share instead",
+			requested, volName, d.name, strings.Join(d.servedShareProtos(), ", "), d.shareProto)
+		return d.shareProto
+	}
+
+	return strings.ToUpper(requested)
+}
+
+// servedShareProtos lists the share protocols the driver serves, for the error messages.
+func (d *Driver) servedShareProtos() []string {
+	protos := make([]string, 0, len(d.fwdEndpoints))
+	for proto := range d.fwdEndpoints {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+
+	return protos
+}
+
+func (d *Driver) initProxiedDriver(fwdEndpoint string) (csiNodeCapabilitySet, error) {
+	conn, err := d.csiClientBuilder.NewConnection(fwdEndpoint)
 	if err != nil {
-		return nil, fmt.Errorf("connecting to %s endpoint failed: %v", d.fwdEndpoint, err)
+		return nil, fmt.Errorf("connecting to %s endpoint failed: %v", fwdEndpoint, err)
 	}
 	defer conn.Close()
 
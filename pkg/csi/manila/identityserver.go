@@ -26,6 +26,7 @@ import (
 
 type identityServer struct {
 	d *Driver
+	csi.UnimplementedIdentityServer
 }
 
 func (ids *identityServer) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
@@ -17,6 +17,8 @@ limitations under the License.
 package manilaclient
 
 import (
+	"net/url"
+
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/messages"
 	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
@@ -72,6 +74,10 @@ func (c Client) GrantAccess(shareID string, opts shares.GrantAccessOptsBuilder)
 	return shares.GrantAccess(c.c, shareID, opts).Extract()
 }
 
+func (c Client) RevokeAccess(shareID string, opts shares.RevokeAccessOptsBuilder) error {
+	return shares.RevokeAccess(c.c, shareID, opts).ExtractErr()
+}
+
 func (c Client) GetSnapshotByID(snapID string) (*snapshots.Snapshot, error) {
 	return snapshots.Get(c.c, snapID).Extract()
 }
@@ -118,3 +124,36 @@ func (c Client) GetUserMessages(opts messages.ListOptsBuilder) ([]messages.Messa
 
 	return messages.ExtractMessages(allPages)
 }
+
+func (c Client) GetShareNetworksByNeutronSubnet(neutronNetID, neutronSubnetID string) ([]ShareNetwork, error) {
+	query := url.Values{"neutron_net_id": {neutronNetID}, "neutron_subnet_id": {neutronSubnetID}}
+	var res struct {
+		ShareNetworks []ShareNetwork `json:"share_networks"`
+	}
+	_, err := c.c.Get(c.c.ServiceURL("share-networks", "detail")+"?"+query.Encode(), &res, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.ShareNetworks, nil
+}
+
+func (c Client) CreateShareNetwork(name, description, neutronNetID, neutronSubnetID string) (*ShareNetwork, error) {
+	body := map[string]interface{}{
+		"share_network": map[string]string{
+			"name":              name,
+			"description":       description,
+			"neutron_net_id":    neutronNetID,
+			"neutron_subnet_id": neutronSubnetID,
+		},
+	}
+	var res struct {
+		ShareNetwork ShareNetwork `json:"share_network"`
+	}
+	_, err := c.c.Post(c.c.ServiceURL("share-networks"), body, &res, &gophercloud.RequestOpts{OkCodes: []int{200}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.ShareNetwork, nil
+}
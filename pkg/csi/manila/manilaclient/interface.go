@@ -24,6 +24,14 @@ import (
 	"k8s.io/cloud-provider-openstack/pkg/client"
 )
 
+// ShareNetwork is a Manila share network, the vendored gophercloud doesn't support them.
+type ShareNetwork struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	NeutronNetID    string `json:"neutron_net_id"`
+	NeutronSubnetID string `json:"neutron_subnet_id"`
+}
+
 type Interface interface {
 	GetShareByID(shareID string) (*shares.Share, error)
 	GetShareByName(shareName string) (*shares.Share, error)
@@ -37,6 +45,7 @@ type Interface interface {
 
 	GetAccessRights(shareID string) ([]shares.AccessRight, error)
 	GrantAccess(shareID string, opts shares.GrantAccessOptsBuilder) (*shares.AccessRight, error)
+	RevokeAccess(shareID string, opts shares.RevokeAccessOptsBuilder) error
 
 	GetSnapshotByID(snapID string) (*snapshots.Snapshot, error)
 	GetSnapshotByName(snapName string) (*snapshots.Snapshot, error)
@@ -48,6 +57,9 @@ type Interface interface {
 	GetShareTypeIDFromName(shareTypeName string) (string, error)
 
 	GetUserMessages(opts messages.ListOptsBuilder) ([]messages.Message, error)
+
+	GetShareNetworksByNeutronSubnet(neutronNetID, neutronSubnetID string) ([]ShareNetwork, error)
+	CreateShareNetwork(name, description, neutronNetID, neutronSubnetID string) (*ShareNetwork, error)
 }
 
 type Builder interface {
@@ -36,23 +36,50 @@ type nodeServer struct {
 	d *Driver
 
 	supportsNodeStage bool
+	// Share protocols whose proxied drivers support NodeStageVolume
+	nodeStageProtos map[string]bool
 	// The result of NodeStageVolume is stashed away for NodePublishVolume(s) that will follow
 	nodeStageCache    map[volumeID]stageCacheEntry
 	nodeStageCacheMtx sync.RWMutex
+	// Share protocols of the volumes staged or published on this node, they pick the proxied driver
+	// of the RPCs that come without a volume context
+	volumeProtos    map[volumeID]string
+	volumeProtosMtx sync.Mutex
+	csi.UnimplementedNodeServer
 }
 
 type stageCacheEntry struct {
+	shareProto    string
 	volumeContext map[string]string
 	stageSecret   map[string]string
 	publishSecret map[string]string
 }
 
+func (ns *nodeServer) rememberShareProto(volID volumeID, shareProto string) {
+	ns.volumeProtosMtx.Lock()
+	ns.volumeProtos[volID] = shareProto
+	ns.volumeProtosMtx.Unlock()
+}
+
+// shareProtoOf returns the share protocol of a volume staged or published on this node. The volumes the node doesn't
+// know about, e.g. after a restart of the plugin, are assumed to be of the share protocol selected by the driver.
+func (ns *nodeServer) shareProtoOf(volID volumeID) string {
+	ns.volumeProtosMtx.Lock()
+	defer ns.volumeProtosMtx.Unlock()
+
+	if shareProto, ok := ns.volumeProtos[volID]; ok {
+		return shareProto
+	}
+
+	return ns.d.shareProto
+}
+
 func (ns *nodeServer) buildVolumeContext(volID volumeID, shareOpts *options.NodeVolumeContext, osOpts *client.AuthOpts) (
-	volumeContext map[string]string, accessRight *shares.AccessRight, err error,
+	volumeContext map[string]string, accessRight *shares.AccessRight, shareProto string, err error,
 ) {
 	manilaClient, err := ns.d.manilaClientBuilder.New(osOpts)
 	if err != nil {
-		return nil, nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
+		return nil, nil, "", status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
 	}
 
 	// Retrieve the share by its ID or name
@@ -67,7 +94,7 @@ func (ns *nodeServer) buildVolumeContext(volID volumeID, shareOpts *options.Node
 				errCode = codes.NotFound
 			}
 
-			return nil, nil, status.Errorf(errCode, "failed to retrieve volume with share ID %s: %v", shareOpts.ShareID, err)
+			return nil, nil, "", status.Errorf(errCode, "failed to retrieve volume with share ID %s: %v", shareOpts.ShareID, err)
 		}
 	} else {
 		share, err = manilaClient.GetShareByName(shareOpts.ShareName)
@@ -77,24 +104,26 @@ func (ns *nodeServer) buildVolumeContext(volID volumeID, shareOpts *options.Node
 				errCode = codes.NotFound
 			}
 
-			return nil, nil, status.Errorf(errCode, "failed to retrieve volume with share name %s: %v", shareOpts.ShareName, err)
+			return nil, nil, "", status.Errorf(errCode, "failed to retrieve volume with share name %s: %v", shareOpts.ShareName, err)
 		}
 	}
 
 	// Verify the plugin supports this share
 
-	if !strings.EqualFold(share.ShareProto, ns.d.shareProto) {
-		return nil, nil, status.Errorf(codes.InvalidArgument,
+	if !ns.d.servesShareProto(share.ShareProto) {
+		return nil, nil, "", status.Errorf(codes.InvalidArgument,
 			"wrong share protocol %s for volume %s, the plugin is set to operate in %s",
-			share.ShareProto, volID, ns.d.shareProto)
+			share.ShareProto, volID, strings.Join(ns.d.servedShareProtos(), ", "))
 	}
 
+	shareProto = strings.ToUpper(share.ShareProto)
+
 	if share.Status != shareAvailable {
 		if share.Status == shareCreating {
-			return nil, nil, status.Errorf(codes.Unavailable, "volume %s is in transient creating state", volID)
+			return nil, nil, "", status.Errorf(codes.Unavailable, "volume %s is in transient creating state", volID)
 		}
 
-		return nil, nil, status.Errorf(codes.FailedPrecondition, "invalid share status for volume %s: expected 'available', got '%s'",
+		return nil, nil, "", status.Errorf(codes.FailedPrecondition, "invalid share status for volume %s: expected 'available', got '%s'",
 			volID, share.Status)
 	}
 
@@ -102,7 +131,7 @@ func (ns *nodeServer) buildVolumeContext(volID volumeID, shareOpts *options.Node
 
 	accessRights, err := manilaClient.GetAccessRights(share.ID)
 	if err != nil {
-		return nil, nil, status.Errorf(codes.Internal, "failed to list access rights for volume %s: %v", volID, err)
+		return nil, nil, "", status.Errorf(codes.Internal, "failed to list access rights for volume %s: %v", volID, err)
 	}
 
 	for i := range accessRights {
@@ -113,7 +142,7 @@ func (ns *nodeServer) buildVolumeContext(volID volumeID, shareOpts *options.Node
 	}
 
 	if accessRight == nil {
-		return nil, nil, status.Errorf(codes.InvalidArgument, "cannot find access right %s for volume %s",
+		return nil, nil, "", status.Errorf(codes.InvalidArgument, "cannot find access right %s for volume %s",
 			shareOpts.ShareAccessID, volID)
 	}
 
@@ -122,19 +151,19 @@ func (ns *nodeServer) buildVolumeContext(volID volumeID, shareOpts *options.Node
 
 	availableExportLocations, err := manilaClient.GetExportLocations(share.ID)
 	if err != nil {
-		return nil, nil, status.Errorf(codes.Internal, "failed to list export locations for volume %s: %v", volID, err)
+		return nil, nil, "", status.Errorf(codes.Internal, "failed to list export locations for volume %s: %v", volID, err)
 	}
 
 	// Build volume context for fwd plugin
 
-	sa := getShareAdapter(ns.d.shareProto)
+	sa := getShareAdapter(shareProto)
 	opts := &shareadapters.VolumeContextArgs{
 		Locations: availableExportLocations,
 		Options:   shareOpts,
 	}
 	volumeContext, err = sa.BuildVolumeContext(opts)
 	if err != nil {
-		return nil, nil, status.Errorf(codes.InvalidArgument, "failed to build volume context for volume %s: %v", volID, err)
+		return nil, nil, "", status.Errorf(codes.InvalidArgument, "failed to build volume context for volume %s: %v", volID, err)
 	}
 
 	return
@@ -186,6 +215,7 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	var (
 		accessRight       *shares.AccessRight
 		volumeCtx, secret map[string]string
+		shareProto        string
 	)
 
 	if ns.supportsNodeStage {
@@ -196,29 +226,32 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		ns.nodeStageCacheMtx.RUnlock()
 
 		if ok {
-			volumeCtx, secret = cacheEntry.volumeContext, cacheEntry.publishSecret
+			volumeCtx, secret, shareProto = cacheEntry.volumeContext, cacheEntry.publishSecret, cacheEntry.shareProto
 		} else {
 			klog.Warningf("STAGE_UNSTAGE_VOLUME capability is enabled, but node stage cache doesn't contain an entry for %s - this is most likely a bug! Rebuilding staging data anyway...", volID)
-			volumeCtx, accessRight, err = ns.buildVolumeContext(volID, shareOpts, osOpts)
+			volumeCtx, accessRight, shareProto, err = ns.buildVolumeContext(volID, shareOpts, osOpts)
 			if err == nil {
-				secret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+				secret, err = buildNodePublishSecret(accessRight, getShareAdapter(shareProto), volID)
 			}
 		}
 	} else {
-		volumeCtx, accessRight, err = ns.buildVolumeContext(volID, shareOpts, osOpts)
+		volumeCtx, accessRight, shareProto, err = ns.buildVolumeContext(volID, shareOpts, osOpts)
 		if err == nil {
-			secret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			secret, err = buildNodePublishSecret(accessRight, getShareAdapter(shareProto), volID)
 		}
 	}
 	if err != nil {
 		return nil, err
 	}
 
+	ns.rememberShareProto(volID, shareProto)
+
 	// Forward the RPC
 
-	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, ns.d.fwdEndpoint)
+	fwdEndpoint := ns.d.fwdEndpoints[shareProto]
+	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, fwdEndpoint)
 	if err != nil {
-		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(ns.d.fwdEndpoint, err))
+		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(fwdEndpoint, err))
 	}
 	defer csiConn.Close()
 
@@ -233,9 +266,10 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, ns.d.fwdEndpoint)
+	fwdEndpoint := ns.d.fwdEndpoints[ns.shareProtoOf(volumeID(req.GetVolumeId()))]
+	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, fwdEndpoint)
 	if err != nil {
-		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(ns.d.fwdEndpoint, err))
+		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(fwdEndpoint, err))
 	}
 	defer csiConn.Close()
 
@@ -253,6 +287,7 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 		accessRight                *shares.AccessRight
 		volumeCtx                  map[string]string
 		stageSecret, publishSecret map[string]string
+		shareProto                 string
 		err                        error
 	)
 
@@ -270,20 +305,20 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 
 	ns.nodeStageCacheMtx.Lock()
 	if cacheEntry, ok := ns.nodeStageCache[volID]; ok {
-		volumeCtx, stageSecret = cacheEntry.volumeContext, cacheEntry.stageSecret
+		volumeCtx, stageSecret, shareProto = cacheEntry.volumeContext, cacheEntry.stageSecret, cacheEntry.shareProto
 	} else {
-		volumeCtx, accessRight, err = ns.buildVolumeContext(volID, shareOpts, osOpts)
+		volumeCtx, accessRight, shareProto, err = ns.buildVolumeContext(volID, shareOpts, osOpts)
 
 		if err == nil {
-			stageSecret, err = buildNodeStageSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			stageSecret, err = buildNodeStageSecret(accessRight, getShareAdapter(shareProto), volID)
 		}
 
 		if err == nil {
-			publishSecret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			publishSecret, err = buildNodePublishSecret(accessRight, getShareAdapter(shareProto), volID)
 		}
 
 		if err == nil {
-			ns.nodeStageCache[volID] = stageCacheEntry{volumeContext: volumeCtx, stageSecret: stageSecret, publishSecret: publishSecret}
+			ns.nodeStageCache[volID] = stageCacheEntry{shareProto: shareProto, volumeContext: volumeCtx, stageSecret: stageSecret, publishSecret: publishSecret}
 		}
 	}
 	ns.nodeStageCacheMtx.Unlock()
@@ -291,11 +326,19 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 		return nil, err
 	}
 
+	ns.rememberShareProto(volID, shareProto)
+
+	if !ns.nodeStageProtos[shareProto] {
+		// The proxied driver of this share protocol mounts the volume in NodePublishVolume, the staging data is enough.
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
 	// Forward the RPC
 
-	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, ns.d.fwdEndpoint)
+	fwdEndpoint := ns.d.fwdEndpoints[shareProto]
+	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, fwdEndpoint)
 	if err != nil {
-		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(ns.d.fwdEndpoint, err))
+		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(fwdEndpoint, err))
 	}
 	defer csiConn.Close()
 
@@ -310,13 +353,25 @@ func (ns *nodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	volID := volumeID(req.VolumeId)
+	shareProto := ns.shareProtoOf(volID)
+
 	ns.nodeStageCacheMtx.Lock()
-	delete(ns.nodeStageCache, volumeID(req.VolumeId))
+	delete(ns.nodeStageCache, volID)
 	ns.nodeStageCacheMtx.Unlock()
 
-	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, ns.d.fwdEndpoint)
+	ns.volumeProtosMtx.Lock()
+	delete(ns.volumeProtos, volID)
+	ns.volumeProtosMtx.Unlock()
+
+	if !ns.nodeStageProtos[shareProto] {
+		return &csi.NodeUnstageVolumeResponse{}, nil
+	}
+
+	fwdEndpoint := ns.d.fwdEndpoints[shareProto]
+	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, fwdEndpoint)
 	if err != nil {
-		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(ns.d.fwdEndpoint, err))
+		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(fwdEndpoint, err))
 	}
 	defer csiConn.Close()
 
@@ -344,9 +399,10 @@ func (ns *nodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetC
 }
 
 func (ns *nodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
-	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, ns.d.fwdEndpoint)
+	fwdEndpoint := ns.d.fwdEndpoints[ns.shareProtoOf(volumeID(req.GetVolumeId()))]
+	csiConn, err := ns.d.csiClientBuilder.NewConnectionWithContext(ctx, fwdEndpoint)
 	if err != nil {
-		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(ns.d.fwdEndpoint, err))
+		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(fwdEndpoint, err))
 	}
 	defer csiConn.Close()
 
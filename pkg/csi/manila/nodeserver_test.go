@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/cloud-provider-openstack/pkg/client"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/csiclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+// fakeNodeShareClient serves a native CephFS share and a CephFS share exported through NFS-Ganesha.
+type fakeNodeShareClient struct {
+	manilaclient.Interface
+}
+
+func (c *fakeNodeShareClient) New(*client.AuthOpts) (manilaclient.Interface, error) {
+	return c, nil
+}
+
+func (c *fakeNodeShareClient) GetShareByID(shareID string) (*shares.Share, error) {
+	proto := map[string]string{"cephfs-share": "CEPHFS", "nfs-share": "NFS"}[shareID]
+	return &shares.Share{ID: shareID, ShareProto: proto, Status: shareAvailable}, nil
+}
+
+func (c *fakeNodeShareClient) GetAccessRights(shareID string) ([]shares.AccessRight, error) {
+	if shareID == "cephfs-share" {
+		return []shares.AccessRight{{ID: "access-id", AccessType: "cephx", AccessTo: "client", AccessKey: "key"}}, nil
+	}
+	return []shares.AccessRight{{ID: "access-id", AccessType: "ip", AccessTo: "0.0.0.0/0"}}, nil
+}
+
+func (c *fakeNodeShareClient) GetExportLocations(shareID string) ([]shares.ExportLocation, error) {
+	if shareID == "cephfs-share" {
+		return []shares.ExportLocation{{Path: "10.0.0.1:6789:/volumes/cephfs-share"}}, nil
+	}
+	return []shares.ExportLocation{{Path: "10.0.0.2:/volumes/nfs-share"}}, nil
+}
+
+// fakeFwdCSIClientBuilder records the RPCs forwarded to the proxied drivers, by their endpoints.
+type fakeFwdCSIClientBuilder struct {
+	endpoint  string
+	forwarded []string
+	// Volume contexts of the published volumes
+	published map[string]map[string]string
+}
+
+func (b *fakeFwdCSIClientBuilder) NewConnection(endpoint string) (*grpc.ClientConn, error) {
+	return b.NewConnectionWithContext(context.TODO(), endpoint)
+}
+
+func (b *fakeFwdCSIClientBuilder) NewConnectionWithContext(_ context.Context, endpoint string) (*grpc.ClientConn, error) {
+	b.endpoint = endpoint
+	return grpc.Dial("localhost", grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+func (b *fakeFwdCSIClientBuilder) NewNodeServiceClient(*grpc.ClientConn) csiclient.Node {
+	return &fakeFwdNodeClient{b: b}
+}
+
+func (b *fakeFwdCSIClientBuilder) NewIdentityServiceClient(*grpc.ClientConn) csiclient.Identity {
+	return nil
+}
+
+type fakeFwdNodeClient struct {
+	csiclient.Node
+	b *fakeFwdCSIClientBuilder
+}
+
+func (c *fakeFwdNodeClient) StageVolume(_ context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	c.b.forwarded = append(c.b.forwarded, "stage "+req.GetVolumeId()+" to "+c.b.endpoint)
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+func (c *fakeFwdNodeClient) UnstageVolume(_ context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	c.b.forwarded = append(c.b.forwarded, "unstage "+req.GetVolumeId()+" to "+c.b.endpoint)
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+func (c *fakeFwdNodeClient) PublishVolume(_ context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	c.b.forwarded = append(c.b.forwarded, "publish "+req.GetVolumeId()+" to "+c.b.endpoint)
+	c.b.published[req.GetVolumeId()] = req.GetVolumeContext()
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+func (c *fakeFwdNodeClient) UnpublishVolume(_ context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	c.b.forwarded = append(c.b.forwarded, "unpublish "+req.GetVolumeId()+" to "+c.b.endpoint)
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+func TestNodeStageVolumeShareProto(t *testing.T) {
+	csiClientBuilder := &fakeFwdCSIClientBuilder{published: make(map[string]map[string]string)}
+	d := &Driver{
+		shareProto:          "CEPHFS",
+		fwdEndpoint:         "unix:///csi/cephfs.sock",
+		fwdEndpoints:        map[string]string{"CEPHFS": "unix:///csi/cephfs.sock", "NFS": "unix:///csi/nfs.sock"},
+		manilaClientBuilder: &fakeNodeShareClient{},
+		csiClientBuilder:    csiClientBuilder,
+	}
+	// CSI NFS mounts the volumes in NodePublishVolume, it doesn't support NodeStageVolume.
+	ns := &nodeServer{
+		d:                 d,
+		supportsNodeStage: true,
+		nodeStageProtos:   map[string]bool{"CEPHFS": true},
+		nodeStageCache:    make(map[volumeID]stageCacheEntry),
+		volumeProtos:      make(map[volumeID]string),
+	}
+
+	secrets := map[string]string{"os-authURL": "https://keystone.example.com", "os-region": "RegionOne", "os-trustID": "trust-id"}
+	capability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+	}
+
+	for _, volID := range []string{"cephfs-share", "nfs-share"} {
+		volCtx := map[string]string{"shareID": volID, "shareAccessID": "access-id"}
+
+		if _, err := ns.NodeStageVolume(context.TODO(), &csi.NodeStageVolumeRequest{
+			VolumeId:          volID,
+			StagingTargetPath: "/staging/" + volID,
+			VolumeCapability:  capability,
+			VolumeContext:     volCtx,
+			Secrets:           secrets,
+		}); err != nil {
+			t.Fatalf("failed to stage %s: %v", volID, err)
+		}
+
+		if _, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeId:          volID,
+			StagingTargetPath: "/staging/" + volID,
+			TargetPath:        "/target/" + volID,
+			VolumeCapability:  capability,
+			VolumeContext:     volCtx,
+			Secrets:           secrets,
+		}); err != nil {
+			t.Fatalf("failed to publish %s: %v", volID, err)
+		}
+
+		if _, err := ns.NodeUnpublishVolume(context.TODO(), &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   volID,
+			TargetPath: "/target/" + volID,
+		}); err != nil {
+			t.Fatalf("failed to unpublish %s: %v", volID, err)
+		}
+
+		if _, err := ns.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{
+			VolumeId:          volID,
+			StagingTargetPath: "/staging/" + volID,
+		}); err != nil {
+			t.Fatalf("failed to unstage %s: %v", volID, err)
+		}
+	}
+
+	expected := []string{
+		"stage cephfs-share to unix:///csi/cephfs.sock",
+		"publish cephfs-share to unix:///csi/cephfs.sock",
+		"unpublish cephfs-share to unix:///csi/cephfs.sock",
+		"unstage cephfs-share to unix:///csi/cephfs.sock",
+		"publish nfs-share to unix:///csi/nfs.sock",
+		"unpublish nfs-share to unix:///csi/nfs.sock",
+	}
+	if !reflect.DeepEqual(csiClientBuilder.forwarded, expected) {
+		t.Errorf("expected the RPCs\n%v\nto be forwarded, got\n%v", expected, csiClientBuilder.forwarded)
+	}
+
+	// Each share is mounted from the export location of its protocol.
+	if monitors := csiClientBuilder.published["cephfs-share"]["monitors"]; monitors != "10.0.0.1:6789" {
+		t.Errorf("expected the CephFS share to be mounted from the monitors 10.0.0.1:6789, got %q", monitors)
+	}
+	if server := csiClientBuilder.published["nfs-share"]["server"]; server != "10.0.0.2" {
+		t.Errorf("expected the NFS share to be mounted from the server 10.0.0.2, got %q", server)
+	}
+}
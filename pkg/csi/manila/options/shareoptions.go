@@ -21,12 +21,15 @@ import (
 )
 
 type ControllerVolumeContext struct {
-	Protocol            string `name:"protocol" matches:"^(?i)CEPHFS|NFS$"`
-	Type                string `name:"type" value:"default:default"`
-	ShareNetworkID      string `name:"shareNetworkID" value:"optional"`
-	AutoTopology        string `name:"autoTopology" value:"default:false" matches:"(?i)^true|false$"`
-	AvailabilityZone    string `name:"availability" value:"optional"`
-	AppendShareMetadata string `name:"appendShareMetadata" value:"optional"`
+	Protocol                    string `name:"protocol" matches:"^(?i)CEPHFS|NFS$"`
+	Type                        string `name:"type" value:"default:default"`
+	ShareNetworkID              string `name:"shareNetworkID" value:"optional"`
+	ShareNetworkNeutronNetID    string `name:"shareNetworkNeutronNetID" value:"optional" dependsOn:"shareNetworkNeutronSubnetID" precludes:"shareNetworkID"`
+	ShareNetworkNeutronSubnetID string `name:"shareNetworkNeutronSubnetID" value:"optional" dependsOn:"shareNetworkNeutronNetID" precludes:"shareNetworkID"`
+	AutoTopology                string `name:"autoTopology" value:"default:false" matches:"(?i)^true|false$"`
+	AvailabilityZone            string `name:"availability" value:"optional"`
+	AppendShareMetadata         string `name:"appendShareMetadata" value:"optional"`
+	RetainShare                 string `name:"retainShare" value:"default:false" matches:"(?i)^true|false$"`
 
 	// Adapter options
 
@@ -105,6 +105,32 @@ func deleteShare(manilaClient manilaclient.Interface, shareID string) error {
 	return nil
 }
 
+// revokeShareAccess revokes the access rule granted to the cluster, recorded in the metadata of the share, so that the
+// retained share cannot be mounted with its key anymore. The rule already gone is ignored.
+func revokeShareAccess(manilaClient manilaclient.Interface, share *shares.Share) error {
+	accessID := share.Metadata[accessIDMetadataKey]
+	if accessID == "" {
+		return nil
+	}
+
+	rights, err := manilaClient.GetAccessRights(share.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list access rights: %v", err)
+	}
+	for _, r := range rights {
+		if r.ID != accessID {
+			continue
+		}
+		if err := manilaClient.RevokeAccess(share.ID, shares.RevokeAccessOpts{AccessID: accessID}); err != nil && !clouderrors.IsNotFound(err) {
+			return fmt.Errorf("failed to revoke access rule %s: %v", accessID, err)
+		}
+		return nil
+	}
+
+	klog.V(4).Infof("access rule %s of volume %s not found, assuming it to be already revoked", accessID, share.ID)
+	return nil
+}
+
 func tryDeleteShare(manilaClient manilaclient.Interface, share *shares.Share) {
 	if share == nil {
 		return
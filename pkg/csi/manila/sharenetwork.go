@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/client"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/klog/v2"
+)
+
+const (
+	shareNetworkDescription = "Share network created by the Manila CSI driver"
+	dhssExtraSpec           = "driver_handles_share_servers"
+)
+
+// shareNetworkCacheKey identifies the share network resolved for the share type and Neutron subnet in the project of
+// the credentials.
+func shareNetworkCacheKey(osOpts *client.AuthOpts, shareOpts *options.ControllerVolumeContext) string {
+	return strings.Join([]string{
+		osOpts.AuthURL, osOpts.Region, osOpts.TenantID, osOpts.TenantName, osOpts.TenantDomainName, osOpts.TrustID,
+		osOpts.ApplicationCredentialID,
+		shareOpts.Type, shareOpts.ShareNetworkNeutronNetID, shareOpts.ShareNetworkNeutronSubnetID,
+	}, "/")
+}
+
+// resolveShareNetwork sets the share network of the share to the one of the Neutron subnet given in the
+// shareNetworkNeutronNetID and shareNetworkNeutronSubnetID parameters, creating it if there's none yet. Share types
+// with driver_handles_share_servers=False don't use share networks, so none is set for them. The result is cached
+// until forgetShareNetwork is called.
+func (d *Driver) resolveShareNetwork(manilaClient manilaclient.Interface, osOpts *client.AuthOpts, shareOpts *options.ControllerVolumeContext) error {
+	if shareOpts.ShareNetworkNeutronSubnetID == "" {
+		return nil
+	}
+
+	key := shareNetworkCacheKey(osOpts, shareOpts)
+
+	d.shareNetworksMu.Lock()
+	defer d.shareNetworksMu.Unlock()
+
+	if shareNetworkID, ok := d.shareNetworks[key]; ok {
+		shareOpts.ShareNetworkID = shareNetworkID
+		return nil
+	}
+
+	dhss, err := shareTypeHandlesShareServers(manilaClient, shareOpts.Type)
+	if err != nil {
+		return err
+	}
+
+	var shareNetworkID string
+	if dhss {
+		shareNetworkID, err = getOrCreateShareNetwork(manilaClient, shareOpts.ShareNetworkNeutronNetID, shareOpts.ShareNetworkNeutronSubnetID)
+		if err != nil {
+			return err
+		}
+	} else {
+		klog.V(4).Infof("share type %s doesn't handle share servers, share network of subnet %s won't be used", shareOpts.Type, shareOpts.ShareNetworkNeutronSubnetID)
+	}
+
+	d.shareNetworks[key] = shareNetworkID
+	shareOpts.ShareNetworkID = shareNetworkID
+
+	return nil
+}
+
+// forgetShareNetwork drops the cached share network of the share, so that it's resolved again next time.
+func (d *Driver) forgetShareNetwork(osOpts *client.AuthOpts, shareOpts *options.ControllerVolumeContext) {
+	if shareOpts.ShareNetworkNeutronSubnetID == "" {
+		return
+	}
+
+	d.shareNetworksMu.Lock()
+	defer d.shareNetworksMu.Unlock()
+
+	delete(d.shareNetworks, shareNetworkCacheKey(osOpts, shareOpts))
+}
+
+// shareTypeHandlesShareServers tells if the share type, given either by its name or ID, requires a share network.
+func shareTypeHandlesShareServers(manilaClient manilaclient.Interface, shareType string) (bool, error) {
+	shareTypes, err := manilaClient.GetShareTypes()
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "failed to retrieve share types: %v", err)
+	}
+
+	for _, t := range shareTypes {
+		if t.ID != shareType && t.Name != shareType {
+			continue
+		}
+
+		dhss := fmt.Sprint(t.RequiredExtraSpecs[dhssExtraSpec])
+		return strings.EqualFold(dhss, "true"), nil
+	}
+
+	return false, status.Errorf(codes.InvalidArgument, "share type %s not found", shareType)
+}
+
+// getOrCreateShareNetwork returns the ID of a share network of the Neutron subnet, a new one is created if there's none.
+func getOrCreateShareNetwork(manilaClient manilaclient.Interface, neutronNetID, neutronSubnetID string) (string, error) {
+	shareNetworks, err := manilaClient.GetShareNetworksByNeutronSubnet(neutronNetID, neutronSubnetID)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to retrieve share networks of subnet %s: %v", neutronSubnetID, err)
+	}
+
+	if len(shareNetworks) > 0 {
+		klog.V(4).Infof("using share network %s for subnet %s", shareNetworks[0].ID, neutronSubnetID)
+		return shareNetworks[0].ID, nil
+	}
+
+	shareNetwork, err := manilaClient.CreateShareNetwork(fmt.Sprintf("csi-manila-%s", neutronSubnetID), shareNetworkDescription, neutronNetID, neutronSubnetID)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to create share network for subnet %s: %v", neutronSubnetID, err)
+	}
+
+	klog.V(4).Infof("created share network %s for subnet %s", shareNetwork.ID, neutronSubnetID)
+
+	return shareNetwork.ID, nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/sharetypes"
+	"k8s.io/cloud-provider-openstack/pkg/client"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+// fakeShareNetworkClient implements the calls needed to resolve share networks, the others panic.
+type fakeShareNetworkClient struct {
+	manilaclient.Interface
+
+	shareNetworks []manilaclient.ShareNetwork
+	created       int
+	lookups       int
+}
+
+func (c *fakeShareNetworkClient) GetShareTypes() ([]sharetypes.ShareType, error) {
+	return []sharetypes.ShareType{
+		{ID: "dhss-id", Name: "dhss", RequiredExtraSpecs: map[string]interface{}{"driver_handles_share_servers": "True"}},
+		{ID: "no-dhss-id", Name: "no-dhss", RequiredExtraSpecs: map[string]interface{}{"driver_handles_share_servers": "False"}},
+	}, nil
+}
+
+func (c *fakeShareNetworkClient) GetShareNetworksByNeutronSubnet(neutronNetID, neutronSubnetID string) ([]manilaclient.ShareNetwork, error) {
+	c.lookups++
+	var res []manilaclient.ShareNetwork
+	for _, sn := range c.shareNetworks {
+		if sn.NeutronNetID == neutronNetID && sn.NeutronSubnetID == neutronSubnetID {
+			res = append(res, sn)
+		}
+	}
+	return res, nil
+}
+
+func (c *fakeShareNetworkClient) CreateShareNetwork(name, description, neutronNetID, neutronSubnetID string) (*manilaclient.ShareNetwork, error) {
+	c.created++
+	sn := manilaclient.ShareNetwork{ID: "created-" + neutronSubnetID, Name: name, NeutronNetID: neutronNetID, NeutronSubnetID: neutronSubnetID}
+	c.shareNetworks = append(c.shareNetworks, sn)
+	return &sn, nil
+}
+
+func TestResolveShareNetwork(t *testing.T) {
+	ts := []struct {
+		name              string
+		shareType         string
+		subnetID          string
+		expectedNetworkID string
+		expectedCreated   int
+		expectedError     bool
+	}{
+		{
+			name:              "existing share network",
+			shareType:         "dhss",
+			subnetID:          "subnet-1",
+			expectedNetworkID: "existing",
+		},
+		{
+			name:              "share type given by ID",
+			shareType:         "dhss-id",
+			subnetID:          "subnet-1",
+			expectedNetworkID: "existing",
+		},
+		{
+			name:              "new share network",
+			shareType:         "dhss",
+			subnetID:          "subnet-2",
+			expectedNetworkID: "created-subnet-2",
+			expectedCreated:   1,
+		},
+		{
+			name:      "share type without share servers",
+			shareType: "no-dhss",
+			subnetID:  "subnet-2",
+		},
+		{
+			name:          "unknown share type",
+			shareType:     "unknown",
+			subnetID:      "subnet-1",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			manilaClient := &fakeShareNetworkClient{
+				shareNetworks: []manilaclient.ShareNetwork{{ID: "existing", NeutronNetID: "net", NeutronSubnetID: "subnet-1"}},
+			}
+			d := &Driver{shareNetworks: make(map[string]string)}
+			osOpts := &client.AuthOpts{TenantID: "project"}
+
+			// The second call is served from the cache.
+			for i := 0; i < 2; i++ {
+				shareOpts := &options.ControllerVolumeContext{Type: tt.shareType, ShareNetworkNeutronNetID: "net", ShareNetworkNeutronSubnetID: tt.subnetID}
+				err := d.resolveShareNetwork(manilaClient, osOpts, shareOpts)
+				if tt.expectedError {
+					if err == nil {
+						t.Fatal("expected an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if shareOpts.ShareNetworkID != tt.expectedNetworkID {
+					t.Errorf("expected share network %q, got %q", tt.expectedNetworkID, shareOpts.ShareNetworkID)
+				}
+			}
+			if manilaClient.created != tt.expectedCreated {
+				t.Errorf("expected %d share networks to be created, got %d", tt.expectedCreated, manilaClient.created)
+			}
+			if manilaClient.lookups > 1 {
+				t.Errorf("expected the share network to be cached, looked it up %d times", manilaClient.lookups)
+			}
+		})
+	}
+}
+
+func TestForgetShareNetwork(t *testing.T) {
+	manilaClient := &fakeShareNetworkClient{}
+	d := &Driver{shareNetworks: make(map[string]string)}
+	osOpts := &client.AuthOpts{TenantID: "project"}
+	shareOpts := &options.ControllerVolumeContext{Type: "dhss", ShareNetworkNeutronNetID: "net", ShareNetworkNeutronSubnetID: "subnet"}
+
+	if err := d.resolveShareNetwork(manilaClient, osOpts, shareOpts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.forgetShareNetwork(osOpts, shareOpts)
+	if err := d.resolveShareNetwork(manilaClient, osOpts, shareOpts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if manilaClient.lookups != 2 || manilaClient.created != 1 {
+		t.Errorf("expected the share network to be looked up again and reused, got %d lookups and %d created", manilaClient.lookups, manilaClient.created)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+const storageProtocolExtraSpec = "storage_protocol"
+
+// shareTypeProtocols returns the share protocols the storage_protocol extra spec of a share type allows, e.g. NFS for
+// CephFS shares exported through NFS-Ganesha. The extra spec may use the <is> and <in> operators, and the backends
+// serving several protocols report them joined with underscores, e.g. NFS_CIFS.
+func shareTypeProtocols(storageProtocol string) []string {
+	storageProtocol = strings.TrimSpace(storageProtocol)
+	for _, op := range []string{"<is>", "<in>"} {
+		storageProtocol = strings.TrimSpace(strings.TrimPrefix(storageProtocol, op))
+	}
+
+	return strings.FieldsFunc(strings.ToUpper(storageProtocol), func(r rune) bool {
+		return r == '_' || r == ' '
+	})
+}
+
+// checkShareTypeProtocol tells whether the share type, given either by its name or ID, can provide shares of the
+// protocol. Share types without the storage_protocol extra spec may be served by any backend, they're accepted as is.
+// The error is only a hint, Manila has the final word on the share type.
+func checkShareTypeProtocol(manilaClient manilaclient.Interface, shareType, protocol string) error {
+	shareTypes, err := manilaClient.GetShareTypes()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve share types to check share type %s provides %s shares: %v", shareType, protocol, err)
+	}
+
+	for _, t := range shareTypes {
+		if t.ID != shareType && t.Name != shareType {
+			continue
+		}
+
+		spec, ok := t.ExtraSpecs[storageProtocolExtraSpec]
+		if !ok {
+			return nil
+		}
+
+		protocols := shareTypeProtocols(fmt.Sprint(spec))
+		for _, p := range protocols {
+			if strings.EqualFold(p, protocol) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("share type %s doesn't provide %s shares, its %s is %v", shareType, protocol, storageProtocolExtraSpec, spec)
+	}
+
+	// The share types that aren't listed, e.g. the default one, are left for Manila to validate.
+	return nil
+}
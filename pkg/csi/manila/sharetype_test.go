@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/sharedfilesystems/v2/sharetypes"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+// fakeShareTypeClient lists share types of CephFS backends exporting the shares natively and through NFS-Ganesha.
+type fakeShareTypeClient struct {
+	manilaclient.Interface
+}
+
+func (c *fakeShareTypeClient) GetShareTypes() ([]sharetypes.ShareType, error) {
+	return []sharetypes.ShareType{
+		{ID: "cephfs-id", Name: "cephfs", ExtraSpecs: map[string]interface{}{"storage_protocol": "CEPHFS"}},
+		{ID: "ganesha-id", Name: "cephfs-nfs", ExtraSpecs: map[string]interface{}{"storage_protocol": "<is> NFS"}},
+		{ID: "multi-id", Name: "multi", ExtraSpecs: map[string]interface{}{"storage_protocol": "NFS_CIFS"}},
+		{ID: "any-id", Name: "any", ExtraSpecs: map[string]interface{}{}},
+	}, nil
+}
+
+// failingShareTypeClient can't list the share types, e.g. for lack of permissions.
+type failingShareTypeClient struct {
+	manilaclient.Interface
+}
+
+func (c *failingShareTypeClient) GetShareTypes() ([]sharetypes.ShareType, error) {
+	return nil, errors.New("forbidden")
+}
+
+func TestShareTypeProtocols(t *testing.T) {
+	ts := []struct {
+		storageProtocol string
+		expected        []string
+	}{
+		{storageProtocol: "CEPHFS", expected: []string{"CEPHFS"}},
+		{storageProtocol: "<is> NFS", expected: []string{"NFS"}},
+		{storageProtocol: "<in> nfs", expected: []string{"NFS"}},
+		{storageProtocol: "NFS_CIFS", expected: []string{"NFS", "CIFS"}},
+		{storageProtocol: "", expected: []string{}},
+	}
+
+	for _, tc := range ts {
+		if res := shareTypeProtocols(tc.storageProtocol); !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.storageProtocol, tc.expected, res)
+		}
+	}
+}
+
+func TestCheckShareTypeProtocol(t *testing.T) {
+	ts := []struct {
+		name          string
+		shareType     string
+		protocol      string
+		expectedError bool
+	}{
+		{name: "native CephFS", shareType: "cephfs", protocol: "CEPHFS"},
+		{name: "CephFS through NFS-Ganesha", shareType: "cephfs-nfs", protocol: "NFS"},
+		{name: "share type given by ID", shareType: "ganesha-id", protocol: "NFS"},
+		{name: "NFS on a native CephFS share type", shareType: "cephfs", protocol: "NFS", expectedError: true},
+		{name: "native CephFS on an NFS-Ganesha share type", shareType: "cephfs-nfs", protocol: "CEPHFS", expectedError: true},
+		{name: "one of several protocols", shareType: "multi", protocol: "NFS"},
+		{name: "no storage protocol", shareType: "any", protocol: "CEPHFS"},
+		{name: "unlisted share type", shareType: "default", protocol: "NFS"},
+	}
+
+	for _, tc := range ts {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkShareTypeProtocol(&fakeShareTypeClient{}, tc.shareType, tc.protocol)
+			if tc.expectedError != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.expectedError, err)
+			}
+		})
+	}
+
+	if err := checkShareTypeProtocol(&failingShareTypeClient{}, "cephfs", "CEPHFS"); err == nil {
+		t.Error("expected an error when the share types can't be listed")
+	}
+}
+
+func TestSelectShareProto(t *testing.T) {
+	d := &Driver{
+		name:         "manila.csi.openstack.org",
+		shareProto:   "CEPHFS",
+		fwdEndpoints: map[string]string{"CEPHFS": "unix:///csi/cephfs.sock", "NFS": "unix:///csi/nfs.sock"},
+	}
+
+	ts := []struct {
+		requested string
+		expected  string
+	}{
+		{requested: "", expected: "CEPHFS"},
+		{requested: "CEPHFS", expected: "CEPHFS"},
+		{requested: "nfs", expected: "NFS"},
+		// The share protocols the driver doesn't serve fall back to the one of the share protocol selector.
+		{requested: "CIFS", expected: "CEPHFS"},
+	}
+
+	for _, tc := range ts {
+		if proto := d.selectShareProto(tc.requested, "pv-1"); proto != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.requested, tc.expected, proto)
+		}
+	}
+}
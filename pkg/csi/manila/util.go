@@ -149,10 +149,6 @@ func lastResourceError(manilaClient manilaclient.Interface, resourceID string) (
 	return manilaErrorMessage{message: "unknown error"}, nil
 }
 
-func compareProtocol(protoA, protoB string) bool {
-	return strings.EqualFold(protoA, protoB)
-}
-
 //
 // Controller service request validation
 //
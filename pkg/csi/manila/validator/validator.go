@@ -113,6 +113,12 @@ func (v *Validator) Populate(data map[string]string, out interface{}) error {
 				return fmt.Errorf("parameter '%s' cannot be empty", fName)
 			}
 
+			// Only string fields can be populated, the other ones are set by other means
+
+			if vOut.Field(int(fIdx)).Kind() != reflect.String {
+				return fmt.Errorf("parameter '%s' is not supported", fName)
+			}
+
 			// The value is present, populate the field and continue with the next one
 
 			vOut.Field(int(fIdx)).SetString(value)
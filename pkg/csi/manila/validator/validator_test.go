@@ -194,6 +194,22 @@ func TestMatches(t *testing.T) {
 	}
 }
 
+func TestNonStringField(t *testing.T) {
+	type s struct {
+		A []string `name:"a" value:"optional"`
+	}
+
+	v := New(&s{})
+
+	if v.Populate(map[string]string{}, &s{}) != nil {
+		t.Error(`non-string field should be permitted when missing`)
+	}
+
+	if v.Populate(map[string]string{"a": "xxx"}, &s{}) == nil {
+		t.Error(`non-string field should fail when present`)
+	}
+}
+
 func TestFieldNames(t *testing.T) {
 	type s struct {
 		A string `name:"a"`
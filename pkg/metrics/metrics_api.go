@@ -18,6 +18,7 @@ package metrics
 
 import (
 	"sync"
+	"time"
 
 	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/legacyregistry"
@@ -41,6 +42,26 @@ var (
 				Help: "Total number of errors for an OpenStack API call",
 			}, []string{"request"}),
 	}
+
+	loadBalancerStatusPollInterval = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:    "openstack_loadbalancer_status_poll_interval_seconds",
+			Help:    "Interval before the next poll of the provisioning status of a load balancer waited for, by the last polled status",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60},
+		}, []string{"provisioning_status"})
+
+	apiRequestAttempts = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:    "openstack_api_request_attempts",
+			Help:    "Number of attempts of an OpenStack API call retried on transient errors, by the result of the last one",
+			Buckets: []float64{1, 2, 3, 4, 5, 8, 10},
+		}, []string{"request", "result"})
+
+	apiCircuitBreakerRejections = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "openstack_api_circuit_breaker_rejections_total",
+			Help: "Total number of OpenStack API calls failed right away while the API keeps failing",
+		}, []string{"request"})
 )
 
 // ObserveRequest records the request latency and counts the errors.
@@ -48,6 +69,27 @@ func (mc *MetricContext) ObserveRequest(err error) error {
 	return mc.Observe(APIRequestMetrics, err)
 }
 
+// ObserveRequestAttempts records the number of attempts of a request retried on transient errors, and whether the last
+// one succeeded.
+func ObserveRequestAttempts(request string, attempts int, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	apiRequestAttempts.WithLabelValues(request, result).Observe(float64(attempts))
+}
+
+// ObserveCircuitBreakerRejection counts a request failed right away while the API keeps failing.
+func ObserveCircuitBreakerRejection(request string) {
+	apiCircuitBreakerRejections.WithLabelValues(request).Inc()
+}
+
+// ObserveLoadBalancerStatusPoll records the interval chosen before polling again a load balancer in the given
+// provisioning status.
+func ObserveLoadBalancerStatusPoll(status string, interval time.Duration) {
+	loadBalancerStatusPollInterval.WithLabelValues(status).Observe(interval.Seconds())
+}
+
 var registerAPIMetrics sync.Once
 
 // RegisterMetrics registers OpenStack metrics.
@@ -57,6 +99,9 @@ func doRegisterAPIMetrics() {
 			APIRequestMetrics.Duration,
 			APIRequestMetrics.Total,
 			APIRequestMetrics.Errors,
+			loadBalancerStatusPollInterval,
+			apiRequestAttempts,
+			apiCircuitBreakerRejections,
 		)
 	})
 }
@@ -42,6 +42,18 @@ var (
 				Help: "Total number of OpenStack cloud controller manager reconciliation errors",
 			}, []string{"operation"}),
 	}
+
+	occmReconcileErrorClasses = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "cloudprovider_openstack_reconcile_error_classes_total",
+			Help: "Total number of OpenStack cloud controller manager reconciliation errors by class, transient or terminal",
+		}, []string{"operation", "class"})
+
+	occmLoadBalancerResources = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "cloudprovider_openstack_loadbalancer_resources",
+			Help: "Number of the Octavia listeners, pools and members of the load balancer of a Service",
+		}, []string{"namespace", "service", "resource"})
 )
 
 // ObserveReconcile records the request reconciliation duration
@@ -49,6 +61,26 @@ func (mc *MetricContext) ObserveReconcile(err error) error {
 	return mc.Observe(occmReconcileMetrics, err)
 }
 
+// ObserveReconcileErrorClass counts a reconciliation error of the given class
+func (mc *MetricContext) ObserveReconcileErrorClass(class string) {
+	labels := append(append([]string{}, mc.Attributes...), class)
+	occmReconcileErrorClasses.WithLabelValues(labels...).Inc()
+}
+
+// SetLoadBalancerResources records the number of listeners, pools and members of the load balancer of a Service
+func SetLoadBalancerResources(namespace, service string, listeners, pools, members int) {
+	occmLoadBalancerResources.WithLabelValues(namespace, service, "listener").Set(float64(listeners))
+	occmLoadBalancerResources.WithLabelValues(namespace, service, "pool").Set(float64(pools))
+	occmLoadBalancerResources.WithLabelValues(namespace, service, "member").Set(float64(members))
+}
+
+// DeleteLoadBalancerResources drops the resources of the load balancer of a Service, once it's deleted
+func DeleteLoadBalancerResources(namespace, service string) {
+	for _, resource := range []string{"listener", "pool", "member"} {
+		occmLoadBalancerResources.Delete(map[string]string{"namespace": namespace, "service": service, "resource": resource})
+	}
+}
+
 var registerOccmMetrics sync.Once
 
 // RegisterMetrics registers OpenStack metrics.
@@ -58,6 +90,8 @@ func doRegisterOccmMetrics() {
 			occmReconcileMetrics.Duration,
 			occmReconcileMetrics.Total,
 			occmReconcileMetrics.Errors,
+			occmReconcileErrorClasses,
+			occmLoadBalancerResources,
 		)
 	})
 }
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+)
+
+// Reasons of the events emitted on the Services
+const (
+	eventLBConfigConflict       = "LoadBalancerConfigConflict"
+	eventLBDriftHealed          = "LoadBalancerDriftHealed"
+	eventLBFloatingIPAllocated  = "LoadBalancerFloatingIPAllocated"
+	eventLBFloatingIPDrift      = "LoadBalancerFloatingIPDrift"
+	eventLBFloatingIPReused     = "LoadBalancerFloatingIPReused"
+	eventLBHealthMonitorInvalid = "LoadBalancerHealthMonitorInvalid"
+	eventLBIPConflict           = "LoadBalancerIPConflict"
+	eventLBMemberDown           = "LoadBalancerMemberDown"
+	eventLBMemberLimit          = "LoadBalancerMemberLimit"
+	eventLBMemberUp             = "LoadBalancerMemberUp"
+	eventLBNoEligibleNodes      = "LoadBalancerNoEligibleNodes"
+	eventLBOperatingStatus      = "LoadBalancerOperatingStatus"
+	eventLBOrphansDeleted       = "LoadBalancerOrphansDeleted"
+	eventLBReleased             = "LoadBalancerReleased"
+	eventLBSourceRangesIgnored  = "LoadBalancerSourceRangesIgnored"
+	eventLBTerminalError        = "LoadBalancerTerminalError"
+)
+
+// maxEventThrottleInterval is the longest identical events are throttled for, unless event-throttle-interval is longer.
+const maxEventThrottleInterval = time.Hour
+
+// throttledEventRecorder drops the events identical to the ones recently emitted on the same object, so that an error
+// hit on every reconcile doesn't flood the events. An identical event is dropped for event-throttle-interval after it's
+// emitted and the interval doubles every time it's emitted again, up to maxEventThrottleInterval.
+type throttledEventRecorder struct {
+	record.EventRecorder
+	backoff *flowcontrol.Backoff
+}
+
+// newThrottledEventRecorder throttles the events of the recorder, it's returned as is if the interval is 0.
+func newThrottledEventRecorder(recorder record.EventRecorder, interval time.Duration) record.EventRecorder {
+	if interval <= 0 {
+		return recorder
+	}
+	maxInterval := maxEventThrottleInterval
+	if interval > maxInterval {
+		maxInterval = interval
+	}
+	return &throttledEventRecorder{EventRecorder: recorder, backoff: flowcontrol.NewBackOff(interval, maxInterval)}
+}
+
+// throttled tells if the event was emitted recently and should be dropped, otherwise it records it's being emitted.
+func (r *throttledEventRecorder) throttled(object runtime.Object, eventtype, reason, message string) bool {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return false
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s/%s/%s", accessor.GetNamespace(), accessor.GetName(), accessor.GetUID(), eventtype, reason, message)
+
+	r.backoff.GC()
+	now := r.backoff.Clock.Now()
+	if r.backoff.IsInBackOffSinceUpdate(key, now) {
+		klog.V(4).InfoS("Dropping repeated event", "object", klog.KObj(accessor), "reason", reason, "message", message)
+		return true
+	}
+	r.backoff.Next(key, now)
+	return false
+}
+
+func (r *throttledEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if !r.throttled(object, eventtype, reason, message) {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *throttledEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *throttledEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if !r.throttled(object, eventtype, reason, message) {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestThrottledEventRecorder(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := newThrottledEventRecorder(fakeRecorder, time.Minute).(*throttledEventRecorder)
+	clock := testingclock.NewFakeClock(time.Now())
+	recorder.backoff.Clock = clock
+
+	web := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web-uid"}}
+	db := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db", UID: "db-uid"}}
+	emit := func(service *corev1.Service, message string) {
+		recorder.Event(service, corev1.EventTypeWarning, eventLBHealthMonitorInvalid, message)
+	}
+	emitted := func() int {
+		n := len(fakeRecorder.Events)
+		for i := 0; i < n; i++ {
+			<-fakeRecorder.Events
+		}
+		return n
+	}
+
+	emit(web, "invalid delay")
+	emit(web, "invalid delay")
+	assert.Equal(t, 1, emitted(), "identical event should be dropped")
+
+	emit(web, "invalid timeout")
+	emit(db, "invalid delay")
+	assert.Equal(t, 2, emitted(), "events with another message or object should be emitted")
+
+	clock.Step(61 * time.Second)
+	emit(web, "invalid delay")
+	assert.Equal(t, 1, emitted(), "identical event should be emitted again after the interval")
+
+	clock.Step(61 * time.Second)
+	emit(web, "invalid delay")
+	assert.Equal(t, 0, emitted(), "interval should double after the event is emitted again")
+
+	clock.Step(61 * time.Second)
+	emit(web, "invalid delay")
+	assert.Equal(t, 1, emitted())
+}
+
+func TestThrottledEventRecorderDisabled(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	assert.Equal(t, fakeRecorder, newThrottledEventRecorder(fakeRecorder, 0))
+}
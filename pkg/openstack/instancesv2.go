@@ -27,15 +27,17 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/cloud-provider-openstack/pkg/util"
 	"k8s.io/cloud-provider-openstack/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
 // InstancesV2 encapsulates an implementation of InstancesV2 for OpenStack.
 type InstancesV2 struct {
-	compute          *gophercloud.ServiceClient
-	network          *gophercloud.ServiceClient
-	region           string
+	// compute and network have the clients of each region
+	compute          map[string]*gophercloud.ServiceClient
+	network          map[string]*gophercloud.ServiceClient
+	regions          []string
 	regionProviderID bool
 	networkingOpts   NetworkingOpts
 }
@@ -51,27 +53,36 @@ func (os *OpenStack) InstancesV2() (cloudprovider.InstancesV2, bool) {
 func (os *OpenStack) instancesv2() (*InstancesV2, bool) {
 	klog.V(4).Info("openstack.Instancesv2() called")
 
-	compute, err := client.NewComputeV2(os.provider, os.epOpts)
-	if err != nil {
-		klog.Errorf("unable to access compute v2 API : %v", err)
-		return nil, false
-	}
+	compute := make(map[string]*gophercloud.ServiceClient, len(os.regions))
+	network := make(map[string]*gophercloud.ServiceClient, len(os.regions))
+	for _, region := range os.regions {
+		var err error
+		compute[region], err = client.NewComputeV2(os.provider, os.regionEpOpts(region))
+		if err != nil {
+			klog.Errorf("unable to access compute v2 API : %v", err)
+			return nil, false
+		}
 
-	network, err := client.NewNetworkV2(os.provider, os.epOpts)
-	if err != nil {
-		klog.Errorf("unable to access network v2 API : %v", err)
-		return nil, false
+		network[region], err = client.NewNetworkV2(os.provider, os.regionEpOpts(region))
+		if err != nil {
+			klog.Errorf("unable to access network v2 API : %v", err)
+			return nil, false
+		}
 	}
 
 	regionalProviderID := false
 	if isRegionalProviderID := sysos.Getenv(RegionalProviderIDEnv); isRegionalProviderID == "true" {
 		regionalProviderID = true
 	}
+	// The instances would have to be looked for in all the regions otherwise.
+	if len(os.regions) > 1 {
+		regionalProviderID = true
+	}
 
 	return &InstancesV2{
 		compute:          compute,
 		network:          network,
-		region:           os.epOpts.Region,
+		regions:          os.regions,
 		regionProviderID: regionalProviderID,
 		networkingOpts:   os.networkingOpts,
 	}, true
@@ -79,7 +90,7 @@ func (os *OpenStack) instancesv2() (*InstancesV2, bool) {
 
 // InstanceExists indicates whether a given node exists according to the cloud provider
 func (i *InstancesV2) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
-	_, err := i.getInstance(ctx, node)
+	_, _, err := i.getInstance(ctx, node)
 	if err == cloudprovider.InstanceNotFound {
 		klog.V(6).Infof("instance not found for node: %s", node.Name)
 		return false, nil
@@ -94,7 +105,7 @@ func (i *InstancesV2) InstanceExists(ctx context.Context, node *v1.Node) (bool,
 
 // InstanceShutdown returns true if the instance is shutdown according to the cloud provider.
 func (i *InstancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
-	server, err := i.getInstance(ctx, node)
+	server, _, err := i.getInstance(ctx, node)
 	if err != nil {
 		return false, err
 	}
@@ -109,7 +120,7 @@ func (i *InstancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool
 
 // InstanceMetadata returns the instance's metadata.
 func (i *InstancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	srv, err := i.getInstance(ctx, node)
+	srv, region, err := i.getInstance(ctx, node)
 	if err != nil {
 		return nil, err
 	}
@@ -118,74 +129,71 @@ func (i *InstancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*clo
 		server = *srv
 	}
 
-	instanceType, err := srvInstanceType(i.compute, &server.Server)
+	instanceType, err := srvInstanceType(i.compute[region], &server.Server)
 	if err != nil {
 		return nil, err
 	}
 
-	ports, err := getAttachedPorts(i.network, server.ID)
+	ports, err := getAttachedPorts(i.network[region], server.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	addresses, err := nodeAddresses(&server.Server, ports, i.network, i.networkingOpts)
+	addresses, err := nodeAddresses(&server.Server, ports, i.network[region], i.networkingOpts)
 	if err != nil {
 		return nil, err
 	}
 
 	return &cloudprovider.InstanceMetadata{
-		ProviderID:    i.makeInstanceID(&server.Server),
+		ProviderID:    i.makeInstanceID(&server.Server, region),
 		InstanceType:  instanceType,
 		NodeAddresses: addresses,
 		Zone:          server.AvailabilityZone,
-		Region:        i.region,
+		Region:        region,
 	}, nil
 }
 
-func (i *InstancesV2) makeInstanceID(srv *servers.Server) string {
+func (i *InstancesV2) makeInstanceID(srv *servers.Server, region string) string {
 	if i.regionProviderID {
-		return fmt.Sprintf("%s://%s/%s", ProviderName, i.region, srv.ID)
+		return fmt.Sprintf("%s://%s/%s", ProviderName, region, srv.ID)
 	}
 	return fmt.Sprintf("%s:///%s", ProviderName, srv.ID)
 }
 
-func (i *InstancesV2) getInstance(ctx context.Context, node *v1.Node) (*ServerAttributesExt, error) {
+// getInstance returns the server of the node along with its region. The nodes without a ProviderID, or with one
+// without a region, are looked for in all the regions.
+func (i *InstancesV2) getInstance(ctx context.Context, node *v1.Node) (*ServerAttributesExt, string, error) {
 	if node.Spec.ProviderID == "" {
-		opt := servers.ListOpts{
-			Name: fmt.Sprintf("^%s$", node.Name),
-		}
-		mc := metrics.NewMetricContext("server", "list")
-		allPages, err := servers.List(i.compute, opt).AllPages()
-		if mc.ObserveRequest(err) != nil {
-			return nil, fmt.Errorf("error listing servers %v: %v", opt, err)
-		}
-
-		serverList := []ServerAttributesExt{}
-		err = servers.ExtractServersInto(allPages, &serverList)
-		if err != nil {
-			return nil, fmt.Errorf("error extracting servers from pages: %v", err)
-		}
-		if len(serverList) == 0 {
-			return nil, cloudprovider.InstanceNotFound
-		}
-		if len(serverList) > 1 {
-			return nil, fmt.Errorf("getInstance: multiple instances found")
-		}
-		return &serverList[0], nil
+		return i.getInstanceByName(node.Name)
 	}
 
 	instanceID, instanceRegion, err := instanceIDFromProviderID(node.Spec.ProviderID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	if instanceRegion != "" && instanceRegion != i.region {
-		return nil, fmt.Errorf("ProviderID \"%s\" didn't match supported region \"%s\"", node.Spec.ProviderID, i.region)
+	if instanceRegion != "" {
+		if !util.Contains(i.regions, instanceRegion) {
+			return nil, "", fmt.Errorf("ProviderID \"%s\" didn't match supported regions %v", node.Spec.ProviderID, i.regions)
+		}
+		server, err := i.getInstanceByID(instanceRegion, instanceID)
+		return server, instanceRegion, err
+	}
+
+	for _, region := range i.regions {
+		server, err := i.getInstanceByID(region, instanceID)
+		if err == cloudprovider.InstanceNotFound {
+			continue
+		}
+		return server, region, err
 	}
+	return nil, "", cloudprovider.InstanceNotFound
+}
 
+func (i *InstancesV2) getInstanceByID(region, instanceID string) (*ServerAttributesExt, error) {
 	server := ServerAttributesExt{}
 	mc := metrics.NewMetricContext("server", "get")
-	err = servers.Get(i.compute, instanceID).ExtractInto(&server)
+	err := servers.Get(i.compute[region], instanceID).ExtractInto(&server)
 	if mc.ObserveRequest(err) != nil {
 		if errors.IsNotFound(err) {
 			return nil, cloudprovider.InstanceNotFound
@@ -194,3 +202,36 @@ func (i *InstancesV2) getInstance(ctx context.Context, node *v1.Node) (*ServerAt
 	}
 	return &server, nil
 }
+
+func (i *InstancesV2) getInstanceByName(name string) (*ServerAttributesExt, string, error) {
+	opt := servers.ListOpts{
+		Name: fmt.Sprintf("^%s$", name),
+	}
+
+	var found *ServerAttributesExt
+	foundRegion := ""
+	for _, region := range i.regions {
+		mc := metrics.NewMetricContext("server", "list")
+		allPages, err := servers.List(i.compute[region], opt).AllPages()
+		if mc.ObserveRequest(err) != nil {
+			return nil, "", fmt.Errorf("error listing servers %v: %v", opt, err)
+		}
+
+		serverList := []ServerAttributesExt{}
+		err = servers.ExtractServersInto(allPages, &serverList)
+		if err != nil {
+			return nil, "", fmt.Errorf("error extracting servers from pages: %v", err)
+		}
+		if len(serverList) == 0 {
+			continue
+		}
+		if len(serverList) > 1 || found != nil {
+			return nil, "", fmt.Errorf("getInstance: multiple instances found")
+		}
+		found, foundRegion = &serverList[0], region
+	}
+	if found == nil {
+		return nil, "", cloudprovider.InstanceNotFound
+	}
+	return found, foundRegion, nil
+}
@@ -19,11 +19,15 @@ package openstack
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/keymanager/v1/containers"
@@ -40,9 +44,13 @@ import (
 	secgroups "github.com/gophercloud/utils/openstack/networking/v2/extensions/security/groups"
 	"gopkg.in/godo.v2/glob"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	netutils "k8s.io/utils/net"
@@ -85,20 +93,87 @@ const (
 	ServiceAnnotationLoadBalancerXForwardedFor        = "loadbalancer.openstack.org/x-forwarded-for"
 	ServiceAnnotationLoadBalancerFlavorID             = "loadbalancer.openstack.org/flavor-id"
 	ServiceAnnotationLoadBalancerAvailabilityZone     = "loadbalancer.openstack.org/availability-zone"
+	ServiceAnnotationLoadBalancerVipQosPolicyID       = "loadbalancer.openstack.org/vip-qos-policy-id"
+	// ServiceAnnotationLoadBalancerFloatingIPQosPolicyID is the Neutron QoS policy of the floating IP of the load
+	// balancer, limiting the external traffic only, unlike the QoS policy of the VIP port.
+	ServiceAnnotationLoadBalancerFloatingIPQosPolicyID = "loadbalancer.openstack.org/fip-qos-policy-id"
+	// ServiceAnnotationLoadBalancerRegion is the region of the load balancer when several regions are configured. If not
+	// set, it's set to the region the load balancer gets created in.
+	ServiceAnnotationLoadBalancerRegion = "loadbalancer.openstack.org/region"
+	// ServiceAnnotationLoadBalancerSessionPersistence overrides the session persistence derived from the Service's
+	// sessionAffinity, it accepts "SOURCE_IP", "HTTP_COOKIE", "APP_COOKIE:<cookie name>" or "none".
+	ServiceAnnotationLoadBalancerSessionPersistence = "loadbalancer.openstack.org/session-persistence"
 	// ServiceAnnotationLoadBalancerEnableHealthMonitor defines whether to create health monitor for the load balancer
 	// pool, if not specified, use 'create-monitor' config. The health monitor can be created or deleted dynamically.
-	ServiceAnnotationLoadBalancerEnableHealthMonitor     = "loadbalancer.openstack.org/enable-health-monitor"
-	ServiceAnnotationLoadBalancerHealthMonitorDelay      = "loadbalancer.openstack.org/health-monitor-delay"
-	ServiceAnnotationLoadBalancerHealthMonitorTimeout    = "loadbalancer.openstack.org/health-monitor-timeout"
-	ServiceAnnotationLoadBalancerHealthMonitorMaxRetries = "loadbalancer.openstack.org/health-monitor-max-retries"
-	ServiceAnnotationLoadBalancerLoadbalancerHostname    = "loadbalancer.openstack.org/hostname"
-	ServiceAnnotationLoadBalancerAddress                 = "loadbalancer.openstack.org/load-balancer-address"
+	ServiceAnnotationLoadBalancerEnableHealthMonitor         = "loadbalancer.openstack.org/enable-health-monitor"
+	ServiceAnnotationLoadBalancerHealthMonitorDelay          = "loadbalancer.openstack.org/health-monitor-delay"
+	ServiceAnnotationLoadBalancerHealthMonitorTimeout        = "loadbalancer.openstack.org/health-monitor-timeout"
+	ServiceAnnotationLoadBalancerHealthMonitorMaxRetries     = "loadbalancer.openstack.org/health-monitor-max-retries"
+	ServiceAnnotationLoadBalancerHealthMonitorMaxRetriesDown = "loadbalancer.openstack.org/health-monitor-max-retries-down"
+	ServiceAnnotationLoadBalancerLoadbalancerHostname        = "loadbalancer.openstack.org/hostname"
+	ServiceAnnotationLoadBalancerAddress                     = "loadbalancer.openstack.org/load-balancer-address"
+	// ServiceAnnotationLoadBalancerSharedPoolGroups maps Service port names to group names, e.g. "http=web,https=web".
+	// Listeners of the ports in the same group share a single pool, members of which use the node port of the first
+	// port of the group.
+	ServiceAnnotationLoadBalancerSharedPoolGroups = "loadbalancer.openstack.org/shared-pool-groups"
+	// ServiceAnnotationLoadBalancerMemberPorts maps Service port names to the port the members listen on instead of the
+	// node port, e.g. "http=8080,https=8443". A port without name, e.g. "8080", applies to the ports not listed.
+	ServiceAnnotationLoadBalancerMemberPorts = "loadbalancer.openstack.org/member-ports"
+	// ServiceAnnotationLoadBalancerAdminState sets the administrative state of the load balancer and of the listeners
+	// of the Service to "up" or "down". Without it, the administrative state is left as is.
+	ServiceAnnotationLoadBalancerAdminState = "loadbalancer.openstack.org/admin-state"
+	// ServiceAnnotationLoadBalancerVIPAllowedAddressPairs sets the allowed address pairs of the VIP port to the comma
+	// separated IP addresses and CIDRs, e.g. "10.0.0.10,10.0.1.0/24". Without it, they are left as is.
+	ServiceAnnotationLoadBalancerVIPAllowedAddressPairs = "loadbalancer.openstack.org/vip-allowed-address-pairs"
+	// ServiceAnnotationLoadBalancerL7PathRoutes sends the requests whose path starts with a prefix to the members of
+	// another Service port, e.g. "http:/api=api" sends the requests of the listener of port "http" starting with /api to
+	// the members of port "api". The listener has to use the HTTP or TERMINATED_HTTPS protocol.
+	ServiceAnnotationLoadBalancerL7PathRoutes = "loadbalancer.openstack.org/l7-path-routes"
+	// ServiceAnnotationLoadBalancerVIPAddress requests the address of the load balancer, like the deprecated
+	// spec.loadBalancerIP it takes precedence over: the VIP address of an internal load balancer or the floating IP of
+	// an external one. An existing unassigned floating IP with that address is associated rather than a new one created.
+	ServiceAnnotationLoadBalancerVIPAddress = "loadbalancer.openstack.org/vip-address"
+	// ServiceAnnotationLoadBalancerHostnameIncludeIP keeps the address of the load balancer in the status of the
+	// Service along with the hostname set with loadbalancer.openstack.org/hostname, instead of replacing it.
+	ServiceAnnotationLoadBalancerHostnameIncludeIP = "loadbalancer.openstack.org/hostname-include-ip"
+	// ServiceAnnotationLoadBalancerHostnameFromPTRRecord sets the hostname in the status of the Service to the domain
+	// name of the Designate record set with loadbalancer.openstack.org/floating-ip-ptr-record, instead of setting it
+	// with loadbalancer.openstack.org/hostname.
+	ServiceAnnotationLoadBalancerHostnameFromPTRRecord = "loadbalancer.openstack.org/hostname-from-ptr-record"
+	// ServiceAnnotationLoadBalancerIncludeVIPAddress reports the VIP address of an external load balancer in the status
+	// of the Service after its floating IP, for the clients reaching the load balancer from the internal networks.
+	ServiceAnnotationLoadBalancerIncludeVIPAddress = "loadbalancer.openstack.org/include-vip-address"
+	// ServiceAnnotationLoadBalancerNotReadyMembers keeps the members of a Service whose endpoints exist but aren't
+	// ready yet with weight 0 instead of removing them, they get their weight back once an endpoint is ready.
+	ServiceAnnotationLoadBalancerNotReadyMembers = "loadbalancer.openstack.org/not-ready-members"
+	// ServiceAnnotationLoadBalancerProfile applies the annotations of the [LoadBalancerProfile] section of the name to
+	// the Service, the annotations set on the Service win over them.
+	ServiceAnnotationLoadBalancerProfile = "loadbalancer.openstack.org/profile"
+	// ServiceAnnotationLoadBalancerBlueprint applies the settings of the LBBlueprint custom resource of the name to the
+	// Service, the annotations set on the Service win over them. It requires enable-blueprints.
+	ServiceAnnotationLoadBalancerBlueprint = "loadbalancer.openstack.org/blueprint"
+	// ServiceAnnotationLoadBalancerTags adds the comma separated tags to the load balancer, along with the ones of the
+	// Service set by the controller, e.g. "team=web,cost-center=42". The tags are removed when dropped from it.
+	ServiceAnnotationLoadBalancerTags = "loadbalancer.openstack.org/tags"
+	// ServiceAnnotationLoadBalancerXForwardedForClientHeader tells what the listeners do with the X-Forwarded-For header
+	// sent by the clients when x-forwarded-for is set: "append" (default) keeps it and appends the client address seen
+	// by the load balancer, "reject" rejects the requests carrying it so that the backends only get the address set by
+	// the load balancer.
+	ServiceAnnotationLoadBalancerXForwardedForClientHeader = "loadbalancer.openstack.org/x-forwarded-for-client-header"
+	// ServiceAnnotationLoadBalancerAntiAffinityGroup spreads the load balancers of the Services of the same group across
+	// the availability zones of anti-affinity-availability-zones, the load balancer is created in the zone holding the
+	// fewest load balancers of the group. It requires anti-affinity-availability-zones.
+	ServiceAnnotationLoadBalancerAntiAffinityGroup = "loadbalancer.openstack.org/anti-affinity-group"
+	// ServiceAnnotationLoadBalancerFloatingIPPTRRecord sets the PTR record of the floating IP of the Service to the
+	// domain name, e.g. "mail.example.com", through Designate. The record is removed when the Service is deleted.
+	ServiceAnnotationLoadBalancerFloatingIPPTRRecord = "loadbalancer.openstack.org/floating-ip-ptr-record"
 	// revive:disable:var-naming
 	ServiceAnnotationTlsContainerRef = "loadbalancer.openstack.org/default-tls-container-ref"
 	// revive:enable:var-naming
 	// See https://nip.io
 	defaultProxyHostnameSuffix      = "nip.io"
 	ServiceAnnotationLoadBalancerID = "loadbalancer.openstack.org/load-balancer-id"
+	defaultDescriptionTemplate      = "Kubernetes external service {{.Namespace}}/{{.Name}} from cluster {{.ClusterName}}"
 )
 
 // LbaasV2 is a LoadBalancer implementation based on Octavia
@@ -324,33 +399,53 @@ func tagList(tags string) ([]string, bool, bool) {
 
 // serviceConfig contains configurations for creating a Service.
 type serviceConfig struct {
-	internal                bool
-	connLimit               int
-	configClassName         string
-	lbNetworkID             string
-	lbSubnetID              string
-	lbMemberSubnetID        string
-	lbPublicNetworkID       string
-	lbPublicSubnetSpec      *floatingSubnetSpec
-	keepClientIP            bool
-	enableProxyProtocol     bool
-	timeoutClientData       int
-	timeoutMemberConnect    int
-	timeoutMemberData       int
-	timeoutTCPInspect       int
-	allowedCIDR             []string
-	enableMonitor           bool
-	flavorID                string
-	availabilityZone        string
-	tlsContainerRef         string
-	lbID                    string
-	lbName                  string
-	supportLBTags           bool
-	healthCheckNodePort     int
-	healthMonitorDelay      int
-	healthMonitorTimeout    int
-	healthMonitorMaxRetries int
-	preferredIPFamily       corev1.IPFamily // preferred (the first) IP family indicated in service's `spec.ipFamilies`
+	internal                    bool
+	configClassName             string
+	lbNetworkID                 string
+	lbSubnetID                  string
+	lbMemberSubnetID            string
+	lbPublicNetworkID           string
+	lbPublicSubnetSpec          *floatingSubnetSpec
+	keepClientIP                bool
+	rejectClientXForwardedFor   bool // whether the listeners reject the requests with an X-Forwarded-For header
+	enableProxyProtocol         bool
+	listenerOpts                ListenerOpts
+	allowedCIDR                 []string
+	securityGroupCIDRs          []string
+	noReadyEndpoints            bool
+	keepMembersWithoutNodes     bool // whether the members are kept while no node is eligible, see no-nodes-behavior
+	notReadyMembers             bool
+	enableMonitor               bool
+	flavorID                    string
+	availabilityZone            string
+	preferredMemberZone         string // zone of the members preferred with topology aware routing, the others are backups
+	antiAffinityGroup           string // group of Services whose load balancers are spread across availability zones
+	tlsContainerRef             string
+	lbID                        string
+	lbName                      string
+	supportLBTags               bool
+	tags                        []string // tags of the load balancer, listeners and pools, see getResourceTags
+	customTags                  []string // tags of the load balancer set with loadbalancer.openstack.org/tags
+	healthCheckNodePort         int
+	healthMonitorDelay          int
+	healthMonitorTimeout        int
+	healthMonitorMaxRetries     int
+	healthMonitorMaxRetriesDown int
+	preferredIPFamily           corev1.IPFamily   // preferred (the first) IP family indicated in service's `spec.ipFamilies`
+	poolGroups                  map[string]string // Service port name to the name of the group of ports sharing a pool
+	memberPorts                 map[string]int    // Service port name to the port of the members, if not the node port
+	adminStateUp                *bool             // administrative state of the load balancer and listeners, nil to leave it as is
+	sessionPersistence          *openstackutil.SessionPersistence
+	description                 string                      // description of the load balancer, listeners and pools
+	vipQosPolicyID              string                      // Neutron QoS policy applied to the VIP port
+	fipQosPolicyID              string                      // Neutron QoS policy applied to the floating IP
+	vipAllowedAddressPairs      *[]neutronports.AddressPair // allowed address pairs of the VIP port, nil to leave them as is
+	l7Routes                    []l7Route                   // L7 routes of the listeners, sorted from the longest path prefix
+	ingressHostname             string                      // hostname set in the status of the Service
+	ingressHostnameIncludeIP    bool                        // whether the address is kept in the status along with the hostname
+	includeVIPAddress           bool                        // whether the VIP is reported in the status after the floating IP
+	fipPTRRecord                string                      // domain name of the PTR record of the floating IP
+	memberMoves                 *pendingMemberMoves         // members of the nodes changing address not moved yet
 }
 
 type listenerKey struct {
@@ -358,8 +453,9 @@ type listenerKey struct {
 	Port     int
 }
 
-// getLoadbalancerByName get the load balancer which is in valid status by the given name/legacy name.
-func getLoadbalancerByName(client *gophercloud.ServiceClient, name string, legacyName string) (*loadbalancers.LoadBalancer, error) {
+// getLoadbalancerByName get the load balancer which is in valid status by the given name, or else by the legacy name
+// and the name given by the previous releases.
+func getLoadbalancerByName(client *gophercloud.ServiceClient, name string, fallbackNames ...string) (*loadbalancers.LoadBalancer, error) {
 	var validLBs []loadbalancers.LoadBalancer
 
 	opts := loadbalancers.ListOpts{
@@ -370,20 +466,25 @@ func getLoadbalancerByName(client *gophercloud.ServiceClient, name string, legac
 		return nil, err
 	}
 
-	if len(allLoadbalancers) == 0 {
-		if len(legacyName) > 0 {
-			// Backoff to get load balnacer by legacy name.
-			opts := loadbalancers.ListOpts{
-				Name: legacyName,
-			}
-			allLoadbalancers, err = openstackutil.GetLoadBalancers(client, opts)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, cpoerrors.ErrNotFound
+	for _, fallbackName := range fallbackNames {
+		if len(allLoadbalancers) > 0 {
+			break
+		}
+		if len(fallbackName) == 0 {
+			continue
+		}
+		// Backoff to get load balancer by the names it may have been given before.
+		opts := loadbalancers.ListOpts{
+			Name: fallbackName,
+		}
+		allLoadbalancers, err = openstackutil.GetLoadBalancers(client, opts)
+		if err != nil {
+			return nil, err
 		}
 	}
+	if len(allLoadbalancers) == 0 {
+		return nil, cpoerrors.ErrNotFound
+	}
 
 	for _, lb := range allLoadbalancers {
 		// All the ProvisioningStatus could be found here https://developer.openstack.org/api-ref/load-balancer/v2/index.html#provisioning-status-codes
@@ -454,22 +555,40 @@ func getListenerProtocol(protocol corev1.Protocol, svcConf *serviceConfig) liste
 func (lbaas *LbaasV2) createOctaviaLoadBalancer(name, clusterName string, service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) (*loadbalancers.LoadBalancer, error) {
 	createOpts := loadbalancers.CreateOpts{
 		Name:        name,
-		Description: fmt.Sprintf("Kubernetes external service %s/%s from cluster %s", service.Namespace, service.Name, clusterName),
+		Description: svcConf.description,
 		Provider:    lbaas.opts.LBProvider,
 	}
 
 	if svcConf.supportLBTags {
-		createOpts.Tags = []string{svcConf.lbName}
+		createOpts.Tags, _ = syncCustomTags(svcConf.tags, svcConf.customTags)
 	}
 
 	if svcConf.flavorID != "" {
 		createOpts.FlavorID = svcConf.flavorID
 	}
 
+	if svcConf.antiAffinityGroup != "" {
+		createOpts.Tags, _ = syncAntiAffinityGroupTag(createOpts.Tags, svcConf.antiAffinityGroup)
+		// An availability zone set on the Service wins, the load balancer still counts in its group.
+		if service.Annotations[ServiceAnnotationLoadBalancerAvailabilityZone] == "" {
+			availabilityZone, err := lbaas.getAntiAffinityAvailabilityZone(clusterName, svcConf.antiAffinityGroup)
+			if err != nil {
+				return nil, err
+			}
+			svcConf.availabilityZone = availabilityZone
+		}
+	}
+
 	if svcConf.availabilityZone != "" {
 		createOpts.AvailabilityZone = svcConf.availabilityZone
 	}
 
+	if svcConf.vipQosPolicyID != "" {
+		createOpts.VipQosPolicyID = svcConf.vipQosPolicyID
+	}
+
+	createOpts.AdminStateUp = svcConf.adminStateUp
+
 	vipPort := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerPortID, "")
 	lbClass := lbaas.opts.LBClasses[svcConf.configClassName]
 
@@ -492,12 +611,19 @@ func (lbaas *LbaasV2) createOctaviaLoadBalancer(name, clusterName string, servic
 	}
 
 	// For external load balancer, the LoadBalancerIP is a public IP address.
-	loadBalancerIP := service.Spec.LoadBalancerIP
+	loadBalancerIP := getLoadBalancerIP(service)
 	if loadBalancerIP != "" && svcConf.internal {
 		createOpts.VipAddress = loadBalancerIP
 	}
 
-	if !lbaas.opts.ProviderRequiresSerialAPICalls {
+	if vipPort == "" && lbaas.opts.VIPRetentionPeriod.Duration > 0 {
+		if err := lbaas.claimRetainedVIPPort(name, &createOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fully populated load balancers can't have pools shared by listeners, these get created in ensureOctaviaLoadBalancer.
+	if !lbaas.opts.ProviderRequiresSerialAPICalls && len(svcConf.poolGroups) == 0 {
 		for portIndex, port := range service.Spec.Ports {
 			listenerCreateOpt := lbaas.buildListenerCreateOpt(port, svcConf)
 			listenerCreateOpt.Name = cpoutil.CutString255(fmt.Sprintf("listener_%d_%s", portIndex, name))
@@ -530,7 +656,7 @@ func (lbaas *LbaasV2) createOctaviaLoadBalancer(name, clusterName string, servic
 		if opts, err := json.Marshal(createOpts); err == nil {
 			printObj = string(opts)
 		}
-		return nil, fmt.Errorf("error creating loadbalancer %v: %v", printObj, err)
+		return nil, fmt.Errorf("error creating loadbalancer %v: %w", printObj, err)
 	}
 
 	// In case subnet ID is not configured
@@ -555,16 +681,33 @@ func (lbaas *LbaasV2) createOctaviaLoadBalancer(name, clusterName string, servic
 
 // GetLoadBalancer returns whether the specified load balancer exists and its status
 func (lbaas *LbaasV2) GetLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service) (*corev1.LoadBalancerStatus, bool, error) {
+	// The service controller gets the load balancer before deleting it, possibly after the namespace is gone.
+	svc, err := lbaas.applyServiceDefaults(service)
+	if apierrors.IsNotFound(err) || errors.Is(err, errUnknownProfile) || errors.Is(err, errUnknownBlueprint) {
+		svc, err = service, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	service = svc
+	// The load balancers of the other classes are none of our business, they don't exist as far as we're concerned.
+	if !lbaas.handlesService(service) {
+		return nil, false, nil
+	}
 	name := lbaas.GetLoadBalancerName(ctx, clusterName, service)
 	legacyName := lbaas.getLoadBalancerLegacyName(ctx, clusterName, service)
+	previousName := lbaas.getLoadBalancerPreviousName(ctx, clusterName, service)
+	lbaas, err = lbaas.lookupRegion(service, name, legacyName, previousName)
+	if err != nil {
+		return nil, false, err
+	}
 	lbID := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerID, "")
 	var loadbalancer *loadbalancers.LoadBalancer
-	var err error
 
 	if lbID != "" {
 		loadbalancer, err = openstackutil.GetLoadbalancerByID(lbaas.lb, lbID)
 	} else {
-		loadbalancer, err = getLoadbalancerByName(lbaas.lb, name, legacyName)
+		loadbalancer, err = getLoadbalancerByName(lbaas.lb, name, legacyName, previousName)
 	}
 	if err != nil && cpoerrors.IsNotFound(err) {
 		return nil, false, nil
@@ -580,11 +723,19 @@ func (lbaas *LbaasV2) GetLoadBalancer(ctx context.Context, clusterName string, s
 		if err != nil {
 			return nil, false, fmt.Errorf("failed when trying to get floating IP for port %s: %v", portID, err)
 		}
+		addr := loadbalancer.VipAddress
 		if floatIP != nil {
-			status.Ingress = []corev1.LoadBalancerIngress{{IP: floatIP.FloatingIP}}
-		} else {
-			status.Ingress = []corev1.LoadBalancerIngress{{IP: loadbalancer.VipAddress}}
+			addr = floatIP.FloatingIP
+		}
+		// Report the status like the reconciles do, an invalid hostname is reported by them.
+		hostname, _ := getIngressHostname(service)
+		svcConf := &serviceConfig{
+			ingressHostname:          hostname,
+			ingressHostnameIncludeIP: getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHostnameIncludeIP, false),
+			includeVIPAddress:        getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerIncludeVIPAddress, false),
+			enableProxyProtocol:      getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerProxyEnabled, false),
 		}
+		status = lbaas.createLoadBalancerStatus(service, svcConf, addr, loadbalancer.VipAddress)
 	}
 
 	return status, true, nil
@@ -592,8 +743,12 @@ func (lbaas *LbaasV2) GetLoadBalancer(ctx context.Context, clusterName string, s
 
 // GetLoadBalancerName returns the constructed load balancer name.
 func (lbaas *LbaasV2) GetLoadBalancerName(_ context.Context, clusterName string, service *corev1.Service) string {
-	name := fmt.Sprintf("%s%s_%s_%s", servicePrefix, clusterName, service.Namespace, service.Name)
-	return cpoutil.CutString255(name)
+	return loadBalancerName(clusterName, service.Namespace, service.Name)
+}
+
+// getLoadBalancerPreviousName returns the name the previous releases gave to the load balancer if it's changed since.
+func (lbaas *LbaasV2) getLoadBalancerPreviousName(_ context.Context, clusterName string, service *corev1.Service) string {
+	return previousLoadBalancerName(clusterName, service.Namespace, service.Name)
 }
 
 // getLoadBalancerLegacyName returns the legacy load balancer name for backward compatibility.
@@ -672,6 +827,23 @@ func getIntFromServiceAnnotation(service *corev1.Service, annotationKey string,
 	return defaultSetting
 }
 
+// getOptionalIntFromServiceAnnotation searches a given v1.Service for a specific annotationKey and returns the
+// annotation's integer value, or nil if it's not set or invalid
+func getOptionalIntFromServiceAnnotation(service *corev1.Service, annotationKey string) *int {
+	annotationValue, ok := service.Annotations[annotationKey]
+	if !ok {
+		return nil
+	}
+	returnValue, err := strconv.Atoi(annotationValue)
+	if err != nil {
+		klog.Warningf("Could not parse int value from %q, ignoring %s: %v", annotationValue, annotationKey, err)
+		return nil
+	}
+
+	klog.V(4).Infof("Found a Service Annotation: %v = %v", annotationKey, annotationValue)
+	return &returnValue
+}
+
 // getBoolFromServiceAnnotation searches a given v1.Service for a specific annotationKey and either returns the annotation's boolean value or a specified defaultSetting
 func getBoolFromServiceAnnotation(service *corev1.Service, annotationKey string, defaultSetting bool) bool {
 	klog.V(4).Infof("getBoolFromServiceAnnotation(%s/%s, %v, %v)", service.Namespace, service.Name, annotationKey, defaultSetting)
@@ -721,17 +893,20 @@ func getSubnetIDForLB(network *gophercloud.ServiceClient, node corev1.Node, pref
 	return "", cpoerrors.ErrNotFound
 }
 
-// applyNodeSecurityGroupIDForLB associates the security group with all the ports on the nodes.
-func applyNodeSecurityGroupIDForLB(network *gophercloud.ServiceClient, nodes []*corev1.Node, sg string) error {
+// applyNodeSecurityGroupIDForLB associates the security group with all the ports on the nodes. It returns the server
+// IDs of the nodes.
+func applyNodeSecurityGroupIDForLB(network *gophercloud.ServiceClient, nodes []*corev1.Node, sg string) (sets.Set[string], error) {
+	serverIDs := sets.New[string]()
 	for _, node := range nodes {
 		serverID, _, err := instanceIDFromProviderID(node.Spec.ProviderID)
 		if err != nil {
-			return fmt.Errorf("error getting server ID from the node: %w", err)
+			return nil, fmt.Errorf("error getting server ID from the node: %w", err)
 		}
+		serverIDs.Insert(serverID)
 		listOpts := neutronports.ListOpts{DeviceID: serverID}
 		allPorts, err := openstackutil.GetPorts(network, listOpts)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		for _, port := range allPorts {
@@ -749,16 +924,17 @@ func applyNodeSecurityGroupIDForLB(network *gophercloud.ServiceClient, nodes []*
 			mc := metrics.NewMetricContext("port", "update")
 			res := neutronports.Update(network, port.ID, updateOpts)
 			if mc.ObserveRequest(res.Err) != nil {
-				return fmt.Errorf("failed to update security group for port %s: %v", port.ID, res.Err)
+				return nil, fmt.Errorf("failed to update security group for port %s: %v", port.ID, res.Err)
 			}
 		}
 	}
 
-	return nil
+	return serverIDs, nil
 }
 
-// disassociateSecurityGroupForLB removes the given security group from the ports
-func disassociateSecurityGroupForLB(network *gophercloud.ServiceClient, sg string) error {
+// disassociateSecurityGroupForLB removes the given security group from the ports, except the ones of the servers in
+// keepServerIDs.
+func disassociateSecurityGroupForLB(network *gophercloud.ServiceClient, sg string, keepServerIDs sets.Set[string]) error {
 	// Find all the ports that have the security group associated.
 	listOpts := neutronports.ListOpts{SecurityGroups: []string{sg}}
 	allPorts, err := openstackutil.GetPorts(network, listOpts)
@@ -768,6 +944,9 @@ func disassociateSecurityGroupForLB(network *gophercloud.ServiceClient, sg strin
 
 	// Disassocate security group and remove the tag.
 	for _, port := range allPorts {
+		if keepServerIDs.Has(port.DeviceID) {
+			continue
+		}
 		existingSGs := sets.NewString()
 		for _, sgID := range port.SecurityGroups {
 			existingSGs.Insert(sgID)
@@ -830,14 +1009,17 @@ func (lbaas *LbaasV2) deleteListeners(lbID string, listenerList []listeners.List
 func (lbaas *LbaasV2) deleteOctaviaListeners(lbID string, listenerList []listeners.Listener, isLBOwner bool, lbName string) error {
 	for _, listener := range listenerList {
 		// If the listener was created by this Service before or after supporting shared LB.
-		if (isLBOwner && len(listener.Tags) == 0) || cpoutil.Contains(listener.Tags, lbName) {
+		if isListenerOwned(listener, isLBOwner, lbName) {
 			klog.InfoS("Deleting listener", "listenerID", listener.ID, "lbID", lbID)
 
 			pool, err := openstackutil.GetPoolByListener(lbaas.lb, lbID, listener.ID)
 			if err != nil && err != cpoerrors.ErrNotFound {
 				return fmt.Errorf("error getting pool for listener %s: %v", listener.ID, err)
 			}
-			if pool != nil {
+			if pool != nil && len(pool.Listeners) > 1 {
+				// The last listener using the pool will take care of deleting it.
+				klog.InfoS("Keeping pool shared with other listeners", "poolID", pool.ID, "listenerID", listener.ID, "lbID", lbID)
+			} else if pool != nil {
 				klog.InfoS("Deleting pool", "poolID", pool.ID, "listenerID", listener.ID, "lbID", lbID)
 
 				// Delete pool automatically deletes all its members.
@@ -862,13 +1044,53 @@ func (lbaas *LbaasV2) deleteOctaviaListeners(lbID string, listenerList []listene
 	return nil
 }
 
+// getLoadBalancerIP returns the address requested for the load balancer of the Service, set with the vip-address
+// annotation or the deprecated Spec.LoadBalancerIP.
+func getLoadBalancerIP(service *corev1.Service) string {
+	if address := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerVIPAddress, ""); address != "" {
+		return address
+	}
+	return service.Spec.LoadBalancerIP
+}
+
+// getExternalTrafficPolicy returns the external traffic policy of the Service, default-external-traffic-policy if
+// spec.externalTrafficPolicy isn't set. The policy set on the Service always wins.
+func (lbaas *LbaasV2) getExternalTrafficPolicy(service *corev1.Service) corev1.ServiceExternalTrafficPolicy {
+	if service.Spec.ExternalTrafficPolicy != "" {
+		return service.Spec.ExternalTrafficPolicy
+	}
+	if lbaas.opts.DefaultExternalTrafficPolicy != "" {
+		return corev1.ServiceExternalTrafficPolicy(lbaas.opts.DefaultExternalTrafficPolicy)
+	}
+	return corev1.ServiceExternalTrafficPolicyCluster
+}
+
+// getAvailableFloatingIP returns the floating IP with the address among the ones found, or nil if there is none. It
+// fails if the floating IP is associated with a port or isn't on the floating network, if one is configured.
+func getAvailableFloatingIP(fips []floatingips.FloatingIP, address, networkID string) (*floatingips.FloatingIP, error) {
+	for i := range fips {
+		fip := &fips[i]
+		if fip.FloatingIP != address {
+			continue
+		}
+		if fip.PortID != "" {
+			return nil, fmt.Errorf("floating IP %s is not available, it is associated with port %s", address, fip.PortID)
+		}
+		if networkID != "" && fip.FloatingNetworkID != networkID {
+			return nil, asTerminalError(fmt.Errorf("floating IP %s is on network %s rather than on floating network %s", address, fip.FloatingNetworkID, networkID))
+		}
+		return fip, nil
+	}
+	return nil, nil
+}
+
 func (lbaas *LbaasV2) createFloatingIP(msg string, floatIPOpts floatingips.CreateOpts) (*floatingips.FloatingIP, error) {
 	klog.V(4).Infof("%s floating ip with opts %+v", msg, floatIPOpts)
 	mc := metrics.NewMetricContext("floating_ip", "create")
 	floatIP, err := floatingips.Create(lbaas.network, floatIPOpts).Extract()
 	err = PreserveGopherError(err)
 	if mc.ObserveRequest(err) != nil {
-		return floatIP, fmt.Errorf("error creating LB floatingip: %s", err)
+		return floatIP, fmt.Errorf("error creating LB floatingip: %w", err)
 	}
 	return floatIP, err
 }
@@ -878,9 +1100,11 @@ func (lbaas *LbaasV2) updateFloatingIP(floatingip *floatingips.FloatingIP, portI
 		PortID: portID,
 	}
 	if portID != nil {
-		klog.V(4).Infof("Attaching floating ip %q to loadbalancer port %q", floatingip.FloatingIP, portID)
+		klog.V(4).Infof("Attaching floating ip %q to loadbalancer port %q", floatingip.FloatingIP, *portID)
 	} else {
 		klog.V(4).Infof("Detaching floating ip %q from port %q", floatingip.FloatingIP, floatingip.PortID)
+		// A nil port_id is omitted from the request, the empty one is sent as null and detaches the floating IP.
+		floatUpdateOpts.PortID = new(string)
 	}
 	mc := metrics.NewMetricContext("floating_ip", "update")
 	floatingip, err := floatingips.Update(lbaas.network, floatingip.ID, floatUpdateOpts).Extract()
@@ -891,21 +1115,39 @@ func (lbaas *LbaasV2) updateFloatingIP(floatingip *floatingips.FloatingIP, portI
 }
 
 // ensureFloatingIP manages a FIP for a Service and returns the address that should be advertised in the
-// .Status.LoadBalancer. In particular it will:
+// .Status.LoadBalancer. If the VIP is on an external network, e.g. a routable provider network, the VIP address is
+// used and no FIP is needed. Otherwise it will:
 //  1. Lookup if any FIP is already attached to the VIP port of the LB.
 //     a) If it is and Service is internal, it will attempt to detach the FIP and delete it if it was created
 //     by cloud provider. This is to support cases of changing the internal annotation.
 //     b) If the Service is not the owner of the LB it will not contiue to prevent accidental exposure of the
 //     possible internal Services already existing on that LB.
 //     c) If it's external Service, it will use that existing FIP.
-//  2. Lookup FIP specified in Spec.LoadBalancerIP and try to assign it to the LB VIP port.
+//  2. Lookup FIP specified in the vip-address annotation or Spec.LoadBalancerIP and try to assign it to the LB VIP
+//     port. The FIP has to be unassigned and on the floating network of the Service. If other Services request the
+//     same address, only the oldest of them gets it and takes it over from the others.
 //  3. Try to create and assign a new FIP:
-//     a) If Spec.LoadBalancerIP is not set, just create a random FIP in the external network and use that.
-//     b) If Spec.LoadBalancerIP is specified, try to create a FIP with that address. By default this is not allowed by
+//     a) If no address is requested, just create a random FIP in the external network and use that.
+//     b) If an address is requested, try to create a FIP with that address. By default this is not allowed by
 //     the Neutron policy for regular users!
-func (lbaas *LbaasV2) ensureFloatingIP(clusterName string, service *corev1.Service, lb *loadbalancers.LoadBalancer, svcConf *serviceConfig, isLBOwner bool) (string, error) {
+//
+// A FIP newly associated with the LB gets a LoadBalancerFloatingIPReused event if it existed already, or a
+// LoadBalancerFloatingIPAllocated one if it was created, none is emitted while it stays attached.
+func (lbaas *LbaasV2) ensureFloatingIP(ctx context.Context, clusterName string, service *corev1.Service, lb *loadbalancers.LoadBalancer, svcConf *serviceConfig, isLBOwner bool) (string, error) {
 	serviceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
 
+	// A FIP can't be attached to a port on an external network and the VIP is reachable without it anyway.
+	if lb.VipNetworkID != "" {
+		external, err := openstackutil.IsExternalNetwork(lbaas.network, lb.VipNetworkID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get network %s of the VIP of load balancer %s: %v", lb.VipNetworkID, lb.ID, err)
+		}
+		if external {
+			klog.V(4).Infof("VIP of load balancer %s for Service %s is on external network %s, not using a floating IP", lb.ID, serviceName, lb.VipNetworkID)
+			return lb.VipAddress, nil
+		}
+	}
+
 	// We need to fetch the FIP attached to load balancer's VIP port for both codepaths
 	portID := lb.VipPortID
 	floatIP, err := openstackutil.GetFloatingIPByPortID(lbaas.network, portID)
@@ -931,15 +1173,28 @@ func (lbaas *LbaasV2) ensureFloatingIP(clusterName string, service *corev1.Servi
 			}
 			if !fipDeleted {
 				// if FIP wasn't deleted (because of keep-floatingip annotation or not being created by us) we should still detach it
-				_, err = lbaas.updateFloatingIP(floatIP, nil)
+				floatIP, err = lbaas.updateFloatingIP(floatIP, nil)
 				if err != nil {
 					return "", err
 				}
+				if err := lbaas.ensureFloatingIPTags(floatIP, nil, ""); err != nil {
+					return "", err
+				}
+				if err := lbaas.deleteFloatingIPQosPolicy(floatIP, service); err != nil {
+					return "", err
+				}
 			}
 		}
 		return lb.VipAddress, nil
 	}
 
+	// A FIP of the LB associated with another port outside of Kubernetes is either associated back or released.
+	if isLBOwner {
+		if floatIP, err = lbaas.reconcileFloatingIPDrift(clusterName, service, lb, floatIP); err != nil {
+			return "", err
+		}
+	}
+
 	// first attempt: if we've found a FIP attached to LBs VIP port, we'll be using that.
 
 	// we cannot add a FIP to a shared LB when we're a secondary Service or we risk adding it to an internal
@@ -949,10 +1204,15 @@ func (lbaas *LbaasV2) ensureFloatingIP(clusterName string, service *corev1.Servi
 			service.Namespace, service.Name)
 	}
 
-	// second attempt: fetch floating IP specified in service Spec.LoadBalancerIP
+	// second attempt: fetch floating IP specified in the vip-address annotation or service Spec.LoadBalancerIP
 	// if found, associate floating IP with loadbalancer's VIP port
-	loadBalancerIP := service.Spec.LoadBalancerIP
+	loadBalancerIP := getLoadBalancerIP(service)
 	if floatIP == nil && loadBalancerIP != "" {
+		younger, err := lbaas.checkLoadBalancerIPConflict(ctx, service, loadBalancerIP)
+		if err != nil {
+			return "", err
+		}
+
 		opts := floatingips.ListOpts{
 			FloatingIP: loadBalancerIP,
 		}
@@ -962,16 +1222,22 @@ func (lbaas *LbaasV2) ensureFloatingIP(clusterName string, service *corev1.Servi
 		}
 		klog.V(4).Infof("Found floating ips %v by loadbalancer ip %q", existingIPs, loadBalancerIP)
 
-		if len(existingIPs) > 0 {
-			floatingip := existingIPs[0]
-			if len(floatingip.PortID) == 0 {
-				floatIP, err = lbaas.updateFloatingIP(&floatingip, &portID)
-				if err != nil {
-					return "", err
-				}
-			} else {
-				return "", fmt.Errorf("floating IP %s is not available", loadBalancerIP)
+		if err := lbaas.reclaimFloatingIP(existingIPs, loadBalancerIP, younger); err != nil {
+			return "", err
+		}
+
+		floatingip, err := getAvailableFloatingIP(existingIPs, loadBalancerIP, svcConf.lbPublicNetworkID)
+		if err != nil {
+			return "", err
+		}
+		if floatingip != nil {
+			klog.InfoS("Associating existing floating IP", "floatingIP", loadBalancerIP, "portID", portID, "service", klog.KObj(service))
+			floatIP, err = lbaas.updateFloatingIP(floatingip, &portID)
+			if err != nil {
+				return "", err
 			}
+			lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBFloatingIPReused,
+				"Reused existing floating IP %s (%s) for load balancer %s", floatIP.FloatingIP, floatIP.ID, lb.ID)
 		}
 	}
 
@@ -1026,6 +1292,8 @@ func (lbaas *LbaasV2) ensureFloatingIP(clusterName string, service *corev1.Servi
 				}
 				klog.V(2).Infof("Successfully created floating IP %s for loadbalancer %s", floatIP.FloatingIP, lb.ID)
 			}
+			lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBFloatingIPAllocated,
+				"Allocated new floating IP %s (%s) for load balancer %s", floatIP.FloatingIP, floatIP.ID, lb.ID)
 
 		} else {
 			klog.Warningf("Floating network configuration not provided for Service %s, forcing to ensure an internal load balancer service", serviceName)
@@ -1033,6 +1301,18 @@ func (lbaas *LbaasV2) ensureFloatingIP(clusterName string, service *corev1.Servi
 	}
 
 	if floatIP != nil {
+		// The FIP of a shared load balancer belongs to the Service owning it.
+		if isLBOwner {
+			if err := lbaas.ensureFloatingIPTags(floatIP, service, lb.ID); err != nil {
+				return "", err
+			}
+			if err := lbaas.ensureFloatingIPPTRRecord(floatIP, service, svcConf); err != nil {
+				return "", err
+			}
+			if err := lbaas.ensureFloatingIPQosPolicy(floatIP, service, svcConf.fipQosPolicyID); err != nil {
+				return "", err
+			}
+		}
 		return floatIP.FloatingIP, nil
 	}
 
@@ -1044,23 +1324,32 @@ func (lbaas *LbaasV2) ensureOctaviaHealthMonitor(lbID string, name string, pool
 
 	if monitorID != "" {
 		monitor, err := openstackutil.GetHealthMonitor(lbaas.lb, monitorID)
-		if err != nil {
+		if err != nil && err != cpoerrors.ErrNotFound {
 			return err
 		}
 		//Recreate health monitor with correct protocol if externalTrafficPolicy was changed
 		createOpts := lbaas.buildMonitorCreateOpts(svcConf, port)
-		if createOpts.Type != monitor.Type {
-			klog.InfoS("Recreating health monitor for the pool", "pool", pool.ID, "oldMonitor", monitorID)
+		if monitor == nil {
+			// The pool may still reference a monitor that was deleted in the meantime.
+			klog.InfoS("Health monitor of the pool not found", "pool", pool.ID, "monitor", monitorID)
+			monitorID = ""
+		} else if createOpts.Type != monitor.Type || !svcConf.enableMonitor {
+			if svcConf.enableMonitor {
+				klog.InfoS("Recreating health monitor for the pool", "pool", pool.ID, "oldMonitor", monitorID)
+			} else {
+				klog.InfoS("Deleting health monitor for the pool", "pool", pool.ID, "monitor", monitorID)
+			}
 			if err := openstackutil.DeleteHealthMonitor(lbaas.lb, monitorID, lbID); err != nil {
 				return err
 			}
 			monitorID = ""
-		}
-		if svcConf.healthMonitorDelay != monitor.Delay || svcConf.healthMonitorTimeout != monitor.Timeout || svcConf.healthMonitorMaxRetries != monitor.MaxRetries {
+		} else if svcConf.healthMonitorDelay != monitor.Delay || svcConf.healthMonitorTimeout != monitor.Timeout ||
+			svcConf.healthMonitorMaxRetries != monitor.MaxRetries || svcConf.healthMonitorMaxRetriesDown != monitor.MaxRetriesDown {
 			updateOpts := v2monitors.UpdateOpts{
-				Delay:      svcConf.healthMonitorDelay,
-				Timeout:    svcConf.healthMonitorTimeout,
-				MaxRetries: svcConf.healthMonitorMaxRetries,
+				Delay:          svcConf.healthMonitorDelay,
+				Timeout:        svcConf.healthMonitorTimeout,
+				MaxRetries:     svcConf.healthMonitorMaxRetries,
+				MaxRetriesDown: svcConf.healthMonitorMaxRetriesDown,
 			}
 			klog.Infof("Updating health monitor %s updateOpts %+v", monitorID, updateOpts)
 			if err := openstackutil.UpdateHealthMonitor(lbaas.lb, monitorID, updateOpts, lbID); err != nil {
@@ -1081,12 +1370,6 @@ func (lbaas *LbaasV2) ensureOctaviaHealthMonitor(lbID string, name string, pool
 		}
 		monitorID = monitor.ID
 		klog.Infof("Health monitor %s for pool %s created.", monitorID, pool.ID)
-	} else if monitorID != "" && !svcConf.enableMonitor {
-		klog.Infof("Deleting health monitor %s for pool %s", monitorID, pool.ID)
-
-		if err := openstackutil.DeleteHealthMonitor(lbaas.lb, monitorID, lbID); err != nil {
-			return err
-		}
 	}
 
 	return nil
@@ -1107,10 +1390,11 @@ func (lbaas *LbaasV2) canUseHTTPMonitor(port corev1.ServicePort) bool {
 // buildMonitorCreateOpts returns a v2monitors.CreateOpts without PoolID for consumption of both, fully popuplated Loadbalancers and Monitors.
 func (lbaas *LbaasV2) buildMonitorCreateOpts(svcConf *serviceConfig, port corev1.ServicePort) v2monitors.CreateOpts {
 	opts := v2monitors.CreateOpts{
-		Type:       string(port.Protocol),
-		Delay:      svcConf.healthMonitorDelay,
-		Timeout:    svcConf.healthMonitorTimeout,
-		MaxRetries: svcConf.healthMonitorMaxRetries,
+		Type:           string(port.Protocol),
+		Delay:          svcConf.healthMonitorDelay,
+		Timeout:        svcConf.healthMonitorTimeout,
+		MaxRetries:     svcConf.healthMonitorMaxRetries,
+		MaxRetriesDown: svcConf.healthMonitorMaxRetriesDown,
 	}
 	if port.Protocol == corev1.ProtocolUDP {
 		opts.Type = "UDP-CONNECT"
@@ -1125,12 +1409,31 @@ func (lbaas *LbaasV2) buildMonitorCreateOpts(svcConf *serviceConfig, port corev1
 }
 
 // Make sure the pool is created for the Service, nodes are added as pool members.
-func (lbaas *LbaasV2) ensureOctaviaPool(lbID string, name string, listener *listeners.Listener, service *corev1.Service, port corev1.ServicePort, nodes []*corev1.Node, svcConf *serviceConfig) (*v2pools.Pool, error) {
+func (lbaas *LbaasV2) ensureOctaviaPool(ctx context.Context, lbID string, name string, listener *listeners.Listener, service *corev1.Service, port corev1.ServicePort, nodes []*corev1.Node, svcConf *serviceConfig) (*v2pools.Pool, error) {
 	pool, err := openstackutil.GetPoolByListener(lbaas.lb, lbID, listener.ID)
 	if err != nil && err != cpoerrors.ErrNotFound {
 		return nil, fmt.Errorf("error getting pool for listener %s: %v", listener.ID, err)
 	}
 
+	// The port is no longer in a group sharing a pool, but its listener still uses the shared pool. Leave the pool to
+	// the other listeners and create a dedicated one.
+	detachSharedPool := false
+	if pool != nil && len(pool.Listeners) > 1 && svcConf.poolGroups[port.Name] == "" {
+		klog.InfoS("Detaching listener from shared pool", "poolID", pool.ID, "listenerID", listener.ID, "lbID", lbID)
+		detachSharedPool = true
+		pool = nil
+	}
+
+	// The default pool of the listener isn't one of the Service, e.g. it was switched manually. Leave it alone and
+	// switch the listener to a pool of the Service.
+	var foreignPool *v2pools.Pool
+	if pool != nil && svcConf.lbName != "" && !isPoolOwned(pool, svcConf.lbName) {
+		klog.InfoS("Replacing default pool not owned by the Service", "poolID", pool.ID, "listenerID", listener.ID, "lbID", lbID)
+		foreignPool = pool
+		detachSharedPool = true
+		pool = nil
+	}
+
 	// By default, use the protocol of the listener
 	poolProto := v2pools.Protocol(listener.Protocol)
 	if svcConf.enableProxyProtocol {
@@ -1139,135 +1442,594 @@ func (lbaas *LbaasV2) ensureOctaviaPool(lbID string, name string, listener *list
 		poolProto = v2pools.ProtocolHTTP
 	}
 
-	// Delete the pool and its members if it already exists and has the wrong protocol
+	// The pool has the wrong protocol and has to be replaced. With create-first the listener is switched to the new
+	// pool once its members are set, and the old pool is deleted afterwards.
+	var replacedPool *v2pools.Pool
 	if pool != nil && v2pools.Protocol(pool.Protocol) != poolProto {
-		klog.InfoS("Deleting unused pool", "poolID", pool.ID, "listenerID", listener.ID, "lbID", lbID)
-
-		// Delete pool automatically deletes all its members.
-		if err := openstackutil.DeletePool(lbaas.lb, pool.ID, lbID); err != nil {
-			return nil, err
+		if lbaas.opts.ReconcileOrder == reconcileOrderDeleteFirst {
+			if err := lbaas.deleteReplacedPool(lbID, listener.ID, pool); err != nil {
+				return nil, err
+			}
+		} else {
+			replacedPool = pool
+			detachSharedPool = true
 		}
 		pool = nil
 	}
 
+	if pool == nil && detachSharedPool {
+		// A previous replacement may have been interrupted before the listener was switched to the new pool.
+		if pool, err = lbaas.getDetachedPool(lbID, name, poolProto); err != nil {
+			return nil, fmt.Errorf("error getting pools of loadbalancer %s: %v", lbID, err)
+		}
+		if pool != nil {
+			klog.InfoS("Reusing pool not used by any listener", "poolID", pool.ID, "listenerID", listener.ID, "lbID", lbID)
+		}
+	}
+
 	if pool == nil {
 		createOpt := lbaas.buildPoolCreateOpt(listener.Protocol, service, svcConf)
-		createOpt.ListenerID = listener.ID
+		if detachSharedPool {
+			// The listener already has a default pool, so the new pool has to be switched to explicitly.
+			createOpt.LoadbalancerID = lbID
+		} else {
+			createOpt.ListenerID = listener.ID
+		}
 		createOpt.Name = name
 
 		klog.InfoS("Creating pool", "listenerID", listener.ID, "protocol", createOpt.Protocol)
 		pool, err = openstackutil.CreatePool(lbaas.lb, createOpt, lbID)
+		if err != nil && replacedPool != nil && cpoerrors.IsQuotaError(err) {
+			// There's no room for both pools, the old one is deleted first.
+			klog.InfoS("Pool quota exceeded, deleting the replaced pool first", "poolID", replacedPool.ID, "listenerID", listener.ID, "lbID", lbID)
+			if err := lbaas.deleteReplacedPool(lbID, listener.ID, replacedPool); err != nil {
+				return nil, err
+			}
+			replacedPool = nil
+			detachSharedPool = false
+			createOpt.LoadbalancerID = ""
+			createOpt.ListenerID = listener.ID
+			pool, err = openstackutil.CreatePool(lbaas.lb, createOpt, lbID)
+		}
 		if err != nil {
 			return nil, err
 		}
 		klog.V(2).Infof("Pool %s created for listener %s", pool.ID, listener.ID)
 	}
 
+	if err := lbaas.ensurePoolSessionPersistence(lbID, pool, svcConf); err != nil {
+		return nil, err
+	}
+
+	if pool.Description != svcConf.description {
+		klog.InfoS("Updating pool description", "poolID", pool.ID, "lbID", lbID)
+		if err := openstackutil.UpdatePool(lbaas.lb, lbID, pool.ID, v2pools.UpdateOpts{Description: &svcConf.description}); err != nil {
+			return nil, fmt.Errorf("failed to update description of pool %s: %v", pool.ID, err)
+		}
+		pool.Description = svcConf.description
+	}
+
+	if svcConf.supportLBTags {
+		if newTags, missing := addMissingTags(pool.Tags, svcConf.tags); missing {
+			klog.InfoS("Updating pool tags", "poolID", pool.ID, "lbID", lbID, "tags", newTags)
+			if err := openstackutil.UpdatePool(lbaas.lb, lbID, pool.ID, v2pools.UpdateOpts{Tags: &newTags}); err != nil {
+				return nil, fmt.Errorf("failed to update tags of pool %s: %v", pool.ID, err)
+			}
+			pool.Tags = newTags
+		}
+	}
+
+	if err := lbaas.ensurePoolMembers(ctx, lbID, pool, service, port, nodes, svcConf); err != nil {
+		return nil, err
+	}
+
+	// The listener is switched to the new pool only once its members are set, so that it always has a backend.
+	if detachSharedPool {
+		if err := openstackutil.UpdateListener(lbaas.lb, lbID, listener.ID, listeners.UpdateOpts{DefaultPoolID: &pool.ID}); err != nil {
+			return nil, fmt.Errorf("failed to update listener %s of loadbalancer %s: %v", listener.ID, lbID, err)
+		}
+	}
+	if foreignPool != nil {
+		lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBDriftHealed,
+			"Replaced default pool %s of listener %s, it doesn't belong to the Service", foreignPool.ID, listener.ID)
+	}
+	if replacedPool != nil {
+		if err := lbaas.deleteReplacedPool(lbID, listener.ID, replacedPool); err != nil {
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
+
+// deleteReplacedPool deletes the pool of the listener replaced by one with another protocol, along with its members.
+func (lbaas *LbaasV2) deleteReplacedPool(lbID, listenerID string, pool *v2pools.Pool) error {
+	klog.InfoS("Deleting unused pool", "poolID", pool.ID, "listenerID", listenerID, "lbID", lbID)
+	return openstackutil.DeletePool(lbaas.lb, pool.ID, lbID)
+}
+
+// isPoolOwned tells if the pool belongs to the Service by its tags. The pools created without tags are named after the
+// load balancer they were created on, which isn't the one of the Service on a shared load balancer, so only their name
+// prefix is checked.
+func isPoolOwned(pool *v2pools.Pool, lbName string) bool {
+	if len(pool.Tags) > 0 {
+		return cpoutil.Contains(pool.Tags, lbName)
+	}
+	return strings.HasPrefix(pool.Name, "pool_")
+}
+
+// ensurePoolMembers makes sure the members of the pool are the nodes, listening on the member port of the Service port.
+func (lbaas *LbaasV2) ensurePoolMembers(ctx context.Context, lbID string, pool *v2pools.Pool, service *corev1.Service, port corev1.ServicePort, nodes []*corev1.Node, svcConf *serviceConfig) error {
+	if len(nodes) == 0 && svcConf.keepMembersWithoutNodes {
+		klog.V(2).Infof("Keeping members of pool %s, Service %s/%s has no eligible node", pool.ID, service.Namespace, service.Name)
+		return nil
+	}
+
+	// Members are removed while the Service has no ready endpoints, so that they aren't left pointing at nodes that
+	// cannot serve the traffic. The listeners stay and HTTP ones respond with 503. With not-ready-members, they're kept
+	// with weight 0 while the endpoints are starting instead, except with serial API calls which cannot set weights.
+	if svcConf.noReadyEndpoints && (!svcConf.notReadyMembers || lbaas.opts.ProviderRequiresSerialAPICalls) {
+		klog.V(2).Infof("Removing members of pool %s, Service %s/%s has no ready endpoints", pool.ID, service.Namespace, service.Name)
+		nodes = nil
+	}
+
 	if lbaas.opts.ProviderRequiresSerialAPICalls {
 		klog.V(2).Infof("Using serial API calls to update members for pool %s", pool.ID)
-		var nodePort int = int(port.NodePort)
+		var nodePort int = getMemberPort(port, svcConf)
 
-		if err := openstackutil.SeriallyReconcilePoolMembers(lbaas.lb, pool, nodePort, lbID, nodes); err != nil {
-			return nil, err
+		// Members can't be drained using serial API calls, they're only removed after the grace period.
+		var memberNodes []*corev1.Node
+		for _, node := range nodes {
+			if _, expired := lbaas.getNodeDrainState(node); !expired {
+				memberNodes = append(memberNodes, node)
+			}
 		}
-		return pool, nil
+
+		return openstackutil.SeriallyReconcilePoolMembers(lbaas.lb, pool, nodePort, lbID, memberNodes)
 	}
 
-	curMembers := sets.New[string]()
 	poolMembers, err := openstackutil.GetMembersbyPool(lbaas.lb, pool.ID)
 	if err != nil {
 		klog.Errorf("failed to get members in the pool %s: %v", pool.ID, err)
 	}
-	for _, m := range poolMembers {
-		curMembers.Insert(fmt.Sprintf("%s-%s-%d-%d", m.Name, m.Address, m.ProtocolPort, m.MonitorPort))
-	}
 
 	members, newMembers, err := lbaas.buildBatchUpdateMemberOpts(port, nodes, svcConf)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	// The members of the nodes whose address changed are replaced without interrupting the traffic.
+	var pendingMoves []string
+	if moves := getMemberMoves(poolMembers, members); len(moves) > 0 {
+		var kept []v2pools.Member
+		kept, poolMembers, pendingMoves, err = lbaas.moveMembers(ctx, lbID, pool, moves, poolMembers, members)
+		if err != nil {
+			return err
+		}
+		for _, m := range kept {
+			members = append(members, keepMemberOpts(m))
+			newMembers.Insert(fmt.Sprintf("%s-%s-%d-%d-%d-%t", m.Name, m.Address, m.ProtocolPort, m.MonitorPort, m.Weight, m.Backup))
+		}
+	}
+
+	curMembers := sets.New[string]()
+	for _, m := range poolMembers {
+		curMembers.Insert(fmt.Sprintf("%s-%s-%d-%d-%d-%t", m.Name, m.Address, m.ProtocolPort, m.MonitorPort, m.Weight, m.Backup))
 	}
 
 	if !curMembers.Equal(newMembers) {
 		klog.V(2).Infof("Updating %d members for pool %s", len(members), pool.ID)
 		if err := openstackutil.BatchUpdatePoolMembers(lbaas.lb, lbID, pool.ID, members); err != nil {
-			return nil, err
+			return err
 		}
 		klog.V(2).Infof("Successfully updated %d members for pool %s", len(members), pool.ID)
 	}
 
-	return pool, nil
+	if len(pendingMoves) > 0 {
+		// The rest of the Service is reconciled meanwhile, the reconcile is retried once it's done.
+		svcConf.memberMoves.add(pool.ID, pendingMoves)
+	}
+	return nil
 }
 
-func (lbaas *LbaasV2) buildPoolCreateOpt(listenerProtocol string, service *corev1.Service, svcConf *serviceConfig) v2pools.CreateOpts {
-	// By default, use the protocol of the listener
-	poolProto := v2pools.Protocol(listenerProtocol)
-	if svcConf.enableProxyProtocol {
-		poolProto = v2pools.ProtocolPROXY
-	} else if (svcConf.keepClientIP || svcConf.tlsContainerRef != "") && poolProto != v2pools.ProtocolHTTP {
-		if svcConf.keepClientIP && svcConf.tlsContainerRef != "" {
-			klog.V(4).Infof("Forcing to use %q protocol for pool because annotations %q %q are set", v2pools.ProtocolHTTP, ServiceAnnotationLoadBalancerXForwardedFor, ServiceAnnotationTlsContainerRef)
-		} else if svcConf.keepClientIP {
-			klog.V(4).Infof("Forcing to use %q protocol for pool because annotation %q is set", v2pools.ProtocolHTTP, ServiceAnnotationLoadBalancerXForwardedFor)
-		} else {
-			klog.V(4).Infof("Forcing to use %q protocol for pool because annotations %q is set", v2pools.ProtocolHTTP, ServiceAnnotationTlsContainerRef)
-		}
-		poolProto = v2pools.ProtocolHTTP
+// ensureOctaviaSharedPool makes the pool shared by a group of Service ports the default pool of the listener. The pool
+// used by the listener before is deleted, unless other listeners still use it.
+func (lbaas *LbaasV2) ensureOctaviaSharedPool(lbID string, listener *listeners.Listener, pool *v2pools.Pool) error {
+	if listener.DefaultPoolID == pool.ID {
+		return nil
 	}
 
-	affinity := service.Spec.SessionAffinity
-	var persistence *v2pools.SessionPersistence
-	switch affinity {
-	case corev1.ServiceAffinityNone:
-		persistence = nil
-	case corev1.ServiceAffinityClientIP:
-		persistence = &v2pools.SessionPersistence{Type: "SOURCE_IP"}
+	oldPool, err := openstackutil.GetPoolByListener(lbaas.lb, lbID, listener.ID)
+	if err != nil && err != cpoerrors.ErrNotFound {
+		return fmt.Errorf("error getting pool for listener %s: %v", listener.ID, err)
 	}
 
-	lbmethod := v2pools.LBMethod(lbaas.opts.LBMethod)
-	return v2pools.CreateOpts{
-		Protocol:    poolProto,
-		LBMethod:    lbmethod,
-		Persistence: persistence,
+	klog.InfoS("Updating listener default pool", "listenerID", listener.ID, "poolID", pool.ID, "lbID", lbID)
+	if err := openstackutil.UpdateListener(lbaas.lb, lbID, listener.ID, listeners.UpdateOpts{DefaultPoolID: &pool.ID}); err != nil {
+		return fmt.Errorf("failed to update listener %s of loadbalancer %s: %v", listener.ID, lbID, err)
 	}
+
+	if oldPool != nil && oldPool.ID != pool.ID && len(oldPool.Listeners) <= 1 {
+		klog.InfoS("Deleting unused pool", "poolID", oldPool.ID, "listenerID", listener.ID, "lbID", lbID)
+		// Delete pool automatically deletes all its members.
+		if err := openstackutil.DeletePool(lbaas.lb, oldPool.ID, lbID); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// buildBatchUpdateMemberOpts returns v2pools.BatchUpdateMemberOpts array for Services and Nodes alongside a list of member names
-func (lbaas *LbaasV2) buildBatchUpdateMemberOpts(port corev1.ServicePort, nodes []*corev1.Node, svcConf *serviceConfig) ([]v2pools.BatchUpdateMemberOpts, sets.Set[string], error) {
-	var members []v2pools.BatchUpdateMemberOpts
-	newMembers := sets.New[string]()
+// validateHealthMonitor checks the health monitor settings against the constraints enforced by Octavia.
+func validateHealthMonitor(svcConf *serviceConfig) error {
+	if svcConf.healthMonitorDelay < 0 || svcConf.healthMonitorTimeout < 0 {
+		return fmt.Errorf("health monitor delay (%d) and timeout (%d) must not be negative", svcConf.healthMonitorDelay, svcConf.healthMonitorTimeout)
+	}
+	if svcConf.healthMonitorTimeout >= svcConf.healthMonitorDelay {
+		return fmt.Errorf("health monitor timeout (%d) must be less than delay (%d)", svcConf.healthMonitorTimeout, svcConf.healthMonitorDelay)
+	}
+	if svcConf.healthMonitorMaxRetries < 1 || svcConf.healthMonitorMaxRetries > 10 {
+		return fmt.Errorf("health monitor max retries (%d) must be between 1 and 10", svcConf.healthMonitorMaxRetries)
+	}
+	if svcConf.healthMonitorMaxRetriesDown < 1 || svcConf.healthMonitorMaxRetriesDown > 10 {
+		return fmt.Errorf("health monitor max retries down (%d) must be between 1 and 10", svcConf.healthMonitorMaxRetriesDown)
+	}
+	return nil
+}
 
-	for _, node := range nodes {
-		addr, err := nodeAddressForLB(node, svcConf.preferredIPFamily)
-		if err != nil {
-			if err == cpoerrors.ErrNoAddressFound {
-				// Node failure, do not create member
-				klog.Warningf("Failed to get the address of node %s for creating member: %v", node.Name, err)
-				continue
-			} else {
-				return nil, nil, fmt.Errorf("error getting address of node %s: %v", node.Name, err)
+// checkClientIPConfig checks that the settings of a Service about the client IP and its health, i.e. the header
+// insertion or PROXY protocol, the ports and the provider of its listeners and the health monitor, make sense together.
+// All the problems found are reported at once in a single warning event, instead of one at a time on every attempt.
+// The conflicting settings fail the reconcile, the ignored ones only get reported.
+func (lbaas *LbaasV2) checkClientIPConfig(service *corev1.Service, svcConf *serviceConfig) error {
+	var conflicts, ignored []string
+
+	if svcConf.keepClientIP && svcConf.enableProxyProtocol {
+		conflicts = append(conflicts, fmt.Sprintf("annotation %s and %s cannot be used together", ServiceAnnotationLoadBalancerProxyEnabled, ServiceAnnotationLoadBalancerXForwardedFor))
+	}
+	if lbaas.opts.LBProvider == "ovn" {
+		// OVN load balancers keep the client IP as the source address of the traffic.
+		if svcConf.keepClientIP {
+			conflicts = append(conflicts, fmt.Sprintf("annotation %s is not supported by the ovn provider, which has no HTTP listeners to insert the header and keeps the client IP as the source address", ServiceAnnotationLoadBalancerXForwardedFor))
+		}
+		if svcConf.enableProxyProtocol {
+			conflicts = append(conflicts, fmt.Sprintf("annotation %s is not supported by the ovn provider, which keeps the client IP as the source address", ServiceAnnotationLoadBalancerProxyEnabled))
+		}
+	}
+	if svcConf.keepClientIP {
+		var nonTCP []string
+		for _, port := range service.Spec.Ports {
+			if port.Protocol != corev1.ProtocolTCP {
+				nonTCP = append(nonTCP, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
 			}
 		}
-
-		memberSubnetID := &svcConf.lbMemberSubnetID
-		if memberSubnetID != nil && *memberSubnetID == "" {
-			memberSubnetID = nil
+		if len(nonTCP) > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("annotation %s requires TCP ports, only HTTP listeners insert the header, ports %s aren't TCP", ServiceAnnotationLoadBalancerXForwardedFor, strings.Join(nonTCP, ", ")))
 		}
+	}
 
-		if port.NodePort != 0 { // It's 0 when AllocateLoadBalancerNodePorts=False
-			member := v2pools.BatchUpdateMemberOpts{
-				Address:      addr,
-				ProtocolPort: int(port.NodePort),
-				Name:         &node.Name,
-				SubnetID:     memberSubnetID,
-			}
-			if svcConf.healthCheckNodePort > 0 && lbaas.canUseHTTPMonitor(port) {
-				member.MonitorPort = &svcConf.healthCheckNodePort
+	// Explicitly disabling the health monitor while setting it up is most likely a leftover.
+	if service.Annotations[ServiceAnnotationLoadBalancerEnableHealthMonitor] == "false" {
+		var monitorAnnotations []string
+		for _, annotation := range []string{ServiceAnnotationLoadBalancerHealthMonitorDelay, ServiceAnnotationLoadBalancerHealthMonitorTimeout,
+			ServiceAnnotationLoadBalancerHealthMonitorMaxRetries, ServiceAnnotationLoadBalancerHealthMonitorMaxRetriesDown} {
+			if _, ok := service.Annotations[annotation]; ok {
+				monitorAnnotations = append(monitorAnnotations, annotation)
 			}
-			members = append(members, member)
-			newMembers.Insert(fmt.Sprintf("%s-%s-%d-%d", node.Name, addr, member.ProtocolPort, svcConf.healthCheckNodePort))
+		}
+		if len(monitorAnnotations) > 0 {
+			ignored = append(ignored, fmt.Sprintf("annotations %s are ignored, annotation %s disables the health monitor", strings.Join(monitorAnnotations, ", "), ServiceAnnotationLoadBalancerEnableHealthMonitor))
 		}
 	}
-	return members, newMembers, nil
+
+	if len(conflicts) == 0 && len(ignored) == 0 {
+		return nil
+	}
+	message := strings.Join(append(append([]string{}, conflicts...), ignored...), "; ")
+	lbaas.eventRecorder.Event(service, corev1.EventTypeWarning, eventLBConfigConflict, message)
+	if len(conflicts) > 0 {
+		return asTerminalError(errors.New(strings.Join(conflicts, "; ")))
+	}
+	return nil
+}
+
+// getPoolGroups parses the ServiceAnnotationLoadBalancerSharedPoolGroups annotation into a map of Service port names to
+// group names. Ports sharing a pool must use the same protocol.
+func getPoolGroups(service *corev1.Service) (map[string]string, error) {
+	value := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerSharedPoolGroups, "")
+	if value == "" {
+		return nil, nil
+	}
+
+	ports := make(map[string]corev1.ServicePort)
+	for _, port := range service.Spec.Ports {
+		ports[port.Name] = port
+	}
+
+	groups := make(map[string]string)
+	groupProtocols := make(map[string]corev1.Protocol)
+	for _, pair := range strings.Split(value, ",") {
+		portName, group, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || portName == "" || group == "" {
+			return nil, fmt.Errorf("invalid value %q of annotation %s, expected comma-separated <port-name>=<group> pairs", value, ServiceAnnotationLoadBalancerSharedPoolGroups)
+		}
+		port, ok := ports[portName]
+		if !ok {
+			return nil, fmt.Errorf("port %q referenced by annotation %s does not exist", portName, ServiceAnnotationLoadBalancerSharedPoolGroups)
+		}
+		if protocol, ok := groupProtocols[group]; ok && protocol != port.Protocol {
+			return nil, fmt.Errorf("ports sharing pool group %q must use the same protocol", group)
+		}
+		groupProtocols[group] = port.Protocol
+		groups[portName] = group
+	}
+
+	return groups, nil
+}
+
+// getMemberPorts parses the ServiceAnnotationLoadBalancerMemberPorts annotation into a map of Service port names to
+// member ports. The port given without name is stored under every port name not listed.
+func getMemberPorts(service *corev1.Service) (map[string]int, error) {
+	value := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerMemberPorts, "")
+	if value == "" {
+		return nil, nil
+	}
+
+	ports := sets.New[string]()
+	for _, port := range service.Spec.Ports {
+		ports.Insert(port.Name)
+	}
+
+	memberPorts := make(map[string]int)
+	defaultPort := 0
+	for _, pair := range strings.Split(value, ",") {
+		portName, memberPort, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			portName, memberPort = "", portName
+		}
+		port, err := strconv.Atoi(memberPort)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid value %q of annotation %s, expected comma-separated <port-name>=<port> pairs with ports between 1 and 65535", value, ServiceAnnotationLoadBalancerMemberPorts)
+		}
+		if portName == "" {
+			defaultPort = port
+			continue
+		}
+		if !ports.Has(portName) {
+			return nil, fmt.Errorf("port %q referenced by annotation %s does not exist", portName, ServiceAnnotationLoadBalancerMemberPorts)
+		}
+		memberPorts[portName] = port
+	}
+
+	if defaultPort != 0 {
+		for portName := range ports {
+			if _, ok := memberPorts[portName]; !ok {
+				memberPorts[portName] = defaultPort
+			}
+		}
+	}
+
+	return memberPorts, nil
+}
+
+// getAdminStateUp parses the ServiceAnnotationLoadBalancerAdminState annotation, it returns nil if it isn't set.
+func getAdminStateUp(service *corev1.Service) (*bool, error) {
+	value := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerAdminState, "")
+	switch strings.ToLower(value) {
+	case "":
+		return nil, nil
+	case "up", "down":
+		up := strings.EqualFold(value, "up")
+		return &up, nil
+	}
+	return nil, fmt.Errorf("invalid value %q of annotation %s, expected up or down", value, ServiceAnnotationLoadBalancerAdminState)
+}
+
+// getMemberPort returns the port the members of the pool of the Service port listen on, the node port unless it's
+// overridden with the ServiceAnnotationLoadBalancerMemberPorts annotation. It's 0 when there's no node port, i.e. when
+// AllocateLoadBalancerNodePorts=False, and it isn't overridden.
+func getMemberPort(port corev1.ServicePort, svcConf *serviceConfig) int {
+	if memberPort, ok := svcConf.memberPorts[port.Name]; ok {
+		return memberPort
+	}
+	return int(port.NodePort)
+}
+
+func (lbaas *LbaasV2) buildPoolCreateOpt(listenerProtocol string, service *corev1.Service, svcConf *serviceConfig) v2pools.CreateOpts {
+	// By default, use the protocol of the listener
+	poolProto := v2pools.Protocol(listenerProtocol)
+	if svcConf.enableProxyProtocol {
+		poolProto = v2pools.ProtocolPROXY
+	} else if (svcConf.keepClientIP || svcConf.tlsContainerRef != "") && poolProto != v2pools.ProtocolHTTP {
+		if svcConf.keepClientIP && svcConf.tlsContainerRef != "" {
+			klog.V(4).Infof("Forcing to use %q protocol for pool because annotations %q %q are set", v2pools.ProtocolHTTP, ServiceAnnotationLoadBalancerXForwardedFor, ServiceAnnotationTlsContainerRef)
+		} else if svcConf.keepClientIP {
+			klog.V(4).Infof("Forcing to use %q protocol for pool because annotation %q is set", v2pools.ProtocolHTTP, ServiceAnnotationLoadBalancerXForwardedFor)
+		} else {
+			klog.V(4).Infof("Forcing to use %q protocol for pool because annotations %q is set", v2pools.ProtocolHTTP, ServiceAnnotationTlsContainerRef)
+		}
+		poolProto = v2pools.ProtocolHTTP
+	}
+
+	// The timeout can't be set on creation, ensureOctaviaPool takes care of it.
+	var persistence *v2pools.SessionPersistence
+	if svcConf.sessionPersistence != nil {
+		persistence = &v2pools.SessionPersistence{
+			Type:       svcConf.sessionPersistence.Type,
+			CookieName: svcConf.sessionPersistence.CookieName,
+		}
+	}
+
+	lbmethod := v2pools.LBMethod(lbaas.opts.LBMethod)
+	createOpt := v2pools.CreateOpts{
+		Protocol:    poolProto,
+		LBMethod:    lbmethod,
+		Persistence: persistence,
+		Description: svcConf.description,
+	}
+	if svcConf.supportLBTags {
+		createOpt.Tags = svcConf.tags
+	}
+	return createOpt
+}
+
+// defaultDescription renders the description of the Octavia resources when description-template isn't set.
+var defaultDescription = template.Must(parseDescriptionTemplate(defaultDescriptionTemplate))
+
+// descriptionTemplateData is what the description-template option gets rendered with.
+type descriptionTemplateData struct {
+	Namespace   string
+	Name        string
+	ClusterName string
+}
+
+// parseDescriptionTemplate parses the description-template option. The template is rendered once with empty data, so
+// that the references to unknown fields are caught too, not only the syntax errors.
+func parseDescriptionTemplate(descriptionTemplate string) (*template.Template, error) {
+	tmpl, err := template.New("description").Parse(descriptionTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid description-template: %v", err)
+	}
+	if err := tmpl.Execute(io.Discard, descriptionTemplateData{}); err != nil {
+		return nil, fmt.Errorf("invalid description-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// getDescription renders the description of the Octavia resources of the Service.
+func (lbaas *LbaasV2) getDescription(clusterName string, service *corev1.Service) (string, error) {
+	tmpl := lbaas.description
+	if tmpl == nil {
+		tmpl = defaultDescription
+	}
+
+	var description strings.Builder
+	data := descriptionTemplateData{Namespace: service.Namespace, Name: service.Name, ClusterName: clusterName}
+	if err := tmpl.Execute(&description, data); err != nil {
+		return "", fmt.Errorf("failed to render description-template: %v", err)
+	}
+	return cpoutil.CutString255(description.String()), nil
+}
+
+// getSessionPersistence returns the session persistence requested for the Service's pools, nil if it's disabled.
+// The annotation takes precedence over the sessionAffinity of the Service.
+func getSessionPersistence(service *corev1.Service) (*openstackutil.SessionPersistence, error) {
+	var persistence *openstackutil.SessionPersistence
+	if value, ok := service.Annotations[ServiceAnnotationLoadBalancerSessionPersistence]; ok {
+		switch {
+		case value == "none":
+			return nil, nil
+		case value == "SOURCE_IP" || value == "HTTP_COOKIE":
+			persistence = &openstackutil.SessionPersistence{Type: value}
+		case strings.HasPrefix(value, "APP_COOKIE:") && len(value) > len("APP_COOKIE:"):
+			persistence = &openstackutil.SessionPersistence{Type: "APP_COOKIE", CookieName: strings.TrimPrefix(value, "APP_COOKIE:")}
+		default:
+			return nil, fmt.Errorf("invalid value %q of annotation %s", value, ServiceAnnotationLoadBalancerSessionPersistence)
+		}
+	} else if service.Spec.SessionAffinity == corev1.ServiceAffinityClientIP {
+		persistence = &openstackutil.SessionPersistence{Type: "SOURCE_IP"}
+	} else {
+		return nil, nil
+	}
+
+	if persistence.Type == "SOURCE_IP" {
+		if cfg := service.Spec.SessionAffinityConfig; cfg != nil && cfg.ClientIP != nil && cfg.ClientIP.TimeoutSeconds != nil {
+			persistence.PersistenceTimeout = int(*cfg.ClientIP.TimeoutSeconds)
+		}
+	}
+
+	return persistence, nil
+}
+
+// ensurePoolSessionPersistence makes sure the session persistence of the pool matches the Service.
+func (lbaas *LbaasV2) ensurePoolSessionPersistence(lbID string, pool *v2pools.Pool, svcConf *serviceConfig) error {
+	var persistence *openstackutil.SessionPersistence
+	if svcConf.sessionPersistence != nil {
+		p := *svcConf.sessionPersistence
+		// Octavia supports the timeout only for UDP and SCTP pools.
+		if pool.Protocol != string(v2pools.ProtocolUDP) && pool.Protocol != string(v2pools.ProtocolSCTP) {
+			p.PersistenceTimeout = 0
+		}
+		persistence = &p
+	}
+
+	changed := false
+	if persistence == nil {
+		changed = pool.Persistence.Type != ""
+	} else if pool.Persistence.Type != persistence.Type || pool.Persistence.CookieName != persistence.CookieName {
+		changed = true
+	} else if persistence.PersistenceTimeout > 0 {
+		// gophercloud doesn't return the timeout as part of the pool, so it has to be checked separately.
+		current, err := openstackutil.GetPoolSessionPersistence(lbaas.lb, pool.ID)
+		if err != nil {
+			return fmt.Errorf("error getting session persistence of pool %s: %v", pool.ID, err)
+		}
+		changed = current == nil || current.PersistenceTimeout != persistence.PersistenceTimeout
+	}
+
+	if changed {
+		klog.InfoS("Updating pool session persistence", "poolID", pool.ID, "lbID", lbID, "persistence", persistence)
+		if err := openstackutil.UpdatePoolSessionPersistence(lbaas.lb, lbID, pool.ID, persistence); err != nil {
+			return fmt.Errorf("failed to update session persistence of pool %s: %v", pool.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// buildBatchUpdateMemberOpts returns v2pools.BatchUpdateMemberOpts array for Services and Nodes alongside a list of member names
+func (lbaas *LbaasV2) buildBatchUpdateMemberOpts(port corev1.ServicePort, nodes []*corev1.Node, svcConf *serviceConfig) ([]v2pools.BatchUpdateMemberOpts, sets.Set[string], error) {
+	var members []v2pools.BatchUpdateMemberOpts
+	newMembers := sets.New[string]()
+
+	for _, node := range nodes {
+		// Draining nodes keep their members with weight 0 until the grace period is over, so that the existing
+		// connections aren't reset.
+		weight := 1
+		if draining, expired := lbaas.getNodeDrainState(node); expired {
+			klog.V(2).Infof("Removing member of node %s, it's been draining for longer than the grace period", node.Name)
+			continue
+		} else if draining || svcConf.notReadyMembers {
+			weight = 0
+		}
+
+		addr, err := nodeAddressForLB(node, svcConf.preferredIPFamily)
+		if err != nil {
+			if err == cpoerrors.ErrNoAddressFound {
+				// Node failure, do not create member
+				klog.Warningf("Failed to get the address of node %s for creating member: %v", node.Name, err)
+				continue
+			} else {
+				return nil, nil, fmt.Errorf("error getting address of node %s: %v", node.Name, err)
+			}
+		}
+
+		memberSubnetID := &svcConf.lbMemberSubnetID
+		if memberSubnetID != nil && *memberSubnetID == "" {
+			memberSubnetID = nil
+		}
+
+		// With topology aware routing, the members out of the zone of the load balancer only get traffic when the
+		// members of the zone are all down.
+		backup := isBackupMemberNode(node, svcConf)
+
+		if memberPort := getMemberPort(port, svcConf); memberPort != 0 {
+			member := v2pools.BatchUpdateMemberOpts{
+				Address:      addr,
+				ProtocolPort: memberPort,
+				Name:         &node.Name,
+				SubnetID:     memberSubnetID,
+				Weight:       &weight,
+				Backup:       &backup,
+			}
+			if svcConf.healthCheckNodePort > 0 && lbaas.canUseHTTPMonitor(port) {
+				member.MonitorPort = &svcConf.healthCheckNodePort
+			}
+			members = append(members, member)
+			newMembers.Insert(fmt.Sprintf("%s-%s-%d-%d-%d-%t", node.Name, addr, member.ProtocolPort, svcConf.healthCheckNodePort, weight, backup))
+		}
+	}
+	return members, newMembers, nil
 }
 
 // Make sure the listener is created for Service
@@ -1286,7 +2048,7 @@ func (lbaas *LbaasV2) ensureOctaviaListener(lbID string, name string, curListene
 		var err error
 		listener, err = openstackutil.CreateListener(lbaas.lb, lbID, listenerCreateOpt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create listener for loadbalancer %s: %v", lbID, err)
+			return nil, fmt.Errorf("failed to create listener for loadbalancer %s: %w", lbID, err)
 		}
 
 		klog.V(2).Infof("Listener %s created for loadbalancer %s", listener.ID, lbID)
@@ -1295,17 +2057,25 @@ func (lbaas *LbaasV2) ensureOctaviaListener(lbID string, name string, curListene
 		updateOpts := listeners.UpdateOpts{}
 
 		if svcConf.supportLBTags {
-			if !cpoutil.Contains(listener.Tags, svcConf.lbName) {
-				var newTags []string
-				copy(newTags, listener.Tags)
-				newTags = append(newTags, svcConf.lbName)
+			if newTags, changed := syncListenerTags(listener.Tags, getListenerTags(svcConf.tags, port)); changed {
 				updateOpts.Tags = &newTags
 				listenerChanged = true
 			}
 		}
 
-		if svcConf.connLimit != listener.ConnLimit {
-			updateOpts.ConnLimit = &svcConf.connLimit
+		listenerOpts := lbaas.getListenerOpts(listeners.Protocol(listener.Protocol), svcConf)
+		if *listenerOpts.ConnectionLimit != listener.ConnLimit {
+			updateOpts.ConnLimit = listenerOpts.ConnectionLimit
+			listenerChanged = true
+		}
+
+		if svcConf.description != listener.Description {
+			updateOpts.Description = &svcConf.description
+			listenerChanged = true
+		}
+
+		if svcConf.adminStateUp != nil && *svcConf.adminStateUp != listener.AdminStateUp {
+			updateOpts.AdminStateUp = svcConf.adminStateUp
 			listenerChanged = true
 		}
 
@@ -1327,20 +2097,20 @@ func (lbaas *LbaasV2) ensureOctaviaListener(lbID string, name string, curListene
 			listenerChanged = true
 		}
 		if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTimeout, lbaas.opts.LBProvider) {
-			if svcConf.timeoutClientData != listener.TimeoutClientData {
-				updateOpts.TimeoutClientData = &svcConf.timeoutClientData
+			if *listenerOpts.TimeoutClientData != listener.TimeoutClientData {
+				updateOpts.TimeoutClientData = listenerOpts.TimeoutClientData
 				listenerChanged = true
 			}
-			if svcConf.timeoutMemberConnect != listener.TimeoutMemberConnect {
-				updateOpts.TimeoutMemberConnect = &svcConf.timeoutMemberConnect
+			if *listenerOpts.TimeoutMemberConnect != listener.TimeoutMemberConnect {
+				updateOpts.TimeoutMemberConnect = listenerOpts.TimeoutMemberConnect
 				listenerChanged = true
 			}
-			if svcConf.timeoutMemberData != listener.TimeoutMemberData {
-				updateOpts.TimeoutMemberData = &svcConf.timeoutMemberData
+			if *listenerOpts.TimeoutMemberData != listener.TimeoutMemberData {
+				updateOpts.TimeoutMemberData = listenerOpts.TimeoutMemberData
 				listenerChanged = true
 			}
-			if svcConf.timeoutTCPInspect != listener.TimeoutTCPInspect {
-				updateOpts.TimeoutTCPInspect = &svcConf.timeoutTCPInspect
+			if *listenerOpts.TimeoutTCPInspect != listener.TimeoutTCPInspect {
+				updateOpts.TimeoutTCPInspect = listenerOpts.TimeoutTCPInspect
 				listenerChanged = true
 			}
 		}
@@ -1363,6 +2133,15 @@ func (lbaas *LbaasV2) ensureOctaviaListener(lbID string, name string, curListene
 	return listener, nil
 }
 
+// getListenerOpts returns the connection limit and timeouts of the listeners of the protocol. The Service annotations
+// win over the [LoadBalancerListener] section of the protocol, which wins over [LoadBalancer].
+func (lbaas *LbaasV2) getListenerOpts(protocol listeners.Protocol, svcConf *serviceConfig) ListenerOpts {
+	opts := lbaas.opts.defaultListenerOpts()
+	opts.override(lbaas.opts.ListenerOpts[string(protocol)])
+	opts.override(&svcConf.listenerOpts)
+	return *opts
+}
+
 // buildListenerCreateOpt returns listeners.CreateOpts for a specific Service port and configuration
 func (lbaas *LbaasV2) buildListenerCreateOpt(port corev1.ServicePort, svcConf *serviceConfig) listeners.CreateOpts {
 	listenerProtocol := listeners.Protocol(port.Protocol)
@@ -1370,18 +2149,12 @@ func (lbaas *LbaasV2) buildListenerCreateOpt(port corev1.ServicePort, svcConf *s
 	listenerCreateOpt := listeners.CreateOpts{
 		Protocol:     listenerProtocol,
 		ProtocolPort: int(port.Port),
-		ConnLimit:    &svcConf.connLimit,
+		Description:  svcConf.description,
+		AdminStateUp: svcConf.adminStateUp,
 	}
 
 	if svcConf.supportLBTags {
-		listenerCreateOpt.Tags = []string{svcConf.lbName}
-	}
-
-	if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTimeout, lbaas.opts.LBProvider) {
-		listenerCreateOpt.TimeoutClientData = &svcConf.timeoutClientData
-		listenerCreateOpt.TimeoutMemberConnect = &svcConf.timeoutMemberConnect
-		listenerCreateOpt.TimeoutMemberData = &svcConf.timeoutMemberData
-		listenerCreateOpt.TimeoutTCPInspect = &svcConf.timeoutTCPInspect
+		listenerCreateOpt.Tags = getListenerTags(svcConf.tags, port)
 	}
 
 	if svcConf.keepClientIP {
@@ -1401,6 +2174,15 @@ func (lbaas *LbaasV2) buildListenerCreateOpt(port corev1.ServicePort, svcConf *s
 		listenerCreateOpt.Protocol = listeners.ProtocolHTTP
 	}
 
+	listenerOpts := lbaas.getListenerOpts(listenerCreateOpt.Protocol, svcConf)
+	listenerCreateOpt.ConnLimit = listenerOpts.ConnectionLimit
+	if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTimeout, lbaas.opts.LBProvider) {
+		listenerCreateOpt.TimeoutClientData = listenerOpts.TimeoutClientData
+		listenerCreateOpt.TimeoutMemberConnect = listenerOpts.TimeoutMemberConnect
+		listenerCreateOpt.TimeoutMemberData = listenerOpts.TimeoutMemberData
+		listenerCreateOpt.TimeoutTCPInspect = listenerOpts.TimeoutTCPInspect
+	}
+
 	if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureVIPACL, lbaas.opts.LBProvider) {
 		if len(svcConf.allowedCIDR) > 0 {
 			listenerCreateOpt.AllowedCIDRs = svcConf.allowedCIDR
@@ -1422,7 +2204,7 @@ func (lbaas *LbaasV2) getMemberSubnetID(service *corev1.Service, svcConf *servic
 	if configClassName != "" {
 		lbClass := lbaas.opts.LBClasses[configClassName]
 		if lbClass == nil {
-			return "", fmt.Errorf("invalid loadbalancer class %q", configClassName)
+			return "", asTerminalError(fmt.Errorf("invalid loadbalancer class %q", configClassName))
 		}
 		if lbClass.MemberSubnetID != "" {
 			return lbClass.MemberSubnetID, nil
@@ -1450,7 +2232,7 @@ func (lbaas *LbaasV2) getSubnetID(service *corev1.Service, svcConf *serviceConfi
 	if configClassName != "" {
 		lbClass := lbaas.opts.LBClasses[configClassName]
 		if lbClass == nil {
-			return "", fmt.Errorf("invalid loadbalancer class %q", configClassName)
+			return "", asTerminalError(fmt.Errorf("invalid loadbalancer class %q", configClassName))
 		}
 		if lbClass.SubnetID != "" {
 			return lbClass.SubnetID, nil
@@ -1478,7 +2260,7 @@ func (lbaas *LbaasV2) getNetworkID(service *corev1.Service, svcConf *serviceConf
 	if configClassName != "" {
 		lbClass := lbaas.opts.LBClasses[configClassName]
 		if lbClass == nil {
-			return "", fmt.Errorf("invalid loadbalancer class %q", configClassName)
+			return "", asTerminalError(fmt.Errorf("invalid loadbalancer class %q", configClassName))
 		}
 		if lbClass.NetworkID != "" {
 			return lbClass.NetworkID, nil
@@ -1493,9 +2275,111 @@ func (lbaas *LbaasV2) getNetworkID(service *corev1.Service, svcConf *serviceConf
 	return "", nil
 }
 
+// checkInternalAnnotations rejects a Service requesting an internal load balancer with the annotations of a floating
+// IP, which an internal load balancer never gets.
+func checkInternalAnnotations(service *corev1.Service) error {
+	if !getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerInternal, false) {
+		return nil
+	}
+	floatingIPAnnotations := []string{
+		ServiceAnnotationLoadBalancerFloatingNetworkID,
+		ServiceAnnotationLoadBalancerFloatingSubnetID,
+		ServiceAnnotationLoadBalancerFloatingSubnet,
+		ServiceAnnotationLoadBalancerFloatingSubnetTags,
+		ServiceAnnotationLoadBalancerIncludeVIPAddress,
+		ServiceAnnotationLoadBalancerFloatingIPQosPolicyID,
+	}
+	for _, annotation := range floatingIPAnnotations {
+		if _, ok := service.Annotations[annotation]; ok {
+			return asTerminalError(fmt.Errorf("annotation %s cannot be used with %s, an internal load balancer has no floating IP", annotation, ServiceAnnotationLoadBalancerInternal))
+		}
+	}
+	return nil
+}
+
+// checkInternalVIPNetwork makes sure the VIP of an internal load balancer isn't on an external network, where it would
+// be reachable from outside of the cloud without a floating IP. The network of the VIP subnet is checked if it's set.
+func (lbaas *LbaasV2) checkInternalVIPNetwork(subnetID, networkID string) error {
+	if subnetID != "" {
+		mc := metrics.NewMetricContext("subnet", "get")
+		subnet, err := subnets.Get(lbaas.network, subnetID).Extract()
+		if mc.ObserveRequest(err) != nil {
+			return fmt.Errorf("failed to find subnet %q: %w", subnetID, err)
+		}
+		networkID = subnet.NetworkID
+	}
+	if networkID == "" {
+		return nil
+	}
+
+	external, err := openstackutil.IsExternalNetwork(lbaas.network, networkID)
+	if err != nil {
+		return fmt.Errorf("failed to get network %s: %w", networkID, err)
+	}
+	if !external {
+		return nil
+	}
+	if subnetID != "" {
+		return asTerminalError(fmt.Errorf("subnet %s of the internal load balancer belongs to external network %s", subnetID, networkID))
+	}
+	return asTerminalError(fmt.Errorf("network %s of the internal load balancer is external", networkID))
+}
+
+// setSourceRanges calculates the source ranges enforced by the listeners' allowed_cidrs and by the security group of the
+// members. Both get the same ranges when they're both available, unless source-ranges-enforcement picks one of them.
+// The ranges not enforced by any of them are reported with an event, or fail the Service if allowed_cidrs are picked and
+// aren't available.
+func (lbaas *LbaasV2) setSourceRanges(service *corev1.Service, svcConf *serviceConfig) error {
+	serviceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+	sourceRanges, err := GetLoadBalancerSourceRanges(service, svcConf.preferredIPFamily)
+	if err != nil {
+		return fmt.Errorf("failed to get source ranges for loadbalancer service %s: %v", serviceName, err)
+	}
+	ranges := sourceRanges.StringSlice()
+
+	mode := lbaas.opts.SourceRangesEnforcement
+	useAllowedCIDRs := mode != sourceRangesEnforcementSecurityGroups &&
+		openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureVIPACL, lbaas.opts.LBProvider)
+	useSecurityGroups := mode != sourceRangesEnforcementAllowedCIDRs &&
+		lbaas.opts.LBProvider == "ovn" && lbaas.opts.ManageSecurityGroups
+
+	if useAllowedCIDRs {
+		klog.V(4).InfoS("LoadBalancerSourceRanges will be enforced by the allowed_cidrs of the listeners", "service", serviceName)
+		svcConf.allowedCIDR = ranges
+	} else {
+		// Makes sure no stale allowed_cidrs are left when the security group is the one enforcing the ranges.
+		svcConf.allowedCIDR = []string{}
+	}
+
+	if useSecurityGroups {
+		klog.V(4).InfoS("LoadBalancerSourceRanges will be enforced on the SG created and attached to LB members", "service", serviceName)
+		svcConf.securityGroupCIDRs = ranges
+	} else if svcConf.preferredIPFamily == corev1.IPv6Protocol {
+		svcConf.securityGroupCIDRs = []string{defaultLoadBalancerSourceRangesIPv6}
+	} else {
+		svcConf.securityGroupCIDRs = []string{defaultLoadBalancerSourceRangesIPv4}
+	}
+
+	if useAllowedCIDRs || useSecurityGroups ||
+		cpoutil.Contains(ranges, defaultLoadBalancerSourceRangesIPv4) || cpoutil.Contains(ranges, defaultLoadBalancerSourceRangesIPv6) {
+		return nil
+	}
+	if mode == sourceRangesEnforcementAllowedCIDRs {
+		// source-ranges-enforcement is validated to be usable with the provider, only the Octavia version can miss it.
+		featureErr := openstackutil.CheckOctaviaFeature(lbaas.lb, openstackutil.OctaviaFeatureVIPACL, lbaas.opts.LBProvider)
+		err = fmt.Errorf("LoadBalancerSourceRanges %v cannot be enforced with allowed_cidrs: %v", ranges, featureErr)
+		lbaas.eventRecorder.Event(service, corev1.EventTypeWarning, eventLBSourceRangesIgnored, err.Error())
+		return err
+	}
+	klog.Warningf("LoadBalancerSourceRanges %v of Service %s are ignored, neither allowed_cidrs nor security groups can enforce them", ranges, serviceName)
+	lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBSourceRangesIgnored,
+		"LoadBalancerSourceRanges %v are ignored, neither allowed_cidrs nor security groups can enforce them", ranges)
+	return nil
+}
+
 func (lbaas *LbaasV2) checkServiceUpdate(service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) error {
 	if len(service.Spec.Ports) == 0 {
-		return fmt.Errorf("no ports provided to openstack load balancer")
+		return asTerminalError(fmt.Errorf("no ports provided to openstack load balancer"))
 	}
 	serviceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
 
@@ -1505,6 +2389,10 @@ func (lbaas *LbaasV2) checkServiceUpdate(service *corev1.Service, nodes []*corev
 		svcConf.preferredIPFamily = service.Spec.IPFamilies[0]
 	}
 
+	if err := lbaas.checkEligibleNodes(service, nodes, svcConf, false); err != nil {
+		return err
+	}
+
 	svcConf.lbID = getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerID, "")
 	svcConf.supportLBTags = openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTags, lbaas.opts.LBProvider)
 
@@ -1522,7 +2410,7 @@ func (lbaas *LbaasV2) checkServiceUpdate(service *corev1.Service, nodes []*corev
 		if svcConf.configClassName != "" {
 			lbClass := lbaas.opts.LBClasses[svcConf.configClassName]
 			if lbClass == nil {
-				return fmt.Errorf("invalid loadbalancer class %q", svcConf.configClassName)
+				return asTerminalError(fmt.Errorf("invalid loadbalancer class %q", svcConf.configClassName))
 			}
 
 			if lbClass.SubnetID != "" {
@@ -1541,25 +2429,82 @@ func (lbaas *LbaasV2) checkServiceUpdate(service *corev1.Service, nodes []*corev
 	}
 
 	// This affects the protocol of listener and pool
-	keepClientIP := getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerXForwardedFor, false)
-	useProxyProtocol := getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerProxyEnabled, false)
-	if useProxyProtocol && keepClientIP {
-		return fmt.Errorf("annotation %s and %s cannot be used together", ServiceAnnotationLoadBalancerProxyEnabled, ServiceAnnotationLoadBalancerXForwardedFor)
+	svcConf.keepClientIP = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerXForwardedFor, false)
+	svcConf.enableProxyProtocol = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerProxyEnabled, false)
+
+	if err := lbaas.setSourceRanges(service, svcConf); err != nil {
+		return err
 	}
-	svcConf.keepClientIP = keepClientIP
-	svcConf.enableProxyProtocol = useProxyProtocol
+	lbaas.setEndpointsReadiness(service, svcConf)
 
 	svcConf.tlsContainerRef = getStringFromServiceAnnotation(service, ServiceAnnotationTlsContainerRef, lbaas.opts.TlsContainerRef)
 	svcConf.enableMonitor = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerEnableHealthMonitor, lbaas.opts.CreateMonitor)
-	if svcConf.enableMonitor && service.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyTypeLocal && service.Spec.HealthCheckNodePort > 0 {
+	if svcConf.enableMonitor && lbaas.getExternalTrafficPolicy(service) == corev1.ServiceExternalTrafficPolicyLocal && service.Spec.HealthCheckNodePort > 0 {
 		svcConf.healthCheckNodePort = int(service.Spec.HealthCheckNodePort)
 	}
 	svcConf.healthMonitorDelay = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorDelay, int(lbaas.opts.MonitorDelay.Duration.Seconds()))
 	svcConf.healthMonitorTimeout = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorTimeout, int(lbaas.opts.MonitorTimeout.Duration.Seconds()))
 	svcConf.healthMonitorMaxRetries = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorMaxRetries, int(lbaas.opts.MonitorMaxRetries))
+	svcConf.healthMonitorMaxRetriesDown = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorMaxRetriesDown, int(lbaas.opts.MonitorMaxRetriesDown))
+	if svcConf.enableMonitor {
+		if err := validateHealthMonitor(svcConf); err != nil {
+			lbaas.eventRecorder.Event(service, corev1.EventTypeWarning, eventLBHealthMonitorInvalid, err.Error())
+			return asTerminalError(err)
+		}
+	}
+	if err := lbaas.checkClientIPConfig(service, svcConf); err != nil {
+		return err
+	}
+
+	poolGroups, err := getPoolGroups(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.poolGroups = poolGroups
+
+	memberPorts, err := getMemberPorts(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.memberPorts = memberPorts
+
+	adminStateUp, err := getAdminStateUp(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.adminStateUp = adminStateUp
+
+	sessionPersistence, err := getSessionPersistence(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.sessionPersistence = sessionPersistence
+
+	l7Routes, err := getL7Routes(service, svcConf, lbaas.opts.LBProvider)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.l7Routes = l7Routes
 	return nil
 }
 
+// getQosPolicyID returns the Neutron QoS policy set in the annotation, making sure it exists.
+func (lbaas *LbaasV2) getQosPolicyID(service *corev1.Service, annotation string) (string, error) {
+	policyID := getStringFromServiceAnnotation(service, annotation, "")
+	if policyID == "" {
+		return "", nil
+	}
+
+	exists, err := openstackutil.QosPolicyExists(lbaas.network, policyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get QoS policy %s: %v", policyID, err)
+	}
+	if !exists {
+		return "", asTerminalError(fmt.Errorf("QoS policy %s referenced by annotation %s does not exist", policyID, annotation))
+	}
+	return policyID, nil
+}
+
 func (lbaas *LbaasV2) checkServiceDelete(service *corev1.Service, svcConf *serviceConfig) error {
 	svcConf.lbID = getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerID, "")
 	svcConf.supportLBTags = openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTags, lbaas.opts.LBProvider)
@@ -1575,12 +2520,12 @@ func (lbaas *LbaasV2) checkServiceDelete(service *corev1.Service, svcConf *servi
 func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) error {
 	serviceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
 
-	if len(nodes) == 0 {
-		return fmt.Errorf("there are no available nodes for LoadBalancer service %s", serviceName)
+	if err := lbaas.checkEligibleNodes(service, nodes, svcConf, true); err != nil {
+		return err
 	}
 	ports := service.Spec.Ports
 	if len(ports) == 0 {
-		return fmt.Errorf("no service ports provided")
+		return asTerminalError(fmt.Errorf("no service ports provided"))
 	}
 
 	if len(service.Spec.IPFamilies) > 0 {
@@ -1589,6 +2534,22 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 		svcConf.preferredIPFamily = service.Spec.IPFamilies[0]
 	}
 
+	ingressHostname, err := getIngressHostname(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.ingressHostname = ingressHostname
+	svcConf.ingressHostnameIncludeIP = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHostnameIncludeIP, false)
+
+	fipPTRRecord, err := getFloatingIPPTRRecord(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	if fipPTRRecord != "" && lbaas.dns == nil {
+		return asTerminalError(fmt.Errorf("annotation %s requires the DNS service, none was found in the catalog", ServiceAnnotationLoadBalancerFloatingIPPTRRecord))
+	}
+	svcConf.fipPTRRecord = fipPTRRecord
+
 	svcConf.lbID = getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerID, "")
 	svcConf.supportLBTags = openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTags, lbaas.opts.LBProvider)
 
@@ -1604,12 +2565,19 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 	} else {
 		svcConf.internal = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerInternal, lbaas.opts.InternalLB)
 	}
+	if err := checkInternalAnnotations(service); err != nil {
+		return err
+	}
+	svcConf.includeVIPAddress = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerIncludeVIPAddress, false)
+	if svcConf.includeVIPAddress && svcConf.internal {
+		return asTerminalError(fmt.Errorf("annotation %s requires a floating IP, the load balancer of Service %s is internal", ServiceAnnotationLoadBalancerIncludeVIPAddress, serviceName))
+	}
 
 	svcConf.tlsContainerRef = getStringFromServiceAnnotation(service, ServiceAnnotationTlsContainerRef, lbaas.opts.TlsContainerRef)
 	if svcConf.tlsContainerRef != "" {
 		if lbaas.secret == nil {
-			return fmt.Errorf("failed to create a TLS Terminated loadbalancer because openstack keymanager client is not "+
-				"initialized and default-tls-container-ref %q is set", svcConf.tlsContainerRef)
+			return asTerminalError(fmt.Errorf("failed to create a TLS Terminated loadbalancer because openstack keymanager client is not "+
+				"initialized and default-tls-container-ref %q is set", svcConf.tlsContainerRef))
 		}
 
 		// check if container exists for 'barbican' container store
@@ -1625,20 +2593,34 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 		}
 	}
 
-	svcConf.connLimit = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerConnLimit, -1)
+	svcConf.listenerOpts.ConnectionLimit = getOptionalIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerConnLimit)
 
 	lbNetworkID, err := lbaas.getNetworkID(service, svcConf)
 	if err != nil {
-		return fmt.Errorf("failed to get network id to create load balancer for service %s: %v", serviceName, err)
+		return fmt.Errorf("failed to get network id to create load balancer for service %s: %w", serviceName, err)
 	}
 	svcConf.lbNetworkID = lbNetworkID
 
 	lbSubnetID, err := lbaas.getSubnetID(service, svcConf)
 	if err != nil {
-		return fmt.Errorf("failed to get subnet to create load balancer for service %s: %v", serviceName, err)
+		return fmt.Errorf("failed to get subnet to create load balancer for service %s: %w", serviceName, err)
 	}
 	svcConf.lbSubnetID = lbSubnetID
 
+	// Only checked when the Service asks for it, IPv6 load balancers are internal too as they have no floating IP, and may
+	// be on an external network on purpose
+	if getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerInternal, false) {
+		if err := lbaas.checkInternalVIPNetwork(svcConf.lbSubnetID, svcConf.lbNetworkID); err != nil {
+			return fmt.Errorf("invalid VIP subnet for internal service %s: %w", serviceName, err)
+		}
+	}
+	// A VIP on an external network gets no floating IP, there would be a single address to report.
+	if svcConf.includeVIPAddress {
+		if err := lbaas.checkInternalVIPNetwork(svcConf.lbSubnetID, svcConf.lbNetworkID); err != nil {
+			return fmt.Errorf("invalid VIP subnet for service %s with annotation %s: %w", serviceName, ServiceAnnotationLoadBalancerIncludeVIPAddress, err)
+		}
+	}
+
 	if lbaas.opts.SubnetID != "" {
 		svcConf.lbMemberSubnetID = lbaas.opts.SubnetID
 	} else {
@@ -1674,7 +2656,7 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 		if svcConf.configClassName != "" {
 			lbClass = lbaas.opts.LBClasses[svcConf.configClassName]
 			if lbClass == nil {
-				return fmt.Errorf("invalid loadbalancer class %q", svcConf.configClassName)
+				return asTerminalError(fmt.Errorf("invalid loadbalancer class %q", svcConf.configClassName))
 			}
 
 			klog.V(4).Infof("Found loadbalancer class %q with %+v", svcConf.configClassName, lbClass)
@@ -1725,11 +2707,11 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 			mc := metrics.NewMetricContext("subnet", "get")
 			subnet, err := subnets.Get(lbaas.network, floatingSubnet.subnetID).Extract()
 			if mc.ObserveRequest(err) != nil {
-				return fmt.Errorf("failed to find subnet %q: %v", floatingSubnet.subnetID, err)
+				return fmt.Errorf("failed to find subnet %q: %w", floatingSubnet.subnetID, err)
 			}
 
 			if subnet.NetworkID != floatingNetworkID {
-				return fmt.Errorf("floating IP subnet %q doesn't belong to the network %q", floatingSubnet.subnetID, subnet.NetworkID)
+				return asTerminalError(fmt.Errorf("floating IP subnet %q doesn't belong to the network %q", floatingSubnet.subnetID, subnet.NetworkID))
 			}
 		}
 
@@ -1744,34 +2726,20 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 		klog.V(4).Infof("Ensure an internal loadbalancer service.")
 	}
 
-	keepClientIP := getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerXForwardedFor, false)
-	useProxyProtocol := getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerProxyEnabled, false)
-	if useProxyProtocol && keepClientIP {
-		return fmt.Errorf("annotation %s and %s cannot be used together", ServiceAnnotationLoadBalancerProxyEnabled, ServiceAnnotationLoadBalancerXForwardedFor)
-	}
-	svcConf.keepClientIP = keepClientIP
-	svcConf.enableProxyProtocol = useProxyProtocol
+	svcConf.keepClientIP = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerXForwardedFor, false)
+	svcConf.enableProxyProtocol = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerProxyEnabled, false)
 
 	if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureTimeout, lbaas.opts.LBProvider) {
-		svcConf.timeoutClientData = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutClientData, 50000)
-		svcConf.timeoutMemberConnect = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutMemberConnect, 5000)
-		svcConf.timeoutMemberData = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutMemberData, 50000)
-		svcConf.timeoutTCPInspect = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutTCPInspect, 0)
+		svcConf.listenerOpts.TimeoutClientData = getOptionalIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutClientData)
+		svcConf.listenerOpts.TimeoutMemberConnect = getOptionalIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutMemberConnect)
+		svcConf.listenerOpts.TimeoutMemberData = getOptionalIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutMemberData)
+		svcConf.listenerOpts.TimeoutTCPInspect = getOptionalIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerTimeoutTCPInspect)
 	}
 
-	sourceRanges, err := GetLoadBalancerSourceRanges(service, svcConf.preferredIPFamily)
-	if err != nil {
-		return fmt.Errorf("failed to get source ranges for loadbalancer service %s: %v", serviceName, err)
-	}
-	if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureVIPACL, lbaas.opts.LBProvider) {
-		klog.V(4).Info("LoadBalancerSourceRanges is suppported")
-		svcConf.allowedCIDR = sourceRanges.StringSlice()
-	} else if lbaas.opts.LBProvider == "ovn" && lbaas.opts.ManageSecurityGroups {
-		klog.V(4).Info("LoadBalancerSourceRanges will be enforced on the SG created and attached to LB members")
-		svcConf.allowedCIDR = sourceRanges.StringSlice()
-	} else {
-		klog.Warning("LoadBalancerSourceRanges are ignored")
+	if err := lbaas.setSourceRanges(service, svcConf); err != nil {
+		return err
 	}
+	lbaas.setEndpointsReadiness(service, svcConf)
 
 	if openstackutil.IsOctaviaFeatureSupported(lbaas.lb, openstackutil.OctaviaFeatureFlavors, lbaas.opts.LBProvider) {
 		svcConf.flavorID = getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerFlavorID, lbaas.opts.FlavorID)
@@ -1784,16 +2752,122 @@ func (lbaas *LbaasV2) checkService(service *corev1.Service, nodes []*corev1.Node
 		klog.Warning("LoadBalancer Availability Zones aren't supported. Please, upgrade Octavia API to version 2.14 or later (Ussuri release) to use them")
 	}
 
+	antiAffinityGroup, err := getAntiAffinityGroup(service, lbaas.opts)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.antiAffinityGroup = antiAffinityGroup
+
 	svcConf.enableMonitor = getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerEnableHealthMonitor, lbaas.opts.CreateMonitor)
-	if svcConf.enableMonitor && service.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyTypeLocal && service.Spec.HealthCheckNodePort > 0 {
+	if svcConf.enableMonitor && lbaas.getExternalTrafficPolicy(service) == corev1.ServiceExternalTrafficPolicyLocal && service.Spec.HealthCheckNodePort > 0 {
 		svcConf.healthCheckNodePort = int(service.Spec.HealthCheckNodePort)
 	}
 	svcConf.healthMonitorDelay = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorDelay, int(lbaas.opts.MonitorDelay.Duration.Seconds()))
 	svcConf.healthMonitorTimeout = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorTimeout, int(lbaas.opts.MonitorTimeout.Duration.Seconds()))
 	svcConf.healthMonitorMaxRetries = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorMaxRetries, int(lbaas.opts.MonitorMaxRetries))
+	svcConf.healthMonitorMaxRetriesDown = getIntFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHealthMonitorMaxRetriesDown, int(lbaas.opts.MonitorMaxRetriesDown))
+	if svcConf.enableMonitor {
+		if err := validateHealthMonitor(svcConf); err != nil {
+			lbaas.eventRecorder.Event(service, corev1.EventTypeWarning, eventLBHealthMonitorInvalid, err.Error())
+			return asTerminalError(err)
+		}
+	}
+	if err := lbaas.checkClientIPConfig(service, svcConf); err != nil {
+		return err
+	}
+
+	poolGroups, err := getPoolGroups(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.poolGroups = poolGroups
+
+	memberPorts, err := getMemberPorts(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.memberPorts = memberPorts
+
+	adminStateUp, err := getAdminStateUp(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.adminStateUp = adminStateUp
+
+	sessionPersistence, err := getSessionPersistence(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.sessionPersistence = sessionPersistence
+
+	vipQosPolicyID, err := lbaas.getQosPolicyID(service, ServiceAnnotationLoadBalancerVipQosPolicyID)
+	if err != nil {
+		return err
+	}
+	svcConf.vipQosPolicyID = vipQosPolicyID
+	fipQosPolicyID, err := lbaas.getQosPolicyID(service, ServiceAnnotationLoadBalancerFloatingIPQosPolicyID)
+	if err != nil {
+		return err
+	}
+	svcConf.fipQosPolicyID = fipQosPolicyID
+
+	vipAllowedAddressPairs, err := getVIPAllowedAddressPairs(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.vipAllowedAddressPairs = vipAllowedAddressPairs
+
+	customTags, err := getCustomTags(service)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.customTags = customTags
+
+	l7Routes, err := getL7Routes(service, svcConf, lbaas.opts.LBProvider)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.l7Routes = l7Routes
+
+	rejectClientXForwardedFor, err := getRejectClientXForwardedFor(service, svcConf, lbaas.opts.LBProvider)
+	if err != nil {
+		return asTerminalError(err)
+	}
+	svcConf.rejectClientXForwardedFor = rejectClientXForwardedFor
 	return nil
 }
 
+// getListenerMapping maps the protocol and port of the listeners to the listeners.
+func getListenerMapping(curListeners []listeners.Listener) map[listenerKey]*listeners.Listener {
+	curListenerMapping := make(map[listenerKey]*listeners.Listener, len(curListeners))
+	for i, l := range curListeners {
+		key := listenerKey{Protocol: listeners.Protocol(l.Protocol), Port: l.ProtocolPort}
+		curListenerMapping[key] = &curListeners[i]
+	}
+	return curListenerMapping
+}
+
+// getDriftedListeners returns the listeners of the Service on one of its ports, but using another protocol than the
+// ones expected on that port. A listener can't change protocol, such listeners have to be recreated.
+func getDriftedListeners(service *corev1.Service, svcConf *serviceConfig, curListeners []listeners.Listener, isLBOwner bool, lbName string) []listeners.Listener {
+	wantedKeys := make(map[listenerKey]bool, len(service.Spec.Ports))
+	wantedPorts := make(map[int]bool, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		wantedKeys[listenerKey{Protocol: getListenerProtocol(port.Protocol, svcConf), Port: int(port.Port)}] = true
+		wantedPorts[int(port.Port)] = true
+	}
+
+	var drifted []listeners.Listener
+	for _, listener := range curListeners {
+		owned := (isLBOwner && len(listener.Tags) == 0) || cpoutil.Contains(listener.Tags, lbName)
+		key := listenerKey{Protocol: listeners.Protocol(listener.Protocol), Port: listener.ProtocolPort}
+		if owned && wantedPorts[listener.ProtocolPort] && !wantedKeys[key] {
+			drifted = append(drifted, listener)
+		}
+	}
+	return drifted
+}
+
 // checkListenerPorts checks if there is conflict for ports.
 func (lbaas *LbaasV2) checkListenerPorts(service *corev1.Service, curListenerMapping map[listenerKey]*listeners.Listener, isLBOwner bool, lbName string) error {
 	for _, svcPort := range service.Spec.Ports {
@@ -1841,12 +2915,59 @@ func (lbaas *LbaasV2) updateServiceAnnotations(service *corev1.Service, annotati
 	}
 }
 
-// createLoadBalancerStatus creates the loadbalancer status from the different possible sources
-func (lbaas *LbaasV2) createLoadBalancerStatus(service *corev1.Service, svcConf *serviceConfig, addr string) *corev1.LoadBalancerStatus {
+// getIngressHostname returns the hostname set with the loadbalancer.openstack.org/hostname annotation, e.g. the DNS
+// record of the load balancer, or the domain name of the PTR record of the floating IP with
+// loadbalancer.openstack.org/hostname-from-ptr-record. It has to be a valid DNS subdomain, like the hostnames of the
+// status of a Service.
+func getIngressHostname(service *corev1.Service) (string, error) {
+	hostname := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerLoadbalancerHostname, "")
+	fromPTRRecord := getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerHostnameFromPTRRecord, false)
+	if fromPTRRecord {
+		if hostname != "" {
+			return "", fmt.Errorf("annotations %s and %s can't be used together", ServiceAnnotationLoadBalancerLoadbalancerHostname, ServiceAnnotationLoadBalancerHostnameFromPTRRecord)
+		}
+		ptrRecord, err := getFloatingIPPTRRecord(service)
+		if err != nil {
+			return "", err
+		}
+		if ptrRecord == "" {
+			return "", fmt.Errorf("annotation %s requires annotation %s", ServiceAnnotationLoadBalancerHostnameFromPTRRecord, ServiceAnnotationLoadBalancerFloatingIPPTRRecord)
+		}
+		// The record is fully qualified for Designate, the hostnames of the status aren't.
+		return strings.TrimSuffix(ptrRecord, "."), nil
+	}
+	if hostname == "" {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) > 0 {
+		return "", fmt.Errorf("invalid hostname %q in annotation %s: %s", hostname, ServiceAnnotationLoadBalancerLoadbalancerHostname, strings.Join(errs, ", "))
+	}
+	return hostname, nil
+}
+
+// getHostnameIngress returns the ingress of the status of a Service: the hostname, with the address as well if
+// includeIP is set, or only the address without hostname.
+func getHostnameIngress(hostname string, includeIP bool, addr string) []corev1.LoadBalancerIngress {
+	if hostname == "" {
+		return []corev1.LoadBalancerIngress{{IP: addr}}
+	}
+	if includeIP {
+		return []corev1.LoadBalancerIngress{{IP: addr, Hostname: hostname}}
+	}
+	return []corev1.LoadBalancerIngress{{Hostname: hostname}}
+}
+
+// createLoadBalancerStatus creates the loadbalancer status from the different possible sources. The VIP address is
+// reported after addr if the Service asks for it and it differs, i.e. addr is a floating IP.
+func (lbaas *LbaasV2) createLoadBalancerStatus(service *corev1.Service, svcConf *serviceConfig, addr, vipAddr string) *corev1.LoadBalancerStatus {
 	status := &corev1.LoadBalancerStatus{}
+	includeVIP := svcConf.includeVIPAddress && vipAddr != "" && vipAddr != addr
 	// If hostname is explicetly set
-	if hostname := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerLoadbalancerHostname, ""); hostname != "" {
-		status.Ingress = []corev1.LoadBalancerIngress{{Hostname: hostname}}
+	if svcConf.ingressHostname != "" {
+		status.Ingress = getHostnameIngress(svcConf.ingressHostname, svcConf.ingressHostnameIncludeIP, addr)
+		if includeVIP {
+			status.Ingress = append(status.Ingress, corev1.LoadBalancerIngress{IP: vipAddr})
+		}
 		return status
 	}
 	// If the load balancer is using the PROXY protocol, expose its IP address via
@@ -1857,27 +2978,49 @@ func (lbaas *LbaasV2) createLoadBalancerStatus(service *corev1.Service, svcConf
 	if svcConf.enableProxyProtocol && lbaas.opts.EnableIngressHostname {
 		fakeHostname := fmt.Sprintf("%s.%s", addr, lbaas.opts.IngressHostnameSuffix)
 		status.Ingress = []corev1.LoadBalancerIngress{{Hostname: fakeHostname}}
+		if includeVIP {
+			status.Ingress = append(status.Ingress, corev1.LoadBalancerIngress{Hostname: fmt.Sprintf("%s.%s", vipAddr, lbaas.opts.IngressHostnameSuffix)})
+		}
 		return status
 	}
 	// Default to IP
 	status.Ingress = []corev1.LoadBalancerIngress{{IP: addr}}
+	if includeVIP {
+		status.Ingress = append(status.Ingress, corev1.LoadBalancerIngress{IP: vipAddr})
+	}
 	return status
 }
 
 func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) (lbs *corev1.LoadBalancerStatus, err error) {
-	svcConf := new(serviceConfig)
+	svcConf := &serviceConfig{memberMoves: new(pendingMemberMoves)}
 
 	// Update the service annotations(e.g. add loadbalancer.openstack.org/load-balancer-id) in the end if it doesn't exist.
 	patcher := newServicePatcher(lbaas.kclient, service)
 	defer func() { err = patcher.Patch(ctx, err) }()
 
+	// The region is recorded first, so that the load balancer is looked for in the same region later on, even if
+	// provisioning it fails.
+	if len(lbaas.regional) > 0 {
+		lbaas.updateServiceAnnotations(service, map[string]string{ServiceAnnotationLoadBalancerRegion: lbaas.region})
+	}
+
 	if err := lbaas.checkService(service, nodes, svcConf); err != nil {
 		return nil, err
 	}
+	nodes = lbaas.limitMemberNodes(service, nodes)
+	if svcConf.description, err = lbaas.getDescription(clusterName, service); err != nil {
+		return nil, err
+	}
+	// The amphorae need the routes when they get plugged into the member subnet, i.e. before the first members are added.
+	if err := lbaas.ensureMemberSubnetHostRoutes(svcConf.lbMemberSubnetID); err != nil {
+		return nil, err
+	}
 
 	// Use more meaningful name for the load balancer but still need to check the legacy name for backward compatibility.
 	lbName := lbaas.GetLoadBalancerName(ctx, clusterName, service)
+	previousName := lbaas.getLoadBalancerPreviousName(ctx, clusterName, service)
 	svcConf.lbName = lbName
+	svcConf.tags = getResourceTags(lbName, clusterName, service)
 	serviceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
 	var loadbalancer *loadbalancers.LoadBalancer
 	isLBOwner := false
@@ -1889,6 +3032,9 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 		if err != nil {
 			return nil, fmt.Errorf("failed to get load balancer %s: %v", svcConf.lbID, err)
 		}
+		if err := lbaas.migrateLoadBalancerName(loadbalancer, lbName, previousName); err != nil {
+			return nil, err
+		}
 
 		// If this LB name matches the default generated name, the Service 'owns' the LB, but it's also possible for this
 		// LB to be shared by other Services.
@@ -1922,7 +3068,10 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 		}
 	} else {
 		legacyName := lbaas.getLoadBalancerLegacyName(ctx, clusterName, service)
-		loadbalancer, err = getLoadbalancerByName(lbaas.lb, lbName, legacyName)
+		loadbalancer, err = getLoadbalancerByName(lbaas.lb, lbName, legacyName, previousName)
+		if err == nil {
+			err = lbaas.migrateLoadBalancerName(loadbalancer, lbName, previousName)
+		}
 		if err != nil {
 			if err != cpoerrors.ErrNotFound {
 				return nil, fmt.Errorf("error getting loadbalancer for Service %s: %v", serviceName, err)
@@ -1930,7 +3079,7 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 			klog.InfoS("Creating loadbalancer", "lbName", lbName, "service", klog.KObj(service))
 			loadbalancer, err = lbaas.createOctaviaLoadBalancer(lbName, clusterName, service, nodes, svcConf)
 			if err != nil {
-				return nil, fmt.Errorf("error creating loadbalancer %s: %v", lbName, err)
+				return nil, fmt.Errorf("error creating loadbalancer %s: %w", lbName, err)
 			}
 			createNewLB = true
 		}
@@ -1949,15 +3098,17 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 
 	klog.V(4).InfoS("Load balancer ensured", "lbID", loadbalancer.ID, "isLBOwner", isLBOwner, "createNewLB", createNewLB)
 
+	// The listeners of a new, fully populated load balancer are all the ones of the Service.
+	listenerIDs := make([]string, 0, len(loadbalancer.Listeners))
+	for _, listener := range loadbalancer.Listeners {
+		listenerIDs = append(listenerIDs, listener.ID)
+	}
+
 	// This is an existing load balancer, either created by occm for other Services or by the user outside of cluster, or
 	// a newly created, unpopulated loadbalancer that needs populating.
-	if !createNewLB || (lbaas.opts.ProviderRequiresSerialAPICalls && createNewLB) {
+	if !createNewLB || (lbaas.opts.ProviderRequiresSerialAPICalls && createNewLB) || len(svcConf.poolGroups) > 0 || len(svcConf.l7Routes) > 0 || svcConf.rejectClientXForwardedFor {
 		curListeners := loadbalancer.Listeners
-		curListenerMapping := make(map[listenerKey]*listeners.Listener)
-		for i, l := range curListeners {
-			key := listenerKey{Protocol: listeners.Protocol(l.Protocol), Port: l.ProtocolPort}
-			curListenerMapping[key] = &curListeners[i]
-		}
+		curListenerMapping := getListenerMapping(curListeners)
 		klog.V(4).InfoS("Existing listeners", "portProtocolMapping", curListenerMapping)
 
 		// Check port conflicts
@@ -1965,48 +3116,157 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 			return nil, err
 		}
 
-		for portIndex, port := range service.Spec.Ports {
-			listener, err := lbaas.ensureOctaviaListener(loadbalancer.ID, cpoutil.CutString255(fmt.Sprintf("listener_%d_%s", portIndex, lbName)), curListenerMapping, port, svcConf, service)
-			if err != nil {
+		// The protocol of a listener can't be changed, the listeners of the Service using the wrong one, e.g. because
+		// it was changed manually, are deleted first so that the right ones can be created on their ports.
+		if drifted := getDriftedListeners(service, svcConf, curListeners, isLBOwner, lbName); len(drifted) > 0 {
+			if err := lbaas.deleteOctaviaListeners(loadbalancer.ID, drifted, isLBOwner, lbName); err != nil {
 				return nil, err
 			}
+			for _, listener := range drifted {
+				lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBDriftHealed,
+					"Recreating listener %s of port %d, its protocol %s isn't the expected one", listener.ID, listener.ProtocolPort, listener.Protocol)
+				curListeners = popListener(curListeners, listener.ID)
+			}
+			curListenerMapping = getListenerMapping(curListeners)
+		}
 
-			pool, err := lbaas.ensureOctaviaPool(loadbalancer.ID, cpoutil.CutString255(fmt.Sprintf("pool_%d_%s", portIndex, lbName)), listener, service, port, nodes, svcConf)
-			if err != nil {
+		// The listeners and pools are reconciled with the ports of the Service: the missing ones are created and the
+		// orphan ones deleted, whichever the reconcile order.
+		orphanListeners := getOrphanListeners(service, svcConf, curListeners, isLBOwner, lbName)
+		if missing := getMissingListeners(service, svcConf, curListeners); len(missing) > 0 && !createNewLB {
+			klog.InfoS("Creating the missing listeners of the Service", "lbID", loadbalancer.ID, "service", klog.KObj(service), "listeners", missing)
+		}
+
+		// With delete-first the listeners of the ports removed from the Service are deleted before the listeners of
+		// the new ports are created, otherwise they're deleted last so that the Service keeps a backend meanwhile.
+		if lbaas.opts.ReconcileOrder == reconcileOrderDeleteFirst {
+			if curListeners, err = lbaas.deleteObsoleteListeners(loadbalancer.ID, service, svcConf, curListeners, isLBOwner, lbName); err != nil {
 				return nil, err
 			}
+			curListenerMapping = getListenerMapping(curListeners)
+		}
 
-			if err := lbaas.ensureOctaviaHealthMonitor(loadbalancer.ID, cpoutil.CutString255(fmt.Sprintf("monitor_%d_%s", portIndex, lbName)), pool, port, svcConf); err != nil {
+		lbaas.setPreferredMemberZone(service, loadbalancer, nodes, svcConf)
+		ensuredListeners, err := lbaas.ensureOctaviaPortsInParallel(ctx, loadbalancer.ID, lbName, curListenerMapping, service, nodes, svcConf)
+		if err != nil && cpoerrors.IsQuotaError(err) && lbaas.opts.ReconcileOrder == reconcileOrderCreateFirst {
+			// There's no room for both the old and the new listeners, the old ones are deleted first. The listeners
+			// created meanwhile are picked up again.
+			klog.InfoS("Listener quota exceeded, deleting the obsolete listeners first", "lbID", loadbalancer.ID, "service", klog.KObj(service))
+			if curListeners, err = openstackutil.GetListenersByLoadBalancerID(lbaas.lb, loadbalancer.ID); err != nil {
+				return nil, err
+			}
+			if curListeners, err = lbaas.deleteObsoleteListeners(loadbalancer.ID, service, svcConf, curListeners, isLBOwner, lbName); err != nil {
 				return nil, err
 			}
+			curListenerMapping = getListenerMapping(curListeners)
+			ensuredListeners, err = lbaas.ensureOctaviaPortsInParallel(ctx, loadbalancer.ID, lbName, curListenerMapping, service, nodes, svcConf)
+		}
+		if err != nil {
+			return nil, err
+		}
 
-			// After all ports have been processed, remaining listeners are removed if they were created by this Service.
-			// The remove of the listener must always happen at the end of the loop to avoid wrong assignment.
-			// Modifying the curListeners would also change the mapping.
+		// After all ports have been processed, remaining listeners are removed if they were created by this Service.
+		// The remove of the listeners must always happen after the ports are processed to avoid wrong assignment.
+		// Modifying the curListeners would also change the mapping.
+		listenerIDs = listenerIDs[:0]
+		for _, listener := range ensuredListeners {
 			curListeners = popListener(curListeners, listener.ID)
+			listenerIDs = append(listenerIDs, listener.ID)
 		}
 
 		// Deal with the remaining listeners, delete the listener if it was created by this Service previously.
 		if err := lbaas.deleteOctaviaListeners(loadbalancer.ID, curListeners, isLBOwner, lbName); err != nil {
 			return nil, err
 		}
+		orphanPools, err := lbaas.deleteOrphanPools(loadbalancer.ID, lbName)
+		if err != nil {
+			return nil, err
+		}
+		if len(orphanListeners) > 0 || orphanPools > 0 {
+			lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBOrphansDeleted,
+				"Deleted %d listeners and %d pools matching no port of the Service", len(orphanListeners), orphanPools)
+		}
+
+		// The L7 policies are gone with the deleted listeners, so the L7 pools they used can be deleted as well.
+		hadL7Policies := false
+		for _, listener := range loadbalancer.Listeners {
+			if len(listener.L7Policies) > 0 {
+				hadL7Policies = true
+			}
+		}
+		if err := lbaas.ensureOctaviaL7Routes(ctx, loadbalancer.ID, lbName, ensuredListeners, hadL7Policies, service, nodes, svcConf); err != nil {
+			return nil, err
+		}
+		for portIndex, listener := range ensuredListeners {
+			if listener == nil {
+				continue
+			}
+			if err := lbaas.ensureOctaviaXFFPolicy(loadbalancer.ID, xffPolicyName(portIndex, lbName), listener, svcConf.rejectClientXForwardedFor); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	addr, err := lbaas.ensureFloatingIP(clusterName, service, loadbalancer, svcConf, isLBOwner)
+	lbaas.endpoints.track(service, clusterName, svcConf.noReadyEndpoints)
+	lbaas.drainingNodes.track(service, clusterName, nodes, lbaas.opts.NodeDrainGracePeriod.Duration)
+	lbaas.blueprints.track(service, clusterName, service.Annotations[ServiceAnnotationLoadBalancerBlueprint])
+
+	addr, err := lbaas.ensureFloatingIP(ctx, clusterName, service, loadbalancer, svcConf, isLBOwner)
 	if err != nil {
 		return nil, err
 	}
-
-	// Add annotation to Service and add LB name to load balancer tags.
-	annotationUpdate := map[string]string{
-		ServiceAnnotationLoadBalancerID:      loadbalancer.ID,
-		ServiceAnnotationLoadBalancerAddress: addr,
+
+	// Add annotation to Service and add LB name to load balancer tags.
+	annotationUpdate := map[string]string{
+		ServiceAnnotationLoadBalancerID:      loadbalancer.ID,
+		ServiceAnnotationLoadBalancerAddress: addr,
+	}
+	lbaas.updateServiceAnnotations(service, annotationUpdate)
+	// The description of a shared load balancer belongs to the Service owning it, the ones created outside of the
+	// cluster are left alone.
+	if isLBOwner && loadbalancer.Description != svcConf.description {
+		klog.InfoS("Updating load balancer description", "lbID", loadbalancer.ID)
+		if err := openstackutil.UpdateLoadBalancerDescription(lbaas.lb, loadbalancer.ID, svcConf.description); err != nil {
+			return nil, err
+		}
+	}
+	// Same as with the description, only the owner of the load balancer sets its administrative state, the listeners of
+	// the other Services sharing it can be taken down on their own.
+	if isLBOwner && svcConf.adminStateUp != nil && loadbalancer.AdminStateUp != *svcConf.adminStateUp {
+		klog.InfoS("Updating load balancer administrative state", "lbID", loadbalancer.ID, "adminStateUp", *svcConf.adminStateUp)
+		if err := openstackutil.UpdateLoadBalancerAdminState(lbaas.lb, loadbalancer.ID, *svcConf.adminStateUp); err != nil {
+			return nil, err
+		}
+	}
+	// Same as with the description, only the owner of the load balancer sets the QoS policy of its VIP.
+	if isLBOwner && loadbalancer.VipQosPolicyID != svcConf.vipQosPolicyID {
+		klog.InfoS("Updating load balancer VIP QoS policy", "lbID", loadbalancer.ID, "policyID", svcConf.vipQosPolicyID)
+		if err := openstackutil.UpdateLoadBalancerVipQosPolicy(lbaas.lb, loadbalancer.ID, svcConf.vipQosPolicyID); err != nil {
+			return nil, err
+		}
+	}
+	// Same as with the description, only the owner of the load balancer sets the allowed address pairs of its VIP port.
+	if isLBOwner {
+		if err := lbaas.ensureVIPAllowedAddressPairs(loadbalancer.VipPortID, svcConf); err != nil {
+			return nil, err
+		}
 	}
-	lbaas.updateServiceAnnotations(service, annotationUpdate)
 	if svcConf.supportLBTags {
-		lbTags := loadbalancer.Tags
-		if !cpoutil.Contains(lbTags, lbName) {
-			lbTags = append(lbTags, lbName)
+		// The tags describing the Service and the custom ones are only set by the owner, the other Services sharing the
+		// load balancer only add the name of their load balancer.
+		wantedTags := []string{lbName}
+		if isLBOwner {
+			wantedTags = svcConf.tags
+		}
+		lbTags, changed := addMissingTags(loadbalancer.Tags, wantedTags)
+		if isLBOwner {
+			var customChanged bool
+			lbTags, customChanged = syncCustomTags(lbTags, svcConf.customTags)
+			changed = changed || customChanged
+			lbTags, customChanged = syncAntiAffinityGroupTag(lbTags, svcConf.antiAffinityGroup)
+			changed = changed || customChanged
+		}
+		if changed {
 			klog.InfoS("Updating load balancer tags", "lbID", loadbalancer.ID, "tags", lbTags)
 			if err := openstackutil.UpdateLoadBalancerTags(lbaas.lb, loadbalancer.ID, lbTags); err != nil {
 				return nil, err
@@ -2015,7 +3275,19 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 	}
 
 	// Create status the load balancer
-	status := lbaas.createLoadBalancerStatus(service, svcConf, addr)
+	status := lbaas.createLoadBalancerStatus(service, svcConf, addr, loadbalancer.VipAddress)
+
+	mapping := &serviceMapping{
+		LoadBalancerID: loadbalancer.ID,
+		VIPAddress:     loadbalancer.VipAddress,
+		ListenerIDs:    listenerIDs,
+	}
+	if addr != loadbalancer.VipAddress {
+		mapping.FloatingIP = addr
+	}
+	if err := lbaas.updateServiceMapping(ctx, service, mapping); err != nil {
+		return status, err
+	}
 
 	if lbaas.opts.ManageSecurityGroups {
 		err := lbaas.ensureAndUpdateOctaviaSecurityGroup(clusterName, service, nodes, svcConf)
@@ -2030,15 +3302,148 @@ func (lbaas *LbaasV2) ensureOctaviaLoadBalancer(ctx context.Context, clusterName
 		}
 	}
 
-	return status, nil
+	lbaas.updateStatuses(ctx, service, loadbalancer, listenerIDs)
+
+	return status, svcConf.memberMoves.err()
+}
+
+// getPortBatches splits the indexes of the Service ports into batches which can be reconciled independently. Ports
+// sharing a pool end up in the same batch, in the order of the Service ports.
+func getPortBatches(ports []corev1.ServicePort, poolGroups map[string]string) [][]int {
+	var batches [][]int
+	groupBatches := make(map[string]int)
+	for portIndex, port := range ports {
+		group, inGroup := poolGroups[port.Name]
+		if !inGroup {
+			batches = append(batches, []int{portIndex})
+			continue
+		}
+		if batch, ok := groupBatches[group]; ok {
+			batches[batch] = append(batches[batch], portIndex)
+		} else {
+			groupBatches[group] = len(batches)
+			batches = append(batches, []int{portIndex})
+		}
+	}
+	return batches
+}
+
+// ensureOctaviaPortsInParallel ensures the listeners, pools and monitors of the ports of the Service, and returns the
+// listeners of the ports. The ports are reconciled in parallel, while the changes of the load balancer itself get
+// serialized by openstackutil as Octavia allows only one at a time.
+func (lbaas *LbaasV2) ensureOctaviaPortsInParallel(ctx context.Context, lbID string, lbName string, curListenerMapping map[listenerKey]*listeners.Listener, service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) ([]*listeners.Listener, error) {
+	workers := lbaas.opts.PortReconcileConcurrency
+	if lbaas.opts.ProviderRequiresSerialAPICalls || workers < 1 {
+		workers = 1
+	}
+	batches := getPortBatches(service.Spec.Ports, svcConf.poolGroups)
+	ensuredListeners := make([]*listeners.Listener, len(service.Spec.Ports))
+	errs := make([]error, len(batches))
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workqueue.ParallelizeUntil(workCtx, workers, len(batches), func(piece int) {
+		if err := lbaas.ensureOctaviaPorts(workCtx, lbID, lbName, batches[piece], ensuredListeners, curListenerMapping, service, nodes, svcConf); err != nil {
+			errs[piece] = err
+			// Don't start reconciling any other ports.
+			cancel()
+		}
+	})
+	for _, err := range errs {
+		// The quota errors are told apart by the caller.
+		if cpoerrors.IsQuotaError(err) {
+			return nil, err
+		}
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return nil, err
+	}
+	return ensuredListeners, nil
+}
+
+// deleteObsoleteListeners deletes the listeners of the Service matching none of its ports, and returns the remaining
+// listeners.
+func (lbaas *LbaasV2) deleteObsoleteListeners(lbID string, service *corev1.Service, svcConf *serviceConfig, curListeners []listeners.Listener, isLBOwner bool, lbName string) ([]listeners.Listener, error) {
+	obsolete := getObsoleteListeners(service, svcConf, curListeners)
+	if err := lbaas.deleteOctaviaListeners(lbID, obsolete, isLBOwner, lbName); err != nil {
+		return nil, err
+	}
+	for _, listener := range obsolete {
+		curListeners = popListener(curListeners, listener.ID)
+	}
+	return curListeners, nil
+}
+
+// ensureOctaviaPorts makes sure the listeners, pools, members and health monitors exist for a batch of Service ports.
+// The ensured listeners are stored in ensuredListeners under the index of their port.
+func (lbaas *LbaasV2) ensureOctaviaPorts(ctx context.Context, lbID string, lbName string, portIndexes []int, ensuredListeners []*listeners.Listener, curListenerMapping map[listenerKey]*listeners.Listener, service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) error {
+	var sharedPool *v2pools.Pool
+	for _, portIndex := range portIndexes {
+		port := service.Spec.Ports[portIndex]
+		listener, err := lbaas.ensureOctaviaListener(lbID, cpoutil.CutString255(fmt.Sprintf("listener_%d_%s", portIndex, lbName)), curListenerMapping, port, svcConf, service)
+		if err != nil {
+			return err
+		}
+		ensuredListeners[portIndex] = listener
+
+		if sharedPool != nil {
+			// The shared pool along with its members and monitor was ensured for the first port of the group.
+			if err := lbaas.ensureOctaviaSharedPool(lbID, listener, sharedPool); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pool, err := lbaas.ensureOctaviaPool(ctx, lbID, cpoutil.CutString255(fmt.Sprintf("pool_%d_%s", portIndex, lbName)), listener, service, port, nodes, svcConf)
+		if err != nil {
+			return err
+		}
+
+		if err := lbaas.ensureOctaviaHealthMonitor(lbID, cpoutil.CutString255(fmt.Sprintf("monitor_%d_%s", portIndex, lbName)), pool, port, svcConf); err != nil {
+			return err
+		}
+
+		if _, inGroup := svcConf.poolGroups[port.Name]; inGroup {
+			sharedPool = pool
+		}
+	}
+	return nil
 }
 
 // EnsureLoadBalancer creates a new load balancer or updates the existing one.
 func (lbaas *LbaasV2) EnsureLoadBalancer(ctx context.Context, clusterName string, apiService *corev1.Service, nodes []*corev1.Node) (*corev1.LoadBalancerStatus, error) {
 	mc := metrics.NewMetricContext("loadbalancer", "ensure")
 	klog.InfoS("EnsureLoadBalancer", "cluster", clusterName, "service", klog.KObj(apiService))
-	status, err := lbaas.ensureOctaviaLoadBalancer(ctx, clusterName, apiService, nodes)
-	return status, mc.ObserveReconcile(err)
+
+	if err := checkClusterName(clusterName); err != nil {
+		return nil, mc.ObserveReconcile(err)
+	}
+	defer lockService(apiService)()
+
+	// The current status is kept, the service controller doesn't retry the ensure nor clear the status then.
+	if lbaas.skipsTerminatingService(apiService) {
+		return apiService.Status.LoadBalancer.DeepCopy(), mc.ObserveReconcile(nil)
+	}
+
+	service, err := lbaas.applyServiceDefaults(apiService)
+	if err != nil {
+		return nil, lbaas.handleReconcileError(mc, apiService, mc.ObserveReconcile(err))
+	}
+	if !lbaas.handlesService(service) {
+		// The class of the Service may have changed away from the handled one, its load balancer is ours to release.
+		if err := lbaas.releaseLoadBalancer(ctx, clusterName, service); err != nil {
+			return nil, lbaas.handleReconcileError(mc, apiService, mc.ObserveReconcile(err))
+		}
+		metrics.DeleteLoadBalancerResources(service.Namespace, service.Name)
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+
+	regional, nodes, err := lbaas.inRegion(service, nodes)
+	if err != nil {
+		return nil, lbaas.handleReconcileError(mc, apiService, mc.ObserveReconcile(err))
+	}
+
+	status, err := regional.ensureOctaviaLoadBalancer(ctx, clusterName, service, nodes)
+	return status, lbaas.handleReconcileError(mc, apiService, mc.ObserveReconcile(err))
 }
 
 func (lbaas *LbaasV2) listSubnetsForNetwork(networkID string, tweak ...TweakSubNetListOpsFunction) ([]subnets.Subnet, error) {
@@ -2080,11 +3485,16 @@ func (lbaas *LbaasV2) ensureSecurityRule(sgRuleCreateOpts rules.CreateOpts) erro
 }
 
 func (lbaas *LbaasV2) updateOctaviaLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) error {
-	svcConf := new(serviceConfig)
+	svcConf := &serviceConfig{memberMoves: new(pendingMemberMoves)}
 	var err error
 	if err := lbaas.checkServiceUpdate(service, nodes, svcConf); err != nil {
 		return err
 	}
+	nodes = lbaas.limitMemberNodes(service, nodes)
+	if svcConf.description, err = lbaas.getDescription(clusterName, service); err != nil {
+		return err
+	}
+	svcConf.tags = getResourceTags(lbaas.GetLoadBalancerName(ctx, clusterName, service), clusterName, service)
 
 	serviceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
 	klog.V(2).Infof("Updating %d nodes for Service %s in cluster %s", len(nodes), serviceName, clusterName)
@@ -2100,7 +3510,7 @@ func (lbaas *LbaasV2) updateOctaviaLoadBalancer(ctx context.Context, clusterName
 		// This is a Service created before shared LB is supported.
 		name := lbaas.GetLoadBalancerName(ctx, clusterName, service)
 		legacyName := lbaas.getLoadBalancerLegacyName(ctx, clusterName, service)
-		loadbalancer, err = getLoadbalancerByName(lbaas.lb, name, legacyName)
+		loadbalancer, err = getLoadbalancerByName(lbaas.lb, name, legacyName, lbaas.getLoadBalancerPreviousName(ctx, clusterName, service))
 		if err != nil {
 			return err
 		}
@@ -2108,6 +3518,9 @@ func (lbaas *LbaasV2) updateOctaviaLoadBalancer(ctx context.Context, clusterName
 	if loadbalancer.ProvisioningStatus != activeStatus {
 		return fmt.Errorf("load balancer %s is not ACTIVE, current provisioning status: %s", loadbalancer.ID, loadbalancer.ProvisioningStatus)
 	}
+	if err := lbaas.migrateLoadBalancerName(loadbalancer, lbaas.GetLoadBalancerName(ctx, clusterName, service), lbaas.getLoadBalancerPreviousName(ctx, clusterName, service)); err != nil {
+		return err
+	}
 
 	loadbalancer.Listeners, err = openstackutil.GetListenersByLoadBalancerID(lbaas.lb, loadbalancer.ID)
 	if err != nil {
@@ -2123,8 +3536,18 @@ func (lbaas *LbaasV2) updateOctaviaLoadBalancer(ctx context.Context, clusterName
 		lbListeners[key] = l
 	}
 
-	// Update pool members for each listener.
+	lbaas.setPreferredMemberZone(service, loadbalancer, nodes, svcConf)
+
+	// Update pool members for each listener, members of the pools shared by a group of ports are updated only once.
+	updatedGroups := sets.New[string]()
 	for portIndex, port := range service.Spec.Ports {
+		if group, ok := svcConf.poolGroups[port.Name]; ok {
+			if updatedGroups.Has(group) {
+				continue
+			}
+			updatedGroups.Insert(group)
+		}
+
 		proto := getListenerProtocol(port.Protocol, svcConf)
 		listener, ok := lbListeners[listenerKey{
 			Protocol: proto,
@@ -2134,12 +3557,19 @@ func (lbaas *LbaasV2) updateOctaviaLoadBalancer(ctx context.Context, clusterName
 			return fmt.Errorf("loadbalancer %s does not contain required listener for port %d and protocol %s", loadbalancer.ID, port.Port, port.Protocol)
 		}
 
-		_, err := lbaas.ensureOctaviaPool(loadbalancer.ID, cpoutil.CutString255(fmt.Sprintf("pool_%d_%s", portIndex, loadbalancer.Name)), &listener, service, port, nodes, svcConf)
+		_, err := lbaas.ensureOctaviaPool(ctx, loadbalancer.ID, cpoutil.CutString255(fmt.Sprintf("pool_%d_%s", portIndex, loadbalancer.Name)), &listener, service, port, nodes, svcConf)
 		if err != nil {
 			return err
 		}
 	}
 
+	if err := lbaas.updateOctaviaL7PoolMembers(ctx, loadbalancer.ID, lbaas.GetLoadBalancerName(ctx, clusterName, service), service, nodes, svcConf); err != nil {
+		return err
+	}
+
+	lbaas.endpoints.track(service, clusterName, svcConf.noReadyEndpoints)
+	lbaas.drainingNodes.track(service, clusterName, nodes, lbaas.opts.NodeDrainGracePeriod.Duration)
+
 	if lbaas.opts.ManageSecurityGroups {
 		err := lbaas.ensureAndUpdateOctaviaSecurityGroup(clusterName, service, nodes, svcConf)
 		if err != nil {
@@ -2150,14 +3580,40 @@ func (lbaas *LbaasV2) updateOctaviaLoadBalancer(ctx context.Context, clusterName
 	// only called on changes to the list of the Nodes. Deletion of the SG on reconfiguration will be handled by
 	// EnsureLoadBalancer() that is the true LB reconcile function.
 
-	return nil
+	var listenerIDs []string
+	for _, port := range service.Spec.Ports {
+		if listener, ok := lbListeners[listenerKey{Protocol: getListenerProtocol(port.Protocol, svcConf), Port: int(port.Port)}]; ok {
+			listenerIDs = append(listenerIDs, listener.ID)
+		}
+	}
+	lbaas.updateStatuses(ctx, service, loadbalancer, listenerIDs)
+
+	return svcConf.memberMoves.err()
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
 func (lbaas *LbaasV2) UpdateLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) error {
 	mc := metrics.NewMetricContext("loadbalancer", "update")
-	err := lbaas.updateOctaviaLoadBalancer(ctx, clusterName, service, nodes)
-	return mc.ObserveReconcile(err)
+	if err := checkClusterName(clusterName); err != nil {
+		return mc.ObserveReconcile(err)
+	}
+	defer lockService(service)()
+	if lbaas.skipsTerminatingService(service) {
+		return mc.ObserveReconcile(nil)
+	}
+	svc, err := lbaas.applyServiceDefaults(service)
+	if err != nil {
+		return lbaas.handleReconcileError(mc, service, mc.ObserveReconcile(err))
+	}
+	if !lbaas.handlesService(svc) {
+		return cloudprovider.ImplementedElsewhere
+	}
+	regional, nodes, err := lbaas.inRegion(svc, nodes)
+	if err != nil {
+		return lbaas.handleReconcileError(mc, service, mc.ObserveReconcile(err))
+	}
+	err = regional.updateOctaviaLoadBalancer(ctx, clusterName, svc, nodes)
+	return lbaas.handleReconcileError(mc, service, mc.ObserveReconcile(err))
 }
 
 func compareSecurityGroupRuleAndCreateOpts(rule rules.SecGroupRule, opts rules.CreateOpts) bool {
@@ -2169,6 +3625,48 @@ func compareSecurityGroupRuleAndCreateOpts(rule rules.SecGroupRule, opts rules.C
 		rule.PortRangeMax == opts.PortRangeMax
 }
 
+// getWantedSecurityGroupRules returns the rules of the security group of the Service, opening the exact ports the load
+// balancer reaches the nodes on: the member port, i.e. the node port, of each Service port from the given CIDRs and the
+// healthCheckNodePort of the Services with the Local traffic policy from the member subnet, where both the amphorae
+// and the health checks of the ovn provider come from. Ports shared by several Service ports get a single rule.
+func getWantedSecurityGroupRules(service *corev1.Service, svcConf *serviceConfig, sgID string, etherType rules.RuleEtherType, subnetCIDR string, cidrs []string) []rules.CreateOpts {
+	var wantedRules []rules.CreateOpts
+	addRule := func(protocol rules.RuleProtocol, cidr string, port int) {
+		rule := rules.CreateOpts{
+			Direction:      rules.DirIngress,
+			Protocol:       protocol,
+			EtherType:      etherType,
+			RemoteIPPrefix: cidr,
+			SecGroupID:     sgID,
+			PortRangeMin:   port,
+			PortRangeMax:   port,
+		}
+		for _, wanted := range wantedRules {
+			if wanted == rule {
+				return
+			}
+		}
+		wantedRules = append(wantedRules, rule)
+	}
+
+	if service.Spec.HealthCheckNodePort != 0 {
+		addRule(rules.ProtocolTCP, subnetCIDR, int(service.Spec.HealthCheckNodePort))
+	}
+
+	for _, port := range service.Spec.Ports {
+		memberPort := getMemberPort(port, svcConf)
+		if memberPort == 0 {
+			continue
+		}
+		protocol := strings.ToLower(string(port.Protocol)) // K8s uses TCP, Neutron uses tcp, etc.
+		for _, cidr := range cidrs {
+			addRule(rules.RuleProtocol(protocol), cidr, memberPort)
+		}
+	}
+
+	return wantedRules
+}
+
 func getRulesToCreateAndDelete(wantedRules []rules.CreateOpts, existingRules []rules.SecGroupRule) ([]rules.CreateOpts, []rules.SecGroupRule) {
 	toCreate := make([]rules.CreateOpts, 0, len(wantedRules))     // Max is all rules need creation
 	toDelete := make([]rules.SecGroupRule, 0, len(existingRules)) // Max will be all the existing rules to be deleted
@@ -2204,26 +3702,101 @@ func getRulesToCreateAndDelete(wantedRules []rules.CreateOpts, existingRules []r
 	return toCreate, toDelete
 }
 
+// getServiceSecurityGroupRules returns the rules to open the member ports of the Service in the security group, see
+// getWantedSecurityGroupRules.
+func (lbaas *LbaasV2) getServiceSecurityGroupRules(service *corev1.Service, svcConf *serviceConfig, sgID string) ([]rules.CreateOpts, error) {
+	mc := metrics.NewMetricContext("subnet", "get")
+	subnet, err := subnets.Get(lbaas.network, svcConf.lbMemberSubnetID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, fmt.Errorf(
+			"failed to find subnet %s from openstack: %w", svcConf.lbMemberSubnetID, err)
+	}
+
+	etherType := rules.EtherType4
+	if netutils.IsIPv6CIDRString(subnet.CIDR) {
+		etherType = rules.EtherType6
+	}
+	cidrs := []string{subnet.CIDR}
+	if lbaas.opts.LBProvider == "ovn" {
+		// OVN keeps the source IP of the incoming traffic. This means that we cannot just open the LB range, but we
+		// need to open for the whole world. This can be restricted by using the service.spec.loadBalancerSourceRanges.
+		// svcConf.securityGroupCIDRs will give us the ranges calculated by setSourceRanges() earlier.
+		cidrs = svcConf.securityGroupCIDRs
+	}
+
+	return getWantedSecurityGroupRules(service, svcConf, sgID, etherType, subnet.CIDR, cidrs), nil
+}
+
+// syncSecurityGroupRules creates the wanted rules missing from the existing ones and deletes the existing rules that
+// aren't wanted anymore.
+func (lbaas *LbaasV2) syncSecurityGroupRules(sgName string, wantedRules []rules.CreateOpts, existingRules []rules.SecGroupRule) error {
+	toCreate, toDelete := getRulesToCreateAndDelete(wantedRules, existingRules)
+
+	// create new rules
+	for _, opts := range toCreate {
+		err := lbaas.ensureSecurityRule(opts)
+		if err != nil {
+			return fmt.Errorf("failed to apply security rule (%v), %w", opts, err)
+		}
+	}
+
+	// delete unneeded rules
+	for _, existingRule := range toDelete {
+		klog.Infof("Deleting rule %s from security group %s (%s)", existingRule.ID, existingRule.SecGroupID, sgName)
+		if err := deleteSecurityGroupRule(lbaas.network, existingRule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSecurityGroupRule deletes the rule, a rule already gone is ignored.
+func deleteSecurityGroupRule(network *gophercloud.ServiceClient, rule rules.SecGroupRule) error {
+	mc := metrics.NewMetricContext("security_group_rule", "delete")
+	err := rules.Delete(network, rule.ID).ExtractErr()
+	if err != nil && cpoerrors.IsNotFound(err) {
+		// ignore 404
+		klog.Warningf("Security group rule %s found missing when trying to delete it. This indicates concurrent "+
+			"updates to the SG %s and is unexpected", rule.ID, rule.SecGroupID)
+		return mc.ObserveRequest(nil)
+	} else if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to delete security group rule %s: %w", rule.ID, err)
+	}
+	return nil
+}
+
 // ensureAndUpdateOctaviaSecurityGroup handles the creation and update of the security group and the securiry rules for the octavia load balancer
 func (lbaas *LbaasV2) ensureAndUpdateOctaviaSecurityGroup(clusterName string, apiService *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) error {
 	// get service ports
-	ports := apiService.Spec.Ports
-	if len(ports) == 0 {
+	if len(apiService.Spec.Ports) == 0 {
 		return fmt.Errorf("no ports provided to openstack load balancer")
 	}
 
+	memberSecGroupID, err := lbaas.getMemberSecurityGroupID()
+	if err != nil {
+		return err
+	}
+	if memberSecGroupID != "" {
+		if err := lbaas.ensureMemberSecurityGroupRules(apiService, svcConf, nodes, memberSecGroupID); err != nil {
+			return err
+		}
+		// The security group of the Service from before member-security-group was set isn't needed anymore
+		return lbaas.deleteServiceSecurityGroup(apiService)
+	}
+
 	// ensure security group for LB
 	lbSecGroupName := getSecurityGroupName(apiService)
-	lbSecGroupID, err := secgroups.IDFromName(lbaas.network, lbSecGroupName)
+	lbSecGroups, err := lbaas.listSecurityGroups(groups.ListOpts{Name: lbSecGroupName})
 	if err != nil {
-		// If the security group of LB not exist, create it later
-		if cpoerrors.IsNotFound(err) {
-			lbSecGroupID = ""
-		} else {
-			return fmt.Errorf("error occurred finding security group: %s: %v", lbSecGroupName, err)
-		}
+		return fmt.Errorf("error occurred finding security group: %s: %v", lbSecGroupName, err)
 	}
-	if len(lbSecGroupID) == 0 {
+	if len(lbSecGroups) > 1 {
+		return fmt.Errorf("error occurred finding security group: %s: %w", lbSecGroupName, cpoerrors.ErrMultipleResults)
+	}
+	var lbSecGroup *groups.SecGroup
+	if len(lbSecGroups) == 1 {
+		lbSecGroup = &lbSecGroups[0]
+	} else {
 		// create security group
 		lbSecGroupCreateOpts := groups.CreateOpts{
 			Name:        lbSecGroupName,
@@ -2231,30 +3804,18 @@ func (lbaas *LbaasV2) ensureAndUpdateOctaviaSecurityGroup(clusterName string, ap
 		}
 
 		mc := metrics.NewMetricContext("security_group", "create")
-		lbSecGroup, err := groups.Create(lbaas.network, lbSecGroupCreateOpts).Extract()
+		lbSecGroup, err = groups.Create(lbaas.network, lbSecGroupCreateOpts).Extract()
 		if mc.ObserveRequest(err) != nil {
-			return fmt.Errorf("failed to create Security Group for loadbalancer service %s/%s: %v", apiService.Namespace, apiService.Name, err)
+			return fmt.Errorf("failed to create Security Group for loadbalancer service %s/%s: %w", apiService.Namespace, apiService.Name, err)
 		}
-		lbSecGroupID = lbSecGroup.ID
 	}
+	lbSecGroupID := lbSecGroup.ID
 
-	mc := metrics.NewMetricContext("subnet", "get")
-	subnet, err := subnets.Get(lbaas.network, svcConf.lbMemberSubnetID).Extract()
-	if mc.ObserveRequest(err) != nil {
-		return fmt.Errorf(
-			"failed to find subnet %s from openstack: %v", svcConf.lbMemberSubnetID, err)
-	}
-
-	etherType := rules.EtherType4
-	if netutils.IsIPv6CIDRString(subnet.CIDR) {
-		etherType = rules.EtherType6
+	if err := lbaas.ensureSecurityGroupTags(lbSecGroup, svcConf.tags); err != nil {
+		return err
 	}
-	cidrs := []string{subnet.CIDR}
-	if lbaas.opts.LBProvider == "ovn" {
-		// OVN keeps the source IP of the incoming traffic. This means that we cannot just open the LB range, but we
-		// need to open for the whole world. This can be restricted by using the service.spec.loadBalancerSourceRanges.
-		// svcConf.allowedCIDR will give us the ranges calculated by GetLoadBalancerSourceRanges() earlier.
-		cidrs = svcConf.allowedCIDR
+	if err := lbaas.deleteStaleSecurityGroups(clusterName, apiService, lbSecGroupID); err != nil {
+		return err
 	}
 
 	existingRules, err := getSecurityGroupRules(lbaas.network, rules.ListOpts{SecGroupID: lbSecGroupID})
@@ -2263,82 +3824,108 @@ func (lbaas *LbaasV2) ensureAndUpdateOctaviaSecurityGroup(clusterName string, ap
 			"failed to find security group rules in %s: %v", lbSecGroupID, err)
 	}
 
-	// List of the security group rules wanted in the SG.
-	// Number of Ports plus the potential HealthCheckNodePort.
-	wantedRules := make([]rules.CreateOpts, 0, len(ports)+1)
-
-	if apiService.Spec.HealthCheckNodePort != 0 {
-		// TODO(dulek): How should this work with OVN…? Do we need to allow all?
-		//              Probably the traffic goes from the compute node?
-		wantedRules = append(wantedRules,
-			rules.CreateOpts{
-				Direction:      rules.DirIngress,
-				Protocol:       rules.ProtocolTCP,
-				EtherType:      etherType,
-				RemoteIPPrefix: subnet.CIDR,
-				SecGroupID:     lbSecGroupID,
-				PortRangeMin:   int(apiService.Spec.HealthCheckNodePort),
-				PortRangeMax:   int(apiService.Spec.HealthCheckNodePort),
-			},
-		)
-	}
-
-	for _, port := range ports {
-		if port.NodePort == 0 { // It's 0 when AllocateLoadBalancerNodePorts=False
-			continue
-		}
-		for _, cidr := range cidrs {
-			protocol := strings.ToLower(string(port.Protocol)) // K8s uses TCP, Neutron uses tcp, etc.
-			wantedRules = append(wantedRules,
-				rules.CreateOpts{
-					Direction:      rules.DirIngress,
-					Protocol:       rules.RuleProtocol(protocol),
-					EtherType:      etherType,
-					RemoteIPPrefix: cidr,
-					SecGroupID:     lbSecGroupID,
-					PortRangeMin:   int(port.NodePort),
-					PortRangeMax:   int(port.NodePort),
-				},
-			)
-		}
-	}
-
-	toCreate, toDelete := getRulesToCreateAndDelete(wantedRules, existingRules)
-
-	// create new rules
-	for _, opts := range toCreate {
-		err := lbaas.ensureSecurityRule(opts)
-		if err != nil {
-			return fmt.Errorf("failed to apply security rule (%v), %w", opts, err)
-		}
+	wantedRules, err := lbaas.getServiceSecurityGroupRules(apiService, svcConf, lbSecGroupID)
+	if err != nil {
+		return err
 	}
-
-	// delete unneeded rules
-	for _, existingRule := range toDelete {
-		klog.Infof("Deleting rule %s from security group %s (%s)", existingRule.ID, existingRule.SecGroupID, lbSecGroupName)
-		mc := metrics.NewMetricContext("security_group_rule", "delete")
-		err := rules.Delete(lbaas.network, existingRule.ID).ExtractErr()
-		if err != nil && cpoerrors.IsNotFound(err) {
-			// ignore 404
-			klog.Warningf("Security group rule %s found missing when trying to delete it. This indicates concurrent "+
-				"updates to the SG %s and is unexpected", existingRule.ID, existingRule.SecGroupID)
-			return mc.ObserveRequest(nil)
-		} else if mc.ObserveRequest(err) != nil {
-			return fmt.Errorf("failed to delete security group rule %s: %w", existingRule.ID, err)
-		}
+	if err := lbaas.syncSecurityGroupRules(lbSecGroupName, wantedRules, existingRules); err != nil {
+		return err
 	}
 
-	if err := applyNodeSecurityGroupIDForLB(lbaas.network, nodes, lbSecGroupID); err != nil {
+	serverIDs, err := applyNodeSecurityGroupIDForLB(lbaas.network, nodes, lbSecGroupID)
+	if err != nil {
 		return err
 	}
+	// The nodes that aren't members of the load balancer anymore don't need to be reached by it.
+	if err := disassociateSecurityGroupForLB(lbaas.network, lbSecGroupID, serverIDs); err != nil {
+		return fmt.Errorf("failed to disassociate security group %s from the removed nodes: %v", lbSecGroupID, err)
+	}
 	return nil
 }
 
 // EnsureLoadBalancerDeleted deletes the specified load balancer
 func (lbaas *LbaasV2) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *corev1.Service) error {
 	mc := metrics.NewMetricContext("loadbalancer", "delete")
-	err := lbaas.ensureLoadBalancerDeleted(ctx, clusterName, service)
-	return mc.ObserveReconcile(err)
+	if err := checkClusterName(clusterName); err != nil {
+		return mc.ObserveReconcile(err)
+	}
+	defer lockService(service)()
+	// The namespace may be gone already when the Service was deleted along with it, the load balancer is deleted anyway.
+	svc, err := lbaas.applyServiceDefaults(service)
+	if apierrors.IsNotFound(err) || errors.Is(err, errUnknownProfile) || errors.Is(err, errUnknownBlueprint) {
+		klog.InfoS("Deleting the load balancer without the default annotations", "service", klog.KObj(service), "err", err)
+		svc, err = service, nil
+	}
+	if err != nil {
+		return lbaas.handleReconcileError(mc, service, mc.ObserveReconcile(err))
+	}
+	if !lbaas.handlesService(svc) {
+		return cloudprovider.ImplementedElsewhere
+	}
+	regional, err := lbaas.lookupRegion(svc, lbaas.GetLoadBalancerName(ctx, clusterName, svc),
+		lbaas.getLoadBalancerLegacyName(ctx, clusterName, svc), lbaas.getLoadBalancerPreviousName(ctx, clusterName, svc))
+	if err != nil {
+		return lbaas.handleReconcileError(mc, service, mc.ObserveReconcile(err))
+	}
+	err = regional.ensureLoadBalancerDeleted(ctx, clusterName, svc)
+	if err == nil {
+		metrics.DeleteLoadBalancerResources(service.Namespace, service.Name)
+		err = lbaas.updateServiceMapping(ctx, service, nil)
+	}
+	return lbaas.handleReconcileError(mc, service, mc.ObserveReconcile(err))
+}
+
+// checkClusterName refuses to touch any load balancer when the cluster name is empty. The cluster name is part of the
+// names of the load balancers and of their resources, without it they cannot be told apart from the ones of other
+// clusters sharing the project, so any change could hit the wrong ones.
+func checkClusterName(clusterName string) error {
+	if clusterName == "" {
+		return fmt.Errorf("cluster name is empty, refusing to manage load balancers, set the --cluster-name option")
+	}
+	return nil
+}
+
+// serviceLocks serializes the reconciles of a Service. The service controller reconciles a Service at a time, but the
+// serviceEndpointsWatcher re-populates the members concurrently with it. Every Service has its own lock, so that the
+// reconciles of unrelated Services never wait for each other, and the locks are dropped once unused.
+var serviceLocks = struct {
+	sync.Mutex
+	locks map[types.UID]*serviceLock
+}{locks: make(map[types.UID]*serviceLock)}
+
+type serviceLock struct {
+	sync.Mutex
+	// users counts the reconciles holding or waiting for the lock.
+	users int
+}
+
+// lockService locks the Service for a reconcile and returns the function unlocking it. The Services are told apart by
+// their UID, as a Service recreated with the same name is another one.
+func lockService(service *corev1.Service) func() {
+	key := service.UID
+	if key == "" {
+		key = types.UID(service.Namespace + "/" + service.Name)
+	}
+
+	serviceLocks.Lock()
+	lock, ok := serviceLocks.locks[key]
+	if !ok {
+		lock = &serviceLock{}
+		serviceLocks.locks[key] = lock
+	}
+	lock.users++
+	serviceLocks.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		serviceLocks.Lock()
+		defer serviceLocks.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(serviceLocks.locks, key)
+		}
+	}
 }
 
 func (lbaas *LbaasV2) deleteFIPIfCreatedByProvider(fip *floatingips.FloatingIP, portID string, service *corev1.Service) (bool, error) {
@@ -2425,6 +4012,11 @@ func (lbaas *LbaasV2) deleteLoadBalancer(loadbalancer *loadbalancers.LoadBalance
 			return err
 		}
 
+		// delete the L7 pools, no longer referenced by the L7 policies of the deleted listeners
+		if err := lbaas.deleteOctaviaL7Pools(loadbalancer.ID, svcConf.lbName); err != nil {
+			return err
+		}
+
 		if needDeleteLB {
 			// delete the loadbalancer in old way, i.e. no cascading.
 			klog.InfoS("Deleting load balancer", "lbID", loadbalancer.ID, "service", klog.KObj(service))
@@ -2441,6 +4033,7 @@ func (lbaas *LbaasV2) deleteLoadBalancer(loadbalancer *loadbalancers.LoadBalance
 func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName string, service *corev1.Service) error {
 	lbName := lbaas.GetLoadBalancerName(ctx, clusterName, service)
 	legacyName := lbaas.getLoadBalancerLegacyName(ctx, clusterName, service)
+	previousName := lbaas.getLoadBalancerPreviousName(ctx, clusterName, service)
 	var err error
 	var loadbalancer *loadbalancers.LoadBalancer
 	isSharedLB := false
@@ -2452,12 +4045,15 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 		return err
 	}
 	svcConf.lbName = lbName
+	lbaas.endpoints.forget(service)
+	lbaas.drainingNodes.track(service, clusterName, nil, 0)
+	lbaas.blueprints.track(service, clusterName, "")
 
 	if svcConf.lbID != "" {
 		loadbalancer, err = openstackutil.GetLoadbalancerByID(lbaas.lb, svcConf.lbID)
 	} else {
 		// This may happen when this Service creation was failed previously.
-		loadbalancer, err = getLoadbalancerByName(lbaas.lb, lbName, legacyName)
+		loadbalancer, err = getLoadbalancerByName(lbaas.lb, lbName, legacyName, previousName)
 	}
 	if err != nil && !cpoerrors.IsNotFound(err) {
 		return err
@@ -2469,6 +4065,9 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 	if loadbalancer.ProvisioningStatus != activeStatus && loadbalancer.ProvisioningStatus != errorStatus {
 		return fmt.Errorf("load balancer %s is in immutable status, current provisioning status: %s", loadbalancer.ID, loadbalancer.ProvisioningStatus)
 	}
+	if err := lbaas.migrateLoadBalancerName(loadbalancer, lbName, previousName); err != nil {
+		return err
+	}
 
 	if strings.HasPrefix(loadbalancer.Name, servicePrefix) {
 		isCreatedByOCCM = true
@@ -2476,7 +4075,8 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 
 	if svcConf.supportLBTags {
 		for _, tag := range loadbalancer.Tags {
-			if tag == lbName {
+			// The load balancers in ERROR can't be renamed, they may still have the previous name.
+			if tag == lbName || (previousName != "" && tag == previousName) {
 				updateLBTag = true
 			} else if strings.HasPrefix(tag, servicePrefix) {
 				isSharedLB = true
@@ -2493,7 +4093,10 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 	klog.V(4).InfoS("Deleting service", "service", klog.KObj(service), "needDeleteLB", needDeleteLB, "isSharedLB", isSharedLB, "updateLBTag", updateLBTag, "isCreatedByOCCM", isCreatedByOCCM)
 
 	keepFloatingAnnotation := getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerKeepFloatingIP, false)
-	if needDeleteLB && !keepFloatingAnnotation {
+	// The kept floating IP still needs its tags, its PTR record and its QoS policy removed.
+	hasPTRRecord := service.Annotations[ServiceAnnotationLoadBalancerFloatingIPPTRRecord] != ""
+	hasQosPolicy := service.Annotations[ServiceAnnotationLoadBalancerFloatingIPQosPolicyID] != ""
+	if needDeleteLB && (!keepFloatingAnnotation || lbaas.opts.FloatingIPTags || lbaas.tracksFloatingIPDrift() || hasPTRRecord || hasQosPolicy) {
 		if loadbalancer.VipPortID != "" {
 			portID := loadbalancer.VipPortID
 			fip, err := openstackutil.GetFloatingIPByPortID(lbaas.network, portID)
@@ -2503,10 +4106,24 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 
 			// Delete the floating IP only if it was created dynamically by the controller manager.
 			if fip != nil {
-				_, err = lbaas.deleteFIPIfCreatedByProvider(fip, portID, service)
-				if err != nil {
+				if err := lbaas.deleteFloatingIPPTRRecord(fip, service); err != nil {
 					return err
 				}
+				fipDeleted := false
+				if !keepFloatingAnnotation {
+					fipDeleted, err = lbaas.deleteFIPIfCreatedByProvider(fip, portID, service)
+					if err != nil {
+						return err
+					}
+				}
+				if !fipDeleted {
+					if err := lbaas.ensureFloatingIPTags(fip, nil, ""); err != nil {
+						return err
+					}
+					if err := lbaas.deleteFloatingIPQosPolicy(fip, service); err != nil {
+						return err
+					}
+				}
 			}
 		}
 	}
@@ -2515,14 +4132,18 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 		return err
 	}
 
+	// The VIP port set on the Service isn't deleted with the load balancer, it needs no retention.
+	if needDeleteLB && lbaas.opts.VIPRetentionPeriod.Duration > 0 && loadbalancer.VipAddress != "" &&
+		getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerPortID, "") == "" {
+		// The load balancer is gone already, failing would lose the address anyway.
+		if err := lbaas.retainVIP(lbName, loadbalancer); err != nil {
+			klog.Warningf("Failed to retain VIP address %s of deleted load balancer %s: %v", loadbalancer.VipAddress, loadbalancer.ID, err)
+		}
+	}
+
 	// Remove the Service's tag from the load balancer.
 	if !needDeleteLB && updateLBTag {
-		var newTags []string
-		for _, tag := range loadbalancer.Tags {
-			if tag != lbName {
-				newTags = append(newTags, tag)
-			}
-		}
+		newTags := removeServiceTags(loadbalancer.Tags, lbName, service)
 		// An empty list won't trigger tags update.
 		if len(newTags) == 0 {
 			newTags = []string{""}
@@ -2544,7 +4165,18 @@ func (lbaas *LbaasV2) ensureLoadBalancerDeleted(ctx context.Context, clusterName
 }
 
 // ensureSecurityGroupDeleted deleting security group for specific loadbalancer service.
-func (lbaas *LbaasV2) ensureSecurityGroupDeleted(_ string, service *corev1.Service) error {
+func (lbaas *LbaasV2) ensureSecurityGroupDeleted(clusterName string, service *corev1.Service) error {
+	if err := lbaas.deleteMemberSecurityGroupRules(service); err != nil {
+		return err
+	}
+	if err := lbaas.deleteServiceSecurityGroup(service); err != nil {
+		return err
+	}
+	return lbaas.deleteStaleSecurityGroups(clusterName, service, "")
+}
+
+// deleteServiceSecurityGroup deletes the security group of the Service, once disassociated from the ports of the nodes.
+func (lbaas *LbaasV2) deleteServiceSecurityGroup(service *corev1.Service) error {
 	// Generate Name
 	lbSecGroupName := getSecurityGroupName(service)
 	lbSecGroupID, err := secgroups.IDFromName(lbaas.network, lbSecGroupName)
@@ -2556,19 +4188,7 @@ func (lbaas *LbaasV2) ensureSecurityGroupDeleted(_ string, service *corev1.Servi
 		return fmt.Errorf("error occurred finding security group: %s: %v", lbSecGroupName, err)
 	}
 
-	// Disassociate the security group from the neutron ports on the nodes.
-	if err := disassociateSecurityGroupForLB(lbaas.network, lbSecGroupID); err != nil {
-		return fmt.Errorf("failed to disassociate security group %s: %v", lbSecGroupID, err)
-	}
-
-	mc := metrics.NewMetricContext("security_group", "delete")
-	lbSecGroup := groups.Delete(lbaas.network, lbSecGroupID)
-	if lbSecGroup.Err != nil && !cpoerrors.IsNotFound(lbSecGroup.Err) {
-		return mc.ObserveRequest(lbSecGroup.Err)
-	}
-	_ = mc.ObserveRequest(nil)
-
-	return nil
+	return lbaas.deleteSecurityGroup(lbSecGroupID)
 }
 
 // GetLoadBalancerSourceRanges first try to parse and verify LoadBalancerSourceRanges field from a service.
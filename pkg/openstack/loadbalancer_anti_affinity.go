@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// Octavia has no anti-affinity between load balancers, the amphora anti-affinity of the flavors only separates the
+// amphorae of a single load balancer. The load balancers of an anti-affinity group are spread across availability
+// zones instead, which the operators map to the host aggregates to keep apart.
+
+// antiAffinityZones returns the availability zones of anti-affinity-availability-zones, in order and without duplicates.
+func (opts LoadBalancerOpts) antiAffinityZones() []string {
+	var zones []string
+	for _, zone := range strings.Split(opts.AntiAffinityAvailabilityZones, ",") {
+		zone = strings.TrimSpace(zone)
+		if zone != "" && !cpoutil.Contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// getAntiAffinityGroup returns the anti-affinity group of the Service, empty if it has none.
+func getAntiAffinityGroup(service *corev1.Service, opts LoadBalancerOpts) (string, error) {
+	group := strings.TrimSpace(service.Annotations[ServiceAnnotationLoadBalancerAntiAffinityGroup])
+	if group == "" {
+		return "", nil
+	}
+	if opts.AntiAffinityAvailabilityZones == "" {
+		return "", fmt.Errorf("annotation %s requires anti-affinity-availability-zones in the [LoadBalancer] section of the config", ServiceAnnotationLoadBalancerAntiAffinityGroup)
+	}
+	if len(resourceTagAntiAffinityGroup+group) > 255 {
+		return "", fmt.Errorf("invalid group %q in annotation %s: groups can't be longer than %d characters", group, ServiceAnnotationLoadBalancerAntiAffinityGroup, 255-len(resourceTagAntiAffinityGroup))
+	}
+	return group, nil
+}
+
+// pickAntiAffinityZone returns the zone holding the fewest of the load balancers of a group, the first one listed on a
+// tie. The load balancers in other zones aren't counted, e.g. the ones created in a zone set on their Service.
+func pickAntiAffinityZone(zones []string, groupLBs []loadbalancers.LoadBalancer) string {
+	counts := make(map[string]int, len(zones))
+	for _, lb := range groupLBs {
+		if lb.ProvisioningStatus == "PENDING_DELETE" || lb.ProvisioningStatus == "DELETED" {
+			continue
+		}
+		counts[lb.AvailabilityZone]++
+	}
+	var picked string
+	for _, zone := range zones {
+		if picked == "" || counts[zone] < counts[picked] {
+			picked = zone
+		}
+	}
+	return picked
+}
+
+// getAntiAffinityAvailabilityZone returns the availability zone of a new load balancer of the anti-affinity group. The
+// anti-affinity is soft: once every zone holds a load balancer of the group, the zones are shared evenly.
+func (lbaas *LbaasV2) getAntiAffinityAvailabilityZone(clusterName, group string) (string, error) {
+	lbs, err := openstackutil.GetLoadBalancers(lbaas.lb, loadbalancers.ListOpts{Tags: []string{resourceTagAntiAffinityGroup + group}})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the load balancers of anti-affinity group %s: %v", group, err)
+	}
+	// The groups of other clusters sharing the project are told apart by the cluster tag.
+	var groupLBs []loadbalancers.LoadBalancer
+	for _, lb := range lbs {
+		if cpoutil.Contains(lb.Tags, cpoutil.CutString255(resourceTagCluster+clusterName)) {
+			groupLBs = append(groupLBs, lb)
+		}
+	}
+	zone := pickAntiAffinityZone(lbaas.opts.antiAffinityZones(), groupLBs)
+	klog.InfoS("Picked availability zone of the anti-affinity group", "group", group, "availabilityZone", zone, "groupLoadBalancers", len(groupLBs))
+	return zone, nil
+}
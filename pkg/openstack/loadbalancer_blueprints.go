@@ -0,0 +1,319 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// blueprintGVR is the resource of the cluster scoped LBBlueprint custom resources.
+var blueprintGVR = schema.GroupVersionResource{Group: "loadbalancer.openstack.org", Version: "v1alpha1", Resource: "lbblueprints"}
+
+// errUnknownBlueprint is returned when the blueprint selected by a Service doesn't exist (yet), or isn't watched.
+var errUnknownBlueprint = errors.New("unknown load balancer blueprint")
+
+// lbBlueprint is an LBBlueprint custom resource, the load balancer settings shared by the Services selecting it.
+type lbBlueprint struct {
+	Spec lbBlueprintSpec `json:"spec"`
+}
+
+type lbBlueprintSpec struct {
+	// Provider is the Octavia provider the blueprint is meant for, it must be the lb-provider of the config.
+	Provider         string                    `json:"provider,omitempty"`
+	FlavorID         string                    `json:"flavorID,omitempty"`
+	AvailabilityZone string                    `json:"availabilityZone,omitempty"`
+	Timeouts         *lbBlueprintTimeouts      `json:"timeouts,omitempty"`
+	HealthMonitor    *lbBlueprintHealthMonitor `json:"healthMonitor,omitempty"`
+	TLS              *lbBlueprintTLS           `json:"tls,omitempty"`
+}
+
+// lbBlueprintTimeouts are the timeouts of the listeners, in milliseconds.
+type lbBlueprintTimeouts struct {
+	ClientData    *int `json:"clientData,omitempty"`
+	MemberConnect *int `json:"memberConnect,omitempty"`
+	MemberData    *int `json:"memberData,omitempty"`
+	TCPInspect    *int `json:"tcpInspect,omitempty"`
+}
+
+// lbBlueprintHealthMonitor is the health monitor of the pools, the durations are in seconds.
+type lbBlueprintHealthMonitor struct {
+	Enabled        *bool `json:"enabled,omitempty"`
+	Delay          *int  `json:"delay,omitempty"`
+	Timeout        *int  `json:"timeout,omitempty"`
+	MaxRetries     *int  `json:"maxRetries,omitempty"`
+	MaxRetriesDown *int  `json:"maxRetriesDown,omitempty"`
+}
+
+// lbBlueprintTLS is the TLS termination of the listeners.
+type lbBlueprintTLS struct {
+	ContainerRef string `json:"containerRef,omitempty"`
+}
+
+// blueprintResyncRetryDelay is how long the watcher waits before retrying to reconcile a Service whose blueprint
+// changed.
+const blueprintResyncRetryDelay = time.Minute
+
+// blueprintWatcher watches the LBBlueprint custom resources. The service controller doesn't reconcile the load
+// balancers when only a blueprint changes, so once it knows the Services and nodes, the watcher also re-syncs the load
+// balancers of the Services selecting a changed blueprint.
+type blueprintWatcher struct {
+	lister cache.GenericLister
+	queue  workqueue.DelayingInterface
+
+	mu sync.Mutex
+	// users maps the Services reconciled with a blueprint to the blueprint and the name of their cluster.
+	users         map[types.NamespacedName]blueprintUser
+	serviceLister corelisters.ServiceLister
+	nodeLister    corelisters.NodeLister
+	resync        repopulateFunc
+}
+
+type blueprintUser struct {
+	blueprint   string
+	clusterName string
+}
+
+// newBlueprintWatcher starts watching the LBBlueprint custom resources until stop is closed.
+func newBlueprintWatcher(config *rest.Config, stop <-chan struct{}) (*blueprintWatcher, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(blueprintGVR)
+
+	w := &blueprintWatcher{
+		lister: informer.Lister(),
+		queue:  workqueue.NewNamedDelayingQueue("lb-blueprints"),
+		users:  make(map[types.NamespacedName]blueprintUser),
+	}
+	_, err = informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: w.onBlueprintUpdate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	factory.Start(stop)
+	return w, nil
+}
+
+// watch lets the watcher re-sync the load balancers of the Services selecting a changed blueprint.
+func (w *blueprintWatcher) watch(informerFactory informers.SharedInformerFactory) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.serviceLister = informerFactory.Core().V1().Services().Lister()
+	w.nodeLister = informerFactory.Core().V1().Nodes().Lister()
+}
+
+// setResync sets the function re-syncing the load balancers of the Services.
+func (w *blueprintWatcher) setResync(resync repopulateFunc) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resync = resync
+}
+
+// track remembers the blueprint the load balancer of the Service was reconciled with, none forgets the Service.
+func (w *blueprintWatcher) track(service *corev1.Service, clusterName, blueprint string) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if blueprint == "" {
+		delete(w.users, key)
+		return
+	}
+	w.users[key] = blueprintUser{blueprint: blueprint, clusterName: clusterName}
+}
+
+// onBlueprintUpdate queues the Services selecting the blueprint when its spec changes. Neither a new nor a deleted
+// blueprint needs it: the reconciles of the Services missing it are retried, and the deletion of the blueprint doesn't
+// change their load balancers.
+func (w *blueprintWatcher) onBlueprintUpdate(oldObj, obj interface{}) {
+	oldBlueprint, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	blueprint, ok := obj.(*unstructured.Unstructured)
+	if !ok || equality.Semantic.DeepEqual(oldBlueprint.Object["spec"], blueprint.Object["spec"]) {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key, user := range w.users {
+		if user.blueprint == blueprint.GetName() {
+			klog.V(2).InfoS("Load balancer blueprint changed, re-syncing the Service", "blueprint", blueprint.GetName(), "service", key)
+			w.queue.Add(key)
+		}
+	}
+}
+
+// run re-syncs the load balancers of the Services whose blueprint changed until stopCh is closed.
+func (w *blueprintWatcher) run(stopCh <-chan struct{}) {
+	if w == nil {
+		return
+	}
+	go func() {
+		<-stopCh
+		w.queue.ShutDown()
+	}()
+
+	for {
+		item, quit := w.queue.Get()
+		if quit {
+			return
+		}
+		w.resyncService(item.(types.NamespacedName))
+		w.queue.Done(item)
+	}
+}
+
+// resyncService reconciles the load balancer of the Service with the current settings of its blueprint.
+func (w *blueprintWatcher) resyncService(key types.NamespacedName) {
+	w.mu.Lock()
+	user, ok := w.users[key]
+	resync, serviceLister, nodeLister := w.resync, w.serviceLister, w.nodeLister
+	w.mu.Unlock()
+	if !ok || resync == nil || serviceLister == nil || nodeLister == nil {
+		return
+	}
+
+	service, err := serviceLister.Services(key.Namespace).Get(key.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			w.track(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}, "", "")
+			return
+		}
+		klog.Errorf("Failed to get Service %s to apply its changed blueprint: %v", key, err)
+		w.queue.AddAfter(key, blueprintResyncRetryDelay)
+		return
+	}
+	nodes, err := listLoadBalancerNodes(nodeLister)
+	if err != nil {
+		klog.Errorf("Failed to list nodes to apply the changed blueprint of Service %s: %v", key, err)
+		w.queue.AddAfter(key, blueprintResyncRetryDelay)
+		return
+	}
+
+	// The error is already reported on the Service, an invalid blueprint is only retried once it changes again.
+	klog.InfoS("Applying the changed load balancer blueprint", "blueprint", user.blueprint, "service", key)
+	if err := resync(context.TODO(), user.clusterName, service.DeepCopy(), nodes); err != nil && classifyError(err) != errorClassTerminal {
+		klog.Errorf("Failed to apply the changed blueprint of Service %s: %v", key, err)
+		w.queue.AddAfter(key, blueprintResyncRetryDelay)
+	}
+}
+
+// getBlueprintAnnotations returns the annotations the settings of the blueprint stand for.
+func getBlueprintAnnotations(obj *unstructured.Unstructured, lbProvider string) (map[string]string, error) {
+	var blueprint lbBlueprint
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &blueprint); err != nil {
+		return nil, fmt.Errorf("invalid LBBlueprint %s: %v", obj.GetName(), err)
+	}
+	spec := blueprint.Spec
+	if spec.Provider != "" && spec.Provider != lbProvider {
+		return nil, fmt.Errorf("LBBlueprint %s is meant for the %s provider, the load balancers are created with the %s provider", obj.GetName(), spec.Provider, lbProvider)
+	}
+
+	annotations := make(map[string]string)
+	setString := func(key, value string) {
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+	setInt := func(key string, value *int) {
+		if value != nil {
+			annotations[key] = strconv.Itoa(*value)
+		}
+	}
+
+	setString(ServiceAnnotationLoadBalancerFlavorID, spec.FlavorID)
+	setString(ServiceAnnotationLoadBalancerAvailabilityZone, spec.AvailabilityZone)
+	if t := spec.Timeouts; t != nil {
+		setInt(ServiceAnnotationLoadBalancerTimeoutClientData, t.ClientData)
+		setInt(ServiceAnnotationLoadBalancerTimeoutMemberConnect, t.MemberConnect)
+		setInt(ServiceAnnotationLoadBalancerTimeoutMemberData, t.MemberData)
+		setInt(ServiceAnnotationLoadBalancerTimeoutTCPInspect, t.TCPInspect)
+	}
+	if m := spec.HealthMonitor; m != nil {
+		if m.Enabled != nil {
+			annotations[ServiceAnnotationLoadBalancerEnableHealthMonitor] = strconv.FormatBool(*m.Enabled)
+		}
+		setInt(ServiceAnnotationLoadBalancerHealthMonitorDelay, m.Delay)
+		setInt(ServiceAnnotationLoadBalancerHealthMonitorTimeout, m.Timeout)
+		setInt(ServiceAnnotationLoadBalancerHealthMonitorMaxRetries, m.MaxRetries)
+		setInt(ServiceAnnotationLoadBalancerHealthMonitorMaxRetriesDown, m.MaxRetriesDown)
+	}
+	if spec.TLS != nil {
+		setString(ServiceAnnotationTlsContainerRef, spec.TLS.ContainerRef)
+	}
+	return annotations, nil
+}
+
+// getSelectedBlueprintAnnotations returns the annotations of the blueprint selected by name with the
+// loadbalancer.openstack.org/blueprint annotation. A missing blueprint may be created later, so it isn't a terminal
+// error, unlike an invalid one.
+func (lbaas *LbaasV2) getSelectedBlueprintAnnotations(name string) (map[string]string, error) {
+	if lbaas.blueprints == nil || lbaas.blueprints.lister == nil {
+		return nil, asTerminalError(fmt.Errorf("%w %q, annotation %s requires enable-blueprints in the [LoadBalancer] section of the config", errUnknownBlueprint, name, ServiceAnnotationLoadBalancerBlueprint))
+	}
+	obj, err := lbaas.blueprints.lister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w %q selected by annotation %s", errUnknownBlueprint, name, ServiceAnnotationLoadBalancerBlueprint)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LBBlueprint %s: %v", name, err)
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T of LBBlueprint %s", obj, name)
+	}
+	annotations, err := getBlueprintAnnotations(u, lbaas.opts.LBProvider)
+	if err != nil {
+		return nil, asTerminalError(err)
+	}
+	klog.V(4).InfoS("Applying load balancer blueprint", "blueprint", name, "annotations", annotations)
+	return annotations, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// getServiceClass returns the class of the Service, its spec.loadBalancerClass or else its
+// loadbalancer.openstack.org/class annotation. Empty if it has none.
+func getServiceClass(service *corev1.Service) string {
+	if service.Spec.LoadBalancerClass != nil {
+		return *service.Spec.LoadBalancerClass
+	}
+	return getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerClass, "")
+}
+
+// handlesService tells if the load balancer of the Service is managed by this OCCM. With handled-class set, only the
+// Services of that class are, plus the ones without a class with default-class set. The others are left to the other
+// load balancer controllers of the cluster: nothing is provisioned nor deleted for them.
+func (lbaas *LbaasV2) handlesService(service *corev1.Service) bool {
+	if lbaas.opts.HandledClass == "" {
+		return true
+	}
+	class := getServiceClass(service)
+	if class == lbaas.opts.HandledClass || (class == "" && lbaas.opts.DefaultClass) {
+		return true
+	}
+	klog.V(4).InfoS("Ignoring Service of another load balancer class", "service", klog.KObj(service), "class", class, "handledClass", lbaas.opts.HandledClass)
+	return false
+}
+
+// releaseLoadBalancer deletes the load balancer of a Service whose class changed away from the handled one, so that
+// it isn't leaked once the controller of the new class takes the Service over. Only the Services with a load balancer
+// status are looked up, the others never had a load balancer of this OCCM.
+func (lbaas *LbaasV2) releaseLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service) error {
+	if len(service.Status.LoadBalancer.Ingress) == 0 {
+		return nil
+	}
+	name := lbaas.GetLoadBalancerName(ctx, clusterName, service)
+	regional, err := lbaas.lookupRegion(service, name)
+	if err != nil {
+		return err
+	}
+	if _, err := getLoadbalancerByName(regional.lb, name, ""); err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	klog.InfoS("Releasing the load balancer of a Service of another load balancer class", "service", klog.KObj(service), "class", getServiceClass(service))
+	if err := regional.ensureLoadBalancerDeleted(ctx, clusterName, service); err != nil {
+		return err
+	}
+	if err := lbaas.updateServiceMapping(ctx, service, nil); err != nil {
+		return err
+	}
+	lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBReleased,
+		"Deleted load balancer %s, the Service is of load balancer class %q now", name, getServiceClass(service))
+	return nil
+}
+
+// addHandledClass makes the handled class valid without a [LoadBalancerClass] section, the Services of the class
+// then get the settings of the [LoadBalancer] section.
+func addHandledClass(cfg *Config) {
+	class := cfg.LoadBalancer.HandledClass
+	if class == "" {
+		return
+	}
+	if cfg.LoadBalancerClass == nil {
+		cfg.LoadBalancerClass = make(map[string]*LBClass)
+	}
+	if _, ok := cfg.LoadBalancerClass[class]; !ok {
+		cfg.LoadBalancerClass[class] = &LBClass{}
+	}
+}
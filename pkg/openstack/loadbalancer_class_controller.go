@@ -0,0 +1,357 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+)
+
+const (
+	// LoadBalancerClassControllerName is the name of the controller reconciling the Services of the handled class.
+	LoadBalancerClassControllerName = "openstack-loadbalancer-class"
+
+	// loadBalancerClassFinalizer protects the load balancers of the Services of the handled class. It differs from the
+	// finalizer of the service controller, which would otherwise clean up these Services itself.
+	loadBalancerClassFinalizer = "loadbalancer.openstack.org/load-balancer-cleanup"
+
+	loadBalancerClassMaxRetries = 15
+)
+
+// loadBalancerClassController reconciles the load balancers of the Services whose spec.loadBalancerClass is the
+// handled class. The service controller of Kubernetes never passes these Services to the cloud provider, they're left
+// to the controller implementing their class.
+type loadBalancerClassController struct {
+	class         string
+	clusterName   string
+	lb            cloudprovider.LoadBalancer
+	kclient       kubernetes.Interface
+	recorder      record.EventRecorder
+	serviceLister corelisters.ServiceLister
+	nodeLister    corelisters.NodeLister
+	hasSynced     []cache.InformerSynced
+	queue         workqueue.RateLimitingInterface
+}
+
+// StartLoadBalancerClassControllerWrapper starts the controller reconciling the Services of the handled class. It's
+// only enabled when handled-class is set.
+func StartLoadBalancerClassControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		os, ok := cloud.(*OpenStack)
+		if !ok || !os.lbOpts.Enabled || os.lbOpts.HandledClass == "" {
+			klog.V(2).Infof("handled-class isn't set, not starting %s controller", LoadBalancerClassControllerName)
+			return nil, false, nil
+		}
+		lb, ok := os.LoadBalancer()
+		if !ok {
+			return nil, false, fmt.Errorf("load balancers aren't supported, cannot start %s controller", LoadBalancerClassControllerName)
+		}
+
+		kclient := controllerContext.ClientBuilder.ClientOrDie(initContext.ClientName)
+		c := newLoadBalancerClassController(os.lbOpts.HandledClass, completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+			lb, kclient, os.eventRecorder, controllerContext.InformerFactory)
+		go c.Run(ctx, int(completedConfig.ComponentConfig.ServiceController.ConcurrentServiceSyncs))
+		return nil, true, nil
+	}
+}
+
+func newLoadBalancerClassController(class, clusterName string, lb cloudprovider.LoadBalancer, kclient kubernetes.Interface,
+	recorder record.EventRecorder, informerFactory informers.SharedInformerFactory) *loadBalancerClassController {
+	serviceInformer := informerFactory.Core().V1().Services()
+	nodeInformer := informerFactory.Core().V1().Nodes()
+
+	c := &loadBalancerClassController{
+		class:         class,
+		clusterName:   clusterName,
+		lb:            lb,
+		kclient:       kclient,
+		recorder:      recorder,
+		serviceLister: serviceInformer.Lister(),
+		nodeLister:    nodeInformer.Lister(),
+		hasSynced:     []cache.InformerSynced{serviceInformer.Informer().HasSynced, nodeInformer.Informer().HasSynced},
+		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), LoadBalancerClassControllerName),
+	}
+
+	_, err := serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueService,
+		UpdateFunc: func(old, cur interface{}) {
+			oldService, ok1 := old.(*corev1.Service)
+			curService, ok2 := cur.(*corev1.Service)
+			if ok1 && ok2 && serviceChangedForLoadBalancer(oldService, curService) {
+				c.enqueueService(curService)
+			}
+		},
+	})
+	if err != nil {
+		klog.Errorf("Failed to watch Services, the Services of load balancer class %q won't be reconciled: %v", class, err)
+	}
+	_, err = nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(_ interface{}) { c.enqueueAllServices() },
+		UpdateFunc: func(old, cur interface{}) {
+			oldNode, ok1 := old.(*corev1.Node)
+			curNode, ok2 := cur.(*corev1.Node)
+			if ok1 && ok2 && nodeChangedForLoadBalancers(oldNode, curNode) {
+				c.enqueueAllServices()
+			}
+		},
+		DeleteFunc: func(_ interface{}) { c.enqueueAllServices() },
+	})
+	if err != nil {
+		klog.Errorf("Failed to watch nodes, the members of the Services of load balancer class %q won't follow them: %v", class, err)
+	}
+	return c
+}
+
+// serviceChangedForLoadBalancer tells if the change of the Service may change its load balancer. The updates of its
+// status and finalizers made by the controller itself don't.
+func serviceChangedForLoadBalancer(oldService, curService *corev1.Service) bool {
+	return !reflect.DeepEqual(oldService.Spec, curService.Spec) || !reflect.DeepEqual(oldService.Annotations, curService.Annotations) ||
+		(oldService.DeletionTimestamp == nil) != (curService.DeletionTimestamp == nil)
+}
+
+// nodeChangedForLoadBalancers tells if the node joined or left the load balancers.
+func nodeChangedForLoadBalancers(oldNode, curNode *corev1.Node) bool {
+	_, oldExcluded := oldNode.Labels[corev1.LabelNodeExcludeBalancers]
+	_, curExcluded := curNode.Labels[corev1.LabelNodeExcludeBalancers]
+	return oldExcluded != curExcluded || isNodeReady(oldNode) != isNodeReady(curNode) ||
+		!reflect.DeepEqual(oldNode.Status.Addresses, curNode.Status.Addresses)
+}
+
+// ownsService tells if the Service is reconciled by the controller: it's of the handled class, or it was and its load
+// balancer is still to be deleted.
+func (c *loadBalancerClassController) ownsService(service *corev1.Service) bool {
+	return c.wantsLoadBalancer(service) || cpoutil.Contains(service.Finalizers, loadBalancerClassFinalizer)
+}
+
+// wantsLoadBalancer tells if the Service should have a load balancer managed by the controller.
+func (c *loadBalancerClassController) wantsLoadBalancer(service *corev1.Service) bool {
+	return service.DeletionTimestamp == nil && service.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		service.Spec.LoadBalancerClass != nil && *service.Spec.LoadBalancerClass == c.class
+}
+
+func (c *loadBalancerClassController) enqueueService(obj interface{}) {
+	service, ok := obj.(*corev1.Service)
+	if !ok || !c.ownsService(service) {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(service)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueAllServices re-syncs the Services of the handled class, their members follow the nodes.
+func (c *loadBalancerClassController) enqueueAllServices() {
+	services, err := c.serviceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list Services to sync the load balancers of class %q: %v", c.class, err)
+		return
+	}
+	for _, service := range services {
+		c.enqueueService(service)
+	}
+}
+
+// Run runs the workers until the context is done.
+func (c *loadBalancerClassController) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.InfoS("Starting load balancer class controller", "class", c.class)
+	defer klog.InfoS("Shutting down load balancer class controller", "class", c.class)
+
+	if !cache.WaitForNamedCacheSync(LoadBalancerClassControllerName, ctx.Done(), c.hasSynced...) {
+		return
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+}
+
+func (c *loadBalancerClassController) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *loadBalancerClassController) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.syncService(ctx, key.(string))
+	if err == nil {
+		c.queue.Forget(key)
+	} else if c.queue.NumRequeues(key) < loadBalancerClassMaxRetries {
+		klog.ErrorS(err, "Failed to sync the load balancer of Service, retrying", "service", key)
+		c.queue.AddRateLimited(key)
+	} else {
+		klog.ErrorS(err, "Failed to sync the load balancer of Service, giving up", "service", key)
+		c.queue.Forget(key)
+		utilruntime.HandleError(err)
+	}
+	return true
+}
+
+// syncService ensures the load balancer of the Service, or deletes it once the Service is being deleted or stopped
+// being a LoadBalancer Service of the handled class.
+func (c *loadBalancerClassController) syncService(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	service, err := c.serviceLister.Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		// The finalizer keeps the Service until its load balancer is deleted, nothing is left to clean up.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.wantsLoadBalancer(service) {
+		return c.ensureLoadBalancer(ctx, service)
+	}
+	if cpoutil.Contains(service.Finalizers, loadBalancerClassFinalizer) {
+		return c.deleteLoadBalancer(ctx, service)
+	}
+	return nil
+}
+
+func (c *loadBalancerClassController) ensureLoadBalancer(ctx context.Context, service *corev1.Service) error {
+	klog.InfoS("Ensuring load balancer of Service", "service", klog.KObj(service), "class", c.class)
+	// The finalizer is added before the load balancer is created, so that it's never leaked.
+	if !cpoutil.Contains(service.Finalizers, loadBalancerClassFinalizer) {
+		updated := service.DeepCopy()
+		updated.Finalizers = append(updated.Finalizers, loadBalancerClassFinalizer)
+		if err := cpoutil.PatchService(ctx, c.kclient, service, updated); err != nil {
+			return fmt.Errorf("failed to add load balancer cleanup finalizer: %v", err)
+		}
+		service = updated
+	}
+
+	nodes, err := listLoadBalancerNodes(c.nodeLister)
+	if err != nil {
+		return err
+	}
+	status, err := c.lb.EnsureLoadBalancer(ctx, c.clusterName, service, nodes)
+	if err != nil {
+		c.recordEvent(service, corev1.EventTypeWarning, "SyncLoadBalancerFailed", fmt.Sprintf("Error syncing load balancer: %v", err))
+		return fmt.Errorf("failed to ensure load balancer: %w", err)
+	}
+	if status == nil {
+		return fmt.Errorf("service status returned by EnsureLoadBalancer is nil")
+	}
+	return c.updateStatus(ctx, service, status)
+}
+
+func (c *loadBalancerClassController) deleteLoadBalancer(ctx context.Context, service *corev1.Service) error {
+	klog.InfoS("Deleting load balancer of Service", "service", klog.KObj(service), "class", c.class)
+	// The class is cleared when the type of the Service changes, the finalizer tells the load balancer is still ours.
+	svc := service.DeepCopy()
+	svc.Spec.LoadBalancerClass = &c.class
+	if err := c.lb.EnsureLoadBalancerDeleted(ctx, c.clusterName, svc); err != nil {
+		c.recordEvent(service, corev1.EventTypeWarning, "SyncLoadBalancerFailed", fmt.Sprintf("Error deleting load balancer: %v", err))
+		return fmt.Errorf("failed to delete load balancer: %w", err)
+	}
+
+	if err := c.updateStatus(ctx, service, &corev1.LoadBalancerStatus{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	updated := service.DeepCopy()
+	updated.Finalizers = nil
+	for _, finalizer := range service.Finalizers {
+		if finalizer != loadBalancerClassFinalizer {
+			updated.Finalizers = append(updated.Finalizers, finalizer)
+		}
+	}
+	if err := cpoutil.PatchService(ctx, c.kclient, service, updated); err != nil {
+		return fmt.Errorf("failed to remove load balancer cleanup finalizer: %v", err)
+	}
+	c.recordEvent(service, corev1.EventTypeNormal, "DeletedLoadBalancer", "Deleted load balancer")
+	return nil
+}
+
+// updateStatus sets the load balancer status of the Service, if it changed.
+func (c *loadBalancerClassController) updateStatus(ctx context.Context, service *corev1.Service, status *corev1.LoadBalancerStatus) error {
+	if reflect.DeepEqual(service.Status.LoadBalancer, *status) {
+		return nil
+	}
+	updated := service.DeepCopy()
+	updated.Status.LoadBalancer = *status
+	if err := patchServiceStatus(ctx, c.kclient, service, updated); err != nil {
+		return fmt.Errorf("failed to update load balancer status: %w", err)
+	}
+	return nil
+}
+
+// patchServiceStatus patches the status of the Service with the changes of the updated one.
+func patchServiceStatus(ctx context.Context, kclient kubernetes.Interface, base, updated *corev1.Service) error {
+	baseJSON, err := json.Marshal(corev1.Service{Status: base.Status})
+	if err != nil {
+		return err
+	}
+	updatedJSON, err := json.Marshal(corev1.Service{Status: updated.Status})
+	if err != nil {
+		return err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(baseJSON, updatedJSON, corev1.Service{})
+	if err != nil {
+		return err
+	}
+	_, err = kclient.CoreV1().Services(base.Namespace).Patch(ctx, base.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+func (c *loadBalancerClassController) recordEvent(service *corev1.Service, eventtype, reason, message string) {
+	if c.recorder != nil {
+		c.recorder.Event(service, eventtype, reason, message)
+	}
+}
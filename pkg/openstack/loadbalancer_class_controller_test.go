@@ -0,0 +1,182 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// fakeClassLoadBalancer records the calls of the load balancer class controller.
+type fakeClassLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	status  *corev1.LoadBalancerStatus
+	ensured []*corev1.Service
+	deleted []*corev1.Service
+}
+
+func (f *fakeClassLoadBalancer) EnsureLoadBalancer(_ context.Context, _ string, service *corev1.Service, _ []*corev1.Node) (*corev1.LoadBalancerStatus, error) {
+	f.ensured = append(f.ensured, service)
+	return f.status, nil
+}
+
+func (f *fakeClassLoadBalancer) EnsureLoadBalancerDeleted(_ context.Context, _ string, service *corev1.Service) error {
+	f.deleted = append(f.deleted, service)
+	return nil
+}
+
+func TestLoadBalancerClassControllerOwnsService(t *testing.T) {
+	ourClass := "openstack"
+	otherClass := "other"
+	tests := []struct {
+		name       string
+		class      *string
+		svcType    corev1.ServiceType
+		finalizer  bool
+		deleting   bool
+		wantsLB    bool
+		ownService bool
+	}{
+		{
+			name:       "matching class",
+			class:      &ourClass,
+			svcType:    corev1.ServiceTypeLoadBalancer,
+			wantsLB:    true,
+			ownService: true,
+		},
+		{
+			name:    "other class",
+			class:   &otherClass,
+			svcType: corev1.ServiceTypeLoadBalancer,
+		},
+		{
+			name:    "no class",
+			svcType: corev1.ServiceTypeLoadBalancer,
+		},
+		{
+			name:    "matching class of a ClusterIP Service",
+			class:   &ourClass,
+			svcType: corev1.ServiceTypeClusterIP,
+		},
+		{
+			name:       "type changed away from LoadBalancer, class cleared",
+			svcType:    corev1.ServiceTypeClusterIP,
+			finalizer:  true,
+			ownService: true,
+		},
+		{
+			name:       "matching class being deleted",
+			class:      &ourClass,
+			svcType:    corev1.ServiceTypeLoadBalancer,
+			finalizer:  true,
+			deleting:   true,
+			ownService: true,
+		},
+	}
+
+	c := &loadBalancerClassController{class: ourClass}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Type: test.svcType, LoadBalancerClass: test.class},
+			}
+			if test.finalizer {
+				service.Finalizers = []string{loadBalancerClassFinalizer}
+			}
+			if test.deleting {
+				now := metav1.Now()
+				service.DeletionTimestamp = &now
+			}
+			assert.Equal(t, test.wantsLB, c.wantsLoadBalancer(service))
+			assert.Equal(t, test.ownService, c.ownsService(service))
+		})
+	}
+}
+
+func TestLoadBalancerClassControllerSyncService(t *testing.T) {
+	ourClass := "openstack"
+	otherClass := "other"
+	status := &corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.10"}}}
+	readyNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+	}
+	newService := func(name string, class *string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerClass: class},
+		}
+	}
+
+	// The Service already has the finalizer and the status, the controller has nothing to patch.
+	matched := newService("matched", &ourClass)
+	matched.Finalizers = []string{loadBalancerClassFinalizer}
+	matched.Status.LoadBalancer = *status
+	unmatched := newService("unmatched", &otherClass)
+	unclassified := newService("unclassified", nil)
+
+	lb := &fakeClassLoadBalancer{status: status}
+	c := &loadBalancerClassController{
+		class:         ourClass,
+		clusterName:   testClusterName,
+		lb:            lb,
+		serviceLister: corelisters.NewServiceLister(newTestIndexer(matched, unmatched, unclassified)),
+		nodeLister:    corelisters.NewNodeLister(newTestIndexer(readyNode)),
+	}
+
+	assert.NoError(t, c.syncService(context.TODO(), "default/matched"))
+	assert.Equal(t, []*corev1.Service{matched}, lb.ensured)
+
+	// The Services of the other classes and without a class are skipped, nothing is provisioned nor deleted.
+	for _, key := range []string{"default/unmatched", "default/unclassified", "default/gone"} {
+		assert.NoError(t, c.syncService(context.TODO(), key))
+	}
+	assert.Len(t, lb.ensured, 1)
+	assert.Empty(t, lb.deleted)
+}
+
+func TestServiceChangedForLoadBalancer(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+	}
+
+	updated := service.DeepCopy()
+	updated.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.10"}}
+	updated.Finalizers = []string{loadBalancerClassFinalizer}
+	assert.False(t, serviceChangedForLoadBalancer(service, updated))
+
+	updated = service.DeepCopy()
+	updated.Spec.Type = corev1.ServiceTypeClusterIP
+	assert.True(t, serviceChangedForLoadBalancer(service, updated))
+
+	updated = service.DeepCopy()
+	updated.Annotations = map[string]string{ServiceAnnotationLoadBalancerInternal: "true"}
+	assert.True(t, serviceChangedForLoadBalancer(service, updated))
+
+	updated = service.DeepCopy()
+	now := metav1.Now()
+	updated.DeletionTimestamp = &now
+	assert.True(t, serviceChangedForLoadBalancer(service, updated))
+}
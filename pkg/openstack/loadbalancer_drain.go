@@ -0,0 +1,214 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// nodeDrainResyncRetryDelay is how long the tracker waits before retrying to remove the members of the drained nodes.
+const nodeDrainResyncRetryDelay = time.Minute
+
+// nodeDrainTracker remembers since when the nodes are draining, as neither cordoning nor tainting a node records it.
+// It's kept in memory only, so the grace period starts over when OCCM restarts. The service controller doesn't
+// reconcile the load balancers when the nodes don't change, so once watching, the tracker also re-syncs the members of
+// the Services when the grace period of their draining nodes is over.
+type nodeDrainTracker struct {
+	mu    sync.Mutex
+	since map[string]time.Time
+	// waiting maps the Services with members on draining nodes to the name of their cluster.
+	waiting map[types.NamespacedName]string
+
+	serviceLister corelisters.ServiceLister
+	nodeLister    corelisters.NodeLister
+	queue         workqueue.DelayingInterface
+	resync        repopulateFunc
+}
+
+func newNodeDrainTracker() *nodeDrainTracker {
+	return &nodeDrainTracker{since: make(map[string]time.Time), waiting: make(map[types.NamespacedName]string)}
+}
+
+// watch lets the tracker re-sync the members of the Services once the grace period of their draining nodes is over.
+func (t *nodeDrainTracker) watch(informerFactory informers.SharedInformerFactory) {
+	t.serviceLister = informerFactory.Core().V1().Services().Lister()
+	t.nodeLister = informerFactory.Core().V1().Nodes().Lister()
+	t.queue = workqueue.NewNamedDelayingQueue("node-drain")
+}
+
+// setResync sets the function re-syncing the members of the Services.
+func (t *nodeDrainTracker) setResync(resync repopulateFunc) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resync = resync
+}
+
+// track schedules the re-sync of the members of the Service for when the grace period of the first of its draining
+// nodes is over. It's called once the members are reconciled, with the nodes of the Service.
+func (t *nodeDrainTracker) track(service *corev1.Service, clusterName string, nodes []*corev1.Node, gracePeriod time.Duration) {
+	if t == nil || t.queue == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	for _, node := range nodes {
+		since, ok := t.since[node.Name]
+		if !ok {
+			continue
+		}
+		if expiry := since.Add(gracePeriod); expiry.After(now) && (next.IsZero() || expiry.Before(next)) {
+			next = expiry
+		}
+	}
+
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if next.IsZero() {
+		delete(t.waiting, key)
+		return
+	}
+	t.waiting[key] = clusterName
+	t.queue.AddAfter(key, next.Sub(now))
+}
+
+// run re-syncs the members of the Services whose draining nodes are over the grace period until stopCh is closed.
+func (t *nodeDrainTracker) run(stopCh <-chan struct{}) {
+	if t == nil || t.queue == nil {
+		return
+	}
+	go func() {
+		<-stopCh
+		t.queue.ShutDown()
+	}()
+
+	for {
+		item, quit := t.queue.Get()
+		if quit {
+			return
+		}
+		t.resyncService(item.(types.NamespacedName))
+		t.queue.Done(item)
+	}
+}
+
+// resyncService removes the members of the nodes of the Service that are draining for longer than the grace period.
+func (t *nodeDrainTracker) resyncService(key types.NamespacedName) {
+	t.mu.Lock()
+	clusterName, ok := t.waiting[key]
+	resync := t.resync
+	t.mu.Unlock()
+	if !ok || resync == nil {
+		return
+	}
+
+	service, err := t.serviceLister.Services(key.Namespace).Get(key.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			t.mu.Lock()
+			delete(t.waiting, key)
+			t.mu.Unlock()
+			return
+		}
+		klog.Errorf("Failed to get Service %s to remove the members of its drained nodes: %v", key, err)
+		t.queue.AddAfter(key, nodeDrainResyncRetryDelay)
+		return
+	}
+	nodes, err := listLoadBalancerNodes(t.nodeLister)
+	if err != nil {
+		klog.Errorf("Failed to list nodes to remove the members of the drained nodes of Service %s: %v", key, err)
+		t.queue.AddAfter(key, nodeDrainResyncRetryDelay)
+		return
+	}
+
+	// A successful re-sync tracks the Service again, in case other nodes are still draining.
+	klog.InfoS("Removing the members of the nodes draining for longer than the grace period", "service", key)
+	if err := resync(context.TODO(), clusterName, service.DeepCopy(), nodes); err != nil {
+		klog.Errorf("Failed to remove the members of the drained nodes of Service %s: %v", key, err)
+		t.queue.AddAfter(key, nodeDrainResyncRetryDelay)
+	}
+}
+
+// observe records whether the node is draining at the given time and returns since when it's been draining.
+func (t *nodeDrainTracker) observe(nodeName string, draining bool, now time.Time) time.Time {
+	if t == nil {
+		return now
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !draining {
+		delete(t.since, nodeName)
+		return time.Time{}
+	}
+	since, ok := t.since[nodeName]
+	if !ok {
+		since = now
+		t.since[nodeName] = since
+	}
+	return since
+}
+
+// isNodeDraining returns true if the node is cordoned or has the taint configured to mark draining nodes.
+func isNodeDraining(node *corev1.Node, taintKey string) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	if taintKey == "" {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == taintKey {
+			return true
+		}
+	}
+	return false
+}
+
+// getNodeDrainState tells if the member of the node should be drained and if it's been draining for longer than the
+// grace period, so it should be removed. Draining is disabled when the grace period isn't configured.
+func (lbaas *LbaasV2) getNodeDrainState(node *corev1.Node) (draining bool, expired bool) {
+	gracePeriod := lbaas.opts.NodeDrainGracePeriod.Duration
+	if gracePeriod == 0 {
+		return false, false
+	}
+
+	now := time.Now()
+	draining = isNodeDraining(node, lbaas.opts.NodeDrainTaintKey)
+	since := lbaas.drainingNodes.observe(node.Name, draining, now)
+	if !draining {
+		return false, false
+	}
+	return true, now.Sub(since) >= gracePeriod
+}
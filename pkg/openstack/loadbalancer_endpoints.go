@@ -0,0 +1,369 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Behaviors for the Services without ready endpoints, set in no-endpoints-behavior
+const (
+	noEndpointsRemoveMembers = "remove-members"
+	noEndpointsKeepMembers   = "keep-members"
+)
+
+// repopulateFunc reconciles the members of the load balancer of a Service.
+type repopulateFunc func(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) error
+
+// serviceEndpointsWatcher tells if the Services have ready endpoints, so that the members of the ones without any can
+// be removed. The service controller doesn't reconcile the load balancers on endpoint changes, so the watcher also
+// removes the members of the Services once their last endpoint isn't ready, and re-populates them once their endpoints
+// are back.
+type serviceEndpointsWatcher struct {
+	endpointSliceLister discoverylisters.EndpointSliceLister
+	serviceLister       corelisters.ServiceLister
+	nodeLister          corelisters.NodeLister
+	hasSynced           func() bool
+	// removeMembers is set when no-endpoints-behavior is remove-members.
+	removeMembers bool
+
+	mu sync.Mutex
+	// emptied maps the Services whose members were removed to the name of their cluster.
+	emptied map[types.NamespacedName]string
+	// populated maps the Services whose load balancers have members to the name of their cluster.
+	populated  map[types.NamespacedName]string
+	repopulate repopulateFunc
+}
+
+func newServiceEndpointsWatcher(informerFactory informers.SharedInformerFactory, removeMembers bool) *serviceEndpointsWatcher {
+	endpointSliceInformer := informerFactory.Discovery().V1().EndpointSlices()
+	serviceInformer := informerFactory.Core().V1().Services()
+	nodeInformer := informerFactory.Core().V1().Nodes()
+
+	w := &serviceEndpointsWatcher{
+		endpointSliceLister: endpointSliceInformer.Lister(),
+		serviceLister:       serviceInformer.Lister(),
+		nodeLister:          nodeInformer.Lister(),
+		hasSynced: func() bool {
+			return endpointSliceInformer.Informer().HasSynced() && serviceInformer.Informer().HasSynced() && nodeInformer.Informer().HasSynced()
+		},
+		removeMembers: removeMembers,
+		emptied:       make(map[types.NamespacedName]string),
+		populated:     make(map[types.NamespacedName]string),
+	}
+	_, err := endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.onEndpointSliceChange,
+		UpdateFunc: func(_, obj interface{}) { w.onEndpointSliceChange(obj) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			w.onEndpointSliceChange(obj)
+		},
+	})
+	if err != nil {
+		klog.Errorf("Failed to watch EndpointSlices, the members of the Services won't be updated when their endpoints change: %v", err)
+	}
+	return w
+}
+
+// setRepopulate sets the function reconciling the members of the Services, both to remove and to re-populate them.
+func (w *serviceEndpointsWatcher) setRepopulate(repopulate repopulateFunc) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.repopulate = repopulate
+}
+
+// hasNoReadyEndpoints returns true if the Service is known to have no ready endpoints. It's false when it cannot be
+// told, so that the members are kept. The Services without a selector are skipped, as their endpoints may be managed
+// outside of the cluster.
+func (w *serviceEndpointsWatcher) hasNoReadyEndpoints(service *corev1.Service) bool {
+	if w == nil || len(service.Spec.Selector) == 0 || !w.hasSynced() {
+		return false
+	}
+
+	ready, err := hasReadyEndpoints(w.endpointSliceLister, service.Namespace, service.Name)
+	if err != nil {
+		klog.Warningf("Failed to get the endpoints of Service %s/%s, keeping its members: %v", service.Namespace, service.Name, err)
+		return false
+	}
+	return !ready
+}
+
+// hasStartingEndpoints returns true if the Service has endpoints that aren't ready, excluding the terminating ones.
+func (w *serviceEndpointsWatcher) hasStartingEndpoints(service *corev1.Service) bool {
+	if w == nil || len(service.Spec.Selector) == 0 || !w.hasSynced() {
+		return false
+	}
+
+	starting, err := hasStartingEndpoints(w.endpointSliceLister, service.Namespace, service.Name)
+	if err != nil {
+		klog.Warningf("Failed to get the endpoints of Service %s/%s: %v", service.Namespace, service.Name, err)
+		return false
+	}
+	return starting
+}
+
+// readyEndpointNodes returns the names of the nodes hosting ready endpoints of the Service, nil when it cannot be told.
+func (w *serviceEndpointsWatcher) readyEndpointNodes(service *corev1.Service) sets.Set[string] {
+	if w == nil || len(service.Spec.Selector) == 0 || !w.hasSynced() {
+		return nil
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service.Name})
+	slices, err := w.endpointSliceLister.EndpointSlices(service.Namespace).List(selector)
+	if err != nil {
+		klog.Warningf("Failed to get the endpoints of Service %s/%s: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+
+	nodes := sets.New[string]()
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.NodeName != nil && (endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready) {
+				nodes.Insert(*endpoint.NodeName)
+			}
+		}
+	}
+	return nodes
+}
+
+// readyEndpointZones returns the zones of the ready endpoints of the Service, nil when it cannot be told.
+func (w *serviceEndpointsWatcher) readyEndpointZones(service *corev1.Service) sets.Set[string] {
+	if w == nil || len(service.Spec.Selector) == 0 || !w.hasSynced() {
+		return nil
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service.Name})
+	slices, err := w.endpointSliceLister.EndpointSlices(service.Namespace).List(selector)
+	if err != nil {
+		klog.Warningf("Failed to get the endpoints of Service %s/%s: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+
+	zones := sets.New[string]()
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Zone != nil && (endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready) {
+				zones.Insert(*endpoint.Zone)
+			}
+		}
+	}
+	return zones
+}
+
+// setEndpointsReadiness sets whether the Service has no ready endpoints and, with the not-ready-members annotation,
+// whether its members are kept with weight 0 as its endpoints are starting.
+func (lbaas *LbaasV2) setEndpointsReadiness(service *corev1.Service, svcConf *serviceConfig) {
+	if lbaas.opts.NoEndpointsBehavior != noEndpointsRemoveMembers {
+		svcConf.noReadyEndpoints, svcConf.notReadyMembers = false, false
+		return
+	}
+	svcConf.noReadyEndpoints = lbaas.endpoints.hasNoReadyEndpoints(service)
+	svcConf.notReadyMembers = svcConf.noReadyEndpoints &&
+		getBoolFromServiceAnnotation(service, ServiceAnnotationLoadBalancerNotReadyMembers, false) &&
+		lbaas.endpoints.hasStartingEndpoints(service)
+}
+
+// track records whether the members of the Service were removed because it has no ready endpoints.
+func (w *serviceEndpointsWatcher) track(service *corev1.Service, clusterName string, emptied bool) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if emptied {
+		w.emptied[key] = clusterName
+		delete(w.populated, key)
+	} else {
+		w.populated[key] = clusterName
+		delete(w.emptied, key)
+	}
+}
+
+// forget stops tracking the Service, e.g. once its load balancer is deleted.
+func (w *serviceEndpointsWatcher) forget(service *corev1.Service) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	delete(w.emptied, key)
+	delete(w.populated, key)
+}
+
+// onEndpointSliceChange reconciles the members of the Service of the EndpointSlice when its ready endpoints are all
+// gone, to remove them, or when they are back after the members were removed, to re-populate them.
+func (w *serviceEndpointsWatcher) onEndpointSliceChange(obj interface{}) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	key := types.NamespacedName{Namespace: slice.Namespace, Name: slice.Labels[discoveryv1.LabelServiceName]}
+	if key.Name == "" {
+		return
+	}
+
+	w.mu.Lock()
+	clusterName, emptied := w.emptied[key]
+	populatedClusterName, populated := w.populated[key]
+	repopulate := w.repopulate
+	w.mu.Unlock()
+	if repopulate == nil || (!emptied && !populated) || (populated && !w.removeMembers) {
+		return
+	}
+	if populated {
+		clusterName = populatedClusterName
+	}
+
+	service, err := w.serviceLister.Services(key.Namespace).Get(key.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			w.mu.Lock()
+			delete(w.emptied, key)
+			delete(w.populated, key)
+			w.mu.Unlock()
+		}
+		return
+	}
+	if emptied {
+		ready, err := hasReadyEndpoints(w.endpointSliceLister, key.Namespace, key.Name)
+		if err != nil || !ready {
+			return
+		}
+	} else if !w.hasNoReadyEndpoints(service) {
+		return
+	}
+	nodes, err := w.listNodes()
+	if err != nil {
+		klog.Errorf("Failed to list nodes to update the members of Service %s: %v", key, err)
+		return
+	}
+
+	// The Service is tracked as it was if the reconcile fails, so that the next change of its endpoints retries it.
+	w.track(service, clusterName, !emptied)
+	go func() {
+		if emptied {
+			klog.InfoS("Re-populating members of Service with ready endpoints again", "service", key)
+		} else {
+			klog.InfoS("Removing members of Service without ready endpoints", "service", key)
+		}
+		if err := repopulate(context.TODO(), clusterName, service.DeepCopy(), nodes); err != nil {
+			klog.Errorf("Failed to update the members of Service %s: %v", key, err)
+			w.track(service, clusterName, emptied)
+		}
+	}()
+}
+
+// listNodes lists the nodes of the load balancers of the Services.
+func (w *serviceEndpointsWatcher) listNodes() ([]*corev1.Node, error) {
+	return listLoadBalancerNodes(w.nodeLister)
+}
+
+// listLoadBalancerNodes lists the ready nodes which aren't excluded from the load balancers, like the service
+// controller does.
+func listLoadBalancerNodes(nodeLister corelisters.NodeLister) ([]*corev1.Node, error) {
+	selector, err := labels.Parse("!" + corev1.LabelNodeExcludeBalancers)
+	if err != nil {
+		return nil, err
+	}
+	allNodes, err := nodeLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*corev1.Node
+	for _, node := range allNodes {
+		if isNodeReady(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// isNodeReady tells if the node has the Ready condition.
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// hasReadyEndpoints returns true if any of the EndpointSlices of the Service has a ready endpoint.
+func hasReadyEndpoints(lister discoverylisters.EndpointSliceLister, namespace, name string) (bool, error) {
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: name})
+	slices, err := lister.EndpointSlices(namespace).List(selector)
+	if err != nil {
+		return false, err
+	}
+
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			// A nil ready condition is to be interpreted as ready.
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// hasStartingEndpoints returns true if any of the EndpointSlices of the Service has an endpoint that isn't ready nor
+// terminating, e.g. the one of a pod that is starting.
+func hasStartingEndpoints(lister discoverylisters.EndpointSliceLister, namespace, name string) (bool, error) {
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: name})
+	slices, err := lister.EndpointSlices(namespace).List(selector)
+	if err != nil {
+		return false, err
+	}
+
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			terminating := endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating
+			if !ready && !terminating {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/cloud-provider/api"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// Classes of the errors of the reconciles of the load balancers.
+const (
+	// errorClassTransient errors, e.g. timeouts, rate limiting or load balancers in a PENDING_* state, are expected to
+	// go away on their own.
+	errorClassTransient = "transient"
+	// errorClassTerminal errors, e.g. invalid annotations, missing subnets or exceeded quotas, need someone to fix them.
+	errorClassTerminal = "terminal"
+)
+
+// terminalErrorRetryDelay is how long the reconciles failing with a terminal error are retried after. The service
+// controller retries the other errors with an exponential backoff starting at 5 seconds.
+const terminalErrorRetryDelay = 10 * time.Minute
+
+// terminalError marks an error that retrying won't fix, e.g. an invalid annotation of the Service.
+type terminalError struct {
+	err error
+}
+
+func (e *terminalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *terminalError) Unwrap() error {
+	return e.err
+}
+
+// asTerminalError marks the error as terminal, it returns nil for a nil error.
+func asTerminalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &terminalError{err: err}
+}
+
+// classifyError tells if the error of a reconcile is transient or terminal. Besides the errors marked as terminal, the
+// OpenStack API errors meaning the request is invalid (400), forbidden, e.g. because of the Octavia quotas (403), or
+// refers to a missing resource (404) are terminal, as well as the conflicts caused by the Neutron quotas. Everything
+// else, including the other conflicts, e.g. with the load balancers in a PENDING_* state, is considered transient.
+func classifyError(err error) string {
+	var terminal *terminalError
+	if errors.As(err, &terminal) {
+		return errorClassTerminal
+	}
+
+	var statusErr gophercloud.StatusCodeError
+	if errors.As(err, &statusErr) {
+		switch statusErr.GetStatusCode() {
+		case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound:
+			return errorClassTerminal
+		case http.StatusConflict:
+			var conflict gophercloud.ErrDefault409
+			if errors.As(err, &conflict) && bytes.Contains(conflict.Body, []byte("OverQuota")) {
+				return errorClassTerminal
+			}
+		}
+	}
+
+	return errorClassTransient
+}
+
+// handleReconcileError counts the error of the reconcile of the Service by class. A terminal error is reported with an
+// event, and the ensure is retried after terminalErrorRetryDelay instead of within seconds. Updating the Service still
+// triggers an ensure right away.
+func (lbaas *LbaasV2) handleReconcileError(mc *metrics.MetricContext, service *corev1.Service, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	class := classifyError(err)
+	mc.ObserveReconcileErrorClass(class)
+	if class != errorClassTerminal {
+		return err
+	}
+
+	lbaas.eventRecorder.Event(service, corev1.EventTypeWarning, eventLBTerminalError, err.Error())
+	// Only the errors of the ensure are retried according to the RetryError, the update and delete ones are retried
+	// with the exponential backoff anyway.
+	return api.NewRetryError(err.Error(), terminalErrorRetryDelay)
+}
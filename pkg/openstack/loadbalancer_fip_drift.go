@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	neutrontags "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// Handling of the floating IPs of the load balancers associated with another port outside of Kubernetes, set in
+// floating-ip-drift
+const (
+	fipDriftIgnore      = "ignore"
+	fipDriftReassociate = "reassociate"
+	fipDriftAdopt       = "adopt"
+)
+
+// tracksFloatingIPDrift returns true if the floating IPs of the load balancers are tagged with the load balancer, so
+// that they're found once associated with another port.
+func (lbaas *LbaasV2) tracksFloatingIPDrift() bool {
+	return lbaas.opts.FloatingIPDrift == fipDriftReassociate || lbaas.opts.FloatingIPDrift == fipDriftAdopt
+}
+
+// describeFloatingIPDrift tells where the floating IP of the load balancer went.
+func describeFloatingIPDrift(fip *floatingips.FloatingIP) string {
+	if fip.PortID == "" {
+		return "it was disassociated outside of Kubernetes"
+	}
+	return fmt.Sprintf("it was associated with port %s outside of Kubernetes", fip.PortID)
+}
+
+// isFloatingIPCreatedFor returns true if the floating IP was created by OCCM for a Service of the cluster.
+func isFloatingIPCreatedFor(fip *floatingips.FloatingIP, clusterName string) bool {
+	return strings.HasPrefix(fip.Description, "Floating IP for Kubernetes external service ") &&
+		strings.HasSuffix(fip.Description, " from cluster "+clusterName)
+}
+
+// reconcileFloatingIPDrift handles the floating IPs tagged for the load balancer but no longer associated with its VIP
+// port, and returns the floating IP of the VIP port. With reassociate, the floating IP is associated back with the VIP
+// port, the one associated with the VIP port in its place is disassociated. With adopt, the floating IP associated
+// with the VIP port in its place, if any, gets the load balancer tag. The floating IP replaced is deleted if it was
+// created by OCCM for the cluster and left unassociated, it's released otherwise: its load balancer tag is removed.
+func (lbaas *LbaasV2) reconcileFloatingIPDrift(clusterName string, service *corev1.Service, lb *loadbalancers.LoadBalancer, current *floatingips.FloatingIP) (*floatingips.FloatingIP, error) {
+	if !lbaas.tracksFloatingIPDrift() {
+		return current, nil
+	}
+
+	tag := fipTagLoadBalancer + lb.ID
+	tracked, err := openstackutil.GetFloatingIPs(lbaas.network, floatingips.ListOpts{Tags: tag})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list floating IPs of load balancer %s: %v", lb.ID, err)
+	}
+	for i := range tracked {
+		fip := &tracked[i]
+		if fip.PortID == lb.VipPortID {
+			continue
+		}
+
+		// Only a single floating IP can be associated with the VIP, the others tracked are released.
+		if lbaas.opts.FloatingIPDrift == fipDriftReassociate && (current == nil || !cpoutil.Contains(current.Tags, tag)) {
+			if current != nil {
+				klog.InfoS("Disassociating floating IP associated with the VIP port outside of Kubernetes", "floatingIP", current.FloatingIP, "lbID", lb.ID, "service", klog.KObj(service))
+				if _, err := lbaas.updateFloatingIP(current, nil); err != nil {
+					return nil, err
+				}
+			}
+			klog.InfoS("Re-associating floating IP with the VIP port", "floatingIP", fip.FloatingIP, "portID", fip.PortID, "lbID", lb.ID, "service", klog.KObj(service))
+			reassociated, err := lbaas.updateFloatingIP(fip, &lb.VipPortID)
+			if err != nil {
+				return nil, err
+			}
+			lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBFloatingIPDrift,
+				"Re-associated floating IP %s with load balancer %s, %s", fip.FloatingIP, lb.ID, describeFloatingIPDrift(fip))
+			current = reassociated
+			continue
+		}
+
+		// Nothing uses the floating IP created for the load balancer once replaced, it would leak.
+		if current != nil && fip.PortID == "" && isFloatingIPCreatedFor(fip, clusterName) {
+			if err := lbaas.deleteFloatingIPPTRRecord(fip, service); err != nil {
+				return nil, err
+			}
+			klog.InfoS("Deleting floating IP replaced outside of Kubernetes", "floatingIP", fip.FloatingIP, "replacement", current.FloatingIP, "lbID", lb.ID, "service", klog.KObj(service))
+			mc := metrics.NewMetricContext("floating_ip", "delete")
+			err := floatingips.Delete(lbaas.network, fip.ID).ExtractErr()
+			if err != nil && !cpoerrors.IsNotFound(err) {
+				_ = mc.ObserveRequest(err)
+				return nil, fmt.Errorf("failed to delete floating IP %s replaced by %s: %v", fip.FloatingIP, current.FloatingIP, err)
+			}
+			_ = mc.ObserveRequest(nil)
+			lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBFloatingIPDrift,
+				"Deleted floating IP %s of load balancer %s, it was replaced by floating IP %s outside of Kubernetes", fip.FloatingIP, lb.ID, current.FloatingIP)
+			continue
+		}
+
+		klog.InfoS("Releasing floating IP associated with another port", "floatingIP", fip.FloatingIP, "portID", fip.PortID, "lbID", lb.ID, "service", klog.KObj(service))
+		mc := metrics.NewMetricContext("floating_ip_tag", "delete")
+		err := neutrontags.Delete(lbaas.network, "floatingips", fip.ID, tag).ExtractErr()
+		if err != nil && !cpoerrors.IsNotFound(err) {
+			_ = mc.ObserveRequest(err)
+			return nil, fmt.Errorf("failed to remove tag of floating IP %s: %v", fip.FloatingIP, err)
+		}
+		_ = mc.ObserveRequest(nil)
+		lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBFloatingIPDrift,
+			"Released floating IP %s of load balancer %s, %s", fip.FloatingIP, lb.ID, describeFloatingIPDrift(fip))
+	}
+	return current, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// getFloatingIPPTRRecord returns the domain name of the PTR record of the floating IP set with the
+// loadbalancer.openstack.org/floating-ip-ptr-record annotation, fully qualified as Designate expects it.
+func getFloatingIPPTRRecord(service *corev1.Service) (string, error) {
+	name := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerFloatingIPPTRRecord, "")
+	if name == "" {
+		return "", nil
+	}
+	name = strings.TrimSuffix(name, ".")
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid domain name %q in annotation %s: %s", name, ServiceAnnotationLoadBalancerFloatingIPPTRRecord, strings.Join(errs, ", "))
+	}
+	return name + ".", nil
+}
+
+// ensureFloatingIPPTRRecord makes sure the floating IP has the PTR record requested by the Service, it's a no-op when
+// the annotation isn't set.
+func (lbaas *LbaasV2) ensureFloatingIPPTRRecord(fip *floatingips.FloatingIP, service *corev1.Service, svcConf *serviceConfig) error {
+	if svcConf.fipPTRRecord == "" {
+		return nil
+	}
+
+	wanted := openstackutil.FloatingIPPTRRecord{
+		PTRDName:    svcConf.fipPTRRecord,
+		Description: fmt.Sprintf("Kubernetes Service %s/%s", service.Namespace, service.Name),
+	}
+	current, err := openstackutil.GetFloatingIPPTRRecord(lbaas.dns, lbaas.region, fip.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get PTR record of floating IP %s: %v", fip.FloatingIP, err)
+	}
+	if current != nil && *current == wanted {
+		return nil
+	}
+
+	klog.InfoS("Setting PTR record of floating IP", "floatingIP", fip.FloatingIP, "ptrdname", wanted.PTRDName, "service", klog.KObj(service))
+	if err := openstackutil.SetFloatingIPPTRRecord(lbaas.dns, lbaas.region, fip.ID, wanted); err != nil {
+		return fmt.Errorf("failed to set PTR record of floating IP %s: %v", fip.FloatingIP, err)
+	}
+	return nil
+}
+
+// deleteFloatingIPPTRRecord removes the PTR record the Service requested for the floating IP, whether the floating IP
+// is deleted or kept.
+func (lbaas *LbaasV2) deleteFloatingIPPTRRecord(fip *floatingips.FloatingIP, service *corev1.Service) error {
+	if lbaas.dns == nil || service.Annotations[ServiceAnnotationLoadBalancerFloatingIPPTRRecord] == "" {
+		return nil
+	}
+
+	klog.InfoS("Removing PTR record of floating IP", "floatingIP", fip.FloatingIP, "service", klog.KObj(service))
+	if err := openstackutil.UnsetFloatingIPPTRRecord(lbaas.dns, lbaas.region, fip.ID); err != nil {
+		return fmt.Errorf("failed to remove PTR record of floating IP %s: %v", fip.FloatingIP, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// ensureFloatingIPQosPolicy makes sure the floating IP has the QoS policy set with the
+// loadbalancer.openstack.org/fip-qos-policy-id annotation, or none once the annotation is removed. Unlike the QoS
+// policy of the VIP port, it only limits the traffic going through the floating IP.
+func (lbaas *LbaasV2) ensureFloatingIPQosPolicy(fip *floatingips.FloatingIP, service *corev1.Service, policyID string) error {
+	current, err := openstackutil.GetFloatingIPQosPolicyID(lbaas.network, fip.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get QoS policy of floating IP %s: %v", fip.FloatingIP, err)
+	}
+	if current == policyID {
+		return nil
+	}
+
+	klog.InfoS("Updating QoS policy of floating IP", "floatingIP", fip.FloatingIP, "policyID", policyID, "service", klog.KObj(service))
+	if err := openstackutil.UpdateFloatingIPQosPolicy(lbaas.network, fip.ID, policyID); err != nil {
+		return fmt.Errorf("failed to update QoS policy of floating IP %s: %v", fip.FloatingIP, err)
+	}
+	return nil
+}
+
+// deleteFloatingIPQosPolicy removes the QoS policy the Service set on the floating IP kept after the Service is gone.
+func (lbaas *LbaasV2) deleteFloatingIPQosPolicy(fip *floatingips.FloatingIP, service *corev1.Service) error {
+	if service.Annotations[ServiceAnnotationLoadBalancerFloatingIPQosPolicyID] == "" {
+		return nil
+	}
+	return lbaas.ensureFloatingIPQosPolicy(fip, service, "")
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	neutrontags "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+)
+
+// Tags of the floating IPs of the Services, set when floating-ip-tags is enabled. All of them start with fipTagPrefix,
+// the tags set by others are left alone. The owner tag is set on the floating IPs requested by the Services when
+// load-balancer-ip-conflicts is oldest-wins, the load balancer tag on the floating IPs of the load balancers when
+// floating-ip-drift is enabled.
+const (
+	fipTagPrefix       = "kube_service_"
+	fipTagNamespace    = fipTagPrefix + "namespace="
+	fipTagName         = fipTagPrefix + "name="
+	fipTagAnnotation   = fipTagPrefix + "annotation_"
+	fipTagOwner        = fipTagPrefix + "owner="
+	fipTagLoadBalancer = fipTagPrefix + "loadbalancer="
+)
+
+// parseFloatingIPTagAnnotations parses the comma separated annotation keys of floating-ip-tag-annotations.
+func parseFloatingIPTagAnnotations(value string) ([]string, error) {
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid annotation key %q: %s", key, strings.Join(errs, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// getFloatingIPTags returns the tags of the floating IP of the Service: its namespace, its name and the values of the
+// annotations. Neutron doesn't allow commas in tags, so the comma separated values of an annotation get a tag each.
+func getFloatingIPTags(service *corev1.Service, annotations []string) []string {
+	tags := []string{
+		cpoutil.CutString255(fipTagNamespace + service.Namespace),
+		cpoutil.CutString255(fipTagName + service.Name),
+	}
+	for _, key := range annotations {
+		value, ok := service.Annotations[key]
+		if !ok {
+			continue
+		}
+		for _, v := range strings.Split(value, ",") {
+			tags = append(tags, cpoutil.CutString255(fmt.Sprintf("%s%s=%s", fipTagAnnotation, key, strings.TrimSpace(v))))
+		}
+	}
+	return tags
+}
+
+// getFloatingIPOwnerTags returns the owner tag of the floating IP requested by the Service, "<namespace>/<name>" of the
+// Service. None if it doesn't request an address.
+func getFloatingIPOwnerTags(service *corev1.Service) []string {
+	if getLoadBalancerIP(service) == "" {
+		return nil
+	}
+	return []string{cpoutil.CutString255(fmt.Sprintf("%s%s/%s", fipTagOwner, service.Namespace, service.Name))}
+}
+
+// getFloatingIPOwner returns "<namespace>/<name>" of the Service owning the floating IP according to its owner tag.
+func getFloatingIPOwner(fip *floatingips.FloatingIP) string {
+	for _, tag := range fip.Tags {
+		if owner, ok := strings.CutPrefix(tag, fipTagOwner); ok {
+			return owner
+		}
+	}
+	return ""
+}
+
+// mergeFloatingIPTags replaces the tags starting with one of the prefixes in the current tags of the floating IP with
+// the wanted ones.
+func mergeFloatingIPTags(current, wanted []string, prefixes ...string) []string {
+	tags := sets.New(wanted...)
+	for _, tag := range current {
+		managed := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(tag, prefix) {
+				managed = true
+				break
+			}
+		}
+		if !managed {
+			tags.Insert(tag)
+		}
+	}
+	return sets.List(tags)
+}
+
+// ensureFloatingIPTags sets the tags of the Service on the floating IP of its load balancer lbID, or removes them if
+// service is nil, e.g. when the floating IP is kept after the Service is gone. Without floating-ip-tags, only the owner
+// tag is managed, if load-balancer-ip-conflicts is oldest-wins, and the load balancer tag, if floating-ip-drift is
+// enabled.
+func (lbaas *LbaasV2) ensureFloatingIPTags(fip *floatingips.FloatingIP, service *corev1.Service, lbID string) error {
+	trackOwner := lbaas.opts.LoadBalancerIPConflicts == lbIPConflictsOldestWins
+	trackLB := lbaas.tracksFloatingIPDrift()
+	if !lbaas.opts.FloatingIPTags && !trackOwner && !trackLB {
+		return nil
+	}
+
+	var prefixes []string
+	if trackOwner {
+		prefixes = append(prefixes, fipTagOwner)
+	}
+	if trackLB {
+		prefixes = append(prefixes, fipTagLoadBalancer)
+	}
+	var wanted []string
+	if lbaas.opts.FloatingIPTags {
+		prefixes = []string{fipTagPrefix}
+		if service != nil {
+			annotations, err := parseFloatingIPTagAnnotations(lbaas.opts.FloatingIPTagAnnotations)
+			if err != nil {
+				return err
+			}
+			wanted = getFloatingIPTags(service, annotations)
+		}
+	}
+	if trackOwner && service != nil {
+		wanted = append(wanted, getFloatingIPOwnerTags(service)...)
+	}
+	if trackLB && service != nil {
+		wanted = append(wanted, fipTagLoadBalancer+lbID)
+	}
+
+	tags := mergeFloatingIPTags(fip.Tags, wanted, prefixes...)
+	if sets.New(tags...).Equal(sets.New(fip.Tags...)) {
+		return nil
+	}
+
+	klog.InfoS("Updating floating IP tags", "floatingIP", fip.FloatingIP, "tags", tags)
+	mc := metrics.NewMetricContext("floating_ip_tag", "update")
+	var err error
+	if len(tags) == 0 {
+		// The tags can't be replaced with an empty list.
+		err = neutrontags.DeleteAll(lbaas.network, "floatingips", fip.ID).ExtractErr()
+	} else {
+		_, err = neutrontags.ReplaceAll(lbaas.network, "floatingips", fip.ID, neutrontags.ReplaceAllOpts{Tags: tags}).Extract()
+	}
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to update tags of floating IP %s: %v", fip.FloatingIP, err)
+	}
+	return nil
+}
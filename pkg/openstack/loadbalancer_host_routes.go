@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// parseHostRoutes parses a comma separated list of routes in the "<destination CIDR> via <nexthop IP>" format. The
+// destinations are normalized to their network address, as Neutron expects.
+func parseHostRoutes(value string) ([]subnets.HostRoute, error) {
+	var routes []subnets.HostRoute
+	for _, route := range strings.Split(value, ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+
+		fields := strings.Fields(route)
+		if len(fields) != 3 || fields[1] != "via" {
+			return nil, fmt.Errorf("route %q isn't in the \"<destination CIDR> via <nexthop IP>\" format", route)
+		}
+		_, destination, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination of route %q: %v", route, err)
+		}
+		nextHop := net.ParseIP(fields[2])
+		if nextHop == nil {
+			return nil, fmt.Errorf("invalid nexthop of route %q", route)
+		}
+		if (destination.IP.To4() == nil) != (nextHop.To4() == nil) {
+			return nil, fmt.Errorf("destination and nexthop of route %q aren't of the same IP family", route)
+		}
+
+		hostRoute := subnets.HostRoute{DestinationCIDR: destination.String(), NextHop: nextHop.String()}
+		if !containsHostRoute(routes, hostRoute) {
+			routes = append(routes, hostRoute)
+		}
+	}
+	return routes, nil
+}
+
+func containsHostRoute(routes []subnets.HostRoute, route subnets.HostRoute) bool {
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureMemberSubnetHostRoutes adds the routes of member-subnet-host-routes to the host routes of the member subnet,
+// so that the amphorae can reach members behind other routers. The amphorae only pick the host routes up when they
+// are plugged into the subnet, so it's done before the load balancer gets created. The other host routes of the
+// subnet are kept.
+func (lbaas *LbaasV2) ensureMemberSubnetHostRoutes(subnetID string) error {
+	wantedRoutes, err := parseHostRoutes(lbaas.opts.MemberSubnetHostRoutes)
+	if err != nil {
+		return err
+	}
+	if len(wantedRoutes) == 0 || subnetID == "" {
+		return nil
+	}
+
+	mc := metrics.NewMetricContext("subnet", "get")
+	subnet, err := subnets.Get(lbaas.network, subnetID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to get member subnet %s: %v", subnetID, err)
+	}
+
+	routes := subnet.HostRoutes
+	for _, route := range wantedRoutes {
+		if !containsHostRoute(routes, route) {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == len(subnet.HostRoutes) {
+		return nil
+	}
+
+	klog.InfoS("Updating host routes of member subnet", "subnetID", subnetID, "hostRoutes", routes)
+	mc = metrics.NewMetricContext("subnet", "update")
+	_, err = subnets.Update(lbaas.network, subnetID, subnets.UpdateOpts{HostRoutes: &routes}).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to update host routes of member subnet %s: %v", subnetID, err)
+	}
+	return nil
+}
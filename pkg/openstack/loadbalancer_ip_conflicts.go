@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// Handling of the Services requesting the same load balancer IP, set in load-balancer-ip-conflicts
+const (
+	lbIPConflictsOldestWins = "oldest-wins"
+	lbIPConflictsIgnore     = "ignore"
+)
+
+// getLoadBalancerIPClaims returns the Services of type LoadBalancer requesting the address, the oldest first. The
+// creation timestamps only have a precision of a second, ties are broken by namespace and name so that every reconcile
+// agrees on the order.
+func getLoadBalancerIPClaims(services []*corev1.Service, address string) []*corev1.Service {
+	var claims []*corev1.Service
+	for _, service := range services {
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil {
+			continue
+		}
+		if getLoadBalancerIP(service) == address {
+			claims = append(claims, service)
+		}
+	}
+	sort.SliceStable(claims, func(i, j int) bool {
+		if !claims[i].CreationTimestamp.Equal(&claims[j].CreationTimestamp) {
+			return claims[i].CreationTimestamp.Before(&claims[j].CreationTimestamp)
+		}
+		if claims[i].Namespace != claims[j].Namespace {
+			return claims[i].Namespace < claims[j].Namespace
+		}
+		return claims[i].Name < claims[j].Name
+	})
+	return claims
+}
+
+// checkLoadBalancerIPConflict makes sure the floating IP requested by the Service isn't requested by an older Service
+// too. The oldest Service gets the floating IP and the others fail with a LoadBalancerIPConflict event, instead of
+// taking it from each other on every reconcile. It returns the Services requesting the address after this one, whose
+// floating IP can be taken over. It's a no-op unless load-balancer-ip-conflicts is oldest-wins.
+func (lbaas *LbaasV2) checkLoadBalancerIPConflict(ctx context.Context, service *corev1.Service, address string) (sets.Set[string], error) {
+	if lbaas.opts.LoadBalancerIPConflicts != lbIPConflictsOldestWins || lbaas.kclient == nil {
+		return nil, nil
+	}
+
+	list, err := lbaas.kclient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the Services requesting load balancer IP %s: %v", address, err)
+	}
+	var services []*corev1.Service
+	for i := range list.Items {
+		if lbaas.handlesService(&list.Items[i]) {
+			services = append(services, &list.Items[i])
+		}
+	}
+
+	younger := sets.New[string]()
+	claims := getLoadBalancerIPClaims(services, address)
+	if len(claims) == 0 {
+		return younger, nil
+	}
+	if owner := claims[0]; owner.Namespace != service.Namespace || owner.Name != service.Name {
+		lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBIPConflict,
+			"Load balancer IP %s is also requested by Service %s/%s, it's assigned to that older Service", address, owner.Namespace, owner.Name)
+		return nil, asTerminalError(fmt.Errorf("load balancer IP %s is assigned to Service %s/%s which requested it first", address, owner.Namespace, owner.Name))
+	}
+	for _, claim := range claims[1:] {
+		younger.Insert(fmt.Sprintf("%s/%s", claim.Namespace, claim.Name))
+	}
+	return younger, nil
+}
+
+// reclaimFloatingIP detaches the floating IP with the address from the load balancer of a Service which requested it
+// after this one, as told by its owner tag, so that it can be associated with the load balancer of this Service.
+func (lbaas *LbaasV2) reclaimFloatingIP(fips []floatingips.FloatingIP, address string, younger sets.Set[string]) error {
+	for i := range fips {
+		fip := &fips[i]
+		if fip.FloatingIP != address || fip.PortID == "" {
+			continue
+		}
+		owner := getFloatingIPOwner(fip)
+		if !younger.Has(owner) {
+			continue
+		}
+		klog.InfoS("Taking over floating IP from a Service which requested it later", "floatingIP", address, "owner", owner)
+		detached, err := lbaas.updateFloatingIP(fip, nil)
+		if err != nil {
+			return err
+		}
+		fips[i] = *detached
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/l7policies"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+const (
+	l7PoolPrefix = "pool_l7_"
+
+	xffClientHeaderAppend = "append"
+	xffClientHeaderReject = "reject"
+)
+
+// l7Route sends the requests received by the listener of a Service port whose path starts with pathPrefix to the L7
+// pool of another Service port, instead of the default pool of the listener.
+type l7Route struct {
+	listenerPort string // name of the Service port of the listener
+	pathPrefix   string
+	backendPort  string // name of the Service port whose members serve the requests
+}
+
+// getL7Routes parses the l7-path-routes annotation, comma separated <port name>:<path prefix>=<port name> routes. The
+// routes of a listener are sorted from the longest path prefix, the first matching route wins.
+func getL7Routes(service *corev1.Service, svcConf *serviceConfig, lbProvider string) ([]l7Route, error) {
+	value := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerL7PathRoutes, "")
+	if value == "" {
+		return nil, nil
+	}
+	if lbProvider == "ovn" {
+		return nil, fmt.Errorf("annotation %s is not supported by the ovn provider", ServiceAnnotationLoadBalancerL7PathRoutes)
+	}
+
+	ports := make(map[string]corev1.ServicePort)
+	for _, port := range service.Spec.Ports {
+		ports[port.Name] = port
+	}
+
+	var routes []l7Route
+	seen := sets.New[string]()
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		listenerPort, rest, found := strings.Cut(item, ":")
+		i := strings.LastIndex(rest, "=")
+		if !found || i < 0 {
+			return nil, fmt.Errorf("invalid route %q of annotation %s, expected <port name>:<path prefix>=<port name>", item, ServiceAnnotationLoadBalancerL7PathRoutes)
+		}
+		route := l7Route{listenerPort: listenerPort, pathPrefix: rest[:i], backendPort: rest[i+1:]}
+
+		if !strings.HasPrefix(route.pathPrefix, "/") {
+			return nil, fmt.Errorf("path prefix %q of annotation %s must start with /", route.pathPrefix, ServiceAnnotationLoadBalancerL7PathRoutes)
+		}
+		port, ok := ports[route.listenerPort]
+		if !ok {
+			return nil, fmt.Errorf("port %q referenced by annotation %s does not exist", route.listenerPort, ServiceAnnotationLoadBalancerL7PathRoutes)
+		}
+		if protocol := getListenerProtocol(port.Protocol, svcConf); protocol != listeners.ProtocolHTTP && protocol != listeners.ProtocolTerminatedHTTPS {
+			return nil, fmt.Errorf("listener of port %q referenced by annotation %s uses the %s protocol, L7 routes require annotation %s or %s", route.listenerPort, ServiceAnnotationLoadBalancerL7PathRoutes, protocol, ServiceAnnotationLoadBalancerXForwardedFor, ServiceAnnotationTlsContainerRef)
+		}
+		backendPort, ok := ports[route.backendPort]
+		if !ok {
+			return nil, fmt.Errorf("port %q referenced by annotation %s does not exist", route.backendPort, ServiceAnnotationLoadBalancerL7PathRoutes)
+		}
+		if backendPort.Protocol != corev1.ProtocolTCP {
+			return nil, fmt.Errorf("port %q referenced by annotation %s must use the TCP protocol", route.backendPort, ServiceAnnotationLoadBalancerL7PathRoutes)
+		}
+
+		key := route.listenerPort + ":" + route.pathPrefix
+		if seen.Has(key) {
+			return nil, fmt.Errorf("path prefix %q of port %q is routed twice by annotation %s", route.pathPrefix, route.listenerPort, ServiceAnnotationLoadBalancerL7PathRoutes)
+		}
+		seen.Insert(key)
+		routes = append(routes, route)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].pathPrefix) > len(routes[j].pathPrefix)
+	})
+	return routes, nil
+}
+
+// getL7Backends returns the Service ports the L7 routes send the requests to, in the order of the Service ports.
+func getL7Backends(service *corev1.Service, routes []l7Route) []corev1.ServicePort {
+	backends := sets.New[string]()
+	for _, route := range routes {
+		backends.Insert(route.backendPort)
+	}
+
+	var ports []corev1.ServicePort
+	for _, port := range service.Spec.Ports {
+		if backends.Has(port.Name) {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+func l7PoolName(backendPort, lbName string) string {
+	return cpoutil.CutString255(fmt.Sprintf("%s%s_%s", l7PoolPrefix, backendPort, lbName))
+}
+
+func l7MonitorName(backendPort, lbName string) string {
+	return cpoutil.CutString255(fmt.Sprintf("monitor_l7_%s_%s", backendPort, lbName))
+}
+
+func l7PolicyName(portIndex int, lbName string) string {
+	return cpoutil.CutString255(fmt.Sprintf("l7policy_%d_%s", portIndex, lbName))
+}
+
+func xffPolicyName(portIndex int, lbName string) string {
+	return cpoutil.CutString255(fmt.Sprintf("l7policy_xff_%d_%s", portIndex, lbName))
+}
+
+// isL7Pool tells if the pool is an L7 pool of the load balancer of the Service.
+func isL7Pool(pool v2pools.Pool, lbName string) bool {
+	return strings.HasPrefix(pool.Name, l7PoolPrefix) && strings.HasSuffix(pool.Name, "_"+lbName)
+}
+
+// l7PolicyMatches tells if the L7 policy sends the requests of the route to the pool.
+func l7PolicyMatches(policy l7policies.L7Policy, rules []l7policies.Rule, route l7Route, poolID string) bool {
+	if policy.Action != string(l7policies.ActionRedirectToPool) || policy.RedirectPoolID != poolID || len(rules) != 1 {
+		return false
+	}
+	rule := rules[0]
+	return rule.RuleType == string(l7policies.TypePath) && rule.CompareType == string(l7policies.CompareTypeStartWith) && rule.Value == route.pathPrefix && !rule.Invert
+}
+
+// getOctaviaL7Pools returns the L7 pools of the Service.
+func (lbaas *LbaasV2) getOctaviaL7Pools(lbID, lbName string) ([]v2pools.Pool, error) {
+	allPools, err := openstackutil.GetPools(lbaas.lb, lbID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pools of load balancer %s: %v", lbID, err)
+	}
+	var pools []v2pools.Pool
+	for _, pool := range allPools {
+		if isL7Pool(pool, lbName) {
+			pools = append(pools, pool)
+		}
+	}
+	return pools, nil
+}
+
+// ensureOctaviaL7Pool makes sure the L7 pool of the Service port exists, along with its members and health monitor.
+func (lbaas *LbaasV2) ensureOctaviaL7Pool(ctx context.Context, lbID, lbName string, pools []v2pools.Pool, service *corev1.Service, port corev1.ServicePort, nodes []*corev1.Node, svcConf *serviceConfig) (*v2pools.Pool, error) {
+	name := l7PoolName(port.Name, lbName)
+	var pool *v2pools.Pool
+	for i := range pools {
+		if pools[i].Name == name {
+			pool = &pools[i]
+			break
+		}
+	}
+
+	if pool == nil {
+		// The L7 pools belong to the load balancer, the listeners only reference them from their L7 policies.
+		createOpt := lbaas.buildPoolCreateOpt(string(listeners.ProtocolHTTP), service, svcConf)
+		createOpt.LoadbalancerID = lbID
+		createOpt.Name = name
+
+		klog.InfoS("Creating L7 pool", "lbID", lbID, "port", port.Name, "protocol", createOpt.Protocol)
+		var err error
+		pool, err = openstackutil.CreatePool(lbaas.lb, createOpt, lbID)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(2).Infof("L7 pool %s created for port %s", pool.ID, port.Name)
+	}
+
+	if err := lbaas.ensurePoolMembers(ctx, lbID, pool, service, port, nodes, svcConf); err != nil {
+		return nil, err
+	}
+	if err := lbaas.ensureOctaviaHealthMonitor(lbID, l7MonitorName(port.Name, lbName), pool, port, svcConf); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ensureOctaviaL7Policies makes sure the L7 policies of the listener are the ones of its routes. The L7 policies
+// created by others are left alone, the IDs of the pools they reference are returned along with the ones of the
+// routes.
+func (lbaas *LbaasV2) ensureOctaviaL7Policies(lbID, name string, listener *listeners.Listener, routes []l7Route, l7Pools map[string]*v2pools.Pool) (sets.Set[string], error) {
+	referenced := sets.New[string]()
+	if len(routes) == 0 && len(listener.L7Policies) == 0 {
+		return referenced, nil
+	}
+
+	policies, err := openstackutil.GetL7policies(lbaas.lb, listener.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get L7 policies of listener %s: %v", listener.ID, err)
+	}
+
+	matched := make([]bool, len(routes))
+	for _, policy := range policies {
+		if policy.Name != name {
+			referenced.Insert(policy.RedirectPoolID)
+			continue
+		}
+
+		rules, err := openstackutil.GetL7Rules(lbaas.lb, policy.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rules of L7 policy %s: %v", policy.ID, err)
+		}
+		keep := false
+		for i, route := range routes {
+			if !matched[i] && l7PolicyMatches(policy, rules, route, l7Pools[route.backendPort].ID) {
+				matched[i] = true
+				keep = true
+				break
+			}
+		}
+		if keep {
+			referenced.Insert(policy.RedirectPoolID)
+			continue
+		}
+
+		klog.InfoS("Deleting L7 policy", "policyID", policy.ID, "listenerID", listener.ID, "lbID", lbID)
+		if err := openstackutil.DeleteL7policy(lbaas.lb, policy.ID, lbID); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, route := range routes {
+		if matched[i] {
+			continue
+		}
+		pool := l7Pools[route.backendPort]
+		createOpts := l7policies.CreateOpts{
+			Name:           name,
+			ListenerID:     listener.ID,
+			Action:         l7policies.ActionRedirectToPool,
+			Position:       int32(i + 1),
+			RedirectPoolID: pool.ID,
+			Rules: []l7policies.CreateRuleOpts{{
+				RuleType:    l7policies.TypePath,
+				CompareType: l7policies.CompareTypeStartWith,
+				Value:       route.pathPrefix,
+			}},
+		}
+		klog.InfoS("Creating L7 policy", "listenerID", listener.ID, "lbID", lbID, "pathPrefix", route.pathPrefix, "poolID", pool.ID)
+		if _, err := openstackutil.CreateL7Policy(lbaas.lb, createOpts, lbID); err != nil {
+			return nil, fmt.Errorf("failed to create L7 policy of listener %s: %v", listener.ID, err)
+		}
+		referenced.Insert(pool.ID)
+	}
+
+	return referenced, nil
+}
+
+// ensureOctaviaL7Routes makes sure the L7 pools and policies of the Service match its L7 routes. The L7 pools are
+// diffed independently of the default pools of the listeners, and deleted once no L7 policy references them. Unless
+// the Service has L7 routes, it's a no-op when no listener of the load balancer had L7 policies.
+func (lbaas *LbaasV2) ensureOctaviaL7Routes(ctx context.Context, lbID, lbName string, ensuredListeners []*listeners.Listener, hadL7Policies bool, service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) error {
+	if len(svcConf.l7Routes) == 0 && !hadL7Policies {
+		return nil
+	}
+
+	pools, err := lbaas.getOctaviaL7Pools(lbID, lbName)
+	if err != nil {
+		return err
+	}
+
+	l7Pools := make(map[string]*v2pools.Pool)
+	for _, port := range getL7Backends(service, svcConf.l7Routes) {
+		pool, err := lbaas.ensureOctaviaL7Pool(ctx, lbID, lbName, pools, service, port, nodes, svcConf)
+		if err != nil {
+			return err
+		}
+		l7Pools[port.Name] = pool
+	}
+
+	referenced := sets.New[string]()
+	for portIndex, port := range service.Spec.Ports {
+		listener := ensuredListeners[portIndex]
+		if listener == nil {
+			continue
+		}
+		var routes []l7Route
+		for _, route := range svcConf.l7Routes {
+			if route.listenerPort == port.Name {
+				routes = append(routes, route)
+			}
+		}
+		policyPools, err := lbaas.ensureOctaviaL7Policies(lbID, l7PolicyName(portIndex, lbName), listener, routes, l7Pools)
+		if err != nil {
+			return err
+		}
+		referenced = referenced.Union(policyPools)
+	}
+
+	for _, pool := range l7Pools {
+		referenced.Insert(pool.ID)
+	}
+	for _, pool := range pools {
+		if referenced.Has(pool.ID) {
+			continue
+		}
+		klog.InfoS("Deleting unused L7 pool", "poolID", pool.ID, "lbID", lbID)
+		// Delete pool automatically deletes all its members.
+		if err := openstackutil.DeletePool(lbaas.lb, pool.ID, lbID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateOctaviaL7PoolMembers updates the members of the L7 pools of the Service.
+func (lbaas *LbaasV2) updateOctaviaL7PoolMembers(ctx context.Context, lbID, lbName string, service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig) error {
+	if len(svcConf.l7Routes) == 0 {
+		return nil
+	}
+
+	pools, err := lbaas.getOctaviaL7Pools(lbID, lbName)
+	if err != nil {
+		return err
+	}
+	for _, port := range getL7Backends(service, svcConf.l7Routes) {
+		name := l7PoolName(port.Name, lbName)
+		for i := range pools {
+			if pools[i].Name != name {
+				continue
+			}
+			if err := lbaas.ensurePoolMembers(ctx, lbID, &pools[i], service, port, nodes, svcConf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteOctaviaL7Pools deletes the L7 pools of the Service, once its listeners and their L7 policies are gone.
+func (lbaas *LbaasV2) deleteOctaviaL7Pools(lbID, lbName string) error {
+	pools, err := lbaas.getOctaviaL7Pools(lbID, lbName)
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools {
+		klog.InfoS("Deleting L7 pool", "poolID", pool.ID, "lbID", lbID)
+		if err := openstackutil.DeletePool(lbaas.lb, pool.ID, lbID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRejectClientXForwardedFor parses the x-forwarded-for-client-header annotation and tells if the listeners reject the
+// requests carrying an X-Forwarded-For header. Only the HTTP and TERMINATED_HTTPS listeners inserting the header, i.e.
+// the ones of the Services with x-forwarded-for, can inspect the headers of the requests.
+func getRejectClientXForwardedFor(service *corev1.Service, svcConf *serviceConfig, lbProvider string) (bool, error) {
+	value := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerXForwardedForClientHeader, xffClientHeaderAppend)
+	switch value {
+	case xffClientHeaderAppend:
+		return false, nil
+	case xffClientHeaderReject:
+	default:
+		return false, fmt.Errorf("invalid value %q of annotation %s, expected %q or %q", value, ServiceAnnotationLoadBalancerXForwardedForClientHeader, xffClientHeaderAppend, xffClientHeaderReject)
+	}
+	if lbProvider == "ovn" {
+		return false, fmt.Errorf("annotation %s is not supported by the ovn provider", ServiceAnnotationLoadBalancerXForwardedForClientHeader)
+	}
+	if !svcConf.keepClientIP {
+		return false, fmt.Errorf("annotation %s requires annotation %s, only the HTTP and TERMINATED_HTTPS listeners inserting the header can reject it", ServiceAnnotationLoadBalancerXForwardedForClientHeader, ServiceAnnotationLoadBalancerXForwardedFor)
+	}
+	return true, nil
+}
+
+// xffPolicyMatches tells if the L7 policy rejects the requests carrying an X-Forwarded-For header.
+func xffPolicyMatches(policy l7policies.L7Policy, rules []l7policies.Rule) bool {
+	if policy.Action != string(l7policies.ActionReject) || len(rules) != 1 {
+		return false
+	}
+	rule := rules[0]
+	return rule.RuleType == string(l7policies.TypeHeader) && rule.Key == annotationXForwardedFor && rule.CompareType == string(l7policies.CompareTypeRegex) && rule.Value == ".*" && !rule.Invert
+}
+
+// ensureOctaviaXFFPolicy makes sure the listener rejects the requests carrying an X-Forwarded-For header when reject is
+// set, and doesn't otherwise. Octavia evaluates the REJECT policies before the redirecting ones, so the spoofed
+// requests are rejected whichever the L7 routes of the listener.
+func (lbaas *LbaasV2) ensureOctaviaXFFPolicy(lbID, name string, listener *listeners.Listener, reject bool) error {
+	if !reject && len(listener.L7Policies) == 0 {
+		return nil
+	}
+
+	policies, err := openstackutil.GetL7policies(lbaas.lb, listener.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get L7 policies of listener %s: %v", listener.ID, err)
+	}
+
+	found := false
+	for _, policy := range policies {
+		if policy.Name != name {
+			continue
+		}
+		if reject && !found {
+			rules, err := openstackutil.GetL7Rules(lbaas.lb, policy.ID)
+			if err != nil {
+				return fmt.Errorf("failed to get rules of L7 policy %s: %v", policy.ID, err)
+			}
+			if xffPolicyMatches(policy, rules) {
+				found = true
+				continue
+			}
+		}
+
+		klog.InfoS("Deleting X-Forwarded-For L7 policy", "policyID", policy.ID, "listenerID", listener.ID, "lbID", lbID)
+		if err := openstackutil.DeleteL7policy(lbaas.lb, policy.ID, lbID); err != nil {
+			return err
+		}
+	}
+	if !reject || found {
+		return nil
+	}
+
+	createOpts := l7policies.CreateOpts{
+		Name:       name,
+		ListenerID: listener.ID,
+		Action:     l7policies.ActionReject,
+		Position:   1,
+		Rules: []l7policies.CreateRuleOpts{{
+			RuleType:    l7policies.TypeHeader,
+			CompareType: l7policies.CompareTypeRegex,
+			Key:         annotationXForwardedFor,
+			Value:       ".*",
+		}},
+	}
+	klog.InfoS("Creating L7 policy rejecting the requests with an X-Forwarded-For header", "listenerID", listener.ID, "lbID", lbID)
+	if _, err := openstackutil.CreateL7Policy(lbaas.lb, createOpts, lbID); err != nil {
+		return fmt.Errorf("failed to create X-Forwarded-For L7 policy of listener %s: %v", listener.ID, err)
+	}
+	return nil
+}
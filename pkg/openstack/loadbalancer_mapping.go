@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// serviceMapping is the entry of a Service in the ConfigMap of service-mapping-configmap.
+type serviceMapping struct {
+	LoadBalancerID string   `json:"loadBalancerID"`
+	VIPAddress     string   `json:"vipAddress"`
+	FloatingIP     string   `json:"floatingIP,omitempty"`
+	ListenerIDs    []string `json:"listenerIDs"`
+}
+
+// parseServiceMappingConfigMap splits the value of service-mapping-configmap into the namespace and the name of the
+// ConfigMap. An empty value disables the mapping.
+func parseServiceMappingConfigMap(value string) (string, string, error) {
+	if value == "" {
+		return "", "", nil
+	}
+
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok {
+		return "", "", fmt.Errorf("%q isn't in the <namespace>/<name> format", value)
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid name %q: %s", name, strings.Join(errs, ", "))
+	}
+	return namespace, name, nil
+}
+
+// serviceMappingKey returns the key of the Service in the ConfigMap. Neither namespaces nor Service names can contain
+// dots, so the key is unique.
+func serviceMappingKey(service *corev1.Service) string {
+	return service.Namespace + "." + service.Name
+}
+
+// setServiceMapping sets the entry of the Service in the data of the ConfigMap, or removes it if mapping is nil. It
+// returns true if the data changed.
+func setServiceMapping(configMap *corev1.ConfigMap, service *corev1.Service, mapping *serviceMapping) (bool, error) {
+	key := serviceMappingKey(service)
+	if mapping == nil {
+		if _, ok := configMap.Data[key]; !ok {
+			return false, nil
+		}
+		delete(configMap.Data, key)
+		return true, nil
+	}
+
+	value, err := json.Marshal(mapping)
+	if err != nil {
+		return false, err
+	}
+	if configMap.Data[key] == string(value) {
+		return false, nil
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[key] = string(value)
+	return true, nil
+}
+
+// updateServiceMapping records the load balancer of the Service in the ConfigMap of service-mapping-configmap, or
+// removes its entry if mapping is nil. The ConfigMap is created if it doesn't exist. It's a no-op when
+// service-mapping-configmap isn't set.
+func (lbaas *LbaasV2) updateServiceMapping(ctx context.Context, service *corev1.Service, mapping *serviceMapping) error {
+	namespace, name, err := parseServiceMappingConfigMap(lbaas.opts.ServiceMappingConfigMap)
+	if err != nil || name == "" {
+		return err
+	}
+
+	// The ConfigMap is shared by all the Services reconciled in parallel, conflicts are expected.
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := lbaas.kclient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if mapping == nil {
+				return nil
+			}
+			configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+			if _, err := setServiceMapping(configMap, service, mapping); err != nil {
+				return err
+			}
+			_, err = lbaas.kclient.CoreV1().ConfigMaps(namespace).Create(ctx, configMap, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created by the reconcile of another Service in the meantime, retry updating it.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		changed, err := setServiceMapping(configMap, service, mapping)
+		if err != nil || !changed {
+			return err
+		}
+		_, err = lbaas.kclient.CoreV1().ConfigMaps(namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the load balancer of Service %s/%s in ConfigMap %s/%s: %v", service.Namespace, service.Name, namespace, name, err)
+	}
+
+	klog.V(4).InfoS("Updated load balancer mapping", "service", klog.KObj(service), "configMap", klog.KRef(namespace, name))
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"hash/fnv"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// limitMemberNodes returns the nodes getting members in the pools of the Service, at most max-members-per-pool of
+// them. The Service gets an event when its eligible nodes are over the limit, identical events are throttled.
+func (lbaas *LbaasV2) limitMemberNodes(service *corev1.Service, nodes []*corev1.Node) []*corev1.Node {
+	limit := lbaas.opts.MaxMembersPerPool
+	if limit <= 0 || len(nodes) <= limit {
+		return nodes
+	}
+
+	// Only the nodes hosting endpoints serve the traffic of the Services with the Local traffic policy.
+	var endpointNodes sets.Set[string]
+	if lbaas.getExternalTrafficPolicy(service) == corev1.ServiceExternalTrafficPolicyLocal {
+		endpointNodes = lbaas.endpoints.readyEndpointNodes(service)
+	}
+	selected := selectMemberNodes(service.Namespace+"/"+service.Name, nodes, endpointNodes, limit)
+
+	klog.InfoS("Limiting the members of the pools of the Service", "service", klog.KObj(service), "eligibleNodes", len(nodes), "maxMembersPerPool", limit)
+	lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBMemberLimit,
+		"Service has %d eligible nodes, only %d of them are members of the load balancer pools as max-members-per-pool is %d", len(nodes), limit, limit)
+	return selected
+}
+
+// selectMemberNodes picks limit of the nodes, the ones in endpointNodes first. The other nodes are ranked by a hash of
+// their name and the key, so that every Service gets its own subset of the nodes, which only changes by the nodes
+// added or removed.
+func selectMemberNodes(key string, nodes []*corev1.Node, endpointNodes sets.Set[string], limit int) []*corev1.Node {
+	rank := func(node *corev1.Node) uint64 {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key + "/" + node.Name))
+		return h.Sum64()
+	}
+
+	ranked := make([]*corev1.Node, len(nodes))
+	copy(ranked, nodes)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		iEndpoint, jEndpoint := endpointNodes.Has(ranked[i].Name), endpointNodes.Has(ranked[j].Name)
+		if iEndpoint != jEndpoint {
+			return iEndpoint
+		}
+		return rank(ranked[i]) < rank(ranked[j])
+	})
+	return ranked[:limit]
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// memberMoveRetryDelay is how long the reconcile of a Service is retried after while the members on the new addresses
+// of its nodes aren't serving yet.
+const memberMoveRetryDelay = 15 * time.Second
+
+// pendingMemberMoves collects the nodes whose members are still moving in the pools of a Service. The pools are
+// reconciled in parallel.
+type pendingMemberMoves struct {
+	mu    sync.Mutex
+	pools []string
+}
+
+func (p *pendingMemberMoves) add(poolID string, nodes []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pools = append(p.pools, fmt.Sprintf("members of nodes %s on their new addresses are not ONLINE in pool %s yet", strings.Join(nodes, ", "), poolID))
+}
+
+// err returns the error putting off the next reconcile of the Service while members are moving, so that a later
+// reconcile finishes the moves, or nil.
+func (p *pendingMemberMoves) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pools) == 0 {
+		return nil
+	}
+	return api.NewRetryError(strings.Join(p.pools, "; ")+", their previous members are kept", memberMoveRetryDelay)
+}
+
+// memberMove is the member of a node whose address changed, e.g. when the subnet of the nodes was re-IPed, along with
+// the member replacing it.
+type memberMove struct {
+	old v2pools.Member
+	new v2pools.BatchUpdateMemberOpts
+}
+
+// getMemberMoves returns the members of the pool of the nodes whose address changed. The members are told apart by the
+// name of their node and their port.
+func getMemberMoves(poolMembers []v2pools.Member, members []v2pools.BatchUpdateMemberOpts) []memberMove {
+	wanted := make(map[string]v2pools.BatchUpdateMemberOpts)
+	for _, member := range members {
+		if member.Name != nil {
+			wanted[fmt.Sprintf("%s-%d", *member.Name, member.ProtocolPort)] = member
+		}
+	}
+
+	var moves []memberMove
+	for _, member := range poolMembers {
+		if opts, ok := wanted[fmt.Sprintf("%s-%d", member.Name, member.ProtocolPort)]; ok && opts.Address != member.Address {
+			moves = append(moves, memberMove{old: member, new: opts})
+		}
+	}
+	return moves
+}
+
+// findMember returns the member of the pool with the address and port, or nil.
+func findMember(poolMembers []v2pools.Member, address string, port int) *v2pools.Member {
+	for i := range poolMembers {
+		if poolMembers[i].Address == address && poolMembers[i].ProtocolPort == port {
+			return &poolMembers[i]
+		}
+	}
+	return nil
+}
+
+// isMemberServing tells if the member gets the traffic: ONLINE, or NO_MONITOR when the pool has no health monitor. The
+// members of a monitored pool are NO_MONITOR until they're first checked.
+func isMemberServing(member *v2pools.Member, monitored bool) bool {
+	if member == nil {
+		return false
+	}
+	return member.OperatingStatus == operatingStatusOnline || (!monitored && member.OperatingStatus == operatingStatusNoMonitor)
+}
+
+// keepMemberOpts returns the batch update options keeping the member as it is.
+func keepMemberOpts(member v2pools.Member) v2pools.BatchUpdateMemberOpts {
+	opts := v2pools.BatchUpdateMemberOpts{
+		Address:      member.Address,
+		ProtocolPort: member.ProtocolPort,
+		Name:         &member.Name,
+		Weight:       &member.Weight,
+		Backup:       &member.Backup,
+	}
+	if member.SubnetID != "" {
+		opts.SubnetID = &member.SubnetID
+	}
+	if member.MonitorPort != 0 {
+		opts.MonitorPort = &member.MonitorPort
+	}
+	return opts
+}
+
+// moveMembers moves the members of the nodes whose address changed without interrupting the traffic. The members on
+// the new addresses are created next to the previous ones first. Once they're serving, the previous members are
+// drained with weight 0 for the node drain grace period, like the members of draining nodes, and then deleted. It
+// returns the previous members to keep in the pool for now, the members of the pool after the new ones were created,
+// and the nodes whose new members aren't serving yet: their previous members are kept as they are while they're
+// still serving themselves. The new members aren't waited for, a later reconcile picks them up once they're serving.
+func (lbaas *LbaasV2) moveMembers(ctx context.Context, lbID string, pool *v2pools.Pool, moves []memberMove, poolMembers []v2pools.Member, members []v2pools.BatchUpdateMemberOpts) ([]v2pools.Member, []v2pools.Member, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The members on the new addresses are created along with the previous ones.
+	overlap := append([]v2pools.BatchUpdateMemberOpts{}, members...)
+	created := false
+	for _, move := range moves {
+		overlap = append(overlap, keepMemberOpts(move.old))
+		if findMember(poolMembers, move.new.Address, move.new.ProtocolPort) == nil {
+			klog.InfoS("Moving member to the new address of its node", "poolID", pool.ID, "node", move.old.Name, "address", move.new.Address, "previousAddress", move.old.Address, "previousSubnetID", move.old.SubnetID)
+			created = true
+		}
+	}
+	if created {
+		if err := openstackutil.BatchUpdatePoolMembers(lbaas.lb, lbID, pool.ID, overlap); err != nil {
+			return nil, nil, nil, err
+		}
+
+		// The members created are checked right away, the pools without health monitor serve them at once.
+		var err error
+		poolMembers, err = openstackutil.GetMembersbyPool(lbaas.lb, pool.ID)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to get members of pool %s: %v", pool.ID, err)
+		}
+	}
+
+	monitored := pool.MonitorID != ""
+
+	gracePeriod := lbaas.opts.NodeDrainGracePeriod.Duration
+	var kept []v2pools.Member
+	var pending []string
+	for _, move := range moves {
+		old := findMember(poolMembers, move.old.Address, move.old.ProtocolPort)
+		if old == nil {
+			continue
+		}
+		if !isMemberServing(findMember(poolMembers, move.new.Address, move.new.ProtocolPort), monitored) {
+			// The previous member is only kept while it's the one serving the node, with its weight back if it was
+			// draining already.
+			if isMemberServing(old, monitored) {
+				restored := *old
+				restored.Weight = *move.new.Weight
+				kept = append(kept, restored)
+				pending = append(pending, old.Name)
+			}
+			continue
+		}
+		drained := *old
+		drained.Weight = 0
+		switch {
+		case gracePeriod == 0:
+		case old.Weight != 0:
+			klog.InfoS("Draining member on the previous address of its node", "poolID", pool.ID, "node", old.Name, "address", old.Address)
+			kept = append(kept, drained)
+		case time.Since(old.UpdatedAt) < gracePeriod:
+			kept = append(kept, drained)
+		}
+	}
+	return kept, poolMembers, pending, nil
+}
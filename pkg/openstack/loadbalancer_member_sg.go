@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// listSecurityGroups returns the security groups matching the options.
+func (lbaas *LbaasV2) listSecurityGroups(opts groups.ListOpts) ([]groups.SecGroup, error) {
+	mc := metrics.NewMetricContext("security_group", "list")
+	page, err := groups.List(lbaas.network, opts).AllPages()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return groups.ExtractGroups(page)
+}
+
+// getMemberSecurityGroupID returns the ID of the existing security group set by member-security-group or
+// member-security-group-tags, empty when neither is set and every Service gets its own security group. The name is
+// tried first, then the ID. Exactly one security group must match.
+func (lbaas *LbaasV2) getMemberSecurityGroupID() (string, error) {
+	var sgs []groups.SecGroup
+	var err error
+	ref := lbaas.opts.MemberSecurityGroup
+	switch {
+	case lbaas.opts.MemberSecurityGroupTags != "":
+		ref = fmt.Sprintf("with tags %s", lbaas.opts.MemberSecurityGroupTags)
+		sgs, err = lbaas.listSecurityGroups(groups.ListOpts{Tags: lbaas.opts.MemberSecurityGroupTags})
+	case lbaas.opts.MemberSecurityGroup != "":
+		sgs, err = lbaas.listSecurityGroups(groups.ListOpts{Name: lbaas.opts.MemberSecurityGroup})
+		if err == nil && len(sgs) == 0 {
+			sgs, err = lbaas.listSecurityGroups(groups.ListOpts{ID: lbaas.opts.MemberSecurityGroup})
+		}
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find member security group %s: %w", ref, err)
+	}
+
+	switch len(sgs) {
+	case 0:
+		return "", fmt.Errorf("member security group %s: %w", ref, cpoerrors.ErrNotFound)
+	case 1:
+		return sgs[0].ID, nil
+	default:
+		return "", fmt.Errorf("member security group %s: %w", ref, cpoerrors.ErrMultipleResults)
+	}
+}
+
+// ensureMemberSecurityGroupRules opens the member ports of the Service in the member security group, and applies it to
+// the ports of the nodes. The security group is shared by the Services and may hold rules of the operator, only the
+// rules described with the security group name of the Service are managed, see getSecurityGroupName. The security
+// group isn't removed from the ports of the nodes, as it's shared.
+func (lbaas *LbaasV2) ensureMemberSecurityGroupRules(service *corev1.Service, svcConf *serviceConfig, nodes []*corev1.Node, sgID string) error {
+	description := getSecurityGroupName(service)
+	existingRules, err := getSecurityGroupRules(lbaas.network, rules.ListOpts{SecGroupID: sgID, Description: description})
+	if err != nil {
+		return fmt.Errorf("failed to find security group rules of Service %s/%s in %s: %v", service.Namespace, service.Name, sgID, err)
+	}
+
+	wantedRules, err := lbaas.getServiceSecurityGroupRules(service, svcConf, sgID)
+	if err != nil {
+		return err
+	}
+	for i := range wantedRules {
+		wantedRules[i].Description = description
+	}
+	if err := lbaas.syncSecurityGroupRules(sgID, wantedRules, existingRules); err != nil {
+		return err
+	}
+
+	_, err = applyNodeSecurityGroupIDForLB(lbaas.network, nodes, sgID)
+	return err
+}
+
+// deleteMemberSecurityGroupRules deletes the rules of the Service from the member security group, if any is set.
+func (lbaas *LbaasV2) deleteMemberSecurityGroupRules(service *corev1.Service) error {
+	sgID, err := lbaas.getMemberSecurityGroupID()
+	if errors.Is(err, cpoerrors.ErrNotFound) {
+		klog.InfoS("Member security group not found, there are no rules of the Service to delete", "service", klog.KObj(service), "err", err)
+		return nil
+	}
+	if err != nil || sgID == "" {
+		return err
+	}
+
+	description := getSecurityGroupName(service)
+	existingRules, err := getSecurityGroupRules(lbaas.network, rules.ListOpts{SecGroupID: sgID, Description: description})
+	if err != nil {
+		return fmt.Errorf("failed to find security group rules of Service %s/%s in %s: %v", service.Namespace, service.Name, sgID, err)
+	}
+	for _, rule := range existingRules {
+		klog.InfoS("Deleting rule of the Service from the member security group", "service", klog.KObj(service), "rule", rule.ID, "securityGroup", sgID)
+		if err := deleteSecurityGroupRule(lbaas.network, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// memberStatusWatcher periodically reports the members of the load balancers of the Services that Octavia considers
+// down, with events on the Services and on the nodes of the members. The status tree of a load balancer gets the
+// statuses of all its members at once, it's requested once per refresh along with the listeners telling the ones of
+// each Service, even if the load balancer is shared. The members down are cached, so that the events are only emitted
+// when a member goes down or comes back.
+type memberStatusWatcher struct {
+	lbaas         *LbaasV2
+	serviceLister corelisters.ServiceLister
+
+	// down maps the Services to the nodes of their members down, along with the pools they're down in.
+	down map[types.NamespacedName]map[string][]string
+}
+
+func newMemberStatusWatcher(lbaas *LbaasV2, serviceLister corelisters.ServiceLister) *memberStatusWatcher {
+	return &memberStatusWatcher{
+		lbaas:         lbaas,
+		serviceLister: serviceLister,
+		down:          make(map[types.NamespacedName]map[string][]string),
+	}
+}
+
+// run refreshes the statuses of the members every interval until stopCh is closed.
+func (w *memberStatusWatcher) run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(w.refresh, interval, stopCh)
+}
+
+// isListenerOfPort returns true if the listener is the one of the port of a Service, on the same port number and with a
+// protocol the protocol of the port can stand for.
+func isListenerOfPort(listener *listeners.Listener, port corev1.ServicePort) bool {
+	if listener.ProtocolPort != int(port.Port) {
+		return false
+	}
+	switch port.Protocol {
+	case corev1.ProtocolUDP, corev1.ProtocolSCTP:
+		return listener.Protocol == string(port.Protocol)
+	default:
+		return listener.Protocol != string(corev1.ProtocolUDP) && listener.Protocol != string(corev1.ProtocolSCTP)
+	}
+}
+
+// getServiceListenerIDs returns the IDs of the listeners of the Service among the listeners of its load balancer, the
+// ones of its ports. The Services sharing a load balancer can't have listeners on the same ports.
+func getServiceListenerIDs(lbListeners []listeners.Listener, service *corev1.Service) sets.Set[string] {
+	ids := sets.New[string]()
+	for i := range lbListeners {
+		for _, port := range service.Spec.Ports {
+			if isListenerOfPort(&lbListeners[i], port) {
+				ids.Insert(lbListeners[i].ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// getMembersDown returns the nodes of the members in ERROR in the status tree, of the pools of the listeners of the
+// Service, along with the pools they're down in. The members are named after their node.
+func getMembersDown(tree *loadbalancers.LoadBalancer, listenerIDs sets.Set[string]) map[string][]string {
+	down := make(map[string][]string)
+	seen := sets.New[string]()
+	for _, listener := range tree.Listeners {
+		if !listenerIDs.Has(listener.ID) {
+			continue
+		}
+		for _, pool := range listener.Pools {
+			// A pool shared by several listeners is listed under each of them.
+			if seen.Has(pool.ID) {
+				continue
+			}
+			seen.Insert(pool.ID)
+			for _, member := range pool.Members {
+				if member.OperatingStatus == operatingStatusError {
+					down[member.Name] = append(down[member.Name], pool.Name)
+				}
+			}
+		}
+	}
+	return down
+}
+
+// lbStatus is the status tree of a load balancer along with its listeners, got once per refresh.
+type lbStatus struct {
+	tree      *loadbalancers.LoadBalancer
+	listeners []listeners.Listener
+}
+
+// refresh gets the statuses of the members of the load balancers of all the Services and reports the changes.
+func (w *memberStatusWatcher) refresh() {
+	services, err := w.serviceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list Services to refresh the statuses of their members: %v", err)
+		return
+	}
+
+	statuses := make(map[string]*lbStatus)
+	seen := sets.New[types.NamespacedName]()
+	for _, service := range services {
+		lbID := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerID, "")
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer || lbID == "" {
+			continue
+		}
+		key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+
+		status, ok := statuses[lbID]
+		if !ok {
+			lbaas, err := w.lbaas.lookupRegion(service, "")
+			if err != nil {
+				continue
+			}
+			// The members are reported again once the status of the load balancer can be told.
+			tree, err := openstackutil.GetLoadBalancerStatusTree(lbaas.lb, lbID)
+			if err != nil {
+				klog.Warningf("Failed to get the statuses of the members of load balancer %s of Service %s: %v", lbID, key, err)
+				continue
+			}
+			lbListeners, err := openstackutil.GetListenersByLoadBalancerID(lbaas.lb, lbID)
+			if err != nil {
+				klog.Warningf("Failed to get the listeners of load balancer %s of Service %s: %v", lbID, key, err)
+				continue
+			}
+			status = &lbStatus{tree: tree, listeners: lbListeners}
+			statuses[lbID] = status
+		}
+		seen.Insert(key)
+		w.report(service, lbID, getMembersDown(status.tree, getServiceListenerIDs(status.listeners, service)))
+	}
+
+	for key := range w.down {
+		if !seen.Has(key) {
+			delete(w.down, key)
+		}
+	}
+}
+
+// report emits the events of the members of the Service going down or coming back since the previous refresh.
+func (w *memberStatusWatcher) report(service *corev1.Service, lbID string, down map[string][]string) {
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	previous := w.down[key]
+	w.down[key] = down
+
+	nodes := make([]string, 0, len(down))
+	for node := range down {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		if _, ok := previous[node]; ok {
+			continue
+		}
+		pools := strings.Join(down[node], ", ")
+		klog.InfoS("Member of the load balancer is down", "service", klog.KObj(service), "node", node, "lbID", lbID, "pools", pools)
+		w.lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBMemberDown,
+			"Octavia reports the member of node %s as down in pools %s of load balancer %s", node, pools, lbID)
+		// The events of the nodes refer to them by name, the way the kubelet does.
+		nodeRef := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: node, UID: types.UID(node)}}
+		w.lbaas.eventRecorder.Eventf(nodeRef, corev1.EventTypeWarning, eventLBMemberDown,
+			"Octavia reports the member of the node as down in load balancer %s of Service %s/%s", lbID, service.Namespace, service.Name)
+	}
+
+	var recovered []string
+	for node := range previous {
+		if _, ok := down[node]; !ok {
+			recovered = append(recovered, node)
+		}
+	}
+	sort.Strings(recovered)
+	for _, node := range recovered {
+		klog.InfoS("Member of the load balancer is back", "service", klog.KObj(service), "node", node, "lbID", lbID)
+		w.lbaas.eventRecorder.Eventf(service, corev1.EventTypeNormal, eventLBMemberUp,
+			"Octavia reports the member of node %s as up again in load balancer %s", node, lbID)
+	}
+}
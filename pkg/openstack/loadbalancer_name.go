@@ -0,0 +1,188 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/l7policies"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/klog/v2"
+
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+const (
+	// Octavia truncates the names at 255 characters. The names of the listeners, pools, monitors and L7 policies are
+	// the name of the load balancer with a prefix of up to 27 characters, e.g. monitor_l7_<port name>_, the load
+	// balancer name is kept short enough for them to fit.
+	lbNameMaxLength = 224
+	// Length of the hash replacing the overflow of the cluster name.
+	lbNameHashLength = 10
+)
+
+// nameHash returns a short hash of s, the same on every call.
+func nameHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:lbNameHashLength]
+}
+
+// loadBalancerName returns the name of the load balancer of the Service, kube_service_<cluster>_<namespace>_<name>.
+// Kubernetes limits the namespaces and the names of the Services to 63 characters, so that the names only exceed
+// lbNameMaxLength with long cluster names: the overflow of the cluster name is then replaced by its hash. The name
+// still ends with _<namespace>_<name>, which the pools are matched with, and the Service is also told by the
+// k8s_namespace and k8s_name tags. The hash only depends on the cluster name, so that the name is the same on every
+// reconcile.
+func loadBalancerName(clusterName, namespace, name string) string {
+	full := fmt.Sprintf("%s%s_%s_%s", servicePrefix, clusterName, namespace, name)
+	if len(full) <= lbNameMaxLength {
+		return full
+	}
+
+	suffix := fmt.Sprintf("_%s_%s", namespace, name)
+	keep := lbNameMaxLength - len(servicePrefix) - len(suffix) - lbNameHashLength - 1
+	if keep >= 0 && keep < len(clusterName) {
+		return fmt.Sprintf("%s%s-%s%s", servicePrefix, clusterName[:keep], nameHash(clusterName), suffix)
+	}
+	// Not reached with the names Kubernetes accepts, the whole name is shortened then.
+	return fmt.Sprintf("%s_%s", full[:lbNameMaxLength-lbNameHashLength-1], nameHash(full))
+}
+
+// previousLoadBalancerName returns the name the previous releases gave to the load balancer of the Service, if it's
+// not the one given now: the long names were cut at 255 characters.
+func previousLoadBalancerName(clusterName, namespace, name string) string {
+	full := fmt.Sprintf("%s%s_%s_%s", servicePrefix, clusterName, namespace, name)
+	if len(full) <= lbNameMaxLength {
+		return ""
+	}
+	return cpoutil.CutString255(full)
+}
+
+// renamedResource returns the name of the listener, pool or L7 policy named after the previous name of the load
+// balancer, named after the current one.
+func renamedResource(name, previousName, lbName string) (string, bool) {
+	if !strings.HasSuffix(name, "_"+previousName) {
+		return name, false
+	}
+	return strings.TrimSuffix(name, previousName) + lbName, true
+}
+
+// replaceTag returns the tags with previous replaced by current.
+func replaceTag(tags []string, previous, current string) ([]string, bool) {
+	if !cpoutil.Contains(tags, previous) {
+		return tags, false
+	}
+	var newTags []string
+	for _, tag := range tags {
+		if tag == previous {
+			tag = current
+		}
+		if !cpoutil.Contains(newTags, tag) {
+			newTags = append(newTags, tag)
+		}
+	}
+	return newTags, true
+}
+
+// migrateLoadBalancerName renames the load balancer of the Service named by the previous releases, along with its
+// listeners, pools and L7 policies, and replaces the previous name in their tags, so that they're still owned by the
+// Service. Only the resources of the Service are changed on a shared load balancer.
+func (lbaas *LbaasV2) migrateLoadBalancerName(loadbalancer *loadbalancers.LoadBalancer, lbName, previousName string) error {
+	// The resources can only be updated while the load balancer is ACTIVE, the callers tell when it's not.
+	if previousName == "" || previousName == lbName || loadbalancer.ProvisioningStatus != activeStatus {
+		return nil
+	}
+	isLBOwner := loadbalancer.Name == previousName
+	if !isLBOwner && !cpoutil.Contains(loadbalancer.Tags, previousName) {
+		return nil
+	}
+	klog.InfoS("Renaming load balancer resources named after the name cut by Octavia", "lbID", loadbalancer.ID, "lbName", lbName)
+
+	lbListeners, err := openstackutil.GetListenersByLoadBalancerID(lbaas.lb, loadbalancer.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get listeners of load balancer %s: %v", loadbalancer.ID, err)
+	}
+	for _, listener := range lbListeners {
+		if !isListenerOwned(listener, isLBOwner, previousName) {
+			continue
+		}
+		var opts listeners.UpdateOpts
+		if newName, renamed := renamedResource(listener.Name, previousName, lbName); renamed {
+			opts.Name = &newName
+		}
+		if newTags, retagged := replaceTag(listener.Tags, previousName, lbName); retagged {
+			opts.Tags = &newTags
+		}
+		if opts.Name != nil || opts.Tags != nil {
+			if err := openstackutil.UpdateListener(lbaas.lb, loadbalancer.ID, listener.ID, opts); err != nil {
+				return fmt.Errorf("failed to rename listener %s: %v", listener.ID, err)
+			}
+		}
+
+		policies, err := openstackutil.GetL7policies(lbaas.lb, listener.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get L7 policies of listener %s: %v", listener.ID, err)
+		}
+		for _, policy := range policies {
+			if newName, renamed := renamedResource(policy.Name, previousName, lbName); renamed {
+				if err := openstackutil.UpdateL7Policy(lbaas.lb, loadbalancer.ID, policy.ID, l7policies.UpdateOpts{Name: &newName}); err != nil {
+					return fmt.Errorf("failed to rename L7 policy %s: %v", policy.ID, err)
+				}
+			}
+		}
+	}
+
+	lbPools, err := openstackutil.GetPools(lbaas.lb, loadbalancer.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get pools of load balancer %s: %v", loadbalancer.ID, err)
+	}
+	for _, pool := range lbPools {
+		var opts v2pools.UpdateOpts
+		if newName, renamed := renamedResource(pool.Name, previousName, lbName); renamed {
+			opts.Name = &newName
+		}
+		if newTags, retagged := replaceTag(pool.Tags, previousName, lbName); retagged {
+			opts.Tags = &newTags
+		}
+		if opts.Name != nil || opts.Tags != nil {
+			if err := openstackutil.UpdatePool(lbaas.lb, loadbalancer.ID, pool.ID, opts); err != nil {
+				return fmt.Errorf("failed to rename pool %s: %v", pool.ID, err)
+			}
+		}
+	}
+
+	// The load balancer is renamed last, so that an interrupted migration is resumed on the next reconcile.
+	if newTags, retagged := replaceTag(loadbalancer.Tags, previousName, lbName); retagged {
+		if err := openstackutil.UpdateLoadBalancerTags(lbaas.lb, loadbalancer.ID, newTags); err != nil {
+			return fmt.Errorf("failed to update tags of load balancer %s: %v", loadbalancer.ID, err)
+		}
+		loadbalancer.Tags = newTags
+	}
+	if isLBOwner {
+		if err := openstackutil.UpdateLoadBalancerName(lbaas.lb, loadbalancer.ID, lbName); err != nil {
+			return fmt.Errorf("failed to rename load balancer %s: %v", loadbalancer.ID, err)
+		}
+		loadbalancer.Name = lbName
+	}
+	return nil
+}
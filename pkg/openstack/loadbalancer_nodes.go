@@ -0,0 +1,58 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Behaviors for the Services with no eligible node, set in no-nodes-behavior
+const (
+	noNodesFail        = "fail"
+	noNodesEmptyPools  = "empty-pools"
+	noNodesKeepMembers = "keep-members"
+)
+
+// checkEligibleNodes handles a Service none of whose nodes is eligible to be a member, e.g. because all of them are
+// tainted or excluded from the load balancers. The Service gets an event explaining it, identical events are
+// throttled so that it isn't flooded while the eligibility of the nodes flaps. Unless no-nodes-behavior lets the load
+// balancer be created with empty pools, the ensure fails and is retried, the updates remove the members either way
+// unless no-nodes-behavior keeps them.
+func (lbaas *LbaasV2) checkEligibleNodes(service *corev1.Service, nodes []*corev1.Node, svcConf *serviceConfig, ensure bool) error {
+	if len(nodes) > 0 {
+		return nil
+	}
+
+	var msg string
+	switch lbaas.opts.NoNodesBehavior {
+	case noNodesKeepMembers:
+		svcConf.keepMembersWithoutNodes = true
+		msg = "No eligible node found for the load balancer members, the current members are kept until a node is eligible"
+	case noNodesEmptyPools:
+		msg = "No eligible node found for the load balancer members, the pools are left empty until a node is eligible"
+	default:
+		msg = "No eligible node found for the load balancer members, e.g. because all of them are tainted or excluded from load balancers"
+	}
+	lbaas.eventRecorder.Event(service, corev1.EventTypeWarning, eventLBNoEligibleNodes, msg)
+
+	if ensure && (lbaas.opts.NoNodesBehavior == "" || lbaas.opts.NoNodesBehavior == noNodesFail) {
+		return fmt.Errorf("there are no available nodes for LoadBalancer service %s/%s", service.Namespace, service.Name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// serviceConditionLBOnline is the condition of the Services reporting the operating status of their load balancer.
+const serviceConditionLBOnline = "loadbalancer.openstack.org/Online"
+
+// Operating statuses of the Octavia load balancers
+const (
+	operatingStatusOnline    = "ONLINE"
+	operatingStatusNoMonitor = "NO_MONITOR"
+	operatingStatusDegraded  = "DEGRADED"
+	operatingStatusError     = "ERROR"
+)
+
+// getOperatingStatusCondition returns the condition of the Service for the operating status of its load balancer. It's
+// true while the load balancer is ONLINE, or NO_MONITOR as the health of its members isn't monitored then. The reason
+// is the operating status.
+func getOperatingStatusCondition(lbID, operatingStatus string, generation int64) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               serviceConditionLBOnline,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             operatingStatus,
+		Message:            fmt.Sprintf("The operating status of load balancer %s is %s", lbID, operatingStatus),
+	}
+	if operatingStatus == operatingStatusOnline || operatingStatus == operatingStatusNoMonitor {
+		condition.Status = metav1.ConditionTrue
+	}
+	if operatingStatus == "" {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "Unknown"
+	}
+	return condition
+}
+
+// updateOperatingStatus refreshes the operating status of the load balancer in the conditions of the Service, and
+// emits a warning event when it's DEGRADED or in ERROR, e.g. when some of its members are down. It's done on every
+// reconcile with the load balancer got by the reconcile, and the Service is only patched when the condition changes.
+// A failure only gets logged.
+func (lbaas *LbaasV2) updateOperatingStatus(ctx context.Context, service *corev1.Service, loadbalancer *loadbalancers.LoadBalancer) {
+	if lbaas.kclient == nil {
+		return
+	}
+
+	if loadbalancer.OperatingStatus == operatingStatusDegraded || loadbalancer.OperatingStatus == operatingStatusError {
+		lbaas.eventRecorder.Eventf(service, corev1.EventTypeWarning, eventLBOperatingStatus,
+			"Load balancer %s is %s, some of its listeners, pools or members are down", loadbalancer.ID, loadbalancer.OperatingStatus)
+	}
+
+	condition := getOperatingStatusCondition(loadbalancer.ID, loadbalancer.OperatingStatus, service.Generation)
+	if current := meta.FindStatusCondition(service.Status.Conditions, condition.Type); current != nil &&
+		current.Status == condition.Status && current.Reason == condition.Reason && current.Message == condition.Message &&
+		current.ObservedGeneration == condition.ObservedGeneration {
+		return
+	}
+	updated := service.DeepCopy()
+	meta.SetStatusCondition(&updated.Status.Conditions, condition)
+	if err := patchServiceStatus(ctx, lbaas.kclient, service, updated); err != nil {
+		klog.Warningf("Failed to update the operating status condition of Service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+}
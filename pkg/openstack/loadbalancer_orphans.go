@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// isListenerOwned tells if the listener was created by the Service, before or after the load balancers were shared.
+func isListenerOwned(listener listeners.Listener, isLBOwner bool, lbName string) bool {
+	return (isLBOwner && len(listener.Tags) == 0) || cpoutil.Contains(listener.Tags, lbName)
+}
+
+// getMissingListeners returns the ports of the Service without a listener, e.g. when a reconcile was interrupted
+// before creating all of them.
+func getMissingListeners(service *corev1.Service, svcConf *serviceConfig, curListeners []listeners.Listener) []listenerKey {
+	mapping := getListenerMapping(curListeners)
+	var missing []listenerKey
+	for _, port := range service.Spec.Ports {
+		key := listenerKey{Protocol: getListenerProtocol(port.Protocol, svcConf), Port: int(port.Port)}
+		if _, ok := mapping[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// getOrphanListeners returns the listeners of the Service matching none of its ports, e.g. the listeners of the ports
+// removed from the Service or left behind by an interrupted reconcile. The listeners of others are never included.
+func getOrphanListeners(service *corev1.Service, svcConf *serviceConfig, curListeners []listeners.Listener, isLBOwner bool, lbName string) []listeners.Listener {
+	var orphans []listeners.Listener
+	for _, listener := range getObsoleteListeners(service, svcConf, curListeners) {
+		if isListenerOwned(listener, isLBOwner, lbName) {
+			orphans = append(orphans, listener)
+		}
+	}
+	return orphans
+}
+
+// getOrphanPools returns the default pools of the Service used by no listener, left behind when a reconcile was
+// interrupted between the creation of a pool and of its listener, or between the deletion of a listener and of its
+// pool. The L7 pools are used by L7 policies rather than listeners, ensureOctaviaL7Routes deletes the unused ones.
+func getOrphanPools(lbPools []v2pools.Pool, lbName string) []v2pools.Pool {
+	var orphans []v2pools.Pool
+	for _, pool := range lbPools {
+		if len(pool.Listeners) > 0 || isL7Pool(pool, lbName) {
+			continue
+		}
+		if !strings.HasPrefix(pool.Name, "pool_") || !strings.HasSuffix(pool.Name, "_"+lbName) {
+			continue
+		}
+		if len(pool.Tags) > 0 && !cpoutil.Contains(pool.Tags, lbName) {
+			continue
+		}
+		orphans = append(orphans, pool)
+	}
+	return orphans
+}
+
+// deleteOrphanPools deletes the default pools of the Service used by no listener and returns how many were deleted.
+func (lbaas *LbaasV2) deleteOrphanPools(lbID, lbName string) (int, error) {
+	lbPools, err := openstackutil.GetPools(lbaas.lb, lbID)
+	if err != nil {
+		return 0, err
+	}
+	orphans := getOrphanPools(lbPools, lbName)
+	for _, pool := range orphans {
+		klog.InfoS("Deleting pool used by no listener", "poolID", pool.ID, "lbID", lbID)
+		// Delete pool automatically deletes all its members.
+		if err := openstackutil.DeletePool(lbaas.lb, pool.ID, lbID); err != nil {
+			return 0, err
+		}
+	}
+	return len(orphans), nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// errUnknownProfile is returned when the profile selected by a Service isn't configured.
+var errUnknownProfile = errors.New("unknown load balancer profile")
+
+// validate checks the namespace selector and the annotations of the profile.
+func (p *LBProfile) validate() error {
+	if p.Explicit && p.NamespaceSelector != "" {
+		return fmt.Errorf("namespace-selector can't be set on an explicit profile")
+	}
+	if _, err := labels.Parse(p.NamespaceSelector); err != nil {
+		return fmt.Errorf("invalid namespace-selector %q: %v", p.NamespaceSelector, err)
+	}
+	if _, err := parseProfileAnnotations(p.Annotation); err != nil {
+		return fmt.Errorf("invalid annotation: %v", err)
+	}
+	return nil
+}
+
+// parseProfileAnnotations parses the "<key>=<value>" annotations of a profile.
+func parseProfileAnnotations(values []string) (map[string]string, error) {
+	annotations := make(map[string]string, len(values))
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q isn't in the <key>=<value> format", value)
+		}
+		key = strings.TrimSpace(key)
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid annotation key %q: %s", key, strings.Join(errs, ", "))
+		}
+		annotations[key] = strings.TrimSpace(v)
+	}
+	return annotations, nil
+}
+
+// getProfileAnnotations returns the default annotations of the profiles matching the labels of a namespace. The
+// profiles are merged in the order of their names, a profile overriding the annotations of the previous ones. The
+// explicit profiles are skipped.
+func getProfileAnnotations(profiles map[string]*LBProfile, namespaceLabels map[string]string) map[string]string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	annotations := make(map[string]string)
+	for _, name := range names {
+		profile := profiles[name]
+		if profile.Explicit {
+			continue
+		}
+		// The profiles are validated when reading the config.
+		selector, err := labels.Parse(profile.NamespaceSelector)
+		if err != nil || !selector.Matches(labels.Set(namespaceLabels)) {
+			continue
+		}
+		profileAnnotations, _ := parseProfileAnnotations(profile.Annotation)
+		for key, value := range profileAnnotations {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// getSelectedProfileAnnotations returns the annotations of the profile selected by name with the
+// loadbalancer.openstack.org/profile annotation, whether it's explicit or not.
+func getSelectedProfileAnnotations(profiles map[string]*LBProfile, name string) (map[string]string, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, asTerminalError(fmt.Errorf("%w %q selected by annotation %s, it isn't a [LoadBalancerProfile] of the config", errUnknownProfile, name, ServiceAnnotationLoadBalancerProfile))
+	}
+	// The profiles are validated when reading the config.
+	annotations, _ := parseProfileAnnotations(profile.Annotation)
+	return annotations, nil
+}
+
+// hasNamespaceProfiles tells if any of the profiles applies to the Services by their namespace.
+func hasNamespaceProfiles(profiles map[string]*LBProfile) bool {
+	for _, profile := range profiles {
+		if !profile.Explicit {
+			return true
+		}
+	}
+	return false
+}
+
+// withDefaultAnnotations returns a copy of the Service with the default annotations it doesn't set, or the Service
+// itself if it sets all of them. The copy is never written back, so the Services don't get the defaults persisted.
+func withDefaultAnnotations(service *corev1.Service, defaults map[string]string) *corev1.Service {
+	var merged *corev1.Service
+	for key, value := range defaults {
+		if _, ok := service.Annotations[key]; ok {
+			continue
+		}
+		if merged == nil {
+			merged = service.DeepCopy()
+			if merged.Annotations == nil {
+				merged.Annotations = make(map[string]string, len(defaults))
+			}
+		}
+		merged.Annotations[key] = value
+	}
+	if merged == nil {
+		return service
+	}
+	return merged
+}
+
+// applyServiceDefaults returns the Service with the default annotations of the [LoadBalancerProfile] sections matching
+// its namespace, overridden by the ones of the profile it selects with the loadbalancer.openstack.org/profile
+// annotation, then by the ones of the LBBlueprint it selects with the loadbalancer.openstack.org/blueprint annotation.
+// The profile and the blueprint can be selected by the profiles too. It's a no-op when there is neither.
+func (lbaas *LbaasV2) applyServiceDefaults(service *corev1.Service) (*corev1.Service, error) {
+	selected := service.Annotations[ServiceAnnotationLoadBalancerProfile]
+	blueprint := service.Annotations[ServiceAnnotationLoadBalancerBlueprint]
+	if len(lbaas.opts.LBProfiles) == 0 && selected == "" && blueprint == "" {
+		return service, nil
+	}
+
+	defaults := make(map[string]string)
+	if hasNamespaceProfiles(lbaas.opts.LBProfiles) {
+		if lbaas.namespaces == nil {
+			return nil, fmt.Errorf("the namespaces needed by [LoadBalancerProfile] aren't watched")
+		}
+		namespace, err := lbaas.namespaces.Get(service.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace %s for the default annotations of Service %s/%s: %w", service.Namespace, service.Namespace, service.Name, err)
+		}
+		defaults = getProfileAnnotations(lbaas.opts.LBProfiles, namespace.Labels)
+	}
+
+	if selected == "" {
+		selected = defaults[ServiceAnnotationLoadBalancerProfile]
+	}
+	if selected != "" {
+		annotations, err := getSelectedProfileAnnotations(lbaas.opts.LBProfiles, selected)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range annotations {
+			defaults[key] = value
+		}
+	}
+
+	if blueprint == "" {
+		blueprint = defaults[ServiceAnnotationLoadBalancerBlueprint]
+	}
+	if blueprint != "" {
+		annotations, err := lbaas.getSelectedBlueprintAnnotations(blueprint)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range annotations {
+			defaults[key] = value
+		}
+	}
+	return withDefaultAnnotations(service, defaults), nil
+}
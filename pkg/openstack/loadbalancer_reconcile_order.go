@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	corev1 "k8s.io/api/core/v1"
+
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// Order of the replacement of the listeners and pools of the Services, set in reconcile-order. With create-first the
+// new listeners and pools are ready before the old ones are deleted, so that the ports of the Service keep a backend
+// meanwhile. It falls back to delete-first when the quota doesn't allow both at once.
+const (
+	reconcileOrderCreateFirst = "create-first"
+	reconcileOrderDeleteFirst = "delete-first"
+)
+
+// getObsoleteListeners returns the listeners of the load balancer matching none of the ports of the Service. They
+// include the listeners of the other Services sharing the load balancer, deleteOctaviaListeners leaves them alone.
+func getObsoleteListeners(service *corev1.Service, svcConf *serviceConfig, curListeners []listeners.Listener) []listeners.Listener {
+	wanted := make(map[listenerKey]bool, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		wanted[listenerKey{Protocol: getListenerProtocol(port.Protocol, svcConf), Port: int(port.Port)}] = true
+	}
+	var obsolete []listeners.Listener
+	for _, listener := range curListeners {
+		if !wanted[listenerKey{Protocol: listeners.Protocol(listener.Protocol), Port: listener.ProtocolPort}] {
+			obsolete = append(obsolete, listener)
+		}
+	}
+	return obsolete
+}
+
+// getDetachedPool returns the pool with the name and protocol used by no listener, left behind when the replacement of
+// a default pool was interrupted before the listener got switched to it, nil if there is none.
+func (lbaas *LbaasV2) getDetachedPool(lbID, name string, protocol v2pools.Protocol) (*v2pools.Pool, error) {
+	lbPools, err := openstackutil.GetPools(lbaas.lb, lbID)
+	if err != nil {
+		return nil, err
+	}
+	for i, pool := range lbPools {
+		if pool.Name == name && len(pool.Listeners) == 0 && v2pools.Protocol(pool.Protocol) == protocol {
+			return &lbPools[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// getLoadBalancerRegion returns the region of the load balancer of the Service. It's the region of the Service
+// annotation if set, otherwise the region of the nodes, otherwise the default region. The nodes which aren't
+// initialized yet don't have a region and are skipped. An error is returned if the nodes are in several regions, as
+// the load balancer would only reach the nodes of one of them: the region must then be set with the annotation.
+func getLoadBalancerRegion(service *corev1.Service, nodes []*corev1.Node, defaultRegion string) (string, error) {
+	if region := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerRegion, ""); region != "" {
+		return region, nil
+	}
+
+	nodesRegion := ""
+	for _, node := range nodes {
+		region := node.Labels[corev1.LabelTopologyRegion]
+		if region == "" {
+			continue
+		}
+		if nodesRegion != "" && region != nodesRegion {
+			return "", fmt.Errorf("the nodes of Service %s/%s are in several regions, %q and %q, the %s annotation must be set to the region of its load balancer",
+				service.Namespace, service.Name, nodesRegion, region, ServiceAnnotationLoadBalancerRegion)
+		}
+		nodesRegion = region
+	}
+	if nodesRegion != "" {
+		return nodesRegion, nil
+	}
+	return defaultRegion, nil
+}
+
+// filterNodesByRegion returns the nodes of the region, along with the ones without a region.
+func filterNodesByRegion(nodes []*corev1.Node, region string) []*corev1.Node {
+	var regionNodes []*corev1.Node
+	for _, node := range nodes {
+		if nodeRegion := node.Labels[corev1.LabelTopologyRegion]; nodeRegion == "" || nodeRegion == region {
+			regionNodes = append(regionNodes, node)
+		}
+	}
+	return regionNodes
+}
+
+// inRegion returns the LbaasV2 of the region of the load balancer of the Service, along with the nodes of that region.
+// The nodes in the other regions can't be reached by the load balancer, so they don't become members. It's a no-op
+// unless several regions are configured.
+func (lbaas *LbaasV2) inRegion(service *corev1.Service, nodes []*corev1.Node) (*LbaasV2, []*corev1.Node, error) {
+	if len(lbaas.regional) == 0 {
+		return lbaas, nodes, nil
+	}
+
+	// The existing load balancers are kept in their region, even without the region annotation.
+	if service.Annotations[ServiceAnnotationLoadBalancerRegion] == "" && service.Annotations[ServiceAnnotationLoadBalancerID] != "" {
+		regional, err := lbaas.lookupRegion(service, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return regional, filterNodesByRegion(nodes, regional.region), nil
+	}
+
+	region, err := getLoadBalancerRegion(service, nodes, lbaas.region)
+	if err != nil {
+		return nil, nil, asTerminalError(err)
+	}
+	regional, err := lbaas.getRegional(service, region)
+	if err != nil {
+		return nil, nil, err
+	}
+	return regional, filterNodesByRegion(nodes, region), nil
+}
+
+// getRegional returns the LbaasV2 of the region.
+func (lbaas *LbaasV2) getRegional(service *corev1.Service, region string) (*LbaasV2, error) {
+	regional, ok := lbaas.regional[region]
+	if !ok {
+		return nil, asTerminalError(fmt.Errorf("region %q of the load balancer of Service %s/%s isn't one of the configured regions", region, service.Namespace, service.Name))
+	}
+	return regional, nil
+}
+
+// lookupRegion returns the LbaasV2 of the region of the existing load balancer of the Service, for the calls which
+// don't get the nodes. Without the region annotation, e.g. when it was removed, the load balancer is looked for by the
+// ID annotation or by its names in all the regions, starting with the default one. The default region is returned
+// when the load balancer is found nowhere. It's a no-op unless several regions are configured.
+func (lbaas *LbaasV2) lookupRegion(service *corev1.Service, name string, fallbackNames ...string) (*LbaasV2, error) {
+	if len(lbaas.regional) == 0 {
+		return lbaas, nil
+	}
+	if region := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerRegion, ""); region != "" {
+		return lbaas.getRegional(service, region)
+	}
+
+	lbID := getStringFromServiceAnnotation(service, ServiceAnnotationLoadBalancerID, "")
+	if lbID == "" && name == "" {
+		return lbaas, nil
+	}
+	regions := make([]string, 0, len(lbaas.regional))
+	for region := range lbaas.regional {
+		if region != lbaas.region {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	for _, region := range append([]string{lbaas.region}, regions...) {
+		regional := lbaas.regional[region]
+		var err error
+		if lbID != "" {
+			_, err = openstackutil.GetLoadbalancerByID(regional.lb, lbID)
+		} else {
+			_, err = getLoadbalancerByName(regional.lb, name, fallbackNames...)
+		}
+		if err == nil {
+			return regional, nil
+		}
+		if !cpoerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to look for the load balancer of Service %s/%s in region %q: %v", service.Namespace, service.Name, region, err)
+		}
+	}
+	return lbaas, nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// countServiceResources counts the listeners of a Service in the status tree of its load balancer, with their pools and
+// the members of the pools. The other listeners of a shared load balancer belong to the other Services, and a pool
+// shared by several listeners is counted once.
+func countServiceResources(tree *loadbalancers.LoadBalancer, listenerIDs []string) (listeners, pools, members int) {
+	ids := sets.New(listenerIDs...)
+	seenPools := sets.New[string]()
+	for _, listener := range tree.Listeners {
+		if !ids.Has(listener.ID) {
+			continue
+		}
+		listeners++
+		for _, pool := range listener.Pools {
+			if seenPools.Has(pool.ID) {
+				continue
+			}
+			seenPools.Insert(pool.ID)
+			pools++
+			members += len(pool.Members)
+		}
+	}
+	return listeners, pools, members
+}
+
+// updateStatuses reports the statuses of the load balancer of the Service once reconciled. With
+// enable-resource-metrics, the status tree of the load balancer is got once to record the number of Octavia listeners,
+// pools and members of the Service, e.g. for chargeback, and the operating status it has, fresher than the one of the
+// load balancer got by the reconcile, is reported. A failure to get the tree only gets logged and the previous numbers
+// are kept.
+func (lbaas *LbaasV2) updateStatuses(ctx context.Context, service *corev1.Service, loadbalancer *loadbalancers.LoadBalancer, listenerIDs []string) {
+	if lbaas.opts.EnableResourceMetrics {
+		tree, err := openstackutil.GetLoadBalancerStatusTree(lbaas.lb, loadbalancer.ID)
+		if err != nil {
+			klog.Warningf("Failed to get the status tree of load balancer %s of Service %s/%s: %v", loadbalancer.ID, service.Namespace, service.Name, err)
+		} else {
+			listeners, pools, members := countServiceResources(tree, listenerIDs)
+			metrics.SetLoadBalancerResources(service.Namespace, service.Name, listeners, pools, members)
+			if tree.OperatingStatus != "" {
+				updated := *loadbalancer
+				updated.OperatingStatus = tree.OperatingStatus
+				loadbalancer = &updated
+			}
+		}
+	}
+	lbaas.updateOperatingStatus(ctx, service, loadbalancer)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	neutrontags "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// getSecurityGroupOwnerTags returns the tags of the security groups of the Service telling which Service of which
+// cluster they belong to, whatever its UID. They find the security groups left behind by the previous Services of the
+// same name.
+func getSecurityGroupOwnerTags(clusterName string, service *corev1.Service) []string {
+	return []string{
+		cpoutil.CutString255(resourceTagCluster + clusterName),
+		cpoutil.CutString255(resourceTagNamespace + service.Namespace),
+		cpoutil.CutString255(resourceTagName + service.Name),
+	}
+}
+
+// syncSecurityGroupTags returns the current tags of the security group of a Service with the wanted ones that are
+// missing appended and the tags of the controller that aren't wanted anymore removed, and whether they changed. The
+// tags set by others are kept.
+func syncSecurityGroupTags(current, wanted []string) ([]string, bool) {
+	var kept []string
+	for _, tag := range current {
+		if isControllerTag(tag) && !cpoutil.Contains(wanted, tag) {
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	tags, missing := addMissingTags(kept, wanted)
+	return tags, missing || len(kept) != len(current)
+}
+
+// ensureSecurityGroupTags tags the security group of the Service with the tags of its resources, see getResourceTags.
+func (lbaas *LbaasV2) ensureSecurityGroupTags(sg *groups.SecGroup, wanted []string) error {
+	if len(wanted) == 0 {
+		return nil
+	}
+	tags, changed := syncSecurityGroupTags(sg.Tags, wanted)
+	if !changed {
+		return nil
+	}
+
+	klog.InfoS("Updating security group tags", "sgID", sg.ID, "tags", tags)
+	mc := metrics.NewMetricContext("security_group_tag", "update")
+	_, err := neutrontags.ReplaceAll(lbaas.network, "security-groups", sg.ID, neutrontags.ReplaceAllOpts{Tags: tags}).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to update tags of security group %s: %v", sg.ID, err)
+	}
+	return nil
+}
+
+// deleteStaleSecurityGroups deletes the security groups tagged for the Service but keepID, e.g. the ones of the
+// previous Services of the same name whose deletion failed. Only a single Service of a name can exist at once, so
+// they're no longer used. The security groups created before they were tagged are only found by the name of the
+// current Service.
+func (lbaas *LbaasV2) deleteStaleSecurityGroups(clusterName string, service *corev1.Service, keepID string) error {
+	sgs, err := lbaas.listSecurityGroups(groups.ListOpts{Tags: strings.Join(getSecurityGroupOwnerTags(clusterName, service), ",")})
+	if err != nil {
+		return fmt.Errorf("failed to list security groups of Service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	for _, sg := range sgs {
+		// Only the security groups named like the ones of the Services are deleted, whatever the tags set by others.
+		if sg.ID == keepID || !strings.HasPrefix(sg.Name, "lb-sg-") {
+			continue
+		}
+		klog.InfoS("Deleting stale security group", "sgID", sg.ID, "name", sg.Name, "service", klog.KObj(service))
+		if err := lbaas.deleteSecurityGroup(sg.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSecurityGroup deletes the security group of a Service, once disassociated from the ports of the nodes.
+func (lbaas *LbaasV2) deleteSecurityGroup(sgID string) error {
+	if err := disassociateSecurityGroupForLB(lbaas.network, sgID, nil); err != nil {
+		return fmt.Errorf("failed to disassociate security group %s: %v", sgID, err)
+	}
+
+	mc := metrics.NewMetricContext("security_group", "delete")
+	err := groups.Delete(lbaas.network, sgID).ExtractErr()
+	if err != nil && !cpoerrors.IsNotFound(err) {
+		return mc.ObserveRequest(err)
+	}
+	_ = mc.ObserveRequest(nil)
+	return nil
+}
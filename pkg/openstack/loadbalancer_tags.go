@@ -0,0 +1,178 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+)
+
+// Tags describing the Service, set along with the name of its load balancer on the load balancer, listeners and pools
+// of the Service. The name of the load balancer stays the tag the ownership of the resources is decided on, e.g. to
+// count the Services sharing a load balancer, so these tags mustn't start with servicePrefix.
+const (
+	resourceTagPrefix     = "k8s_"
+	resourceTagCluster    = resourceTagPrefix + "cluster="
+	resourceTagNamespace  = resourceTagPrefix + "namespace="
+	resourceTagName       = resourceTagPrefix + "name="
+	resourceTagServiceUID = resourceTagPrefix + "service_uid="
+	resourceTagPortName   = resourceTagPrefix + "port_name="
+	// resourceTagCustom marks each tag of loadbalancer.openstack.org/tags, so that the tags dropped from the annotation
+	// can be told apart from the ones set by others.
+	resourceTagCustom = resourceTagPrefix + "tag="
+	// resourceTagAntiAffinityGroup marks the load balancers of the Services of an anti-affinity group, counted to pick
+	// the availability zone of the next load balancer of the group.
+	resourceTagAntiAffinityGroup = resourceTagPrefix + "anti_affinity_group="
+)
+
+// getResourceTags returns the tags of the resources of the Service: the name of its load balancer, the cluster, the
+// namespace, the name and the UID of the Service.
+func getResourceTags(lbName, clusterName string, service *corev1.Service) []string {
+	return []string{
+		lbName,
+		cpoutil.CutString255(resourceTagCluster + clusterName),
+		cpoutil.CutString255(resourceTagNamespace + service.Namespace),
+		cpoutil.CutString255(resourceTagName + service.Name),
+		resourceTagServiceUID + string(service.UID),
+	}
+}
+
+// addMissingTags returns the current tags with the wanted ones that are missing appended, and whether any was
+// missing. The other tags are kept, a load balancer is tagged by all the Services sharing it.
+func addMissingTags(current, wanted []string) ([]string, bool) {
+	tags := append([]string{}, current...)
+	for _, tag := range wanted {
+		if !cpoutil.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, len(tags) != len(current)
+}
+
+// getListenerTags returns the tags of the listener of a Service port: the tags of the resources of the Service and the
+// name of the port if it has one, so that the listeners of a Service with several ports can be told apart.
+func getListenerTags(tags []string, port corev1.ServicePort) []string {
+	listenerTags := append([]string{}, tags...)
+	if port.Name != "" {
+		listenerTags = append(listenerTags, cpoutil.CutString255(resourceTagPortName+port.Name))
+	}
+	return listenerTags
+}
+
+// syncListenerTags returns the current tags of a listener with the wanted ones that are missing appended and the port
+// name tags that aren't wanted anymore removed, e.g. when the port was renamed, and whether they changed.
+func syncListenerTags(current, wanted []string) ([]string, bool) {
+	var kept []string
+	for _, tag := range current {
+		if strings.HasPrefix(tag, resourceTagPortName) && !cpoutil.Contains(wanted, tag) {
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	tags, missing := addMissingTags(kept, wanted)
+	return tags, missing || len(kept) != len(current)
+}
+
+// getCustomTags returns the tags of loadbalancer.openstack.org/tags. They can't look like the tags of the controller,
+// which would be dropped along with them.
+func getCustomTags(service *corev1.Service) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(service.Annotations[ServiceAnnotationLoadBalancerTags], ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || cpoutil.Contains(tags, tag) {
+			continue
+		}
+		if isControllerTag(tag) {
+			return nil, fmt.Errorf("invalid tag %q in annotation %s: tags starting with %s or %s are reserved", tag, ServiceAnnotationLoadBalancerTags, resourceTagPrefix, servicePrefix)
+		}
+		if len(resourceTagCustom+tag) > 255 {
+			return nil, fmt.Errorf("invalid tag %q in annotation %s: tags can't be longer than %d characters", tag, ServiceAnnotationLoadBalancerTags, 255-len(resourceTagCustom))
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// isControllerTag tells if the tag is set by the controller, e.g. the name of a load balancer or the cluster name tag.
+func isControllerTag(tag string) bool {
+	return strings.HasPrefix(tag, resourceTagPrefix) || strings.HasPrefix(tag, servicePrefix)
+}
+
+// syncCustomTags returns the current tags of a load balancer with the custom tags that are missing appended along with
+// their marker, and the custom tags that aren't wanted anymore removed, and whether they changed. Only the tags with a
+// marker are removed, the tags of the controller and the ones set by others are kept.
+func syncCustomTags(current, custom []string) ([]string, bool) {
+	var kept []string
+	for _, tag := range current {
+		if value, ok := strings.CutPrefix(tag, resourceTagCustom); ok && !cpoutil.Contains(custom, value) {
+			continue
+		}
+		if !cpoutil.Contains(custom, tag) && cpoutil.Contains(current, resourceTagCustom+tag) && !isControllerTag(tag) {
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	var wanted []string
+	for _, tag := range custom {
+		wanted = append(wanted, tag, resourceTagCustom+tag)
+	}
+	tags, missing := addMissingTags(kept, wanted)
+	return tags, missing || len(kept) != len(current)
+}
+
+// removeServiceTags returns the tags of a load balancer without the ones of the Service, kept when the Service is
+// deleted but other Services still share the load balancer. The tags describing the Service are only set by the
+// Service owning the load balancer, they are removed along with its UID tag and its custom tags.
+func removeServiceTags(tags []string, lbName string, service *corev1.Service) []string {
+	owner := cpoutil.Contains(tags, resourceTagServiceUID+string(service.UID))
+	var newTags []string
+	for _, tag := range tags {
+		if tag == lbName {
+			continue
+		}
+		if owner && (strings.HasPrefix(tag, resourceTagNamespace) || strings.HasPrefix(tag, resourceTagName) || strings.HasPrefix(tag, resourceTagServiceUID)) {
+			continue
+		}
+		if owner && (strings.HasPrefix(tag, resourceTagCustom) || (cpoutil.Contains(tags, resourceTagCustom+tag) && !isControllerTag(tag))) {
+			continue
+		}
+		newTags = append(newTags, tag)
+	}
+	return newTags
+}
+
+// syncAntiAffinityGroupTag returns the current tags of a load balancer with the tag of the anti-affinity group, if any,
+// replacing the one of another group, and whether they changed.
+func syncAntiAffinityGroupTag(current []string, group string) ([]string, bool) {
+	var wanted []string
+	if group != "" {
+		wanted = []string{resourceTagAntiAffinityGroup + group}
+	}
+	var kept []string
+	for _, tag := range current {
+		if strings.HasPrefix(tag, resourceTagAntiAffinityGroup) && !cpoutil.Contains(wanted, tag) {
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	tags, missing := addMissingTags(kept, wanted)
+	return tags, missing || len(kept) != len(current)
+}
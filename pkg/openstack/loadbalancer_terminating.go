@@ -0,0 +1,40 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// Behaviors for the reconciles of Services being deleted, set in terminating-service-behavior
+const (
+	terminatingServiceSkip   = "skip"
+	terminatingServiceEnsure = "ensure"
+)
+
+// skipsTerminatingService tells if the reconcile of the Service is skipped because the Service is being deleted. An
+// ensure or an update may still be queued for it, e.g. by the service controller with a stale Service or by the
+// watchers of the endpoints and nodes. Provisioning anything at that point would resurrect resources
+// EnsureLoadBalancerDeleted() removes, so it's left to the delete path unless terminating-service-behavior is ensure.
+func (lbaas *LbaasV2) skipsTerminatingService(service *corev1.Service) bool {
+	if service.DeletionTimestamp == nil || lbaas.opts.TerminatingServiceBehavior == terminatingServiceEnsure {
+		return false
+	}
+	klog.InfoS("Service is being deleted, skipping the reconcile of its load balancer", "service", klog.KObj(service))
+	return true
+}
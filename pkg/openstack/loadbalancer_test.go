@@ -1,13 +1,48 @@
 package openstack
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/api"
 
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/l7policies"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	th "github.com/gophercloud/gophercloud/testhelper"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+	"k8s.io/utils/pointer"
 )
 
 type testPopListener struct {
@@ -460,3 +495,5856 @@ func TestGetRulesToCreateAndDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestGetWantedSecurityGroupRules(t *testing.T) {
+	rule := func(protocol rules.RuleProtocol, cidr string, port int) rules.CreateOpts {
+		return rules.CreateOpts{
+			Direction:      rules.DirIngress,
+			Protocol:       protocol,
+			EtherType:      rules.EtherType4,
+			RemoteIPPrefix: cidr,
+			SecGroupID:     "sg-id",
+			PortRangeMin:   port,
+			PortRangeMax:   port,
+		}
+	}
+	tests := []struct {
+		name          string
+		spec          corev1.ServiceSpec
+		svcConf       *serviceConfig
+		cidrs         []string
+		expectedRules []rules.CreateOpts
+	}{
+		{
+			name: "node ports of the Cluster traffic policy",
+			spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080},
+				{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53, NodePort: 30053},
+			}},
+			svcConf: &serviceConfig{},
+			cidrs:   []string{"10.0.0.0/24"},
+			expectedRules: []rules.CreateOpts{
+				rule(rules.ProtocolTCP, "10.0.0.0/24", 30080),
+				rule(rules.ProtocolUDP, "10.0.0.0/24", 30053),
+			},
+		},
+		{
+			name: "healthCheckNodePort of the Local traffic policy",
+			spec: corev1.ServiceSpec{
+				Ports:               []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+				HealthCheckNodePort: 32000,
+			},
+			svcConf: &serviceConfig{},
+			cidrs:   []string{"10.0.0.0/24"},
+			expectedRules: []rules.CreateOpts{
+				rule(rules.ProtocolTCP, "10.0.0.0/24", 32000),
+				rule(rules.ProtocolTCP, "10.0.0.0/24", 30080),
+			},
+		},
+		{
+			name: "source ranges of the ovn provider",
+			spec: corev1.ServiceSpec{
+				Ports:               []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+				HealthCheckNodePort: 32000,
+			},
+			svcConf: &serviceConfig{},
+			cidrs:   []string{"192.0.2.0/24", "198.51.100.0/24"},
+			expectedRules: []rules.CreateOpts{
+				rule(rules.ProtocolTCP, "10.0.0.0/24", 32000),
+				rule(rules.ProtocolTCP, "192.0.2.0/24", 30080),
+				rule(rules.ProtocolTCP, "198.51.100.0/24", 30080),
+			},
+		},
+		{
+			name: "member ports shared by several ports",
+			spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080},
+				{Name: "https", Protocol: corev1.ProtocolTCP, Port: 443, NodePort: 30443},
+			}},
+			svcConf:       &serviceConfig{memberPorts: map[string]int{"http": 8080, "https": 8080}},
+			cidrs:         []string{"10.0.0.0/24"},
+			expectedRules: []rules.CreateOpts{rule(rules.ProtocolTCP, "10.0.0.0/24", 8080)},
+		},
+		{
+			name: "no node ports allocated",
+			spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+			}},
+			svcConf: &serviceConfig{},
+			cidrs:   []string{"10.0.0.0/24"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{Spec: test.spec}
+			wantedRules := getWantedSecurityGroupRules(service, test.svcConf, "sg-id", rules.EtherType4, "10.0.0.0/24", test.cidrs)
+			assert.Equal(t, test.expectedRules, wantedRules)
+		})
+	}
+}
+
+func TestDisassociateSecurityGroupForLB(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	var updated []string
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		th.TestFormValues(t, r, map[string]string{"security_groups": "sg-id"})
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ports": [
+			{"id": "member-port", "device_id": "member-server", "security_groups": ["default", "sg-id"]},
+			{"id": "removed-port", "device_id": "removed-server", "security_groups": ["default", "sg-id"]}
+		]}`)
+	})
+	th.Mux.HandleFunc("/ports/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPut)
+		th.TestJSONRequest(t, r, `{"port": {"security_groups": ["default"]}}`)
+		updated = append(updated, strings.TrimPrefix(r.URL.Path, "/ports/"))
+		fmt.Fprint(w, `{"port": {}}`)
+	})
+
+	network := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+	assert.NoError(t, disassociateSecurityGroupForLB(network, "sg-id", sets.New("member-server")))
+	assert.Equal(t, []string{"removed-port"}, updated)
+}
+
+func TestEnsureLoadBalancerTerminatingService(t *testing.T) {
+	now := metav1.Now()
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test",
+			Namespace:         "default",
+			DeletionTimestamp: &now,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80, NodePort: 30080, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+
+	service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}}
+
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	th.Mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s for a Service being deleted", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+	lbaas := &LbaasV2{LoadBalancer{
+		lb:      client,
+		network: client,
+		opts:    LoadBalancerOpts{TerminatingServiceBehavior: terminatingServiceSkip},
+	}}
+
+	// The ensure and the update are queued while the delete of the load balancer is in progress, they wait for it
+	// under the lock of the Service and must not provision it again once it's deleted.
+	deleted := false
+	unlock := lockService(service)
+	ensured := make(chan struct{})
+	go func() {
+		defer close(ensured)
+		status, err := lbaas.EnsureLoadBalancer(context.TODO(), testClusterName, service, []*corev1.Node{{}})
+		assert.True(t, deleted)
+		assert.NoError(t, err)
+		assert.Equal(t, &service.Status.LoadBalancer, status)
+	}()
+	updated := make(chan struct{})
+	go func() {
+		defer close(updated)
+		assert.NoError(t, lbaas.UpdateLoadBalancer(context.TODO(), testClusterName, service, []*corev1.Node{{}}))
+		assert.True(t, deleted)
+	}()
+
+	select {
+	case <-ensured:
+		t.Fatal("the ensure didn't wait for the delete in progress")
+	case <-updated:
+		t.Fatal("the update didn't wait for the delete in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	deleted = true
+	unlock()
+
+	for _, done := range []chan struct{}{ensured, updated} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the reconciles of the Service being deleted didn't return")
+		}
+	}
+}
+
+func TestSkipsTerminatingService(t *testing.T) {
+	now := metav1.Now()
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+	terminating := service.DeepCopy()
+	terminating.DeletionTimestamp = &now
+
+	skip := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{TerminatingServiceBehavior: terminatingServiceSkip}}}
+	assert.False(t, skip.skipsTerminatingService(service))
+	assert.True(t, skip.skipsTerminatingService(terminating))
+
+	ensure := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{TerminatingServiceBehavior: terminatingServiceEnsure}}}
+	assert.False(t, ensure.skipsTerminatingService(terminating))
+}
+
+func TestLoadBalancerEmptyClusterName(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80, NodePort: 30080, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+	nodes := []*corev1.Node{{}}
+
+	// No OpenStack clients are set up, any attempt to touch the load balancer of the Service would panic here.
+	lbaas := &LbaasV2{LoadBalancer{}}
+
+	status, err := lbaas.EnsureLoadBalancer(context.TODO(), "", service, nodes)
+	assert.Nil(t, status)
+	assert.ErrorContains(t, err, "cluster name is empty")
+
+	err = lbaas.UpdateLoadBalancer(context.TODO(), "", service, nodes)
+	assert.ErrorContains(t, err, "cluster name is empty")
+
+	err = lbaas.EnsureLoadBalancerDeleted(context.TODO(), "", service)
+	assert.ErrorContains(t, err, "cluster name is empty")
+}
+
+func TestLockService(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	unlock := lockService(service)
+	locked := make(chan struct{})
+	go func() {
+		// e.g. the members being re-populated while the Service is ensured
+		defer lockService(service.DeepCopy())()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Service locked by two reconciles at once")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Service not locked once unlocked")
+	}
+
+	// Other Services don't wait, even if they have the same name.
+	unlock = lockService(service)
+	recreated := service.DeepCopy()
+	recreated.UID = "uid-recreated"
+	lockService(recreated)()
+	lockService(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other"}})()
+	unlock()
+
+	serviceLocks.Lock()
+	defer serviceLocks.Unlock()
+	assert.Empty(t, serviceLocks.locks)
+}
+
+func TestGetPoolGroups(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
+		{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
+		{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+	}
+	tests := []struct {
+		name       string
+		annotation string
+		expected   map[string]string
+		expectErr  bool
+	}{
+		{
+			name:       "no annotation",
+			annotation: "",
+			expected:   nil,
+		},
+		{
+			name:       "single group",
+			annotation: "http=web, https=web",
+			expected:   map[string]string{"http": "web", "https": "web"},
+		},
+		{
+			name:       "multiple groups",
+			annotation: "http=web,https=secure,dns=dns",
+			expected:   map[string]string{"http": "web", "https": "secure", "dns": "dns"},
+		},
+		{
+			name:       "malformed pair",
+			annotation: "http=web,https",
+			expectErr:  true,
+		},
+		{
+			name:       "unknown port",
+			annotation: "http=web,metrics=web",
+			expectErr:  true,
+		},
+		{
+			name:       "mixed protocols",
+			annotation: "http=web,dns=web",
+			expectErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec:       corev1.ServiceSpec{Ports: ports},
+			}
+			if tt.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerSharedPoolGroups] = tt.annotation
+			}
+			groups, err := getPoolGroups(service)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, groups)
+		})
+	}
+}
+
+func TestGetMemberPorts(t *testing.T) {
+	tests := []struct {
+		name       string
+		ports      []corev1.ServicePort
+		annotation string
+		expected   map[string]int
+		expectErr  bool
+	}{
+		{
+			name:       "no annotation",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}},
+			annotation: "",
+			expected:   nil,
+		},
+		{
+			name:       "named ports",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}},
+			annotation: "http=8080, https=8443",
+			expected:   map[string]int{"http": 8080, "https": 8443},
+		},
+		{
+			name:       "port without name",
+			ports:      []corev1.ServicePort{{Port: 80}},
+			annotation: "8080",
+			expected:   map[string]int{"": 8080},
+		},
+		{
+			name:       "port without name applies to the ports not listed",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}, {Name: "metrics", Port: 9090}},
+			annotation: "8080,metrics=9100",
+			expected:   map[string]int{"http": 8080, "https": 8080, "metrics": 9100},
+		},
+		{
+			name:       "port out of range",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}},
+			annotation: "http=65536",
+			expectErr:  true,
+		},
+		{
+			name:       "zero port",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}},
+			annotation: "http=0",
+			expectErr:  true,
+		},
+		{
+			name:       "not a number",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}},
+			annotation: "http=web",
+			expectErr:  true,
+		},
+		{
+			name:       "unknown port",
+			ports:      []corev1.ServicePort{{Name: "http", Port: 80}},
+			annotation: "metrics=9100",
+			expectErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec:       corev1.ServiceSpec{Ports: tt.ports},
+			}
+			if tt.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerMemberPorts] = tt.annotation
+			}
+			memberPorts, err := getMemberPorts(service)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, memberPorts)
+		})
+	}
+}
+
+func TestGetAdminStateUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		expected   *bool
+		expectErr  bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:       "up",
+			annotation: "up",
+			expected:   pointer.Bool(true),
+		},
+		{
+			name:       "down",
+			annotation: "Down",
+			expected:   pointer.Bool(false),
+		},
+		{
+			name:       "invalid",
+			annotation: "false",
+			expectErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tt.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerAdminState] = tt.annotation
+			}
+			adminStateUp, err := getAdminStateUp(service)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, adminStateUp)
+		})
+	}
+}
+
+func TestEnsureOctaviaListenerAdminState(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminStateUp  *bool
+		listenerUp    bool
+		expectedBody  string
+		expectUpdated bool
+	}{
+		{
+			name:         "annotation not set",
+			adminStateUp: nil,
+			listenerUp:   false,
+		},
+		{
+			name:         "already down",
+			adminStateUp: pointer.Bool(false),
+			listenerUp:   false,
+		},
+		{
+			name:          "taken down",
+			adminStateUp:  pointer.Bool(false),
+			listenerUp:    true,
+			expectedBody:  `{"listener": {"admin_state_up": false}}`,
+			expectUpdated: true,
+		},
+		{
+			name:          "restored",
+			adminStateUp:  pointer.Bool(true),
+			listenerUp:    false,
+			expectedBody:  `{"listener": {"admin_state_up": true}}`,
+			expectUpdated: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var updated bool
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/listeners/listener-id", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodPut)
+				th.TestJSONRequest(t, r, test.expectedBody)
+				updated = true
+				fmt.Fprint(w, `{"listener": {"id": "listener-id"}}`)
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			listener := &listeners.Listener{ID: "listener-id", Protocol: "TCP", ProtocolPort: 80, AdminStateUp: test.listenerUp}
+			mapping := map[listenerKey]*listeners.Listener{{Protocol: listeners.ProtocolTCP, Port: 80}: listener}
+			port := corev1.ServicePort{Port: 80, Protocol: corev1.ProtocolTCP}
+
+			_, err := lbaas.ensureOctaviaListener("lb-id", "listener_0_test", mapping, port, &serviceConfig{adminStateUp: test.adminStateUp}, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectUpdated, updated)
+		})
+	}
+}
+
+func TestGetResourceTags(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "8e7d1f2c-5b4a-4c3d-9e8f-0a1b2c3d4e5f"}}
+	tags := getResourceTags("kube_service_kubernetes_default_web", "kubernetes", service)
+	assert.Equal(t, []string{
+		"kube_service_kubernetes_default_web",
+		"k8s_cluster=kubernetes",
+		"k8s_namespace=default",
+		"k8s_name=web",
+		"k8s_service_uid=8e7d1f2c-5b4a-4c3d-9e8f-0a1b2c3d4e5f",
+	}, tags)
+
+	// The Services sharing a load balancer are counted on the name tags, the others mustn't look like one.
+	for _, tag := range tags[1:] {
+		assert.False(t, strings.HasPrefix(tag, servicePrefix), tag)
+	}
+}
+
+func TestAddMissingTags(t *testing.T) {
+	tests := []struct {
+		name            string
+		current         []string
+		wanted          []string
+		expectedTags    []string
+		expectedMissing bool
+	}{
+		{
+			name:         "all set",
+			current:      []string{"other", "a", "b"},
+			wanted:       []string{"a", "b"},
+			expectedTags: []string{"other", "a", "b"},
+		},
+		{
+			name:            "untagged",
+			wanted:          []string{"a", "b"},
+			expectedTags:    []string{"a", "b"},
+			expectedMissing: true,
+		},
+		{
+			name:            "tags of other Services kept",
+			current:         []string{"other", "a"},
+			wanted:          []string{"a", "b"},
+			expectedTags:    []string{"other", "a", "b"},
+			expectedMissing: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags, missing := addMissingTags(test.current, test.wanted)
+			assert.Equal(t, test.expectedTags, tags)
+			assert.Equal(t, test.expectedMissing, missing)
+		})
+	}
+}
+
+func TestRemoveServiceTags(t *testing.T) {
+	owner := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid-web"}}
+	other := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api", UID: "uid-api"}}
+	lbTags := append(getResourceTags("kube_service_kubernetes_default_web", "kubernetes", owner), "kube_service_kubernetes_default_api")
+
+	assert.Equal(t, []string{"kube_service_kubernetes_default_web", "k8s_cluster=kubernetes", "k8s_namespace=default", "k8s_name=web", "k8s_service_uid=uid-web"},
+		removeServiceTags(lbTags, "kube_service_kubernetes_default_api", other))
+	assert.Equal(t, []string{"k8s_cluster=kubernetes", "kube_service_kubernetes_default_api"},
+		removeServiceTags(lbTags, "kube_service_kubernetes_default_web", owner))
+}
+
+func TestGetCustomTags(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	tags, err := getCustomTags(service)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	service.Annotations[ServiceAnnotationLoadBalancerTags] = "team=web, cost-center=42,,team=web"
+	tags, err = getCustomTags(service)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team=web", "cost-center=42"}, tags)
+
+	for _, value := range []string{"team=web,k8s_cluster=other", "kube_service_kubernetes_default_api", strings.Repeat("a", 250)} {
+		service.Annotations[ServiceAnnotationLoadBalancerTags] = value
+		_, err = getCustomTags(service)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestSyncCustomTags(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid-web"}}
+	occmTags := getResourceTags("kube_service_kubernetes_default_web", "kubernetes", service)
+
+	// Added along with their markers
+	tags, changed := syncCustomTags(append([]string{"other"}, occmTags...), []string{"team=web", "cost-center=42"})
+	assert.True(t, changed)
+	assert.Equal(t, append(append([]string{"other"}, occmTags...), "team=web", "k8s_tag=team=web", "cost-center=42", "k8s_tag=cost-center=42"), tags)
+
+	current := tags
+	tags, changed = syncCustomTags(current, []string{"team=web", "cost-center=42"})
+	assert.False(t, changed)
+	assert.Equal(t, current, tags)
+
+	// Removed when dropped from the annotation, the tags of the controller and of others are kept
+	tags, changed = syncCustomTags(current, []string{"team=api"})
+	assert.True(t, changed)
+	assert.Equal(t, append(append([]string{"other"}, occmTags...), "team=api", "k8s_tag=team=api"), tags)
+
+	tags, changed = syncCustomTags(tags, nil)
+	assert.True(t, changed)
+	assert.Equal(t, append([]string{"other"}, occmTags...), tags)
+
+	// The tags of the controller are never removed, even if marked
+	tags, changed = syncCustomTags(append(append([]string{}, occmTags...), "k8s_tag=k8s_cluster=kubernetes"), nil)
+	assert.True(t, changed)
+	assert.Equal(t, occmTags, tags)
+
+	// The custom tags of the owner are removed along with the tags describing it
+	lbTags, _ := syncCustomTags(append(append([]string{}, occmTags...), "kube_service_kubernetes_default_api"), []string{"team=web"})
+	assert.Equal(t, []string{"k8s_cluster=kubernetes", "kube_service_kubernetes_default_api"},
+		removeServiceTags(lbTags, "kube_service_kubernetes_default_web", service))
+}
+
+func TestEnsureOctaviaListenerTags(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid-web"}}
+	lbName := "kube_service_kubernetes_default_web"
+	svcConf := &serviceConfig{supportLBTags: true, lbName: lbName, tags: getResourceTags(lbName, "kubernetes", service)}
+
+	// The listeners are kept in memory, so that the tags set on creation can be read back.
+	stored := map[string]*listeners.Listener{}
+	var updates int
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+	})
+	th.Mux.HandleFunc("/lbaas/listeners", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPost)
+		var body struct {
+			Listener listeners.Listener `json:"listener"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		body.Listener.ID = "created-id"
+		stored[body.Listener.ID] = &body.Listener
+		w.WriteHeader(http.StatusCreated)
+		assert.NoError(t, json.NewEncoder(w).Encode(body))
+	})
+	th.Mux.HandleFunc("/lbaas/listeners/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPut)
+		listener := stored[strings.TrimPrefix(r.URL.Path, "/lbaas/listeners/")]
+		var body struct {
+			Listener struct {
+				Tags []string `json:"tags"`
+			} `json:"listener"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		listener.Tags = body.Listener.Tags
+		updates++
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]*listeners.Listener{"listener": listener}))
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+	port := corev1.ServicePort{Port: 80, Protocol: corev1.ProtocolTCP}
+	key := listenerKey{Protocol: listeners.ProtocolTCP, Port: 80}
+
+	// Created with the tags
+	listener, err := lbaas.ensureOctaviaListener("lb-id", "listener_0_test", map[listenerKey]*listeners.Listener{}, port, svcConf, service)
+	assert.NoError(t, err)
+	assert.Equal(t, svcConf.tags, stored[listener.ID].Tags)
+
+	// Not updated once tagged
+	_, err = lbaas.ensureOctaviaListener("lb-id", "listener_0_test", map[listenerKey]*listeners.Listener{key: stored[listener.ID]}, port, svcConf, service)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updates)
+
+	// The listeners tagged only with the name of the load balancer get the missing tags, the other tags are kept
+	legacy := &listeners.Listener{ID: "legacy-id", Protocol: "TCP", ProtocolPort: 80, Tags: []string{"custom", lbName}}
+	stored[legacy.ID] = legacy
+	_, err = lbaas.ensureOctaviaListener("lb-id", "listener_0_test", map[listenerKey]*listeners.Listener{key: legacy}, port, svcConf, service)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+	assert.Equal(t, append([]string{"custom"}, svcConf.tags...), stored[legacy.ID].Tags)
+
+	// The listeners of the named ports are tagged with the name, the tag follows the renames of the port
+	named := corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}
+	listener, err = lbaas.ensureOctaviaListener("lb-id", "listener_0_test", map[listenerKey]*listeners.Listener{}, named, svcConf, service)
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]string{}, svcConf.tags...), "k8s_port_name=http"), stored[listener.ID].Tags)
+
+	named.Name = "web"
+	_, err = lbaas.ensureOctaviaListener("lb-id", "listener_0_test", map[listenerKey]*listeners.Listener{key: stored[listener.ID]}, named, svcConf, service)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updates)
+	assert.Equal(t, append(append([]string{}, svcConf.tags...), "k8s_port_name=web"), stored[listener.ID].Tags)
+
+	named.Name = ""
+	_, err = lbaas.ensureOctaviaListener("lb-id", "listener_0_test", map[listenerKey]*listeners.Listener{key: stored[listener.ID]}, named, svcConf, service)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, updates)
+	assert.Equal(t, svcConf.tags, stored[listener.ID].Tags)
+}
+
+func TestSyncListenerTags(t *testing.T) {
+	wanted := getListenerTags([]string{"lb-name"}, corev1.ServicePort{Name: "https", Port: 443})
+	assert.Equal(t, []string{"lb-name", "k8s_port_name=https"}, wanted)
+
+	tags, changed := syncListenerTags([]string{"custom", "lb-name", "k8s_port_name=https"}, wanted)
+	assert.False(t, changed)
+	assert.Equal(t, []string{"custom", "lb-name", "k8s_port_name=https"}, tags)
+
+	tags, changed = syncListenerTags([]string{"custom", "lb-name", "k8s_port_name=tls"}, wanted)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"custom", "lb-name", "k8s_port_name=https"}, tags)
+
+	tags, changed = syncListenerTags([]string{"custom", "lb-name", "k8s_port_name=tls"}, []string{"lb-name"})
+	assert.True(t, changed)
+	assert.Equal(t, []string{"custom", "lb-name"}, tags)
+}
+
+func TestGetDriftedListeners(t *testing.T) {
+	lbName := "kube_service_kubernetes_default_web"
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Port: 80, Protocol: corev1.ProtocolTCP},
+		{Port: 53, Protocol: corev1.ProtocolUDP},
+	}}}
+
+	tests := []struct {
+		name        string
+		svcConf     *serviceConfig
+		listeners   []listeners.Listener
+		isLBOwner   bool
+		expectedIDs []string
+	}{
+		{
+			name:    "no drift",
+			svcConf: &serviceConfig{},
+			listeners: []listeners.Listener{
+				{ID: "tcp", Protocol: "TCP", ProtocolPort: 80, Tags: []string{lbName}},
+				{ID: "udp", Protocol: "UDP", ProtocolPort: 53, Tags: []string{lbName}},
+			},
+		},
+		{
+			name:    "protocol changed",
+			svcConf: &serviceConfig{},
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "HTTP", ProtocolPort: 80, Tags: []string{lbName}},
+				{ID: "udp", Protocol: "UDP", ProtocolPort: 53, Tags: []string{lbName}},
+			},
+			expectedIDs: []string{"http"},
+		},
+		{
+			name:    "protocol expected by the service config",
+			svcConf: &serviceConfig{keepClientIP: true},
+			listeners: []listeners.Listener{
+				{ID: "tcp", Protocol: "TCP", ProtocolPort: 80, Tags: []string{lbName}},
+			},
+			expectedIDs: []string{"tcp"},
+		},
+		{
+			name:    "listener of another service",
+			svcConf: &serviceConfig{},
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "HTTP", ProtocolPort: 80, Tags: []string{"kube_service_kubernetes_default_other"}},
+			},
+		},
+		{
+			name:    "untagged listener of the owner",
+			svcConf: &serviceConfig{},
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "HTTP", ProtocolPort: 80},
+			},
+			isLBOwner:   true,
+			expectedIDs: []string{"http"},
+		},
+		{
+			name:    "port no longer in the service",
+			svcConf: &serviceConfig{},
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "HTTP", ProtocolPort: 8080, Tags: []string{lbName}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ids []string
+			for _, listener := range getDriftedListeners(service, test.svcConf, test.listeners, test.isLBOwner, lbName) {
+				ids = append(ids, listener.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+		})
+	}
+}
+
+func TestIsPoolOwned(t *testing.T) {
+	lbName := "kube_service_kubernetes_default_web"
+
+	tests := []struct {
+		name     string
+		pool     *v2pools.Pool
+		expected bool
+	}{
+		{
+			name:     "tagged",
+			pool:     &v2pools.Pool{Name: "pool_0_" + lbName, Tags: []string{lbName}},
+			expected: true,
+		},
+		{
+			name: "tagged by another service",
+			pool: &v2pools.Pool{Name: "pool_0_" + lbName, Tags: []string{"kube_service_kubernetes_default_other"}},
+		},
+		{
+			name:     "untagged",
+			pool:     &v2pools.Pool{Name: "pool_0_kube_service_kubernetes_default_owner"},
+			expected: true,
+		},
+		{
+			name: "created manually",
+			pool: &v2pools.Pool{Name: "maintenance"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isPoolOwned(test.pool, lbName))
+		})
+	}
+}
+
+func TestBuildBatchUpdateMemberOpts(t *testing.T) {
+	nodes := []*corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}}},
+		},
+	}
+	tests := []struct {
+		name          string
+		port          corev1.ServicePort
+		memberPorts   map[string]int
+		expectedPorts []int
+	}{
+		{
+			name:          "node port",
+			port:          corev1.ServicePort{Name: "http", Port: 80, NodePort: 30080},
+			expectedPorts: []int{30080, 30080},
+		},
+		{
+			name:          "overridden member port",
+			port:          corev1.ServicePort{Name: "http", Port: 80, NodePort: 30080},
+			memberPorts:   map[string]int{"http": 8080},
+			expectedPorts: []int{8080, 8080},
+		},
+		{
+			name:          "overridden member port without node port",
+			port:          corev1.ServicePort{Name: "http", Port: 80},
+			memberPorts:   map[string]int{"http": 8080},
+			expectedPorts: []int{8080, 8080},
+		},
+		{
+			name: "no node port",
+			port: corev1.ServicePort{Name: "http", Port: 80},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{drainingNodes: newNodeDrainTracker()}}
+			members, newMembers, err := lbaas.buildBatchUpdateMemberOpts(tt.port, nodes, &serviceConfig{memberPorts: tt.memberPorts})
+			assert.NoError(t, err)
+
+			var ports []int
+			for _, member := range members {
+				ports = append(ports, member.ProtocolPort)
+			}
+			assert.Equal(t, tt.expectedPorts, ports)
+			assert.Equal(t, len(tt.expectedPorts), newMembers.Len())
+		})
+	}
+}
+
+func TestGetPortBatches(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
+		{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+		{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
+		{Name: "metrics", Port: 9090, Protocol: corev1.ProtocolTCP},
+	}
+	tests := []struct {
+		name       string
+		poolGroups map[string]string
+		expected   [][]int
+	}{
+		{
+			name:     "no groups",
+			expected: [][]int{{0}, {1}, {2}, {3}},
+		},
+		{
+			name:       "ports sharing a pool",
+			poolGroups: map[string]string{"http": "web", "https": "web"},
+			expected:   [][]int{{0, 2}, {1}, {3}},
+		},
+		{
+			name:       "multiple groups",
+			poolGroups: map[string]string{"http": "web", "https": "web", "dns": "dns", "metrics": "dns"},
+			expected:   [][]int{{0, 2}, {1, 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, getPortBatches(ports, tt.poolGroups))
+		})
+	}
+}
+
+func TestGetDescription(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	tests := []struct {
+		name      string
+		template  string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "default template",
+			expected: "Kubernetes external service default/web from cluster kubernetes",
+		},
+		{
+			name:     "custom template",
+			template: "{{.ClusterName}}: {{.Namespace}}/{{.Name}}",
+			expected: "kubernetes: default/web",
+		},
+		{
+			name:     "truncated description",
+			template: strings.Repeat("x", 300),
+			expected: strings.Repeat("x", 255),
+		},
+		{
+			name:      "unknown field",
+			template:  "{{.Owner}}",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{}}
+			if test.template != "" {
+				tmpl, err := parseDescriptionTemplate(test.template)
+				if test.expectErr {
+					assert.Error(t, err)
+					return
+				}
+				assert.NoError(t, err)
+				lbaas.description = tmpl
+			}
+			description, err := lbaas.getDescription("kubernetes", service)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, description)
+		})
+	}
+}
+
+func TestGetListenerOpts(t *testing.T) {
+	opts := LoadBalancerOpts{
+		ConnectionLimit:      1000,
+		TimeoutClientData:    50000,
+		TimeoutMemberConnect: 5000,
+		TimeoutMemberData:    50000,
+		TimeoutTCPInspect:    0,
+		ListenerOpts: map[string]*ListenerOpts{
+			"HTTP": {ConnectionLimit: pointer.Int(-1), TimeoutClientData: pointer.Int(60000)},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		protocol     listeners.Protocol
+		listenerOpts ListenerOpts
+		expected     ListenerOpts
+	}{
+		{
+			name:     "defaults",
+			protocol: listeners.ProtocolTCP,
+			expected: ListenerOpts{
+				ConnectionLimit:      pointer.Int(1000),
+				TimeoutClientData:    pointer.Int(50000),
+				TimeoutMemberConnect: pointer.Int(5000),
+				TimeoutMemberData:    pointer.Int(50000),
+				TimeoutTCPInspect:    pointer.Int(0),
+			},
+		},
+		{
+			name:     "protocol section",
+			protocol: listeners.ProtocolHTTP,
+			expected: ListenerOpts{
+				ConnectionLimit:      pointer.Int(-1),
+				TimeoutClientData:    pointer.Int(60000),
+				TimeoutMemberConnect: pointer.Int(5000),
+				TimeoutMemberData:    pointer.Int(50000),
+				TimeoutTCPInspect:    pointer.Int(0),
+			},
+		},
+		{
+			name:         "annotations win",
+			protocol:     listeners.ProtocolHTTP,
+			listenerOpts: ListenerOpts{ConnectionLimit: pointer.Int(200), TimeoutMemberData: pointer.Int(1000)},
+			expected: ListenerOpts{
+				ConnectionLimit:      pointer.Int(200),
+				TimeoutClientData:    pointer.Int(60000),
+				TimeoutMemberConnect: pointer.Int(5000),
+				TimeoutMemberData:    pointer.Int(1000),
+				TimeoutTCPInspect:    pointer.Int(0),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{opts: opts}}
+			svcConf := &serviceConfig{listenerOpts: test.listenerOpts}
+			assert.Equal(t, test.expected, lbaas.getListenerOpts(test.protocol, svcConf))
+		})
+	}
+}
+
+func TestGetNodeDrainState(t *testing.T) {
+	tests := []struct {
+		name             string
+		gracePeriod      time.Duration
+		taintKey         string
+		node             *corev1.Node
+		drainingFor      time.Duration
+		expectedDraining bool
+		expectedExpired  bool
+	}{
+		{
+			name:        "draining disabled",
+			node:        &corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}},
+			drainingFor: time.Hour,
+		},
+		{
+			name:        "schedulable node",
+			gracePeriod: time.Minute,
+			node:        &corev1.Node{},
+		},
+		{
+			name:             "cordoned node",
+			gracePeriod:      time.Minute,
+			node:             &corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}},
+			expectedDraining: true,
+		},
+		{
+			name:        "tainted node without taint key configured",
+			gracePeriod: time.Minute,
+			node:        &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "draining"}}}},
+		},
+		{
+			name:             "tainted node",
+			gracePeriod:      time.Minute,
+			taintKey:         "draining",
+			node:             &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "draining"}}}},
+			expectedDraining: true,
+		},
+		{
+			name:             "grace period expired",
+			gracePeriod:      time.Minute,
+			node:             &corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}},
+			drainingFor:      2 * time.Minute,
+			expectedDraining: true,
+			expectedExpired:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.node.Name = "node-1"
+			tracker := newNodeDrainTracker()
+			if test.drainingFor > 0 {
+				tracker.since[test.node.Name] = time.Now().Add(-test.drainingFor)
+			}
+			lbaas := &LbaasV2{LoadBalancer{
+				opts: LoadBalancerOpts{
+					NodeDrainGracePeriod: util.MyDuration{Duration: test.gracePeriod},
+					NodeDrainTaintKey:    test.taintKey,
+				},
+				drainingNodes: tracker,
+			}}
+
+			draining, expired := lbaas.getNodeDrainState(test.node)
+			assert.Equal(t, test.expectedDraining, draining)
+			assert.Equal(t, test.expectedExpired, expired)
+		})
+	}
+}
+
+func TestNodeDrainTrackerUncordon(t *testing.T) {
+	tracker := newNodeDrainTracker()
+	start := time.Now()
+
+	assert.Equal(t, start, tracker.observe("node-1", true, start))
+	assert.Equal(t, start, tracker.observe("node-1", true, start.Add(time.Minute)))
+	assert.Equal(t, time.Time{}, tracker.observe("node-1", false, start.Add(2*time.Minute)))
+	assert.Equal(t, start.Add(3*time.Minute), tracker.observe("node-1", true, start.Add(3*time.Minute)))
+}
+
+func TestNodeDrainTrackerResync(t *testing.T) {
+	readyCondition := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+	draining := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+		Status:     corev1.NodeStatus{Conditions: readyCondition},
+	}
+	ready := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}, Status: corev1.NodeStatus{Conditions: readyCondition}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	gracePeriod := time.Minute
+
+	tracker := newNodeDrainTracker()
+	tracker.serviceLister = corelisters.NewServiceLister(newTestIndexer(service))
+	tracker.nodeLister = corelisters.NewNodeLister(newTestIndexer(draining, ready))
+	tracker.queue = workqueue.NewDelayingQueue()
+	resynced := make(chan []*corev1.Node, 1)
+	tracker.setResync(func(_ context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node) error {
+		assert.Equal(t, "kubernetes", clusterName)
+		assert.Equal(t, "web", svc.Name)
+		resynced <- nodes
+		return nil
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go tracker.run(stopCh)
+
+	// No node is draining, nothing is scheduled.
+	tracker.track(service, "kubernetes", []*corev1.Node{ready}, gracePeriod)
+	assert.Empty(t, tracker.waiting)
+
+	tracker.since[draining.Name] = time.Now().Add(-gracePeriod + 100*time.Millisecond)
+	tracker.track(service, "kubernetes", []*corev1.Node{draining, ready}, gracePeriod)
+	select {
+	case nodes := <-resynced:
+		assert.Len(t, nodes, 2)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Service wasn't re-synced once the grace period was over")
+	}
+
+	// The deleted load balancers aren't re-synced.
+	tracker.since[draining.Name] = time.Now().Add(-gracePeriod + 100*time.Millisecond)
+	tracker.track(service, "kubernetes", []*corev1.Node{draining, ready}, gracePeriod)
+	tracker.track(service, "kubernetes", nil, 0)
+	select {
+	case <-resynced:
+		t.Fatal("the Service of a deleted load balancer was re-synced")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestValidateHealthMonitor(t *testing.T) {
+	tests := []struct {
+		name      string
+		svcConf   serviceConfig
+		expectErr string
+	}{
+		{
+			name:    "valid",
+			svcConf: serviceConfig{healthMonitorDelay: 5, healthMonitorTimeout: 3, healthMonitorMaxRetries: 1, healthMonitorMaxRetriesDown: 3},
+		},
+		{
+			name:      "negative delay",
+			svcConf:   serviceConfig{healthMonitorDelay: -5, healthMonitorTimeout: 3, healthMonitorMaxRetries: 1, healthMonitorMaxRetriesDown: 3},
+			expectErr: "must not be negative",
+		},
+		{
+			name:      "timeout equal to delay",
+			svcConf:   serviceConfig{healthMonitorDelay: 5, healthMonitorTimeout: 5, healthMonitorMaxRetries: 1, healthMonitorMaxRetriesDown: 3},
+			expectErr: "must be less than delay",
+		},
+		{
+			name:      "max retries out of range",
+			svcConf:   serviceConfig{healthMonitorDelay: 5, healthMonitorTimeout: 3, healthMonitorMaxRetries: 11, healthMonitorMaxRetriesDown: 3},
+			expectErr: "max retries (11)",
+		},
+		{
+			name:      "max retries down out of range",
+			svcConf:   serviceConfig{healthMonitorDelay: 5, healthMonitorTimeout: 3, healthMonitorMaxRetries: 1, healthMonitorMaxRetriesDown: 0},
+			expectErr: "max retries down (0)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateHealthMonitor(&test.svcConf)
+			if test.expectErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.expectErr)
+			}
+		})
+	}
+}
+
+func TestCheckClientIPConfig(t *testing.T) {
+	tcpPort := corev1.ServicePort{Port: 80, NodePort: 30080, Protocol: corev1.ProtocolTCP}
+	udpPort := corev1.ServicePort{Port: 53, NodePort: 30053, Protocol: corev1.ProtocolUDP}
+	tests := []struct {
+		name          string
+		provider      string
+		ports         []corev1.ServicePort
+		annotations   map[string]string
+		svcConf       serviceConfig
+		expectedErr   string
+		expectedEvent string
+	}{
+		{
+			name:    "header insertion with TCP ports",
+			ports:   []corev1.ServicePort{tcpPort},
+			svcConf: serviceConfig{keepClientIP: true, allowedCIDR: []string{"10.0.0.0/8"}, enableMonitor: true},
+		},
+		{
+			name:     "PROXY protocol with ovn",
+			provider: "ovn",
+			ports:    []corev1.ServicePort{tcpPort},
+			svcConf:  serviceConfig{enableProxyProtocol: true},
+			expectedErr: "annotation loadbalancer.openstack.org/proxy-protocol is not supported by the ovn provider, " +
+				"which keeps the client IP as the source address",
+		},
+		{
+			name:     "all the conflicts at once",
+			provider: "ovn",
+			ports:    []corev1.ServicePort{tcpPort, udpPort},
+			svcConf:  serviceConfig{keepClientIP: true, enableProxyProtocol: true},
+			expectedErr: "annotation loadbalancer.openstack.org/proxy-protocol and loadbalancer.openstack.org/x-forwarded-for cannot be used together; " +
+				"annotation loadbalancer.openstack.org/x-forwarded-for is not supported by the ovn provider, which has no HTTP listeners to insert the header and keeps the client IP as the source address; " +
+				"annotation loadbalancer.openstack.org/proxy-protocol is not supported by the ovn provider, which keeps the client IP as the source address; " +
+				"annotation loadbalancer.openstack.org/x-forwarded-for requires TCP ports, only HTTP listeners insert the header, ports 53/UDP aren't TCP",
+		},
+		{
+			name:  "monitor settings with the monitor disabled",
+			ports: []corev1.ServicePort{tcpPort},
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerEnableHealthMonitor: "false",
+				ServiceAnnotationLoadBalancerHealthMonitorDelay:  "10",
+			},
+			svcConf: serviceConfig{keepClientIP: true},
+			expectedEvent: "Warning LoadBalancerConfigConflict annotations loadbalancer.openstack.org/health-monitor-delay are ignored, " +
+				"annotation loadbalancer.openstack.org/enable-health-monitor disables the health monitor",
+		},
+		{
+			name:  "conflicts and ignored settings",
+			ports: []corev1.ServicePort{udpPort},
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerEnableHealthMonitor:     "false",
+				ServiceAnnotationLoadBalancerHealthMonitorTimeout:    "3",
+				ServiceAnnotationLoadBalancerHealthMonitorMaxRetries: "2",
+			},
+			svcConf:     serviceConfig{keepClientIP: true},
+			expectedErr: "annotation loadbalancer.openstack.org/x-forwarded-for requires TCP ports, only HTTP listeners insert the header, ports 53/UDP aren't TCP",
+			expectedEvent: "Warning LoadBalancerConfigConflict annotation loadbalancer.openstack.org/x-forwarded-for requires TCP ports, only HTTP listeners insert the header, ports 53/UDP aren't TCP; " +
+				"annotations loadbalancer.openstack.org/health-monitor-timeout, loadbalancer.openstack.org/health-monitor-max-retries are ignored, " +
+				"annotation loadbalancer.openstack.org/enable-health-monitor disables the health monitor",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			lbaas := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{LBProvider: test.provider}, eventRecorder: recorder}}
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: test.annotations},
+				Spec:       corev1.ServiceSpec{Ports: test.ports},
+			}
+
+			err := lbaas.checkClientIPConfig(service, &test.svcConf)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Equal(t, errorClassTerminal, classifyError(err))
+				if test.expectedEvent == "" {
+					test.expectedEvent = "Warning LoadBalancerConfigConflict " + test.expectedErr
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			if test.expectedEvent != "" {
+				assert.Equal(t, test.expectedEvent, <-recorder.Events)
+			}
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestEnsureOctaviaHealthMonitor(t *testing.T) {
+	port := corev1.ServicePort{Port: 53, NodePort: 30053, Protocol: corev1.ProtocolUDP}
+	tests := []struct {
+		name            string
+		monitorID       string
+		monitorExists   bool
+		enableMonitor   bool
+		expectedDeleted bool
+		expectedCreated bool
+	}{
+		{
+			name:            "disabled monitor is deleted",
+			monitorID:       "monitor-id",
+			monitorExists:   true,
+			expectedDeleted: true,
+		},
+		{
+			name:      "disabled monitor without existing monitor",
+			monitorID: "",
+		},
+		{
+			name:          "disabled monitor already deleted",
+			monitorID:     "monitor-id",
+			monitorExists: false,
+		},
+		{
+			name:            "re-enabled monitor is recreated",
+			monitorID:       "",
+			enableMonitor:   true,
+			expectedCreated: true,
+		},
+		{
+			name:            "missing monitor is recreated",
+			monitorID:       "monitor-id",
+			monitorExists:   false,
+			enableMonitor:   true,
+			expectedCreated: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var deleted, created bool
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/healthmonitors/monitor-id", func(w http.ResponseWriter, r *http.Request) {
+				if !test.monitorExists {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				switch r.Method {
+				case http.MethodGet:
+					fmt.Fprint(w, `{"healthmonitor": {"id": "monitor-id", "type": "UDP-CONNECT", "delay": 5, "timeout": 3, "max_retries": 1, "max_retries_down": 3}}`)
+				case http.MethodDelete:
+					deleted = true
+					w.WriteHeader(http.StatusNoContent)
+				}
+			})
+			th.Mux.HandleFunc("/lbaas/healthmonitors", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodPost)
+				created = true
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"healthmonitor": {"id": "new-monitor-id", "type": "UDP-CONNECT"}}`)
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			svcConf := &serviceConfig{
+				enableMonitor:               test.enableMonitor,
+				healthMonitorDelay:          5,
+				healthMonitorTimeout:        3,
+				healthMonitorMaxRetries:     1,
+				healthMonitorMaxRetriesDown: 3,
+			}
+			pool := &v2pools.Pool{ID: "pool-id", MonitorID: test.monitorID}
+
+			err := lbaas.ensureOctaviaHealthMonitor("lb-id", "monitor_0_test", pool, port, svcConf)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedDeleted, deleted)
+			assert.Equal(t, test.expectedCreated, created)
+		})
+	}
+}
+
+func TestGetSessionPersistence(t *testing.T) {
+	timeout := int32(600)
+	clientIPConfig := &corev1.SessionAffinityConfig{ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: &timeout}}
+	tests := []struct {
+		name       string
+		affinity   corev1.ServiceAffinity
+		config     *corev1.SessionAffinityConfig
+		annotation string
+		expected   *openstackutil.SessionPersistence
+		expectErr  bool
+	}{
+		{
+			name:     "no affinity",
+			affinity: corev1.ServiceAffinityNone,
+		},
+		{
+			name:     "client IP affinity",
+			affinity: corev1.ServiceAffinityClientIP,
+			expected: &openstackutil.SessionPersistence{Type: "SOURCE_IP"},
+		},
+		{
+			name:     "client IP affinity with timeout",
+			affinity: corev1.ServiceAffinityClientIP,
+			config:   clientIPConfig,
+			expected: &openstackutil.SessionPersistence{Type: "SOURCE_IP", PersistenceTimeout: 600},
+		},
+		{
+			name:       "annotation disables affinity",
+			affinity:   corev1.ServiceAffinityClientIP,
+			annotation: "none",
+		},
+		{
+			name:       "annotation overrides affinity",
+			affinity:   corev1.ServiceAffinityClientIP,
+			config:     clientIPConfig,
+			annotation: "HTTP_COOKIE",
+			expected:   &openstackutil.SessionPersistence{Type: "HTTP_COOKIE"},
+		},
+		{
+			name:       "annotation without affinity",
+			affinity:   corev1.ServiceAffinityNone,
+			annotation: "APP_COOKIE:session",
+			expected:   &openstackutil.SessionPersistence{Type: "APP_COOKIE", CookieName: "session"},
+		},
+		{
+			name:       "annotation without cookie name",
+			annotation: "APP_COOKIE:",
+			expectErr:  true,
+		},
+		{
+			name:       "invalid annotation",
+			annotation: "ROUND_ROBIN",
+			expectErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec:       corev1.ServiceSpec{SessionAffinity: test.affinity, SessionAffinityConfig: test.config},
+			}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerSessionPersistence] = test.annotation
+			}
+			persistence, err := getSessionPersistence(service)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, persistence)
+		})
+	}
+}
+
+func TestEnsurePoolSessionPersistence(t *testing.T) {
+	tests := []struct {
+		name               string
+		protocol           string
+		current            v2pools.SessionPersistence
+		currentRaw         string
+		sessionPersistence *openstackutil.SessionPersistence
+		expectedUpdate     string
+	}{
+		{
+			name:     "persistence stays disabled",
+			protocol: "TCP",
+		},
+		{
+			name:           "persistence is disabled",
+			protocol:       "TCP",
+			current:        v2pools.SessionPersistence{Type: "SOURCE_IP"},
+			expectedUpdate: `{"pool": {"session_persistence": null}}`,
+		},
+		{
+			name:               "persistence is enabled",
+			protocol:           "TCP",
+			sessionPersistence: &openstackutil.SessionPersistence{Type: "SOURCE_IP", PersistenceTimeout: 600},
+			expectedUpdate:     `{"pool": {"session_persistence": {"type": "SOURCE_IP"}}}`,
+		},
+		{
+			name:               "timeout is ignored for TCP pools",
+			protocol:           "TCP",
+			current:            v2pools.SessionPersistence{Type: "SOURCE_IP"},
+			sessionPersistence: &openstackutil.SessionPersistence{Type: "SOURCE_IP", PersistenceTimeout: 600},
+		},
+		{
+			name:               "timeout is set for UDP pools",
+			protocol:           "UDP",
+			current:            v2pools.SessionPersistence{Type: "SOURCE_IP"},
+			currentRaw:         `{"type": "SOURCE_IP", "persistence_timeout": 360}`,
+			sessionPersistence: &openstackutil.SessionPersistence{Type: "SOURCE_IP", PersistenceTimeout: 600},
+			expectedUpdate:     `{"pool": {"session_persistence": {"type": "SOURCE_IP", "persistence_timeout": 600}}}`,
+		},
+		{
+			name:               "timeout is up to date",
+			protocol:           "UDP",
+			current:            v2pools.SessionPersistence{Type: "SOURCE_IP"},
+			currentRaw:         `{"type": "SOURCE_IP", "persistence_timeout": 600}`,
+			sessionPersistence: &openstackutil.SessionPersistence{Type: "SOURCE_IP", PersistenceTimeout: 600},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			updated := false
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools/pool-id", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					fmt.Fprintf(w, `{"pool": {"id": "pool-id", "session_persistence": %s}}`, test.currentRaw)
+				case http.MethodPut:
+					th.TestJSONRequest(t, r, test.expectedUpdate)
+					updated = true
+					fmt.Fprint(w, `{"pool": {"id": "pool-id"}}`)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			svcConf := &serviceConfig{sessionPersistence: test.sessionPersistence}
+			pool := &v2pools.Pool{ID: "pool-id", Protocol: test.protocol, Persistence: test.current}
+
+			err := lbaas.ensurePoolSessionPersistence("lb-id", pool, svcConf)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedUpdate != "", updated)
+		})
+	}
+}
+
+func TestGetVipQosPolicyID(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		expected   string
+		expectErr  bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:       "existing policy",
+			annotation: "policy-id",
+			expected:   "policy-id",
+		},
+		{
+			name:       "missing policy",
+			annotation: "missing-policy-id",
+			expectErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			th.Mux.HandleFunc("/qos/policies/policy-id", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodGet)
+				fmt.Fprint(w, `{"policy": {"id": "policy-id"}}`)
+			})
+			th.Mux.HandleFunc("/qos/policies/missing-policy-id", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerVipQosPolicyID] = test.annotation
+			}
+			lbaas := &LbaasV2{LoadBalancer{network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+
+			policyID, err := lbaas.getQosPolicyID(service, ServiceAnnotationLoadBalancerVipQosPolicyID)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, policyID)
+		})
+	}
+}
+
+func TestParseHostRoutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  []subnets.HostRoute
+		expectErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "routes",
+			value: "10.1.0.0/16 via 192.168.0.1, 10.2.3.4/16 via 192.168.0.2,,10.1.0.0/16 via 192.168.0.1",
+			expected: []subnets.HostRoute{
+				{DestinationCIDR: "10.1.0.0/16", NextHop: "192.168.0.1"},
+				{DestinationCIDR: "10.2.0.0/16", NextHop: "192.168.0.2"},
+			},
+		},
+		{
+			name:     "IPv6",
+			value:    "fd00:1::/64 via fd00::1",
+			expected: []subnets.HostRoute{{DestinationCIDR: "fd00:1::/64", NextHop: "fd00::1"}},
+		},
+		{
+			name:      "invalid format",
+			value:     "10.1.0.0/16 192.168.0.1",
+			expectErr: `route "10.1.0.0/16 192.168.0.1" isn't in the "<destination CIDR> via <nexthop IP>" format`,
+		},
+		{
+			name:      "invalid destination",
+			value:     "10.1.0.0 via 192.168.0.1",
+			expectErr: `invalid destination of route "10.1.0.0 via 192.168.0.1"`,
+		},
+		{
+			name:      "invalid nexthop",
+			value:     "10.1.0.0/16 via gateway",
+			expectErr: `invalid nexthop of route "10.1.0.0/16 via gateway"`,
+		},
+		{
+			name:      "mixed IP families",
+			value:     "10.1.0.0/16 via fd00::1",
+			expectErr: "aren't of the same IP family",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routes, err := parseHostRoutes(test.value)
+			if test.expectErr != "" {
+				assert.ErrorContains(t, err, test.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, routes)
+		})
+	}
+}
+
+func TestEnsureMemberSubnetHostRoutes(t *testing.T) {
+	tests := []struct {
+		name           string
+		hostRoutes     string
+		expectedUpdate string
+	}{
+		{
+			name: "no routes configured",
+		},
+		{
+			name:       "routes already set",
+			hostRoutes: "10.1.0.0/16 via 192.168.0.1",
+		},
+		{
+			name:           "missing routes",
+			hostRoutes:     "10.1.0.0/16 via 192.168.0.1, 10.2.0.0/16 via 192.168.0.2",
+			expectedUpdate: `{"subnet": {"host_routes": [{"destination": "10.1.0.0/16", "nexthop": "192.168.0.1"}, {"destination": "10.2.0.0/16", "nexthop": "192.168.0.2"}]}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			updated := false
+			th.Mux.HandleFunc("/subnets/subnet-id", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					fmt.Fprint(w, `{"subnet": {"id": "subnet-id", "host_routes": [{"destination": "10.1.0.0/16", "nexthop": "192.168.0.1"}]}}`)
+				case http.MethodPut:
+					th.TestJSONRequest(t, r, test.expectedUpdate)
+					updated = true
+					fmt.Fprint(w, `{"subnet": {"id": "subnet-id"}}`)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts:    LoadBalancerOpts{MemberSubnetHostRoutes: test.hostRoutes},
+			}}
+
+			assert.NoError(t, lbaas.ensureMemberSubnetHostRoutes("subnet-id"))
+			assert.Equal(t, test.expectedUpdate != "", updated)
+		})
+	}
+}
+
+func TestGetVIPAllowedAddressPairs(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		expectedPairs *[]neutronports.AddressPair
+		expectedError string
+	}{
+		{
+			name: "annotation not set",
+		},
+		{
+			name:          "empty annotation",
+			annotations:   map[string]string{ServiceAnnotationLoadBalancerVIPAllowedAddressPairs: ""},
+			expectedPairs: &[]neutronports.AddressPair{},
+		},
+		{
+			name:        "addresses and CIDRs",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerVIPAllowedAddressPairs: "10.0.0.10, 10.0.1.5/24,2001:db8::1,10.0.0.11/32,10.0.0.10"},
+			expectedPairs: &[]neutronports.AddressPair{
+				{IPAddress: "10.0.0.10"},
+				{IPAddress: "10.0.1.0/24"},
+				{IPAddress: "2001:db8::1"},
+				{IPAddress: "10.0.0.11"},
+			},
+		},
+		{
+			name:          "invalid address",
+			annotations:   map[string]string{ServiceAnnotationLoadBalancerVIPAllowedAddressPairs: "10.0.0.300"},
+			expectedError: `invalid value of annotation loadbalancer.openstack.org/vip-allowed-address-pairs: "10.0.0.300" is neither an IP address nor a CIDR`,
+		},
+		{
+			name:          "CIDR matching any address",
+			annotations:   map[string]string{ServiceAnnotationLoadBalancerVIPAllowedAddressPairs: "10.0.0.10,::/0"},
+			expectedError: `invalid value of annotation loadbalancer.openstack.org/vip-allowed-address-pairs: CIDR "::/0" matches any address`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			pairs, err := getVIPAllowedAddressPairs(service)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedPairs, pairs)
+		})
+	}
+}
+
+func TestEnsureVIPAllowedAddressPairs(t *testing.T) {
+	tests := []struct {
+		name           string
+		pairs          *[]neutronports.AddressPair
+		expectedUpdate string
+	}{
+		{
+			name: "annotation not set",
+		},
+		{
+			name:  "pairs already set",
+			pairs: &[]neutronports.AddressPair{{IPAddress: "10.0.1.0/24"}, {IPAddress: "10.0.0.10"}},
+		},
+		{
+			name:           "missing pair",
+			pairs:          &[]neutronports.AddressPair{{IPAddress: "10.0.0.10"}, {IPAddress: "10.0.0.11"}, {IPAddress: "10.0.1.0/24"}},
+			expectedUpdate: `{"port": {"allowed_address_pairs": [{"ip_address": "10.0.0.10"}, {"ip_address": "10.0.0.11"}, {"ip_address": "10.0.1.0/24"}]}}`,
+		},
+		{
+			name:           "pairs removed",
+			pairs:          &[]neutronports.AddressPair{},
+			expectedUpdate: `{"port": {"allowed_address_pairs": []}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			updated := false
+			th.Mux.HandleFunc("/ports/port-id", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					fmt.Fprint(w, `{"port": {"id": "port-id", "allowed_address_pairs": [{"ip_address": "10.0.0.10/32", "mac_address": "fa:16:3e:00:00:01"}, {"ip_address": "10.0.1.0/24", "mac_address": "fa:16:3e:00:00:01"}]}}`)
+				case http.MethodPut:
+					th.TestJSONRequest(t, r, test.expectedUpdate)
+					updated = true
+					fmt.Fprint(w, `{"port": {"id": "port-id"}}`)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+			}}
+
+			assert.NoError(t, lbaas.ensureVIPAllowedAddressPairs("port-id", &serviceConfig{vipAllowedAddressPairs: test.pairs}))
+			assert.Equal(t, test.expectedUpdate != "", updated)
+		})
+	}
+}
+
+func TestGetL7Routes(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
+		{Name: "api", Port: 8080, Protocol: corev1.ProtocolTCP},
+		{Name: "static", Port: 8081, Protocol: corev1.ProtocolTCP},
+		{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+	}
+	tests := []struct {
+		name           string
+		annotation     string
+		svcConf        *serviceConfig
+		lbProvider     string
+		expectedRoutes []l7Route
+		expectedErr    string
+	}{
+		{
+			name:    "annotation not set",
+			svcConf: &serviceConfig{keepClientIP: true},
+		},
+		{
+			name:       "routes sorted from the longest path prefix",
+			annotation: "http:/api=api, http:/api/static=static",
+			svcConf:    &serviceConfig{keepClientIP: true},
+			expectedRoutes: []l7Route{
+				{listenerPort: "http", pathPrefix: "/api/static", backendPort: "static"},
+				{listenerPort: "http", pathPrefix: "/api", backendPort: "api"},
+			},
+		},
+		{
+			name:           "terminated HTTPS listener",
+			annotation:     "http:/api=api",
+			svcConf:        &serviceConfig{tlsContainerRef: "tls-container-ref"},
+			expectedRoutes: []l7Route{{listenerPort: "http", pathPrefix: "/api", backendPort: "api"}},
+		},
+		{
+			name:        "TCP listener",
+			annotation:  "http:/api=api",
+			svcConf:     &serviceConfig{},
+			expectedErr: "uses the TCP protocol",
+		},
+		{
+			name:        "ovn provider",
+			annotation:  "http:/api=api",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			lbProvider:  "ovn",
+			expectedErr: "not supported by the ovn provider",
+		},
+		{
+			name:        "invalid format",
+			annotation:  "http/api=api",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			expectedErr: "expected <port name>:<path prefix>=<port name>",
+		},
+		{
+			name:        "path prefix not absolute",
+			annotation:  "http:api=api",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			expectedErr: "must start with /",
+		},
+		{
+			name:        "unknown port",
+			annotation:  "http:/api=grpc",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			expectedErr: `port "grpc" referenced by annotation`,
+		},
+		{
+			name:        "UDP backend port",
+			annotation:  "http:/dns=dns",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			expectedErr: "must use the TCP protocol",
+		},
+		{
+			name:        "path prefix routed twice",
+			annotation:  "http:/api=api,http:/api=static",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			expectedErr: "routed twice",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec:       corev1.ServiceSpec{Ports: ports},
+			}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerL7PathRoutes] = test.annotation
+			}
+
+			routes, err := getL7Routes(service, test.svcConf, test.lbProvider)
+			if test.expectedErr != "" {
+				assert.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRoutes, routes)
+		})
+	}
+}
+
+func TestEnsureOctaviaL7Policies(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	policyName := "l7policy_0_kube_service_kubernetes_default_web"
+	var deleted, created []string
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+	})
+	th.Mux.HandleFunc("/lbaas/l7policies", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			th.TestFormValues(t, r, map[string]string{"listener_id": "listener-id"})
+			fmt.Fprintf(w, `{"l7policies": [
+				{"id": "policy-kept", "name": "%[1]s", "action": "REDIRECT_TO_POOL", "redirect_pool_id": "pool-api"},
+				{"id": "policy-stale", "name": "%[1]s", "action": "REDIRECT_TO_POOL", "redirect_pool_id": "pool-api"},
+				{"id": "policy-foreign", "name": "custom", "action": "REDIRECT_TO_POOL", "redirect_pool_id": "pool-foreign"}
+			]}`, policyName)
+		case http.MethodPost:
+			th.TestJSONRequest(t, r, fmt.Sprintf(`{"l7policy": {"name": "%s", "listener_id": "listener-id", "action": "REDIRECT_TO_POOL", "position": 1, "redirect_pool_id": "pool-static", "rules": [{"type": "PATH", "compare_type": "STARTS_WITH", "value": "/api/static"}]}}`, policyName))
+			created = append(created, "/api/static")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"l7policy": {"id": "policy-created"}}`)
+		}
+	})
+	th.Mux.HandleFunc("/lbaas/l7policies/", func(w http.ResponseWriter, r *http.Request) {
+		id, rules := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/lbaas/l7policies/"), "/rules")
+		w.Header().Add("Content-Type", "application/json")
+		switch {
+		case rules && id == "policy-kept":
+			fmt.Fprint(w, `{"rules": [{"id": "rule-kept", "type": "PATH", "compare_type": "STARTS_WITH", "value": "/api"}]}`)
+		case rules && id == "policy-stale":
+			fmt.Fprint(w, `{"rules": [{"id": "rule-stale", "type": "PATH", "compare_type": "STARTS_WITH", "value": "/old"}]}`)
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+	listener := &listeners.Listener{ID: "listener-id", L7Policies: []l7policies.L7Policy{{ID: "policy-kept"}, {ID: "policy-stale"}, {ID: "policy-foreign"}}}
+	routes := []l7Route{
+		{listenerPort: "http", pathPrefix: "/api/static", backendPort: "static"},
+		{listenerPort: "http", pathPrefix: "/api", backendPort: "api"},
+	}
+	l7Pools := map[string]*v2pools.Pool{"api": {ID: "pool-api"}, "static": {ID: "pool-static"}}
+
+	referenced, err := lbaas.ensureOctaviaL7Policies("lb-id", policyName, listener, routes, l7Pools)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"policy-stale"}, deleted)
+	assert.Equal(t, []string{"/api/static"}, created)
+	// The pools of the policies created by others are still in use
+	assert.Equal(t, sets.New("pool-api", "pool-static", "pool-foreign"), referenced)
+}
+
+func TestGetRejectClientXForwardedFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotation  string
+		svcConf     *serviceConfig
+		lbProvider  string
+		expected    bool
+		expectedErr string
+	}{
+		{
+			name:    "annotation not set",
+			svcConf: &serviceConfig{},
+		},
+		{
+			name:       "append",
+			annotation: "append",
+			svcConf:    &serviceConfig{keepClientIP: true},
+		},
+		{
+			name:       "reject",
+			annotation: "reject",
+			svcConf:    &serviceConfig{keepClientIP: true},
+			expected:   true,
+		},
+		{
+			name:        "reject without x-forwarded-for",
+			annotation:  "reject",
+			svcConf:     &serviceConfig{tlsContainerRef: "tls-container-ref"},
+			expectedErr: "requires annotation " + ServiceAnnotationLoadBalancerXForwardedFor,
+		},
+		{
+			name:        "ovn provider",
+			annotation:  "reject",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			lbProvider:  "ovn",
+			expectedErr: "not supported by the ovn provider",
+		},
+		{
+			name:        "invalid value",
+			annotation:  "replace",
+			svcConf:     &serviceConfig{keepClientIP: true},
+			expectedErr: `invalid value "replace"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerXForwardedForClientHeader] = test.annotation
+			}
+
+			reject, err := getRejectClientXForwardedFor(service, test.svcConf, test.lbProvider)
+			if test.expectedErr != "" {
+				assert.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, reject)
+		})
+	}
+}
+
+func TestEnsureOctaviaXFFPolicy(t *testing.T) {
+	policyName := "l7policy_xff_0_kube_service_kubernetes_default_web"
+	tests := []struct {
+		name            string
+		reject          bool
+		policies        string
+		expectedDeleted []string
+		expectedCreated bool
+	}{
+		{
+			name:            "policy created",
+			reject:          true,
+			policies:        `{"id": "policy-route", "name": "l7policy_0_kube_service_kubernetes_default_web", "action": "REDIRECT_TO_POOL"}`,
+			expectedCreated: true,
+		},
+		{
+			name:     "policy kept",
+			reject:   true,
+			policies: fmt.Sprintf(`{"id": "policy-kept", "name": "%s", "action": "REJECT"}`, policyName),
+		},
+		{
+			name:   "policy drifted",
+			reject: true,
+			policies: fmt.Sprintf(`{"id": "policy-kept", "name": "%[1]s", "action": "REJECT"},
+				{"id": "policy-drifted", "name": "%[1]s", "action": "REJECT"}`, policyName),
+			expectedDeleted: []string{"policy-drifted"},
+		},
+		{
+			name:            "policy deleted",
+			policies:        fmt.Sprintf(`{"id": "policy-kept", "name": "%s", "action": "REJECT"}`, policyName),
+			expectedDeleted: []string{"policy-kept"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var deleted []string
+			created := false
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/l7policies", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				switch r.Method {
+				case http.MethodGet:
+					th.TestFormValues(t, r, map[string]string{"listener_id": "listener-id"})
+					fmt.Fprintf(w, `{"l7policies": [%s]}`, test.policies)
+				case http.MethodPost:
+					th.TestJSONRequest(t, r, fmt.Sprintf(`{"l7policy": {"name": "%s", "listener_id": "listener-id", "action": "REJECT", "position": 1, "rules": [{"type": "HEADER", "compare_type": "REGEX", "key": "X-Forwarded-For", "value": ".*"}]}}`, policyName))
+					created = true
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{"l7policy": {"id": "policy-created"}}`)
+				}
+			})
+			th.Mux.HandleFunc("/lbaas/l7policies/", func(w http.ResponseWriter, r *http.Request) {
+				id, rules := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/lbaas/l7policies/"), "/rules")
+				w.Header().Add("Content-Type", "application/json")
+				switch {
+				case rules && id == "policy-kept":
+					fmt.Fprint(w, `{"rules": [{"id": "rule-kept", "type": "HEADER", "compare_type": "REGEX", "key": "X-Forwarded-For", "value": ".*"}]}`)
+				case rules && id == "policy-drifted":
+					fmt.Fprint(w, `{"rules": [{"id": "rule-drifted", "type": "HEADER", "compare_type": "EQUAL_TO", "key": "X-Forwarded-For", "value": "10.0.0.1"}]}`)
+				case r.Method == http.MethodDelete:
+					deleted = append(deleted, id)
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			listener := &listeners.Listener{ID: "listener-id", L7Policies: []l7policies.L7Policy{{ID: "policy"}}}
+
+			err := lbaas.ensureOctaviaXFFPolicy("lb-id", policyName, listener, test.reject)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedDeleted, deleted)
+			assert.Equal(t, test.expectedCreated, created)
+		})
+	}
+}
+
+func TestEnsureFloatingIPExternalVipNetwork(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/networks/provider-net-id", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"network": {"id": "provider-net-id", "router:external": true}}`)
+	})
+	th.Mux.HandleFunc("/floatingips", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for floating IPs: %s %s", r.Method, r.URL)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	lb := &loadbalancers.LoadBalancer{ID: "lb-id", VipNetworkID: "provider-net-id", VipAddress: "203.0.113.10", VipPortID: "port-id"}
+
+	addr, err := lbaas.ensureFloatingIP(context.TODO(), "kubernetes", service, lb, &serviceConfig{lbPublicNetworkID: "public-net-id"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "203.0.113.10", addr)
+}
+
+func TestGetLoadBalancerIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotation     string
+		loadBalancerIP string
+		expected       string
+	}{
+		{
+			name: "nothing requested",
+		},
+		{
+			name:           "spec",
+			loadBalancerIP: "172.24.4.10",
+			expected:       "172.24.4.10",
+		},
+		{
+			name:           "annotation takes precedence",
+			annotation:     "172.24.4.20",
+			loadBalancerIP: "172.24.4.10",
+			expected:       "172.24.4.20",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec:       corev1.ServiceSpec{LoadBalancerIP: test.loadBalancerIP},
+			}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerVIPAddress] = test.annotation
+			}
+			assert.Equal(t, test.expected, getLoadBalancerIP(service))
+		})
+	}
+}
+
+func TestGetAvailableFloatingIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		fips      []floatingips.FloatingIP
+		networkID string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "no floating IP",
+		},
+		{
+			name:      "unassigned floating IP",
+			fips:      []floatingips.FloatingIP{{ID: "fip-id", FloatingIP: "172.24.4.10", FloatingNetworkID: "public-net-id"}},
+			networkID: "public-net-id",
+			expected:  "fip-id",
+		},
+		{
+			name:     "no floating network configured",
+			fips:     []floatingips.FloatingIP{{ID: "fip-id", FloatingIP: "172.24.4.10", FloatingNetworkID: "other-net-id"}},
+			expected: "fip-id",
+		},
+		{
+			name:      "other address",
+			fips:      []floatingips.FloatingIP{{ID: "fip-id", FloatingIP: "172.24.4.11", FloatingNetworkID: "public-net-id"}},
+			networkID: "public-net-id",
+		},
+		{
+			name:      "associated floating IP",
+			fips:      []floatingips.FloatingIP{{ID: "fip-id", FloatingIP: "172.24.4.10", FloatingNetworkID: "public-net-id", PortID: "other-port-id"}},
+			networkID: "public-net-id",
+			expectErr: true,
+		},
+		{
+			name:      "floating IP on another network",
+			fips:      []floatingips.FloatingIP{{ID: "fip-id", FloatingIP: "172.24.4.10", FloatingNetworkID: "other-net-id"}},
+			networkID: "public-net-id",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fip, err := getAvailableFloatingIP(test.fips, "172.24.4.10", test.networkID)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if test.expected == "" {
+				assert.Nil(t, fip)
+				return
+			}
+			assert.Equal(t, test.expected, fip.ID)
+		})
+	}
+}
+
+func TestGetExternalTrafficPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultPolicy string
+		policy        corev1.ServiceExternalTrafficPolicy
+		expected      corev1.ServiceExternalTrafficPolicy
+	}{
+		{
+			name:     "unset",
+			expected: corev1.ServiceExternalTrafficPolicyCluster,
+		},
+		{
+			name:          "default applies",
+			defaultPolicy: "Local",
+			expected:      corev1.ServiceExternalTrafficPolicyLocal,
+		},
+		{
+			name:          "Service takes precedence",
+			defaultPolicy: "Local",
+			policy:        corev1.ServiceExternalTrafficPolicyCluster,
+			expected:      corev1.ServiceExternalTrafficPolicyCluster,
+		},
+		{
+			name:          "Service Local",
+			defaultPolicy: "Cluster",
+			policy:        corev1.ServiceExternalTrafficPolicyLocal,
+			expected:      corev1.ServiceExternalTrafficPolicyLocal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{DefaultExternalTrafficPolicy: test.defaultPolicy}}}
+			service := &corev1.Service{Spec: corev1.ServiceSpec{ExternalTrafficPolicy: test.policy}}
+			assert.Equal(t, test.expected, lbaas.getExternalTrafficPolicy(service))
+		})
+	}
+}
+
+func TestGetLoadBalancerIPClaims(t *testing.T) {
+	older := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	newer := metav1.NewTime(older.Add(time.Hour))
+	newService := func(namespace, name string, created metav1.Time, address string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: created},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerIP: address},
+		}
+	}
+
+	newest := newService("default", "newest", newer, "172.24.4.10")
+	oldest := newService("default", "oldest", older, "172.24.4.10")
+	sameAgeB := newService("team-b", "web", newer, "172.24.4.10")
+	sameAgeA := newService("team-a", "web", newer, "172.24.4.10")
+	annotated := newService("default", "annotated", older, "172.24.4.99")
+	annotated.Annotations = map[string]string{ServiceAnnotationLoadBalancerVIPAddress: "172.24.4.10"}
+	other := newService("default", "other", older, "172.24.4.11")
+	clusterIP := newService("default", "cluster-ip", older, "172.24.4.10")
+	clusterIP.Spec.Type = corev1.ServiceTypeClusterIP
+	deleted := newService("default", "deleted", older, "172.24.4.10")
+	deleted.DeletionTimestamp = &older
+
+	services := []*corev1.Service{newest, sameAgeB, other, clusterIP, oldest, deleted, sameAgeA, annotated}
+	// The oldest Service gets the address, whatever order they're listed in, the names break the ties.
+	assert.Equal(t, []*corev1.Service{annotated, oldest, newest, sameAgeA, sameAgeB}, getLoadBalancerIPClaims(services, "172.24.4.10"))
+	assert.Equal(t, []*corev1.Service{other}, getLoadBalancerIPClaims(services, "172.24.4.11"))
+	assert.Empty(t, getLoadBalancerIPClaims(services, "172.24.4.12"))
+}
+
+func TestReclaimFloatingIP(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	detached := false
+	th.Mux.HandleFunc("/floatingips/fip-younger", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPut)
+		th.TestJSONRequest(t, r, `{"floatingip": {"port_id": null}}`)
+		detached = true
+		fmt.Fprint(w, `{"floatingip": {"id": "fip-younger", "floating_ip_address": "172.24.4.10", "tags": ["kube_service_owner=default/younger"]}}`)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+	younger := sets.New("default/younger")
+
+	// The floating IPs of the Services not requesting the address after this one are left alone.
+	for _, fip := range []floatingips.FloatingIP{
+		{ID: "fip-untagged", FloatingIP: "172.24.4.10", PortID: "port-untagged"},
+		{ID: "fip-older", FloatingIP: "172.24.4.10", PortID: "port-older", Tags: []string{"kube_service_owner=default/older"}},
+		{ID: "fip-other", FloatingIP: "172.24.4.11", PortID: "port-other", Tags: []string{"kube_service_owner=default/younger"}},
+	} {
+		fips := []floatingips.FloatingIP{fip}
+		assert.NoError(t, lbaas.reclaimFloatingIP(fips, "172.24.4.10", younger))
+		assert.Equal(t, fip, fips[0])
+	}
+
+	fips := []floatingips.FloatingIP{{ID: "fip-younger", FloatingIP: "172.24.4.10", PortID: "port-younger", Tags: []string{"kube_service_owner=default/younger"}}}
+	assert.NoError(t, lbaas.reclaimFloatingIP(fips, "172.24.4.10", younger))
+	assert.True(t, detached)
+	assert.Empty(t, fips[0].PortID)
+
+	fip, err := getAvailableFloatingIP(fips, "172.24.4.10", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "fip-younger", fip.ID)
+}
+
+func TestCheckLoadBalancerIPConflictDisabled(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	// Nothing is listed when conflicts are ignored, or without a Kubernetes client.
+	lbaas := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{LoadBalancerIPConflicts: lbIPConflictsIgnore}}}
+	younger, err := lbaas.checkLoadBalancerIPConflict(context.TODO(), service, "172.24.4.10")
+	assert.NoError(t, err)
+	assert.Empty(t, younger)
+
+	lbaas = &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{LoadBalancerIPConflicts: lbIPConflictsOldestWins}}}
+	younger, err = lbaas.checkLoadBalancerIPConflict(context.TODO(), service, "172.24.4.10")
+	assert.NoError(t, err)
+	assert.Empty(t, younger)
+}
+
+func TestEnsureFloatingIPExisting(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/floatingips", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		w.Header().Add("Content-Type", "application/json")
+		if r.URL.Query().Get("floating_ip_address") == "172.24.4.10" {
+			fmt.Fprint(w, `{"floatingips": [{"id": "fip-id", "floating_ip_address": "172.24.4.10", "floating_network_id": "public-net-id"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"floatingips": []}`)
+	})
+	th.Mux.HandleFunc("/floatingips/fip-id", func(w http.ResponseWriter, r *http.Request) {
+		// The QoS policy of the floating IP is checked, it has none.
+		if r.Method == http.MethodPut {
+			th.TestJSONRequest(t, r, `{"floatingip": {"port_id": "port-id"}}`)
+		}
+		fmt.Fprint(w, `{"floatingip": {"id": "fip-id", "floating_ip_address": "172.24.4.10", "floating_network_id": "public-net-id", "port_id": "port-id"}}`)
+	})
+	tagged := false
+	th.Mux.HandleFunc("/floatingips/fip-id/tags", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPut)
+		th.TestJSONRequest(t, r, `{"tags": ["kube_service_name=web", "kube_service_namespace=default"]}`)
+		tagged = true
+		fmt.Fprint(w, `{"tags": ["kube_service_name=web", "kube_service_namespace=default"]}`)
+	})
+
+	recorder := record.NewFakeRecorder(10)
+	lbaas := &LbaasV2{LoadBalancer{
+		network:       &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		opts:          LoadBalancerOpts{FloatingIPTags: true},
+		eventRecorder: recorder,
+	}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "web",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerVIPAddress: "172.24.4.10"},
+	}}
+	lb := &loadbalancers.LoadBalancer{ID: "lb-id", VipAddress: "10.0.0.10", VipPortID: "port-id"}
+
+	addr, err := lbaas.ensureFloatingIP(context.TODO(), "kubernetes", service, lb, &serviceConfig{lbPublicNetworkID: "public-net-id"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.24.4.10", addr)
+	assert.True(t, tagged)
+	assert.Equal(t, "Normal LoadBalancerFloatingIPReused Reused existing floating IP 172.24.4.10 (fip-id) for load balancer lb-id", <-recorder.Events)
+}
+
+func TestEnsureFloatingIPAllocated(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	attached := false
+	th.Mux.HandleFunc("/floatingips", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			if attached {
+				fmt.Fprint(w, `{"floatingips": [{"id": "fip-id", "floating_ip_address": "172.24.4.20", "port_id": "port-id"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"floatingips": []}`)
+		case http.MethodPost:
+			attached = true
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"floatingip": {"id": "fip-id", "floating_ip_address": "172.24.4.20", "port_id": "port-id"}}`)
+		}
+	})
+	th.Mux.HandleFunc("/floatingips/fip-id", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"floatingip": {"id": "fip-id", "floating_ip_address": "172.24.4.20", "port_id": "port-id"}}`)
+	})
+
+	recorder := record.NewFakeRecorder(10)
+	lbaas := &LbaasV2{LoadBalancer{
+		network:       &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		eventRecorder: recorder,
+	}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	lb := &loadbalancers.LoadBalancer{ID: "lb-id", VipAddress: "10.0.0.10", VipPortID: "port-id"}
+
+	addr, err := lbaas.ensureFloatingIP(context.TODO(), "kubernetes", service, lb, &serviceConfig{lbPublicNetworkID: "public-net-id"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.24.4.20", addr)
+	assert.Equal(t, "Normal LoadBalancerFloatingIPAllocated Allocated new floating IP 172.24.4.20 (fip-id) for load balancer lb-id", <-recorder.Events)
+
+	// The floating IP stays attached on the next reconciles, there's no new event.
+	addr, err = lbaas.ensureFloatingIP(context.TODO(), "kubernetes", service, lb, &serviceConfig{lbPublicNetworkID: "public-net-id"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.24.4.20", addr)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestGetIngressHostname(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		expectErr   bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:        "DNS name",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerLoadbalancerHostname: "web.example.com"},
+			expected:    "web.example.com",
+		},
+		{
+			name:        "invalid DNS name",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerLoadbalancerHostname: "web_example.com"},
+			expectErr:   true,
+		},
+		{
+			name: "PTR record",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHostnameFromPTRRecord: "true",
+				ServiceAnnotationLoadBalancerFloatingIPPTRRecord:   "web.example.com.",
+			},
+			expected: "web.example.com",
+		},
+		{
+			name: "PTR record not requested",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerFloatingIPPTRRecord: "web.example.com",
+			},
+		},
+		{
+			name:        "no PTR record",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerHostnameFromPTRRecord: "true"},
+			expectErr:   true,
+		},
+		{
+			name: "PTR record and DNS name",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerHostnameFromPTRRecord: "true",
+				ServiceAnnotationLoadBalancerFloatingIPPTRRecord:   "web.example.com",
+				ServiceAnnotationLoadBalancerLoadbalancerHostname:  "api.example.com",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			hostname, err := getIngressHostname(service)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, hostname)
+		})
+	}
+}
+
+func TestGetHostnameIngress(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostname  string
+		includeIP bool
+		expected  []corev1.LoadBalancerIngress
+	}{
+		{
+			name:     "address only",
+			expected: []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}},
+		},
+		{
+			name:      "address only without hostname",
+			includeIP: true,
+			expected:  []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}},
+		},
+		{
+			name:     "hostname instead of the address",
+			hostname: "web.example.com",
+			expected: []corev1.LoadBalancerIngress{{Hostname: "web.example.com"}},
+		},
+		{
+			name:      "hostname and address",
+			hostname:  "web.example.com",
+			includeIP: true,
+			expected:  []corev1.LoadBalancerIngress{{IP: "172.24.4.10", Hostname: "web.example.com"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, getHostnameIngress(test.hostname, test.includeIP, "172.24.4.10"))
+		})
+	}
+}
+
+func TestCreateLoadBalancerStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		svcConf  serviceConfig
+		addr     string
+		expected []corev1.LoadBalancerIngress
+	}{
+		{
+			name:     "floating IP only",
+			addr:     "172.24.4.10",
+			expected: []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}},
+		},
+		{
+			name:     "floating IP and VIP",
+			svcConf:  serviceConfig{includeVIPAddress: true},
+			addr:     "172.24.4.10",
+			expected: []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}, {IP: "10.0.0.10"}},
+		},
+		{
+			name:     "VIP without floating IP reported once",
+			svcConf:  serviceConfig{includeVIPAddress: true},
+			addr:     "10.0.0.10",
+			expected: []corev1.LoadBalancerIngress{{IP: "10.0.0.10"}},
+		},
+		{
+			name:     "hostname and VIP",
+			svcConf:  serviceConfig{includeVIPAddress: true, ingressHostname: "web.example.com"},
+			addr:     "172.24.4.10",
+			expected: []corev1.LoadBalancerIngress{{Hostname: "web.example.com"}, {IP: "10.0.0.10"}},
+		},
+		{
+			name:    "PROXY protocol and VIP",
+			svcConf: serviceConfig{includeVIPAddress: true, enableProxyProtocol: true},
+			addr:    "172.24.4.10",
+			expected: []corev1.LoadBalancerIngress{
+				{Hostname: "172.24.4.10.nip.io"},
+				{Hostname: "10.0.0.10.nip.io"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{EnableIngressHostname: true, IngressHostnameSuffix: "nip.io"}}}
+			status := lbaas.createLoadBalancerStatus(&corev1.Service{}, &test.svcConf, test.addr, "10.0.0.10")
+			assert.Equal(t, test.expected, status.Ingress)
+		})
+	}
+}
+
+func TestSetSourceRanges(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	th.Mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v2.0", "status": "SUPPORTED"}, {"id": "v2.16", "status": "CURRENT"}]}`)
+	})
+	lb := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint(), Type: "load-balancer"}
+
+	tests := []struct {
+		name                string
+		octaviaVersion      string
+		opts                LoadBalancerOpts
+		ipFamily            corev1.IPFamily
+		sourceRanges        []string
+		expectedAllowedCIDR []string
+		expectedSGCIDRs     []string
+		expectedEvent       bool
+		expectErr           bool
+	}{
+		{
+			name:                "allowed_cidrs",
+			octaviaVersion:      "v2.16",
+			opts:                LoadBalancerOpts{LBProvider: "amphora", ManageSecurityGroups: true},
+			sourceRanges:        []string{"10.0.0.0/8"},
+			expectedAllowedCIDR: []string{"10.0.0.0/8"},
+			expectedSGCIDRs:     []string{"0.0.0.0/0"},
+		},
+		{
+			name:                "allowed_cidrs unavailable",
+			octaviaVersion:      "v2.10",
+			opts:                LoadBalancerOpts{LBProvider: "amphora"},
+			sourceRanges:        []string{"10.0.0.0/8"},
+			expectedAllowedCIDR: []string{},
+			expectedSGCIDRs:     []string{"0.0.0.0/0"},
+			expectedEvent:       true,
+		},
+		{
+			name:           "allowed_cidrs enforced but unavailable",
+			octaviaVersion: "v2.10",
+			opts:           LoadBalancerOpts{LBProvider: "amphora", SourceRangesEnforcement: sourceRangesEnforcementAllowedCIDRs},
+			sourceRanges:   []string{"10.0.0.0/8"},
+			expectedEvent:  true,
+			expectErr:      true,
+		},
+		{
+			name:                "allowed_cidrs enforced and unrestricted",
+			octaviaVersion:      "v2.10",
+			opts:                LoadBalancerOpts{LBProvider: "amphora", SourceRangesEnforcement: sourceRangesEnforcementAllowedCIDRs},
+			expectedAllowedCIDR: []string{},
+			expectedSGCIDRs:     []string{"0.0.0.0/0"},
+		},
+		{
+			name:                "security groups",
+			opts:                LoadBalancerOpts{LBProvider: "ovn", ManageSecurityGroups: true},
+			sourceRanges:        []string{"10.0.0.0/8", "192.168.0.0/16"},
+			expectedAllowedCIDR: []string{},
+			expectedSGCIDRs:     []string{"10.0.0.0/8", "192.168.0.0/16"},
+		},
+		{
+			name:                "security groups enforced",
+			opts:                LoadBalancerOpts{LBProvider: "ovn", ManageSecurityGroups: true, SourceRangesEnforcement: sourceRangesEnforcementSecurityGroups},
+			sourceRanges:        []string{"10.0.0.0/8"},
+			expectedAllowedCIDR: []string{},
+			expectedSGCIDRs:     []string{"10.0.0.0/8"},
+		},
+		{
+			name:                "security groups unmanaged",
+			opts:                LoadBalancerOpts{LBProvider: "ovn"},
+			sourceRanges:        []string{"10.0.0.0/8"},
+			expectedAllowedCIDR: []string{},
+			expectedSGCIDRs:     []string{"0.0.0.0/0"},
+			expectedEvent:       true,
+		},
+		{
+			name:                "unrestricted IPv6",
+			opts:                LoadBalancerOpts{LBProvider: "ovn"},
+			ipFamily:            corev1.IPv6Protocol,
+			expectedAllowedCIDR: []string{},
+			expectedSGCIDRs:     []string{"::/0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.octaviaVersion != "" {
+				_, err := openstackutil.NegotiateOctaviaVersion(lb, test.octaviaVersion)
+				assert.NoError(t, err)
+			}
+			recorder := record.NewFakeRecorder(10)
+			lbaas := &LbaasV2{LoadBalancer{lb: lb, opts: test.opts, eventRecorder: recorder}}
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+				Spec:       corev1.ServiceSpec{LoadBalancerSourceRanges: test.sourceRanges},
+			}
+			svcConf := &serviceConfig{preferredIPFamily: test.ipFamily}
+
+			err := lbaas.setSourceRanges(service, svcConf)
+			assert.Equal(t, test.expectedEvent, len(recorder.Events) == 1)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			sort.Strings(svcConf.allowedCIDR)
+			assert.Equal(t, test.expectedAllowedCIDR, svcConf.allowedCIDR)
+			sort.Strings(svcConf.securityGroupCIDRs)
+			assert.Equal(t, test.expectedSGCIDRs, svcConf.securityGroupCIDRs)
+		})
+	}
+}
+
+func newTestEndpointSlice(serviceName string, ready ...*bool) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      serviceName + "-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: serviceName},
+		},
+	}
+	for _, r := range ready {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Conditions: discoveryv1.EndpointConditions{Ready: r}})
+	}
+	return slice
+}
+
+func newTestIndexer(objs ...interface{}) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objs {
+		_ = indexer.Add(obj)
+	}
+	return indexer
+}
+
+func TestGetProfileAnnotations(t *testing.T) {
+	profiles := map[string]*LBProfile{
+		"a-internal": {
+			NamespaceSelector: "team in (backend, data)",
+			Annotation: []string{
+				"service.beta.kubernetes.io/openstack-internal-load-balancer=true",
+				"loadbalancer.openstack.org/flavor-id=small",
+			},
+		},
+		"b-data": {
+			NamespaceSelector: "team=data",
+			Annotation:        []string{"loadbalancer.openstack.org/flavor-id=large"},
+		},
+		"c-all": {Annotation: []string{"loadbalancer.openstack.org/enable-health-monitor=true"}},
+	}
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "no matching selector",
+			labels:   map[string]string{"team": "frontend"},
+			expected: map[string]string{"loadbalancer.openstack.org/enable-health-monitor": "true"},
+		},
+		{
+			name:   "matching selector",
+			labels: map[string]string{"team": "backend"},
+			expected: map[string]string{
+				"service.beta.kubernetes.io/openstack-internal-load-balancer": "true",
+				"loadbalancer.openstack.org/flavor-id":                        "small",
+				"loadbalancer.openstack.org/enable-health-monitor":            "true",
+			},
+		},
+		{
+			name:   "later profile overrides",
+			labels: map[string]string{"team": "data"},
+			expected: map[string]string{
+				"service.beta.kubernetes.io/openstack-internal-load-balancer": "true",
+				"loadbalancer.openstack.org/flavor-id":                        "large",
+				"loadbalancer.openstack.org/enable-health-monitor":            "true",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, getProfileAnnotations(profiles, test.labels))
+		})
+	}
+}
+
+func TestWithDefaultAnnotations(t *testing.T) {
+	defaults := map[string]string{
+		ServiceAnnotationLoadBalancerInternal: "true",
+		ServiceAnnotationLoadBalancerFlavorID: "small",
+	}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	merged := withDefaultAnnotations(service, defaults)
+	assert.Equal(t, defaults, merged.Annotations)
+	assert.Nil(t, service.Annotations, "the Service must not be modified")
+
+	service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "web",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "false"},
+	}}
+	merged = withDefaultAnnotations(service, defaults)
+	assert.Equal(t, map[string]string{ServiceAnnotationLoadBalancerInternal: "false", ServiceAnnotationLoadBalancerFlavorID: "small"}, merged.Annotations)
+	assert.Equal(t, map[string]string{ServiceAnnotationLoadBalancerInternal: "false"}, service.Annotations)
+
+	service.Annotations[ServiceAnnotationLoadBalancerFlavorID] = "large"
+	assert.Same(t, service, withDefaultAnnotations(service, defaults))
+}
+
+func TestApplyServiceDefaults(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "backend", Labels: map[string]string{"team": "backend"}}}
+	lbaas := &LbaasV2{LoadBalancer{
+		opts: LoadBalancerOpts{LBProfiles: map[string]*LBProfile{
+			"internal": {NamespaceSelector: "team=backend", Annotation: []string{ServiceAnnotationLoadBalancerInternal + "=true"}},
+		}},
+		namespaces: corelisters.NewNamespaceLister(newTestIndexer(namespace)),
+	}}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "backend", Name: "web"}}
+	merged, err := lbaas.applyServiceDefaults(service)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{ServiceAnnotationLoadBalancerInternal: "true"}, merged.Annotations)
+
+	_, err = lbaas.applyServiceDefaults(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "missing", Name: "web"}})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestApplyServiceDefaultsSelectedProfile(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "backend", Labels: map[string]string{"team": "backend"}}}
+	lbaas := &LbaasV2{LoadBalancer{
+		opts: LoadBalancerOpts{LBProfiles: map[string]*LBProfile{
+			"backend": {NamespaceSelector: "team=backend", Annotation: []string{
+				ServiceAnnotationLoadBalancerInternal + "=true",
+				ServiceAnnotationLoadBalancerFlavorID + "=small",
+			}},
+			"large": {Explicit: true, Annotation: []string{ServiceAnnotationLoadBalancerFlavorID + "=large"}},
+			"tls": {Explicit: true, Annotation: []string{
+				ServiceAnnotationLoadBalancerFlavorID + "=tls",
+				ServiceAnnotationTlsContainerRef + "=container",
+			}},
+		}},
+		namespaces: corelisters.NewNamespaceLister(newTestIndexer(namespace)),
+	}}
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "backend", Name: "web", Annotations: annotations}}
+	}
+
+	// The explicit profiles only apply to the Services selecting them.
+	merged, err := lbaas.applyServiceDefaults(newService(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{ServiceAnnotationLoadBalancerInternal: "true", ServiceAnnotationLoadBalancerFlavorID: "small"}, merged.Annotations)
+
+	// The selected profile overrides the ones of the namespace, the annotations of the Service override both.
+	merged, err = lbaas.applyServiceDefaults(newService(map[string]string{
+		ServiceAnnotationLoadBalancerProfile: "tls",
+		ServiceAnnotationTlsContainerRef:     "own-container",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		ServiceAnnotationLoadBalancerProfile:  "tls",
+		ServiceAnnotationLoadBalancerInternal: "true",
+		ServiceAnnotationLoadBalancerFlavorID: "tls",
+		ServiceAnnotationTlsContainerRef:      "own-container",
+	}, merged.Annotations)
+
+	// A profile of the namespace can select another profile.
+	lbaas.opts.LBProfiles["backend"].Annotation = append(lbaas.opts.LBProfiles["backend"].Annotation, ServiceAnnotationLoadBalancerProfile+"=large")
+	merged, err = lbaas.applyServiceDefaults(newService(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "large", merged.Annotations[ServiceAnnotationLoadBalancerFlavorID])
+
+	_, err = lbaas.applyServiceDefaults(newService(map[string]string{ServiceAnnotationLoadBalancerProfile: "missing"}))
+	assert.ErrorIs(t, err, errUnknownProfile)
+	assert.Equal(t, errorClassTerminal, classifyError(err))
+
+	// Without any profile configured, the selected one is still checked.
+	lbaas = &LbaasV2{LoadBalancer{}}
+	_, err = lbaas.applyServiceDefaults(newService(map[string]string{ServiceAnnotationLoadBalancerProfile: "tls"}))
+	assert.ErrorIs(t, err, errUnknownProfile)
+}
+
+func newTestBlueprint(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "loadbalancer.openstack.org/v1alpha1",
+		"kind":       "LBBlueprint",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}}
+}
+
+func TestApplyServiceDefaultsBlueprint(t *testing.T) {
+	blueprints := cache.NewGenericLister(newTestIndexer(
+		newTestBlueprint("web", map[string]interface{}{
+			"provider": "amphora",
+			"flavorID": "large",
+			"timeouts": map[string]interface{}{"clientData": int64(60000), "memberData": int64(60000)},
+			"healthMonitor": map[string]interface{}{
+				"enabled": true,
+				"delay":   int64(10),
+			},
+			"tls": map[string]interface{}{"containerRef": "container"},
+		}),
+		newTestBlueprint("ovn", map[string]interface{}{"provider": "ovn"}),
+	), blueprintGVR.GroupResource())
+	lbaas := &LbaasV2{LoadBalancer{
+		opts: LoadBalancerOpts{LBProvider: "amphora", LBProfiles: map[string]*LBProfile{
+			"small": {Explicit: true, Annotation: []string{
+				ServiceAnnotationLoadBalancerFlavorID + "=small",
+				ServiceAnnotationLoadBalancerInternal + "=true",
+			}},
+		}},
+		blueprints: &blueprintWatcher{lister: blueprints},
+	}}
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: annotations}}
+	}
+
+	// The blueprint overrides the selected profile, the annotations of the Service override both.
+	merged, err := lbaas.applyServiceDefaults(newService(map[string]string{
+		ServiceAnnotationLoadBalancerProfile:           "small",
+		ServiceAnnotationLoadBalancerBlueprint:         "web",
+		ServiceAnnotationLoadBalancerTimeoutMemberData: "120000",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		ServiceAnnotationLoadBalancerProfile:             "small",
+		ServiceAnnotationLoadBalancerBlueprint:           "web",
+		ServiceAnnotationLoadBalancerInternal:            "true",
+		ServiceAnnotationLoadBalancerFlavorID:            "large",
+		ServiceAnnotationLoadBalancerTimeoutClientData:   "60000",
+		ServiceAnnotationLoadBalancerTimeoutMemberData:   "120000",
+		ServiceAnnotationLoadBalancerEnableHealthMonitor: "true",
+		ServiceAnnotationLoadBalancerHealthMonitorDelay:  "10",
+		ServiceAnnotationTlsContainerRef:                 "container",
+	}, merged.Annotations)
+
+	// A blueprint created later is picked up by the retries.
+	_, err = lbaas.applyServiceDefaults(newService(map[string]string{ServiceAnnotationLoadBalancerBlueprint: "missing"}))
+	assert.ErrorIs(t, err, errUnknownBlueprint)
+	assert.Equal(t, errorClassTransient, classifyError(err))
+
+	_, err = lbaas.applyServiceDefaults(newService(map[string]string{ServiceAnnotationLoadBalancerBlueprint: "ovn"}))
+	assert.ErrorContains(t, err, "meant for the ovn provider")
+	assert.Equal(t, errorClassTerminal, classifyError(err))
+
+	// The blueprints aren't watched unless enable-blueprints is set.
+	lbaas = &LbaasV2{LoadBalancer{}}
+	_, err = lbaas.applyServiceDefaults(newService(map[string]string{ServiceAnnotationLoadBalancerBlueprint: "web"}))
+	assert.ErrorIs(t, err, errUnknownBlueprint)
+	assert.Equal(t, errorClassTerminal, classifyError(err))
+}
+
+func TestBlueprintWatcherResync(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}}
+	web := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	api := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api"}}
+
+	w := &blueprintWatcher{
+		queue:         workqueue.NewDelayingQueue(),
+		users:         make(map[types.NamespacedName]blueprintUser),
+		serviceLister: corelisters.NewServiceLister(newTestIndexer(web, api)),
+		nodeLister:    corelisters.NewNodeLister(newTestIndexer(node)),
+	}
+	resynced := make(chan string, 2)
+	w.setResync(func(_ context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node) error {
+		assert.Equal(t, "kubernetes", clusterName)
+		assert.Len(t, nodes, 1)
+		resynced <- svc.Name
+		return nil
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go w.run(stopCh)
+
+	w.track(web, "kubernetes", "large")
+	w.track(api, "kubernetes", "small")
+	large := newTestBlueprint("large", map[string]interface{}{"flavorID": "large"})
+
+	// Only the changes of the spec re-sync the Services, and only the ones selecting the blueprint.
+	relabeled := large.DeepCopy()
+	relabeled.SetLabels(map[string]string{"team": "web"})
+	w.onBlueprintUpdate(large, relabeled)
+	changed := newTestBlueprint("large", map[string]interface{}{"flavorID": "xlarge"})
+	w.onBlueprintUpdate(large, changed)
+	select {
+	case name := <-resynced:
+		assert.Equal(t, "web", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Service selecting the changed blueprint wasn't re-synced")
+	}
+	select {
+	case name := <-resynced:
+		t.Fatalf("Service %s was re-synced unexpectedly", name)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// The Services whose load balancer was deleted aren't re-synced.
+	w.track(web, "kubernetes", "")
+	w.onBlueprintUpdate(changed, large)
+	select {
+	case <-resynced:
+		t.Fatal("the Service of a deleted load balancer was re-synced")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestCheckEligibleNodes(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	tests := []struct {
+		name                string
+		behavior            string
+		nodes               []*corev1.Node
+		ensure              bool
+		expectedErr         bool
+		expectedKeepMembers bool
+		expectedEvent       string
+	}{
+		{
+			name:     "eligible nodes",
+			behavior: noNodesFail,
+			nodes:    []*corev1.Node{node},
+			ensure:   true,
+		},
+		{
+			name:          "fail",
+			behavior:      noNodesFail,
+			ensure:        true,
+			expectedErr:   true,
+			expectedEvent: "Warning LoadBalancerNoEligibleNodes No eligible node found for the load balancer members, e.g. because all of them are tainted or excluded from load balancers",
+		},
+		{
+			name:          "fail removes the members on update",
+			behavior:      noNodesFail,
+			expectedEvent: "Warning LoadBalancerNoEligibleNodes No eligible node found for the load balancer members, e.g. because all of them are tainted or excluded from load balancers",
+		},
+		{
+			name:          "empty pools",
+			behavior:      noNodesEmptyPools,
+			ensure:        true,
+			expectedEvent: "Warning LoadBalancerNoEligibleNodes No eligible node found for the load balancer members, the pools are left empty until a node is eligible",
+		},
+		{
+			name:                "keep members",
+			behavior:            noNodesKeepMembers,
+			ensure:              true,
+			expectedKeepMembers: true,
+			expectedEvent:       "Warning LoadBalancerNoEligibleNodes No eligible node found for the load balancer members, the current members are kept until a node is eligible",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			lbaas := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{NoNodesBehavior: test.behavior}, eventRecorder: recorder}}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+			svcConf := &serviceConfig{}
+
+			err := lbaas.checkEligibleNodes(service, test.nodes, svcConf, test.ensure)
+			if test.expectedErr {
+				assert.ErrorContains(t, err, "there are no available nodes for LoadBalancer service default/web")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedKeepMembers, svcConf.keepMembersWithoutNodes)
+			if test.expectedEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				assert.Equal(t, test.expectedEvent, <-recorder.Events)
+			}
+		})
+	}
+}
+
+func TestEnsurePoolMembersWithoutNodes(t *testing.T) {
+	// The pool isn't even looked at, its members are kept as they are.
+	lbaas := &LbaasV2{LoadBalancer{}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	port := corev1.ServicePort{Port: 80, NodePort: 30080, Protocol: corev1.ProtocolTCP}
+
+	err := lbaas.ensurePoolMembers(context.TODO(), "lb-id", &v2pools.Pool{ID: "pool-id"}, service, port, nil, &serviceConfig{keepMembersWithoutNodes: true})
+	assert.NoError(t, err)
+}
+
+func TestEnsurePoolMembersNodePortChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		nodePort      int32
+		expectedPorts []int
+	}{
+		{
+			name:     "same node port",
+			nodePort: 30080,
+		},
+		{
+			// The protocol port of a member can't be updated, the batch update replaces the members.
+			name:          "reallocated node port",
+			nodePort:      30081,
+			expectedPorts: []int{30081},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var updatedPorts []int
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools/pool-id/members", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					w.Header().Add("Content-Type", "application/json")
+					fmt.Fprint(w, `{"members": [{"id": "member-id", "name": "node-1", "address": "10.0.0.1", "protocol_port": 30080, "weight": 1}]}`)
+				case http.MethodPut:
+					var body struct {
+						Members []struct {
+							ProtocolPort int `json:"protocol_port"`
+						} `json:"members"`
+					}
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					for _, member := range body.Members {
+						updatedPorts = append(updatedPorts, member.ProtocolPort)
+					}
+					w.WriteHeader(http.StatusAccepted)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+			port := corev1.ServicePort{Port: 80, NodePort: test.nodePort, Protocol: corev1.ProtocolTCP}
+			nodes := []*corev1.Node{{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+				Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}},
+			}}
+
+			err := lbaas.ensurePoolMembers(context.TODO(), "lb-id", &v2pools.Pool{ID: "pool-id"}, service, port, nodes, &serviceConfig{})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedPorts, updatedPorts)
+		})
+	}
+}
+
+func TestHasNoReadyEndpoints(t *testing.T) {
+	ready, notReady := true, false
+	tests := []struct {
+		name     string
+		selector map[string]string
+		synced   bool
+		slices   []interface{}
+		expected bool
+	}{
+		{
+			name:     "ready endpoints",
+			selector: map[string]string{"app": "test"},
+			synced:   true,
+			slices:   []interface{}{newTestEndpointSlice("test", &notReady), newTestEndpointSlice("test", &ready)},
+		},
+		{
+			name:     "endpoints without ready condition",
+			selector: map[string]string{"app": "test"},
+			synced:   true,
+			slices:   []interface{}{newTestEndpointSlice("test", nil)},
+		},
+		{
+			name:     "no ready endpoints",
+			selector: map[string]string{"app": "test"},
+			synced:   true,
+			slices:   []interface{}{newTestEndpointSlice("test", &notReady), newTestEndpointSlice("other", &ready)},
+			expected: true,
+		},
+		{
+			name:     "no endpoints",
+			selector: map[string]string{"app": "test"},
+			synced:   true,
+			expected: true,
+		},
+		{
+			name:   "no selector",
+			synced: true,
+		},
+		{
+			name:     "not synced",
+			selector: map[string]string{"app": "test"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := &serviceEndpointsWatcher{
+				endpointSliceLister: discoverylisters.NewEndpointSliceLister(newTestIndexer(test.slices...)),
+				hasSynced:           func() bool { return test.synced },
+			}
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+				Spec:       corev1.ServiceSpec{Selector: test.selector},
+			}
+
+			assert.Equal(t, test.expected, w.hasNoReadyEndpoints(service))
+		})
+	}
+
+	var w *serviceEndpointsWatcher
+	assert.False(t, w.hasNoReadyEndpoints(&corev1.Service{Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "test"}}}))
+}
+
+func TestSetEndpointsReadiness(t *testing.T) {
+	ready, notReady, terminating := true, false, true
+	terminatingSlice := newTestEndpointSlice("test", &notReady)
+	terminatingSlice.Endpoints[0].Conditions.Terminating = &terminating
+	tests := []struct {
+		name                     string
+		annotation               string
+		slices                   []interface{}
+		expectedNoReadyEndpoints bool
+		expectedNotReadyMembers  bool
+	}{
+		{
+			name:                     "starting endpoints",
+			annotation:               "true",
+			slices:                   []interface{}{newTestEndpointSlice("test", &notReady)},
+			expectedNoReadyEndpoints: true,
+			expectedNotReadyMembers:  true,
+		},
+		{
+			name:                     "starting endpoints without the annotation",
+			slices:                   []interface{}{newTestEndpointSlice("test", &notReady)},
+			expectedNoReadyEndpoints: true,
+		},
+		{
+			name:       "ready endpoints",
+			annotation: "true",
+			slices:     []interface{}{newTestEndpointSlice("test", &notReady, &ready)},
+		},
+		{
+			name:                     "terminating endpoints",
+			annotation:               "true",
+			slices:                   []interface{}{terminatingSlice},
+			expectedNoReadyEndpoints: true,
+		},
+		{
+			name:                     "no endpoints",
+			annotation:               "true",
+			expectedNoReadyEndpoints: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{
+				opts: LoadBalancerOpts{NoEndpointsBehavior: noEndpointsRemoveMembers},
+				endpoints: &serviceEndpointsWatcher{
+					endpointSliceLister: discoverylisters.NewEndpointSliceLister(newTestIndexer(test.slices...)),
+					hasSynced:           func() bool { return true },
+				},
+			}}
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test", Annotations: map[string]string{}},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "test"}},
+			}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerNotReadyMembers] = test.annotation
+			}
+
+			svcConf := &serviceConfig{}
+			lbaas.setEndpointsReadiness(service, svcConf)
+			assert.Equal(t, test.expectedNoReadyEndpoints, svcConf.noReadyEndpoints)
+			assert.Equal(t, test.expectedNotReadyMembers, svcConf.notReadyMembers)
+
+			// The members are left as they are with keep-members.
+			lbaas.opts.NoEndpointsBehavior = noEndpointsKeepMembers
+			lbaas.setEndpointsReadiness(service, svcConf)
+			assert.False(t, svcConf.noReadyEndpoints)
+			assert.False(t, svcConf.notReadyMembers)
+		})
+	}
+}
+
+func TestBuildBatchUpdateMemberOptsNotReadyMembers(t *testing.T) {
+	nodes := []*corev1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}}
+	port := corev1.ServicePort{Name: "http", Port: 80, NodePort: 30080}
+	lbaas := &LbaasV2{LoadBalancer{drainingNodes: newNodeDrainTracker()}}
+
+	members, newMembers, err := lbaas.buildBatchUpdateMemberOpts(port, nodes, &serviceConfig{noReadyEndpoints: true, notReadyMembers: true})
+	assert.NoError(t, err)
+	assert.Len(t, members, 1)
+	assert.Equal(t, 0, *members[0].Weight)
+	assert.True(t, newMembers.Has("node-1-10.0.0.1-30080-0-0-false"))
+
+	// The members are promoted once the Service has ready endpoints.
+	members, _, err = lbaas.buildBatchUpdateMemberOpts(port, nodes, &serviceConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *members[0].Weight)
+}
+
+func TestServiceEndpointsWatcherRepopulate(t *testing.T) {
+	ready, notReady := true, false
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"}}
+	readyCondition := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+	nodes := []interface{}{
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ready"}, Status: corev1.NodeStatus{Conditions: readyCondition}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "not-ready"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "excluded", Labels: map[string]string{corev1.LabelNodeExcludeBalancers: ""}}, Status: corev1.NodeStatus{Conditions: readyCondition}},
+	}
+	slices := newTestIndexer(newTestEndpointSlice("test", &notReady))
+
+	repopulated := make(chan []string, 1)
+	w := &serviceEndpointsWatcher{
+		endpointSliceLister: discoverylisters.NewEndpointSliceLister(slices),
+		serviceLister:       corelisters.NewServiceLister(newTestIndexer(service)),
+		nodeLister:          corelisters.NewNodeLister(newTestIndexer(nodes...)),
+		hasSynced:           func() bool { return true },
+		emptied:             make(map[types.NamespacedName]string),
+		populated:           make(map[types.NamespacedName]string),
+	}
+	w.setRepopulate(func(_ context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node) error {
+		assert.Equal(t, "kubernetes", clusterName)
+		assert.Equal(t, "test", svc.Name)
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		repopulated <- names
+		return nil
+	})
+	w.track(service, "kubernetes", true)
+
+	// Nothing happens while the endpoints aren't ready.
+	w.onEndpointSliceChange(newTestEndpointSlice("test", &notReady))
+	assert.Len(t, w.emptied, 1)
+
+	slice := newTestEndpointSlice("test", &ready)
+	assert.NoError(t, slices.Update(slice))
+	w.onEndpointSliceChange(slice)
+	select {
+	case names := <-repopulated:
+		assert.Equal(t, []string{"ready"}, names)
+	case <-time.After(5 * time.Second):
+		t.Fatal("members weren't re-populated")
+	}
+	assert.Empty(t, w.emptied)
+
+	// The Services whose members weren't removed are left alone.
+	w.onEndpointSliceChange(slice)
+	assert.Empty(t, repopulated)
+}
+
+func TestServiceEndpointsWatcherRemoveMembers(t *testing.T) {
+	ready, notReady := true, false
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "test"}},
+	}
+	slice := newTestEndpointSlice("test", &ready)
+	slices := newTestIndexer(slice)
+
+	removed := make(chan struct{}, 1)
+	w := &serviceEndpointsWatcher{
+		endpointSliceLister: discoverylisters.NewEndpointSliceLister(slices),
+		serviceLister:       corelisters.NewServiceLister(newTestIndexer(service)),
+		nodeLister:          corelisters.NewNodeLister(newTestIndexer()),
+		hasSynced:           func() bool { return true },
+		removeMembers:       true,
+		emptied:             make(map[types.NamespacedName]string),
+		populated:           make(map[types.NamespacedName]string),
+	}
+	w.setRepopulate(func(_ context.Context, clusterName string, svc *corev1.Service, _ []*corev1.Node) error {
+		assert.Equal(t, "kubernetes", clusterName)
+		assert.Equal(t, "test", svc.Name)
+		removed <- struct{}{}
+		return nil
+	})
+	w.track(service, "kubernetes", false)
+
+	// Nothing happens while the Service has ready endpoints.
+	w.onEndpointSliceChange(slice)
+	assert.Empty(t, removed)
+
+	slice = newTestEndpointSlice("test", &notReady)
+	assert.NoError(t, slices.Update(slice))
+	w.onEndpointSliceChange(slice)
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("members weren't removed")
+	}
+	assert.Equal(t, map[types.NamespacedName]string{{Namespace: "default", Name: "test"}: "kubernetes"}, w.emptied)
+	assert.Empty(t, w.populated)
+
+	// The members are kept with keep-members.
+	w.removeMembers = false
+	w.track(service, "kubernetes", false)
+	w.onEndpointSliceChange(slice)
+	assert.Empty(t, removed)
+}
+
+func TestParseServiceMappingConfigMap(t *testing.T) {
+	tests := []struct {
+		name              string
+		value             string
+		expectedNamespace string
+		expectedName      string
+		expectErr         bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:              "valid",
+			value:             "kube-system/occm-loadbalancers",
+			expectedNamespace: "kube-system",
+			expectedName:      "occm-loadbalancers",
+		},
+		{
+			name:      "missing namespace",
+			value:     "occm-loadbalancers",
+			expectErr: true,
+		},
+		{
+			name:      "invalid namespace",
+			value:     "kube.system/occm-loadbalancers",
+			expectErr: true,
+		},
+		{
+			name:      "invalid name",
+			value:     "kube-system/OCCM",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namespace, name, err := parseServiceMappingConfigMap(test.value)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedNamespace, namespace)
+			assert.Equal(t, test.expectedName, name)
+		})
+	}
+}
+
+func TestSetServiceMapping(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	configMap := &corev1.ConfigMap{}
+	mapping := &serviceMapping{
+		LoadBalancerID: "lb-id",
+		VIPAddress:     "10.0.0.10",
+		FloatingIP:     "172.24.4.10",
+		ListenerIDs:    []string{"listener-1", "listener-2"},
+	}
+
+	changed, err := setServiceMapping(configMap, service, mapping)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.JSONEq(t, `{"loadBalancerID": "lb-id", "vipAddress": "10.0.0.10", "floatingIP": "172.24.4.10", "listenerIDs": ["listener-1", "listener-2"]}`, configMap.Data["default.web"])
+
+	changed, err = setServiceMapping(configMap, service, mapping)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = setServiceMapping(configMap, service, nil)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotContains(t, configMap.Data, "default.web")
+
+	changed, err = setServiceMapping(configMap, service, nil)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestGetLoadBalancerRegion(t *testing.T) {
+	node := func(name, region string) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if region != "" {
+			n.Labels = map[string]string{corev1.LabelTopologyRegion: region}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		nodes          []*corev1.Node
+		expectedRegion string
+		expectErr      bool
+	}{
+		{
+			name:           "no nodes",
+			expectedRegion: "RegionOne",
+		},
+		{
+			name:           "annotation",
+			annotations:    map[string]string{ServiceAnnotationLoadBalancerRegion: "RegionThree"},
+			nodes:          []*corev1.Node{node("node-1", "RegionTwo")},
+			expectedRegion: "RegionThree",
+		},
+		{
+			name:           "nodes in a single region",
+			nodes:          []*corev1.Node{node("node-1", "RegionTwo"), node("node-2", ""), node("node-3", "RegionTwo")},
+			expectedRegion: "RegionTwo",
+		},
+		{
+			name:      "nodes in several regions",
+			nodes:     []*corev1.Node{node("node-1", "RegionTwo"), node("node-2", "RegionThree")},
+			expectErr: true,
+		},
+		{
+			name:           "nodes in several regions with annotation",
+			annotations:    map[string]string{ServiceAnnotationLoadBalancerRegion: "RegionTwo"},
+			nodes:          []*corev1.Node{node("node-1", "RegionTwo"), node("node-2", "RegionThree")},
+			expectedRegion: "RegionTwo",
+		},
+		{
+			name:           "nodes without region",
+			nodes:          []*corev1.Node{node("node-1", "")},
+			expectedRegion: "RegionOne",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: test.annotations}}
+			region, err := getLoadBalancerRegion(service, test.nodes, "RegionOne")
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRegion, region)
+		})
+	}
+}
+
+func TestLbaasInRegion(t *testing.T) {
+	regionOne := &LbaasV2{LoadBalancer{region: "RegionOne"}}
+	regionTwo := &LbaasV2{LoadBalancer{region: "RegionTwo"}}
+	regional := map[string]*LbaasV2{"RegionOne": regionOne, "RegionTwo": regionTwo}
+	regionOne.regional, regionTwo.regional = regional, regional
+
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{corev1.LabelTopologyRegion: "RegionOne"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{corev1.LabelTopologyRegion: "RegionTwo"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}},
+	}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	lbaas, regionNodes, err := regionOne.inRegion(service, []*corev1.Node{nodes[0], nodes[2]})
+	assert.NoError(t, err)
+	assert.Same(t, regionOne, lbaas)
+	assert.Equal(t, []*corev1.Node{nodes[0], nodes[2]}, regionNodes)
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerRegion: "RegionOne"}
+	lbaas, regionNodes, err = regionOne.inRegion(service, nodes)
+	assert.NoError(t, err)
+	assert.Same(t, regionOne, lbaas)
+	assert.Equal(t, []*corev1.Node{nodes[0], nodes[2]}, regionNodes)
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerRegion: "RegionTwo"}
+	lbaas, regionNodes, err = regionOne.inRegion(service, nodes)
+	assert.NoError(t, err)
+	assert.Same(t, regionTwo, lbaas)
+	assert.Equal(t, []*corev1.Node{nodes[1], nodes[2]}, regionNodes)
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerRegion: "RegionThree"}
+	_, _, err = regionOne.inRegion(service, nodes)
+	assert.EqualError(t, err, `region "RegionThree" of the load balancer of Service default/web isn't one of the configured regions`)
+
+	// The nodes spread over the regions must be given a region.
+	service.Annotations = nil
+	_, _, err = regionOne.inRegion(service, nodes[:2])
+	assert.ErrorContains(t, err, "are in several regions")
+
+	// Nothing changes with a single region.
+	single := &LbaasV2{LoadBalancer{region: "RegionOne"}}
+	lbaas, regionNodes, err = single.inRegion(service, nodes)
+	assert.NoError(t, err)
+	assert.Same(t, single, lbaas)
+	assert.Equal(t, nodes, regionNodes)
+}
+
+func TestLbaasLookupRegion(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// The load balancer is only in RegionTwo.
+	th.Mux.HandleFunc("/regionone/lbaas/loadbalancers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"loadbalancers": []}`)
+	})
+	th.Mux.HandleFunc("/regiontwo/lbaas/loadbalancers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		if r.URL.Query().Get("name") != "kube_service_kubernetes_default_web" {
+			fmt.Fprint(w, `{"loadbalancers": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"loadbalancers": [{"id": "lb-id", "name": "kube_service_kubernetes_default_web"}]}`)
+	})
+	th.Mux.HandleFunc("/regionone/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	th.Mux.HandleFunc("/regiontwo/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id"}}`)
+	})
+
+	client := func(path string) *gophercloud.ServiceClient {
+		return &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint() + path}
+	}
+	regionOne := &LbaasV2{LoadBalancer{region: "RegionOne", lb: client("regionone/")}}
+	regionTwo := &LbaasV2{LoadBalancer{region: "RegionTwo", lb: client("regiontwo/")}}
+	regional := map[string]*LbaasV2{"RegionOne": regionOne, "RegionTwo": regionTwo}
+	regionOne.regional, regionTwo.regional = regional, regional
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	lbaas, err := regionOne.lookupRegion(service, "kube_service_kubernetes_default_web")
+	assert.NoError(t, err)
+	assert.Same(t, regionTwo, lbaas)
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerID: "lb-id"}
+	lbaas, err = regionOne.lookupRegion(service, "")
+	assert.NoError(t, err)
+	assert.Same(t, regionTwo, lbaas)
+
+	// The existing load balancer stays in its region when reconciled.
+	lbaas, _, err = regionOne.inRegion(service, nil)
+	assert.NoError(t, err)
+	assert.Same(t, regionTwo, lbaas)
+
+	// The annotation takes precedence.
+	service.Annotations[ServiceAnnotationLoadBalancerRegion] = "RegionOne"
+	lbaas, err = regionOne.lookupRegion(service, "")
+	assert.NoError(t, err)
+	assert.Same(t, regionOne, lbaas)
+
+	// The default region when the load balancer is found nowhere.
+	service.Annotations = nil
+	lbaas, err = regionOne.lookupRegion(service, "kube_service_kubernetes_default_other")
+	assert.NoError(t, err)
+	assert.Same(t, regionOne, lbaas)
+}
+
+func TestGetFloatingIPTags(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "web",
+		Annotations: map[string]string{
+			"external-dns.alpha.kubernetes.io/hostname": "a.example.com, b.example.com",
+			"example.com/owner":                         "team-a",
+			"example.com/ignored":                       "value",
+		},
+	}}
+
+	annotations, err := parseFloatingIPTagAnnotations(" external-dns.alpha.kubernetes.io/hostname, example.com/owner,example.com/missing ")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"kube_service_namespace=default",
+		"kube_service_name=web",
+		"kube_service_annotation_external-dns.alpha.kubernetes.io/hostname=a.example.com",
+		"kube_service_annotation_external-dns.alpha.kubernetes.io/hostname=b.example.com",
+		"kube_service_annotation_example.com/owner=team-a",
+	}, getFloatingIPTags(service, annotations))
+
+	_, err = parseFloatingIPTagAnnotations("example.com/owner,not a key")
+	assert.ErrorContains(t, err, `invalid annotation key "not a key"`)
+}
+
+func TestMergeFloatingIPTags(t *testing.T) {
+	current := []string{"firewall=open", "kube_service_namespace=default", "kube_service_name=old"}
+
+	assert.Equal(t, []string{"firewall=open", "kube_service_name=web", "kube_service_namespace=default"},
+		mergeFloatingIPTags(current, []string{"kube_service_namespace=default", "kube_service_name=web"}, fipTagPrefix))
+	assert.Equal(t, []string{"firewall=open"}, mergeFloatingIPTags(current, nil, fipTagPrefix))
+	// Only the owner tag is replaced without floating-ip-tags.
+	assert.Equal(t, []string{"firewall=open", "kube_service_name=old", "kube_service_namespace=default", "kube_service_owner=default/web"},
+		mergeFloatingIPTags(append(current, "kube_service_owner=default/old"), []string{"kube_service_owner=default/web"}, fipTagOwner))
+}
+
+func TestEnsureFloatingIPTags(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	requester := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "web",
+		Annotations: map[string]string{ServiceAnnotationLoadBalancerVIPAddress: "172.24.4.10"},
+	}}
+
+	tests := []struct {
+		name           string
+		disabled       bool
+		ipConflicts    string
+		drift          string
+		tags           []string
+		service        *corev1.Service
+		expectedMethod string
+		expectedUpdate string
+	}{
+		{
+			name:     "disabled",
+			disabled: true,
+			service:  service,
+		},
+		{
+			name:        "disabled, owner tag of a Service not requesting an address",
+			disabled:    true,
+			ipConflicts: lbIPConflictsOldestWins,
+			service:     service,
+		},
+		{
+			name:           "disabled, owner tag added",
+			disabled:       true,
+			ipConflicts:    lbIPConflictsOldestWins,
+			tags:           []string{"kube_service_name=web", "kube_service_owner=default/other"},
+			service:        requester,
+			expectedMethod: http.MethodPut,
+			expectedUpdate: `{"tags": ["kube_service_name=web", "kube_service_owner=default/web"]}`,
+		},
+		{
+			name:           "disabled, load balancer tag added",
+			disabled:       true,
+			drift:          fipDriftReassociate,
+			tags:           []string{"kube_service_name=web", "kube_service_loadbalancer=old-lb-id"},
+			service:        service,
+			expectedMethod: http.MethodPut,
+			expectedUpdate: `{"tags": ["kube_service_loadbalancer=lb-id", "kube_service_name=web"]}`,
+		},
+		{
+			name:           "owner tag added along with the others",
+			ipConflicts:    lbIPConflictsOldestWins,
+			service:        requester,
+			expectedMethod: http.MethodPut,
+			expectedUpdate: `{"tags": ["kube_service_name=web", "kube_service_namespace=default", "kube_service_owner=default/web"]}`,
+		},
+		{
+			name:           "tags added",
+			tags:           []string{"firewall=open"},
+			service:        service,
+			expectedMethod: http.MethodPut,
+			expectedUpdate: `{"tags": ["firewall=open", "kube_service_name=web", "kube_service_namespace=default"]}`,
+		},
+		{
+			name:    "tags up to date",
+			tags:    []string{"kube_service_namespace=default", "kube_service_name=web"},
+			service: service,
+		},
+		{
+			name:           "tags removed",
+			tags:           []string{"firewall=open", "kube_service_namespace=default", "kube_service_name=web"},
+			expectedMethod: http.MethodPut,
+			expectedUpdate: `{"tags": ["firewall=open"]}`,
+		},
+		{
+			name:           "all tags removed",
+			tags:           []string{"kube_service_namespace=default", "kube_service_name=web"},
+			expectedMethod: http.MethodDelete,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			method := ""
+			th.Mux.HandleFunc("/floatingips/fip-id/tags", func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				if r.Method == http.MethodPut {
+					th.TestJSONRequest(t, r, test.expectedUpdate)
+					fmt.Fprint(w, test.expectedUpdate)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts:    LoadBalancerOpts{FloatingIPTags: !test.disabled, LoadBalancerIPConflicts: test.ipConflicts, FloatingIPDrift: test.drift},
+			}}
+			fip := &floatingips.FloatingIP{ID: "fip-id", FloatingIP: "172.24.4.10", Tags: test.tags}
+
+			assert.NoError(t, lbaas.ensureFloatingIPTags(fip, test.service, "lb-id"))
+			assert.Equal(t, test.expectedMethod, method)
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "unknown error",
+			err:      fmt.Errorf("timeout waiting for the loadbalancer"),
+			expected: errorClassTransient,
+		},
+		{
+			name:     "terminal error",
+			err:      fmt.Errorf("failed to check service: %w", asTerminalError(fmt.Errorf("invalid annotation"))),
+			expected: errorClassTerminal,
+		},
+		{
+			name:     "bad request",
+			err:      fmt.Errorf("error creating loadbalancer: %w", gophercloud.ErrDefault400{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusBadRequest}}),
+			expected: errorClassTerminal,
+		},
+		{
+			name:     "Octavia quota",
+			err:      fmt.Errorf("error creating loadbalancer: %w", gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusForbidden}}),
+			expected: errorClassTerminal,
+		},
+		{
+			name:     "missing subnet",
+			err:      fmt.Errorf("failed to find subnet: %w", gophercloud.ErrDefault404{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}}),
+			expected: errorClassTerminal,
+		},
+		{
+			name: "Neutron quota",
+			err: fmt.Errorf("error creating LB floatingip: %w", gophercloud.ErrDefault409{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusConflict,
+				Body:   []byte(`{"NeutronError": {"type": "OverQuota", "message": "Quota exceeded for resources: ['floatingip']."}}`),
+			}}),
+			expected: errorClassTerminal,
+		},
+		{
+			name: "load balancer in a PENDING_UPDATE state",
+			err: fmt.Errorf("error creating listener: %w", gophercloud.ErrDefault409{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusConflict,
+				Body:   []byte(`{"faultstring": "Load Balancer is immutable and cannot be updated."}`),
+			}}),
+			expected: errorClassTransient,
+		},
+		{
+			name:     "rate limited",
+			err:      fmt.Errorf("error creating pool: %w", gophercloud.ErrDefault429{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusTooManyRequests}}),
+			expected: errorClassTransient,
+		},
+		{
+			name:     "server error",
+			err:      fmt.Errorf("error creating pool: %w", gophercloud.ErrDefault503{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}}),
+			expected: errorClassTransient,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, classifyError(test.err))
+		})
+	}
+}
+
+func TestHandleReconcileError(t *testing.T) {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc"}}
+	recorder := record.NewFakeRecorder(10)
+	lbaas := &LbaasV2{LoadBalancer{eventRecorder: recorder}}
+	mc := metrics.NewMetricContext("loadbalancer", "ensure")
+
+	assert.NoError(t, lbaas.handleReconcileError(mc, service, nil))
+
+	transient := fmt.Errorf("timeout waiting for the loadbalancer")
+	assert.Equal(t, transient, lbaas.handleReconcileError(mc, service, transient))
+	assert.Len(t, recorder.Events, 0)
+
+	err := lbaas.handleReconcileError(mc, service, asTerminalError(fmt.Errorf("invalid annotation")))
+	var retryErr *api.RetryError
+	if assert.ErrorAs(t, err, &retryErr) {
+		assert.Equal(t, terminalErrorRetryDelay, retryErr.RetryAfter())
+		assert.Equal(t, "invalid annotation", retryErr.Error())
+	}
+	assert.Equal(t, "Warning LoadBalancerTerminalError invalid annotation", <-recorder.Events)
+}
+
+func TestHandledClass(t *testing.T) {
+	otherClass := "other"
+	ourClass := "openstack"
+	tests := []struct {
+		name         string
+		handledClass string
+		defaultClass bool
+		annotation   string
+		specClass    *string
+		expected     bool
+	}{
+		{
+			name:     "no handled class",
+			expected: true,
+		},
+		{
+			name:       "no handled class and a class annotation",
+			annotation: otherClass,
+			expected:   true,
+		},
+		{
+			name:         "Service without a class",
+			handledClass: ourClass,
+		},
+		{
+			name:         "Service without a class and default class",
+			handledClass: ourClass,
+			defaultClass: true,
+			expected:     true,
+		},
+		{
+			name:         "other class annotation and default class",
+			handledClass: ourClass,
+			defaultClass: true,
+			annotation:   otherClass,
+		},
+		{
+			name:         "matching class annotation",
+			handledClass: ourClass,
+			annotation:   ourClass,
+			expected:     true,
+		},
+		{
+			name:         "other class annotation",
+			handledClass: ourClass,
+			annotation:   otherClass,
+		},
+		{
+			name:         "matching spec.loadBalancerClass",
+			handledClass: ourClass,
+			specClass:    &ourClass,
+			expected:     true,
+		},
+		{
+			name:         "other spec.loadBalancerClass wins over the annotation",
+			handledClass: ourClass,
+			annotation:   ourClass,
+			specClass:    &otherClass,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Annotations: map[string]string{}},
+				Spec: corev1.ServiceSpec{
+					Type:              corev1.ServiceTypeLoadBalancer,
+					LoadBalancerClass: test.specClass,
+				},
+			}
+			if test.annotation != "" {
+				service.Annotations[ServiceAnnotationLoadBalancerClass] = test.annotation
+			}
+
+			lbaas := &LbaasV2{LoadBalancer{opts: LoadBalancerOpts{HandledClass: test.handledClass, DefaultClass: test.defaultClass}}}
+			assert.Equal(t, test.expected, lbaas.handlesService(service))
+			if test.expected {
+				return
+			}
+
+			// No OpenStack clients are set up, touching any resource of the Service would panic here. The Service has
+			// no load balancer status, so there's no load balancer of a former class to release either.
+			status, err := lbaas.EnsureLoadBalancer(context.TODO(), testClusterName, service, []*corev1.Node{{}})
+			assert.Nil(t, status)
+			assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+			assert.Equal(t, cloudprovider.ImplementedElsewhere, lbaas.UpdateLoadBalancer(context.TODO(), testClusterName, service, []*corev1.Node{{}}))
+			assert.Equal(t, cloudprovider.ImplementedElsewhere, lbaas.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, service))
+			status, exists, err := lbaas.GetLoadBalancer(context.TODO(), testClusterName, service)
+			assert.Nil(t, status)
+			assert.False(t, exists)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGetLoadBalancerStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		floatingIP  string
+		expected    []corev1.LoadBalancerIngress
+	}{
+		{
+			name:       "floating IP",
+			floatingIP: "172.24.4.10",
+			expected:   []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}},
+		},
+		{
+			name:        "floating IP with the VIP address",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerIncludeVIPAddress: "true"},
+			floatingIP:  "172.24.4.10",
+			expected:    []corev1.LoadBalancerIngress{{IP: "172.24.4.10"}, {IP: "10.0.0.10"}},
+		},
+		{
+			name:        "VIP address only",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerIncludeVIPAddress: "true"},
+			expected:    []corev1.LoadBalancerIngress{{IP: "10.0.0.10"}},
+		},
+		{
+			name:        "PROXY protocol",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerProxyEnabled: "true"},
+			floatingIP:  "172.24.4.10",
+			expected:    []corev1.LoadBalancerIngress{{Hostname: "172.24.4.10.nip.io"}},
+		},
+		{
+			name:        "hostname",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerLoadbalancerHostname: "web.example.com"},
+			floatingIP:  "172.24.4.10",
+			expected:    []corev1.LoadBalancerIngress{{Hostname: "web.example.com"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "vip_address": "10.0.0.10", "vip_port_id": "vip-port-id"}}`)
+			})
+			th.Mux.HandleFunc("/floatingips", func(w http.ResponseWriter, r *http.Request) {
+				th.TestFormValues(t, r, map[string]string{"port_id": "vip-port-id"})
+				w.Header().Add("Content-Type", "application/json")
+				if test.floatingIP == "" {
+					fmt.Fprint(w, `{"floatingips": []}`)
+					return
+				}
+				fmt.Fprintf(w, `{"floatingips": [{"id": "fip-id", "floating_ip_address": %q, "port_id": "vip-port-id"}]}`, test.floatingIP)
+			})
+
+			client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+			lbaas := &LbaasV2{LoadBalancer{
+				lb:      client,
+				network: client,
+				opts:    LoadBalancerOpts{EnableIngressHostname: true, IngressHostnameSuffix: "nip.io"},
+			}}
+			annotations := map[string]string{ServiceAnnotationLoadBalancerID: "lb-id"}
+			for key, value := range test.annotations {
+				annotations[key] = value
+			}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: annotations}}
+
+			status, exists, err := lbaas.GetLoadBalancer(context.TODO(), testClusterName, service)
+			assert.NoError(t, err)
+			assert.True(t, exists)
+			assert.Equal(t, test.expected, status.Ingress)
+		})
+	}
+}
+
+func TestAddHandledClass(t *testing.T) {
+	cfg := Config{}
+	addHandledClass(&cfg)
+	assert.Nil(t, cfg.LoadBalancerClass)
+
+	cfg.LoadBalancer.HandledClass = "openstack"
+	addHandledClass(&cfg)
+	assert.Equal(t, map[string]*LBClass{"openstack": {}}, cfg.LoadBalancerClass)
+
+	// A [LoadBalancerClass] section of the handled class is kept
+	cfg.LoadBalancerClass["openstack"] = &LBClass{SubnetID: "subnet"}
+	addHandledClass(&cfg)
+	assert.Equal(t, "subnet", cfg.LoadBalancerClass["openstack"].SubnetID)
+}
+
+func TestGetOperatingStatusCondition(t *testing.T) {
+	tests := []struct {
+		operatingStatus string
+		expectedStatus  metav1.ConditionStatus
+		expectedReason  string
+	}{
+		{operatingStatus: "ONLINE", expectedStatus: metav1.ConditionTrue, expectedReason: "ONLINE"},
+		{operatingStatus: "NO_MONITOR", expectedStatus: metav1.ConditionTrue, expectedReason: "NO_MONITOR"},
+		{operatingStatus: "DEGRADED", expectedStatus: metav1.ConditionFalse, expectedReason: "DEGRADED"},
+		{operatingStatus: "ERROR", expectedStatus: metav1.ConditionFalse, expectedReason: "ERROR"},
+		{operatingStatus: "OFFLINE", expectedStatus: metav1.ConditionFalse, expectedReason: "OFFLINE"},
+		{operatingStatus: "", expectedStatus: metav1.ConditionUnknown, expectedReason: "Unknown"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.operatingStatus, func(t *testing.T) {
+			condition := getOperatingStatusCondition("lb-id", test.operatingStatus, 3)
+			assert.Equal(t, serviceConditionLBOnline, condition.Type)
+			assert.Equal(t, test.expectedStatus, condition.Status)
+			assert.Equal(t, test.expectedReason, condition.Reason)
+			assert.Equal(t, int64(3), condition.ObservedGeneration)
+			assert.Contains(t, condition.Message, "lb-id")
+		})
+	}
+}
+
+func TestCheckInternalAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expectedErr string
+	}{
+		{
+			name:        "internal with a VIP subnet",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true", ServiceAnnotationLoadBalancerSubnetID: "subnet-id"},
+		},
+		{
+			name:        "external with a floating network",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "false", ServiceAnnotationLoadBalancerFloatingNetworkID: "public-id"},
+		},
+		{
+			name:        "internal with a floating network",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true", ServiceAnnotationLoadBalancerFloatingNetworkID: "public-id"},
+			expectedErr: "annotation loadbalancer.openstack.org/floating-network-id cannot be used with service.beta.kubernetes.io/openstack-internal-load-balancer, an internal load balancer has no floating IP",
+		},
+		{
+			name:        "internal with a floating subnet",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true", ServiceAnnotationLoadBalancerFloatingSubnetTags: "public"},
+			expectedErr: "annotation loadbalancer.openstack.org/floating-subnet-tags cannot be used with service.beta.kubernetes.io/openstack-internal-load-balancer, an internal load balancer has no floating IP",
+		},
+		{
+			name:        "internal with the VIP address",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerInternal: "true", ServiceAnnotationLoadBalancerIncludeVIPAddress: "true"},
+			expectedErr: "annotation loadbalancer.openstack.org/include-vip-address cannot be used with service.beta.kubernetes.io/openstack-internal-load-balancer, an internal load balancer has no floating IP",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			err := checkInternalAnnotations(service)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.expectedErr)
+			assert.Equal(t, errorClassTerminal, classifyError(err))
+		})
+	}
+}
+
+func TestCheckInternalVIPNetwork(t *testing.T) {
+	tests := []struct {
+		name        string
+		subnetID    string
+		networkID   string
+		expectedErr string
+	}{
+		{
+			name: "no VIP subnet nor network",
+		},
+		{
+			name:     "tenant subnet",
+			subnetID: "tenant-subnet",
+		},
+		{
+			name:      "tenant network",
+			networkID: "tenant-net",
+		},
+		{
+			name:        "external subnet",
+			subnetID:    "public-subnet",
+			networkID:   "tenant-net",
+			expectedErr: "subnet public-subnet of the internal load balancer belongs to external network public-net",
+		},
+		{
+			name:        "external network",
+			networkID:   "public-net",
+			expectedErr: "network public-net of the internal load balancer is external",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			th.Mux.HandleFunc("/subnets/", func(w http.ResponseWriter, r *http.Request) {
+				networkID := "tenant-net"
+				if strings.HasSuffix(r.URL.Path, "/public-subnet") {
+					networkID = "public-net"
+				}
+				fmt.Fprintf(w, `{"subnet": {"id": "%s", "network_id": "%s"}}`, strings.TrimPrefix(r.URL.Path, "/subnets/"), networkID)
+			})
+			th.Mux.HandleFunc("/networks/", func(w http.ResponseWriter, r *http.Request) {
+				networkID := strings.TrimPrefix(r.URL.Path, "/networks/")
+				fmt.Fprintf(w, `{"network": {"id": "%s", "router:external": %t}}`, networkID, networkID == "public-net")
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			err := lbaas.checkInternalVIPNetwork(test.subnetID, test.networkID)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.expectedErr)
+			assert.Equal(t, errorClassTerminal, classifyError(err))
+		})
+	}
+}
+
+func TestGetMemberSecurityGroupID(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        LoadBalancerOpts
+		expectedID  string
+		expectedErr string
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:       "by name",
+			opts:       LoadBalancerOpts{MemberSecurityGroup: "k8s-lb-members"},
+			expectedID: "members-sg",
+		},
+		{
+			name:       "by ID",
+			opts:       LoadBalancerOpts{MemberSecurityGroup: "members-sg"},
+			expectedID: "members-sg",
+		},
+		{
+			name:       "by tags",
+			opts:       LoadBalancerOpts{MemberSecurityGroupTags: "k8s-lb"},
+			expectedID: "members-sg",
+		},
+		{
+			name:        "not found",
+			opts:        LoadBalancerOpts{MemberSecurityGroup: "missing"},
+			expectedErr: "member security group missing: failed to find object",
+		},
+		{
+			name:        "multiple matches",
+			opts:        LoadBalancerOpts{MemberSecurityGroupTags: "k8s"},
+			expectedErr: "member security group with tags k8s: multiple results where only one expected",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			th.Mux.HandleFunc("/security-groups", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				query := r.URL.Query()
+				switch {
+				case query.Get("name") == "k8s-lb-members", query.Get("id") == "members-sg", query.Get("tags") == "k8s-lb":
+					fmt.Fprint(w, `{"security_groups": [{"id": "members-sg", "name": "k8s-lb-members"}]}`)
+				case query.Get("tags") == "k8s":
+					fmt.Fprint(w, `{"security_groups": [{"id": "members-sg"}, {"id": "other-sg"}]}`)
+				default:
+					fmt.Fprint(w, `{"security_groups": []}`)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts:    test.opts,
+			}}
+			id, err := lbaas.getMemberSecurityGroupID()
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedID, id)
+		})
+	}
+}
+
+func TestMemberSecurityGroupRules(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+		},
+	}
+	description := getSecurityGroupName(service)
+
+	// The rules of the other Services and of the operator are never listed, the rules are filtered on the description.
+	th.Mux.HandleFunc("/security-groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"security_groups": [{"id": "members-sg", "name": "k8s-lb-members"}]}`)
+	})
+	th.Mux.HandleFunc("/subnets/member-subnet", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"subnet": {"id": "member-subnet", "cidr": "10.0.0.0/24"}}`)
+	})
+	var created []map[string]interface{}
+	var deleted []string
+	th.Mux.HandleFunc("/security-group-rules", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			assert.Equal(t, "members-sg", r.URL.Query().Get("security_group_id"))
+			assert.Equal(t, description, r.URL.Query().Get("description"))
+			fmt.Fprintf(w, `{"security_group_rules": [
+				{"id": "stale-rule", "security_group_id": "members-sg", "direction": "ingress", "protocol": "tcp", "ethertype": "IPv4", "remote_ip_prefix": "10.0.0.0/24", "port_range_min": 30081, "port_range_max": 30081, "description": "%s"}
+			]}`, description)
+		case http.MethodPost:
+			var body struct {
+				Rule map[string]interface{} `json:"security_group_rule"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			created = append(created, body.Rule)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"security_group_rule": {"id": "new-rule"}}`)
+		}
+	})
+	th.Mux.HandleFunc("/security-group-rules/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/security-group-rules/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		opts:    LoadBalancerOpts{ManageSecurityGroups: true, MemberSecurityGroup: "k8s-lb-members"},
+	}}
+	err := lbaas.ensureMemberSecurityGroupRules(service, &serviceConfig{lbMemberSubnetID: "member-subnet"}, nil, "members-sg")
+	assert.NoError(t, err)
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, description, created[0]["description"])
+		assert.Equal(t, "members-sg", created[0]["security_group_id"])
+		assert.Equal(t, float64(30080), created[0]["port_range_min"])
+		assert.Equal(t, "10.0.0.0/24", created[0]["remote_ip_prefix"])
+	}
+	assert.Equal(t, []string{"stale-rule"}, deleted)
+
+	deleted = nil
+	assert.NoError(t, lbaas.deleteMemberSecurityGroupRules(service))
+	assert.Equal(t, []string{"stale-rule"}, deleted)
+}
+
+func TestGetObsoleteListeners(t *testing.T) {
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+		{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53},
+	}}}
+	curListeners := []listeners.Listener{
+		{ID: "http", Protocol: "TCP", ProtocolPort: 80},
+		{ID: "dns", Protocol: "UDP", ProtocolPort: 53},
+		{ID: "https", Protocol: "TCP", ProtocolPort: 443},
+		{ID: "dns-tcp", Protocol: "TCP", ProtocolPort: 53},
+	}
+
+	obsolete := getObsoleteListeners(service, &serviceConfig{}, curListeners)
+	assert.Equal(t, []listeners.Listener{curListeners[2], curListeners[3]}, obsolete)
+}
+
+func TestGetMissingAndOrphanListeners(t *testing.T) {
+	lbName := "kube_service_kubernetes_default_web"
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+		{Name: "https", Protocol: corev1.ProtocolTCP, Port: 443},
+	}}}
+
+	tests := []struct {
+		name            string
+		listeners       []listeners.Listener
+		isLBOwner       bool
+		expectedMissing []listenerKey
+		expectedOrphans []string
+	}{
+		{
+			name: "in sync",
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "TCP", ProtocolPort: 80, Tags: []string{lbName}},
+				{ID: "https", Protocol: "TCP", ProtocolPort: 443, Tags: []string{lbName}},
+			},
+		},
+		{
+			name: "under-provisioned",
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "TCP", ProtocolPort: 80, Tags: []string{lbName}},
+			},
+			expectedMissing: []listenerKey{{Protocol: listeners.ProtocolTCP, Port: 443}},
+		},
+		{
+			name: "over-provisioned",
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "TCP", ProtocolPort: 80, Tags: []string{lbName}},
+				{ID: "https", Protocol: "TCP", ProtocolPort: 443, Tags: []string{lbName}},
+				{ID: "orphan", Protocol: "TCP", ProtocolPort: 8080, Tags: []string{lbName}},
+				{ID: "other", Protocol: "TCP", ProtocolPort: 8443, Tags: []string{"kube_service_kubernetes_default_api"}},
+				{ID: "untagged", Protocol: "TCP", ProtocolPort: 9090},
+			},
+			expectedOrphans: []string{"orphan"},
+		},
+		{
+			name: "over-provisioned owner",
+			listeners: []listeners.Listener{
+				{ID: "http", Protocol: "TCP", ProtocolPort: 80, Tags: []string{lbName}},
+				{ID: "https", Protocol: "TCP", ProtocolPort: 443, Tags: []string{lbName}},
+				{ID: "other", Protocol: "TCP", ProtocolPort: 8443, Tags: []string{"kube_service_kubernetes_default_api"}},
+				{ID: "untagged", Protocol: "TCP", ProtocolPort: 9090},
+			},
+			isLBOwner:       true,
+			expectedOrphans: []string{"untagged"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedMissing, getMissingListeners(service, &serviceConfig{}, test.listeners))
+
+			var orphans []string
+			for _, listener := range getOrphanListeners(service, &serviceConfig{}, test.listeners, test.isLBOwner, lbName) {
+				orphans = append(orphans, listener.ID)
+			}
+			assert.Equal(t, test.expectedOrphans, orphans)
+		})
+	}
+}
+
+func TestDeleteOrphanPools(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	lbName := "kube_service_kubernetes_default_web"
+	var deleted []string
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+	})
+	th.Mux.HandleFunc("/lbaas/pools", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"pools": [
+			{"id": "used", "name": "pool_0_%[1]s", "tags": ["%[1]s"], "listeners": [{"id": "listener-id"}]},
+			{"id": "orphan", "name": "pool_1_%[1]s", "tags": ["%[1]s"]},
+			{"id": "legacy-orphan", "name": "pool_2_%[1]s"},
+			{"id": "l7", "name": "pool_l7_api_%[1]s", "tags": ["%[1]s"]},
+			{"id": "other", "name": "pool_0_kube_service_kubernetes_default_api", "tags": ["kube_service_kubernetes_default_api"]},
+			{"id": "retagged", "name": "pool_3_%[1]s", "tags": ["custom"]}
+		]}`, lbName)
+	})
+	th.Mux.HandleFunc("/lbaas/pools/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/lbaas/pools/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+	count, err := lbaas.deleteOrphanPools("lb-id", lbName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"orphan", "legacy-orphan"}, deleted)
+}
+
+func TestEnsureOctaviaPoolReplacement(t *testing.T) {
+	tests := []struct {
+		name          string
+		order         string
+		quotaExceeded bool
+		expectedCalls []string
+	}{
+		{
+			name:  "create first",
+			order: reconcileOrderCreateFirst,
+			expectedCalls: []string{
+				"POST /lbaas/pools loadbalancer_id=lb-id",
+				"GET /lbaas/pools/new-pool/members",
+				"PUT /lbaas/listeners/listener-id",
+				"DELETE /lbaas/pools/old-pool",
+			},
+		},
+		{
+			name:  "delete first",
+			order: reconcileOrderDeleteFirst,
+			expectedCalls: []string{
+				"DELETE /lbaas/pools/old-pool",
+				"POST /lbaas/pools listener_id=listener-id",
+				"GET /lbaas/pools/new-pool/members",
+			},
+		},
+		{
+			name:          "create first over quota",
+			order:         reconcileOrderCreateFirst,
+			quotaExceeded: true,
+			expectedCalls: []string{
+				"POST /lbaas/pools loadbalancer_id=lb-id",
+				"DELETE /lbaas/pools/old-pool",
+				"POST /lbaas/pools listener_id=listener-id",
+				"GET /lbaas/pools/new-pool/members",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var calls []string
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				if r.Method == http.MethodGet {
+					fmt.Fprint(w, `{"pools": [{"id": "old-pool", "name": "pool_0_lb", "protocol": "TCP", "listeners": [{"id": "listener-id"}]}]}`)
+					return
+				}
+				var body struct {
+					Pool map[string]interface{} `json:"pool"`
+				}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				assert.Equal(t, "PROXY", body.Pool["protocol"])
+				if lbID, ok := body.Pool["loadbalancer_id"]; ok {
+					calls = append(calls, fmt.Sprintf("POST /lbaas/pools loadbalancer_id=%s", lbID))
+				} else {
+					calls = append(calls, fmt.Sprintf("POST /lbaas/pools listener_id=%s", body.Pool["listener_id"]))
+				}
+				if test.quotaExceeded && len(calls) == 1 {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `{"faultcode": "Client", "faultstring": "Quota has been met for resources: Pool"}`)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"pool": {"id": "new-pool", "name": "pool_0_lb", "protocol": "PROXY"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools/new-pool/members", func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprint(w, `{"members": []}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools/old-pool", func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				w.WriteHeader(http.StatusNoContent)
+			})
+			th.Mux.HandleFunc("/lbaas/listeners/listener-id", func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				th.TestJSONRequest(t, r, `{"listener": {"default_pool_id": "new-pool"}}`)
+				fmt.Fprint(w, `{"listener": {"id": "listener-id", "default_pool_id": "new-pool"}}`)
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				lb:   &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts: LoadBalancerOpts{ReconcileOrder: test.order, LBMethod: "ROUND_ROBIN"},
+			}}
+			listener := &listeners.Listener{ID: "listener-id", Protocol: "TCP", ProtocolPort: 80}
+			port := corev1.ServicePort{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+			pool, err := lbaas.ensureOctaviaPool(context.TODO(), "lb-id", "pool_0_lb", listener, service, port, nil, &serviceConfig{enableProxyProtocol: true})
+			assert.NoError(t, err)
+			assert.Equal(t, "new-pool", pool.ID)
+			assert.Equal(t, test.expectedCalls, calls)
+		})
+	}
+}
+
+func TestGetAntiAffinityGroup(t *testing.T) {
+	opts := LoadBalancerOpts{AntiAffinityAvailabilityZones: "az1,az2"}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	group, err := getAntiAffinityGroup(service, opts)
+	assert.NoError(t, err)
+	assert.Empty(t, group)
+
+	service.Annotations[ServiceAnnotationLoadBalancerAntiAffinityGroup] = " db "
+	group, err = getAntiAffinityGroup(service, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "db", group)
+
+	_, err = getAntiAffinityGroup(service, LoadBalancerOpts{})
+	assert.ErrorContains(t, err, "requires anti-affinity-availability-zones")
+
+	service.Annotations[ServiceAnnotationLoadBalancerAntiAffinityGroup] = strings.Repeat("a", 250)
+	_, err = getAntiAffinityGroup(service, opts)
+	assert.Error(t, err)
+}
+
+func TestSyncAntiAffinityGroupTag(t *testing.T) {
+	tags, changed := syncAntiAffinityGroupTag([]string{"kube_service_kubernetes_default_db"}, "db")
+	assert.True(t, changed)
+	assert.Equal(t, []string{"kube_service_kubernetes_default_db", "k8s_anti_affinity_group=db"}, tags)
+
+	_, changed = syncAntiAffinityGroupTag(tags, "db")
+	assert.False(t, changed)
+
+	tags, changed = syncAntiAffinityGroupTag(tags, "cache")
+	assert.True(t, changed)
+	assert.Equal(t, []string{"kube_service_kubernetes_default_db", "k8s_anti_affinity_group=cache"}, tags)
+
+	tags, changed = syncAntiAffinityGroupTag(tags, "")
+	assert.True(t, changed)
+	assert.Equal(t, []string{"kube_service_kubernetes_default_db"}, tags)
+}
+
+func TestPickAntiAffinityZone(t *testing.T) {
+	zones := []string{"az1", "az2", "az3"}
+	lb := func(zone, status string) loadbalancers.LoadBalancer {
+		return loadbalancers.LoadBalancer{AvailabilityZone: zone, ProvisioningStatus: status}
+	}
+
+	assert.Equal(t, "az1", pickAntiAffinityZone(zones, nil))
+	assert.Equal(t, "az2", pickAntiAffinityZone(zones, []loadbalancers.LoadBalancer{lb("az1", "ACTIVE")}))
+	assert.Equal(t, "az3", pickAntiAffinityZone(zones, []loadbalancers.LoadBalancer{lb("az1", "ACTIVE"), lb("az2", "PENDING_CREATE")}))
+	// Soft anti-affinity: the zones are shared once all of them hold a load balancer of the group
+	assert.Equal(t, "az2", pickAntiAffinityZone(zones, []loadbalancers.LoadBalancer{
+		lb("az1", "ACTIVE"), lb("az2", "ACTIVE"), lb("az3", "ACTIVE"), lb("az1", "ACTIVE"),
+	}))
+	// The load balancers being deleted and the ones in other zones aren't counted
+	assert.Equal(t, "az1", pickAntiAffinityZone(zones, []loadbalancers.LoadBalancer{lb("az1", "PENDING_DELETE"), lb("other", "ACTIVE")}))
+}
+
+func TestGetAntiAffinityAvailabilityZone(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	th.Mux.HandleFunc("/lbaas/loadbalancers", func(w http.ResponseWriter, r *http.Request) {
+		th.TestFormValues(t, r, map[string]string{"tags": "k8s_anti_affinity_group=db"})
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"loadbalancers": [
+			{"id": "lb-1", "availability_zone": "az1", "provisioning_status": "ACTIVE", "tags": ["k8s_cluster=kubernetes", "k8s_anti_affinity_group=db"]},
+			{"id": "lb-2", "availability_zone": "az2", "provisioning_status": "ACTIVE", "tags": ["k8s_cluster=other", "k8s_anti_affinity_group=db"]}
+		]}`)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		lb:   &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		opts: LoadBalancerOpts{AntiAffinityAvailabilityZones: "az1, az2"},
+	}}
+	zone, err := lbaas.getAntiAffinityAvailabilityZone("kubernetes", "db")
+	assert.NoError(t, err)
+	assert.Equal(t, "az2", zone)
+}
+
+func TestCountServiceResources(t *testing.T) {
+	sharedPool := v2pools.Pool{ID: "pool-shared", Members: []v2pools.Member{{ID: "m1"}, {ID: "m2"}}}
+	tree := &loadbalancers.LoadBalancer{
+		Listeners: []listeners.Listener{
+			{ID: "listener-1", Pools: []v2pools.Pool{sharedPool}},
+			{ID: "listener-2", Pools: []v2pools.Pool{sharedPool, {ID: "pool-l7", Members: []v2pools.Member{{ID: "m3"}}}}},
+			{ID: "listener-other", Pools: []v2pools.Pool{{ID: "pool-other", Members: []v2pools.Member{{ID: "m4"}}}}},
+		},
+	}
+
+	listenerCount, poolCount, memberCount := countServiceResources(tree, []string{"listener-1", "listener-2"})
+	assert.Equal(t, 2, listenerCount)
+	assert.Equal(t, 2, poolCount)
+	assert.Equal(t, 3, memberCount)
+
+	listenerCount, poolCount, memberCount = countServiceResources(tree, nil)
+	assert.Equal(t, 0, listenerCount)
+	assert.Equal(t, 0, poolCount)
+	assert.Equal(t, 0, memberCount)
+}
+
+func TestUpdateStatusesResourceMetrics(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	requests := 0
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-1/status", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"statuses": {"loadbalancer": {"id": "lb-1", "operating_status": "DEGRADED", "listeners": [
+			{"id": "listener-1", "pools": [{"id": "pool-1", "members": [{"id": "m1"}]}]}
+		]}}}`)
+	})
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	loadbalancer := &loadbalancers.LoadBalancer{ID: "lb-1", OperatingStatus: "ONLINE"}
+	lbaas := &LbaasV2{LoadBalancer{
+		lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+	}}
+
+	// The status tree is only got when the resource metrics are enabled.
+	lbaas.updateStatuses(context.TODO(), service, loadbalancer, []string{"listener-1"})
+	assert.Equal(t, 0, requests)
+
+	lbaas.opts.EnableResourceMetrics = true
+	lbaas.updateStatuses(context.TODO(), service, loadbalancer, []string{"listener-1"})
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, "ONLINE", loadbalancer.OperatingStatus)
+}
+
+func TestClaimRetainedVIPPort(t *testing.T) {
+	tests := []struct {
+		name       string
+		createOpts loadbalancers.CreateOpts
+		ports      string
+		wantPortID string
+		wantTagged bool
+		wantDelete bool
+	}{
+		{
+			name:       "no retained port",
+			createOpts: loadbalancers.CreateOpts{VipSubnetID: "subnet-id"},
+			ports:      `{"ports": []}`,
+		},
+		{
+			name:       "retained port reused",
+			createOpts: loadbalancers.CreateOpts{VipSubnetID: "subnet-id", VipNetworkID: "network-id", VipAddress: "10.0.0.10"},
+			ports:      `{"ports": [{"id": "port-id", "network_id": "network-id", "fixed_ips": [{"subnet_id": "subnet-id", "ip_address": "10.0.0.10"}]}]}`,
+			wantPortID: "port-id",
+			wantTagged: true,
+		},
+		{
+			name:       "retained port with another address released",
+			createOpts: loadbalancers.CreateOpts{VipSubnetID: "subnet-id", VipAddress: "10.0.0.20"},
+			ports:      `{"ports": [{"id": "port-id", "network_id": "network-id", "fixed_ips": [{"subnet_id": "subnet-id", "ip_address": "10.0.0.10"}]}]}`,
+			wantDelete: true,
+		},
+		{
+			name:       "retained port in another subnet released",
+			createOpts: loadbalancers.CreateOpts{VipSubnetID: "other-subnet-id"},
+			ports:      `{"ports": [{"id": "port-id", "network_id": "network-id", "fixed_ips": [{"subnet_id": "subnet-id", "ip_address": "10.0.0.10"}]}]}`,
+			wantDelete: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodGet)
+				assert.Equal(t, "retained_vip_kube_service_kubernetes_default_web", r.URL.Query().Get("name"))
+				assert.Equal(t, retainedVIPTag, r.URL.Query().Get("tags"))
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprint(w, test.ports)
+			})
+			tagged := false
+			th.Mux.HandleFunc("/ports/port-id/tags", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodPut)
+				tagged = true
+				fmt.Fprint(w, `{"tags": []}`)
+			})
+			deleted := false
+			th.Mux.HandleFunc("/ports/port-id", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodDelete)
+				deleted = true
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts:    LoadBalancerOpts{VIPRetentionPeriod: util.MyDuration{Duration: time.Hour}},
+			}}
+			createOpts := test.createOpts
+			err := lbaas.claimRetainedVIPPort("kube_service_kubernetes_default_web", &createOpts)
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantPortID, createOpts.VipPortID)
+			if test.wantPortID != "" {
+				assert.Empty(t, createOpts.VipSubnetID)
+				assert.Empty(t, createOpts.VipNetworkID)
+				assert.Empty(t, createOpts.VipAddress)
+			} else {
+				assert.Equal(t, test.createOpts, createOpts)
+			}
+			assert.Equal(t, test.wantTagged, tagged)
+			assert.Equal(t, test.wantDelete, deleted)
+		})
+	}
+}
+
+func TestRetainVIP(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"ports": []}`)
+		case http.MethodPost:
+			th.TestJSONRequest(t, r, `{"port": {
+				"name": "retained_vip_kube_service_kubernetes_default_web",
+				"network_id": "network-id",
+				"description": "Retained VIP address of deleted load balancer lb-id",
+				"fixed_ips": [{"subnet_id": "subnet-id", "ip_address": "10.0.0.10"}]
+			}}`)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"port": {"id": "port-id", "network_id": "network-id"}}`)
+		default:
+			t.Errorf("unexpected method %s", r.Method)
+		}
+	})
+	var tags []string
+	th.Mux.HandleFunc("/ports/port-id/tags", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPut)
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		tags = body.Tags
+		fmt.Fprint(w, `{"tags": []}`)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		opts:    LoadBalancerOpts{VIPRetentionPeriod: util.MyDuration{Duration: time.Hour}},
+	}}
+	lb := &loadbalancers.LoadBalancer{ID: "lb-id", VipAddress: "10.0.0.10", VipNetworkID: "network-id", VipSubnetID: "subnet-id", VipPortID: "vip-port-id"}
+
+	before := time.Now().Truncate(time.Second)
+	assert.NoError(t, lbaas.retainVIP("kube_service_kubernetes_default_web", lb))
+	assert.Len(t, tags, 2)
+	assert.Contains(t, tags, retainedVIPTag)
+	until, ok := getRetainedUntil(tags)
+	assert.True(t, ok)
+	assert.False(t, until.Before(before.Add(time.Hour)))
+	assert.False(t, until.After(time.Now().Add(time.Hour)))
+}
+
+func TestReleaseExpiredVIPs(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		assert.Equal(t, retainedVIPTag, r.URL.Query().Get("tags"))
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ports": [
+			{"id": "expired", "tags": ["kube_service_retained_vip", "kube_service_retained_until=2024-05-01T11:00:00Z"]},
+			{"id": "expired-in-use", "tags": ["kube_service_retained_vip", "kube_service_retained_until=2024-05-01T11:00:00Z"]},
+			{"id": "retained", "tags": ["kube_service_retained_vip", "kube_service_retained_until=2024-05-01T13:00:00Z"]},
+			{"id": "no-expiry", "tags": ["kube_service_retained_vip"]}
+		]}`)
+	})
+	th.Mux.HandleFunc("/lbaas/loadbalancers", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		w.Header().Add("Content-Type", "application/json")
+		if r.URL.Query().Get("vip_port_id") == "expired-in-use" {
+			fmt.Fprint(w, `{"loadbalancers": [{"id": "lb-id", "vip_port_id": "expired-in-use"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"loadbalancers": []}`)
+	})
+	var deleted []string
+	th.Mux.HandleFunc("/ports/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/ports/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		lb:      &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		opts:    LoadBalancerOpts{VIPRetentionPeriod: util.MyDuration{Duration: time.Hour}},
+	}}
+	assert.NoError(t, lbaas.releaseExpiredVIPs(now))
+	assert.Equal(t, []string{"expired"}, deleted)
+}
+
+func TestSelectMemberNodes(t *testing.T) {
+	var nodes []*corev1.Node
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}})
+	}
+	names := func(nodes []*corev1.Node) []string {
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+
+	selected := selectMemberNodes("default/web", nodes, nil, 4)
+	assert.Len(t, selected, 4)
+	assert.Equal(t, names(selected), names(selectMemberNodes("default/web", nodes, nil, 4)))
+	assert.NotEqual(t, names(selected), names(selectMemberNodes("default/api", nodes, nil, 4)))
+
+	// Removing a node that isn't selected doesn't change the subset.
+	var remaining []*corev1.Node
+	removed := false
+	for _, node := range nodes {
+		if !removed && !util.Contains(names(selected), node.Name) {
+			removed = true
+			continue
+		}
+		remaining = append(remaining, node)
+	}
+	assert.Len(t, remaining, 9)
+	assert.ElementsMatch(t, names(selected), names(selectMemberNodes("default/web", remaining, nil, 4)))
+
+	// The nodes hosting endpoints come first.
+	selected = selectMemberNodes("default/web", nodes, sets.New("node-3", "node-7"), 3)
+	assert.Len(t, selected, 3)
+	assert.ElementsMatch(t, []string{"node-3", "node-7"}, names(selected)[:2])
+}
+
+func TestLimitMemberNodes(t *testing.T) {
+	var nodes []*corev1.Node
+	for i := 0; i < 5; i++ {
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}})
+	}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	tests := []struct {
+		name      string
+		limit     int
+		wantNodes int
+		wantEvent string
+	}{
+		{name: "unlimited", limit: 0, wantNodes: 5},
+		{name: "under the limit", limit: 5, wantNodes: 5},
+		{
+			name:      "over the limit",
+			limit:     2,
+			wantNodes: 2,
+			wantEvent: "Warning LoadBalancerMemberLimit Service has 5 eligible nodes, only 2 of them are members of the load balancer pools as max-members-per-pool is 2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			lbaas := &LbaasV2{LoadBalancer{
+				opts:          LoadBalancerOpts{MaxMembersPerPool: test.limit},
+				eventRecorder: recorder,
+			}}
+			assert.Len(t, lbaas.limitMemberNodes(service, nodes), test.wantNodes)
+			if test.wantEvent != "" {
+				assert.Equal(t, test.wantEvent, <-recorder.Events)
+			}
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestGetFloatingIPPTRRecord(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "mail.example.com", want: "mail.example.com."},
+		{value: "mail.example.com.", want: "mail.example.com."},
+		{value: "mail_example.com", wantErr: true},
+	}
+
+	for _, test := range tests {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{ServiceAnnotationLoadBalancerFloatingIPPTRRecord: test.value},
+		}}
+		got, err := getFloatingIPPTRRecord(service)
+		if test.wantErr {
+			assert.Error(t, err, test.value)
+			continue
+		}
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.want, got, test.value)
+	}
+}
+
+func TestEnsureFloatingIPPTRRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   string
+		wantPatch bool
+	}{
+		{
+			name:      "no record",
+			current:   `{"id": "RegionOne:fip-id", "ptrdname": null, "description": null, "address": "172.24.4.10"}`,
+			wantPatch: true,
+		},
+		{
+			name:      "another record",
+			current:   `{"id": "RegionOne:fip-id", "ptrdname": "smtp.example.com.", "description": "Kubernetes Service default/mail", "address": "172.24.4.10"}`,
+			wantPatch: true,
+		},
+		{
+			name:    "record up to date",
+			current: `{"id": "RegionOne:fip-id", "ptrdname": "mail.example.com.", "description": "Kubernetes Service default/mail", "address": "172.24.4.10"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			patched := false
+			th.Mux.HandleFunc("/reverse/floatingips/RegionOne:fip-id", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				switch r.Method {
+				case http.MethodGet:
+					fmt.Fprint(w, test.current)
+				case http.MethodPatch:
+					th.TestJSONRequest(t, r, `{"ptrdname": "mail.example.com.", "description": "Kubernetes Service default/mail"}`)
+					patched = true
+					w.WriteHeader(http.StatusAccepted)
+					fmt.Fprint(w, `{}`)
+				default:
+					t.Errorf("unexpected method %s", r.Method)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				dns:    &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				region: "RegionOne",
+			}}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mail"}}
+			fip := &floatingips.FloatingIP{ID: "fip-id", FloatingIP: "172.24.4.10"}
+
+			err := lbaas.ensureFloatingIPPTRRecord(fip, service, &serviceConfig{fipPTRRecord: "mail.example.com."})
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantPatch, patched)
+		})
+	}
+}
+
+func TestDeleteFloatingIPPTRRecord(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	unset := false
+	th.Mux.HandleFunc("/reverse/floatingips/RegionOne:fip-id", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPatch)
+		th.TestJSONRequest(t, r, `{"ptrdname": null}`)
+		unset = true
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		dns:    &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		region: "RegionOne",
+	}}
+	fip := &floatingips.FloatingIP{ID: "fip-id", FloatingIP: "172.24.4.10"}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	assert.NoError(t, lbaas.deleteFloatingIPPTRRecord(fip, service))
+	assert.False(t, unset)
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerFloatingIPPTRRecord: "mail.example.com"}
+	assert.NoError(t, lbaas.deleteFloatingIPPTRRecord(fip, service))
+	assert.True(t, unset)
+}
+
+func TestSyncSecurityGroupTags(t *testing.T) {
+	wanted := []string{"kube_service_kubernetes_default_web", "k8s_cluster=kubernetes", "k8s_namespace=default", "k8s_name=web", "k8s_service_uid=uid"}
+	tests := []struct {
+		name        string
+		current     []string
+		want        []string
+		wantChanged bool
+	}{
+		{
+			name:        "untagged",
+			current:     nil,
+			want:        wanted,
+			wantChanged: true,
+		},
+		{
+			name:    "up to date",
+			current: wanted,
+			want:    wanted,
+		},
+		{
+			name:        "tags of others kept",
+			current:     []string{"audit=yes", "k8s_cluster=kubernetes"},
+			want:        append([]string{"audit=yes", "k8s_cluster=kubernetes"}, "kube_service_kubernetes_default_web", "k8s_namespace=default", "k8s_name=web", "k8s_service_uid=uid"),
+			wantChanged: true,
+		},
+		{
+			name:        "stale tags of the controller removed",
+			current:     append([]string{"k8s_cluster=old", "kube_service_old_default_web"}, wanted...),
+			want:        wanted,
+			wantChanged: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags, changed := syncSecurityGroupTags(test.current, wanted)
+			assert.Equal(t, test.want, tags)
+			assert.Equal(t, test.wantChanged, changed)
+		})
+	}
+}
+
+func TestEnsureSecurityGroupTags(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	tagged := 0
+	th.Mux.HandleFunc("/security-groups/sg-id/tags", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodPut)
+		th.TestJSONRequest(t, r, `{"tags": ["audit=yes", "kube_service_kubernetes_default_web", "k8s_cluster=kubernetes", "k8s_namespace=default", "k8s_name=web", "k8s_service_uid=uid"]}`)
+		tagged++
+		fmt.Fprint(w, `{"tags": []}`)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+	}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid"}}
+	tags := getResourceTags("kube_service_kubernetes_default_web", "kubernetes", service)
+
+	sg := &groups.SecGroup{ID: "sg-id", Tags: []string{"audit=yes"}}
+	assert.NoError(t, lbaas.ensureSecurityGroupTags(sg, tags))
+	assert.Equal(t, 1, tagged)
+
+	sg.Tags = append([]string{"audit=yes"}, tags...)
+	assert.NoError(t, lbaas.ensureSecurityGroupTags(sg, tags))
+	assert.Equal(t, 1, tagged)
+}
+
+func TestDeleteStaleSecurityGroups(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/security-groups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		th.TestFormValues(t, r, map[string]string{"tags": "k8s_cluster=kubernetes,k8s_namespace=default,k8s_name=web"})
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"security_groups": [
+			{"id": "current-sg", "name": "lb-sg-uid-default-web"},
+			{"id": "stale-sg", "name": "lb-sg-old-uid-default-web"},
+			{"id": "operator-sg", "name": "web-audit"}
+		]}`)
+	})
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodGet)
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ports": []}`)
+	})
+	var deleted []string
+	th.Mux.HandleFunc("/security-groups/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/security-groups/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{
+		network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+	}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "uid"}}
+
+	assert.NoError(t, lbaas.deleteStaleSecurityGroups("kubernetes", service, "current-sg"))
+	assert.Equal(t, []string{"stale-sg"}, deleted)
+
+	// Once the Service is deleted, all its security groups are.
+	deleted = nil
+	assert.NoError(t, lbaas.deleteStaleSecurityGroups("kubernetes", service, ""))
+	assert.Equal(t, []string{"current-sg", "stale-sg"}, deleted)
+}
+
+func TestPrefersCloseMembers(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "no annotation"},
+		{name: "topology mode auto", annotations: map[string]string{corev1.AnnotationTopologyMode: "Auto"}, expected: true},
+		{name: "topology mode disabled", annotations: map[string]string{corev1.AnnotationTopologyMode: "Disabled"}},
+		{name: "deprecated topology aware hints", annotations: map[string]string{corev1.DeprecatedAnnotationTopologyAwareHints: "auto"}, expected: true},
+		{
+			name:        "topology mode wins over deprecated annotation",
+			annotations: map[string]string{corev1.AnnotationTopologyMode: "Disabled", corev1.DeprecatedAnnotationTopologyAwareHints: "auto"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			assert.Equal(t, test.expected, prefersCloseMembers(service))
+		})
+	}
+}
+
+func TestBuildBatchUpdateMemberOptsTopology(t *testing.T) {
+	ready := true
+	zoneA, zoneB := "az-a", "az-b"
+	nodes := []*corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{corev1.LabelTopologyZone: zoneA}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{corev1.LabelTopologyZone: zoneB}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}}},
+		},
+	}
+	newSlice := func(zones ...*string) *discoveryv1.EndpointSlice {
+		slice := newTestEndpointSlice("test")
+		for _, zone := range zones {
+			slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Zone: zone, Conditions: discoveryv1.EndpointConditions{Ready: &ready}})
+		}
+		return slice
+	}
+
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		lbZone         string
+		provider       string
+		slice          *discoveryv1.EndpointSlice
+		expectedZone   string
+		expectedBackup map[string]bool
+	}{
+		{
+			name:           "local endpoints",
+			annotations:    map[string]string{corev1.AnnotationTopologyMode: "Auto"},
+			lbZone:         zoneA,
+			slice:          newSlice(&zoneA, &zoneB),
+			expectedZone:   zoneA,
+			expectedBackup: map[string]bool{"node-a": false, "node-b": true},
+		},
+		{
+			name:           "no local endpoints",
+			annotations:    map[string]string{corev1.AnnotationTopologyMode: "Auto"},
+			lbZone:         zoneA,
+			slice:          newSlice(&zoneB),
+			expectedBackup: map[string]bool{"node-a": false, "node-b": false},
+		},
+		{
+			name:           "no zone preference",
+			lbZone:         zoneA,
+			slice:          newSlice(&zoneA),
+			expectedBackup: map[string]bool{"node-a": false, "node-b": false},
+		},
+		{
+			name:           "no availability zone",
+			annotations:    map[string]string{corev1.AnnotationTopologyMode: "Auto"},
+			slice:          newSlice(&zoneA),
+			expectedBackup: map[string]bool{"node-a": false, "node-b": false},
+		},
+		{
+			name:           "ovn provider",
+			annotations:    map[string]string{corev1.AnnotationTopologyMode: "Auto"},
+			lbZone:         zoneA,
+			provider:       "ovn",
+			slice:          newSlice(&zoneA),
+			expectedBackup: map[string]bool{"node-a": false, "node-b": false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lbaas := &LbaasV2{LoadBalancer{
+				opts:          LoadBalancerOpts{LBProvider: test.provider},
+				drainingNodes: newNodeDrainTracker(),
+				endpoints: &serviceEndpointsWatcher{
+					endpointSliceLister: discoverylisters.NewEndpointSliceLister(newTestIndexer(test.slice)),
+					hasSynced:           func() bool { return true },
+				},
+			}}
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test", Annotations: test.annotations},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "test"}},
+			}
+			svcConf := &serviceConfig{}
+
+			lbaas.setPreferredMemberZone(service, &loadbalancers.LoadBalancer{AvailabilityZone: test.lbZone}, nodes, svcConf)
+			assert.Equal(t, test.expectedZone, svcConf.preferredMemberZone)
+
+			members, newMembers, err := lbaas.buildBatchUpdateMemberOpts(corev1.ServicePort{Port: 80, NodePort: 30080}, nodes, svcConf)
+			assert.NoError(t, err)
+			assert.Len(t, members, len(nodes))
+			for _, member := range members {
+				assert.Equal(t, test.expectedBackup[*member.Name], *member.Backup, *member.Name)
+				assert.Equal(t, 1, *member.Weight)
+			}
+			assert.True(t, newMembers.Has(fmt.Sprintf("node-b-10.0.0.2-30080-0-1-%t", test.expectedBackup["node-b"])))
+		})
+	}
+}
+
+func TestReconcileFloatingIPDrift(t *testing.T) {
+	lb := &loadbalancers.LoadBalancer{ID: "lb-id", VipPortID: "vip-port-id"}
+	tracked := `{"id": "fip-1", "floating_ip_address": "172.24.4.10", "port_id": "vm-port-id", "tags": ["kube_service_loadbalancer=lb-id"]}`
+	manual := &floatingips.FloatingIP{ID: "fip-2", FloatingIP: "172.24.4.20", PortID: "vip-port-id"}
+	created := func(clusterName string) string {
+		return fmt.Sprintf(`{"id": "fip-1", "floating_ip_address": "172.24.4.10", "description": "Floating IP for Kubernetes external service default/web from cluster %s", "tags": ["kube_service_loadbalancer=lb-id"]}`, clusterName)
+	}
+
+	tests := []struct {
+		name            string
+		drift           string
+		floatingIPs     string
+		current         *floatingips.FloatingIP
+		expectedFIP     string
+		expectedUpdates []string
+		expectedRelease bool
+		expectedDelete  bool
+		expectedEvent   string
+	}{
+		{
+			name:        "ignored",
+			drift:       fipDriftIgnore,
+			floatingIPs: tracked,
+			current:     manual,
+			expectedFIP: "fip-2",
+		},
+		{
+			name:        "no drift",
+			drift:       fipDriftReassociate,
+			floatingIPs: `{"id": "fip-1", "floating_ip_address": "172.24.4.10", "port_id": "vip-port-id", "tags": ["kube_service_loadbalancer=lb-id"]}`,
+			current:     &floatingips.FloatingIP{ID: "fip-1", FloatingIP: "172.24.4.10", PortID: "vip-port-id", Tags: []string{"kube_service_loadbalancer=lb-id"}},
+			expectedFIP: "fip-1",
+		},
+		{
+			name:            "manual re-association healed",
+			drift:           fipDriftReassociate,
+			floatingIPs:     tracked,
+			expectedFIP:     "fip-1",
+			expectedUpdates: []string{`fip-1:"vip-port-id"`},
+			expectedEvent:   "Warning LoadBalancerFloatingIPDrift Re-associated floating IP 172.24.4.10 with load balancer lb-id, it was associated with port vm-port-id outside of Kubernetes",
+		},
+		{
+			name:            "manual replacement healed",
+			drift:           fipDriftReassociate,
+			floatingIPs:     tracked,
+			current:         manual,
+			expectedFIP:     "fip-1",
+			expectedUpdates: []string{`fip-2:null`, `fip-1:"vip-port-id"`},
+			expectedEvent:   "Warning LoadBalancerFloatingIPDrift Re-associated floating IP 172.24.4.10 with load balancer lb-id, it was associated with port vm-port-id outside of Kubernetes",
+		},
+		{
+			name:            "manual re-association adopted",
+			drift:           fipDriftAdopt,
+			floatingIPs:     tracked,
+			current:         manual,
+			expectedFIP:     "fip-2",
+			expectedRelease: true,
+			expectedEvent:   "Warning LoadBalancerFloatingIPDrift Released floating IP 172.24.4.10 of load balancer lb-id, it was associated with port vm-port-id outside of Kubernetes",
+		},
+		{
+			name:           "manual replacement adopted",
+			drift:          fipDriftAdopt,
+			floatingIPs:    created("kubernetes"),
+			current:        manual,
+			expectedFIP:    "fip-2",
+			expectedDelete: true,
+			expectedEvent:  "Warning LoadBalancerFloatingIPDrift Deleted floating IP 172.24.4.10 of load balancer lb-id, it was replaced by floating IP 172.24.4.20 outside of Kubernetes",
+		},
+		{
+			name:            "manual replacement of a floating IP of another cluster adopted",
+			drift:           fipDriftAdopt,
+			floatingIPs:     created("other"),
+			current:         manual,
+			expectedFIP:     "fip-2",
+			expectedRelease: true,
+			expectedEvent:   "Warning LoadBalancerFloatingIPDrift Released floating IP 172.24.4.10 of load balancer lb-id, it was disassociated outside of Kubernetes",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var updates []string
+			released, deleted := false, false
+			th.Mux.HandleFunc("/floatingips", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "kube_service_loadbalancer=lb-id", r.URL.Query().Get("tags"))
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"floatingips": [%s]}`, test.floatingIPs)
+			})
+			th.Mux.HandleFunc("/floatingips/", func(w http.ResponseWriter, r *http.Request) {
+				id := strings.Split(strings.TrimPrefix(r.URL.Path, "/floatingips/"), "/")[0]
+				if r.Method == http.MethodDelete && r.URL.Path == "/floatingips/fip-1" {
+					deleted = true
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				if r.Method == http.MethodDelete {
+					assert.Equal(t, "/floatingips/fip-1/tags/kube_service_loadbalancer=lb-id", r.URL.Path)
+					released = true
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				var body struct {
+					FloatingIP struct {
+						PortID json.RawMessage `json:"port_id"`
+					} `json:"floatingip"`
+				}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				updates = append(updates, id+":"+string(body.FloatingIP.PortID))
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"floatingip": {"id": %q, "port_id": %s}}`, id, body.FloatingIP.PortID)
+			})
+
+			recorder := record.NewFakeRecorder(10)
+			lbaas := &LbaasV2{LoadBalancer{
+				network:       &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts:          LoadBalancerOpts{FloatingIPDrift: test.drift},
+				eventRecorder: recorder,
+			}}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+			fip, err := lbaas.reconcileFloatingIPDrift("kubernetes", service, lb, test.current)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedFIP, fip.ID)
+			assert.Equal(t, test.expectedUpdates, updates)
+			assert.Equal(t, test.expectedRelease, released)
+			assert.Equal(t, test.expectedDelete, deleted)
+			if test.expectedEvent != "" {
+				assert.Equal(t, test.expectedEvent, <-recorder.Events)
+			}
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestMemberStatusWatcher(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	statuses := map[string]string{"node-1": "ONLINE", "node-2": "ERROR", "node-3": "NO_MONITOR"}
+	requests := 0
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id/status", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		members := func(names ...string) string {
+			var members []string
+			for _, name := range names {
+				members = append(members, fmt.Sprintf(`{"name": %q, "operating_status": %q}`, name, statuses[name]))
+			}
+			return strings.Join(members, ", ")
+		}
+		// The pool of the other Service sharing the load balancer has a member down too, the pools are named after the
+		// load balancer rather than the Service.
+		fmt.Fprintf(w, `{"statuses": {"loadbalancer": {"id": "lb-id", "listeners": [
+			{"id": "listener-web-80", "pools": [{"id": "pool-1", "name": "pool_0_kube_service_kubernetes_default_web", "members": [%s]}]},
+			{"id": "listener-web-443", "pools": [{"id": "pool-1", "name": "pool_0_kube_service_kubernetes_default_web", "members": [%s]}]},
+			{"id": "listener-api-53", "pools": [{"id": "pool-2", "name": "pool_1_kube_service_kubernetes_default_web", "members": [{"name": "node-1", "operating_status": "ERROR"}]}]}
+		]}}}`, members("node-1", "node-2", "node-3"), members("node-1", "node-2", "node-3"))
+	})
+	th.Mux.HandleFunc("/lbaas/listeners", func(w http.ResponseWriter, r *http.Request) {
+		th.TestFormValues(t, r, map[string]string{"loadbalancer_id": "lb-id"})
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"listeners": [
+			{"id": "listener-web-80", "protocol": "HTTP", "protocol_port": 80},
+			{"id": "listener-web-443", "protocol": "TCP", "protocol_port": 443},
+			{"id": "listener-api-53", "protocol": "UDP", "protocol_port": 53}
+		]}`)
+	})
+
+	newService := func(name string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Annotations: map[string]string{ServiceAnnotationLoadBalancerID: "lb-id"}},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, Ports: ports},
+		}
+	}
+	services := newTestIndexer(
+		newService("web", corev1.ServicePort{Port: 80, Protocol: corev1.ProtocolTCP}, corev1.ServicePort{Port: 443, Protocol: corev1.ProtocolTCP}),
+		newService("api", corev1.ServicePort{Port: 53, Protocol: corev1.ProtocolUDP}, corev1.ServicePort{Port: 80, Protocol: corev1.ProtocolUDP}),
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-ip"}})
+
+	recorder := record.NewFakeRecorder(10)
+	lbaas := &LbaasV2{LoadBalancer{
+		lb:            &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+		eventRecorder: recorder,
+	}}
+	w := newMemberStatusWatcher(lbaas, corelisters.NewServiceLister(services))
+	events := func() []string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		sort.Strings(events)
+		return events
+	}
+
+	// The status tree of the shared load balancer is requested once.
+	w.refresh()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, []string{
+		"Warning LoadBalancerMemberDown Octavia reports the member of node node-1 as down in pools pool_1_kube_service_kubernetes_default_web of load balancer lb-id",
+		"Warning LoadBalancerMemberDown Octavia reports the member of node node-2 as down in pools pool_0_kube_service_kubernetes_default_web of load balancer lb-id",
+		"Warning LoadBalancerMemberDown Octavia reports the member of the node as down in load balancer lb-id of Service default/api",
+		"Warning LoadBalancerMemberDown Octavia reports the member of the node as down in load balancer lb-id of Service default/web",
+	}, events())
+
+	// The members still down aren't reported again.
+	w.refresh()
+	assert.Empty(t, events())
+
+	statuses["node-2"] = "ONLINE"
+	statuses["node-3"] = "ERROR"
+	w.refresh()
+	assert.Equal(t, []string{
+		"Normal LoadBalancerMemberUp Octavia reports the member of node node-2 as up again in load balancer lb-id",
+		"Warning LoadBalancerMemberDown Octavia reports the member of node node-3 as down in pools pool_0_kube_service_kubernetes_default_web of load balancer lb-id",
+		"Warning LoadBalancerMemberDown Octavia reports the member of the node as down in load balancer lb-id of Service default/web",
+	}, events())
+	assert.Equal(t, 3, requests)
+
+	// The Services gone are forgotten.
+	assert.NoError(t, services.Delete(newService("api")))
+	w.refresh()
+	assert.Len(t, w.down, 1)
+}
+
+func TestLoadBalancerName(t *testing.T) {
+	longCluster := strings.Repeat("c", 200)
+	longNamespace := strings.Repeat("n", 63)
+	longName := strings.Repeat("s", 63)
+
+	// The short names are unchanged
+	assert.Equal(t, "kube_service_kubernetes_default_web", loadBalancerName("kubernetes", "default", "web"))
+	assert.Equal(t, "", previousLoadBalancerName("kubernetes", "default", "web"))
+
+	name := loadBalancerName(longCluster, longNamespace, longName)
+	assert.Equal(t, lbNameMaxLength, len(name))
+	assert.True(t, strings.HasPrefix(name, servicePrefix+"ccc"))
+	assert.True(t, strings.HasSuffix(name, fmt.Sprintf("-%s_%s_%s", nameHash(longCluster), longNamespace, longName)))
+	// The longest names of the resources of the load balancer aren't cut by Octavia
+	assert.LessOrEqual(t, len(l7MonitorName(strings.Repeat("p", 15), name)), 255)
+
+	// Stable across reconciles, distinct for the clusters sharing the kept part of the name
+	assert.Equal(t, name, loadBalancerName(longCluster, longNamespace, longName))
+	assert.NotEqual(t, name, loadBalancerName(longCluster+"-2", longNamespace, longName))
+	assert.NotEqual(t, name, loadBalancerName(longCluster, longNamespace, "other"))
+
+	// The Services of the same cluster get the same cluster part
+	other := loadBalancerName(longCluster, "default", "web")
+	assert.Equal(t, lbNameMaxLength, len(other))
+	assert.True(t, strings.HasSuffix(other, fmt.Sprintf("-%s_default_web", nameHash(longCluster))))
+
+	// The previous releases cut the names at 255 characters
+	full := fmt.Sprintf("%s%s_%s_%s", servicePrefix, longCluster, longNamespace, longName)
+	assert.Equal(t, full[:255], previousLoadBalancerName(longCluster, longNamespace, longName))
+	assert.Equal(t, fmt.Sprintf("%s%s_default_web", servicePrefix, longCluster), previousLoadBalancerName(longCluster, "default", "web"))
+
+	// Not reached with valid Kubernetes names, the whole name is hashed then
+	name = loadBalancerName("kubernetes", strings.Repeat("n", 150), longName)
+	assert.Equal(t, lbNameMaxLength, len(name))
+	assert.True(t, strings.HasPrefix(name, "kube_service_kubernetes_nnn"))
+}
+
+func TestMigrateLoadBalancerName(t *testing.T) {
+	cluster := strings.Repeat("c", 200)
+	lbName := loadBalancerName(cluster, "default", "web")
+	previousName := previousLoadBalancerName(cluster, "default", "web")
+
+	tests := []struct {
+		name        string
+		lb          loadbalancers.LoadBalancer
+		wantUpdates []string
+		wantLB      loadbalancers.LoadBalancer
+	}{
+		{
+			name:   "renamed already",
+			lb:     loadbalancers.LoadBalancer{ID: "lb-id", Name: lbName, ProvisioningStatus: activeStatus, Tags: []string{lbName}},
+			wantLB: loadbalancers.LoadBalancer{ID: "lb-id", Name: lbName, ProvisioningStatus: activeStatus, Tags: []string{lbName}},
+		},
+		{
+			name:   "not ACTIVE",
+			lb:     loadbalancers.LoadBalancer{ID: "lb-id", Name: previousName, ProvisioningStatus: errorStatus, Tags: []string{previousName}},
+			wantLB: loadbalancers.LoadBalancer{ID: "lb-id", Name: previousName, ProvisioningStatus: errorStatus, Tags: []string{previousName}},
+		},
+		{
+			name: "owned",
+			lb:   loadbalancers.LoadBalancer{ID: "lb-id", Name: previousName, ProvisioningStatus: activeStatus, Tags: []string{previousName, "k8s_name=web"}},
+			wantUpdates: []string{
+				fmt.Sprintf(`listeners/listener-owned {"listener":{"name":"listener_0_%[1]s","tags":["%[1]s"]}}`, lbName),
+				fmt.Sprintf(`l7policies/policy-owned {"l7policy":{"name":"l7policy_xff_0_%s"}}`, lbName),
+				fmt.Sprintf(`listeners/listener-untagged {"listener":{"name":"listener_1_%s"}}`, lbName),
+				fmt.Sprintf(`pools/pool-owned {"pool":{"name":"pool_0_%[1]s","tags":["%[1]s"]}}`, lbName),
+				fmt.Sprintf(`pools/pool-l7 {"pool":{"name":"pool_l7_http_%s"}}`, lbName),
+				fmt.Sprintf(`loadbalancers/lb-id {"loadbalancer":{"tags":["%s","k8s_name=web"]}}`, lbName),
+				fmt.Sprintf(`loadbalancers/lb-id {"loadbalancer":{"name":"%s"}}`, lbName),
+			},
+			wantLB: loadbalancers.LoadBalancer{ID: "lb-id", Name: lbName, ProvisioningStatus: activeStatus, Tags: []string{lbName, "k8s_name=web"}},
+		},
+		{
+			name: "shared",
+			lb:   loadbalancers.LoadBalancer{ID: "lb-id", Name: "shared", ProvisioningStatus: activeStatus, Tags: []string{"kube_service_other", previousName}},
+			wantUpdates: []string{
+				fmt.Sprintf(`listeners/listener-owned {"listener":{"name":"listener_0_%[1]s","tags":["%[1]s"]}}`, lbName),
+				fmt.Sprintf(`l7policies/policy-owned {"l7policy":{"name":"l7policy_xff_0_%s"}}`, lbName),
+				fmt.Sprintf(`pools/pool-owned {"pool":{"name":"pool_0_%[1]s","tags":["%[1]s"]}}`, lbName),
+				fmt.Sprintf(`pools/pool-l7 {"pool":{"name":"pool_l7_http_%s"}}`, lbName),
+				fmt.Sprintf(`loadbalancers/lb-id {"loadbalancer":{"tags":["kube_service_other","%s"]}}`, lbName),
+			},
+			wantLB: loadbalancers.LoadBalancer{ID: "lb-id", Name: "shared", ProvisioningStatus: activeStatus, Tags: []string{"kube_service_other", lbName}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			var updates []string
+			record := func(w http.ResponseWriter, r *http.Request, response string) {
+				w.Header().Add("Content-Type", "application/json")
+				if r.Method == http.MethodPut {
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(t, err)
+					updates = append(updates, strings.TrimPrefix(r.URL.Path, "/lbaas/")+" "+string(body))
+				}
+				fmt.Fprint(w, response)
+			}
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				record(w, r, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/listeners", func(w http.ResponseWriter, r *http.Request) {
+				th.TestFormValues(t, r, map[string]string{"loadbalancer_id": "lb-id"})
+				record(w, r, fmt.Sprintf(`{"listeners": [
+					{"id": "listener-owned", "name": "listener_0_%[1]s", "tags": ["%[1]s"]},
+					{"id": "listener-untagged", "name": "listener_1_%[1]s"},
+					{"id": "listener-other", "name": "listener_0_kube_service_other", "tags": ["kube_service_other"]}
+				]}`, previousName))
+			})
+			th.Mux.HandleFunc("/lbaas/listeners/", func(w http.ResponseWriter, r *http.Request) {
+				record(w, r, `{"listener": {}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/l7policies", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("listener_id") == "listener-owned" {
+					record(w, r, fmt.Sprintf(`{"l7policies": [{"id": "policy-owned", "name": "l7policy_xff_0_%s"}]}`, previousName))
+					return
+				}
+				record(w, r, `{"l7policies": []}`)
+			})
+			th.Mux.HandleFunc("/lbaas/l7policies/", func(w http.ResponseWriter, r *http.Request) {
+				record(w, r, `{"l7policy": {}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools", func(w http.ResponseWriter, r *http.Request) {
+				record(w, r, fmt.Sprintf(`{"pools": [
+					{"id": "pool-owned", "name": "pool_0_%[1]s", "tags": ["%[1]s"]},
+					{"id": "pool-l7", "name": "pool_l7_http_%[1]s"},
+					{"id": "pool-other", "name": "pool_0_kube_service_other", "tags": ["kube_service_other"]}
+				]}`, previousName))
+			})
+			th.Mux.HandleFunc("/lbaas/pools/", func(w http.ResponseWriter, r *http.Request) {
+				record(w, r, `{"pool": {}}`)
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{lb: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			lb := test.lb
+			assert.NoError(t, lbaas.migrateLoadBalancerName(&lb, lbName, previousName))
+			assert.Equal(t, test.wantUpdates, updates)
+			assert.Equal(t, test.wantLB, lb)
+		})
+	}
+}
+
+func TestEnsurePoolMembersSubnetChange(t *testing.T) {
+	type member struct {
+		Name            string `json:"name"`
+		Address         string `json:"address"`
+		ProtocolPort    int    `json:"protocol_port"`
+		SubnetID        string `json:"subnet_id,omitempty"`
+		Weight          int    `json:"weight"`
+		OperatingStatus string `json:"operating_status,omitempty"`
+		UpdatedAt       string `json:"updated_at,omitempty"`
+	}
+	old := member{Name: "node-1", Address: "10.0.0.1", ProtocolPort: 30080, SubnetID: "old-subnet", Weight: 1}
+	moved := member{Name: "node-1", Address: "10.1.0.1", ProtocolPort: 30080, SubnetID: "new-subnet", Weight: 1}
+	drained := old
+	drained.Weight = 0
+	// with returns the member as Octavia reports it.
+	with := func(m member, status string, updated time.Duration) member {
+		m.OperatingStatus = status
+		m.UpdatedAt = time.Now().Add(-updated).UTC().Format(gophercloud.RFC3339NoZ)
+		return m
+	}
+
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		members     []member
+		// Status of the members created
+		newStatus   string
+		wantUpdates [][]member
+		wantPending bool
+	}{
+		{
+			name:        "moved once the new member is ONLINE",
+			members:     []member{with(old, "ONLINE", time.Hour)},
+			newStatus:   "ONLINE",
+			wantUpdates: [][]member{{moved, old}, {moved}},
+		},
+		{
+			name:        "drained for the node drain grace period",
+			gracePeriod: time.Hour,
+			members:     []member{with(old, "ONLINE", time.Hour)},
+			newStatus:   "ONLINE",
+			wantUpdates: [][]member{{moved, old}, {moved, drained}},
+		},
+		{
+			name:        "still draining",
+			gracePeriod: time.Hour,
+			members:     []member{with(moved, "ONLINE", time.Minute), with(drained, "ONLINE", time.Minute)},
+		},
+		{
+			name:        "deleted after the node drain grace period",
+			gracePeriod: time.Hour,
+			members:     []member{with(moved, "ONLINE", 2*time.Hour), with(drained, "ONLINE", 2*time.Hour)},
+			wantUpdates: [][]member{{moved}},
+		},
+		{
+			// The members of a monitored pool are NO_MONITOR until they're first checked.
+			name:        "previous member kept while the new one is not checked yet",
+			members:     []member{with(old, "ONLINE", time.Hour)},
+			newStatus:   "NO_MONITOR",
+			wantUpdates: [][]member{{moved, old}},
+			wantPending: true,
+		},
+		{
+			name:        "drained member back while the new one is down",
+			gracePeriod: time.Hour,
+			members:     []member{with(moved, "ERROR", time.Minute), with(drained, "ONLINE", time.Minute)},
+			wantUpdates: [][]member{{moved, old}},
+			wantPending: true,
+		},
+		{
+			name:        "previous member down too",
+			members:     []member{with(old, "ERROR", time.Hour)},
+			newStatus:   "ERROR",
+			wantUpdates: [][]member{{moved, old}, {moved}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			stored := append([]member{}, test.members...)
+			var updates [][]member
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+			})
+			th.Mux.HandleFunc("/lbaas/pools/pool-id/members", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					w.Header().Add("Content-Type", "application/json")
+					assert.NoError(t, json.NewEncoder(w).Encode(map[string][]member{"members": stored}))
+				case http.MethodPut:
+					var body struct {
+						Members []member `json:"members"`
+					}
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					updates = append(updates, body.Members)
+					// The members kept by the batch update keep their status.
+					var members []member
+					for _, m := range body.Members {
+						m = with(m, test.newStatus, 0)
+						for _, s := range stored {
+							if s.Address == m.Address {
+								m.OperatingStatus = s.OperatingStatus
+							}
+						}
+						members = append(members, m)
+					}
+					stored = members
+					w.WriteHeader(http.StatusAccepted)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{
+				lb:   &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()},
+				opts: LoadBalancerOpts{NodeDrainGracePeriod: util.MyDuration{Duration: test.gracePeriod}},
+			}}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+			port := corev1.ServicePort{Port: 80, NodePort: 30080, Protocol: corev1.ProtocolTCP}
+			// The node was re-IPed on the new subnet
+			nodes := []*corev1.Node{{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+				Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.1.0.1"}}},
+			}}
+
+			svcConf := &serviceConfig{lbMemberSubnetID: "new-subnet", memberMoves: new(pendingMemberMoves)}
+			err := lbaas.ensurePoolMembers(context.TODO(), "lb-id", &v2pools.Pool{ID: "pool-id", MonitorID: "monitor-id"}, service, port, nodes, svcConf)
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantUpdates, updates)
+
+			// The moves still pending put off the next reconcile instead of being waited for.
+			err = svcConf.memberMoves.err()
+			if test.wantPending {
+				var retryErr *api.RetryError
+				assert.ErrorAs(t, err, &retryErr)
+				assert.Equal(t, memberMoveRetryDelay, retryErr.RetryAfter())
+				assert.ErrorContains(t, err, "members of nodes node-1 on their new addresses are not ONLINE in pool pool-id yet")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMoveMembersCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	// No member is created once the reconcile is canceled, e.g. when another port of the Service failed.
+	lbaas := &LbaasV2{}
+	moves := []memberMove{{old: v2pools.Member{Name: "node-1", Address: "10.0.0.1", ProtocolPort: 30080}, new: v2pools.BatchUpdateMemberOpts{Address: "10.1.0.1", ProtocolPort: 30080}}}
+	_, _, _, err := lbaas.moveMembers(ctx, "lb-id", &v2pools.Pool{ID: "pool-id"}, moves, nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestEnsureFloatingIPQosPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		policyID   string
+		wantUpdate string
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name:       "associated",
+			policyID:   "policy-id",
+			wantUpdate: `{"floatingip": {"qos_policy_id": "policy-id"}}`,
+		},
+		{
+			name:     "unchanged",
+			current:  "policy-id",
+			policyID: "policy-id",
+		},
+		{
+			name:       "changed",
+			current:    "old-policy-id",
+			policyID:   "policy-id",
+			wantUpdate: `{"floatingip": {"qos_policy_id": "policy-id"}}`,
+		},
+		{
+			name:       "removed",
+			current:    "policy-id",
+			wantUpdate: `{"floatingip": {"qos_policy_id": null}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			updated := false
+			th.Mux.HandleFunc("/floatingips/fip-id", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				switch r.Method {
+				case http.MethodGet:
+					fmt.Fprintf(w, `{"floatingip": {"id": "fip-id", "floating_ip_address": "172.24.4.10", "qos_policy_id": %q}}`, test.current)
+				case http.MethodPut:
+					th.TestJSONRequest(t, r, test.wantUpdate)
+					updated = true
+					fmt.Fprint(w, `{"floatingip": {"id": "fip-id", "floating_ip_address": "172.24.4.10"}}`)
+				}
+			})
+
+			lbaas := &LbaasV2{LoadBalancer{network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+			fip := &floatingips.FloatingIP{ID: "fip-id", FloatingIP: "172.24.4.10"}
+
+			assert.NoError(t, lbaas.ensureFloatingIPQosPolicy(fip, service, test.policyID))
+			assert.Equal(t, test.wantUpdate != "", updated)
+		})
+	}
+}
+
+func TestDeleteFloatingIPQosPolicy(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	var requests []string
+	th.Mux.HandleFunc("/floatingips/fip-id", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method)
+		w.Header().Add("Content-Type", "application/json")
+		if r.Method == http.MethodPut {
+			th.TestJSONRequest(t, r, `{"floatingip": {"qos_policy_id": null}}`)
+		}
+		fmt.Fprint(w, `{"floatingip": {"id": "fip-id", "floating_ip_address": "172.24.4.10", "qos_policy_id": "policy-id"}}`)
+	})
+
+	lbaas := &LbaasV2{LoadBalancer{network: &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}}}
+	fip := &floatingips.FloatingIP{ID: "fip-id", FloatingIP: "172.24.4.10"}
+
+	// The floating IPs of the Services without the annotation are left alone.
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	assert.NoError(t, lbaas.deleteFloatingIPQosPolicy(fip, service))
+	assert.Empty(t, requests)
+
+	service.Annotations = map[string]string{ServiceAnnotationLoadBalancerFloatingIPQosPolicyID: "policy-id"}
+	assert.NoError(t, lbaas.deleteFloatingIPQosPolicy(fip, service))
+	assert.Equal(t, []string{http.MethodGet, http.MethodPut}, requests)
+}
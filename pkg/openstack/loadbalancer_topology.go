@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// prefersCloseMembers returns true if the Service enables topology aware routing, so that the traffic is kept in the
+// zone it enters the cluster from whenever possible.
+// TODO: honor spec.trafficDistribution: PreferClose as well once k8s.io/api is bumped to v0.30.
+func prefersCloseMembers(service *corev1.Service) bool {
+	if mode, ok := service.Annotations[corev1.AnnotationTopologyMode]; ok {
+		return strings.EqualFold(mode, "auto")
+	}
+	return strings.EqualFold(service.Annotations[corev1.DeprecatedAnnotationTopologyAwareHints], "auto")
+}
+
+// setPreferredMemberZone sets the zone of the members preferred for the Service: the availability zone of its load
+// balancer, when the Service prefers close members and has ready endpoints in that zone. The members of the other
+// zones become backup members, all the members are used alike when none of the endpoints is in the zone.
+func (lbaas *LbaasV2) setPreferredMemberZone(service *corev1.Service, loadbalancer *loadbalancers.LoadBalancer, nodes []*corev1.Node, svcConf *serviceConfig) {
+	svcConf.preferredMemberZone = ""
+	zone := loadbalancer.AvailabilityZone
+	if !prefersCloseMembers(service) || zone == "" {
+		return
+	}
+	if lbaas.opts.LBProvider == "ovn" {
+		klog.V(4).InfoS("Ignoring topology aware routing, the ovn provider doesn't support backup members", "service", klog.KObj(service))
+		return
+	}
+
+	if !lbaas.endpoints.readyEndpointZones(service).Has(zone) {
+		klog.V(2).InfoS("No ready endpoints in the availability zone of the load balancer, using the members of all zones", "service", klog.KObj(service), "zone", zone)
+		return
+	}
+	for _, node := range nodes {
+		if node.Labels[corev1.LabelTopologyZone] == zone {
+			svcConf.preferredMemberZone = zone
+			return
+		}
+	}
+	klog.V(2).InfoS("No nodes in the availability zone of the load balancer, using the members of all zones", "service", klog.KObj(service), "zone", zone)
+}
+
+// isBackupMemberNode returns true if the member of the node only gets traffic when the preferred members are down.
+func isBackupMemberNode(node *corev1.Node, svcConf *serviceConfig) bool {
+	return svcConf.preferredMemberZone != "" && node.Labels[corev1.LabelTopologyZone] != svcConf.preferredMemberZone
+}
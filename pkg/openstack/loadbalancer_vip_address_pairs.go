@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// parseAllowedAddressPairs parses a comma separated list of IP addresses and CIDRs. The CIDRs are normalized to their
+// network address and the ones of a single address to the address, as Neutron compares them as strings. The CIDRs
+// matching any address are rejected, they would disable the anti-spoofing of the port altogether.
+func parseAllowedAddressPairs(value string) ([]neutronports.AddressPair, error) {
+	pairs := []neutronports.AddressPair{}
+	seen := sets.New[string]()
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		normalized, err := normalizeAllowedAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		if seen.Has(normalized) {
+			continue
+		}
+		seen.Insert(normalized)
+		pairs = append(pairs, neutronports.AddressPair{IPAddress: normalized})
+	}
+	return pairs, nil
+}
+
+func normalizeAllowedAddress(address string) (string, error) {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String(), nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return "", fmt.Errorf("%q is neither an IP address nor a CIDR", address)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if ones == 0 {
+		return "", fmt.Errorf("CIDR %q matches any address", address)
+	}
+	if ones == bits {
+		return ipNet.IP.String(), nil
+	}
+	return ipNet.String(), nil
+}
+
+// getVIPAllowedAddressPairs returns the allowed address pairs of the VIP port set by the vip-allowed-address-pairs
+// annotation, or nil if it isn't set and the allowed address pairs are left as is. An empty annotation removes them.
+func getVIPAllowedAddressPairs(service *corev1.Service) (*[]neutronports.AddressPair, error) {
+	value, ok := service.Annotations[ServiceAnnotationLoadBalancerVIPAllowedAddressPairs]
+	if !ok {
+		return nil, nil
+	}
+	pairs, err := parseAllowedAddressPairs(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of annotation %s: %v", ServiceAnnotationLoadBalancerVIPAllowedAddressPairs, err)
+	}
+	return &pairs, nil
+}
+
+// allowedAddressPairsEqual tells if both lists allow the same addresses. The MAC addresses aren't compared, the ones
+// of the wanted pairs are left for Neutron to default to the MAC address of the port.
+func allowedAddressPairsEqual(current, wanted []neutronports.AddressPair) bool {
+	currentAddresses := sets.New[string]()
+	for _, pair := range current {
+		address, err := normalizeAllowedAddress(pair.IPAddress)
+		if err != nil {
+			address = pair.IPAddress
+		}
+		currentAddresses.Insert(address)
+	}
+	wantedAddresses := sets.New[string]()
+	for _, pair := range wanted {
+		wantedAddresses.Insert(pair.IPAddress)
+	}
+	return currentAddresses.Equal(wantedAddresses)
+}
+
+// ensureVIPAllowedAddressPairs sets the allowed address pairs of the VIP port to the ones of
+// vip-allowed-address-pairs. It's a no-op when the annotation isn't set.
+func (lbaas *LbaasV2) ensureVIPAllowedAddressPairs(portID string, svcConf *serviceConfig) error {
+	if svcConf.vipAllowedAddressPairs == nil || portID == "" {
+		return nil
+	}
+
+	mc := metrics.NewMetricContext("port", "get")
+	port, err := neutronports.Get(lbaas.network, portID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to get VIP port %s: %v", portID, err)
+	}
+	if allowedAddressPairsEqual(port.AllowedAddressPairs, *svcConf.vipAllowedAddressPairs) {
+		return nil
+	}
+
+	klog.InfoS("Updating allowed address pairs of VIP port", "portID", portID, "allowedAddressPairs", *svcConf.vipAllowedAddressPairs)
+	mc = metrics.NewMetricContext("port", "update")
+	_, err = neutronports.Update(lbaas.network, portID, neutronports.UpdateOpts{AllowedAddressPairs: svcConf.vipAllowedAddressPairs}).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to update allowed address pairs of VIP port %s: %v", portID, err)
+	}
+	return nil
+}
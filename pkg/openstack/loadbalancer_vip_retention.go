@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	neutrontags "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoutil "k8s.io/cloud-provider-openstack/pkg/util"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+)
+
+// The VIP address of a deleted load balancer is retained by a Neutron port named after the load balancer, found by
+// retainedVIPTag. retainedVIPUntilTag holds the time the port gets released at, in RFC 3339.
+const (
+	retainedVIPPortPrefix = "retained_vip_"
+	retainedVIPTag        = "kube_service_retained_vip"
+	retainedVIPUntilTag   = "kube_service_retained_until="
+
+	// vipReaperInterval is the interval of the release of the expired retained VIP ports.
+	vipReaperInterval = time.Minute
+)
+
+func retainedVIPPortName(lbName string) string {
+	return cpoutil.CutString255(retainedVIPPortPrefix + lbName)
+}
+
+// getRetainedUntil returns the time the retained VIP port with the tags gets released at.
+func getRetainedUntil(tags []string) (time.Time, bool) {
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, retainedVIPUntilTag); ok {
+			until, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return until, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (lbaas *LbaasV2) getRetainedVIPPort(lbName string) (*neutronports.Port, error) {
+	ports, err := openstackutil.GetPorts(lbaas.network, neutronports.ListOpts{Name: retainedVIPPortName(lbName), Tags: retainedVIPTag})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retained VIP port of load balancer %s: %v", lbName, err)
+	}
+	if len(ports) == 0 {
+		return nil, nil
+	}
+	return &ports[0], nil
+}
+
+// setRetainedUntil (re)starts the retention period of the retained VIP port.
+func (lbaas *LbaasV2) setRetainedUntil(portID string) error {
+	until := time.Now().Add(lbaas.opts.VIPRetentionPeriod.Duration).UTC().Format(time.RFC3339)
+	tags := []string{retainedVIPTag, retainedVIPUntilTag + until}
+	mc := metrics.NewMetricContext("port_tag", "update")
+	_, err := neutrontags.ReplaceAll(lbaas.network, "ports", portID, neutrontags.ReplaceAllOpts{Tags: tags}).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return fmt.Errorf("failed to update tags of retained VIP port %s: %v", portID, err)
+	}
+	return nil
+}
+
+func (lbaas *LbaasV2) deleteRetainedVIPPort(portID string) error {
+	mc := metrics.NewMetricContext("port", "delete")
+	err := neutronports.Delete(lbaas.network, portID).ExtractErr()
+	if err != nil && !cpoerrors.IsNotFound(err) {
+		_ = mc.ObserveRequest(err)
+		return fmt.Errorf("failed to delete retained VIP port %s: %v", portID, err)
+	}
+	_ = mc.ObserveRequest(nil)
+	return nil
+}
+
+// claimRetainedVIPPort makes the load balancer being created get the VIP address retained when it was deleted. The
+// retained port is used only if it matches the network, the subnet and the address requested for the VIP, otherwise
+// it gets released for the load balancer to be able to get the address.
+func (lbaas *LbaasV2) claimRetainedVIPPort(lbName string, createOpts *loadbalancers.CreateOpts) error {
+	port, err := lbaas.getRetainedVIPPort(lbName)
+	if err != nil || port == nil {
+		return err
+	}
+
+	matches := createOpts.VipNetworkID == "" || createOpts.VipNetworkID == port.NetworkID
+	if createOpts.VipSubnetID != "" || createOpts.VipAddress != "" {
+		found := false
+		for _, ip := range port.FixedIPs {
+			if (createOpts.VipSubnetID == "" || ip.SubnetID == createOpts.VipSubnetID) &&
+				(createOpts.VipAddress == "" || ip.IPAddress == createOpts.VipAddress) {
+				found = true
+				break
+			}
+		}
+		matches = matches && found
+	}
+	if !matches {
+		klog.InfoS("Releasing retained VIP port not matching the load balancer", "portID", port.ID, "lbName", lbName)
+		return lbaas.deleteRetainedVIPPort(port.ID)
+	}
+
+	// The retention period restarts for the port to get released if the load balancer fails to be created, the
+	// ports in use by load balancers are never released.
+	if err := lbaas.setRetainedUntil(port.ID); err != nil {
+		return err
+	}
+	klog.InfoS("Reusing retained VIP port", "portID", port.ID, "lbName", lbName)
+	createOpts.VipPortID = port.ID
+	createOpts.VipNetworkID = ""
+	createOpts.VipSubnetID = ""
+	createOpts.VipAddress = ""
+	return nil
+}
+
+// retainVIP keeps the VIP address of the deleted load balancer for vip-retention-period. The VIP port created by
+// Octavia is deleted along with the load balancer, the address is taken again by a new port. The retained port of a
+// load balancer created from it outlives the load balancer, only its retention period is restarted.
+func (lbaas *LbaasV2) retainVIP(lbName string, loadbalancer *loadbalancers.LoadBalancer) error {
+	port, err := lbaas.getRetainedVIPPort(lbName)
+	if err != nil {
+		return err
+	}
+	if port == nil {
+		createOpts := neutronports.CreateOpts{
+			Name:        retainedVIPPortName(lbName),
+			NetworkID:   loadbalancer.VipNetworkID,
+			Description: fmt.Sprintf("Retained VIP address of deleted load balancer %s", loadbalancer.ID),
+			FixedIPs:    []neutronports.IP{{SubnetID: loadbalancer.VipSubnetID, IPAddress: loadbalancer.VipAddress}},
+		}
+		mc := metrics.NewMetricContext("port", "create")
+		port, err = neutronports.Create(lbaas.network, createOpts).Extract()
+		if mc.ObserveRequest(err) != nil {
+			return fmt.Errorf("failed to create retained VIP port with address %s: %v", loadbalancer.VipAddress, err)
+		}
+	}
+	if err := lbaas.setRetainedUntil(port.ID); err != nil {
+		return err
+	}
+	klog.InfoS("Retained VIP address of deleted load balancer", "portID", port.ID, "address", loadbalancer.VipAddress, "lbName", lbName, "retentionPeriod", lbaas.opts.VIPRetentionPeriod.Duration)
+	return nil
+}
+
+// releaseExpiredVIPs deletes the retained VIP ports whose retention period is over, unless a load balancer uses them.
+func (lbaas *LbaasV2) releaseExpiredVIPs(now time.Time) error {
+	ports, err := openstackutil.GetPorts(lbaas.network, neutronports.ListOpts{Tags: retainedVIPTag})
+	if err != nil {
+		return fmt.Errorf("failed to list retained VIP ports: %v", err)
+	}
+	for _, port := range ports {
+		until, ok := getRetainedUntil(port.Tags)
+		if !ok || now.Before(until) {
+			continue
+		}
+		lbs, err := openstackutil.GetLoadBalancers(lbaas.lb, loadbalancers.ListOpts{VipPortID: port.ID})
+		if err != nil {
+			return fmt.Errorf("failed to list load balancers of retained VIP port %s: %v", port.ID, err)
+		}
+		if len(lbs) > 0 {
+			continue
+		}
+		klog.InfoS("Releasing expired retained VIP port", "portID", port.ID, "name", port.Name, "retainedUntil", until)
+		if err := lbaas.deleteRetainedVIPPort(port.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startRetainedVIPReaper periodically releases the expired retained VIP ports of all the regions until stopCh is
+// closed.
+func startRetainedVIPReaper(regional map[string]*LbaasV2, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		for region, lbaas := range regional {
+			if err := lbaas.releaseExpiredVIPs(time.Now()); err != nil {
+				klog.Errorf("Failed to release expired retained VIP ports in region %q: %v", region, err)
+			}
+		}
+	}, vipReaperInterval, stopCh)
+}
@@ -22,6 +22,8 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
@@ -31,13 +33,19 @@ import (
 	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/spf13/pflag"
 	gcfg "gopkg.in/gcfg.v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 
 	"k8s.io/client-go/informers"
 	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/cloud-provider-openstack/pkg/util"
@@ -61,6 +69,15 @@ var userAgentData []string
 // supportedLBProvider map is used to define LoadBalancer providers that we support
 var supportedLBProvider = []string{"amphora", "octavia", "ovn"}
 
+// Mechanisms the Service source ranges can be enforced with, set in source-ranges-enforcement
+const (
+	sourceRangesEnforcementAllowedCIDRs   = "allowed-cidrs"
+	sourceRangesEnforcementSecurityGroups = "security-groups"
+)
+
+// supportedListenerProtocols are the protocols of the listeners which can have their own [LoadBalancerListener] section
+var supportedListenerProtocols = []string{"TCP", "UDP", "SCTP", "HTTP", "HTTPS", "TERMINATED_HTTPS"}
+
 // supportedContainerStore map is used to define supported tls-container-ref store
 var supportedContainerStore = []string{"barbican", "external"}
 
@@ -76,44 +93,161 @@ type PortWithTrunkDetails struct {
 
 // LoadBalancer is used for creating and maintaining load balancers
 type LoadBalancer struct {
-	secret  *gophercloud.ServiceClient
-	network *gophercloud.ServiceClient
-	lb      *gophercloud.ServiceClient
-	opts    LoadBalancerOpts
-	kclient kubernetes.Interface
+	secret        *gophercloud.ServiceClient
+	dns           *gophercloud.ServiceClient
+	network       *gophercloud.ServiceClient
+	lb            *gophercloud.ServiceClient
+	opts          LoadBalancerOpts
+	kclient       kubernetes.Interface
+	eventRecorder record.EventRecorder
+	drainingNodes *nodeDrainTracker
+	endpoints     *serviceEndpointsWatcher
+	// description is the parsed description-template, the default one is used when it's nil.
+	description *template.Template
+	// namespaces lists the namespaces matched by the selectors of the [LoadBalancerProfile] sections, if any.
+	namespaces corelisters.NamespaceLister
+	// blueprints watches the LBBlueprint custom resources when enable-blueprints is set.
+	blueprints *blueprintWatcher
+	// region of the clients above
+	region string
+	// regional has the LbaasV2 of each region when several are configured.
+	regional map[string]*LbaasV2
 }
 
 // LoadBalancerOpts have the options to talk to Neutron LBaaSV2 or Octavia
 type LoadBalancerOpts struct {
-	Enabled                        bool                `gcfg:"enabled"`              // if false, disables the controller
-	LBVersion                      string              `gcfg:"lb-version"`           // overrides autodetection. Only support v2.
-	SubnetID                       string              `gcfg:"subnet-id"`            // overrides autodetection.
-	MemberSubnetID                 string              `gcfg:"member-subnet-id"`     // overrides autodetection.
-	NetworkID                      string              `gcfg:"network-id"`           // If specified, will create virtual ip from a subnet in network which has available IP addresses
-	FloatingNetworkID              string              `gcfg:"floating-network-id"`  // If specified, will create floating ip for loadbalancer, or do not create floating ip.
-	FloatingSubnetID               string              `gcfg:"floating-subnet-id"`   // If specified, will create floating ip for loadbalancer in this particular floating pool subnetwork.
-	FloatingSubnet                 string              `gcfg:"floating-subnet"`      // If specified, will create floating ip for loadbalancer in one of the matching floating pool subnetworks.
-	FloatingSubnetTags             string              `gcfg:"floating-subnet-tags"` // If specified, will create floating ip for loadbalancer in one of the matching floating pool subnetworks.
-	LBClasses                      map[string]*LBClass // Predefined named Floating networks and subnets
-	LBMethod                       string              `gcfg:"lb-method"` // default to ROUND_ROBIN.
-	LBProvider                     string              `gcfg:"lb-provider"`
-	CreateMonitor                  bool                `gcfg:"create-monitor"`
-	MonitorDelay                   util.MyDuration     `gcfg:"monitor-delay"`
-	MonitorTimeout                 util.MyDuration     `gcfg:"monitor-timeout"`
-	MonitorMaxRetries              uint                `gcfg:"monitor-max-retries"`
-	ManageSecurityGroups           bool                `gcfg:"manage-security-groups"`
-	InternalLB                     bool                `gcfg:"internal-lb"` // default false
-	CascadeDelete                  bool                `gcfg:"cascade-delete"`
-	FlavorID                       string              `gcfg:"flavor-id"`
-	AvailabilityZone               string              `gcfg:"availability-zone"`
-	EnableIngressHostname          bool                `gcfg:"enable-ingress-hostname"`            // Used with proxy protocol by adding a dns suffix to the load balancer IP address. Default false.
-	IngressHostnameSuffix          string              `gcfg:"ingress-hostname-suffix"`            // Used with proxy protocol by adding a dns suffix to the load balancer IP address. Default nip.io.
-	MaxSharedLB                    int                 `gcfg:"max-shared-lb"`                      //  Number of Services in maximum can share a single load balancer. Default 2
-	ContainerStore                 string              `gcfg:"container-store"`                    // Used to specify the store of the tls-container-ref
-	ProviderRequiresSerialAPICalls bool                `gcfg:"provider-requires-serial-api-calls"` // default false, the provider supportes the "bulk update" API call
+	Enabled                        bool                  `gcfg:"enabled"`              // if false, disables the controller
+	LBVersion                      string                `gcfg:"lb-version"`           // overrides autodetection. Only support v2.
+	SubnetID                       string                `gcfg:"subnet-id"`            // overrides autodetection.
+	MemberSubnetID                 string                `gcfg:"member-subnet-id"`     // overrides autodetection.
+	NetworkID                      string                `gcfg:"network-id"`           // If specified, will create virtual ip from a subnet in network which has available IP addresses
+	FloatingNetworkID              string                `gcfg:"floating-network-id"`  // If specified, will create floating ip for loadbalancer, or do not create floating ip.
+	FloatingSubnetID               string                `gcfg:"floating-subnet-id"`   // If specified, will create floating ip for loadbalancer in this particular floating pool subnetwork.
+	FloatingSubnet                 string                `gcfg:"floating-subnet"`      // If specified, will create floating ip for loadbalancer in one of the matching floating pool subnetworks.
+	FloatingSubnetTags             string                `gcfg:"floating-subnet-tags"` // If specified, will create floating ip for loadbalancer in one of the matching floating pool subnetworks.
+	LBClasses                      map[string]*LBClass   // Predefined named Floating networks and subnets
+	LBProfiles                     map[string]*LBProfile // Default annotations of the Services per namespace selector
+	LBMethod                       string                `gcfg:"lb-method"` // default to ROUND_ROBIN.
+	LBProvider                     string                `gcfg:"lb-provider"`
+	CreateMonitor                  bool                  `gcfg:"create-monitor"`
+	MonitorDelay                   util.MyDuration       `gcfg:"monitor-delay"`
+	MonitorTimeout                 util.MyDuration       `gcfg:"monitor-timeout"`
+	MonitorMaxRetries              uint                  `gcfg:"monitor-max-retries"`
+	MonitorMaxRetriesDown          uint                  `gcfg:"monitor-max-retries-down"`
+	ManageSecurityGroups           bool                  `gcfg:"manage-security-groups"`
+	InternalLB                     bool                  `gcfg:"internal-lb"` // default false
+	CascadeDelete                  bool                  `gcfg:"cascade-delete"`
+	FlavorID                       string                `gcfg:"flavor-id"`
+	AvailabilityZone               string                `gcfg:"availability-zone"`
+	EnableIngressHostname          bool                  `gcfg:"enable-ingress-hostname"`            // Used with proxy protocol by adding a dns suffix to the load balancer IP address. Default false.
+	IngressHostnameSuffix          string                `gcfg:"ingress-hostname-suffix"`            // Used with proxy protocol by adding a dns suffix to the load balancer IP address. Default nip.io.
+	MaxSharedLB                    int                   `gcfg:"max-shared-lb"`                      //  Number of Services in maximum can share a single load balancer. Default 2
+	ContainerStore                 string                `gcfg:"container-store"`                    // Used to specify the store of the tls-container-ref
+	ProviderRequiresSerialAPICalls bool                  `gcfg:"provider-requires-serial-api-calls"` // default false, the provider supportes the "bulk update" API call
+	PortReconcileConcurrency       int                   `gcfg:"port-reconcile-concurrency"`         // Number of Service ports reconciled in parallel. Default 1
+	OctaviaEndpointType            string                `gcfg:"octavia-endpoint-type"`              // overrides os-endpoint-type of [Global] for Octavia.
+	OctaviaAPIVersion              string                `gcfg:"octavia-api-version"`                // Octavia API version to use, features requiring a newer one are disabled.
+	DescriptionTemplate            string                `gcfg:"description-template"`               // Template of the description of the Octavia resources of a Service.
+	NodeDrainGracePeriod           util.MyDuration       `gcfg:"node-drain-grace-period"`            // How long members of draining nodes are kept with weight 0. Default 0, draining is disabled.
+	NodeDrainTaintKey              string                `gcfg:"node-drain-taint-key"`               // Key of the taint marking nodes as draining besides cordoning.
+	EventThrottleInterval          util.MyDuration       `gcfg:"event-throttle-interval"`            // How long identical events on a Service are dropped for after being emitted, doubling on every repeat. 0 disables it.
+	SourceRangesEnforcement        string                `gcfg:"source-ranges-enforcement"`          // Mechanism enforcing the Service source ranges, "allowed-cidrs" or "security-groups". Default empty, any available one.
+	NoEndpointsBehavior            string                `gcfg:"no-endpoints-behavior"`              // What happens to the members of Services without ready endpoints, "remove-members" or "keep-members". Default remove-members.
+	ConnectionLimit                int                   `gcfg:"connection-limit"`                   // Connection limit of the listeners, -1 is unlimited. Default -1.
+	TimeoutClientData              int                   `gcfg:"timeout-client-data"`                // Listener timeouts in milliseconds, used when the Octavia API supports them. Default 50000.
+	TimeoutMemberConnect           int                   `gcfg:"timeout-member-connect"`             // Default 5000.
+	TimeoutMemberData              int                   `gcfg:"timeout-member-data"`                // Default 50000.
+	TimeoutTCPInspect              int                   `gcfg:"timeout-tcp-inspect"`                // Default 0.
+	MemberSubnetHostRoutes         string                `gcfg:"member-subnet-host-routes"`          // Host routes added to the member subnet, e.g. "10.1.0.0/16 via 192.168.0.1, 10.2.0.0/16 via 192.168.0.2".
+	ServiceMappingConfigMap        string                `gcfg:"service-mapping-configmap"`          // "<namespace>/<name>" of a ConfigMap mapping the Services to their load balancers. Default empty, disabled.
+	FloatingIPTags                 bool                  `gcfg:"floating-ip-tags"`                   // Tag the floating IPs with the namespace and name of their Service. Default false.
+	FloatingIPTagAnnotations       string                `gcfg:"floating-ip-tag-annotations"`        // Comma separated keys of the Service annotations also added as tags when floating-ip-tags is set.
+	FloatingIPDrift                string                `gcfg:"floating-ip-drift"`                  // Handling of the floating IPs of the load balancers associated with another port outside of Kubernetes, "ignore", "reassociate" or "adopt". Default ignore.
+	StatusPollInterval             util.MyDuration       `gcfg:"status-poll-interval"`               // Interval of the polls of the load balancers waited for while their status changes. Default 1s.
+	StatusPollMaxInterval          util.MyDuration       `gcfg:"status-poll-max-interval"`           // Interval the polls slow down to while the status stays the same. Default 10s.
+	HandledClass                   string                `gcfg:"handled-class"`                      // Only the Services of this class are managed, from spec.loadBalancerClass or the class annotation. Default empty, all of them.
+	DefaultClass                   bool                  `gcfg:"default-class"`                      // Also manage the Services without a class when handled-class is set. Default false.
+	LoadBalancerIPConflicts        string                `gcfg:"load-balancer-ip-conflicts"`         // Handling of the Services requesting the same load balancer IP, "oldest-wins" or "ignore". Default oldest-wins.
+	MemberSecurityGroup            string                `gcfg:"member-security-group"`              // Name or ID of an existing security group getting the rules of the Services instead of one security group per Service.
+	MemberSecurityGroupTags        string                `gcfg:"member-security-group-tags"`         // Comma separated tags finding the existing security group, instead of member-security-group.
+	ReconcileOrder                 string                `gcfg:"reconcile-order"`                    // Order of the replacement of the listeners and pools of the Services, "create-first" or "delete-first". Default create-first.
+	DefaultExternalTrafficPolicy   string                `gcfg:"default-external-traffic-policy"`    // Traffic policy of the Services without spec.externalTrafficPolicy, "Cluster" or "Local". Default Cluster.
+	NoNodesBehavior                string                `gcfg:"no-nodes-behavior"`                  // What happens to the load balancers of Services with no eligible node, "fail", "empty-pools" or "keep-members". Default fail.
+	TerminatingServiceBehavior     string                `gcfg:"terminating-service-behavior"`       // What the reconciles of Services being deleted do, "skip" or "ensure". Default skip.
+	EnableBlueprints               bool                  `gcfg:"enable-blueprints"`                  // Watch the LBBlueprint custom resources selected by the Services with the blueprint annotation. Default false.
+	EnableResourceMetrics          bool                  `gcfg:"enable-resource-metrics"`            // Record the number of Octavia listeners, pools and members of the Services, with one more request per reconcile. Default false.
+	AntiAffinityAvailabilityZones  string                `gcfg:"anti-affinity-availability-zones"`   // Comma separated availability zones the load balancers of the Services of an anti-affinity group are spread across.
+	MaxMembersPerPool              int                   `gcfg:"max-members-per-pool"`               // Most members of a pool, the pools of the Services with more eligible nodes get a subset of them. Default 0, unlimited.
+	VIPRetentionPeriod             util.MyDuration       `gcfg:"vip-retention-period"`               // How long the VIP address of a deleted load balancer is kept for the Service to get it back when recreated. Default 0, disabled.
+	MemberStatusInterval           util.MyDuration       `gcfg:"member-status-interval"`             // Interval of the refreshes of the statuses of the members reported with events on the Services and nodes. Default 0, disabled.
 	// revive:disable:var-naming
 	TlsContainerRef string `gcfg:"default-tls-container-ref"` //  reference to a tls container
 	// revive:enable:var-naming
+
+	ListenerOpts map[string]*ListenerOpts // Listener settings per protocol, overriding the ones above
+}
+
+// ListenerOpts override the listener settings of [LoadBalancer] for the listeners of a protocol, the Service
+// annotations still win over them.
+type ListenerOpts struct {
+	ConnectionLimit      *int `gcfg:"connection-limit"`
+	TimeoutClientData    *int `gcfg:"timeout-client-data"`
+	TimeoutMemberConnect *int `gcfg:"timeout-member-connect"`
+	TimeoutMemberData    *int `gcfg:"timeout-member-data"`
+	TimeoutTCPInspect    *int `gcfg:"timeout-tcp-inspect"`
+}
+
+// defaultListenerOpts returns the listener settings of [LoadBalancer], used when neither a [LoadBalancerListener] section
+// nor the Service annotations override them.
+func (opts LoadBalancerOpts) defaultListenerOpts() *ListenerOpts {
+	return &ListenerOpts{
+		ConnectionLimit:      &opts.ConnectionLimit,
+		TimeoutClientData:    &opts.TimeoutClientData,
+		TimeoutMemberConnect: &opts.TimeoutMemberConnect,
+		TimeoutMemberData:    &opts.TimeoutMemberData,
+		TimeoutTCPInspect:    &opts.TimeoutTCPInspect,
+	}
+}
+
+// override sets the listener settings which are set in the other ones.
+func (opts *ListenerOpts) override(other *ListenerOpts) {
+	if other == nil {
+		return
+	}
+	if other.ConnectionLimit != nil {
+		opts.ConnectionLimit = other.ConnectionLimit
+	}
+	if other.TimeoutClientData != nil {
+		opts.TimeoutClientData = other.TimeoutClientData
+	}
+	if other.TimeoutMemberConnect != nil {
+		opts.TimeoutMemberConnect = other.TimeoutMemberConnect
+	}
+	if other.TimeoutMemberData != nil {
+		opts.TimeoutMemberData = other.TimeoutMemberData
+	}
+	if other.TimeoutTCPInspect != nil {
+		opts.TimeoutTCPInspect = other.TimeoutTCPInspect
+	}
+}
+
+// validate checks the listener settings aren't negative, except for the unlimited connection limit.
+func (opts *ListenerOpts) validate() error {
+	if opts.ConnectionLimit != nil && *opts.ConnectionLimit < -1 {
+		return fmt.Errorf("connection-limit must be -1 or more, got %d", *opts.ConnectionLimit)
+	}
+	timeouts := map[string]*int{
+		"timeout-client-data":    opts.TimeoutClientData,
+		"timeout-member-connect": opts.TimeoutMemberConnect,
+		"timeout-member-data":    opts.TimeoutMemberData,
+		"timeout-tcp-inspect":    opts.TimeoutTCPInspect,
+	}
+	for name, timeout := range timeouts {
+		if timeout != nil && *timeout < 0 {
+			return fmt.Errorf("%s must be 0 or more, got %d", name, *timeout)
+		}
+	}
+	return nil
 }
 
 // LBClass defines the corresponding floating network, floating subnet or internal subnet ID
@@ -127,6 +261,14 @@ type LBClass struct {
 	MemberSubnetID     string `gcfg:"member-subnet-id,omitempty"`
 }
 
+// LBProfile sets default annotations on the Services of the namespaces matching its selector, and on the Services
+// selecting it with the loadbalancer.openstack.org/profile annotation. The annotations of the Services win over them.
+type LBProfile struct {
+	NamespaceSelector string   `gcfg:"namespace-selector"` // label selector of the namespaces, empty matches all of them
+	Annotation        []string `gcfg:"annotation"`         // "<key>=<value>" default annotation, can be repeated
+	Explicit          bool     `gcfg:"explicit"`           // only applied to the Services selecting it with the annotation
+}
+
 // NetworkingOpts is used for networking settings
 type NetworkingOpts struct {
 	IPv6SupportDisabled bool     `gcfg:"ipv6-support-disabled"`
@@ -156,9 +298,22 @@ type OpenStack struct {
 	// InstanceID of the server where this OpenStack object is instantiated.
 	localInstanceID       string
 	kclient               kubernetes.Interface
+	eventBroadcaster      record.EventBroadcaster
+	eventRecorder         record.EventRecorder
 	useV1Instances        bool // TODO: v1 instance apis can be deleted after the v2 is verified enough
 	nodeInformer          coreinformers.NodeInformer
 	nodeInformerHasSynced func() bool
+	endpointsWatcher      *serviceEndpointsWatcher
+	drainingNodes         *nodeDrainTracker
+	namespaceLister       corelisters.NamespaceLister
+	serviceLister         corelisters.ServiceLister // Services whose members statuses are refreshed, see member-status-interval
+	blueprints            *blueprintWatcher
+	// regions the resources can be placed in, the first one is the region of epOpts.
+	regions []string
+	// lbaas is built by the first successful LoadBalancer() call and returned by the next ones, as it holds the
+	// regional clients and the state shared by the reconciles, e.g. the draining nodes. lbMu guards it.
+	lbMu  sync.Mutex
+	lbaas *LbaasV2
 }
 
 // Config is used to read and store information from the cloud configuration file
@@ -169,6 +324,12 @@ type Config struct {
 	Route             RouterOpts
 	Metadata          metadata.Opts
 	Networking        NetworkingOpts
+
+	// LoadBalancerListener has the listener settings per protocol, e.g. [LoadBalancerListener "HTTP"]
+	LoadBalancerListener map[string]*ListenerOpts
+
+	// LoadBalancerProfile has the default Service annotations per namespace selector, e.g. [LoadBalancerProfile "internal"]
+	LoadBalancerProfile map[string]*LBProfile
 }
 
 func init() {
@@ -192,6 +353,20 @@ func init() {
 func (os *OpenStack) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
 	clientset := clientBuilder.ClientOrDie("cloud-controller-manager")
 	os.kclient = clientset
+	os.eventBroadcaster = record.NewBroadcaster()
+	os.eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: os.kclient.CoreV1().Events("")})
+	os.eventRecorder = newThrottledEventRecorder(
+		os.eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "cloud-provider-openstack"}),
+		os.lbOpts.EventThrottleInterval.Duration)
+
+	if os.lbOpts.Enabled && os.lbOpts.EnableBlueprints {
+		blueprints, err := newBlueprintWatcher(clientBuilder.ConfigOrDie("cloud-controller-manager"), stop)
+		if err != nil {
+			klog.Errorf("Failed to watch the LBBlueprint custom resources, the Services selecting one won't be reconciled: %v", err)
+			return
+		}
+		os.blueprints = blueprints
+	}
 }
 
 // ReadConfig reads values from the cloud.conf
@@ -211,6 +386,7 @@ func ReadConfig(config io.Reader) (Config, error) {
 	cfg.LoadBalancer.MonitorDelay = util.MyDuration{Duration: 5 * time.Second}
 	cfg.LoadBalancer.MonitorTimeout = util.MyDuration{Duration: 3 * time.Second}
 	cfg.LoadBalancer.MonitorMaxRetries = 1
+	cfg.LoadBalancer.MonitorMaxRetriesDown = 3
 	cfg.LoadBalancer.CascadeDelete = true
 	cfg.LoadBalancer.EnableIngressHostname = false
 	cfg.LoadBalancer.IngressHostnameSuffix = defaultProxyHostnameSuffix
@@ -218,6 +394,23 @@ func ReadConfig(config io.Reader) (Config, error) {
 	cfg.LoadBalancer.ContainerStore = "barbican"
 	cfg.LoadBalancer.MaxSharedLB = 2
 	cfg.LoadBalancer.ProviderRequiresSerialAPICalls = false
+	cfg.LoadBalancer.PortReconcileConcurrency = 1
+	cfg.LoadBalancer.DescriptionTemplate = defaultDescriptionTemplate
+	cfg.LoadBalancer.EventThrottleInterval = util.MyDuration{Duration: 1 * time.Minute}
+	cfg.LoadBalancer.NoEndpointsBehavior = noEndpointsRemoveMembers
+	cfg.LoadBalancer.NoNodesBehavior = noNodesFail
+	cfg.LoadBalancer.TerminatingServiceBehavior = terminatingServiceSkip
+	cfg.LoadBalancer.LoadBalancerIPConflicts = lbIPConflictsOldestWins
+	cfg.LoadBalancer.FloatingIPDrift = fipDriftIgnore
+	cfg.LoadBalancer.ReconcileOrder = reconcileOrderCreateFirst
+	cfg.LoadBalancer.DefaultExternalTrafficPolicy = string(corev1.ServiceExternalTrafficPolicyCluster)
+	cfg.LoadBalancer.ConnectionLimit = -1
+	cfg.LoadBalancer.TimeoutClientData = 50000
+	cfg.LoadBalancer.TimeoutMemberConnect = 5000
+	cfg.LoadBalancer.TimeoutMemberData = 50000
+	cfg.LoadBalancer.TimeoutTCPInspect = 0
+	cfg.LoadBalancer.StatusPollInterval = util.MyDuration{Duration: openstackutil.DefaultStatusPollInterval}
+	cfg.LoadBalancer.StatusPollMaxInterval = util.MyDuration{Duration: openstackutil.DefaultStatusPollMaxInterval}
 
 	err := gcfg.FatalOnly(gcfg.ReadInto(&cfg, config))
 	if err != nil {
@@ -238,6 +431,9 @@ func ReadConfig(config io.Reader) (Config, error) {
 		klog.V(5).Infof("Config, loaded from the %s:", cfg.Global.CloudsFile)
 		client.LogCfg(cfg.Global)
 	}
+	if err := setRegions(&cfg.Global); err != nil {
+		return Config{}, err
+	}
 	// Set the default values for search order if not set
 	if cfg.Metadata.SearchOrder == "" {
 		cfg.Metadata.SearchOrder = fmt.Sprintf("%s,%s", metadata.ConfigDriveID, metadata.MetadataID)
@@ -251,6 +447,142 @@ func ReadConfig(config io.Reader) (Config, error) {
 		klog.Warningf("Unsupported Container Store: %s", cfg.LoadBalancer.ContainerStore)
 	}
 
+	if _, err := parseDescriptionTemplate(cfg.LoadBalancer.DescriptionTemplate); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.LoadBalancer.PortReconcileConcurrency < 1 {
+		return Config{}, fmt.Errorf("port-reconcile-concurrency must be at least 1, got %d", cfg.LoadBalancer.PortReconcileConcurrency)
+	}
+
+	switch cfg.LoadBalancer.SourceRangesEnforcement {
+	case "":
+	case sourceRangesEnforcementAllowedCIDRs:
+		if cfg.LoadBalancer.LBProvider == "ovn" {
+			return Config{}, fmt.Errorf("source-ranges-enforcement %q is not supported by the ovn provider", cfg.LoadBalancer.SourceRangesEnforcement)
+		}
+	case sourceRangesEnforcementSecurityGroups:
+		if !cfg.LoadBalancer.ManageSecurityGroups {
+			return Config{}, fmt.Errorf("source-ranges-enforcement %q requires manage-security-groups to be enabled", cfg.LoadBalancer.SourceRangesEnforcement)
+		}
+		// Amphorae replace the source IP of the traffic, the security groups of the members cannot filter on it.
+		if cfg.LoadBalancer.LBProvider != "ovn" {
+			return Config{}, fmt.Errorf("source-ranges-enforcement %q is only supported by the ovn provider", cfg.LoadBalancer.SourceRangesEnforcement)
+		}
+	default:
+		return Config{}, fmt.Errorf("unsupported source-ranges-enforcement %q, supported values are %q and %q",
+			cfg.LoadBalancer.SourceRangesEnforcement, sourceRangesEnforcementAllowedCIDRs, sourceRangesEnforcementSecurityGroups)
+	}
+
+	if cfg.LoadBalancer.NoEndpointsBehavior != noEndpointsRemoveMembers && cfg.LoadBalancer.NoEndpointsBehavior != noEndpointsKeepMembers {
+		return Config{}, fmt.Errorf("unsupported no-endpoints-behavior %q, supported values are %q and %q",
+			cfg.LoadBalancer.NoEndpointsBehavior, noEndpointsRemoveMembers, noEndpointsKeepMembers)
+	}
+
+	switch cfg.LoadBalancer.NoNodesBehavior {
+	case noNodesFail, noNodesEmptyPools, noNodesKeepMembers:
+	default:
+		return Config{}, fmt.Errorf("unsupported no-nodes-behavior %q, supported values are %q, %q and %q",
+			cfg.LoadBalancer.NoNodesBehavior, noNodesFail, noNodesEmptyPools, noNodesKeepMembers)
+	}
+
+	if cfg.LoadBalancer.TerminatingServiceBehavior != terminatingServiceSkip && cfg.LoadBalancer.TerminatingServiceBehavior != terminatingServiceEnsure {
+		return Config{}, fmt.Errorf("unsupported terminating-service-behavior %q, supported values are %q and %q",
+			cfg.LoadBalancer.TerminatingServiceBehavior, terminatingServiceSkip, terminatingServiceEnsure)
+	}
+
+	if cfg.LoadBalancer.AntiAffinityAvailabilityZones != "" && len(cfg.LoadBalancer.antiAffinityZones()) < 2 {
+		return Config{}, fmt.Errorf("anti-affinity-availability-zones %q must list at least two availability zones", cfg.LoadBalancer.AntiAffinityAvailabilityZones)
+	}
+
+	if cfg.LoadBalancer.LoadBalancerIPConflicts != lbIPConflictsOldestWins && cfg.LoadBalancer.LoadBalancerIPConflicts != lbIPConflictsIgnore {
+		return Config{}, fmt.Errorf("unsupported load-balancer-ip-conflicts %q, supported values are %q and %q",
+			cfg.LoadBalancer.LoadBalancerIPConflicts, lbIPConflictsOldestWins, lbIPConflictsIgnore)
+	}
+
+	switch cfg.LoadBalancer.FloatingIPDrift {
+	case fipDriftIgnore, fipDriftReassociate, fipDriftAdopt:
+	default:
+		return Config{}, fmt.Errorf("unsupported floating-ip-drift %q, supported values are %q, %q and %q",
+			cfg.LoadBalancer.FloatingIPDrift, fipDriftIgnore, fipDriftReassociate, fipDriftAdopt)
+	}
+
+	if cfg.LoadBalancer.ReconcileOrder != reconcileOrderCreateFirst && cfg.LoadBalancer.ReconcileOrder != reconcileOrderDeleteFirst {
+		return Config{}, fmt.Errorf("unsupported reconcile-order %q, supported values are %q and %q",
+			cfg.LoadBalancer.ReconcileOrder, reconcileOrderCreateFirst, reconcileOrderDeleteFirst)
+	}
+
+	switch corev1.ServiceExternalTrafficPolicy(cfg.LoadBalancer.DefaultExternalTrafficPolicy) {
+	case corev1.ServiceExternalTrafficPolicyCluster, corev1.ServiceExternalTrafficPolicyLocal:
+	default:
+		return Config{}, fmt.Errorf("unsupported default-external-traffic-policy %q, supported values are %q and %q",
+			cfg.LoadBalancer.DefaultExternalTrafficPolicy, corev1.ServiceExternalTrafficPolicyCluster, corev1.ServiceExternalTrafficPolicyLocal)
+	}
+
+	if cfg.LoadBalancer.MemberSecurityGroup != "" || cfg.LoadBalancer.MemberSecurityGroupTags != "" {
+		if cfg.LoadBalancer.MemberSecurityGroup != "" && cfg.LoadBalancer.MemberSecurityGroupTags != "" {
+			return Config{}, fmt.Errorf("member-security-group and member-security-group-tags are mutually exclusive")
+		}
+		if !cfg.LoadBalancer.ManageSecurityGroups {
+			return Config{}, fmt.Errorf("member-security-group and member-security-group-tags require manage-security-groups to be enabled")
+		}
+	}
+
+	if cfg.LoadBalancer.StatusPollInterval.Duration <= 0 {
+		return Config{}, fmt.Errorf("status-poll-interval must be positive, got %v", cfg.LoadBalancer.StatusPollInterval.Duration)
+	}
+	if cfg.LoadBalancer.StatusPollMaxInterval.Duration < cfg.LoadBalancer.StatusPollInterval.Duration {
+		return Config{}, fmt.Errorf("status-poll-max-interval %v must not be shorter than status-poll-interval %v",
+			cfg.LoadBalancer.StatusPollMaxInterval.Duration, cfg.LoadBalancer.StatusPollInterval.Duration)
+	}
+
+	if cfg.LoadBalancer.MaxMembersPerPool < 0 {
+		return Config{}, fmt.Errorf("max-members-per-pool must not be negative, got %d", cfg.LoadBalancer.MaxMembersPerPool)
+	}
+	if cfg.LoadBalancer.VIPRetentionPeriod.Duration < 0 {
+		return Config{}, fmt.Errorf("vip-retention-period must not be negative, got %v", cfg.LoadBalancer.VIPRetentionPeriod.Duration)
+	}
+	if cfg.LoadBalancer.MemberStatusInterval.Duration < 0 {
+		return Config{}, fmt.Errorf("member-status-interval must not be negative, got %v", cfg.LoadBalancer.MemberStatusInterval.Duration)
+	}
+
+	if _, err := parseHostRoutes(cfg.LoadBalancer.MemberSubnetHostRoutes); err != nil {
+		return Config{}, fmt.Errorf("invalid member-subnet-host-routes: %v", err)
+	}
+
+	if _, _, err := parseServiceMappingConfigMap(cfg.LoadBalancer.ServiceMappingConfigMap); err != nil {
+		return Config{}, fmt.Errorf("invalid service-mapping-configmap: %v", err)
+	}
+
+	if _, err := parseFloatingIPTagAnnotations(cfg.LoadBalancer.FloatingIPTagAnnotations); err != nil {
+		return Config{}, fmt.Errorf("invalid floating-ip-tag-annotations: %v", err)
+	}
+
+	if err := cfg.LoadBalancer.defaultListenerOpts().validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid [LoadBalancer] listener settings: %v", err)
+	}
+	// The protocols are matched case-insensitively.
+	listenerOpts := make(map[string]*ListenerOpts, len(cfg.LoadBalancerListener))
+	for protocol, opts := range cfg.LoadBalancerListener {
+		protocol = strings.ToUpper(protocol)
+		if !util.Contains(supportedListenerProtocols, protocol) {
+			return Config{}, fmt.Errorf("unsupported listener protocol %q in [LoadBalancerListener], supported ones are %v", protocol, supportedListenerProtocols)
+		}
+		if err := opts.validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid [LoadBalancerListener %q] settings: %v", protocol, err)
+		}
+		listenerOpts[protocol] = opts
+	}
+	cfg.LoadBalancerListener = listenerOpts
+
+	for name, profile := range cfg.LoadBalancerProfile {
+		if err := profile.validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid [LoadBalancerProfile %q] settings: %v", name, err)
+		}
+	}
+
+	addHandledClass(&cfg)
+
 	return cfg, err
 }
 
@@ -271,6 +603,53 @@ func checkOpenStackOpts(openstackOpts *OpenStack) error {
 	return metadata.CheckMetadataSearchOrder(openstackOpts.metadataOpts.SearchOrder)
 }
 
+// setRegions sets the regions of [Global]. The region is the default one, it's always part of the regions and comes
+// first. Without regions, the region is the only one.
+func setRegions(cfg *client.AuthOpts) error {
+	var regions []string
+	if cfg.Region != "" {
+		regions = append(regions, cfg.Region)
+	}
+	for _, region := range cfg.Regions {
+		region = strings.TrimSpace(region)
+		if region == "" {
+			return fmt.Errorf("regions can't contain an empty region")
+		}
+		if !util.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	if len(regions) == 0 {
+		// No region at all, the first endpoint of the service catalog is used.
+		regions = []string{""}
+	}
+
+	cfg.Region = regions[0]
+	cfg.Regions = regions
+	return nil
+}
+
+// regionEpOpts returns the endpoint options of the clients of the region.
+func (os *OpenStack) regionEpOpts(region string) *gophercloud.EndpointOpts {
+	epOpts := *os.epOpts
+	epOpts.Region = region
+	return &epOpts
+}
+
+// checkRegions makes sure the service catalog has the compute and network endpoints of all the regions, the nodes
+// can't be found otherwise.
+func (os *OpenStack) checkRegions() error {
+	for _, region := range os.regions {
+		if _, err := client.NewComputeV2(os.provider, os.regionEpOpts(region)); err != nil {
+			return err
+		}
+		if _, err := client.NewNetworkV2(os.provider, os.regionEpOpts(region)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // NewOpenStack creates a new new instance of the openstack struct from a config struct
 func NewOpenStack(cfg Config) (*OpenStack, error) {
 	provider, err := client.NewOpenStackClient(&cfg.Global, "openstack-cloud-controller-manager", userAgentData...)
@@ -301,16 +680,31 @@ func NewOpenStack(cfg Config) (*OpenStack, error) {
 		networkingOpts: cfg.Networking,
 		useV1Instances: useV1Instances,
 	}
+	os.regions = cfg.Global.Regions
+	if len(os.regions) == 0 {
+		os.regions = []string{cfg.Global.Region}
+	}
 
 	// ini file doesn't support maps so we are reusing top level sub sections
 	// and copy the resulting map to corresponding loadbalancer section
 	os.lbOpts.LBClasses = cfg.LoadBalancerClass
+	os.lbOpts.ListenerOpts = cfg.LoadBalancerListener
+	os.lbOpts.LBProfiles = cfg.LoadBalancerProfile
+
+	openstackutil.SetStatusPolling(os.lbOpts.StatusPollInterval.Duration, os.lbOpts.StatusPollMaxInterval.Duration)
+	openstackutil.SetLoadBalancerLocking(os.lbOpts.PortReconcileConcurrency > 1)
 
 	err = checkOpenStackOpts(&os)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(os.regions) > 1 {
+		if err := os.checkRegions(); err != nil {
+			return nil, err
+		}
+	}
+
 	return &os, nil
 }
 
@@ -337,22 +731,102 @@ func (os *OpenStack) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 		return nil, false
 	}
 
-	network, err := client.NewNetworkV2(os.provider, os.epOpts)
-	if err != nil {
-		klog.Errorf("Failed to create an OpenStack Network client: %v", err)
-		return nil, false
+	os.lbMu.Lock()
+	defer os.lbMu.Unlock()
+	if os.lbaas == nil {
+		lbaas, ok := os.newLoadBalancer()
+		if !ok {
+			return nil, false
+		}
+		os.lbaas = lbaas
+	}
+	return os.lbaas, true
+}
+
+// newLoadBalancer builds the LbaasV2 of the default region along with the ones of the other regions, and starts the
+// background tasks of the load balancers.
+func (os *OpenStack) newLoadBalancer() (*LbaasV2, bool) {
+	lbAvailability := os.epOpts.Availability
+	if os.lbOpts.OctaviaEndpointType != "" {
+		lbAvailability = gophercloud.Availability(os.lbOpts.OctaviaEndpointType)
 	}
+	drainingNodes := os.drainingNodes
+	if drainingNodes == nil {
+		drainingNodes = newNodeDrainTracker()
+	}
+	var description *template.Template
+	if os.lbOpts.DescriptionTemplate != "" {
+		var err error
+		if description, err = parseDescriptionTemplate(os.lbOpts.DescriptionTemplate); err != nil {
+			klog.Errorf("Config error: %v", err)
+			return nil, false
+		}
+	}
+
+	regional := make(map[string]*LbaasV2, len(os.regions))
+	lbClients := make([]*gophercloud.ServiceClient, 0, len(os.regions))
+	for _, region := range os.regions {
+		epOpts := os.regionEpOpts(region)
+		network, err := client.NewNetworkV2(os.provider, epOpts)
+		if err != nil {
+			klog.Errorf("Failed to create an OpenStack Network client in region %q: %v", region, err)
+			return nil, false
+		}
 
-	lb, err := client.NewLoadBalancerV2(os.provider, os.epOpts)
+		lbEpOpts := *epOpts
+		lbEpOpts.Availability = lbAvailability
+		lb, err := client.NewLoadBalancerV2(os.provider, &lbEpOpts)
+		if err != nil {
+			klog.Errorf("Failed to create an OpenStack LoadBalancer client in region %q: %v", region, err)
+			return nil, false
+		}
+
+		// keymanager client is optional
+		secret, err := client.NewKeyManagerV1(os.provider, epOpts)
+		if err != nil {
+			klog.Warningf("Failed to create an OpenStack Secret client in region %q: %v", region, err)
+		}
+
+		// dns client is optional too, it's only used for the PTR records of the floating IPs
+		dns, err := client.NewDNSV2(os.provider, epOpts)
+		if err != nil {
+			klog.V(2).Infof("Failed to create an OpenStack DNS client in region %q: %v", region, err)
+		}
+
+		regional[region] = &LbaasV2{LoadBalancer{
+			secret:        secret,
+			dns:           dns,
+			network:       network,
+			lb:            lb,
+			opts:          os.lbOpts,
+			kclient:       os.kclient,
+			eventRecorder: os.eventRecorder,
+			drainingNodes: drainingNodes,
+			endpoints:     os.endpointsWatcher,
+			description:   description,
+			namespaces:    os.namespaceLister,
+			blueprints:    os.blueprints,
+			region:        region,
+		}}
+		lbClients = append(lbClients, lb)
+	}
+
+	// The features are picked according to a single Octavia API version, the lowest one of the regions.
+	octaviaVersion, err := openstackutil.NegotiateOctaviaVersions(lbClients, os.lbOpts.OctaviaAPIVersion)
 	if err != nil {
-		klog.Errorf("Failed to create an OpenStack LoadBalancer client: %v", err)
+		klog.Errorf("Failed to negotiate Octavia API version: %v", err)
 		return nil, false
 	}
+	klog.InfoS("Negotiated Octavia API version", "version", octaviaVersion, "endpointType", lbAvailability, "regions", os.regions)
 
-	// keymanager client is optional
-	secret, err := client.NewKeyManagerV1(os.provider, os.epOpts)
-	if err != nil {
-		klog.Warningf("Failed to create an OpenStack Secret client: %v", err)
+	for region, lbaas := range regional {
+		if err := checkRequiredOctaviaFeatures(lbaas.lb, os.lbOpts); err != nil {
+			klog.Errorf("Config error in region %q: %v", region, err)
+			return nil, false
+		}
+		if len(regional) > 1 {
+			lbaas.regional = regional
+		}
 	}
 
 	// LBaaS v1 is deprecated in the OpenStack Liberty release.
@@ -365,7 +839,47 @@ func (os *OpenStack) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 
 	klog.V(1).Info("Claiming to support LoadBalancer")
 
-	return &LbaasV2{LoadBalancer{secret, network, lb, os.lbOpts, os.kclient}}, true
+	lbaas := regional[os.regions[0]]
+	os.endpointsWatcher.setRepopulate(lbaas.UpdateLoadBalancer)
+	drainingNodes.setResync(lbaas.UpdateLoadBalancer)
+	os.blueprints.setResync(func(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) error {
+		_, err := lbaas.EnsureLoadBalancer(ctx, clusterName, service, nodes)
+		return err
+	})
+
+	if os.lbOpts.VIPRetentionPeriod.Duration > 0 {
+		go startRetainedVIPReaper(regional, wait.NeverStop)
+	}
+	if os.lbOpts.MemberStatusInterval.Duration > 0 && os.serviceLister != nil {
+		go newMemberStatusWatcher(lbaas, os.serviceLister).run(os.lbOpts.MemberStatusInterval.Duration, wait.NeverStop)
+	}
+	go drainingNodes.run(wait.NeverStop)
+	go os.blueprints.run(wait.NeverStop)
+
+	return lbaas, true
+}
+
+// checkRequiredOctaviaFeatures makes sure the Octavia features required by the [LoadBalancer] options are available.
+func checkRequiredOctaviaFeatures(lb *gophercloud.ServiceClient, lbOpts LoadBalancerOpts) error {
+	if lbOpts.FlavorID != "" {
+		if err := openstackutil.CheckOctaviaFeature(lb, openstackutil.OctaviaFeatureFlavors, lbOpts.LBProvider); err != nil {
+			return fmt.Errorf("flavor-id can't be used: %v", err)
+		}
+	}
+	if lbOpts.AvailabilityZone != "" {
+		if err := openstackutil.CheckOctaviaFeature(lb, openstackutil.OctaviaFeatureAvailabilityZones, lbOpts.LBProvider); err != nil {
+			return fmt.Errorf("availability-zone can't be used: %v", err)
+		}
+	}
+	// The load balancers of a group are found by their tags.
+	if lbOpts.AntiAffinityAvailabilityZones != "" {
+		for _, feature := range []int{openstackutil.OctaviaFeatureAvailabilityZones, openstackutil.OctaviaFeatureTags} {
+			if err := openstackutil.CheckOctaviaFeature(lb, feature, lbOpts.LBProvider); err != nil {
+				return fmt.Errorf("anti-affinity-availability-zones can't be used: %v", err)
+			}
+		}
+	}
+	return nil
 }
 
 // Zones indicates that we support zones
@@ -485,4 +999,20 @@ func (os *OpenStack) SetInformers(informerFactory informers.SharedInformerFactor
 	klog.V(1).Infof("Setting up informers for Cloud")
 	os.nodeInformer = informerFactory.Core().V1().Nodes()
 	os.nodeInformerHasSynced = os.nodeInformer.Informer().HasSynced
+	if os.lbOpts.Enabled {
+		os.endpointsWatcher = newServiceEndpointsWatcher(informerFactory, os.lbOpts.NoEndpointsBehavior == noEndpointsRemoveMembers)
+	}
+	if os.lbOpts.Enabled && os.lbOpts.NodeDrainGracePeriod.Duration > 0 {
+		os.drainingNodes = newNodeDrainTracker()
+		os.drainingNodes.watch(informerFactory)
+	}
+	if os.lbOpts.Enabled && hasNamespaceProfiles(os.lbOpts.LBProfiles) {
+		os.namespaceLister = informerFactory.Core().V1().Namespaces().Lister()
+	}
+	if os.lbOpts.Enabled && os.blueprints != nil {
+		os.blueprints.watch(informerFactory)
+	}
+	if os.lbOpts.Enabled && os.lbOpts.MemberStatusInterval.Duration > 0 {
+		os.serviceLister = informerFactory.Core().V1().Services().Lister()
+	}
 }
@@ -19,6 +19,7 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -29,11 +30,16 @@ import (
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	th "github.com/gophercloud/gophercloud/testhelper"
 	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
+	openstackutil "k8s.io/cloud-provider-openstack/pkg/util/openstack"
+	"k8s.io/utils/pointer"
 )
 
 const (
@@ -94,11 +100,36 @@ func TestReadConfig(t *testing.T) {
  tenant-name = demo
  tenant-domain-name = Default
  region = RegionOne
+ regions = RegionOne
+ regions = RegionTwo
  [LoadBalancer]
  create-monitor = yes
  monitor-delay = 1m
  monitor-timeout = 30s
  monitor-max-retries = 3
+ monitor-max-retries-down = 5
+ port-reconcile-concurrency = 8
+ octavia-endpoint-type = internal
+ octavia-api-version = v2.10
+ description-template = "{{.Namespace}}/{{.Name}}"
+ node-drain-grace-period = 10m
+ node-drain-taint-key = example.com/draining
+ event-throttle-interval = 5m
+ vip-retention-period = 30m
+ member-status-interval = 30s
+ max-members-per-pool = 50
+ source-ranges-enforcement = allowed-cidrs
+ no-endpoints-behavior = keep-members
+ terminating-service-behavior = ensure
+ connection-limit = 1000
+ timeout-client-data = 60000
+ member-subnet-host-routes = "10.1.0.0/16 via 192.168.0.1, 10.2.0.0/16 via 192.168.0.2"
+ floating-ip-tags = true
+ floating-ip-tag-annotations = "external-dns.alpha.kubernetes.io/hostname, example.com/owner"
+ status-poll-interval = 2s
+ status-poll-max-interval = 30s
+ load-balancer-ip-conflicts = ignore
+ floating-ip-drift = reassociate
  [Metadata]
  search-order = configDrive, metadataService
  `))
@@ -130,6 +161,10 @@ func TestReadConfig(t *testing.T) {
 		t.Errorf("incorrect region: %s", cfg.Global.Region)
 	}
 
+	if !reflect.DeepEqual(cfg.Global.Regions, []string{"RegionOne", "RegionTwo"}) {
+		t.Errorf("incorrect regions: %v", cfg.Global.Regions)
+	}
+
 	if !cfg.LoadBalancer.CreateMonitor {
 		t.Errorf("incorrect lb.createmonitor: %t", cfg.LoadBalancer.CreateMonitor)
 	}
@@ -142,9 +177,409 @@ func TestReadConfig(t *testing.T) {
 	if cfg.LoadBalancer.MonitorMaxRetries != 3 {
 		t.Errorf("incorrect lb.monitormaxretries: %d", cfg.LoadBalancer.MonitorMaxRetries)
 	}
+	if cfg.LoadBalancer.MonitorMaxRetriesDown != 5 {
+		t.Errorf("incorrect lb.monitormaxretriesdown: %d", cfg.LoadBalancer.MonitorMaxRetriesDown)
+	}
+	if cfg.LoadBalancer.PortReconcileConcurrency != 8 {
+		t.Errorf("incorrect lb.portreconcileconcurrency: %d", cfg.LoadBalancer.PortReconcileConcurrency)
+	}
+	if cfg.LoadBalancer.OctaviaEndpointType != "internal" {
+		t.Errorf("incorrect lb.octaviaendpointtype: %s", cfg.LoadBalancer.OctaviaEndpointType)
+	}
+	if cfg.LoadBalancer.OctaviaAPIVersion != "v2.10" {
+		t.Errorf("incorrect lb.octaviaapiversion: %s", cfg.LoadBalancer.OctaviaAPIVersion)
+	}
+	if cfg.LoadBalancer.DescriptionTemplate != "{{.Namespace}}/{{.Name}}" {
+		t.Errorf("incorrect lb.descriptiontemplate: %s", cfg.LoadBalancer.DescriptionTemplate)
+	}
+	if cfg.LoadBalancer.NodeDrainGracePeriod.Duration != 10*time.Minute {
+		t.Errorf("incorrect lb.nodedraingraceperiod: %v", cfg.LoadBalancer.NodeDrainGracePeriod.Duration)
+	}
+	if cfg.LoadBalancer.NodeDrainTaintKey != "example.com/draining" {
+		t.Errorf("incorrect lb.nodedraintaintkey: %s", cfg.LoadBalancer.NodeDrainTaintKey)
+	}
+	if cfg.LoadBalancer.EventThrottleInterval.Duration != 5*time.Minute {
+		t.Errorf("incorrect lb.eventthrottleinterval: %v", cfg.LoadBalancer.EventThrottleInterval.Duration)
+	}
+	if cfg.LoadBalancer.VIPRetentionPeriod.Duration != 30*time.Minute {
+		t.Errorf("incorrect lb.vipretentionperiod: %v", cfg.LoadBalancer.VIPRetentionPeriod.Duration)
+	}
+	if cfg.LoadBalancer.MemberStatusInterval.Duration != 30*time.Second {
+		t.Errorf("incorrect lb.memberstatusinterval: %v", cfg.LoadBalancer.MemberStatusInterval.Duration)
+	}
+	if cfg.LoadBalancer.MaxMembersPerPool != 50 {
+		t.Errorf("incorrect lb.maxmembersperpool: %d", cfg.LoadBalancer.MaxMembersPerPool)
+	}
+	if cfg.LoadBalancer.SourceRangesEnforcement != "allowed-cidrs" {
+		t.Errorf("incorrect lb.sourcerangesenforcement: %s", cfg.LoadBalancer.SourceRangesEnforcement)
+	}
+	if cfg.LoadBalancer.NoEndpointsBehavior != "keep-members" {
+		t.Errorf("incorrect lb.noendpointsbehavior: %s", cfg.LoadBalancer.NoEndpointsBehavior)
+	}
+	if cfg.LoadBalancer.TerminatingServiceBehavior != "ensure" {
+		t.Errorf("incorrect lb.terminatingservicebehavior: %s", cfg.LoadBalancer.TerminatingServiceBehavior)
+	}
+	if cfg.LoadBalancer.ConnectionLimit != 1000 {
+		t.Errorf("incorrect lb.connectionlimit: %d", cfg.LoadBalancer.ConnectionLimit)
+	}
+	if cfg.LoadBalancer.TimeoutClientData != 60000 {
+		t.Errorf("incorrect lb.timeoutclientdata: %d", cfg.LoadBalancer.TimeoutClientData)
+	}
+	if cfg.LoadBalancer.TimeoutMemberConnect != 5000 {
+		t.Errorf("incorrect lb.timeoutmemberconnect: %d", cfg.LoadBalancer.TimeoutMemberConnect)
+	}
+	if cfg.LoadBalancer.MemberSubnetHostRoutes != "10.1.0.0/16 via 192.168.0.1, 10.2.0.0/16 via 192.168.0.2" {
+		t.Errorf("incorrect lb.membersubnethostroutes: %s", cfg.LoadBalancer.MemberSubnetHostRoutes)
+	}
+	if !cfg.LoadBalancer.FloatingIPTags {
+		t.Errorf("incorrect lb.floatingiptags: %t", cfg.LoadBalancer.FloatingIPTags)
+	}
+	if cfg.LoadBalancer.FloatingIPTagAnnotations != "external-dns.alpha.kubernetes.io/hostname, example.com/owner" {
+		t.Errorf("incorrect lb.floatingiptagannotations: %s", cfg.LoadBalancer.FloatingIPTagAnnotations)
+	}
+	if cfg.LoadBalancer.StatusPollInterval.Duration != 2*time.Second {
+		t.Errorf("incorrect lb.statuspollinterval: %v", cfg.LoadBalancer.StatusPollInterval.Duration)
+	}
+	if cfg.LoadBalancer.StatusPollMaxInterval.Duration != 30*time.Second {
+		t.Errorf("incorrect lb.statuspollmaxinterval: %v", cfg.LoadBalancer.StatusPollMaxInterval.Duration)
+	}
+	if cfg.LoadBalancer.LoadBalancerIPConflicts != "ignore" {
+		t.Errorf("incorrect lb.loadbalanceripconflicts: %s", cfg.LoadBalancer.LoadBalancerIPConflicts)
+	}
+	if cfg.LoadBalancer.FloatingIPDrift != "reassociate" {
+		t.Errorf("incorrect lb.floatingipdrift: %s", cfg.LoadBalancer.FloatingIPDrift)
+	}
 	if cfg.Metadata.SearchOrder != "configDrive, metadataService" {
 		t.Errorf("incorrect md.search-order: %v", cfg.Metadata.SearchOrder)
 	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nno-endpoints-behavior = drop-listeners\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported no-endpoints-behavior is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\ndescription-template = \"{{.Owner}}\"\n"))
+	if err == nil {
+		t.Errorf("Should fail when a description-template with an unknown field is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\ndescription-template = \"{{.Name\"\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unparsable description-template is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nload-balancer-ip-conflicts = newest-wins\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported load-balancer-ip-conflicts is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nmember-status-interval = -1m\n"))
+	if err == nil {
+		t.Errorf("Should fail when a negative member-status-interval is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nfloating-ip-drift = heal\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported floating-ip-drift is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nmember-subnet-host-routes = 10.1.0.0/16\n"))
+	if err == nil {
+		t.Errorf("Should fail when an invalid member-subnet-host-routes is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nservice-mapping-configmap = occm-loadbalancers\n"))
+	if err == nil {
+		t.Errorf("Should fail when service-mapping-configmap has no namespace")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nfloating-ip-tag-annotations = example.com/owner/team\n"))
+	if err == nil {
+		t.Errorf("Should fail when an invalid floating-ip-tag-annotations is provided")
+	}
+
+	// The ports are reconciled one by one unless the operator opts in
+	cfg, err = ReadConfig(strings.NewReader("[LoadBalancer]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LoadBalancer.PortReconcileConcurrency != 1 {
+		t.Errorf("incorrect default lb.portreconcileconcurrency: %d", cfg.LoadBalancer.PortReconcileConcurrency)
+	}
+	// The members of the Services without ready endpoints are removed unless the operator keeps them
+	if cfg.LoadBalancer.NoEndpointsBehavior != "remove-members" {
+		t.Errorf("incorrect default lb.noendpointsbehavior: %s", cfg.LoadBalancer.NoEndpointsBehavior)
+	}
+	if cfg.LoadBalancer.TerminatingServiceBehavior != "skip" {
+		t.Errorf("incorrect default lb.terminatingservicebehavior: %s", cfg.LoadBalancer.TerminatingServiceBehavior)
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nreconcile-order = parallel\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported reconcile-order is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\ndefault-external-traffic-policy = local\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported default-external-traffic-policy is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nno-nodes-behavior = remove-members\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported no-nodes-behavior is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nterminating-service-behavior = delete\n"))
+	if err == nil {
+		t.Errorf("Should fail when an unsupported terminating-service-behavior is provided")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nanti-affinity-availability-zones = az1, az1\n"))
+	if err == nil {
+		t.Errorf("Should fail when anti-affinity-availability-zones lists a single availability zone")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nmember-security-group = k8s-lb-members\n"))
+	if err == nil {
+		t.Errorf("Should fail when member-security-group is set without manage-security-groups")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nmanage-security-groups = true\nmember-security-group = k8s-lb-members\nmember-security-group-tags = k8s-lb\n"))
+	if err == nil {
+		t.Errorf("Should fail when both member-security-group and member-security-group-tags are set")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nstatus-poll-interval = 0s\n"))
+	if err == nil {
+		t.Errorf("Should fail when status-poll-interval isn't positive")
+	}
+
+	_, err = ReadConfig(strings.NewReader("[LoadBalancer]\nstatus-poll-interval = 20s\n"))
+	if err == nil {
+		t.Errorf("Should fail when status-poll-max-interval is shorter than status-poll-interval")
+	}
+}
+
+func TestSetRegions(t *testing.T) {
+	tests := []struct {
+		name            string
+		region          string
+		regions         []string
+		expectedRegion  string
+		expectedRegions []string
+		expectErr       string
+	}{
+		{
+			name:            "no region",
+			expectedRegions: []string{""},
+		},
+		{
+			name:            "region only",
+			region:          "RegionOne",
+			expectedRegion:  "RegionOne",
+			expectedRegions: []string{"RegionOne"},
+		},
+		{
+			name:            "regions only",
+			regions:         []string{"RegionTwo", "RegionOne"},
+			expectedRegion:  "RegionTwo",
+			expectedRegions: []string{"RegionTwo", "RegionOne"},
+		},
+		{
+			name:            "region comes first",
+			region:          "RegionOne",
+			regions:         []string{"RegionTwo", "RegionOne", "RegionTwo"},
+			expectedRegion:  "RegionOne",
+			expectedRegions: []string{"RegionOne", "RegionTwo"},
+		},
+		{
+			name:      "empty region in regions",
+			region:    "RegionOne",
+			regions:   []string{"RegionTwo", " "},
+			expectErr: "regions can't contain an empty region",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := client.AuthOpts{Region: test.region, Regions: test.regions}
+			err := setRegions(&cfg)
+			if test.expectErr != "" {
+				assert.EqualError(t, err, test.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRegion, cfg.Region)
+			assert.Equal(t, test.expectedRegions, cfg.Regions)
+		})
+	}
+}
+
+func TestReadConfigSourceRangesEnforcement(t *testing.T) {
+	tests := []struct {
+		name      string
+		lbConfig  string
+		expectErr string
+	}{
+		{
+			name:     "allowed-cidrs",
+			lbConfig: "source-ranges-enforcement = allowed-cidrs",
+		},
+		{
+			name:      "allowed-cidrs with ovn",
+			lbConfig:  "source-ranges-enforcement = allowed-cidrs\nlb-provider = ovn",
+			expectErr: `source-ranges-enforcement "allowed-cidrs" is not supported by the ovn provider`,
+		},
+		{
+			name:     "security-groups",
+			lbConfig: "source-ranges-enforcement = security-groups\nlb-provider = ovn\nmanage-security-groups = true",
+		},
+		{
+			name:      "security-groups unmanaged",
+			lbConfig:  "source-ranges-enforcement = security-groups\nlb-provider = ovn",
+			expectErr: `source-ranges-enforcement "security-groups" requires manage-security-groups to be enabled`,
+		},
+		{
+			name:      "security-groups with amphora",
+			lbConfig:  "source-ranges-enforcement = security-groups\nmanage-security-groups = true",
+			expectErr: `source-ranges-enforcement "security-groups" is only supported by the ovn provider`,
+		},
+		{
+			name:      "unknown",
+			lbConfig:  "source-ranges-enforcement = firewall",
+			expectErr: `unsupported source-ranges-enforcement "firewall"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadConfig(strings.NewReader("[LoadBalancer]\n" + test.lbConfig + "\n"))
+			if test.expectErr != "" {
+				assert.ErrorContains(t, err, test.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReadConfigListenerOpts(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		expected  map[string]*ListenerOpts
+		expectErr string
+	}{
+		{
+			name: "protocol sections",
+			config: `[LoadBalancer]
+connection-limit = 1000
+[LoadBalancerListener "http"]
+timeout-client-data = 60000
+[LoadBalancerListener "TCP"]
+connection-limit = -1
+timeout-tcp-inspect = 10`,
+			expected: map[string]*ListenerOpts{
+				"HTTP": {TimeoutClientData: pointer.Int(60000)},
+				"TCP":  {ConnectionLimit: pointer.Int(-1), TimeoutTCPInspect: pointer.Int(10)},
+			},
+		},
+		{
+			name:      "invalid default connection limit",
+			config:    "[LoadBalancer]\nconnection-limit = -2",
+			expectErr: "connection-limit must be -1 or more, got -2",
+		},
+		{
+			name:      "invalid default timeout",
+			config:    "[LoadBalancer]\ntimeout-member-connect = -1",
+			expectErr: "timeout-member-connect must be 0 or more, got -1",
+		},
+		{
+			name:      "invalid protocol timeout",
+			config:    "[LoadBalancerListener \"UDP\"]\ntimeout-member-data = -5",
+			expectErr: "timeout-member-data must be 0 or more, got -5",
+		},
+		{
+			name:      "unsupported protocol",
+			config:    "[LoadBalancerListener \"QUIC\"]\nconnection-limit = 10",
+			expectErr: `unsupported listener protocol "QUIC"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := ReadConfig(strings.NewReader(test.config + "\n"))
+			if test.expectErr != "" {
+				assert.ErrorContains(t, err, test.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, cfg.LoadBalancerListener)
+		})
+	}
+}
+
+func TestReadConfigLoadBalancerProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		expected  map[string]*LBProfile
+		expectErr string
+	}{
+		{
+			name: "profiles",
+			config: `[LoadBalancerProfile "internal"]
+namespace-selector = team in (backend, data)
+annotation = service.beta.kubernetes.io/openstack-internal-load-balancer=true
+annotation = loadbalancer.openstack.org/flavor-id=small
+[LoadBalancerProfile "all"]
+annotation = loadbalancer.openstack.org/enable-health-monitor=true
+[LoadBalancerProfile "tls"]
+explicit = true
+annotation = loadbalancer.openstack.org/default-tls-container-ref=https://barbican.example.com/v1/containers/tls`,
+			expected: map[string]*LBProfile{
+				"internal": {
+					NamespaceSelector: "team in (backend, data)",
+					Annotation: []string{
+						"service.beta.kubernetes.io/openstack-internal-load-balancer=true",
+						"loadbalancer.openstack.org/flavor-id=small",
+					},
+				},
+				"all": {Annotation: []string{"loadbalancer.openstack.org/enable-health-monitor=true"}},
+				"tls": {
+					Annotation: []string{"loadbalancer.openstack.org/default-tls-container-ref=https://barbican.example.com/v1/containers/tls"},
+					Explicit:   true,
+				},
+			},
+		},
+		{
+			name:      "explicit profile with a selector",
+			config:    "[LoadBalancerProfile \"tls\"]\nexplicit = true\nnamespace-selector = team=backend",
+			expectErr: `invalid [LoadBalancerProfile "tls"] settings: namespace-selector can't be set on an explicit profile`,
+		},
+		{
+			name:      "invalid selector",
+			config:    "[LoadBalancerProfile \"internal\"]\nnamespace-selector = team in backend",
+			expectErr: `invalid [LoadBalancerProfile "internal"] settings: invalid namespace-selector`,
+		},
+		{
+			name:      "invalid annotation",
+			config:    "[LoadBalancerProfile \"internal\"]\nannotation = loadbalancer.openstack.org/flavor-id",
+			expectErr: `invalid [LoadBalancerProfile "internal"] settings: invalid annotation`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := ReadConfig(strings.NewReader(test.config + "\n"))
+			if test.expectErr != "" {
+				assert.ErrorContains(t, err, test.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, cfg.LoadBalancerProfile)
+		})
+	}
 }
 
 func TestReadClouds(t *testing.T) {
@@ -925,6 +1360,72 @@ func TestLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestCheckRequiredOctaviaFeatures(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	th.Mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v2.0", "status": "SUPPORTED"}, {"id": "v2.16", "status": "CURRENT"}]}`)
+	})
+	lb := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint(), Type: "load-balancer"}
+
+	_, err := openstackutil.NegotiateOctaviaVersion(lb, "v2.20")
+	assert.ErrorContains(t, err, "requested Octavia API version v2.20 is not supported")
+
+	version, err := openstackutil.NegotiateOctaviaVersion(lb, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2.16", version)
+	assert.NoError(t, checkRequiredOctaviaFeatures(lb, LoadBalancerOpts{FlavorID: "flavor", AvailabilityZone: "az"}))
+
+	version, err = openstackutil.NegotiateOctaviaVersion(lb, "2.10")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2.10", version)
+	// Octavia has no microversions, the version only picks the features
+	assert.Empty(t, lb.Microversion)
+	assert.NoError(t, checkRequiredOctaviaFeatures(lb, LoadBalancerOpts{FlavorID: "flavor"}))
+	err = checkRequiredOctaviaFeatures(lb, LoadBalancerOpts{AvailabilityZone: "az"})
+	assert.ErrorContains(t, err, "availability zones require Octavia API version v2.14 or later, the version in use is v2.10")
+	err = checkRequiredOctaviaFeatures(lb, LoadBalancerOpts{AntiAffinityAvailabilityZones: "az1,az2"})
+	assert.ErrorContains(t, err, "anti-affinity-availability-zones can't be used")
+
+	err = checkRequiredOctaviaFeatures(lb, LoadBalancerOpts{FlavorID: "flavor", LBProvider: "ovn"})
+	assert.ErrorContains(t, err, "flavors are not supported by the ovn provider")
+}
+
+func TestNegotiateOctaviaVersions(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	th.Mux.HandleFunc("/RegionOne/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v2.0", "status": "SUPPORTED"}, {"id": "v2.16", "status": "CURRENT"}]}`)
+	})
+	th.Mux.HandleFunc("/RegionTwo/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v2.0", "status": "SUPPORTED"}, {"id": "v2.12", "status": "CURRENT"}]}`)
+	})
+	lbs := []*gophercloud.ServiceClient{
+		{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint() + "RegionOne/", Type: "load-balancer"},
+		{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint() + "RegionTwo/", Type: "load-balancer"},
+	}
+
+	version, err := openstackutil.NegotiateOctaviaVersions(lbs, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2.12", version)
+	err = checkRequiredOctaviaFeatures(lbs[0], LoadBalancerOpts{AvailabilityZone: "az"})
+	assert.ErrorContains(t, err, "availability zones require Octavia API version v2.14 or later, the version in use is v2.12")
+
+	_, err = openstackutil.NegotiateOctaviaVersions(lbs, "v2.14")
+	assert.ErrorContains(t, err, "requested Octavia API version v2.14 is not supported, the current version is v2.12")
+
+	version, err = openstackutil.NegotiateOctaviaVersions(lbs, "2.10")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2.10", version)
+	assert.Empty(t, lbs[0].Microversion)
+	assert.Empty(t, lbs[1].Microversion)
+	err = checkRequiredOctaviaFeatures(lbs[1], LoadBalancerOpts{FlavorID: "flavor"})
+	assert.NoError(t, err)
+}
+
 var FakeMetadata = metadata.Metadata{
 	UUID:             "83679162-1378-4288-a2d4-70e13ec132aa",
 	Name:             "test",
@@ -55,6 +55,24 @@ func IsBlockDevice(path string) (bool, error) {
 	return (stat.Mode & unix.S_IFMT) == unix.S_IFBLK, nil
 }
 
+// GetBlockDevicePath returns the /dev path of the block device on the path, e.g. of the bind mount of a block volume
+// published to a pod, found from the device number.
+func GetBlockDevicePath(path string) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return "", fmt.Errorf("failed to stat() %q: %s", path, err)
+	}
+	if (stat.Mode & unix.S_IFMT) != unix.S_IFBLK {
+		return "", fmt.Errorf("%q is not a block device", path)
+	}
+	sysPath := filepath.Join("/sys/dev/block", fmt.Sprintf("%d:%d", unix.Major(stat.Rdev), unix.Minor(stat.Rdev)))
+	devicePath, err := filepath.EvalSymlinks(sysPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the block device of %q: %s", path, err)
+	}
+	return filepath.Join("/dev", filepath.Base(devicePath)), nil
+}
+
 // GetBlockDeviceSize returns the size of the block device by path
 func GetBlockDeviceSize(path string) (int64, error) {
 	fd, err := os.Open(path)
@@ -27,6 +27,10 @@ func IsBlockDevice(path string) (bool, error) {
 	return false, errors.New("IsBlockDevice is not implemented for this OS")
 }
 
+func GetBlockDevicePath(path string) (string, error) {
+	return "", errors.New("GetBlockDevicePath is not implemented for this OS")
+}
+
 func GetBlockDeviceSize(path string) (int64, error) {
 	return -1, errors.New("GetBlockDeviceSize is not implemented for this OS")
 }
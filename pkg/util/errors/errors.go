@@ -17,6 +17,7 @@ limitations under the License.
 package errors
 
 import (
+	"bytes"
 	"errors"
 	"net/http"
 
@@ -91,3 +92,23 @@ func IsConflictError(err error) bool {
 
 	return false
 }
+
+// IsQuotaError tells if the request was rejected as the quota of the project is exceeded, Octavia and Neutron answer
+// with a 403 or a 409 then, mentioning the quota.
+func IsQuotaError(err error) bool {
+	var body []byte
+	var forbidden gophercloud.ErrDefault403
+	var conflict gophercloud.ErrDefault409
+	var unexpected gophercloud.ErrUnexpectedResponseCode
+	switch {
+	case errors.As(err, &forbidden):
+		body = forbidden.Body
+	case errors.As(err, &conflict):
+		body = conflict.Body
+	case errors.As(err, &unexpected) && (unexpected.Actual == http.StatusForbidden || unexpected.Actual == http.StatusConflict):
+		body = unexpected.Body
+	default:
+		return false
+	}
+	return bytes.Contains(bytes.ToLower(body), []byte("quota"))
+}
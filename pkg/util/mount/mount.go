@@ -17,10 +17,14 @@ limitations under the License.
 package mount
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -40,16 +44,64 @@ const (
 	operationFinishSteps     = 15
 )
 
+// Strategies of GetDevicePath to find the device of a volume.
+const (
+	// DeviceDiscoveryAuto tries the other strategies in turn.
+	DeviceDiscoveryAuto = "auto"
+	// DeviceDiscoverySysfs matches the serial or WWN of the block devices reported by the kernel.
+	DeviceDiscoverySysfs = "sysfs"
+	// DeviceDiscoveryByID looks for the /dev/disk/by-id links maintained by udev.
+	DeviceDiscoveryByID = "by-id"
+	// DeviceDiscoveryNovaDevice uses the device name returned by Nova when attaching the volume.
+	DeviceDiscoveryNovaDevice = "nova-device"
+	// DeviceDiscoveryMetadata uses the device of the volume in the metadata, it's up to the callers.
+	DeviceDiscoveryMetadata = "metadata"
+)
+
+// ValidateDeviceDiscovery checks that strategy is a device discovery strategy, an empty one stands for auto.
+func ValidateDeviceDiscovery(strategy string) error {
+	switch strategy {
+	case "", DeviceDiscoveryAuto, DeviceDiscoverySysfs, DeviceDiscoveryByID, DeviceDiscoveryNovaDevice, DeviceDiscoveryMetadata:
+		return nil
+	}
+	return fmt.Errorf("unsupported device discovery strategy %q, must be one of %s, %s, %s, %s or %s", strategy,
+		DeviceDiscoveryAuto, DeviceDiscoverySysfs, DeviceDiscoveryByID, DeviceDiscoveryNovaDevice, DeviceDiscoveryMetadata)
+}
+
+// ValidateDevicePathPrefix checks that prefix is the prefix of kernel device paths, e.g. /dev/vd or /dev/sd. An empty
+// one stands for no hint.
+func ValidateDevicePathPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	name := strings.TrimPrefix(prefix, "/dev/")
+	if name == prefix || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("unsupported device path prefix %q, must be the prefix of the kernel device names in /dev, e.g. /dev/vd or /dev/sd", prefix)
+	}
+	return nil
+}
+
+// sysBlockPath is where the kernel exposes the attributes of the block devices, diskByIDPath is where udev links the
+// block devices by their serial. Tests point them to fake layouts.
+var (
+	sysBlockPath = "/sys/block"
+	diskByIDPath = "/dev/disk/by-id"
+)
+
+// procMountInfoPath lists the mounts of the plugin's mount namespace.
+const procMountInfoPath = "/proc/self/mountinfo"
+
 type IMount interface {
 	Mounter() *mount.SafeFormatAndMount
 	ScanForAttach(devicePath string) error
-	GetDevicePath(volumeID string) (string, error)
+	GetDevicePath(volumeID, novaDevicePath, strategy, devicePathPrefix string) (string, error)
 	IsLikelyNotMountPointAttach(targetpath string) (bool, error)
 	UnmountPath(mountPath string) error
 	MakeFile(pathname string) error
 	MakeDir(pathname string) error
 	GetDeviceStats(path string) (*DeviceStats, error)
 	GetMountFs(path string) ([]byte, error)
+	CheckMountHealth(path string) error
 }
 
 type DeviceStats struct {
@@ -118,8 +170,24 @@ func probeVolume() error {
 	return nil
 }
 
-// GetDevicePath returns the path of an attached block storage volume, specified by its id.
-func (m *Mount) GetDevicePath(volumeID string) (string, error) {
+// GetDevicePath returns the path of an attached block storage volume, specified by its id. novaDevicePath is the
+// device name returned by Nova when attaching the volume, if known. strategy forces a device discovery strategy, by
+// default the serial reported by the kernel is tried first, then the udev links and finally the Nova device name.
+// devicePathPrefix hints the kernel device names of the hypervisor, e.g. /dev/sd when Nova returns /dev/vdb but the
+// volumes show up as SCSI devices, the devices without it are only used when none with it is found. An error is
+// returned if several devices match the volume, instead of guessing which one to use.
+// Kernel device names can change across reboots, so a udev link of the device found is returned if there's one.
+func (m *Mount) GetDevicePath(volumeID, novaDevicePath, strategy, devicePathPrefix string) (string, error) {
+	if err := ValidateDeviceDiscovery(strategy); err != nil {
+		return "", err
+	}
+	if err := ValidateDevicePathPrefix(devicePathPrefix); err != nil {
+		return "", err
+	}
+	if strategy == DeviceDiscoveryMetadata {
+		return "", fmt.Errorf("device of the volumeID: %q must be found in the metadata", volumeID)
+	}
+
 	backoff := wait.Backoff{
 		Duration: operationFinishInitDelay,
 		Factor:   operationFinishFactor,
@@ -128,7 +196,11 @@ func (m *Mount) GetDevicePath(volumeID string) (string, error) {
 
 	var devicePath string
 	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		devicePath = m.getDevicePathBySerialID(volumeID)
+		var err error
+		devicePath, err = findDevicePath(volumeID, novaDevicePath, strategy, devicePathPrefix)
+		if err != nil {
+			return false, err
+		}
 		if devicePath != "" {
 			return true, nil
 		}
@@ -142,14 +214,114 @@ func (m *Mount) GetDevicePath(volumeID string) (string, error) {
 
 	if wait.Interrupted(err) {
 		return "", fmt.Errorf("failed to find device for the volumeID: %q within the alloted time", volumeID)
+	} else if err != nil {
+		return "", err
 	} else if devicePath == "" {
 		return "", fmt.Errorf("device path was empty for volumeID: %q", volumeID)
 	}
 	return devicePath, nil
 }
 
-// GetDevicePathBySerialID returns the path of an attached block storage volume, specified by its id.
-func (m *Mount) getDevicePathBySerialID(volumeID string) string {
+// findDevicePath runs the device discovery strategy once, see GetDevicePath.
+func findDevicePath(volumeID, novaDevicePath, strategy, devicePathPrefix string) (string, error) {
+	var devicePath string
+	var err error
+	switch strategy {
+	case DeviceDiscoverySysfs:
+		devicePath, err = getDevicePathBySysfs(volumeID, devicePathPrefix)
+	case DeviceDiscoveryByID:
+		devicePath = getDevicePathBySerialID(volumeID)
+	case DeviceDiscoveryNovaDevice:
+		devicePath = getDevicePathByNovaDevice(volumeID, novaDevicePath, devicePathPrefix)
+	default:
+		devicePath, err = getDevicePathBySysfs(volumeID, devicePathPrefix)
+		if err != nil {
+			return "", err
+		}
+		if devicePath == "" {
+			devicePath = getDevicePathBySerialID(volumeID)
+		}
+		if devicePath == "" {
+			devicePath = getDevicePathByNovaDevice(volumeID, novaDevicePath, devicePathPrefix)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return stableDevicePath(devicePath), nil
+}
+
+// getDevicePathBySysfs returns the path of the block device whose serial or WWN reported by the kernel matches the
+// volume ID. Unlike the /dev/disk/by-id links maintained by udev, these can't be stale after a rescan. When several
+// devices match, only the ones named with devicePathPrefix are considered, and an error is returned if there's still
+// more than one.
+func getDevicePathBySysfs(volumeID, devicePathPrefix string) (string, error) {
+	devices, err := os.ReadDir(sysBlockPath)
+	if err != nil {
+		klog.V(4).Infof("ReadDir failed with error %v", err)
+		return "", nil
+	}
+
+	var matches []string
+	for _, d := range devices {
+		if deviceMatchesVolume(path.Join(sysBlockPath, d.Name()), volumeID) {
+			matches = append(matches, d.Name())
+		}
+	}
+
+	if len(matches) == 0 {
+		klog.V(4).Infof("Failed to find device for the volumeID: %q in %s", volumeID, sysBlockPath)
+		return "", nil
+	}
+	matches = filterDevicePathPrefix(matches, devicePathPrefix)
+	if len(matches) > 1 {
+		return "", fmt.Errorf("found multiple devices %v for the volumeID: %q", matches, volumeID)
+	}
+
+	devicePath := path.Join("/dev", matches[0])
+	klog.V(4).Infof("Found disk attached as %q by its serial; full devicepath: %s", matches[0], devicePath)
+	return devicePath, nil
+}
+
+// deviceMatchesVolume checks the serial of virtio-blk devices and the serial and WWN of SCSI devices. Depending on
+// the hypervisor, the serial is either the volume ID or its first 20 characters.
+func deviceMatchesVolume(devicePath string, volumeID string) bool {
+	serials := []string{volumeID}
+	if len(volumeID) > 20 {
+		serials = append(serials, volumeID[:20])
+	}
+	matchesSerial := func(serial string) bool {
+		for _, s := range serials {
+			if serial == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	// virtio-blk
+	if serial, err := os.ReadFile(path.Join(devicePath, "serial")); err == nil && matchesSerial(strings.TrimSpace(string(serial))) {
+		return true
+	}
+
+	// SCSI unit serial number VPD page, the serial follows the 4 bytes header.
+	if page, err := os.ReadFile(path.Join(devicePath, "device", "vpd_pg80")); err == nil && len(page) > 4 && matchesSerial(strings.TrimSpace(string(page[4:]))) {
+		return true
+	}
+
+	// SCSI device identification, e.g. "t10.QEMU    QEMU HARDDISK   <serial>".
+	if data, err := os.ReadFile(path.Join(devicePath, "device", "wwid")); err == nil {
+		wwid := strings.TrimSpace(string(data))
+		if fields := strings.Fields(wwid); strings.HasPrefix(wwid, "t10.") && len(fields) > 1 && matchesSerial(fields[len(fields)-1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getDevicePathBySerialID returns the path of an attached block storage volume, specified by its id.
+func getDevicePathBySerialID(volumeID string) string {
 	// Build a list of candidate device paths.
 	// Certain Nova drivers will set the disk serial ID, including the Cinder volume id.
 	candidateDeviceNodes := []string{
@@ -165,7 +337,7 @@ func (m *Mount) getDevicePathBySerialID(volumeID string) string {
 		fmt.Sprintf("wwn-0x%s", strings.Replace(volumeID, "-", "", -1)),
 	}
 
-	files, err := os.ReadDir("/dev/disk/by-id/")
+	files, err := os.ReadDir(diskByIDPath)
 	if err != nil {
 		klog.V(4).Infof("ReadDir failed with error %v", err)
 	}
@@ -174,8 +346,8 @@ func (m *Mount) getDevicePathBySerialID(volumeID string) string {
 		for _, c := range candidateDeviceNodes {
 			if c == f.Name() {
 				klog.V(4).Infof("Found disk attached as %q; full devicepath: %s\n",
-					f.Name(), path.Join("/dev/disk/by-id/", f.Name()))
-				return path.Join("/dev/disk/by-id/", f.Name())
+					f.Name(), path.Join(diskByIDPath, f.Name()))
+				return path.Join(diskByIDPath, f.Name())
 			}
 		}
 	}
@@ -184,6 +356,127 @@ func (m *Mount) getDevicePathBySerialID(volumeID string) string {
 	return ""
 }
 
+// getDevicePathByNovaDevice returns the device name returned by Nova when attaching the volume. The name is only a
+// hint given to the hypervisor, e.g. libvirt doesn't honour it, so the device must exist and mustn't report the serial
+// of another volume. Devices without serial are accepted, the other strategies can't find them anyway.
+// Nova names the devices after the bus it asked for, e.g. /dev/vdb, so with devicePathPrefix, e.g. /dev/sd, the same
+// device letter is tried with the prefix first, e.g. /dev/sdb, then the name returned by Nova.
+func getDevicePathByNovaDevice(volumeID, novaDevicePath, devicePathPrefix string) string {
+	if novaDevicePath == "" {
+		return ""
+	}
+
+	for _, name := range novaDeviceCandidates(path.Base(novaDevicePath), devicePathPrefix) {
+		sysfsPath := path.Join(sysBlockPath, name)
+		if _, err := os.Stat(sysfsPath); err != nil {
+			klog.V(4).Infof("Device %s for the device %s returned by Nova for the volumeID: %q doesn't exist: %v", name, novaDevicePath, volumeID, err)
+			continue
+		}
+		if !deviceMatchesVolume(sysfsPath, volumeID) && deviceHasSerial(sysfsPath) {
+			klog.V(4).Infof("Device %s for the device %s returned by Nova for the volumeID: %q belongs to another volume", name, novaDevicePath, volumeID)
+			continue
+		}
+
+		devicePath := path.Join("/dev", name)
+		klog.V(4).Infof("Found disk attached as %q by the device name returned by Nova; full devicepath: %s", name, devicePath)
+		return devicePath
+	}
+	return ""
+}
+
+// novaDeviceTypes are the prefixes of the device names returned by Nova, xvd before vd as it ends with it.
+var novaDeviceTypes = []string{"xvd", "vd", "sd", "hd"}
+
+// novaDeviceCandidates returns the kernel device names to try for the device name returned by Nova, the name with the
+// device path prefix first if it's not already named with it.
+func novaDeviceCandidates(name, devicePathPrefix string) []string {
+	prefix := strings.TrimPrefix(devicePathPrefix, "/dev/")
+	if prefix == "" || strings.HasPrefix(name, prefix) {
+		return []string{name}
+	}
+	for _, t := range novaDeviceTypes {
+		if suffix := strings.TrimPrefix(name, t); suffix != name && suffix != "" {
+			return []string{prefix + suffix, name}
+		}
+	}
+	return []string{name}
+}
+
+// filterDevicePathPrefix keeps the device names with the device path prefix, unless none has it.
+func filterDevicePathPrefix(names []string, devicePathPrefix string) []string {
+	prefix := strings.TrimPrefix(devicePathPrefix, "/dev/")
+	if prefix == "" {
+		return names
+	}
+	var preferred []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			preferred = append(preferred, name)
+		}
+	}
+	if len(preferred) == 0 {
+		return names
+	}
+	return preferred
+}
+
+// deviceHasSerial checks if the device reports any of the serials checked by deviceMatchesVolume.
+func deviceHasSerial(devicePath string) bool {
+	for _, attr := range []string{"serial", "device/vpd_pg80", "device/wwid"} {
+		data, err := os.ReadFile(path.Join(devicePath, attr))
+		if err != nil {
+			continue
+		}
+		if attr == "device/vpd_pg80" && len(data) > 4 {
+			data = data[4:]
+		}
+		if strings.TrimSpace(string(data)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// stableDevicePath returns a udev link of the kernel device, e.g. /dev/vdb, if there's one, as the kernel device names
+// depend on the order the devices are probed in and can change across reboots. The link is checked to point to the
+// device, so that a stale link is never returned.
+func stableDevicePath(devicePath string) string {
+	if !strings.HasPrefix(devicePath, "/dev/") || strings.HasPrefix(devicePath, diskByIDPath) {
+		return devicePath
+	}
+
+	files, err := os.ReadDir(diskByIDPath)
+	if err != nil {
+		return devicePath
+	}
+
+	var links []string
+	for _, f := range files {
+		link := path.Join(diskByIDPath, f.Name())
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(diskByIDPath, target)
+		}
+		if target == devicePath {
+			links = append(links, link)
+		}
+	}
+	if len(links) == 0 {
+		return devicePath
+	}
+
+	// The links are sorted by name, prefer the virtio and SCSI ones holding the serial to the WWN ones.
+	for _, link := range links {
+		if !strings.HasPrefix(path.Base(link), "wwn-") {
+			return link
+		}
+	}
+	return links[0]
+}
+
 // ScanForAttach
 func (m *Mount) ScanForAttach(devicePath string) error {
 	ticker := time.NewTicker(probeVolumeDuration)
@@ -295,3 +588,53 @@ func (m *Mount) GetDeviceStats(path string) (*DeviceStats, error) {
 		UsedInodes:      int64(statfs.Files) - int64(statfs.Ffree),
 	}, nil
 }
+
+// CheckMountHealth returns an error describing why the filesystem mounted at path is unhealthy, nil if it's healthy. A
+// filesystem is unhealthy when the kernel remounted it read-only behind the back of the mount, e.g. ext4 with
+// errors=remount-ro after I/O errors, or when reading its root directory fails with an I/O error.
+func (m *Mount) CheckMountHealth(path string) error {
+	infos, err := mount.ParseMountInfo(procMountInfoPath)
+	if err != nil {
+		// Not a problem of the filesystem, the read probe still applies.
+		klog.Warningf("Failed to read %s to check the mount %s: %v", procMountInfoPath, path, err)
+	} else if err := checkReadOnlyRemount(infos, path); err != nil {
+		return err
+	}
+
+	return probeRead(path)
+}
+
+// checkReadOnlyRemount returns an error if the filesystem of the topmost mount at path was remounted read-only. Mounting
+// read-only, as done for read-only attachments, sets both the per-mount and the superblock options to ro, while a
+// read-only bind mount only sets the per-mount one. Only the kernel turns the superblock read-only under a read-write
+// mount.
+func checkReadOnlyRemount(infos []mount.MountInfo, path string) error {
+	path = filepath.Clean(path)
+	var info *mount.MountInfo
+	for i := range infos {
+		if infos[i].MountPoint == path {
+			info = &infos[i]
+		}
+	}
+	if info == nil {
+		return nil
+	}
+
+	if slices.Contains(info.MountOptions, "rw") && slices.Contains(info.SuperOptions, "ro") {
+		return fmt.Errorf("filesystem %s mounted at %s was remounted read-only", info.Source, path)
+	}
+	return nil
+}
+
+// probeRead reads an entry of the directory at path, reporting I/O errors of the filesystem.
+func probeRead(path string) error {
+	f, err := os.Open(path)
+	if err == nil {
+		_, err = f.Readdirnames(1)
+		_ = f.Close()
+	}
+	if errors.Is(err, syscall.EIO) {
+		return fmt.Errorf("I/O error reading filesystem mounted at %s: %v", path, err)
+	}
+	return nil
+}
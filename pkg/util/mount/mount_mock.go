@@ -109,20 +109,20 @@ func (_m *MountMock) ScanForAttach(devicePath string) error {
 	return r0
 }
 
-// GetDevicePath provides a mock function with given fields: volumeID
-func (_m *MountMock) GetDevicePath(volumeID string) (string, error) {
-	ret := _m.Called(volumeID)
+// GetDevicePath provides a mock function with given fields: volumeID, novaDevicePath, strategy, devicePathPrefix
+func (_m *MountMock) GetDevicePath(volumeID string, novaDevicePath string, strategy string, devicePathPrefix string) (string, error) {
+	ret := _m.Called(volumeID, novaDevicePath, strategy, devicePathPrefix)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(string) string); ok {
-		r0 = rf(volumeID)
+	if rf, ok := ret.Get(0).(func(string, string, string, string) string); ok {
+		r0 = rf(volumeID, novaDevicePath, strategy, devicePathPrefix)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(volumeID)
+	if rf, ok := ret.Get(1).(func(string, string, string, string) error); ok {
+		r1 = rf(volumeID, novaDevicePath, strategy, devicePathPrefix)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -195,3 +195,10 @@ func (_m *MountMock) MakeFile(pathname string) error {
 func (_m *MountMock) GetMountFs(pathname string) ([]byte, error) {
 	return []byte("devicepath"), nil
 }
+
+// CheckMountHealth provides a mock function with given fields: path
+func (_m *MountMock) CheckMountHealth(path string) error {
+	ret := _m.Called(path)
+
+	return ret.Error(0)
+}
@@ -0,0 +1,444 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/mount-utils"
+)
+
+const fakeVolumeID = "b7bf9b1c-7ab5-4b2b-9a3e-5d6f7a8b9c0d"
+
+// writeSysfs creates the given attribute files of a fake /sys/block layout.
+func writeSysfs(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetDevicePathBySysfs(t *testing.T) {
+	tests := []struct {
+		name             string
+		files            map[string]string
+		devicePathPrefix string
+		expected         string
+		expectErr        bool
+	}{
+		{
+			name: "virtio-blk with truncated serial",
+			files: map[string]string{
+				"vda/serial": "\n",
+				"vdb/serial": "other-volume-id-0000\n",
+				"vdc/serial": fakeVolumeID[:20] + "\n",
+			},
+			expected: "/dev/vdc",
+		},
+		{
+			name: "virtio-blk with full serial",
+			files: map[string]string{
+				"vdb/serial": fakeVolumeID + "\n",
+			},
+			expected: "/dev/vdb",
+		},
+		{
+			name: "virtio-scsi serial VPD page",
+			files: map[string]string{
+				"sda/device/vpd_pg80": "\x00\x80\x00\x24" + fakeVolumeID,
+				"sdb/device/vpd_pg80": "\x00\x80\x00\x24" + "other-volume-id",
+			},
+			expected: "/dev/sda",
+		},
+		{
+			name: "virtio-scsi t10 identifier",
+			files: map[string]string{
+				"sda/device/wwid": "t10.QEMU    QEMU HARDDISK   other-volume-id-0000\n",
+				"sdb/device/wwid": "t10.QEMU    QEMU HARDDISK   " + fakeVolumeID[:20] + "\n",
+			},
+			expected: "/dev/sdb",
+		},
+		{
+			name: "WWN derived from the volume ID",
+			files: map[string]string{
+				"sda/device/wwid": "naa.b7bf9b1c7ab54b2b9a3e5d6f7a8b9c0d\n",
+			},
+			expected: "",
+		},
+		{
+			name: "device not attached yet",
+			files: map[string]string{
+				"vda/serial":          "\n",
+				"sda/device/wwid":     "naa.6000c2900000000000000000000000000\n",
+				"sdb/device/vpd_pg80": "\x00\x80",
+			},
+			expected: "",
+		},
+		{
+			name: "virtio-blk and SCSI devices of the volume",
+			files: map[string]string{
+				"sda/device/vpd_pg80": "\x00\x80\x00\x24" + fakeVolumeID,
+				"vdb/serial":          fakeVolumeID[:20] + "\n",
+			},
+			expectErr: true,
+		},
+		{
+			name: "SCSI devices of the volume with the /dev/sd prefix",
+			files: map[string]string{
+				"sda/device/vpd_pg80": "\x00\x80\x00\x24" + fakeVolumeID,
+				"sdb/device/wwid":     "t10.QEMU    QEMU HARDDISK   " + fakeVolumeID[:20] + "\n",
+			},
+			devicePathPrefix: "/dev/sd",
+			expectErr:        true,
+		},
+		{
+			name: "virtio-blk and SCSI devices of the volume with the /dev/vd prefix",
+			files: map[string]string{
+				"sda/device/vpd_pg80": "\x00\x80\x00\x24" + fakeVolumeID,
+				"vdb/serial":          fakeVolumeID[:20] + "\n",
+			},
+			devicePathPrefix: "/dev/vd",
+			expected:         "/dev/vdb",
+		},
+		{
+			name: "virtio-blk and SCSI devices of the volume with the /dev/sd prefix",
+			files: map[string]string{
+				"sda/device/vpd_pg80": "\x00\x80\x00\x24" + fakeVolumeID,
+				"vdb/serial":          fakeVolumeID[:20] + "\n",
+			},
+			devicePathPrefix: "/dev/sd",
+			expected:         "/dev/sda",
+		},
+		{
+			name: "no device with the prefix",
+			files: map[string]string{
+				"vdb/serial": fakeVolumeID[:20] + "\n",
+			},
+			devicePathPrefix: "/dev/sd",
+			expected:         "/dev/vdb",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sysBlockPath = t.TempDir()
+			defer func() { sysBlockPath = "/sys/block" }()
+			writeSysfs(t, sysBlockPath, test.files)
+
+			devicePath, err := getDevicePathBySysfs(fakeVolumeID, test.devicePathPrefix)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, devicePath)
+		})
+	}
+}
+
+func TestGetDevicePathByNovaDevice(t *testing.T) {
+	tests := []struct {
+		name             string
+		files            map[string]string
+		novaDevicePath   string
+		devicePathPrefix string
+		expected         string
+	}{
+		{
+			name: "device without serial",
+			files: map[string]string{
+				"vda/serial": "\n",
+				"vdb/serial": "other-volume-id-0000\n",
+				"vdc/size":   "2097152\n",
+			},
+			novaDevicePath: "/dev/vdc",
+			expected:       "/dev/vdc",
+		},
+		{
+			name: "device with the serial of the volume",
+			files: map[string]string{
+				"vdb/serial": "other-volume-id-0000\n",
+				"vdc/serial": fakeVolumeID[:20] + "\n",
+			},
+			novaDevicePath: "/dev/vdc",
+			expected:       "/dev/vdc",
+		},
+		{
+			name: "device with the serial of another volume",
+			files: map[string]string{
+				"vdb/serial": "other-volume-id-0000\n",
+				"vdc/serial": fakeVolumeID[:20] + "\n",
+			},
+			novaDevicePath: "/dev/vdb",
+			expected:       "",
+		},
+		{
+			name: "SCSI device with the serial of another volume",
+			files: map[string]string{
+				"sda/device/vpd_pg80": "\x00\x80\x00\x24" + "other-volume-id",
+				"sdb/device/vpd_pg80": "\x00\x80",
+			},
+			novaDevicePath: "/dev/sda",
+			expected:       "",
+		},
+		{
+			name: "device doesn't exist",
+			files: map[string]string{
+				"vda/serial": "\n",
+				"vdb/serial": "other-volume-id-0000\n",
+			},
+			novaDevicePath: "/dev/vdc",
+			expected:       "",
+		},
+		{
+			name: "no device returned by Nova",
+			files: map[string]string{
+				"vdb/size": "2097152\n",
+			},
+			expected: "",
+		},
+		{
+			name: "SCSI device named as virtio-blk by Nova with the /dev/sd prefix",
+			files: map[string]string{
+				"sda/device/wwid": "t10.QEMU    QEMU HARDDISK   other-volume-id-0000\n",
+				"sdc/size":        "2097152\n",
+			},
+			novaDevicePath:   "/dev/vdc",
+			devicePathPrefix: "/dev/sd",
+			expected:         "/dev/sdc",
+		},
+		{
+			name: "virtio-blk device named as SCSI by Nova with the /dev/vd prefix",
+			files: map[string]string{
+				"vdb/size": "2097152\n",
+			},
+			novaDevicePath:   "/dev/sdb",
+			devicePathPrefix: "/dev/vd",
+			expected:         "/dev/vdb",
+		},
+		{
+			name: "device with the prefix of another volume",
+			files: map[string]string{
+				"sdc/device/wwid": "t10.QEMU    QEMU HARDDISK   other-volume-id-0000\n",
+				"vdc/size":        "2097152\n",
+			},
+			novaDevicePath:   "/dev/vdc",
+			devicePathPrefix: "/dev/sd",
+			expected:         "/dev/vdc",
+		},
+		{
+			name: "no device with the prefix",
+			files: map[string]string{
+				"vdc/size": "2097152\n",
+			},
+			novaDevicePath:   "/dev/vdc",
+			devicePathPrefix: "/dev/sd",
+			expected:         "/dev/vdc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sysBlockPath = t.TempDir()
+			defer func() { sysBlockPath = "/sys/block" }()
+			writeSysfs(t, sysBlockPath, test.files)
+
+			assert.Equal(t, test.expected, getDevicePathByNovaDevice(fakeVolumeID, test.novaDevicePath, test.devicePathPrefix))
+		})
+	}
+}
+
+func TestFindDevicePath(t *testing.T) {
+	files := map[string]string{
+		"vda/serial": "\n",
+		"vdb/serial": "other-volume-id-0000\n",
+		"vdc/serial": fakeVolumeID[:20] + "\n",
+		"vdd/size":   "2097152\n",
+	}
+	links := map[string]string{
+		"virtio-other-volume-id-0000": "/dev/vdb",
+		"virtio-" + fakeVolumeID[:20]: "/dev/vdc",
+	}
+
+	tests := []struct {
+		name           string
+		novaDevicePath string
+		strategy       string
+		expected       string
+	}{
+		{
+			name:     "auto",
+			strategy: DeviceDiscoveryAuto,
+			expected: "virtio-" + fakeVolumeID[:20],
+		},
+		{
+			name:     "sysfs",
+			strategy: DeviceDiscoverySysfs,
+			expected: "virtio-" + fakeVolumeID[:20],
+		},
+		{
+			name:     "by-id",
+			strategy: DeviceDiscoveryByID,
+			expected: "virtio-" + fakeVolumeID[:20],
+		},
+		{
+			name:           "Nova device with the serial of the volume",
+			novaDevicePath: "/dev/vdc",
+			strategy:       DeviceDiscoveryNovaDevice,
+			expected:       "virtio-" + fakeVolumeID[:20],
+		},
+		{
+			name:           "Nova device without serial",
+			novaDevicePath: "/dev/vdd",
+			strategy:       DeviceDiscoveryNovaDevice,
+			expected:       "/dev/vdd",
+		},
+		{
+			name:           "Nova device ignored when the serial matches another device",
+			novaDevicePath: "/dev/vdd",
+			strategy:       DeviceDiscoveryAuto,
+			expected:       "virtio-" + fakeVolumeID[:20],
+		},
+		{
+			name:           "Nova device of another volume",
+			novaDevicePath: "/dev/vdb",
+			strategy:       DeviceDiscoveryNovaDevice,
+			expected:       "",
+		},
+	}
+
+	sysBlockPath = t.TempDir()
+	diskByIDPath = t.TempDir()
+	defer func() {
+		sysBlockPath = "/sys/block"
+		diskByIDPath = "/dev/disk/by-id"
+	}()
+	writeSysfs(t, sysBlockPath, files)
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(diskByIDPath, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := test.expected
+			if expected != "" && !filepath.IsAbs(expected) {
+				expected = filepath.Join(diskByIDPath, expected)
+			}
+			devicePath, err := findDevicePath(fakeVolumeID, test.novaDevicePath, test.strategy, "")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, devicePath)
+		})
+	}
+}
+
+func TestValidateDevicePathPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "/dev/vd", "/dev/sd", "/dev/xvd"} {
+		assert.NoError(t, ValidateDevicePathPrefix(prefix), prefix)
+	}
+	for _, prefix := range []string{"sd", "/dev/", "/dev/disk/by-id/virtio-", "/sys/block/vd"} {
+		assert.Error(t, ValidateDevicePathPrefix(prefix), prefix)
+	}
+}
+
+func TestStableDevicePath(t *testing.T) {
+	diskByIDPath = t.TempDir()
+	defer func() { diskByIDPath = "/dev/disk/by-id" }()
+
+	links := map[string]string{
+		"wwn-0x6000c29000000000":     "/dev/sda",
+		"scsi-0QEMU_QEMU_HARDDISK_x": "/dev/sda",
+		"virtio-y":                   "/dev/vdb",
+		"virtio-y-part1":             "/dev/vdb1",
+		"wwn-0x6000c29000000001":     "/dev/sdb",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(diskByIDPath, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Equal(t, filepath.Join(diskByIDPath, "scsi-0QEMU_QEMU_HARDDISK_x"), stableDevicePath("/dev/sda"))
+	assert.Equal(t, filepath.Join(diskByIDPath, "wwn-0x6000c29000000001"), stableDevicePath("/dev/sdb"))
+	assert.Equal(t, filepath.Join(diskByIDPath, "virtio-y"), stableDevicePath("/dev/vdb"))
+	assert.Equal(t, "/dev/vdc", stableDevicePath("/dev/vdc"))
+	assert.Equal(t, "", stableDevicePath(""))
+}
+
+func TestCheckReadOnlyRemount(t *testing.T) {
+	target := "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount"
+	tests := []struct {
+		name        string
+		infos       []mount.MountInfo
+		expectedErr bool
+	}{
+		{
+			name:  "not mounted",
+			infos: []mount.MountInfo{{MountPoint: "/", MountOptions: []string{"rw"}, SuperOptions: []string{"ro"}}},
+		},
+		{
+			name:  "read-write",
+			infos: []mount.MountInfo{{Source: "/dev/vdb", MountPoint: target, MountOptions: []string{"rw", "relatime"}, SuperOptions: []string{"rw"}}},
+		},
+		{
+			name:  "read-only bind mount",
+			infos: []mount.MountInfo{{Source: "/dev/vdb", MountPoint: target, MountOptions: []string{"ro", "relatime"}, SuperOptions: []string{"rw"}}},
+		},
+		{
+			name:  "mounted read-only",
+			infos: []mount.MountInfo{{Source: "/dev/vdb", MountPoint: target, MountOptions: []string{"ro", "relatime"}, SuperOptions: []string{"ro"}}},
+		},
+		{
+			name:        "remounted read-only by the kernel",
+			infos:       []mount.MountInfo{{Source: "/dev/vdb", MountPoint: target, MountOptions: []string{"rw", "relatime"}, SuperOptions: []string{"ro", "errors=remount-ro"}}},
+			expectedErr: true,
+		},
+		{
+			name: "topmost mount checked",
+			infos: []mount.MountInfo{
+				{Source: "/dev/vdb", MountPoint: target, MountOptions: []string{"rw"}, SuperOptions: []string{"ro"}},
+				{Source: "/dev/vdc", MountPoint: target, MountOptions: []string{"rw"}, SuperOptions: []string{"rw"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkReadOnlyRemount(test.infos, target+"/")
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProbeRead(t *testing.T) {
+	assert.NoError(t, probeRead(t.TempDir()))
+	// Only I/O errors make the filesystem unhealthy
+	assert.NoError(t, probeRead(filepath.Join(t.TempDir(), "missing")))
+}
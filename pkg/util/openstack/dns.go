@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"github.com/gophercloud/gophercloud"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// FloatingIPPTRRecord is the PTR record of a floating IP. Designate finds the reverse zone of the address of the
+// floating IP itself. gophercloud doesn't support the PTR records of the floating IPs yet.
+type FloatingIPPTRRecord struct {
+	PTRDName    string `json:"ptrdname"`
+	Description string `json:"description"`
+}
+
+func floatingIPPTRRecordURL(client *gophercloud.ServiceClient, region, fipID string) string {
+	return client.ServiceURL("reverse", "floatingips", region+":"+fipID)
+}
+
+// GetFloatingIPPTRRecord gets the PTR record of the floating IP of the region, nil if it has none.
+func GetFloatingIPPTRRecord(client *gophercloud.ServiceClient, region, fipID string) (*FloatingIPPTRRecord, error) {
+	var record struct {
+		PTRDName    *string `json:"ptrdname"`
+		Description *string `json:"description"`
+	}
+	mc := metrics.NewMetricContext("floating_ip_ptr_record", "get")
+	_, err := client.Get(floatingIPPTRRecordURL(client, region, fipID), &record, nil)
+	if cpoerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	if record.PTRDName == nil {
+		return nil, nil
+	}
+
+	ptr := &FloatingIPPTRRecord{PTRDName: *record.PTRDName}
+	if record.Description != nil {
+		ptr.Description = *record.Description
+	}
+	return ptr, nil
+}
+
+// SetFloatingIPPTRRecord creates or updates the PTR record of the floating IP of the region.
+func SetFloatingIPPTRRecord(client *gophercloud.ServiceClient, region, fipID string, record FloatingIPPTRRecord) error {
+	mc := metrics.NewMetricContext("floating_ip_ptr_record", "update")
+	_, err := client.Patch(floatingIPPTRRecordURL(client, region, fipID), record, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200, 202},
+	})
+	return mc.ObserveRequest(err)
+}
+
+// UnsetFloatingIPPTRRecord removes the PTR record of the floating IP of the region.
+func UnsetFloatingIPPTRRecord(client *gophercloud.ServiceClient, region, fipID string) error {
+	mc := metrics.NewMetricContext("floating_ip_ptr_record", "delete")
+	_, err := client.Patch(floatingIPPTRRecordURL(client, region, fipID), map[string]interface{}{"ptrdname": nil}, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200, 202},
+	})
+	if cpoerrors.IsNotFound(err) {
+		return mc.ObserveRequest(nil)
+	}
+	return mc.ObserveRequest(err)
+}
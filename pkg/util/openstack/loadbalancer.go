@@ -17,9 +17,13 @@ limitations under the License.
 package openstack
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
@@ -31,7 +35,6 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
 	"github.com/gophercloud/gophercloud/pagination"
 	version "github.com/hashicorp/go-version"
-	"k8s.io/apimachinery/pkg/util/wait"
 	klog "k8s.io/klog/v2"
 
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
@@ -51,20 +54,125 @@ const (
 	waitLoadbalancerActiveSteps = 23
 	waitLoadbalancerDeleteSteps = 12
 
+	// immutableRetries is how many times the creation of a child of a load balancer is retried when Octavia rejects it
+	// as the load balancer is immutable, see createChild.
+	immutableRetries = 3
+
+	// DefaultStatusPollInterval and DefaultStatusPollMaxInterval are the default cadence of the polls of the
+	// provisioning status of the load balancers, see SetStatusPolling.
+	DefaultStatusPollInterval    = 1 * time.Second
+	DefaultStatusPollMaxInterval = 10 * time.Second
+
 	activeStatus = "ACTIVE"
 	errorStatus  = "ERROR"
 )
 
 var (
-	octaviaVersion string
+	// octaviaVersions are the Octavia API versions the features are picked by, per client: the negotiated one, or the
+	// current one of the API of the client. Octavia has no microversions, the requests don't depend on them.
+	octaviaVersions   = make(map[*gophercloud.ServiceClient]string)
+	octaviaVersionsMu sync.RWMutex
+
+	statusPollInterval    = DefaultStatusPollInterval
+	statusPollMaxInterval = DefaultStatusPollMaxInterval
+
+	// lbLocking tells if the changes of a load balancer are serialized, see SetLoadBalancerLocking.
+	lbLocking bool
 )
 
-// getOctaviaVersion returns the current Octavia API version.
+// lbLocks serializes the changes of a load balancer, Octavia rejects them while the load balancer isn't ACTIVE. Every
+// load balancer has its own lock, so that the changes of unrelated load balancers never wait for each other, e.g.
+// while one of them is waited for to be ACTIVE, and the locks are dropped once unused.
+var lbLocks = struct {
+	sync.Mutex
+	locks map[string]*lbLock
+}{locks: make(map[string]*lbLock)}
+
+type lbLock struct {
+	sync.Mutex
+	// users counts the changes holding or waiting for the lock.
+	users int
+}
+
+// SetLoadBalancerLocking sets whether the changes of a load balancer are serialized. They only need to be when the
+// ports of a Service are reconciled in parallel, the reconciles of a Service are serialized already.
+func SetLoadBalancerLocking(enabled bool) {
+	lbLocking = enabled
+}
+
+// lockLoadBalancer locks the load balancer for a change and returns the function unlocking it.
+func lockLoadBalancer(lbID string) func() {
+	if !lbLocking {
+		return func() {}
+	}
+
+	lbLocks.Lock()
+	lock, ok := lbLocks.locks[lbID]
+	if !ok {
+		lock = &lbLock{}
+		lbLocks.locks[lbID] = lock
+	}
+	lock.users++
+	lbLocks.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		lbLocks.Lock()
+		defer lbLocks.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(lbLocks.locks, lbID)
+		}
+	}
+}
+
+// octaviaFeatureVersions are the Octavia API versions the features were added in.
+var octaviaFeatureVersions = map[int]string{
+	OctaviaFeatureTags:              "v2.5",
+	OctaviaFeatureVIPACL:            "v2.12",
+	OctaviaFeatureFlavors:           "v2.6",
+	OctaviaFeatureTimeout:           "v2.1",
+	OctaviaFeatureAvailabilityZones: "v2.14",
+	OctaviaFeatureHTTPMonitorsOnUDP: "v2.16",
+}
+
+// octaviaFeatureNames are the names of the features used in error messages.
+var octaviaFeatureNames = map[int]string{
+	OctaviaFeatureTags:              "tags",
+	OctaviaFeatureVIPACL:            "VIP ACL",
+	OctaviaFeatureFlavors:           "flavors",
+	OctaviaFeatureTimeout:           "listener timeouts",
+	OctaviaFeatureAvailabilityZones: "availability zones",
+	OctaviaFeatureHTTPMonitorsOnUDP: "HTTP monitors on UDP pools",
+}
+
+// getOctaviaVersion returns the Octavia API version in use by the client, the current one of its API unless one was
+// negotiated.
 func getOctaviaVersion(client *gophercloud.ServiceClient) (string, error) {
-	if octaviaVersion != "" {
+	octaviaVersionsMu.RLock()
+	octaviaVersion, ok := octaviaVersions[client]
+	octaviaVersionsMu.RUnlock()
+	if ok {
 		return octaviaVersion, nil
 	}
 
+	octaviaVersion, err := getCurrentOctaviaVersion(client)
+	if err != nil {
+		return octaviaVersion, err
+	}
+	setOctaviaVersion(client, octaviaVersion)
+	return octaviaVersion, nil
+}
+
+func setOctaviaVersion(client *gophercloud.ServiceClient, octaviaVersion string) {
+	octaviaVersionsMu.Lock()
+	defer octaviaVersionsMu.Unlock()
+	octaviaVersions[client] = octaviaVersion
+}
+
+// getCurrentOctaviaVersion returns the current version of the Octavia API of the client.
+func getCurrentOctaviaVersion(client *gophercloud.ServiceClient) (string, error) {
 	var defaultVer = "0.0"
 	mc := metrics.NewMetricContext("version", "list")
 	allPages, err := apiversions.List(client).AllPages()
@@ -82,73 +190,156 @@ func getOctaviaVersion(client *gophercloud.ServiceClient) (string, error) {
 	klog.V(4).Infof("Found Octavia API versions: %v", versions)
 
 	// The current version is always the last one in the list
-	octaviaVersion = versions[len(versions)-1].ID
+	octaviaVersion := versions[len(versions)-1].ID
 	klog.V(4).Infof("The current Octavia API version: %v", octaviaVersion)
 
 	return octaviaVersion, nil
 }
 
-// IsOctaviaFeatureSupported returns true if the given feature is supported in the deployed Octavia version.
-func IsOctaviaFeatureSupported(client *gophercloud.ServiceClient, feature int, lbProvider string) bool {
+// NegotiateOctaviaVersion settles the Octavia API version used by the client to decide which features can be used.
+// It's the current version of the API, or the requested one if it's not later. The version only picks the features,
+// Octavia has no microversions.
+func NegotiateOctaviaVersion(client *gophercloud.ServiceClient, requested string) (string, error) {
+	return NegotiateOctaviaVersions([]*gophercloud.ServiceClient{client}, requested)
+}
+
+// NegotiateOctaviaVersions is NegotiateOctaviaVersion for the Octavia APIs of several regions. Without a requested
+// version, the lowest current version of them is used, so that only the features available in all the regions are.
+func NegotiateOctaviaVersions(clients []*gophercloud.ServiceClient, requested string) (string, error) {
+	var lowestVer string
+	var lowest *version.Version
+	for _, client := range clients {
+		currentVer, err := getCurrentOctaviaVersion(client)
+		if err != nil {
+			return "", fmt.Errorf("failed to get current Octavia API version: %v", err)
+		}
+		current, err := version.NewVersion(currentVer)
+		if err != nil {
+			return "", fmt.Errorf("invalid current Octavia API version %q: %v", currentVer, err)
+		}
+		if lowest == nil || current.LessThan(lowest) {
+			lowestVer, lowest = currentVer, current
+		}
+	}
+
+	negotiated := lowestVer
+	if requested != "" {
+		requestedVer, err := version.NewVersion(requested)
+		if err != nil {
+			return "", fmt.Errorf("invalid Octavia API version %q: %v", requested, err)
+		}
+		if requestedVer.GreaterThan(lowest) {
+			return "", fmt.Errorf("requested Octavia API version %s is not supported, the current version is %s", requested, lowestVer)
+		}
+		negotiated = "v" + strings.TrimPrefix(requested, "v")
+	}
+
+	for _, client := range clients {
+		setOctaviaVersion(client, negotiated)
+	}
+	return negotiated, nil
+}
+
+// CheckOctaviaFeature returns an error describing why the given feature can't be used with the deployed Octavia.
+func CheckOctaviaFeature(client *gophercloud.ServiceClient, feature int, lbProvider string) error {
+	minVersion, ok := octaviaFeatureVersions[feature]
+	if !ok {
+		return fmt.Errorf("feature %d not recognized", feature)
+	}
+	name := octaviaFeatureNames[feature]
+
+	// ovn-octavia-provider supports tags only
+	if lbProvider == "ovn" && feature != OctaviaFeatureTags {
+		return fmt.Errorf("%s are not supported by the ovn provider", name)
+	}
+
 	octaviaVer, err := getOctaviaVersion(client)
 	if err != nil {
 		klog.Warningf("Failed to get current Octavia API version: %v", err)
-		return false
+		return fmt.Errorf("failed to get current Octavia API version: %v", err)
 	}
 
 	currentVer, _ := version.NewVersion(octaviaVer)
+	featureVer, _ := version.NewVersion(minVersion)
+	if currentVer.LessThan(featureVer) {
+		return fmt.Errorf("%s require Octavia API version %s or later, the version in use is %s", name, minVersion, octaviaVer)
+	}
 
-	switch feature {
-	case OctaviaFeatureVIPACL:
-		if lbProvider == "ovn" {
-			return false
-		}
-		verACL, _ := version.NewVersion("v2.12")
-		if currentVer.GreaterThanOrEqual(verACL) {
-			return true
-		}
-	case OctaviaFeatureTags:
-		verTags, _ := version.NewVersion("v2.5")
-		if currentVer.GreaterThanOrEqual(verTags) {
-			return true
-		}
-	case OctaviaFeatureFlavors:
-		if lbProvider == "ovn" {
-			return false
-		}
-		verFlavors, _ := version.NewVersion("v2.6")
-		if currentVer.GreaterThanOrEqual(verFlavors) {
-			return true
-		}
-	case OctaviaFeatureTimeout:
-		if lbProvider == "ovn" {
-			return false
-		}
-		verFlavors, _ := version.NewVersion("v2.1")
-		if currentVer.GreaterThanOrEqual(verFlavors) {
-			return true
-		}
-	case OctaviaFeatureAvailabilityZones:
-		if lbProvider == "ovn" {
-			return false
-		}
-		verAvailabilityZones, _ := version.NewVersion("v2.14")
-		if currentVer.GreaterThanOrEqual(verAvailabilityZones) {
-			return true
-		}
-	case OctaviaFeatureHTTPMonitorsOnUDP:
-		if lbProvider == "ovn" {
-			return false
+	return nil
+}
+
+// IsOctaviaFeatureSupported returns true if the given feature is supported in the deployed Octavia version.
+func IsOctaviaFeatureSupported(client *gophercloud.ServiceClient, feature int, lbProvider string) bool {
+	err := CheckOctaviaFeature(client, feature, lbProvider)
+	if err != nil {
+		klog.V(4).Infof("Octavia feature %d is not supported: %v", feature, err)
+	}
+	return err == nil
+}
+
+// SetStatusPolling sets the cadence of the polls of the provisioning status of the load balancers waited for. They're
+// polled every interval while the status changes, and slow down up to maxInterval while it stays the same.
+func SetStatusPolling(interval, maxInterval time.Duration) {
+	statusPollInterval = interval
+	statusPollMaxInterval = maxInterval
+}
+
+// statusPoller paces the polls of the provisioning status of a load balancer. Octavia has no API notifying the changes
+// of the status, so it's polled: fast while the status changes, as the load balancer is expected to be ACTIVE soon,
+// slowing down while it stays the same, e.g. while the amphorae of a new load balancer boot.
+type statusPoller struct {
+	interval    time.Duration
+	maxInterval time.Duration
+	next        time.Duration
+	lastStatus  string
+}
+
+func newStatusPoller() *statusPoller {
+	return &statusPoller{interval: statusPollInterval, maxInterval: statusPollMaxInterval}
+}
+
+// nextInterval returns how long to wait before polling again a load balancer in the given status.
+func (p *statusPoller) nextInterval(status string) time.Duration {
+	if status != p.lastStatus {
+		p.lastStatus = status
+		p.next = p.interval
+	} else {
+		p.next = min(time.Duration(float64(p.next)*waitLoadbalancerFactor), p.maxInterval)
+	}
+	return p.next
+}
+
+// errStatusPollTimeout is returned by pollStatus when the load balancer didn't reach the status in time.
+var errStatusPollTimeout = errors.New("timed out polling the load balancer status")
+
+// pollStatus polls the provisioning status of a load balancer with get, until get is done or fails, or until timeout.
+func pollStatus(timeout time.Duration, get func() (status string, done bool, err error)) error {
+	poller := newStatusPoller()
+	deadline := time.Now().Add(timeout)
+	for {
+		status, done, err := get()
+		if done || err != nil {
+			return err
 		}
-		verHTTPMonitorsOnUDP, _ := version.NewVersion("v2.16")
-		if currentVer.GreaterThanOrEqual(verHTTPMonitorsOnUDP) {
-			return true
+		interval := poller.nextInterval(status)
+		if time.Now().Add(interval).After(deadline) {
+			return errStatusPollTimeout
 		}
-	default:
-		klog.Warningf("Feature %d not recognized", feature)
+		metrics.ObserveLoadBalancerStatusPoll(status, interval)
+		time.Sleep(interval)
 	}
+}
 
-	return false
+// getWaitTimeout returns how long to wait for a load balancer, the time the former exponential backoff took for the
+// given steps, so that OCCM_WAIT_LB_ACTIVE_STEPS keeps its meaning.
+func getWaitTimeout(steps int) time.Duration {
+	var timeout time.Duration
+	delay := waitLoadbalancerInitDelay
+	for i := 1; i < steps; i++ {
+		timeout += delay
+		delay = time.Duration(float64(delay) * waitLoadbalancerFactor)
+	}
+	return timeout
 }
 
 func getTimeoutSteps(name string, steps int) int {
@@ -165,38 +356,65 @@ func getTimeoutSteps(name string, steps int) int {
 func WaitActiveAndGetLoadBalancer(client *gophercloud.ServiceClient, loadbalancerID string) (*loadbalancers.LoadBalancer, error) {
 	klog.InfoS("Waiting for load balancer ACTIVE", "lbID", loadbalancerID)
 	steps := getTimeoutSteps("OCCM_WAIT_LB_ACTIVE_STEPS", waitLoadbalancerActiveSteps)
-	backoff := wait.Backoff{
-		Duration: waitLoadbalancerInitDelay,
-		Factor:   waitLoadbalancerFactor,
-		Steps:    steps,
-	}
 
 	var loadbalancer *loadbalancers.LoadBalancer
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+	err := pollStatus(getWaitTimeout(steps), func() (string, bool, error) {
 		mc := metrics.NewMetricContext("loadbalancer", "get")
 		var err error
 		loadbalancer, err = loadbalancers.Get(client, loadbalancerID).Extract()
 		if mc.ObserveRequest(err) != nil {
-			return false, err
+			return "", false, err
 		}
 		if loadbalancer.ProvisioningStatus == activeStatus {
 			klog.InfoS("Load balancer ACTIVE", "lbID", loadbalancerID)
-			return true, nil
+			return activeStatus, true, nil
 		} else if loadbalancer.ProvisioningStatus == errorStatus {
-			return true, fmt.Errorf("loadbalancer %s has gone into ERROR state", loadbalancerID)
+			return errorStatus, true, fmt.Errorf("loadbalancer %s has gone into ERROR state", loadbalancerID)
 		} else {
-			return false, nil
+			return loadbalancer.ProvisioningStatus, false, nil
 		}
-
 	})
 
-	if wait.Interrupted(err) {
+	if errors.Is(err, errStatusPollTimeout) {
 		err = fmt.Errorf("timeout waiting for the loadbalancer %s %s", loadbalancerID, activeStatus)
 	}
 
 	return loadbalancer, err
 }
 
+// isImmutableError tells if Octavia rejected the change as the load balancer is immutable, i.e. in a PENDING_* state.
+func isImmutableError(err error) bool {
+	var conflict gophercloud.ErrDefault409
+	return errors.As(err, &conflict) && bytes.Contains(conflict.Body, []byte("immutable"))
+}
+
+// createChild creates a child of the load balancer, e.g. a listener or a pool, with create once the load balancer is
+// ACTIVE, as Octavia rejects the changes of a load balancer in a PENDING_* state, e.g. right after its creation. A
+// creation rejected anyway as the load balancer is immutable, e.g. as another client changed it in the meantime, is
+// retried after waiting again, up to OCCM_LB_IMMUTABLE_RETRIES times. The load balancer is ACTIVE again on success.
+func createChild(client *gophercloud.ServiceClient, lbID string, resource string, create func() error) error {
+	retries := getTimeoutSteps("OCCM_LB_IMMUTABLE_RETRIES", immutableRetries)
+	for attempt := 0; ; attempt++ {
+		if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+			return fmt.Errorf("failed to wait for load balancer %s ACTIVE before creating %s: %v", lbID, resource, err)
+		}
+
+		err := create()
+		if err == nil {
+			break
+		}
+		if !isImmutableError(err) || attempt >= retries {
+			return err
+		}
+		klog.InfoS("Load balancer is immutable, retrying", "lbID", lbID, "resource", resource, "attempt", attempt+1)
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after creating %s: %v", lbID, resource, err)
+	}
+	return nil
+}
+
 // GetLoadBalancers returns all the filtered load balancer.
 func GetLoadBalancers(client *gophercloud.ServiceClient, opts loadbalancers.ListOpts) ([]loadbalancers.LoadBalancer, error) {
 	mc := metrics.NewMetricContext("loadbalancer", "list")
@@ -223,6 +441,21 @@ func GetLoadbalancerByID(client *gophercloud.ServiceClient, lbID string) (*loadb
 	return lb, nil
 }
 
+// GetLoadBalancerStatusTree retrieves the status tree of a load balancer, i.e. its listeners with their pools and the
+// members of the pools.
+func GetLoadBalancerStatusTree(client *gophercloud.ServiceClient, lbID string) (*loadbalancers.LoadBalancer, error) {
+	mc := metrics.NewMetricContext("loadbalancer_status", "get")
+	tree, err := loadbalancers.GetStatuses(client, lbID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	if tree.Loadbalancer == nil {
+		return nil, fmt.Errorf("no status tree returned for load balancer %s", lbID)
+	}
+
+	return tree.Loadbalancer, nil
+}
+
 // GetLoadbalancerByName retrieves loadbalancer object
 func GetLoadbalancerByName(client *gophercloud.ServiceClient, name string) (*loadbalancers.LoadBalancer, error) {
 	opts := loadbalancers.ListOpts{
@@ -250,6 +483,8 @@ func GetLoadbalancerByName(client *gophercloud.ServiceClient, name string) (*loa
 
 // UpdateLoadBalancerTags updates tags for the load balancer
 func UpdateLoadBalancerTags(client *gophercloud.ServiceClient, lbID string, tags []string) error {
+	defer lockLoadBalancer(lbID)()
+
 	updateOpts := loadbalancers.UpdateOpts{
 		Tags: &tags,
 	}
@@ -267,27 +502,115 @@ func UpdateLoadBalancerTags(client *gophercloud.ServiceClient, lbID string, tags
 	return nil
 }
 
+// UpdateLoadBalancerDescription updates the description of the load balancer
+func UpdateLoadBalancerDescription(client *gophercloud.ServiceClient, lbID string, description string) error {
+	defer lockLoadBalancer(lbID)()
+
+	updateOpts := loadbalancers.UpdateOpts{
+		Description: &description,
+	}
+
+	mc := metrics.NewMetricContext("loadbalancer", "update")
+	_, err := loadbalancers.Update(client, lbID, updateOpts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating: %v", lbID, err)
+	}
+
+	return nil
+}
+
+// UpdateLoadBalancerName updates the name of the load balancer
+func UpdateLoadBalancerName(client *gophercloud.ServiceClient, lbID string, name string) error {
+	defer lockLoadBalancer(lbID)()
+
+	updateOpts := loadbalancers.UpdateOpts{
+		Name: &name,
+	}
+
+	mc := metrics.NewMetricContext("loadbalancer", "update")
+	_, err := loadbalancers.Update(client, lbID, updateOpts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating: %v", lbID, err)
+	}
+
+	return nil
+}
+
+// UpdateLoadBalancerAdminState updates the administrative state of the load balancer
+func UpdateLoadBalancerAdminState(client *gophercloud.ServiceClient, lbID string, adminStateUp bool) error {
+	defer lockLoadBalancer(lbID)()
+
+	updateOpts := loadbalancers.UpdateOpts{
+		AdminStateUp: &adminStateUp,
+	}
+
+	mc := metrics.NewMetricContext("loadbalancer", "update")
+	_, err := loadbalancers.Update(client, lbID, updateOpts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating: %v", lbID, err)
+	}
+
+	return nil
+}
+
+// UpdateLoadBalancerVipQosPolicy updates the QoS policy of the load balancer VIP, an empty policy ID removes it
+func UpdateLoadBalancerVipQosPolicy(client *gophercloud.ServiceClient, lbID string, policyID string) error {
+	defer lockLoadBalancer(lbID)()
+
+	// loadbalancers.UpdateOpts can't send null, which is how Octavia removes the QoS policy.
+	var vipQosPolicyID interface{}
+	if policyID != "" {
+		vipQosPolicyID = policyID
+	}
+	body := map[string]interface{}{
+		"loadbalancer": map[string]interface{}{
+			"vip_qos_policy_id": vipQosPolicyID,
+		},
+	}
+
+	mc := metrics.NewMetricContext("loadbalancer", "update")
+	_, err := client.Put(client.ServiceURL("lbaas", "loadbalancers", lbID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200, 202},
+	})
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating: %v", lbID, err)
+	}
+
+	return nil
+}
+
 func waitLoadbalancerDeleted(client *gophercloud.ServiceClient, loadbalancerID string) error {
 	klog.V(4).InfoS("Waiting for load balancer deleted", "lbID", loadbalancerID)
-	backoff := wait.Backoff{
-		Duration: waitLoadbalancerInitDelay,
-		Factor:   waitLoadbalancerFactor,
-		Steps:    waitLoadbalancerDeleteSteps,
-	}
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+	err := pollStatus(getWaitTimeout(waitLoadbalancerDeleteSteps), func() (string, bool, error) {
 		mc := metrics.NewMetricContext("loadbalancer", "get")
-		_, err := loadbalancers.Get(client, loadbalancerID).Extract()
+		loadbalancer, err := loadbalancers.Get(client, loadbalancerID).Extract()
 		if err != nil {
 			if cpoerrors.IsNotFound(err) {
 				klog.V(4).InfoS("Load balancer deleted", "lbID", loadbalancerID)
-				return true, mc.ObserveRequest(nil)
+				return "", true, mc.ObserveRequest(nil)
 			}
-			return false, mc.ObserveRequest(err)
+			return "", false, mc.ObserveRequest(err)
 		}
-		return false, mc.ObserveRequest(nil)
+		return loadbalancer.ProvisioningStatus, false, mc.ObserveRequest(nil)
 	})
 
-	if wait.Interrupted(err) {
+	if errors.Is(err, errStatusPollTimeout) {
 		err = fmt.Errorf("loadbalancer failed to delete within the allotted time")
 	}
 
@@ -318,6 +641,8 @@ func DeleteLoadbalancer(client *gophercloud.ServiceClient, lbID string, cascade
 
 // UpdateListener updates a listener and wait for the lb active
 func UpdateListener(client *gophercloud.ServiceClient, lbID string, listenerID string, opts listeners.UpdateOpts) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_listener", "update")
 	_, err := listeners.Update(client, listenerID, opts).Extract()
 	if mc.ObserveRequest(err) != nil {
@@ -333,14 +658,17 @@ func UpdateListener(client *gophercloud.ServiceClient, lbID string, listenerID s
 
 // CreateListener creates a new listener
 func CreateListener(client *gophercloud.ServiceClient, lbID string, opts listeners.CreateOpts) (*listeners.Listener, error) {
-	mc := metrics.NewMetricContext("loadbalancer_listener", "create")
-	listener, err := listeners.Create(client, opts).Extract()
-	if mc.ObserveRequest(err) != nil {
-		return nil, err
-	}
+	defer lockLoadBalancer(lbID)()
 
-	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
-		return nil, fmt.Errorf("failed to wait for load balancer %s ACTIVE after creating listener: %v", lbID, err)
+	var listener *listeners.Listener
+	err := createChild(client, lbID, "listener", func() error {
+		mc := metrics.NewMetricContext("loadbalancer_listener", "create")
+		var err error
+		listener, err = listeners.Create(client, opts).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return listener, nil
@@ -348,6 +676,8 @@ func CreateListener(client *gophercloud.ServiceClient, lbID string, opts listene
 
 // DeleteListener deletes a listener.
 func DeleteListener(client *gophercloud.ServiceClient, listenerID string, lbID string) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_listener", "delete")
 	if err := listeners.Delete(client, listenerID).ExtractErr(); mc.ObserveRequest(err) != nil {
 		if cpoerrors.IsNotFound(err) {
@@ -419,14 +749,17 @@ func GetListenersByLoadBalancerID(client *gophercloud.ServiceClient, lbID string
 
 // CreatePool creates a new pool.
 func CreatePool(client *gophercloud.ServiceClient, opts pools.CreateOptsBuilder, lbID string) (*pools.Pool, error) {
-	mc := metrics.NewMetricContext("loadbalancer_pool", "create")
-	pool, err := pools.Create(client, opts).Extract()
-	if mc.ObserveRequest(err) != nil {
-		return nil, err
-	}
+	defer lockLoadBalancer(lbID)()
 
-	if _, err = WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
-		return nil, fmt.Errorf("failed to wait for load balancer ACTIVE after creating pool: %v", err)
+	var pool *pools.Pool
+	err := createChild(client, lbID, "pool", func() error {
+		mc := metrics.NewMetricContext("loadbalancer_pool", "create")
+		var err error
+		pool, err = pools.Create(client, opts).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return pool, nil
@@ -547,6 +880,8 @@ func GetMembersbyPool(client *gophercloud.ServiceClient, poolID string) ([]pools
 
 // DeletePool deletes a pool.
 func DeletePool(client *gophercloud.ServiceClient, poolID string, lbID string) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_pool", "delete")
 	if err := pools.Delete(client, poolID).ExtractErr(); mc.ObserveRequest(err) != nil {
 		if cpoerrors.IsNotFound(err) {
@@ -562,8 +897,81 @@ func DeletePool(client *gophercloud.ServiceClient, poolID string, lbID string) e
 	return nil
 }
 
+// UpdatePool updates a pool and wait for the lb active
+func UpdatePool(client *gophercloud.ServiceClient, lbID string, poolID string, opts pools.UpdateOpts) error {
+	defer lockLoadBalancer(lbID)()
+
+	mc := metrics.NewMetricContext("loadbalancer_pool", "update")
+	_, err := pools.Update(client, poolID, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating pool %s: %v", lbID, poolID, err)
+	}
+
+	return nil
+}
+
+// SessionPersistence is the session persistence of a pool, including the settings of UDP and SCTP pools that
+// gophercloud doesn't support yet.
+type SessionPersistence struct {
+	Type               string `json:"type"`
+	CookieName         string `json:"cookie_name,omitempty"`
+	PersistenceTimeout int    `json:"persistence_timeout,omitempty"`
+}
+
+type sessionPersistenceUpdateOpts struct {
+	persistence *SessionPersistence
+}
+
+// ToPoolUpdateMap sends the session persistence even if it's nil, as that's how Octavia disables it.
+func (opts sessionPersistenceUpdateOpts) ToPoolUpdateMap() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"pool": map[string]interface{}{
+			"session_persistence": opts.persistence,
+		},
+	}, nil
+}
+
+// GetPoolSessionPersistence retrieves the session persistence of a pool, nil if it's disabled.
+func GetPoolSessionPersistence(client *gophercloud.ServiceClient, poolID string) (*SessionPersistence, error) {
+	var s struct {
+		Pool struct {
+			Persistence *SessionPersistence `json:"session_persistence"`
+		} `json:"pool"`
+	}
+	mc := metrics.NewMetricContext("loadbalancer_pool", "get")
+	err := pools.Get(client, poolID).ExtractInto(&s)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return s.Pool.Persistence, nil
+}
+
+// UpdatePoolSessionPersistence sets the session persistence of a pool, nil disables it.
+func UpdatePoolSessionPersistence(client *gophercloud.ServiceClient, lbID string, poolID string, persistence *SessionPersistence) error {
+	defer lockLoadBalancer(lbID)()
+
+	mc := metrics.NewMetricContext("loadbalancer_pool", "update")
+	_, err := pools.Update(client, poolID, sessionPersistenceUpdateOpts{persistence: persistence}).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating pool %s: %v", lbID, poolID, err)
+	}
+
+	return nil
+}
+
 // BatchUpdatePoolMembers updates pool members in batch.
 func BatchUpdatePoolMembers(client *gophercloud.ServiceClient, lbID string, poolID string, opts []pools.BatchUpdateMemberOpts) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_members", "update")
 	err := pools.BatchUpdateMembers(client, poolID, opts).ExtractErr()
 	if mc.ObserveRequest(err) != nil {
@@ -600,21 +1008,43 @@ func GetL7policies(client *gophercloud.ServiceClient, listenerID string) ([]l7po
 
 // CreateL7Policy creates a l7 policy.
 func CreateL7Policy(client *gophercloud.ServiceClient, opts l7policies.CreateOpts, lbID string) (*l7policies.L7Policy, error) {
-	mc := metrics.NewMetricContext("loadbalancer_l7policy", "create")
-	policy, err := l7policies.Create(client, opts).Extract()
-	if mc.ObserveRequest(err) != nil {
+	defer lockLoadBalancer(lbID)()
+
+	var policy *l7policies.L7Policy
+	err := createChild(client, lbID, "l7policy", func() error {
+		mc := metrics.NewMetricContext("loadbalancer_l7policy", "create")
+		var err error
+		policy, err = l7policies.Create(client, opts).Extract()
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	if _, err = WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
-		return nil, fmt.Errorf("failed to wait for load balancer ACTIVE after creating l7policy: %v", err)
+	return policy, nil
+}
+
+// UpdateL7Policy updates a l7 policy.
+func UpdateL7Policy(client *gophercloud.ServiceClient, lbID string, policyID string, opts l7policies.UpdateOpts) error {
+	defer lockLoadBalancer(lbID)()
+
+	mc := metrics.NewMetricContext("loadbalancer_l7policy", "update")
+	_, err := l7policies.Update(client, policyID, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return err
+	}
+
+	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
+		return fmt.Errorf("failed to wait for load balancer %s ACTIVE after updating l7policy: %v", lbID, err)
 	}
 
-	return policy, nil
+	return nil
 }
 
 // DeleteL7policy deletes a l7 policy.
 func DeleteL7policy(client *gophercloud.ServiceClient, policyID string, lbID string) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_l7policy", "delete")
 	if err := l7policies.Delete(client, policyID).ExtractErr(); mc.ObserveRequest(err) != nil {
 		return err
@@ -644,21 +1074,19 @@ func GetL7Rules(client *gophercloud.ServiceClient, policyID string) ([]l7policie
 
 // CreateL7Rule creates a l7 rule.
 func CreateL7Rule(client *gophercloud.ServiceClient, policyID string, opts l7policies.CreateRuleOpts, lbID string) error {
-	mc := metrics.NewMetricContext("loadbalancer_l7rule", "create")
-	_, err := l7policies.CreateRule(client, policyID, opts).Extract()
-	if mc.ObserveRequest(err) != nil {
-		return err
-	}
-
-	if _, err = WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
-		return fmt.Errorf("failed to wait for load balancer ACTIVE after creating l7policy rule: %v", err)
-	}
+	defer lockLoadBalancer(lbID)()
 
-	return nil
+	return createChild(client, lbID, "l7policy rule", func() error {
+		mc := metrics.NewMetricContext("loadbalancer_l7rule", "create")
+		_, err := l7policies.CreateRule(client, policyID, opts).Extract()
+		return mc.ObserveRequest(err)
+	})
 }
 
 // UpdateHealthMonitor updates a health monitor.
 func UpdateHealthMonitor(client *gophercloud.ServiceClient, monitorID string, opts monitors.UpdateOpts, lbID string) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_healthmonitor", "update")
 	_, err := monitors.Update(client, monitorID, opts).Extract()
 	if mc.ObserveRequest(err) != nil {
@@ -674,6 +1102,8 @@ func UpdateHealthMonitor(client *gophercloud.ServiceClient, monitorID string, op
 
 // DeleteHealthMonitor deletes a health monitor.
 func DeleteHealthMonitor(client *gophercloud.ServiceClient, monitorID string, lbID string) error {
+	defer lockLoadBalancer(lbID)()
+
 	mc := metrics.NewMetricContext("loadbalancer_healthmonitor", "delete")
 	err := monitors.Delete(client, monitorID).ExtractErr()
 	if err != nil && !cpoerrors.IsNotFound(err) {
@@ -689,14 +1119,20 @@ func DeleteHealthMonitor(client *gophercloud.ServiceClient, monitorID string, lb
 
 // CreateHealthMonitor creates a health monitor in a pool.
 func CreateHealthMonitor(client *gophercloud.ServiceClient, opts monitors.CreateOpts, lbID string) (*monitors.Monitor, error) {
-	mc := metrics.NewMetricContext("loadbalancer_healthmonitor", "create")
-	monitor, err := monitors.Create(client, opts).Extract()
-	if mc.ObserveRequest(err) != nil {
-		return nil, fmt.Errorf("failed to create healthmonitor: %v", err)
-	}
+	defer lockLoadBalancer(lbID)()
 
-	if _, err := WaitActiveAndGetLoadBalancer(client, lbID); err != nil {
-		return nil, fmt.Errorf("failed to wait for load balancer %s ACTIVE after creating healthmonitor: %v", lbID, err)
+	var monitor *monitors.Monitor
+	err := createChild(client, lbID, "healthmonitor", func() error {
+		mc := metrics.NewMetricContext("loadbalancer_healthmonitor", "create")
+		var err error
+		monitor, err = monitors.Create(client, opts).Extract()
+		if mc.ObserveRequest(err) != nil {
+			return fmt.Errorf("failed to create healthmonitor: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return monitor, nil
@@ -707,6 +1143,9 @@ func GetHealthMonitor(client *gophercloud.ServiceClient, monitorID string) (*mon
 	mc := metrics.NewMetricContext("loadbalancer_healthmonitor", "get")
 	monitor, err := monitors.Get(client, monitorID).Extract()
 	if mc.ObserveRequest(err) != nil {
+		if cpoerrors.IsNotFound(err) {
+			return nil, cpoerrors.ErrNotFound
+		}
 		return nil, fmt.Errorf("failed to get healthmonitor: %v", err)
 	}
 
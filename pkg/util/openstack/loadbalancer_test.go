@@ -0,0 +1,276 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStatusPollerNextInterval(t *testing.T) {
+	poller := &statusPoller{interval: time.Second, maxInterval: 2 * time.Second}
+
+	// Fast while the status changes, slowing down while it stays the same
+	assert.Equal(t, time.Second, poller.nextInterval("PENDING_CREATE"))
+	assert.Equal(t, 1200*time.Millisecond, poller.nextInterval("PENDING_CREATE"))
+	assert.Equal(t, 1440*time.Millisecond, poller.nextInterval("PENDING_CREATE"))
+	assert.Equal(t, 1728*time.Millisecond, poller.nextInterval("PENDING_CREATE"))
+	assert.Equal(t, 2*time.Second, poller.nextInterval("PENDING_CREATE"))
+	assert.Equal(t, 2*time.Second, poller.nextInterval("PENDING_CREATE"))
+	assert.Equal(t, time.Second, poller.nextInterval("PENDING_UPDATE"))
+}
+
+func TestGetWaitTimeout(t *testing.T) {
+	assert.Equal(t, time.Duration(0), getWaitTimeout(1))
+	assert.Equal(t, 2200*time.Millisecond, getWaitTimeout(3))
+	// The default steps wait for about 4.5 minutes
+	assert.InDelta(t, 271*time.Second, getWaitTimeout(waitLoadbalancerActiveSteps), float64(time.Second))
+}
+
+func TestWaitActiveAndGetLoadBalancer(t *testing.T) {
+	SetStatusPolling(time.Millisecond, 2*time.Millisecond)
+	defer SetStatusPolling(DefaultStatusPollInterval, DefaultStatusPollMaxInterval)
+
+	tests := []struct {
+		name        string
+		statuses    []string
+		expectedErr string
+	}{
+		{
+			name:     "active after pending",
+			statuses: []string{"PENDING_UPDATE", "PENDING_UPDATE", "ACTIVE"},
+		},
+		{
+			name:        "error",
+			statuses:    []string{"PENDING_UPDATE", "ERROR"},
+			expectedErr: "loadbalancer lb-id has gone into ERROR state",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			polls := 0
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodGet)
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "%s"}}`, test.statuses[polls])
+				polls++
+			})
+
+			client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+			lb, err := WaitActiveAndGetLoadBalancer(client, "lb-id")
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "ACTIVE", lb.ProvisioningStatus)
+			}
+			assert.Equal(t, len(test.statuses), polls)
+		})
+	}
+}
+
+func TestCreateListenerImmutable(t *testing.T) {
+	SetStatusPolling(time.Millisecond, 2*time.Millisecond)
+	defer SetStatusPolling(DefaultStatusPollInterval, DefaultStatusPollMaxInterval)
+
+	tests := []struct {
+		name            string
+		statuses        []string
+		immutableCreate int
+		expectedCreates int
+		expectedErr     string
+	}{
+		{
+			name:            "waits for the new load balancer",
+			statuses:        []string{"PENDING_CREATE", "PENDING_CREATE", "ACTIVE", "PENDING_UPDATE", "ACTIVE"},
+			expectedCreates: 1,
+		},
+		{
+			name:            "retries while immutable",
+			statuses:        []string{"ACTIVE", "PENDING_UPDATE", "ACTIVE", "ACTIVE", "ACTIVE"},
+			immutableCreate: 2,
+			expectedCreates: 3,
+		},
+		{
+			name:            "gives up once the retries are exhausted",
+			statuses:        []string{"ACTIVE", "ACTIVE", "ACTIVE", "ACTIVE"},
+			immutableCreate: 4,
+			expectedCreates: 4,
+			expectedErr:     "Load Balancer lb-id is immutable and cannot be updated.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			polls := 0
+			th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "%s"}}`, test.statuses[polls])
+				polls++
+			})
+			creates := 0
+			th.Mux.HandleFunc("/lbaas/listeners", func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, http.MethodPost)
+				creates++
+				w.Header().Add("Content-Type", "application/json")
+				if creates <= test.immutableCreate {
+					w.WriteHeader(http.StatusConflict)
+					fmt.Fprint(w, `{"faultcode": "Client", "faultstring": "Load Balancer lb-id is immutable and cannot be updated.", "debuginfo": null}`)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"listener": {"id": "listener-id"}}`)
+			})
+
+			client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+			listener, err := CreateListener(client, "lb-id", listeners.CreateOpts{LoadbalancerID: "lb-id", Protocol: listeners.ProtocolTCP, ProtocolPort: 80})
+			if test.expectedErr != "" {
+				assert.ErrorContains(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "listener-id", listener.ID)
+			}
+			assert.Equal(t, test.expectedCreates, creates)
+			assert.Equal(t, len(test.statuses), polls)
+		})
+	}
+}
+
+func TestLockLoadBalancerPerID(t *testing.T) {
+	SetStatusPolling(time.Millisecond, 2*time.Millisecond)
+	defer SetStatusPolling(DefaultStatusPollInterval, DefaultStatusPollMaxInterval)
+	SetLoadBalancerLocking(true)
+	defer SetLoadBalancerLocking(false)
+
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// lb-1 stays PENDING_UPDATE until released, lb-2 is ACTIVE.
+	waiting := make(chan struct{})
+	release := make(chan struct{})
+	var waitingOnce sync.Once
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-1", func(w http.ResponseWriter, r *http.Request) {
+		status := "ACTIVE"
+		select {
+		case <-release:
+		default:
+			status = "PENDING_UPDATE"
+			waitingOnce.Do(func() { close(waiting) })
+		}
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"loadbalancer": {"id": "lb-1", "provisioning_status": "%s"}}`, status)
+	})
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"loadbalancer": {"id": "lb-2", "provisioning_status": "ACTIVE"}}`)
+	})
+	th.Mux.HandleFunc("/lbaas/listeners", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"listener": {"id": "listener-id"}}`)
+	})
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+
+	lb1Done := make(chan error)
+	go func() {
+		_, err := CreateListener(client, "lb-1", listeners.CreateOpts{LoadbalancerID: "lb-1", Protocol: listeners.ProtocolTCP, ProtocolPort: 80})
+		lb1Done <- err
+	}()
+	<-waiting
+
+	// lb-1 holds its lock while it's waited for to be ACTIVE, lb-2 has its own.
+	lb2Done := make(chan error)
+	go func() {
+		_, err := CreateListener(client, "lb-2", listeners.CreateOpts{LoadbalancerID: "lb-2", Protocol: listeners.ProtocolTCP, ProtocolPort: 80})
+		lb2Done <- err
+	}()
+	select {
+	case err := <-lb2Done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change of lb-2 waited for lb-1")
+	}
+
+	close(release)
+	assert.NoError(t, <-lb1Done)
+
+	// The locks are dropped once unused.
+	lbLocks.Lock()
+	assert.Empty(t, lbLocks.locks)
+	lbLocks.Unlock()
+}
+
+func TestSeriallyReconcilePoolMembersNodePortChange(t *testing.T) {
+	SetStatusPolling(time.Millisecond, 2*time.Millisecond)
+	defer SetStatusPolling(DefaultStatusPollInterval, DefaultStatusPollMaxInterval)
+
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/lbaas/loadbalancers/lb-id", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"loadbalancer": {"id": "lb-id", "provisioning_status": "ACTIVE"}}`)
+	})
+	var created []string
+	th.Mux.HandleFunc("/lbaas/pools/pool-id/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"members": [{"id": "old-member", "address": "10.0.0.1", "protocol_port": 30080}]}`)
+		case http.MethodPost:
+			th.TestJSONRequest(t, r, `{"member": {"name": "member_node-1_10.0.0.1_30081", "address": "10.0.0.1", "protocol_port": 30081}}`)
+			created = append(created, "new-member")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"member": {"id": "new-member", "address": "10.0.0.1", "protocol_port": 30081}}`)
+		}
+	})
+	var deleted []string
+	th.Mux.HandleFunc("/lbaas/pools/pool-id/members/old-member", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, "old-member")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// The member of the node on the old node port is replaced by one on the reallocated node port.
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: th.Endpoint()}
+	nodes := []*apiv1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     apiv1.NodeStatus{Addresses: []apiv1.NodeAddress{{Type: apiv1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}}
+	err := SeriallyReconcilePoolMembers(client, &pools.Pool{ID: "pool-id"}, 30081, "lb-id", nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new-member"}, created)
+	assert.Equal(t, []string{"old-member"}, deleted)
+}
@@ -129,6 +129,22 @@ func GetFloatingNetworkID(client *gophercloud.ServiceClient) (string, error) {
 	return "", mc.ObserveRequest(cpoerrors.ErrNotFound)
 }
 
+// IsExternalNetwork tells if the network is external, e.g. a provider network with addresses routable without FIPs.
+func IsExternalNetwork(client *gophercloud.ServiceClient, networkID string) (bool, error) {
+	var network struct {
+		networks.Network
+		external.NetworkExternalExt
+	}
+
+	mc := metrics.NewMetricContext("network", "get")
+	err := networks.Get(client, networkID).ExtractInto(&network)
+	if mc.ObserveRequest(err) != nil {
+		return false, err
+	}
+
+	return network.External, nil
+}
+
 // getSubnet checks if a Subnet is present in the list of Subnets the tenant has access to and returns it
 func getSubnet(networkSubnet string, subnetList []subnets.Subnet) *subnets.Subnet {
 	for _, subnet := range subnetList {
@@ -153,3 +169,54 @@ func GetPorts(client *gophercloud.ServiceClient, listOpts neutronports.ListOpts)
 
 	return allPorts, nil
 }
+
+// QosPolicyExists tells if the Neutron QoS policy exists. gophercloud doesn't support QoS policies yet.
+func QosPolicyExists(client *gophercloud.ServiceClient, policyID string) (bool, error) {
+	mc := metrics.NewMetricContext("qos_policy", "get")
+	_, err := client.Get(client.ServiceURL("qos", "policies", policyID), nil, nil)
+	if cpoerrors.IsNotFound(err) {
+		return false, nil
+	}
+	if mc.ObserveRequest(err) != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type floatingIPQosPolicyUpdateOpts struct {
+	policyID string
+}
+
+// ToFloatingIPUpdateMap sends the QoS policy even if it's empty, as null is how Neutron removes it.
+func (opts floatingIPQosPolicyUpdateOpts) ToFloatingIPUpdateMap() (map[string]interface{}, error) {
+	var policyID interface{}
+	if opts.policyID != "" {
+		policyID = opts.policyID
+	}
+	return map[string]interface{}{
+		"floatingip": map[string]interface{}{
+			"qos_policy_id": policyID,
+		},
+	}, nil
+}
+
+// GetFloatingIPQosPolicyID returns the Neutron QoS policy of the floating IP, empty if it has none. gophercloud doesn't
+// support the QoS policies of the floating IPs yet.
+func GetFloatingIPQosPolicyID(client *gophercloud.ServiceClient, fipID string) (string, error) {
+	var s struct {
+		QosPolicyID string `json:"qos_policy_id"`
+	}
+	mc := metrics.NewMetricContext("floating_ip", "get")
+	err := floatingips.Get(client, fipID).ExtractInto(&s)
+	if mc.ObserveRequest(err) != nil {
+		return "", err
+	}
+	return s.QosPolicyID, nil
+}
+
+// UpdateFloatingIPQosPolicy sets the Neutron QoS policy of the floating IP, an empty policyID removes it.
+func UpdateFloatingIPQosPolicy(client *gophercloud.ServiceClient, fipID string, policyID string) error {
+	mc := metrics.NewMetricContext("floating_ip", "update")
+	_, err := floatingips.Update(client, fipID, floatingIPQosPolicyUpdateOpts{policyID: policyID}).Extract()
+	return mc.ObserveRequest(err)
+}
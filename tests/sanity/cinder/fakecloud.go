@@ -7,8 +7,10 @@ import (
 	"time"
 
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/backups"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
@@ -18,6 +20,7 @@ import (
 type cloud struct {
 	volumes   map[string]*volumes.Volume
 	snapshots map[string]*snapshots.Snapshot
+	backups   map[string]*backups.Backup
 	instances map[string]*servers.Server
 }
 
@@ -25,6 +28,7 @@ func getfakecloud() *cloud {
 	return &cloud{
 		volumes:   make(map[string]*volumes.Volume, 0),
 		snapshots: make(map[string]*snapshots.Snapshot, 0),
+		backups:   make(map[string]*backups.Backup, 0),
 		instances: make(map[string]*servers.Server, 0),
 	}
 }
@@ -32,7 +36,7 @@ func getfakecloud() *cloud {
 var _ openstack.IOpenStack = &cloud{}
 
 // Fake Cloud
-func (cloud *cloud) CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourceVolID string, tags *map[string]string) (*volumes.Volume, error) {
+func (cloud *cloud) CreateVolume(name string, size int, vtype, availability string, snapshotID string, sourceVolID string, tags *map[string]string, schedulerHints map[string]interface{}) (*volumes.Volume, error) {
 
 	vol := &volumes.Volume{
 		ID:               randString(10),
@@ -107,6 +111,26 @@ func (cloud *cloud) DetachVolume(instanceID, volumeID string) error {
 	return nil
 }
 
+func (cloud *cloud) DetachVolumeAttachment(volumeID, attachmentID string) error {
+	return nil
+}
+
+func (cloud *cloud) AttachVolumeToHost(volumeID, hostName string) error {
+	return nil
+}
+
+func (cloud *cloud) DetachVolumeFromHost(volumeID, hostName string) error {
+	return nil
+}
+
+func (cloud *cloud) InitializeConnection(volumeID string, connector openstack.Connector) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (cloud *cloud) TerminateConnection(volumeID string, connector openstack.Connector) error {
+	return nil
+}
+
 func (cloud *cloud) WaitDiskDetached(instanceID string, volumeID string) error {
 	return nil
 }
@@ -224,6 +248,42 @@ func (cloud *cloud) WaitSnapshotReady(snapshotID string) error {
 	return nil
 }
 
+func (cloud *cloud) CreateBackup(name, volID, snapshotID string, tags map[string]string) (*backups.Backup, error) {
+	backup := &backups.Backup{
+		ID:         randString(10),
+		Name:       name,
+		Status:     "available",
+		VolumeID:   volID,
+		SnapshotID: snapshotID,
+	}
+
+	cloud.backups[backup.ID] = backup
+	return backup, nil
+}
+
+func (cloud *cloud) GetBackupsByName(name string) ([]backups.Backup, error) {
+	var backuplist []backups.Backup
+	for _, value := range cloud.backups {
+		if value.Name == name {
+			backuplist = append(backuplist, *value)
+		}
+	}
+	return backuplist, nil
+}
+
+func (cloud *cloud) DeleteBackup(backupID string) error {
+	delete(cloud.backups, backupID)
+	return nil
+}
+
+func (cloud *cloud) WaitBackupReady(backupID string) error {
+	return nil
+}
+
+func (cloud *cloud) CreateVolumeFromBackup(name string, size int, vtype, availability, backupID string, tags map[string]string) (*volumes.Volume, error) {
+	return cloud.CreateVolume(name, size, vtype, availability, "", "", &tags, nil)
+}
+
 func randString(n int) string {
 	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	b := make([]byte, n)
@@ -250,6 +310,49 @@ func (cloud *cloud) ExpandVolume(volumeID string, status string, size int) error
 	return nil
 }
 
+func (cloud *cloud) GetVolumeType(nameOrID string) (*volumetypes.VolumeType, error) {
+	return &volumetypes.VolumeType{ID: nameOrID, Name: nameOrID}, nil
+}
+
+func (cloud *cloud) GetVolumeTypes() ([]volumetypes.VolumeType, error) {
+	return nil, nil
+}
+
+func (cloud *cloud) GetQoSVolumeTypes(qosNameOrID string) ([]volumetypes.VolumeType, error) {
+	return []volumetypes.VolumeType{{ID: qosNameOrID, Name: qosNameOrID}}, nil
+}
+
+func (cloud *cloud) ChangeVolumeType(volumeID string, volumeType string, migrationPolicy string) error {
+	vol, ok := cloud.volumes[volumeID]
+
+	if !ok {
+		return notFoundError()
+	}
+
+	vol.VolumeType = volumeType
+
+	return nil
+}
+
+func (cloud *cloud) SetVolumeReadOnly(volumeID string, readOnly bool) error {
+	vol, ok := cloud.volumes[volumeID]
+
+	if !ok {
+		return notFoundError()
+	}
+
+	if vol.Metadata == nil {
+		vol.Metadata = make(map[string]string)
+	}
+	vol.Metadata[openstack.VolumeReadOnlyKey] = strconv.FormatBool(readOnly)
+
+	return nil
+}
+
+func (cloud *cloud) GetStoragePools() ([]openstack.StoragePool, error) {
+	return []openstack.StoragePool{{Name: "fake@fake#fake", VolumeBackendName: "fake", AvailabilityZone: "nova", FreeCapacityGB: 1024}}, nil
+}
+
 func (cloud *cloud) GetMaxVolLimit() int64 {
 	return 256
 }
@@ -51,7 +51,7 @@ func (m *fakemount) GetInstanceID() (string, error) {
 	return cinder.FakeInstanceID, nil
 }
 
-func (m *fakemount) GetDevicePath(volumeID string) (string, error) {
+func (m *fakemount) GetDevicePath(volumeID, novaDevicePath, strategy, devicePathPrefix string) (string, error) {
 	return cinder.FakeDevicePath, nil
 }
 
@@ -71,3 +71,7 @@ func (m *fakemount) GetDeviceStats(path string) (*cpomount.DeviceStats, error) {
 func (m *fakemount) GetMountFs(pathname string) ([]byte, error) {
 	return []byte("aaa"), nil
 }
+
+func (m *fakemount) CheckMountHealth(path string) error {
+	return nil
+}
@@ -34,5 +34,6 @@ func TestDriver(t *testing.T) {
 
 	config := sanity.NewTestConfig()
 	config.Address = endpoint
+	config.TestVolumeMutableParameters = map[string]string{"type": "fast"}
 	sanity.Test(t, config)
 }
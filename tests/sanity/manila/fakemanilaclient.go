@@ -214,6 +214,25 @@ func (c fakeManilaClient) GrantAccess(shareID string, opts shares.GrantAccessOpt
 	return accessRight, nil
 }
 
+func (c fakeManilaClient) RevokeAccess(shareID string, opts shares.RevokeAccessOptsBuilder) error {
+	if !shareExists(shareID) {
+		return gophercloud.ErrResourceNotFound{}
+	}
+
+	optsMap, err := opts.ToRevokeAccessMap()
+	if err != nil {
+		return err
+	}
+
+	accessID := optsMap["deny_access"].(map[string]interface{})["access_id"].(string)
+	if _, ok := fakeAccessRights[strToInt(accessID)]; !ok {
+		return gophercloud.ErrResourceNotFound{}
+	}
+
+	delete(fakeAccessRights, strToInt(accessID))
+	return nil
+}
+
 func (c fakeManilaClient) GetSnapshotByID(snapID string) (*snapshots.Snapshot, error) {
 	s, ok := fakeSnapshots[strToInt(snapID)]
 	if !ok {
@@ -274,3 +293,16 @@ func (c fakeManilaClient) DeleteSnapshot(snapID string) error {
 func (c fakeManilaClient) GetUserMessages(opts messages.ListOptsBuilder) ([]messages.Message, error) {
 	return nil, nil
 }
+
+func (c fakeManilaClient) GetShareNetworksByNeutronSubnet(neutronNetID, neutronSubnetID string) ([]manilaclient.ShareNetwork, error) {
+	return nil, nil
+}
+
+func (c fakeManilaClient) CreateShareNetwork(name, description, neutronNetID, neutronSubnetID string) (*manilaclient.ShareNetwork, error) {
+	return &manilaclient.ShareNetwork{
+		ID:              "fake-share-network",
+		Name:            name,
+		NeutronNetID:    neutronNetID,
+		NeutronSubnetID: neutronSubnetID,
+	}, nil
+}